@@ -7,6 +7,7 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
 	gwapiv1a2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
@@ -211,6 +212,557 @@ type AIGatewayRouteSpec struct {
 	// +optional
 	// +kubebuilder:validation:MaxItems=36
 	LLMRequestCosts []LLMRequestCost `json:"llmRequestCosts,omitempty"`
+
+	// Authorization restricts the models of this AIGatewayRoute each caller can use and the max tokens of their
+	// requests based on a claim of the caller, such as the groups of the user.
+	//
+	// The requests to the models not allowed for the caller are rejected with 403 Forbidden, and the "/v1/models"
+	// endpoint only lists the models the caller can use.
+	//
+	// Currently, this only applies to the models declared by the exact match of the "x-ai-eg-model" header in the rules.
+	//
+	// +optional
+	Authorization *AIGatewayRouteAuthorization `json:"authorization,omitempty"`
+
+	// Guardrails configures the guardrails inspecting the requests to the models of this AIGatewayRoute before they
+	// are sent to the backends, and their responses before they are returned to the clients.
+	//
+	// Currently, this only applies to the models declared by the exact match of the "x-ai-eg-model" header in the rules.
+	//
+	// +optional
+	Guardrails *AIGatewayRouteGuardrails `json:"guardrails,omitempty"`
+
+	// RequestLimits limits the size and the parameters of the chat completion requests to the models of this
+	// AIGatewayRoute, e.g. to prevent a single request with a huge max_tokens from exhausting the budget.
+	//
+	// Currently, this only applies to the models declared by the exact match of the "x-ai-eg-model" header in the rules.
+	//
+	// +optional
+	RequestLimits *AIGatewayRouteRequestLimits `json:"requestLimits,omitempty"`
+
+	// ToolPolicy governs the tools of the chat completion requests to the models of this AIGatewayRoute, and the tool
+	// calls made by the models in their responses, which are often run by the agents without any review.
+	//
+	// Currently, this only applies to the models declared by the exact match of the "x-ai-eg-model" header in the rules.
+	//
+	// +optional
+	ToolPolicy *AIGatewayRouteToolPolicy `json:"toolPolicy,omitempty"`
+
+	// AuditLog records the chat completion requests to the models of this AIGatewayRoute and their responses in the
+	// audit log for the compliance review. This has no effect unless the audit log is enabled on the controller.
+	//
+	// Currently, this only applies to the models declared by the exact match of the "x-ai-eg-model" header in the rules.
+	//
+	// +optional
+	AuditLog *AIGatewayRouteAuditLog `json:"auditLog,omitempty"`
+
+	// MetricAttributes is the list of the attributes extracted from the requests to the models of this AIGatewayRoute,
+	// such as the team or the API key of the caller, added to the GenAI metrics, i.e., the token usage, the request
+	// duration, the time to first token and the time per output token. The name of the attribute in the metrics is
+	// prefixed with "ai_gateway.", e.g., "ai_gateway.team".
+	//
+	// Since each distinct value creates new time series, the values should be bounded by the allowed values or the
+	// max values of each attribute.
+	//
+	// Currently, this only applies to the models declared by the exact match of the "x-ai-eg-model" header in the rules.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=8
+	MetricAttributes []AIGatewayRouteMetricAttribute `json:"metricAttributes,omitempty"`
+
+	// Capture writes the chat completion requests to the models of this AIGatewayRoute to the disk of the external
+	// processor for debugging, such as the translation issues of the backends. Each capture has the request after the
+	// modifications by the gateway, e.g., the redaction of the PII and the secrets, the translated request and the raw
+	// response of each backend, and the response returned to the client, which can be replayed through the translators
+	// offline by the `aigw replay` command. This has no effect unless the capture directory is configured on the
+	// controller, and the captures are no longer written once the directory reaches its limits.
+	//
+	// Since the captures contain the prompts and the completions as they are, this should only be enabled temporarily.
+	//
+	// Currently, this only applies to the models declared by the exact match of the "x-ai-eg-model" header in the rules.
+	//
+	// +optional
+	Capture *AIGatewayRouteCapture `json:"capture,omitempty"`
+
+	// ResponseCache caches the successful chat completion responses of the models of this AIGatewayRoute, and returns
+	// the cached response to the identical requests without sending them to the backends, such as the deterministic
+	// prompts sent repeatedly by the evaluation jobs. The requests are identical when their bodies are the same JSON
+	// regardless of the order of the fields and the whitespaces. The streaming requests are answered with the cached
+	// server-sent events.
+	//
+	// The responses served from the cache have the "x-ai-eg-cache: hit" header and cost zero tokens in the
+	// llmRequestCosts. The clients can bypass the cache with the "Cache-Control: no-cache" header, or prevent their
+	// responses from being cached with the "Cache-Control: no-store" header.
+	//
+	// The embeddings requests are cached per input string, so that only the inputs missing the cache are sent to the
+	// backend and the response is stitched together with the cached embeddings. The maxEntryBytes then applies to the
+	// embedding of each input.
+	//
+	// The cache is in the memory of each external processor by default, which can be replaced with the server speaking
+	// the Redis protocol on the controller.
+	//
+	// Currently, this only applies to the models declared by the exact match of the "x-ai-eg-model" header in the rules.
+	//
+	// +optional
+	ResponseCache *AIGatewayRouteResponseCache `json:"responseCache,omitempty"`
+}
+
+// AIGatewayRouteResponseCache configures the cache of the chat completion responses.
+type AIGatewayRouteResponseCache struct {
+	// TTL is the duration for which the cached response is returned.
+	//
+	// Default is 5m.
+	//
+	// +optional
+	// +kubebuilder:default="5m"
+	TTL *gwapiv1.Duration `json:"ttl,omitempty"`
+
+	// MaxEntryBytes is the maximum size of the response body to be cached. The larger responses are not cached.
+	//
+	// Default is 1048576 (1MiB).
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1048576
+	MaxEntryBytes *int32 `json:"maxEntryBytes,omitempty"`
+
+	// Scope specifies the callers sharing the cached responses. When this is not set, the cached responses are
+	// shared by all the callers of the route.
+	//
+	// +optional
+	Scope *AIGatewayRouteResponseCacheScope `json:"scope,omitempty"`
+
+	// Semantic enables the semantic cache, which also returns the cached response to the requests whose last user
+	// message is similar enough to the one of a cached request, such as the paraphrased questions to a support bot.
+	// The requests must still be identical except for the text of the last user message.
+	//
+	// By default, only the identical requests hit the cache.
+	//
+	// +optional
+	Semantic *AIGatewayRouteSemanticCache `json:"semantic,omitempty"`
+}
+
+// AIGatewayRouteSemanticCache configures the semantic cache of the chat completion responses.
+//
+// The last user message of the request is embedded with the embedding model through the embeddings endpoint of the
+// Gateway, so the embedding model must be served by an AIGatewayRoute of the same Gateway. The embeddings are kept in
+// the memory of each external processor and compared by the cosine similarity, while the responses are stored in the
+// same place as the other cached responses.
+//
+// +kubebuilder:validation:XValidation:rule="!has(self.endpoint) || self.endpoint.startsWith('http://') || self.endpoint.startsWith('https://')",message="endpoint must be an http or https URL"
+type AIGatewayRouteSemanticCache struct {
+	// EmbeddingModel is the name of the embedding model, such as "text-embedding-3-small".
+	//
+	// +kubebuilder:validation:MinLength=1
+	EmbeddingModel string `json:"embeddingModel"`
+
+	// Endpoint is the URL of the embeddings endpoint of the Gateway reachable from the external processor, which runs
+	// alongside Envoy in the same pod. The request carries the "Authorization" header of the original request.
+	//
+	// Default is "http://127.0.0.1:10080/v1/embeddings", which is the listener on the port 80 of the Gateway since
+	// Envoy Gateway shifts the privileged ports by 10000 in the Envoy pod.
+	//
+	// +optional
+	// +kubebuilder:default="http://127.0.0.1:10080/v1/embeddings"
+	Endpoint *string `json:"endpoint,omitempty"`
+
+	// SimilarityThreshold is the minimum cosine similarity between the embeddings of the last user messages, from "0"
+	// to "1", for the cached response to be returned, e.g. "0.95". The lower threshold returns more cached responses
+	// at the risk of answering the different questions.
+	//
+	// Default is "0.95".
+	//
+	// +optional
+	// +kubebuilder:validation:Pattern=`^(0(\.[0-9]{1,3})?|1(\.0{1,3})?)$`
+	// +kubebuilder:default="0.95"
+	SimilarityThreshold *string `json:"similarityThreshold,omitempty"`
+
+	// MaxEntries is the maximum number of the embeddings kept for each combination of the rule, the model, the scope
+	// and the rest of the request. The oldest embeddings are evicted first, in addition to the expiry by the TTL.
+	//
+	// Default is 1000.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1000
+	MaxEntries *int32 `json:"maxEntries,omitempty"`
+
+	// Timeout is the timeout of the embedding request. The request is sent to the backend without the semantic cache
+	// when the embedding request fails.
+	//
+	// Default is 1s.
+	//
+	// +optional
+	// +kubebuilder:default="1s"
+	Timeout *gwapiv1.Duration `json:"timeout,omitempty"`
+}
+
+// AIGatewayRouteResponseCacheScope identifies the consumer of the request so that the cached responses are only
+// returned to the same consumer. The requests whose consumer cannot be identified are not cached.
+//
+// Exactly one of the fields must be set.
+//
+// +kubebuilder:validation:XValidation:rule="has(self.header) != has(self.jwtClaim)", message="exactly one of header or jwtClaim must be set"
+type AIGatewayRouteResponseCacheScope struct {
+	// Header is the name of the request header identifying the consumer, such as the API key or the team.
+	//
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	Header *string `json:"header,omitempty"`
+
+	// JWTClaim is the name of the top-level claim of the JWT identifying the consumer, such as "sub".
+	//
+	// The claim is read from the payload of the JWT verified by the JWT authentication of the Envoy Gateway
+	// SecurityPolicy, so the requests without the verified JWT have no value for the claim.
+	//
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	JWTClaim *string `json:"jwtClaim,omitempty"`
+}
+
+// AIGatewayRouteCapture configures the capture of the requests for debugging.
+type AIGatewayRouteCapture struct {
+	// Mode specifies which requests are captured. "Always" captures all the requests, while "Header" only captures
+	// the requests with the "x-ai-eg-capture: true" header, e.g., to reproduce an issue with a specific request.
+	//
+	// Default is "Header".
+	//
+	// +optional
+	// +kubebuilder:validation:Enum=Always;Header
+	// +kubebuilder:default=Header
+	Mode AIGatewayRouteCaptureMode `json:"mode,omitempty"`
+
+	// IncludeOriginalRequest captures the original request body of the client as well, before the modifications by
+	// the gateway such as the redaction of the PII and the secrets. Since this writes them to the disk as they are,
+	// this should only be enabled to debug the modifications themselves.
+	//
+	// Default is false.
+	//
+	// +optional
+	IncludeOriginalRequest bool `json:"includeOriginalRequest,omitempty"`
+}
+
+// AIGatewayRouteCaptureMode specifies which requests are captured.
+type AIGatewayRouteCaptureMode string
+
+const (
+	// AIGatewayRouteCaptureModeAlways captures all the requests.
+	AIGatewayRouteCaptureModeAlways AIGatewayRouteCaptureMode = "Always"
+	// AIGatewayRouteCaptureModeHeader captures the requests with the "x-ai-eg-capture: true" header.
+	AIGatewayRouteCaptureModeHeader AIGatewayRouteCaptureMode = "Header"
+)
+
+// AIGatewayRouteMetricAttribute configures an attribute of the GenAI metrics extracted from the requests.
+//
+// +kubebuilder:validation:XValidation:rule="has(self.header) != has(self.metadata)", message="exactly one of header or metadata must be set"
+type AIGatewayRouteMetricAttribute struct {
+	// Name is the name of the attribute, e.g., "team". The attribute is recorded as "ai_gateway.<name>".
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z][a-z0-9_]*$`
+	// +kubebuilder:validation:XValidation:rule="!(self in ['consumer', 'experiment'])", message="consumer and experiment are reserved"
+	Name string `json:"name"`
+
+	// Header is the name of the request header containing the value of the attribute, such as the one populated by
+	// the claimToHeaders of the JWT authentication of the Envoy Gateway SecurityPolicy.
+	//
+	// +optional
+	Header *string `json:"header,omitempty"`
+
+	// Metadata is the key of the dynamic metadata containing the value of the attribute, such as the one populated
+	// by the filters running before the AI Gateway. The value must be a string or a number.
+	//
+	// +optional
+	Metadata *AIGatewayRouteMetricAttributeMetadata `json:"metadata,omitempty"`
+
+	// AllowedValues is the list of the values recorded as they are. The other values are recorded as "_OTHER".
+	// If not specified, any value is recorded up to the max values.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=256
+	AllowedValues []string `json:"allowedValues,omitempty"`
+
+	// MaxValues is the maximum number of the distinct values of the attribute recorded by each external processor.
+	// Once reached, the values not seen before are recorded as "_OTHER".
+	//
+	// Default is 100.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10000
+	// +kubebuilder:default=100
+	MaxValues *int32 `json:"maxValues,omitempty"`
+
+	// Hash replaces the values with the first 16 hex characters of their SHA-256 hash, so that sensitive values such
+	// as the API keys are not exposed in the metrics. The allowed values are compared before hashing.
+	//
+	// +optional
+	Hash bool `json:"hash,omitempty"`
+}
+
+// AIGatewayRouteMetricAttributeMetadata is the key of the dynamic metadata.
+type AIGatewayRouteMetricAttributeMetadata struct {
+	// Namespace is the namespace of the dynamic metadata, e.g., "envoy.filters.http.jwt_authn".
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+
+	// Key is the key in the namespace. The value must be a string or a number.
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
+// AIGatewayRouteAuthorization configures the authorization of the callers of an AIGatewayRoute based on their claim.
+type AIGatewayRouteAuthorization struct {
+	// Claim specifies where the claim of the caller is taken from.
+	//
+	// +kubebuilder:validation:Required
+	Claim AIGatewayRouteAuthorizationClaim `json:"claim"`
+
+	// Rules is the list of the rules granting the models to the callers. A caller can use a model if any of the rules
+	// matching the caller allows the model. The callers not matching any rule cannot use any model of the route.
+	//
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=64
+	Rules []AIGatewayRouteAuthorizationRule `json:"rules"`
+}
+
+// AIGatewayRouteAuthorizationClaim specifies where the claim of the caller is taken from.
+//
+// The claim is only taken from the JWT verified by Envoy rather than from a request header, e.g. the one populated by
+// the claimToHeaders of the JWT authentication, since the authorization cannot tell such a header from the one set
+// by the client.
+type AIGatewayRouteAuthorizationClaim struct {
+	// JWTClaim is the name of the top-level claim of the JWT, such as "groups". The claim can be either a string
+	// or an array of strings.
+	//
+	// The claim is read from the payload of the JWT verified by the JWT authentication of the Envoy Gateway
+	// SecurityPolicy, so the requests without the verified JWT have no value for the claim.
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	JWTClaim string `json:"jwtClaim"`
+}
+
+// AIGatewayRouteAuthorizationRule grants the models to the callers with any of the claim values.
+type AIGatewayRouteAuthorizationRule struct {
+	// ClaimValues is the list of the claim values this rule applies to. The rule applies to a caller if any of its
+	// claim values is listed. If not specified, the rule applies to all the callers, including the ones without
+	// the claim.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	ClaimValues []string `json:"claimValues,omitempty"`
+
+	// Models is the list of the patterns of the model names the callers can use. The "*" in a pattern matches
+	// any sequence of characters, e.g., "gpt-4o-mini*". If not specified, all the models are allowed.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	Models []string `json:"models,omitempty"`
+
+	// MaxTokens caps the max_tokens or max_completion_tokens of the chat completion requests by the callers.
+	// The requests without them or exceeding the cap are rejected. When multiple rules allow the model for the
+	// caller, the largest cap applies, and the rule without the cap lifts it.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxTokens *int64 `json:"maxTokens,omitempty"`
+}
+
+// AIGatewayRouteRequestLimits limits the size and the parameters of the chat completion requests.
+//
+// +kubebuilder:validation:XValidation:rule="!(has(self.allowedParameters) && has(self.forbiddenParameters))",message="only one of allowedParameters or forbiddenParameters can be set"
+type AIGatewayRouteRequestLimits struct {
+	// Mode specifies what is done when the max tokens, the n or the parameters of the request violate the limits.
+	// Defaults to Reject.
+	//
+	//   - Reject: the request is rejected with 400 Bad Request.
+	//   - Clamp: the max tokens and the n are lowered to the limits, and the parameters not allowed are removed from
+	//     the request, which is then sent to the backend.
+	//
+	// The requests exceeding the other limits are always rejected since they cannot be clamped.
+	//
+	// +optional
+	// +kubebuilder:default=Reject
+	// +kubebuilder:validation:Enum=Reject;Clamp
+	Mode RequestLimitsMode `json:"mode,omitempty"`
+
+	// MaxBodyBytes is the maximum size of the request body in bytes, including the encoded images.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxBodyBytes *int64 `json:"maxBodyBytes,omitempty"`
+
+	// MaxPromptBytes is the maximum total size in bytes of the text content of all the messages of the request.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxPromptBytes *int64 `json:"maxPromptBytes,omitempty"`
+
+	// MaxMessages is the maximum number of the messages of the request.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxMessages *int32 `json:"maxMessages,omitempty"`
+
+	// MaxImages is the maximum number of the image parts in the messages of the request.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxImages *int32 `json:"maxImages,omitempty"`
+
+	// MaxTokens is the maximum of the max_tokens and the max_completion_tokens of the request. The requests without
+	// them are not limited by this, which can be enforced by the maxTokens of the authorization instead.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxTokens *int64 `json:"maxTokens,omitempty"`
+
+	// MaxN is the maximum of the number of the choices, n, of the request.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxN *int32 `json:"maxN,omitempty"`
+
+	// AllowedParameters is the list of the top-level parameters of the request allowed in addition to "model" and
+	// "messages", e.g. ["temperature", "max_tokens", "stream"]. If specified, the other parameters are not allowed.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	AllowedParameters []string `json:"allowedParameters,omitempty"`
+
+	// ForbiddenParameters is the list of the top-level parameters of the request not allowed, e.g. ["logprobs"].
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	ForbiddenParameters []string `json:"forbiddenParameters,omitempty"`
+}
+
+// RequestLimitsMode specifies what is done when the request violates the limits.
+type RequestLimitsMode string
+
+const (
+	// RequestLimitsModeReject rejects the request violating the limits.
+	RequestLimitsModeReject RequestLimitsMode = "Reject"
+	// RequestLimitsModeClamp clamps the max tokens and the n of the request, and removes the parameters not allowed.
+	RequestLimitsModeClamp RequestLimitsMode = "Clamp"
+)
+
+// AIGatewayRouteToolPolicy restricts the tools defined in the chat completion requests and the tool calls in the
+// requests and the responses.
+//
+// The requests defining or calling the tools not allowed, or calling the tools with the arguments violating the
+// schemas, are rejected with 400 Bad Request. The tool calls of the responses violating the policy are handled by
+// the ResponseAction. Every tool call of the responses is recorded in the audit log if it is enabled.
+type AIGatewayRouteToolPolicy struct {
+	// AllowedTools is the list of the patterns of the names of the tools allowed. The "*" in a pattern matches any
+	// sequence of characters, e.g., "search_*". If specified, the other tools are not allowed.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=128
+	AllowedTools []string `json:"allowedTools,omitempty"`
+
+	// DeniedTools is the list of the patterns of the names of the tools not allowed, which takes precedence over the
+	// AllowedTools. The "*" in a pattern matches any sequence of characters, e.g., "delete_*".
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=128
+	DeniedTools []string `json:"deniedTools,omitempty"`
+
+	// Arguments is the list of the JSON schemas the arguments of the tool calls must conform to. The arguments of a
+	// tool call must conform to all the schemas of the tools matching its name.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	Arguments []ToolArgumentsSchema `json:"arguments,omitempty"`
+
+	// ResponseAction specifies what is done with the tool calls of the responses violating the policy.
+	// Defaults to Reject.
+	//
+	//   - Reject: the response is replaced with 400 Bad Request, or, for the streaming responses, the stream is
+	//     terminated with the error event.
+	//   - Strip: the tool calls violating the policy are removed from the response.
+	//
+	// +optional
+	// +kubebuilder:default=Reject
+	// +kubebuilder:validation:Enum=Reject;Strip
+	ResponseAction ToolPolicyResponseAction `json:"responseAction,omitempty"`
+}
+
+// ToolArgumentsSchema is the JSON schema the arguments of the calls of the tools must conform to.
+type ToolArgumentsSchema struct {
+	// Tool is the pattern of the names of the tools this schema applies to. The "*" in the pattern matches any
+	// sequence of characters.
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=128
+	Tool string `json:"tool"`
+
+	// Schema is the JSON schema of the arguments of the tool calls, e.g.,
+	// {"type": "object", "properties": {"path": {"type": "string", "pattern": "^/tmp/"}}, "required": ["path"]}.
+	//
+	// The schema is of the JSON Schema draft 2020-12 unless the "$schema" keyword specifies another draft. The
+	// references to the external schemas are not supported.
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	Schema apiextensionsv1.JSON `json:"schema"`
+}
+
+// ToolPolicyResponseAction specifies what is done with the tool calls of the responses violating the tool policy.
+type ToolPolicyResponseAction string
+
+const (
+	// ToolPolicyResponseActionReject fails the response with the tool calls violating the policy.
+	ToolPolicyResponseActionReject ToolPolicyResponseAction = "Reject"
+	// ToolPolicyResponseActionStrip removes the tool calls violating the policy from the response.
+	ToolPolicyResponseActionStrip ToolPolicyResponseAction = "Strip"
+)
+
+// AIGatewayRouteAuditLog configures the recording of the conversations in the audit log.
+//
+// Each record has the original request of the client before any modification by the gateway, e.g., by the
+// guardrails, and the final response returned to the client, with the streaming response reassembled into a single
+// chat completion object. The records are made in the background, so that the recording never delays the requests.
+type AIGatewayRouteAuditLog struct {
+	// Percentage is the percentage of the requests that are recorded.
+	//
+	// Default is 100.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default=100
+	Percentage *int32 `json:"percentage,omitempty"`
+
+	// RedactedFields is the list of the paths of the fields of the requests and the responses whose values are
+	// replaced with "[REDACTED]" in the records. A path is the names of the fields separated by ".", where "*" matches
+	// any element of an array or any field of an object, e.g., "messages.*.content" or "choices.*.message.content".
+	// The paths not found in a body are ignored.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	// +kubebuilder:validation:items:MinLength=1
+	RedactedFields []string `json:"redactedFields,omitempty"`
+
+	// MaxBodyBytes is the maximum size in bytes of each of the request and the response in a record. The larger ones
+	// are truncated after the redaction, and the record is marked as truncated.
+	//
+	// Default is 65536.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=16777216
+	// +kubebuilder:default=65536
+	MaxBodyBytes *int32 `json:"maxBodyBytes,omitempty"`
 }
 
 // AIGatewayRouteRule is a rule that defines the routing behavior of the AIGatewayRoute.
@@ -274,6 +826,186 @@ type AIGatewayRouteRule struct {
 	// +optional
 	// +kubebuilder:validation:Format=date-time
 	ModelsCreatedAt *metav1.Time `json:"modelsCreatedAt,omitempty"`
+
+	// HedgePolicy configures the request hedging for this rule. When set, if the response headers
+	// have not been received from the selected backend within the configured timeout, a duplicate request
+	// is sent to the next backend ref, and whichever responds first is returned to the client while the
+	// other in-flight request is cancelled.
+	//
+	// This is useful for latency-sensitive routes, e.g. interactive chat, where the time to the first byte
+	// matters more than the cost. Only the response headers are awaited: once the backend has responded with
+	// the headers, the request is not hedged even if the first chunk of the streaming response is slow.
+	//
+	// The token usage of the cancelled requests is unknown, so each of them is estimated to have consumed
+	// as many input tokens as the request returned to the client. The estimation is included in the costs
+	// of the request charged to the quotas, and is recorded in the token usage and the cost metrics with
+	// the "ai_gateway.hedged_attempt" attribute so that the extra cost of hedging is visible.
+	//
+	// The next backend ref is determined by the Priority of the backend refs, so it is recommended to
+	// set different priorities on the backend refs of the rule.
+	//
+	// +optional
+	HedgePolicy *AIGatewayRouteRuleHedgePolicy `json:"hedgePolicy,omitempty"`
+
+	// LoadBalancing configures how the endpoint of the backend is selected for the requests matching this rule.
+	// When not set, the default load balancing of Envoy Gateway is used.
+	//
+	// +optional
+	LoadBalancing *AIGatewayRouteRuleLoadBalancing `json:"loadBalancing,omitempty"`
+
+	// ShadowPolicy configures the traffic shadowing for this rule. When set, a sampled percentage of the
+	// requests matching this rule is mirrored to the shadow backend in addition to the regular backend refs.
+	// The request is translated to the schema of the shadow backend, and its response is discarded without
+	// affecting the client.
+	//
+	// This is useful to evaluate a candidate backend with the production traffic before migrating a workload
+	// to it. The latency, token usage, finish reason as well as the JSON validity for structured outputs of the
+	// shadow response are compared with the ones of the primary response and recorded in the metrics. The token
+	// usage of the shadow requests is recorded separately from the regular token usage metrics and costs.
+	//
+	// Currently, this only applies to the chat completion requests.
+	//
+	// +optional
+	ShadowPolicy *AIGatewayRouteRuleShadowPolicy `json:"shadowPolicy,omitempty"`
+
+	// Experiment configures the sticky assignment of the end users to the backends of this rule.
+	//
+	// By default, the requests are split randomly across the BackendRefs according to their weights, so the requests
+	// of the same end user can be served by different backends. When this is set, the end user identified by
+	// the Subject is deterministically assigned to one of the BackendRefs, called a variant, by hashing the identity,
+	// and all the requests of the user are sent to it. The split across the users still follows the weights.
+	// Only the BackendRefs with the priority 0 are the variants, and the others are the fallbacks shared by all the variants.
+	// Each BackendRef is a distinct variant even when the same AIServiceBackend is referenced multiple times.
+	//
+	// The experiment name and the variant, which is the name of the AIServiceBackend, are populated in the dynamic
+	// metadata, the metrics attributes as well as the "x-ai-eg-experiment" and "x-ai-eg-experiment-variant" response
+	// headers, so that they can be joined with the other analytics data. The requests without the identity of
+	// the end user are split randomly as usual.
+	//
+	// Currently, this only applies to the chat completion requests to the rules matching on the model name header.
+	//
+	// +optional
+	Experiment *AIGatewayRouteRuleExperiment `json:"experiment,omitempty"`
+}
+
+// AIGatewayRouteRuleExperiment configures the sticky assignment of the end users to the backends of an AIGatewayRouteRule.
+type AIGatewayRouteRuleExperiment struct {
+	// Name is the name of the experiment. This is also used as the seed of the hashing, so renaming the experiment
+	// reshuffles the assignment.
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Subject specifies where the identity of the end user is taken from.
+	//
+	// +kubebuilder:validation:Required
+	Subject AIGatewayRouteRuleExperimentSubject `json:"subject"`
+}
+
+// AIGatewayRouteRuleExperimentSubject specifies where the identity of the end user is taken from.
+// Exactly one of the fields must be set.
+//
+// +kubebuilder:validation:XValidation:rule="has(self.header) != has(self.jwtClaim)", message="exactly one of header or jwtClaim must be set"
+type AIGatewayRouteRuleExperimentSubject struct {
+	// Header is the name of the request header containing the identity of the end user.
+	//
+	// +optional
+	Header *string `json:"header,omitempty"`
+
+	// JWTClaim is the name of the top-level claim of the JWT containing the identity of the end user, such as "sub".
+	//
+	// The claim is read from the payload of the JWT verified by the JWT authentication of the Envoy Gateway
+	// SecurityPolicy, so the requests without the verified JWT have no value for the claim.
+	//
+	// +optional
+	JWTClaim *string `json:"jwtClaim,omitempty"`
+}
+
+// AIGatewayRouteRuleShadowPolicy configures the traffic shadowing for an AIGatewayRouteRule.
+type AIGatewayRouteRuleShadowPolicy struct {
+	// BackendRef is the AIServiceBackend to which the shadow traffic is sent.
+	// Weight and Priority are ignored.
+	//
+	// +kubebuilder:validation:Required
+	BackendRef AIGatewayRouteRuleBackendRef `json:"backendRef"`
+
+	// Percentage is the percentage of the requests that are mirrored to the shadow backend.
+	//
+	// Default is 100.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default=100
+	Percentage *int32 `json:"percentage,omitempty"`
+}
+
+// AIGatewayRouteRuleLoadBalancing configures the endpoint selection for an AIGatewayRouteRule.
+type AIGatewayRouteRuleLoadBalancing struct {
+	// PrefixCacheAffinity enables the consistent hashing of the requests based on the prompt prefix.
+	//
+	// This is primarily intended for the self-hosted inference servers such as vLLM or SGLang exposed as
+	// OpenAI-compatible AIServiceBackends, where the KV-cache hit rate depends on sending the requests sharing
+	// the same conversation prefix to the same replica. The system prompt and the leading messages of the
+	// request are hashed into a key, and the endpoint is selected by the consistent hashing on that key.
+	//
+	// Currently, this only applies to the chat completion requests.
+	//
+	// +optional
+	PrefixCacheAffinity *PrefixCacheAffinity `json:"prefixCacheAffinity,omitempty"`
+}
+
+// PrefixCacheAffinity configures the prompt-prefix-based consistent hashing.
+type PrefixCacheAffinity struct {
+	// LeadingMessages is the number of the leading non-system messages of the conversation that are hashed
+	// together with the system prompt. Setting it to zero makes the key depend only on the system prompt, and
+	// the requests without the system prompt are load balanced as if the prefix cache affinity is not configured.
+	//
+	// Default is 1.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=32
+	// +kubebuilder:default=1
+	LeadingMessages *int32 `json:"leadingMessages,omitempty"`
+
+	// BoundedLoadFactor is the bounded-load protection of the consistent hashing in percent. An endpoint
+	// is not selected when its number of outstanding requests exceeds this percentage of the average across all
+	// endpoints, and the request spills over to the next endpoint on the hash ring instead.
+	//
+	// For example, 150 means that an endpoint can receive at most 1.5 times the average load.
+	// Lower values spread the load more evenly at the cost of the affinity.
+	//
+	// Default is 150.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=100
+	// +kubebuilder:default=150
+	BoundedLoadFactor *int32 `json:"boundedLoadFactor,omitempty"`
+}
+
+// AIGatewayRouteRuleHedgePolicy configures the request hedging for an AIGatewayRouteRule.
+type AIGatewayRouteRuleHedgePolicy struct {
+	// FirstResponseTimeout is the duration to wait for the response headers from the backend
+	// before sending a hedged request to the next backend ref. For example, "500ms".
+	//
+	// This is the per-try timeout of the attempt, so the attempt retried by the retry policy before
+	// this timeout is not a hedged request.
+	//
+	// +kubebuilder:validation:Required
+	FirstResponseTimeout gwapiv1.Duration `json:"firstResponseTimeout"`
+
+	// MaxHedgedRequests is the maximum number of hedged requests that can be sent in addition to
+	// the original request.
+	//
+	// Default is 1.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=8
+	// +kubebuilder:default=1
+	MaxHedgedRequests *int32 `json:"maxHedgedRequests,omitempty"`
 }
 
 // AIGatewayRouteRuleBackendRef is a reference to a backend with a weight.
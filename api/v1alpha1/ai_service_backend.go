@@ -67,6 +67,69 @@ type AIServiceBackendSpec struct {
 	// +optional
 	BackendSecurityPolicyRef *gwapiv1.LocalObjectReference `json:"backendSecurityPolicyRef,omitempty"`
 
+	// ConcurrencyLimit limits the number of the requests in flight to this backend. This is useful for the backends
+	// with a hard concurrency ceiling such as self-hosted model servers or provisioned throughput endpoints.
+	//
+	// The excess requests are queued in the order of their priority class until the slot becomes available.
+	// When the queue timeout expires, the request spills over to the backend refs with the lower priority of the
+	// AIGatewayRoute rule, or fails with 503 if there's none.
+	//
+	// The limit is enforced by each Envoy Gateway proxy instance independently.
+	//
+	// +optional
+	ConcurrencyLimit *AIServiceBackendConcurrencyLimit `json:"concurrencyLimit,omitempty"`
+
 	// TODO: maybe add backend-level LLMRequestCost configuration that overrides the AIGatewayRoute-level LLMRequestCost.
 	// 	That may be useful for the backend that has a different cost calculation logic.
 }
+
+// AIServiceBackendConcurrencyLimit configures the concurrency limit of an AIServiceBackend.
+type AIServiceBackendConcurrencyLimit struct {
+	// MaxInFlightRequests is the maximum number of the requests in flight to the backend.
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=1
+	MaxInFlightRequests int32 `json:"maxInFlightRequests"`
+
+	// QueueTimeout is the maximum duration for which the excess request waits in the queue before spilling over.
+	// Setting this to "0s" disables the queueing so that the excess requests spill over immediately.
+	//
+	// Default is "10s".
+	//
+	// +optional
+	// +kubebuilder:default="10s"
+	QueueTimeout *gwapiv1.Duration `json:"queueTimeout,omitempty"`
+
+	// Priority specifies the priority class of the request used to order the queue.
+	// When not set, the requests are queued in the arrival order.
+	//
+	// +optional
+	Priority *AIServiceBackendConcurrencyPriority `json:"priority,omitempty"`
+}
+
+// AIServiceBackendConcurrencyPriority specifies how the priority class of the request is determined.
+// Exactly one of Header or JWTClaim must be set.
+//
+// +kubebuilder:validation:XValidation:rule="has(self.header) != has(self.jwtClaim)", message="exactly one of header or jwtClaim must be set"
+type AIServiceBackendConcurrencyPriority struct {
+	// Header is the name of the request header containing the priority class.
+	//
+	// +optional
+	Header *string `json:"header,omitempty"`
+
+	// JWTClaim is the name of the top-level claim of the JWT containing the priority class, such as the tier
+	// of the consumer.
+	//
+	// The claim is read from the payload of the JWT verified by the JWT authentication of the Envoy Gateway
+	// SecurityPolicy, so the requests without the verified JWT have no value for the claim.
+	//
+	// +optional
+	JWTClaim *string `json:"jwtClaim,omitempty"`
+
+	// Classes is the list of the priority classes in the descending order of the priority.
+	// The requests whose priority class is not in the list have the lowest priority.
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Classes []string `json:"classes"`
+}
@@ -0,0 +1,121 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gwapiv1a2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// ConsumerKey is a virtual API key issued by the AI Gateway to a consumer of the models, such as a team.
+//
+// Once any ConsumerKey targets a Gateway, the AI Gateway requires every request to the Gateway to carry one of
+// the keys in the "Authorization: Bearer <key>" header. The requests with a missing, unknown or expired key are
+// rejected with 401 Unauthorized, and the requests to the models or the AIGatewayRoutes not allowed for the key
+// are rejected with 403 Forbidden. The key is removed from the request before it is sent to the backend, and
+// the consumer identity is populated in the request headers instead.
+//
+// Only the SHA-256 hash of the key is stored in the Secret, so the key itself is never persisted in the cluster.
+// The changes to the ConsumerKey and the Secret, including the deletion to revoke the key, take effect without
+// restarting the Gateway.
+//
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Consumer",type=string,JSONPath=`.spec.consumer`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[-1:].type`
+type ConsumerKey struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Spec defines the details of the ConsumerKey.
+	Spec ConsumerKeySpec `json:"spec,omitempty"`
+	// Status defines the status details of the ConsumerKey.
+	Status ConsumerKeyStatus `json:"status,omitempty"`
+}
+
+// ConsumerKeyList contains a list of ConsumerKey.
+//
+// +kubebuilder:object:root=true
+type ConsumerKeyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ConsumerKey `json:"items"`
+}
+
+// ConsumerKeySpec details the ConsumerKey configuration.
+type ConsumerKeySpec struct {
+	// TargetRefs are the names of the Gateway resources this ConsumerKey is being attached to.
+	// The Gateways must be in the same namespace as the ConsumerKey.
+	//
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:XValidation:rule="self.all(ref, ref.group == 'gateway.networking.k8s.io' && ref.kind == 'Gateway')", message="targetRefs must reference Gateway resources"
+	TargetRefs []gwapiv1a2.LocalPolicyTargetReference `json:"targetRefs"`
+
+	// Consumer is the identity of the consumer, such as the team, to which the key is issued.
+	// Multiple keys can be issued to the same consumer, e.g. to rotate the key.
+	//
+	// The consumer is populated in the "x-ai-eg-consumer" request header, and the name of the ConsumerKey in
+	// the "x-ai-eg-consumer-key" request header, so that they can be used by the other policies such as
+	// the QuotaPolicy and the usage ledger.
+	//
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	Consumer string `json:"consumer"`
+
+	// SecretRef is the reference to the secret containing the hex-encoded SHA-256 hash of the key.
+	// The key of the secret should be "apiKeyHash". ai-gateway must be given the permission to read this secret.
+	//
+	// +kubebuilder:validation:Required
+	SecretRef *gwapiv1.SecretObjectReference `json:"secretRef"`
+
+	// Models is the list of the model names the key is allowed to use.
+	// If not specified, all the models are allowed.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=128
+	Models []string `json:"models,omitempty"`
+
+	// Routes is the list of the names of the AIGatewayRoutes in the same namespace the key is allowed to use.
+	// The route of a request is resolved by the model name, so the requests to the models not declared by the
+	// exact match of the "x-ai-eg-model" header in any of the AIGatewayRoutes are rejected when this is set.
+	// If not specified, all the routes are allowed.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	Routes []string `json:"routes,omitempty"`
+
+	// Budgets is the list of the budgets applied to the key in addition to the QuotaPolicies. The consumption is
+	// counted per ConsumerKey, not per consumer.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=32
+	Budgets []QuotaBudget `json:"budgets,omitempty"`
+
+	// Labels are the additional metadata of the consumer. Each label is populated in the request header named
+	// "x-ai-eg-consumer-label-<name>", so that they can be used by, e.g., the header matches of the rate limits.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxProperties=16
+	// +kubebuilder:validation:XValidation:rule="self.all(k, k.matches('^[a-z0-9-]+$'))", message="label names must consist of lower case alphanumeric characters or '-'"
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// ExpiresAt is the time after which the key is rejected. If not specified, the key never expires.
+	//
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Disabled revokes the key while keeping the ConsumerKey resource.
+	//
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+const (
+	// ConsumerKeyHashInSecret is the key of the Secret referenced by the ConsumerKey which holds the hex-encoded
+	// SHA-256 hash of the key.
+	ConsumerKeyHashInSecret = "apiKeyHash"
+)
@@ -0,0 +1,121 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gwapiv1a2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// PricingCatalog holds the prices of the models served through the Gateways it targets.
+//
+// The AI Gateway computes the actual cost of every request in micro-USD from the token usage reported by the backend
+// and the price of the model, and stores it in the dynamic metadata as well as the "gen_ai.usage.cost" metric.
+// The prices are also available in the CEL expressions of the LLMRequestCosts of the AIGatewayRoute, so that the
+// costs can be used for the rate limiting without hard-coding the prices in the expressions.
+//
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[-1:].type`
+type PricingCatalog struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Spec defines the details of the PricingCatalog.
+	Spec PricingCatalogSpec `json:"spec,omitempty"`
+	// Status defines the status details of the PricingCatalog.
+	Status PricingCatalogStatus `json:"status,omitempty"`
+}
+
+// PricingCatalogList contains a list of PricingCatalog.
+//
+// +kubebuilder:object:root=true
+type PricingCatalogList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PricingCatalog `json:"items"`
+}
+
+// PricingCatalogSpec details the PricingCatalog configuration.
+type PricingCatalogSpec struct {
+	// TargetRefs are the names of the Gateway resources this PricingCatalog is being attached to.
+	// The Gateways must be in the same namespace as the PricingCatalog.
+	//
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:XValidation:rule="self.all(ref, ref.group == 'gateway.networking.k8s.io' && ref.kind == 'Gateway')", message="targetRefs must reference Gateway resources"
+	TargetRefs []gwapiv1a2.LocalPolicyTargetReference `json:"targetRefs"`
+
+	// Prices is the list of the prices of the models.
+	//
+	// When multiple prices match the request, the one with the matching backendRef takes precedence over the one
+	// without it. Otherwise, the first one in the list is used. When multiple PricingCatalogs target the same Gateway,
+	// they are considered in the order of the creation time.
+	//
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=256
+	Prices []ModelPrice `json:"prices"`
+}
+
+// USDPrice is the price in USD as a decimal number, e.g. "2.5" or "0.075".
+//
+// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+// +kubebuilder:validation:MaxLength=32
+type USDPrice string
+
+// ModelPrice is the price of a model.
+//
+// The token prices are in USD per million tokens, which is the unit used by most of the providers, e.g.,
+// "2.5" for $2.50 per 1M tokens. In other words, this is the price in micro-USD per token.
+//
+// The cached input tokens and the reasoning tokens are part of the input and output tokens respectively. They are
+// charged at their own price instead of the input or output token price when it is specified.
+type ModelPrice struct {
+	// Model is the name of the model in the request, which is the value of the "x-ai-eg-model" header.
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Model string `json:"model"`
+
+	// BackendRef is the name of the AIServiceBackend in the same namespace as the PricingCatalog.
+	// When specified, this price is only applied to the requests sent to the backend. This is useful when the same
+	// model is served by multiple providers at different prices.
+	//
+	// +optional
+	BackendRef *string `json:"backendRef,omitempty"`
+
+	// InputTokenPrice is the price of the input tokens in USD per million tokens.
+	//
+	// +kubebuilder:validation:Required
+	InputTokenPrice USDPrice `json:"inputTokenPrice"`
+
+	// OutputTokenPrice is the price of the output tokens in USD per million tokens.
+	//
+	// +kubebuilder:validation:Required
+	OutputTokenPrice USDPrice `json:"outputTokenPrice"`
+
+	// CachedInputTokenPrice is the price of the input tokens read from the prompt cache in USD per million tokens.
+	// Defaults to the input token price.
+	//
+	// +optional
+	CachedInputTokenPrice *USDPrice `json:"cachedInputTokenPrice,omitempty"`
+
+	// ReasoningTokenPrice is the price of the reasoning tokens in USD per million tokens.
+	// Defaults to the output token price.
+	//
+	// +optional
+	ReasoningTokenPrice *USDPrice `json:"reasoningTokenPrice,omitempty"`
+
+	// ImagePrice is the price of an image in the request content in USD.
+	//
+	// +optional
+	ImagePrice *USDPrice `json:"imagePrice,omitempty"`
+
+	// AudioSecondPrice is the price of a second of the audio in the request content in USD.
+	// The duration of the audio is only known for the audio in the WAV format.
+	//
+	// +optional
+	AudioSecondPrice *USDPrice `json:"audioSecondPrice,omitempty"`
+}
@@ -0,0 +1,173 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gwapiv1a2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// QuotaPolicy enforces the token and spend budgets per consumer on the Gateways it targets.
+//
+// Unlike the rate limiting with the LLMRequestCosts of the AIGatewayRoute, which relies on the external
+// rate limit service configured on the Envoy Gateway side, the budgets are counted and enforced by the AI Gateway
+// itself. The request atomically reserves its estimated tokens, or a single unit when they are not estimated, from
+// the applicable budgets when it arrives, so the concurrent requests are not all admitted against the same remaining
+// amount. The request is rejected with 429 Too Many Requests if the remaining amount of any of the budgets in the
+// current period is less than its reservation. Otherwise, the reservation is settled with the consumed tokens or
+// costs after the response is completed, or released if the request completes without the response. Since the
+// consumption is only known after the response, the budget can still be exceeded by the last admitted requests.
+//
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[-1:].type`
+type QuotaPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Spec defines the details of the QuotaPolicy.
+	Spec QuotaPolicySpec `json:"spec,omitempty"`
+	// Status defines the status details of the QuotaPolicy.
+	Status QuotaPolicyStatus `json:"status,omitempty"`
+}
+
+// QuotaPolicyList contains a list of QuotaPolicy.
+//
+// +kubebuilder:object:root=true
+type QuotaPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuotaPolicy `json:"items"`
+}
+
+// QuotaPolicySpec details the QuotaPolicy configuration.
+type QuotaPolicySpec struct {
+	// TargetRefs are the names of the Gateway resources this QuotaPolicy is being attached to.
+	// The Gateways must be in the same namespace as the QuotaPolicy.
+	//
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:XValidation:rule="self.all(ref, ref.group == 'gateway.networking.k8s.io' && ref.kind == 'Gateway')", message="targetRefs must reference Gateway resources"
+	TargetRefs []gwapiv1a2.LocalPolicyTargetReference `json:"targetRefs"`
+
+	// ConsumerKey specifies how to identify the consumer of a request. The budgets are counted per consumer.
+	// The requests whose consumer cannot be identified are not subject to the budgets.
+	//
+	// +kubebuilder:validation:Required
+	ConsumerKey QuotaConsumerKey `json:"consumerKey"`
+
+	// Budgets is the list of the budgets applied to each consumer. A request is rejected when the remaining amount
+	// of any of the budgets applicable to the request is less than its reservation.
+	//
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=32
+	Budgets []QuotaBudget `json:"budgets"`
+}
+
+// QuotaConsumerKeyType specifies the source of the consumer key.
+type QuotaConsumerKeyType string
+
+const (
+	// QuotaConsumerKeyTypeHeader is the type of the consumer key taken from a request header.
+	QuotaConsumerKeyTypeHeader QuotaConsumerKeyType = "Header"
+	// QuotaConsumerKeyTypeJWTClaim is the type of the consumer key taken from a claim of the JWT in the
+	// Authorization header. The JWT is not verified by the AI Gateway, so the JWT authentication must be configured
+	// on the Gateway via the SecurityPolicy of the Envoy Gateway.
+	QuotaConsumerKeyTypeJWTClaim QuotaConsumerKeyType = "JWTClaim"
+	// QuotaConsumerKeyTypeClientIP is the type of the consumer key using the client IP address, which is the
+	// address appended to the x-forwarded-for header by Envoy.
+	QuotaConsumerKeyTypeClientIP QuotaConsumerKeyType = "ClientIP"
+)
+
+// QuotaConsumerKey specifies how to identify the consumer of a request.
+//
+// +kubebuilder:validation:XValidation:rule="self.type == 'Header' ? (has(self.header) && !has(self.jwtClaim)) : true",message="When type is Header, only header field should be set"
+// +kubebuilder:validation:XValidation:rule="self.type == 'JWTClaim' ? (has(self.jwtClaim) && !has(self.header)) : true",message="When type is JWTClaim, only jwtClaim field should be set"
+// +kubebuilder:validation:XValidation:rule="self.type == 'ClientIP' ? (!has(self.header) && !has(self.jwtClaim)) : true",message="When type is ClientIP, neither header nor jwtClaim field should be set"
+type QuotaConsumerKey struct {
+	// Type specifies the source of the consumer key.
+	//
+	// +kubebuilder:validation:Enum=Header;JWTClaim;ClientIP
+	Type QuotaConsumerKeyType `json:"type"`
+
+	// Header is the name of the request header whose value is used as the consumer key.
+	//
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	Header *string `json:"header,omitempty"`
+
+	// JWTClaim is the name of the top-level claim of the JWT whose value is used as the consumer key.
+	//
+	// The claim is read from the payload of the JWT verified by the JWT authentication of the Envoy Gateway
+	// SecurityPolicy, so the requests without the verified JWT have no value for the claim.
+	//
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	JWTClaim *string `json:"jwtClaim,omitempty"`
+}
+
+// QuotaBudgetType specifies what is counted by the budget.
+type QuotaBudgetType string
+
+const (
+	// QuotaBudgetTypeToken is the type of the budget counting the total tokens of the requests.
+	QuotaBudgetTypeToken QuotaBudgetType = "Token"
+	// QuotaBudgetTypeCost is the type of the budget counting the cost of the requests calculated by
+	// the LLMRequestCost of the AIGatewayRoute specified by CostMetadataKey.
+	QuotaBudgetTypeCost QuotaBudgetType = "Cost"
+)
+
+// QuotaBudgetPeriod specifies the period after which the budget is reset.
+type QuotaBudgetPeriod string
+
+const (
+	// QuotaBudgetPeriodDaily resets the budget at 00:00 UTC every day.
+	QuotaBudgetPeriodDaily QuotaBudgetPeriod = "Daily"
+	// QuotaBudgetPeriodMonthly resets the budget at 00:00 UTC on the first day of every month.
+	QuotaBudgetPeriodMonthly QuotaBudgetPeriod = "Monthly"
+)
+
+// QuotaBudget specifies a budget for each consumer.
+//
+// +kubebuilder:validation:XValidation:rule="self.type == 'Cost' ? has(self.costMetadataKey) : !has(self.costMetadataKey)",message="costMetadataKey must be set if and only if type is Cost"
+type QuotaBudget struct {
+	// Name is the name of the budget which is unique within the QuotaPolicy.
+	// Changing the name resets the consumption counted so far.
+	//
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_.-]+$`
+	Name string `json:"name"`
+
+	// Models is the list of the model names this budget applies to. The consumption of all the listed models
+	// is counted together. If not specified, the budget applies to all the models.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	Models []string `json:"models,omitempty"`
+
+	// Type specifies what is counted by the budget.
+	//
+	// +kubebuilder:validation:Enum=Token;Cost
+	Type QuotaBudgetType `json:"type"`
+
+	// CostMetadataKey is the metadataKey of the LLMRequestCost configured in the AIGatewayRoute whose calculated
+	// value is counted by this budget. This must be set when the type is Cost, and must refer to the LLMRequestCost
+	// configured in an AIGatewayRoute attached to the same Gateway. Otherwise, the QuotaPolicy is rejected, and the
+	// ConsumerKey with this budget is left out of the Gateway.
+	//
+	// +optional
+	CostMetadataKey *string `json:"costMetadataKey,omitempty"`
+
+	// Period specifies the period after which the budget is reset. The periods follow the calendar in UTC.
+	//
+	// +kubebuilder:validation:Enum=Daily;Monthly
+	Period QuotaBudgetPeriod `json:"period"`
+
+	// Limit is the maximum amount of tokens or cost each consumer can use in the period.
+	//
+	// +kubebuilder:validation:Minimum=1
+	Limit int64 `json:"limit"`
+}
@@ -14,6 +14,9 @@ func init() {
 	SchemeBuilder.Register(&AIGatewayRoute{}, &AIGatewayRouteList{})
 	SchemeBuilder.Register(&AIServiceBackend{}, &AIServiceBackendList{})
 	SchemeBuilder.Register(&BackendSecurityPolicy{}, &BackendSecurityPolicyList{})
+	SchemeBuilder.Register(&QuotaPolicy{}, &QuotaPolicyList{})
+	SchemeBuilder.Register(&PricingCatalog{}, &PricingCatalogList{})
+	SchemeBuilder.Register(&ConsumerKey{}, &ConsumerKeyList{})
 }
 
 const GroupName = "aigateway.envoyproxy.io"
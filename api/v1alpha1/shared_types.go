@@ -78,9 +78,16 @@ type LLMRequestCost struct {
 	MetadataKey string `json:"metadataKey"`
 	// Type specifies the type of the request cost. The default is "OutputToken",
 	// and it uses "output token" as the cost. The other types are "InputToken", "TotalToken",
-	// and "CEL".
+	// "CEL", "EstimatedInputToken", "ReservedOutputToken" and "ReservedTotalToken".
 	//
-	// +kubebuilder:validation:Enum=OutputToken;InputToken;TotalToken;CEL
+	// The "EstimatedInputToken", "ReservedOutputToken" and "ReservedTotalToken" types are available
+	// before the request is sent upstream, so that they can be used for the admission-time rate limiting.
+	// The input token is estimated from the request content with the tokenizer of the model, and the
+	// output token is reserved by "max_tokens" or "max_completion_tokens" of the request (zero if unset).
+	// When the response completes, the metadata is overwritten with the actual input, output and total
+	// tokens respectively.
+	//
+	// +kubebuilder:validation:Enum=OutputToken;InputToken;TotalToken;CEL;EstimatedInputToken;ReservedOutputToken;ReservedTotalToken
 	Type LLMRequestCostType `json:"type"`
 	// CEL is the CEL expression to calculate the cost of the request.
 	// The CEL expression must return a signed or unsigned integer. If the
@@ -93,6 +100,20 @@ type LLMRequestCost struct {
 	//	* input_tokens: the number of input tokens. Type: unsigned integer.
 	//	* output_tokens: the number of output tokens. Type: unsigned integer.
 	//	* total_tokens: the total number of tokens. Type: unsigned integer.
+	//	* cached_input_tokens: the number of input tokens read from the prompt cache. Type: unsigned integer.
+	//	* reasoning_tokens: the number of output tokens used for the reasoning. Type: unsigned integer.
+	//	  This is always zero for the AWS Bedrock and the GCP Anthropic backends which do not report them separately.
+	//	* request: the attributes of the request. Type: object with the following fields.
+	//	  * headers: the request headers keyed by the lower-cased names. Type: map of string to string.
+	//	  * stream: whether the streaming response is requested. Type: bool.
+	//	  * retry: whether the request is a retry of the previous attempt. Type: bool.
+	//	  * images: the number of images in the request. Type: unsigned integer.
+	//	  * n: the number of choices requested, which is 1 by default. Type: unsigned integer.
+	//	* cost_micro_usd: the cost of the request in micro-USD computed from the PricingCatalog. Type: unsigned integer.
+	//	* input_token_price, output_token_price, cached_input_token_price, reasoning_token_price: the prices of the
+	//	  model in the PricingCatalog in micro-USD per token. Type: double.
+	//
+	// The cost and the prices are zero if the model has no price in the PricingCatalog.
 	//
 	// For example, the following expressions are valid:
 	//
@@ -100,6 +121,12 @@ type LLMRequestCost struct {
 	//	* "backend == 'foo.default' ?  input_tokens + output_tokens : total_tokens"
 	//	* "input_tokens + output_tokens + total_tokens"
 	//	* "input_tokens * output_tokens"
+	//	* "uint(double(input_tokens) * input_token_price)"
+	//	* "request.headers[?'x-tier'].orValue('free') == 'gold' ? total_tokens : total_tokens * uint(2)"
+	//	* "(input_tokens - cached_input_tokens + output_tokens) * request.n"
+	//
+	// The headers which may be absent must be accessed with the optional syntax "request.headers[?'name']"
+	// or checked with "'name' in request.headers", otherwise the expression is rejected.
 	//
 	// +optional
 	CEL *string `json:"cel,omitempty"`
@@ -117,6 +144,15 @@ const (
 	LLMRequestCostTypeTotalToken LLMRequestCostType = "TotalToken"
 	// LLMRequestCostTypeCEL is for calculating the cost using the CEL expression.
 	LLMRequestCostTypeCEL LLMRequestCostType = "CEL"
+	// LLMRequestCostTypeEstimatedInputToken is the cost type of the input token estimated before the request
+	// is sent upstream.
+	LLMRequestCostTypeEstimatedInputToken LLMRequestCostType = "EstimatedInputToken"
+	// LLMRequestCostTypeReservedOutputToken is the cost type of the output token reserved by the max tokens of
+	// the request before the request is sent upstream.
+	LLMRequestCostTypeReservedOutputToken LLMRequestCostType = "ReservedOutputToken"
+	// LLMRequestCostTypeReservedTotalToken is the cost type of the sum of the estimated input token and the
+	// reserved output token.
+	LLMRequestCostTypeReservedTotalToken LLMRequestCostType = "ReservedTotalToken"
 )
 
 const (
@@ -42,3 +42,30 @@ type BackendSecurityPolicyStatus struct {
 	// Known .status.conditions.type are: "Accepted", "NotAccepted".
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
+
+// QuotaPolicyStatus contains the conditions by the reconciliation result.
+type QuotaPolicyStatus struct {
+	// Conditions is the list of conditions by the reconciliation result.
+	// Currently, at most one condition is set.
+	//
+	// Known .status.conditions.type are: "Accepted", "NotAccepted".
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// PricingCatalogStatus contains the conditions by the reconciliation result.
+type PricingCatalogStatus struct {
+	// Conditions is the list of conditions by the reconciliation result.
+	// Currently, at most one condition is set.
+	//
+	// Known .status.conditions.type are: "Accepted", "NotAccepted".
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ConsumerKeyStatus contains the conditions by the reconciliation result.
+type ConsumerKeyStatus struct {
+	// Conditions is the list of conditions by the reconciliation result.
+	// Currently, at most one condition is set.
+	//
+	// Known .status.conditions.type are: "Accepted", "NotAccepted".
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
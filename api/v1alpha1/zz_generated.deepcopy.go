@@ -84,6 +84,151 @@ func (in *AIGatewayRoute) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteAuditLog) DeepCopyInto(out *AIGatewayRouteAuditLog) {
+	*out = *in
+	if in.Percentage != nil {
+		in, out := &in.Percentage, &out.Percentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RedactedFields != nil {
+		in, out := &in.RedactedFields, &out.RedactedFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxBodyBytes != nil {
+		in, out := &in.MaxBodyBytes, &out.MaxBodyBytes
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteAuditLog.
+func (in *AIGatewayRouteAuditLog) DeepCopy() *AIGatewayRouteAuditLog {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteAuditLog)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteAuthorization) DeepCopyInto(out *AIGatewayRouteAuthorization) {
+	*out = *in
+	out.Claim = in.Claim
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]AIGatewayRouteAuthorizationRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteAuthorization.
+func (in *AIGatewayRouteAuthorization) DeepCopy() *AIGatewayRouteAuthorization {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteAuthorization)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteAuthorizationClaim) DeepCopyInto(out *AIGatewayRouteAuthorizationClaim) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteAuthorizationClaim.
+func (in *AIGatewayRouteAuthorizationClaim) DeepCopy() *AIGatewayRouteAuthorizationClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteAuthorizationClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteAuthorizationRule) DeepCopyInto(out *AIGatewayRouteAuthorizationRule) {
+	*out = *in
+	if in.ClaimValues != nil {
+		in, out := &in.ClaimValues, &out.ClaimValues
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Models != nil {
+		in, out := &in.Models, &out.Models
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxTokens != nil {
+		in, out := &in.MaxTokens, &out.MaxTokens
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteAuthorizationRule.
+func (in *AIGatewayRouteAuthorizationRule) DeepCopy() *AIGatewayRouteAuthorizationRule {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteAuthorizationRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteCapture) DeepCopyInto(out *AIGatewayRouteCapture) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteCapture.
+func (in *AIGatewayRouteCapture) DeepCopy() *AIGatewayRouteCapture {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteCapture)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteGuardrails) DeepCopyInto(out *AIGatewayRouteGuardrails) {
+	*out = *in
+	if in.PII != nil {
+		in, out := &in.PII, &out.PII
+		*out = new(PIIGuardrail)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Secrets != nil {
+		in, out := &in.Secrets, &out.Secrets
+		*out = new(SecretGuardrail)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = make([]ExternalGuardrail, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteGuardrails.
+func (in *AIGatewayRouteGuardrails) DeepCopy() *AIGatewayRouteGuardrails {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteGuardrails)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AIGatewayRouteList) DeepCopyInto(out *AIGatewayRouteList) {
 	*out = *in
@@ -116,6 +261,171 @@ func (in *AIGatewayRouteList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteMetricAttribute) DeepCopyInto(out *AIGatewayRouteMetricAttribute) {
+	*out = *in
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(string)
+		**out = **in
+	}
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = new(AIGatewayRouteMetricAttributeMetadata)
+		**out = **in
+	}
+	if in.AllowedValues != nil {
+		in, out := &in.AllowedValues, &out.AllowedValues
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxValues != nil {
+		in, out := &in.MaxValues, &out.MaxValues
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteMetricAttribute.
+func (in *AIGatewayRouteMetricAttribute) DeepCopy() *AIGatewayRouteMetricAttribute {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteMetricAttribute)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteMetricAttributeMetadata) DeepCopyInto(out *AIGatewayRouteMetricAttributeMetadata) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteMetricAttributeMetadata.
+func (in *AIGatewayRouteMetricAttributeMetadata) DeepCopy() *AIGatewayRouteMetricAttributeMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteMetricAttributeMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteRequestLimits) DeepCopyInto(out *AIGatewayRouteRequestLimits) {
+	*out = *in
+	if in.MaxBodyBytes != nil {
+		in, out := &in.MaxBodyBytes, &out.MaxBodyBytes
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxPromptBytes != nil {
+		in, out := &in.MaxPromptBytes, &out.MaxPromptBytes
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxMessages != nil {
+		in, out := &in.MaxMessages, &out.MaxMessages
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxImages != nil {
+		in, out := &in.MaxImages, &out.MaxImages
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxTokens != nil {
+		in, out := &in.MaxTokens, &out.MaxTokens
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxN != nil {
+		in, out := &in.MaxN, &out.MaxN
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AllowedParameters != nil {
+		in, out := &in.AllowedParameters, &out.AllowedParameters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ForbiddenParameters != nil {
+		in, out := &in.ForbiddenParameters, &out.ForbiddenParameters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteRequestLimits.
+func (in *AIGatewayRouteRequestLimits) DeepCopy() *AIGatewayRouteRequestLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteRequestLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteResponseCache) DeepCopyInto(out *AIGatewayRouteResponseCache) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxEntryBytes != nil {
+		in, out := &in.MaxEntryBytes, &out.MaxEntryBytes
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Scope != nil {
+		in, out := &in.Scope, &out.Scope
+		*out = new(AIGatewayRouteResponseCacheScope)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Semantic != nil {
+		in, out := &in.Semantic, &out.Semantic
+		*out = new(AIGatewayRouteSemanticCache)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteResponseCache.
+func (in *AIGatewayRouteResponseCache) DeepCopy() *AIGatewayRouteResponseCache {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteResponseCache)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteResponseCacheScope) DeepCopyInto(out *AIGatewayRouteResponseCacheScope) {
+	*out = *in
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(string)
+		**out = **in
+	}
+	if in.JWTClaim != nil {
+		in, out := &in.JWTClaim, &out.JWTClaim
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteResponseCacheScope.
+func (in *AIGatewayRouteResponseCacheScope) DeepCopy() *AIGatewayRouteResponseCacheScope {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteResponseCacheScope)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AIGatewayRouteRule) DeepCopyInto(out *AIGatewayRouteRule) {
 	*out = *in
@@ -147,6 +457,26 @@ func (in *AIGatewayRouteRule) DeepCopyInto(out *AIGatewayRouteRule) {
 		in, out := &in.ModelsCreatedAt, &out.ModelsCreatedAt
 		*out = (*in).DeepCopy()
 	}
+	if in.HedgePolicy != nil {
+		in, out := &in.HedgePolicy, &out.HedgePolicy
+		*out = new(AIGatewayRouteRuleHedgePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LoadBalancing != nil {
+		in, out := &in.LoadBalancing, &out.LoadBalancing
+		*out = new(AIGatewayRouteRuleLoadBalancing)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ShadowPolicy != nil {
+		in, out := &in.ShadowPolicy, &out.ShadowPolicy
+		*out = new(AIGatewayRouteRuleShadowPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Experiment != nil {
+		in, out := &in.Experiment, &out.Experiment
+		*out = new(AIGatewayRouteRuleExperiment)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteRule.
@@ -185,94 +515,305 @@ func (in *AIGatewayRouteRuleBackendRef) DeepCopy() *AIGatewayRouteRuleBackendRef
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AIGatewayRouteRuleMatch) DeepCopyInto(out *AIGatewayRouteRuleMatch) {
+func (in *AIGatewayRouteRuleExperiment) DeepCopyInto(out *AIGatewayRouteRuleExperiment) {
 	*out = *in
-	if in.Headers != nil {
-		in, out := &in.Headers, &out.Headers
-		*out = make([]v1.HTTPHeaderMatch, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
+	in.Subject.DeepCopyInto(&out.Subject)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteRuleMatch.
-func (in *AIGatewayRouteRuleMatch) DeepCopy() *AIGatewayRouteRuleMatch {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteRuleExperiment.
+func (in *AIGatewayRouteRuleExperiment) DeepCopy() *AIGatewayRouteRuleExperiment {
 	if in == nil {
 		return nil
 	}
-	out := new(AIGatewayRouteRuleMatch)
+	out := new(AIGatewayRouteRuleExperiment)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AIGatewayRouteSpec) DeepCopyInto(out *AIGatewayRouteSpec) {
+func (in *AIGatewayRouteRuleExperimentSubject) DeepCopyInto(out *AIGatewayRouteRuleExperimentSubject) {
 	*out = *in
-	if in.TargetRefs != nil {
-		in, out := &in.TargetRefs, &out.TargetRefs
-		*out = make([]v1alpha2.LocalPolicyTargetReferenceWithSectionName, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-	if in.ParentRefs != nil {
-		in, out := &in.ParentRefs, &out.ParentRefs
-		*out = make([]v1.ParentReference, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-	in.APISchema.DeepCopyInto(&out.APISchema)
-	if in.Rules != nil {
-		in, out := &in.Rules, &out.Rules
-		*out = make([]AIGatewayRouteRule, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-	if in.FilterConfig != nil {
-		in, out := &in.FilterConfig, &out.FilterConfig
-		*out = new(AIGatewayFilterConfig)
-		(*in).DeepCopyInto(*out)
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(string)
+		**out = **in
 	}
-	if in.LLMRequestCosts != nil {
-		in, out := &in.LLMRequestCosts, &out.LLMRequestCosts
-		*out = make([]LLMRequestCost, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.JWTClaim != nil {
+		in, out := &in.JWTClaim, &out.JWTClaim
+		*out = new(string)
+		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteSpec.
-func (in *AIGatewayRouteSpec) DeepCopy() *AIGatewayRouteSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteRuleExperimentSubject.
+func (in *AIGatewayRouteRuleExperimentSubject) DeepCopy() *AIGatewayRouteRuleExperimentSubject {
 	if in == nil {
 		return nil
 	}
-	out := new(AIGatewayRouteSpec)
+	out := new(AIGatewayRouteRuleExperimentSubject)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AIGatewayRouteStatus) DeepCopyInto(out *AIGatewayRouteStatus) {
+func (in *AIGatewayRouteRuleHedgePolicy) DeepCopyInto(out *AIGatewayRouteRuleHedgePolicy) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]metav1.Condition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.MaxHedgedRequests != nil {
+		in, out := &in.MaxHedgedRequests, &out.MaxHedgedRequests
+		*out = new(int32)
+		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteStatus.
-func (in *AIGatewayRouteStatus) DeepCopy() *AIGatewayRouteStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteRuleHedgePolicy.
+func (in *AIGatewayRouteRuleHedgePolicy) DeepCopy() *AIGatewayRouteRuleHedgePolicy {
 	if in == nil {
 		return nil
 	}
-	out := new(AIGatewayRouteStatus)
+	out := new(AIGatewayRouteRuleHedgePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteRuleLoadBalancing) DeepCopyInto(out *AIGatewayRouteRuleLoadBalancing) {
+	*out = *in
+	if in.PrefixCacheAffinity != nil {
+		in, out := &in.PrefixCacheAffinity, &out.PrefixCacheAffinity
+		*out = new(PrefixCacheAffinity)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteRuleLoadBalancing.
+func (in *AIGatewayRouteRuleLoadBalancing) DeepCopy() *AIGatewayRouteRuleLoadBalancing {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteRuleLoadBalancing)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteRuleMatch) DeepCopyInto(out *AIGatewayRouteRuleMatch) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]v1.HTTPHeaderMatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteRuleMatch.
+func (in *AIGatewayRouteRuleMatch) DeepCopy() *AIGatewayRouteRuleMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteRuleMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteRuleShadowPolicy) DeepCopyInto(out *AIGatewayRouteRuleShadowPolicy) {
+	*out = *in
+	in.BackendRef.DeepCopyInto(&out.BackendRef)
+	if in.Percentage != nil {
+		in, out := &in.Percentage, &out.Percentage
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteRuleShadowPolicy.
+func (in *AIGatewayRouteRuleShadowPolicy) DeepCopy() *AIGatewayRouteRuleShadowPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteRuleShadowPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteSemanticCache) DeepCopyInto(out *AIGatewayRouteSemanticCache) {
+	*out = *in
+	if in.Endpoint != nil {
+		in, out := &in.Endpoint, &out.Endpoint
+		*out = new(string)
+		**out = **in
+	}
+	if in.SimilarityThreshold != nil {
+		in, out := &in.SimilarityThreshold, &out.SimilarityThreshold
+		*out = new(string)
+		**out = **in
+	}
+	if in.MaxEntries != nil {
+		in, out := &in.MaxEntries, &out.MaxEntries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteSemanticCache.
+func (in *AIGatewayRouteSemanticCache) DeepCopy() *AIGatewayRouteSemanticCache {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteSemanticCache)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteSpec) DeepCopyInto(out *AIGatewayRouteSpec) {
+	*out = *in
+	if in.TargetRefs != nil {
+		in, out := &in.TargetRefs, &out.TargetRefs
+		*out = make([]v1alpha2.LocalPolicyTargetReferenceWithSectionName, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ParentRefs != nil {
+		in, out := &in.ParentRefs, &out.ParentRefs
+		*out = make([]v1.ParentReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.APISchema.DeepCopyInto(&out.APISchema)
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]AIGatewayRouteRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.FilterConfig != nil {
+		in, out := &in.FilterConfig, &out.FilterConfig
+		*out = new(AIGatewayFilterConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LLMRequestCosts != nil {
+		in, out := &in.LLMRequestCosts, &out.LLMRequestCosts
+		*out = make([]LLMRequestCost, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Authorization != nil {
+		in, out := &in.Authorization, &out.Authorization
+		*out = new(AIGatewayRouteAuthorization)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Guardrails != nil {
+		in, out := &in.Guardrails, &out.Guardrails
+		*out = new(AIGatewayRouteGuardrails)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RequestLimits != nil {
+		in, out := &in.RequestLimits, &out.RequestLimits
+		*out = new(AIGatewayRouteRequestLimits)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ToolPolicy != nil {
+		in, out := &in.ToolPolicy, &out.ToolPolicy
+		*out = new(AIGatewayRouteToolPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AuditLog != nil {
+		in, out := &in.AuditLog, &out.AuditLog
+		*out = new(AIGatewayRouteAuditLog)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MetricAttributes != nil {
+		in, out := &in.MetricAttributes, &out.MetricAttributes
+		*out = make([]AIGatewayRouteMetricAttribute, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Capture != nil {
+		in, out := &in.Capture, &out.Capture
+		*out = new(AIGatewayRouteCapture)
+		**out = **in
+	}
+	if in.ResponseCache != nil {
+		in, out := &in.ResponseCache, &out.ResponseCache
+		*out = new(AIGatewayRouteResponseCache)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteSpec.
+func (in *AIGatewayRouteSpec) DeepCopy() *AIGatewayRouteSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteStatus) DeepCopyInto(out *AIGatewayRouteStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteStatus.
+func (in *AIGatewayRouteStatus) DeepCopy() *AIGatewayRouteStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIGatewayRouteToolPolicy) DeepCopyInto(out *AIGatewayRouteToolPolicy) {
+	*out = *in
+	if in.AllowedTools != nil {
+		in, out := &in.AllowedTools, &out.AllowedTools
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedTools != nil {
+		in, out := &in.DeniedTools, &out.DeniedTools
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Arguments != nil {
+		in, out := &in.Arguments, &out.Arguments
+		*out = make([]ToolArgumentsSchema, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIGatewayRouteToolPolicy.
+func (in *AIGatewayRouteToolPolicy) DeepCopy() *AIGatewayRouteToolPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AIGatewayRouteToolPolicy)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -304,6 +845,61 @@ func (in *AIServiceBackend) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIServiceBackendConcurrencyLimit) DeepCopyInto(out *AIServiceBackendConcurrencyLimit) {
+	*out = *in
+	if in.QueueTimeout != nil {
+		in, out := &in.QueueTimeout, &out.QueueTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Priority != nil {
+		in, out := &in.Priority, &out.Priority
+		*out = new(AIServiceBackendConcurrencyPriority)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIServiceBackendConcurrencyLimit.
+func (in *AIServiceBackendConcurrencyLimit) DeepCopy() *AIServiceBackendConcurrencyLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(AIServiceBackendConcurrencyLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIServiceBackendConcurrencyPriority) DeepCopyInto(out *AIServiceBackendConcurrencyPriority) {
+	*out = *in
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(string)
+		**out = **in
+	}
+	if in.JWTClaim != nil {
+		in, out := &in.JWTClaim, &out.JWTClaim
+		*out = new(string)
+		**out = **in
+	}
+	if in.Classes != nil {
+		in, out := &in.Classes, &out.Classes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIServiceBackendConcurrencyPriority.
+func (in *AIServiceBackendConcurrencyPriority) DeepCopy() *AIServiceBackendConcurrencyPriority {
+	if in == nil {
+		return nil
+	}
+	out := new(AIServiceBackendConcurrencyPriority)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AIServiceBackendList) DeepCopyInto(out *AIServiceBackendList) {
 	*out = *in
@@ -318,141 +914,756 @@ func (in *AIServiceBackendList) DeepCopyInto(out *AIServiceBackendList) {
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIServiceBackendList.
-func (in *AIServiceBackendList) DeepCopy() *AIServiceBackendList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIServiceBackendList.
+func (in *AIServiceBackendList) DeepCopy() *AIServiceBackendList {
+	if in == nil {
+		return nil
+	}
+	out := new(AIServiceBackendList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AIServiceBackendList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIServiceBackendSpec) DeepCopyInto(out *AIServiceBackendSpec) {
+	*out = *in
+	in.APISchema.DeepCopyInto(&out.APISchema)
+	in.BackendRef.DeepCopyInto(&out.BackendRef)
+	if in.BackendSecurityPolicyRef != nil {
+		in, out := &in.BackendSecurityPolicyRef, &out.BackendSecurityPolicyRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.ConcurrencyLimit != nil {
+		in, out := &in.ConcurrencyLimit, &out.ConcurrencyLimit
+		*out = new(AIServiceBackendConcurrencyLimit)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIServiceBackendSpec.
+func (in *AIServiceBackendSpec) DeepCopy() *AIServiceBackendSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AIServiceBackendSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AIServiceBackendStatus) DeepCopyInto(out *AIServiceBackendStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIServiceBackendStatus.
+func (in *AIServiceBackendStatus) DeepCopy() *AIServiceBackendStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AIServiceBackendStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AWSCredentialsFile) DeepCopyInto(out *AWSCredentialsFile) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.SecretObjectReference)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSCredentialsFile.
+func (in *AWSCredentialsFile) DeepCopy() *AWSCredentialsFile {
+	if in == nil {
+		return nil
+	}
+	out := new(AWSCredentialsFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AWSOIDCExchangeToken) DeepCopyInto(out *AWSOIDCExchangeToken) {
+	*out = *in
+	in.BackendSecurityPolicyOIDC.DeepCopyInto(&out.BackendSecurityPolicyOIDC)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSOIDCExchangeToken.
+func (in *AWSOIDCExchangeToken) DeepCopy() *AWSOIDCExchangeToken {
+	if in == nil {
+		return nil
+	}
+	out := new(AWSOIDCExchangeToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureOIDCExchangeToken) DeepCopyInto(out *AzureOIDCExchangeToken) {
+	*out = *in
+	in.BackendSecurityPolicyOIDC.DeepCopyInto(&out.BackendSecurityPolicyOIDC)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureOIDCExchangeToken.
+func (in *AzureOIDCExchangeToken) DeepCopy() *AzureOIDCExchangeToken {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureOIDCExchangeToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendSecurityPolicy) DeepCopyInto(out *BackendSecurityPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicy.
+func (in *BackendSecurityPolicy) DeepCopy() *BackendSecurityPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendSecurityPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BackendSecurityPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendSecurityPolicyAPIKey) DeepCopyInto(out *BackendSecurityPolicyAPIKey) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.SecretObjectReference)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyAPIKey.
+func (in *BackendSecurityPolicyAPIKey) DeepCopy() *BackendSecurityPolicyAPIKey {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendSecurityPolicyAPIKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendSecurityPolicyAWSCredentials) DeepCopyInto(out *BackendSecurityPolicyAWSCredentials) {
+	*out = *in
+	if in.CredentialsFile != nil {
+		in, out := &in.CredentialsFile, &out.CredentialsFile
+		*out = new(AWSCredentialsFile)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OIDCExchangeToken != nil {
+		in, out := &in.OIDCExchangeToken, &out.OIDCExchangeToken
+		*out = new(AWSOIDCExchangeToken)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyAWSCredentials.
+func (in *BackendSecurityPolicyAWSCredentials) DeepCopy() *BackendSecurityPolicyAWSCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendSecurityPolicyAWSCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendSecurityPolicyAzureCredentials) DeepCopyInto(out *BackendSecurityPolicyAzureCredentials) {
+	*out = *in
+	if in.ClientSecretRef != nil {
+		in, out := &in.ClientSecretRef, &out.ClientSecretRef
+		*out = new(v1.SecretObjectReference)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OIDCExchangeToken != nil {
+		in, out := &in.OIDCExchangeToken, &out.OIDCExchangeToken
+		*out = new(AzureOIDCExchangeToken)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyAzureCredentials.
+func (in *BackendSecurityPolicyAzureCredentials) DeepCopy() *BackendSecurityPolicyAzureCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendSecurityPolicyAzureCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendSecurityPolicyGCPCredentials) DeepCopyInto(out *BackendSecurityPolicyGCPCredentials) {
+	*out = *in
+	in.WorkLoadIdentityFederationConfig.DeepCopyInto(&out.WorkLoadIdentityFederationConfig)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyGCPCredentials.
+func (in *BackendSecurityPolicyGCPCredentials) DeepCopy() *BackendSecurityPolicyGCPCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendSecurityPolicyGCPCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendSecurityPolicyList) DeepCopyInto(out *BackendSecurityPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]BackendSecurityPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyList.
+func (in *BackendSecurityPolicyList) DeepCopy() *BackendSecurityPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendSecurityPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BackendSecurityPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendSecurityPolicyOIDC) DeepCopyInto(out *BackendSecurityPolicyOIDC) {
+	*out = *in
+	in.OIDC.DeepCopyInto(&out.OIDC)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyOIDC.
+func (in *BackendSecurityPolicyOIDC) DeepCopy() *BackendSecurityPolicyOIDC {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendSecurityPolicyOIDC)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendSecurityPolicySpec) DeepCopyInto(out *BackendSecurityPolicySpec) {
+	*out = *in
+	if in.APIKey != nil {
+		in, out := &in.APIKey, &out.APIKey
+		*out = new(BackendSecurityPolicyAPIKey)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AWSCredentials != nil {
+		in, out := &in.AWSCredentials, &out.AWSCredentials
+		*out = new(BackendSecurityPolicyAWSCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AzureCredentials != nil {
+		in, out := &in.AzureCredentials, &out.AzureCredentials
+		*out = new(BackendSecurityPolicyAzureCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GCPCredentials != nil {
+		in, out := &in.GCPCredentials, &out.GCPCredentials
+		*out = new(BackendSecurityPolicyGCPCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicySpec.
+func (in *BackendSecurityPolicySpec) DeepCopy() *BackendSecurityPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendSecurityPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendSecurityPolicyStatus) DeepCopyInto(out *BackendSecurityPolicyStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyStatus.
+func (in *BackendSecurityPolicyStatus) DeepCopy() *BackendSecurityPolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendSecurityPolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsumerKey) DeepCopyInto(out *ConsumerKey) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsumerKey.
+func (in *ConsumerKey) DeepCopy() *ConsumerKey {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsumerKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ConsumerKey) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsumerKeyList) DeepCopyInto(out *ConsumerKeyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ConsumerKey, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsumerKeyList.
+func (in *ConsumerKeyList) DeepCopy() *ConsumerKeyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsumerKeyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ConsumerKeyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsumerKeySpec) DeepCopyInto(out *ConsumerKeySpec) {
+	*out = *in
+	if in.TargetRefs != nil {
+		in, out := &in.TargetRefs, &out.TargetRefs
+		*out = make([]v1alpha2.LocalPolicyTargetReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.SecretObjectReference)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Models != nil {
+		in, out := &in.Models, &out.Models
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Budgets != nil {
+		in, out := &in.Budgets, &out.Budgets
+		*out = make([]QuotaBudget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsumerKeySpec.
+func (in *ConsumerKeySpec) DeepCopy() *ConsumerKeySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsumerKeySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsumerKeyStatus) DeepCopyInto(out *ConsumerKeyStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsumerKeyStatus.
+func (in *ConsumerKeyStatus) DeepCopy() *ConsumerKeyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsumerKeyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalGuardrail) DeepCopyInto(out *ExternalGuardrail) {
+	*out = *in
+	if in.Phases != nil {
+		in, out := &in.Phases, &out.Phases
+		*out = make([]ExternalGuardrailPhase, len(*in))
+		copy(*out, *in)
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalGuardrail.
+func (in *ExternalGuardrail) DeepCopy() *ExternalGuardrail {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalGuardrail)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPServiceAccountImpersonationConfig) DeepCopyInto(out *GCPServiceAccountImpersonationConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPServiceAccountImpersonationConfig.
+func (in *GCPServiceAccountImpersonationConfig) DeepCopy() *GCPServiceAccountImpersonationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPServiceAccountImpersonationConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPWorkLoadIdentityFederationConfig) DeepCopyInto(out *GCPWorkLoadIdentityFederationConfig) {
+	*out = *in
+	in.WorkloadIdentityProvider.DeepCopyInto(&out.WorkloadIdentityProvider)
+	if in.ServiceAccountImpersonation != nil {
+		in, out := &in.ServiceAccountImpersonation, &out.ServiceAccountImpersonation
+		*out = new(GCPServiceAccountImpersonationConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPWorkLoadIdentityFederationConfig.
+func (in *GCPWorkLoadIdentityFederationConfig) DeepCopy() *GCPWorkLoadIdentityFederationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPWorkLoadIdentityFederationConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPWorkloadIdentityProvider) DeepCopyInto(out *GCPWorkloadIdentityProvider) {
+	*out = *in
+	in.OIDCProvider.DeepCopyInto(&out.OIDCProvider)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPWorkloadIdentityProvider.
+func (in *GCPWorkloadIdentityProvider) DeepCopy() *GCPWorkloadIdentityProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPWorkloadIdentityProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LLMRequestCost) DeepCopyInto(out *LLMRequestCost) {
+	*out = *in
+	if in.CEL != nil {
+		in, out := &in.CEL, &out.CEL
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LLMRequestCost.
+func (in *LLMRequestCost) DeepCopy() *LLMRequestCost {
+	if in == nil {
+		return nil
+	}
+	out := new(LLMRequestCost)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelPrice) DeepCopyInto(out *ModelPrice) {
+	*out = *in
+	if in.BackendRef != nil {
+		in, out := &in.BackendRef, &out.BackendRef
+		*out = new(string)
+		**out = **in
+	}
+	if in.CachedInputTokenPrice != nil {
+		in, out := &in.CachedInputTokenPrice, &out.CachedInputTokenPrice
+		*out = new(USDPrice)
+		**out = **in
+	}
+	if in.ReasoningTokenPrice != nil {
+		in, out := &in.ReasoningTokenPrice, &out.ReasoningTokenPrice
+		*out = new(USDPrice)
+		**out = **in
+	}
+	if in.ImagePrice != nil {
+		in, out := &in.ImagePrice, &out.ImagePrice
+		*out = new(USDPrice)
+		**out = **in
+	}
+	if in.AudioSecondPrice != nil {
+		in, out := &in.AudioSecondPrice, &out.AudioSecondPrice
+		*out = new(USDPrice)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelPrice.
+func (in *ModelPrice) DeepCopy() *ModelPrice {
 	if in == nil {
 		return nil
 	}
-	out := new(AIServiceBackendList)
+	out := new(ModelPrice)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *AIServiceBackendList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AIServiceBackendSpec) DeepCopyInto(out *AIServiceBackendSpec) {
+func (in *PIICustomDetector) DeepCopyInto(out *PIICustomDetector) {
 	*out = *in
-	in.APISchema.DeepCopyInto(&out.APISchema)
-	in.BackendRef.DeepCopyInto(&out.BackendRef)
-	if in.BackendSecurityPolicyRef != nil {
-		in, out := &in.BackendSecurityPolicyRef, &out.BackendSecurityPolicyRef
-		*out = new(v1.LocalObjectReference)
+	if in.Validator != nil {
+		in, out := &in.Validator, &out.Validator
+		*out = new(PIIValidator)
 		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIServiceBackendSpec.
-func (in *AIServiceBackendSpec) DeepCopy() *AIServiceBackendSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PIICustomDetector.
+func (in *PIICustomDetector) DeepCopy() *PIICustomDetector {
 	if in == nil {
 		return nil
 	}
-	out := new(AIServiceBackendSpec)
+	out := new(PIICustomDetector)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AIServiceBackendStatus) DeepCopyInto(out *AIServiceBackendStatus) {
+func (in *PIIDetector) DeepCopyInto(out *PIIDetector) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]metav1.Condition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.Custom != nil {
+		in, out := &in.Custom, &out.Custom
+		*out = new(PIICustomDetector)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AIServiceBackendStatus.
-func (in *AIServiceBackendStatus) DeepCopy() *AIServiceBackendStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PIIDetector.
+func (in *PIIDetector) DeepCopy() *PIIDetector {
 	if in == nil {
 		return nil
 	}
-	out := new(AIServiceBackendStatus)
+	out := new(PIIDetector)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AWSCredentialsFile) DeepCopyInto(out *AWSCredentialsFile) {
+func (in *PIIGuardrail) DeepCopyInto(out *PIIGuardrail) {
 	*out = *in
-	if in.SecretRef != nil {
-		in, out := &in.SecretRef, &out.SecretRef
-		*out = new(v1.SecretObjectReference)
-		(*in).DeepCopyInto(*out)
+	if in.Detectors != nil {
+		in, out := &in.Detectors, &out.Detectors
+		*out = make([]PIIDetector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSCredentialsFile.
-func (in *AWSCredentialsFile) DeepCopy() *AWSCredentialsFile {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PIIGuardrail.
+func (in *PIIGuardrail) DeepCopy() *PIIGuardrail {
 	if in == nil {
 		return nil
 	}
-	out := new(AWSCredentialsFile)
+	out := new(PIIGuardrail)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AWSOIDCExchangeToken) DeepCopyInto(out *AWSOIDCExchangeToken) {
+func (in *PrefixCacheAffinity) DeepCopyInto(out *PrefixCacheAffinity) {
 	*out = *in
-	in.BackendSecurityPolicyOIDC.DeepCopyInto(&out.BackendSecurityPolicyOIDC)
+	if in.LeadingMessages != nil {
+		in, out := &in.LeadingMessages, &out.LeadingMessages
+		*out = new(int32)
+		**out = **in
+	}
+	if in.BoundedLoadFactor != nil {
+		in, out := &in.BoundedLoadFactor, &out.BoundedLoadFactor
+		*out = new(int32)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSOIDCExchangeToken.
-func (in *AWSOIDCExchangeToken) DeepCopy() *AWSOIDCExchangeToken {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrefixCacheAffinity.
+func (in *PrefixCacheAffinity) DeepCopy() *PrefixCacheAffinity {
 	if in == nil {
 		return nil
 	}
-	out := new(AWSOIDCExchangeToken)
+	out := new(PrefixCacheAffinity)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AzureOIDCExchangeToken) DeepCopyInto(out *AzureOIDCExchangeToken) {
+func (in *PricingCatalog) DeepCopyInto(out *PricingCatalog) {
 	*out = *in
-	in.BackendSecurityPolicyOIDC.DeepCopyInto(&out.BackendSecurityPolicyOIDC)
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureOIDCExchangeToken.
-func (in *AzureOIDCExchangeToken) DeepCopy() *AzureOIDCExchangeToken {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PricingCatalog.
+func (in *PricingCatalog) DeepCopy() *PricingCatalog {
 	if in == nil {
 		return nil
 	}
-	out := new(AzureOIDCExchangeToken)
+	out := new(PricingCatalog)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PricingCatalog) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *BackendSecurityPolicy) DeepCopyInto(out *BackendSecurityPolicy) {
+func (in *PricingCatalogList) DeepCopyInto(out *PricingCatalogList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	in.Status.DeepCopyInto(&out.Status)
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PricingCatalog, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicy.
-func (in *BackendSecurityPolicy) DeepCopy() *BackendSecurityPolicy {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PricingCatalogList.
+func (in *PricingCatalogList) DeepCopy() *PricingCatalogList {
 	if in == nil {
 		return nil
 	}
-	out := new(BackendSecurityPolicy)
+	out := new(PricingCatalogList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *BackendSecurityPolicy) DeepCopyObject() runtime.Object {
+func (in *PricingCatalogList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -460,117 +1671,127 @@ func (in *BackendSecurityPolicy) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *BackendSecurityPolicyAPIKey) DeepCopyInto(out *BackendSecurityPolicyAPIKey) {
+func (in *PricingCatalogSpec) DeepCopyInto(out *PricingCatalogSpec) {
 	*out = *in
-	if in.SecretRef != nil {
-		in, out := &in.SecretRef, &out.SecretRef
-		*out = new(v1.SecretObjectReference)
-		(*in).DeepCopyInto(*out)
+	if in.TargetRefs != nil {
+		in, out := &in.TargetRefs, &out.TargetRefs
+		*out = make([]v1alpha2.LocalPolicyTargetReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Prices != nil {
+		in, out := &in.Prices, &out.Prices
+		*out = make([]ModelPrice, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyAPIKey.
-func (in *BackendSecurityPolicyAPIKey) DeepCopy() *BackendSecurityPolicyAPIKey {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PricingCatalogSpec.
+func (in *PricingCatalogSpec) DeepCopy() *PricingCatalogSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(BackendSecurityPolicyAPIKey)
+	out := new(PricingCatalogSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *BackendSecurityPolicyAWSCredentials) DeepCopyInto(out *BackendSecurityPolicyAWSCredentials) {
+func (in *PricingCatalogStatus) DeepCopyInto(out *PricingCatalogStatus) {
 	*out = *in
-	if in.CredentialsFile != nil {
-		in, out := &in.CredentialsFile, &out.CredentialsFile
-		*out = new(AWSCredentialsFile)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.OIDCExchangeToken != nil {
-		in, out := &in.OIDCExchangeToken, &out.OIDCExchangeToken
-		*out = new(AWSOIDCExchangeToken)
-		(*in).DeepCopyInto(*out)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyAWSCredentials.
-func (in *BackendSecurityPolicyAWSCredentials) DeepCopy() *BackendSecurityPolicyAWSCredentials {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PricingCatalogStatus.
+func (in *PricingCatalogStatus) DeepCopy() *PricingCatalogStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(BackendSecurityPolicyAWSCredentials)
+	out := new(PricingCatalogStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *BackendSecurityPolicyAzureCredentials) DeepCopyInto(out *BackendSecurityPolicyAzureCredentials) {
+func (in *QuotaBudget) DeepCopyInto(out *QuotaBudget) {
 	*out = *in
-	if in.ClientSecretRef != nil {
-		in, out := &in.ClientSecretRef, &out.ClientSecretRef
-		*out = new(v1.SecretObjectReference)
-		(*in).DeepCopyInto(*out)
+	if in.Models != nil {
+		in, out := &in.Models, &out.Models
+		*out = make([]string, len(*in))
+		copy(*out, *in)
 	}
-	if in.OIDCExchangeToken != nil {
-		in, out := &in.OIDCExchangeToken, &out.OIDCExchangeToken
-		*out = new(AzureOIDCExchangeToken)
-		(*in).DeepCopyInto(*out)
+	if in.CostMetadataKey != nil {
+		in, out := &in.CostMetadataKey, &out.CostMetadataKey
+		*out = new(string)
+		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyAzureCredentials.
-func (in *BackendSecurityPolicyAzureCredentials) DeepCopy() *BackendSecurityPolicyAzureCredentials {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaBudget.
+func (in *QuotaBudget) DeepCopy() *QuotaBudget {
 	if in == nil {
 		return nil
 	}
-	out := new(BackendSecurityPolicyAzureCredentials)
+	out := new(QuotaBudget)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *BackendSecurityPolicyGCPCredentials) DeepCopyInto(out *BackendSecurityPolicyGCPCredentials) {
+func (in *QuotaConsumerKey) DeepCopyInto(out *QuotaConsumerKey) {
 	*out = *in
-	in.WorkLoadIdentityFederationConfig.DeepCopyInto(&out.WorkLoadIdentityFederationConfig)
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(string)
+		**out = **in
+	}
+	if in.JWTClaim != nil {
+		in, out := &in.JWTClaim, &out.JWTClaim
+		*out = new(string)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyGCPCredentials.
-func (in *BackendSecurityPolicyGCPCredentials) DeepCopy() *BackendSecurityPolicyGCPCredentials {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaConsumerKey.
+func (in *QuotaConsumerKey) DeepCopy() *QuotaConsumerKey {
 	if in == nil {
 		return nil
 	}
-	out := new(BackendSecurityPolicyGCPCredentials)
+	out := new(QuotaConsumerKey)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *BackendSecurityPolicyList) DeepCopyInto(out *BackendSecurityPolicyList) {
+func (in *QuotaPolicy) DeepCopyInto(out *QuotaPolicy) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]BackendSecurityPolicy, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyList.
-func (in *BackendSecurityPolicyList) DeepCopy() *BackendSecurityPolicyList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaPolicy.
+func (in *QuotaPolicy) DeepCopy() *QuotaPolicy {
 	if in == nil {
 		return nil
 	}
-	out := new(BackendSecurityPolicyList)
+	out := new(QuotaPolicy)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *BackendSecurityPolicyList) DeepCopyObject() runtime.Object {
+func (in *QuotaPolicy) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -578,58 +1799,69 @@ func (in *BackendSecurityPolicyList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *BackendSecurityPolicyOIDC) DeepCopyInto(out *BackendSecurityPolicyOIDC) {
+func (in *QuotaPolicyList) DeepCopyInto(out *QuotaPolicyList) {
 	*out = *in
-	in.OIDC.DeepCopyInto(&out.OIDC)
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]QuotaPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyOIDC.
-func (in *BackendSecurityPolicyOIDC) DeepCopy() *BackendSecurityPolicyOIDC {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaPolicyList.
+func (in *QuotaPolicyList) DeepCopy() *QuotaPolicyList {
 	if in == nil {
 		return nil
 	}
-	out := new(BackendSecurityPolicyOIDC)
+	out := new(QuotaPolicyList)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuotaPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *BackendSecurityPolicySpec) DeepCopyInto(out *BackendSecurityPolicySpec) {
+func (in *QuotaPolicySpec) DeepCopyInto(out *QuotaPolicySpec) {
 	*out = *in
-	if in.APIKey != nil {
-		in, out := &in.APIKey, &out.APIKey
-		*out = new(BackendSecurityPolicyAPIKey)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.AWSCredentials != nil {
-		in, out := &in.AWSCredentials, &out.AWSCredentials
-		*out = new(BackendSecurityPolicyAWSCredentials)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.AzureCredentials != nil {
-		in, out := &in.AzureCredentials, &out.AzureCredentials
-		*out = new(BackendSecurityPolicyAzureCredentials)
-		(*in).DeepCopyInto(*out)
+	if in.TargetRefs != nil {
+		in, out := &in.TargetRefs, &out.TargetRefs
+		*out = make([]v1alpha2.LocalPolicyTargetReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
-	if in.GCPCredentials != nil {
-		in, out := &in.GCPCredentials, &out.GCPCredentials
-		*out = new(BackendSecurityPolicyGCPCredentials)
-		(*in).DeepCopyInto(*out)
+	in.ConsumerKey.DeepCopyInto(&out.ConsumerKey)
+	if in.Budgets != nil {
+		in, out := &in.Budgets, &out.Budgets
+		*out = make([]QuotaBudget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicySpec.
-func (in *BackendSecurityPolicySpec) DeepCopy() *BackendSecurityPolicySpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaPolicySpec.
+func (in *QuotaPolicySpec) DeepCopy() *QuotaPolicySpec {
 	if in == nil {
 		return nil
 	}
-	out := new(BackendSecurityPolicySpec)
+	out := new(QuotaPolicySpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *BackendSecurityPolicyStatus) DeepCopyInto(out *BackendSecurityPolicyStatus) {
+func (in *QuotaPolicyStatus) DeepCopyInto(out *QuotaPolicyStatus) {
 	*out = *in
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
@@ -640,84 +1872,95 @@ func (in *BackendSecurityPolicyStatus) DeepCopyInto(out *BackendSecurityPolicySt
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendSecurityPolicyStatus.
-func (in *BackendSecurityPolicyStatus) DeepCopy() *BackendSecurityPolicyStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaPolicyStatus.
+func (in *QuotaPolicyStatus) DeepCopy() *QuotaPolicyStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(BackendSecurityPolicyStatus)
+	out := new(QuotaPolicyStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GCPServiceAccountImpersonationConfig) DeepCopyInto(out *GCPServiceAccountImpersonationConfig) {
+func (in *SecretCustomDetector) DeepCopyInto(out *SecretCustomDetector) {
 	*out = *in
+	if in.MinEntropy != nil {
+		in, out := &in.MinEntropy, &out.MinEntropy
+		*out = new(string)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPServiceAccountImpersonationConfig.
-func (in *GCPServiceAccountImpersonationConfig) DeepCopy() *GCPServiceAccountImpersonationConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretCustomDetector.
+func (in *SecretCustomDetector) DeepCopy() *SecretCustomDetector {
 	if in == nil {
 		return nil
 	}
-	out := new(GCPServiceAccountImpersonationConfig)
+	out := new(SecretCustomDetector)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GCPWorkLoadIdentityFederationConfig) DeepCopyInto(out *GCPWorkLoadIdentityFederationConfig) {
+func (in *SecretDetector) DeepCopyInto(out *SecretDetector) {
 	*out = *in
-	in.WorkloadIdentityProvider.DeepCopyInto(&out.WorkloadIdentityProvider)
-	if in.ServiceAccountImpersonation != nil {
-		in, out := &in.ServiceAccountImpersonation, &out.ServiceAccountImpersonation
-		*out = new(GCPServiceAccountImpersonationConfig)
-		**out = **in
+	if in.Custom != nil {
+		in, out := &in.Custom, &out.Custom
+		*out = new(SecretCustomDetector)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPWorkLoadIdentityFederationConfig.
-func (in *GCPWorkLoadIdentityFederationConfig) DeepCopy() *GCPWorkLoadIdentityFederationConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretDetector.
+func (in *SecretDetector) DeepCopy() *SecretDetector {
 	if in == nil {
 		return nil
 	}
-	out := new(GCPWorkLoadIdentityFederationConfig)
+	out := new(SecretDetector)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GCPWorkloadIdentityProvider) DeepCopyInto(out *GCPWorkloadIdentityProvider) {
+func (in *SecretGuardrail) DeepCopyInto(out *SecretGuardrail) {
 	*out = *in
-	in.OIDCProvider.DeepCopyInto(&out.OIDCProvider)
+	if in.Detectors != nil {
+		in, out := &in.Detectors, &out.Detectors
+		*out = make([]SecretDetector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Phases != nil {
+		in, out := &in.Phases, &out.Phases
+		*out = make([]SecretGuardrailPhase, len(*in))
+		copy(*out, *in)
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPWorkloadIdentityProvider.
-func (in *GCPWorkloadIdentityProvider) DeepCopy() *GCPWorkloadIdentityProvider {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretGuardrail.
+func (in *SecretGuardrail) DeepCopy() *SecretGuardrail {
 	if in == nil {
 		return nil
 	}
-	out := new(GCPWorkloadIdentityProvider)
+	out := new(SecretGuardrail)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *LLMRequestCost) DeepCopyInto(out *LLMRequestCost) {
+func (in *ToolArgumentsSchema) DeepCopyInto(out *ToolArgumentsSchema) {
 	*out = *in
-	if in.CEL != nil {
-		in, out := &in.CEL, &out.CEL
-		*out = new(string)
-		**out = **in
-	}
+	in.Schema.DeepCopyInto(&out.Schema)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LLMRequestCost.
-func (in *LLMRequestCost) DeepCopy() *LLMRequestCost {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ToolArgumentsSchema.
+func (in *ToolArgumentsSchema) DeepCopy() *ToolArgumentsSchema {
 	if in == nil {
 		return nil
 	}
-	out := new(LLMRequestCost)
+	out := new(ToolArgumentsSchema)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -27,6 +27,8 @@ type (
 		Translate cmdTranslate `cmd:"" help:"Translate yaml files containing AI Gateway resources to Envoy Gateway and Kubernetes resources. The translated resources are written to stdout."`
 		// Run is the sub-command parsed by the `cmdRun` struct.
 		Run cmdRun `cmd:"" help:"Run the AI Gateway locally for given configuration."`
+		// Replay is the sub-command parsed by the `cmdReplay` struct.
+		Replay cmdReplay `cmd:"" help:"Replay the requests captured by the external processor through the current translators, and show the differences from the captured ones."`
 	}
 	// cmdTranslate corresponds to `aigw translate` command.
 	cmdTranslate struct {
@@ -39,16 +41,21 @@ type (
 		Path        string `arg:"" name:"path" optional:"" help:"Path to the AI Gateway configuration yaml file. Optional. When this is not given, aigw runs the default configuration. Use --show-default to check the default configuration's behavior" type:"path"`
 		ShowDefault bool   `help:"Show the default configuration, and exit."`
 	}
+	// cmdReplay corresponds to `aigw replay` command.
+	cmdReplay struct {
+		Paths []string `arg:"" name:"path" help:"Paths to the capture files or the directories containing them." type:"path"`
+	}
 )
 
 type (
 	subCmdFn[T any] func(context.Context, T, io.Writer, io.Writer) error
 	translateFn     subCmdFn[cmdTranslate]
 	runFn           subCmdFn[cmdRun]
+	replayFn        subCmdFn[cmdReplay]
 )
 
 func main() {
-	doMain(ctrl.SetupSignalHandler(), os.Stdout, os.Stderr, os.Args[1:], os.Exit, translate, run)
+	doMain(ctrl.SetupSignalHandler(), os.Stdout, os.Stderr, os.Args[1:], os.Exit, translate, run, replay)
 }
 
 // doMain is the main entry point for the CLI. It parses the command line arguments and executes the appropriate command.
@@ -59,9 +66,11 @@ func main() {
 //   - exitFn is the function to call to exit the program during the parsing of the command line arguments. Mainly for testing.
 //   - tf is the function to call to translate the AI Gateway resources to Envoy Gateway and Kubernetes resources. Mainly for testing.
 //   - rf is the function to call to run the AI Gateway locally. Mainly for testing.
+//   - rpf is the function to call to replay the captured requests. Mainly for testing.
 func doMain(ctx context.Context, stdout, stderr io.Writer, args []string, exitFn func(int),
 	tf translateFn,
 	rf runFn,
+	rpf replayFn,
 ) {
 	var c cmd
 	parser, err := kong.New(&c,
@@ -88,6 +97,11 @@ func doMain(ctx context.Context, stdout, stderr io.Writer, args []string, exitFn
 		if err != nil {
 			log.Fatalf("Error running: %v", err)
 		}
+	case "replay <path>":
+		err = rpf(ctx, c.Replay, stdout, stderr)
+		if err != nil {
+			log.Fatalf("Error replaying: %v", err)
+		}
 	default:
 		panic("unreachable")
 	}
@@ -23,6 +23,7 @@ func Test_doMain(t *testing.T) {
 		args         []string
 		tf           translateFn
 		rf           runFn
+		rpf          replayFn
 		expOut       string
 		expPanicCode *int
 	}{
@@ -47,6 +48,10 @@ Commands:
   run [<path>] [flags]
     Run the AI Gateway locally for given configuration.
 
+  replay <path> ...
+    Replay the requests captured by the external processor through the current
+    translators, and show the differences from the captured ones.
+
 Run "aigw <command> --help" for more information on a command.
 `,
 			expPanicCode: ptr.To(0),
@@ -149,16 +154,32 @@ Flags:
 				return nil
 			},
 		},
+		{
+			name: "replay",
+			args: []string{"replay", "path1", "path2"},
+			rpf: func(_ context.Context, c cmdReplay, _, _ io.Writer) error {
+				cwd, err := os.Getwd()
+				require.NoError(t, err)
+				require.Equal(t, []string{cwd + "/path1", cwd + "/path2"}, c.Paths)
+				return nil
+			},
+		},
+		{
+			name:         "replay no arg",
+			args:         []string{"replay"},
+			rpf:          func(_ context.Context, _ cmdReplay, _, _ io.Writer) error { return nil },
+			expPanicCode: ptr.To(80),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			out := &bytes.Buffer{}
 			if tt.expPanicCode != nil {
 				require.PanicsWithValue(t, *tt.expPanicCode, func() {
-					doMain(t.Context(), out, os.Stderr, tt.args, func(code int) { panic(code) }, tt.tf, tt.rf)
+					doMain(t.Context(), out, os.Stderr, tt.args, func(code int) { panic(code) }, tt.tf, tt.rf, tt.rpf)
 				})
 			} else {
-				doMain(t.Context(), out, os.Stderr, tt.args, nil, tt.tf, tt.rf)
+				doMain(t.Context(), out, os.Stderr, tt.args, nil, tt.tf, tt.rf, tt.rpf)
 			}
 			require.Equal(t, tt.expOut, out.String())
 		})
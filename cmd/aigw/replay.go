@@ -0,0 +1,121 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/capture"
+)
+
+// replay implements subCmd[cmdReplay]. This function reads the capture files, translates the captured requests and
+// the captured responses of the backends again with the translators of this version, and writes the differences
+// from the captured translations to the output writer. This returns an error if any of them differs.
+func replay(_ context.Context, cmd cmdReplay, output, _ io.Writer) error {
+	files, err := captureFiles(cmd.Paths)
+	if err != nil {
+		return err
+	}
+	var differed int
+	for _, file := range files {
+		r, err := capture.Read(file)
+		if err != nil {
+			return err
+		}
+		same, err := replayRecord(r, output)
+		if err != nil {
+			return fmt.Errorf("failed to replay %s: %w", file, err)
+		}
+		if !same {
+			differed++
+		}
+	}
+	if differed > 0 {
+		return fmt.Errorf("%d of %d captures differ", differed, len(files))
+	}
+	return nil
+}
+
+// captureFiles returns the capture files of the paths, where the directories are expanded to the JSON files in them.
+func captureFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", p, err)
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list captures in %s: %w", p, err)
+		}
+		slices.Sort(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// replayRecord replays the attempts of the capture and writes the differences to the output writer. This returns
+// true if the replayed translations are the same as the captured ones.
+func replayRecord(r *capture.Record, output io.Writer) (bool, error) {
+	if r.Path != "/v1/chat/completions" {
+		_, _ = fmt.Fprintf(output, "%s: skipped the unsupported path %s\n", r.ID, r.Path)
+		return true, nil
+	}
+	if len(r.Attempts) == 0 {
+		_, _ = fmt.Fprintf(output, "%s: skipped since the request was not sent to any backend\n", r.ID)
+		return true, nil
+	}
+	same := true
+	for i, a := range r.Attempts {
+		replayed, err := extproc.ReplayChatCompletionAttempt(r, a)
+		if err != nil {
+			return false, fmt.Errorf("attempt %d: %w", i+1, err)
+		}
+		_, _ = fmt.Fprintf(output, "%s: attempt %d to %s (%s)\n", r.ID, i+1, a.Backend, a.Schema.Name)
+		same = writeDiff(output, "request headers", a.RequestHeaders, replayed.RequestHeaders) && same
+		same = writeDiff(output, "request body", string(a.RequestBody), string(replayed.RequestBody)) && same
+		if a.ResponseHeaders != nil {
+			same = writeDiff(output, "response body", chunkStrings(a.ClientResponseChunks), chunkStrings(replayed.ClientResponseChunks)) && same
+		}
+		if r.Truncated {
+			_, _ = fmt.Fprintln(output, "  the response was truncated in the capture")
+		}
+	}
+	return same, nil
+}
+
+// writeDiff writes the difference between the captured and the replayed values to the output writer, and returns
+// true if they are the same.
+func writeDiff(output io.Writer, name string, captured, replayed any) bool {
+	diff := cmp.Diff(captured, replayed)
+	if diff == "" {
+		_, _ = fmt.Fprintf(output, "  %s: same\n", name)
+		return true
+	}
+	_, _ = fmt.Fprintf(output, "  %s: differs (-captured +replayed):\n%s", name, diff)
+	return false
+}
+
+// chunkStrings converts the chunks to strings so that their differences are shown as text.
+func chunkStrings(chunks [][]byte) []string {
+	ret := make([]string, len(chunks))
+	for i, c := range chunks {
+		ret[i] = string(c)
+	}
+	return ret
+}
@@ -0,0 +1,90 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/capture"
+)
+
+// writeReplayTestCapture writes the capture of the request to the AWS Bedrock backend whose translations are the ones
+// of the current translators, with the modification by the function, and returns its path.
+func writeReplayTestCapture(t *testing.T, dir string, modify func(a *capture.Attempt)) string {
+	r := &capture.Record{
+		ID:      "req-1",
+		Path:    "/v1/chat/completions",
+		Model:   "gpt",
+		Request: []byte(`{"model":"gpt","messages":[{"role":"user","content":"hello"}]}`),
+	}
+	a, err := extproc.ReplayChatCompletionAttempt(r, &capture.Attempt{
+		Backend:         "backend",
+		Schema:          filterapi.VersionedAPISchema{Name: filterapi.APISchemaAWSBedrock},
+		ResponseHeaders: map[string]string{":status": "200", "content-type": "application/json"},
+		ResponseChunks: [][]byte{
+			[]byte(`{"output":{"message":{"role":"assistant","content":[{"text":"hi"}]}},"usage":{"inputTokens":1,"outputTokens":1,"totalTokens":2}}`),
+		},
+	})
+	require.NoError(t, err)
+	modify(a)
+	r.Attempts = []*capture.Attempt{a}
+	w, err := capture.NewWriter(dir, 1<<20, 10)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(r))
+	return filepath.Join(dir, "req-1.json")
+}
+
+func TestReplay(t *testing.T) {
+	t.Run("same", func(t *testing.T) {
+		dir := t.TempDir()
+		writeReplayTestCapture(t, dir, func(*capture.Attempt) {})
+		out := &bytes.Buffer{}
+		// The directory is expanded to the capture files in it.
+		require.NoError(t, replay(t.Context(), cmdReplay{Paths: []string{dir}}, out, os.Stderr))
+		require.Equal(t, `req-1: attempt 1 to backend (AWSBedrock)
+  request headers: same
+  request body: same
+  response body: same
+`, out.String())
+	})
+
+	t.Run("differs", func(t *testing.T) {
+		path := writeReplayTestCapture(t, t.TempDir(), func(a *capture.Attempt) {
+			a.ClientResponseChunks = [][]byte{[]byte(`{"choices":[]}`)}
+		})
+		out := &bytes.Buffer{}
+		err := replay(t.Context(), cmdReplay{Paths: []string{path}}, out, os.Stderr)
+		require.EqualError(t, err, "1 of 1 captures differ")
+		require.Contains(t, out.String(), "  request body: same\n")
+		require.Contains(t, out.String(), "  response body: differs (-captured +replayed):\n")
+		require.Contains(t, out.String(), `{"choices":[]}`)
+	})
+
+	t.Run("skipped", func(t *testing.T) {
+		dir := t.TempDir()
+		w, err := capture.NewWriter(dir, 1<<20, 10)
+		require.NoError(t, err)
+		require.NoError(t, w.Write(&capture.Record{ID: "req-1", Path: "/v1/embeddings"}))
+		require.NoError(t, w.Write(&capture.Record{ID: "req-2", Path: "/v1/chat/completions", LocalReplyStatus: 403}))
+		out := &bytes.Buffer{}
+		require.NoError(t, replay(t.Context(), cmdReplay{Paths: []string{dir}}, out, os.Stderr))
+		require.Equal(t, `req-1: skipped the unsupported path /v1/embeddings
+req-2: skipped since the request was not sent to any backend
+`, out.String())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := replay(t.Context(), cmdReplay{Paths: []string{filepath.Join(t.TempDir(), "nonexistent.json")}}, &bytes.Buffer{}, os.Stderr)
+		require.ErrorContains(t, err, "failed to stat")
+	})
+}
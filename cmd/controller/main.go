@@ -34,6 +34,12 @@ type flags struct {
 	extProcLogLevel        string
 	extProcImage           string
 	extProcImagePullPolicy corev1.PullPolicy
+	extProcQuotaRedisAddr  string
+	extProcUsageLedger     controller.UsageLedgerOptions
+	extProcAuditLog        controller.AuditLogOptions
+	extProcTracing         controller.TracingOptions
+	extProcMetrics         controller.MetricsOptions
+	extProcCaptureDir      string
 	enableLeaderElection   bool
 	logLevel               zapcore.Level
 	extensionServerPort    string
@@ -42,6 +48,8 @@ type flags struct {
 	tlsKeyName             string
 	caBundleName           string
 	envoyGatewayNamespace  string
+	// extProcResponseCacheRedisAddr is the address of the Redis-protocol server for the cached responses.
+	extProcResponseCacheRedisAddr string
 }
 
 // parsePullPolicy parses string into a k8s PullPolicy.
@@ -74,6 +82,97 @@ func parseAndValidateFlags(args []string) (flags, error) {
 		"IfNotPresent",
 		"The image pull policy for the external processor. One of 'Always', 'Never', 'IfNotPresent'",
 	)
+	extProcQuotaRedisAddrPtr := fs.String(
+		"extProcQuotaRedisAddr",
+		"",
+		"The address of the Redis-protocol server where the external processor stores the QuotaPolicy counters. "+
+			"If empty, the counters are kept in the memory of each external processor.",
+	)
+	var extProcUsageLedger controller.UsageLedgerOptions
+	fs.StringVar(&extProcUsageLedger.Sink,
+		"extProcUsageLedgerSink",
+		"",
+		"The sink where the external processor exports the usage records of the completed requests. "+
+			"One of 'file', 'otlp', or 'webhook'. If empty, the usage records are not exported.",
+	)
+	fs.StringVar(&extProcUsageLedger.Endpoint,
+		"extProcUsageLedgerEndpoint",
+		"",
+		"The file path, the OTLP/HTTP endpoint or the webhook URL of the usage ledger sink.",
+	)
+	fs.StringVar(&extProcUsageLedger.ConsumerHeader,
+		"extProcUsageLedgerConsumerHeader",
+		"",
+		"The name of the request header identifying the consumer in the usage records.",
+	)
+	fs.StringVar(&extProcUsageLedger.ConsumerJWTClaim,
+		"extProcUsageLedgerConsumerJWTClaim",
+		"",
+		"The name of the claim of the verified JWT identifying the consumer in the usage records.",
+	)
+	var extProcAuditLog controller.AuditLogOptions
+	fs.StringVar(&extProcAuditLog.Sink,
+		"extProcAuditLogSink",
+		"",
+		"The sink where the external processor exports the audit records, such as the tool calls and the conversations. "+
+			"Either 'file' or 'otlp'. If empty, the audit records are not exported.",
+	)
+	fs.StringVar(&extProcAuditLog.Endpoint,
+		"extProcAuditLogEndpoint",
+		"",
+		"The file path or the OTLP/HTTP endpoint of the audit log sink.",
+	)
+	var extProcTracing controller.TracingOptions
+	fs.StringVar(&extProcTracing.Endpoint,
+		"extProcTracingEndpoint",
+		"",
+		"The OTLP/HTTP endpoint where the external processor exports the spans of the requests. "+
+			"If empty, the requests are not traced.",
+	)
+	fs.Float64Var(&extProcTracing.SampleRatio,
+		"extProcTracingSampleRatio",
+		1.0,
+		"The ratio from 0 to 1 of the traces sampled by the external processor when the incoming request has no sampling decision.",
+	)
+	fs.BoolVar(&extProcTracing.CaptureContent,
+		"extProcTracingCaptureContent",
+		false,
+		"Record the prompts and the completions as the events of the spans. They may contain sensitive data.",
+	)
+	var extProcMetrics controller.MetricsOptions
+	fs.StringVar(&extProcMetrics.Exporter,
+		"extProcMetricsExporter",
+		"",
+		"The comma-separated list of the exporters of the metrics of the external processor. Each is one of "+
+			"'prometheus', 'otlp', or 'none'. If empty, the external processor only serves the Prometheus metrics.",
+	)
+	fs.StringVar(&extProcMetrics.OTLPEndpoint,
+		"extProcMetricsOTLPEndpoint",
+		"",
+		"The OTLP endpoint where the external processor pushes the metrics to with the 'otlp' exporter.",
+	)
+	fs.StringVar(&extProcMetrics.OTLPProtocol,
+		"extProcMetricsOTLPProtocol",
+		"",
+		"The protocol of the OTLP metrics exporter of the external processor. Either 'grpc' or 'http/protobuf'.",
+	)
+	fs.DurationVar(&extProcMetrics.OTLPExportInterval,
+		"extProcMetricsOTLPExportInterval",
+		0,
+		"The interval between the pushes of the metrics by the external processor. If zero, it is 60 seconds.",
+	)
+	extProcCaptureDirPtr := fs.String(
+		"extProcCaptureDir",
+		"",
+		"The directory where the external processor writes the captures of the requests of the AIGatewayRoutes with "+
+			"the capture enabled. If empty, the requests are not captured.",
+	)
+	extProcResponseCacheRedisAddrPtr := fs.String(
+		"extProcResponseCacheRedisAddr",
+		"",
+		"The address of the Redis-protocol server where the external processor stores the responses cached by the "+
+			"AIGatewayRoutes. If empty, the responses are kept in the memory of each external processor.",
+	)
 	enableLeaderElectionPtr := fs.Bool(
 		"enableLeaderElection",
 		true,
@@ -141,6 +240,12 @@ func parseAndValidateFlags(args []string) (flags, error) {
 		extProcLogLevel:        *extProcLogLevelPtr,
 		extProcImage:           *extProcImagePtr,
 		extProcImagePullPolicy: extProcPullPolicy,
+		extProcQuotaRedisAddr:  *extProcQuotaRedisAddrPtr,
+		extProcUsageLedger:     extProcUsageLedger,
+		extProcAuditLog:        extProcAuditLog,
+		extProcTracing:         extProcTracing,
+		extProcMetrics:         extProcMetrics,
+		extProcCaptureDir:      *extProcCaptureDirPtr,
 		enableLeaderElection:   *enableLeaderElectionPtr,
 		logLevel:               zapLogLevel,
 		extensionServerPort:    *extensionServerPortPtr,
@@ -149,6 +254,8 @@ func parseAndValidateFlags(args []string) (flags, error) {
 		tlsKeyName:             *tlsKeyName,
 		caBundleName:           *caBundleName,
 		envoyGatewayNamespace:  *envoyGatewayNamespace,
+
+		extProcResponseCacheRedisAddr: *extProcResponseCacheRedisAddrPtr,
 	}, nil
 }
 
@@ -219,9 +326,17 @@ func main() {
 		ExtProcImage:           flags.extProcImage,
 		ExtProcImagePullPolicy: flags.extProcImagePullPolicy,
 		ExtProcLogLevel:        flags.extProcLogLevel,
+		ExtProcQuotaRedisAddr:  flags.extProcQuotaRedisAddr,
+		ExtProcUsageLedger:     flags.extProcUsageLedger,
+		ExtProcAuditLog:        flags.extProcAuditLog,
+		ExtProcTracing:         flags.extProcTracing,
+		ExtProcMetrics:         flags.extProcMetrics,
+		ExtProcCaptureDir:      flags.extProcCaptureDir,
 		EnableLeaderElection:   flags.enableLeaderElection,
 		EnvoyGatewayNamespace:  flags.envoyGatewayNamespace,
 		UDSPath:                extProcUDSPath,
+
+		ExtProcResponseCacheRedisAddr: flags.extProcResponseCacheRedisAddr,
 	}); err != nil {
 		setupLog.Error(err, "failed to start controller")
 	}
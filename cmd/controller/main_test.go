@@ -45,6 +45,8 @@ func Test_parseAndValidateFlags(t *testing.T) {
 					tc.dash + "extProcLogLevel=debug",
 					tc.dash + "extProcImage=example.com/extproc:latest",
 					tc.dash + "extProcImagePullPolicy=Always",
+					tc.dash + "extProcQuotaRedisAddr=redis:6379",
+					tc.dash + "extProcResponseCacheRedisAddr=valkey:6379",
 					tc.dash + "enableLeaderElection=false",
 					tc.dash + "logLevel=debug",
 					tc.dash + "port=:8080",
@@ -53,6 +55,8 @@ func Test_parseAndValidateFlags(t *testing.T) {
 				require.Equal(t, "debug", f.extProcLogLevel)
 				require.Equal(t, "example.com/extproc:latest", f.extProcImage)
 				require.Equal(t, corev1.PullAlways, f.extProcImagePullPolicy)
+				require.Equal(t, "redis:6379", f.extProcQuotaRedisAddr)
+				require.Equal(t, "valkey:6379", f.extProcResponseCacheRedisAddr)
 				require.False(t, f.enableLeaderElection)
 				require.Equal(t, "debug", f.logLevel.String())
 				require.Equal(t, ":8080", f.extensionServerPort)
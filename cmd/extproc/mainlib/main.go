@@ -6,12 +6,12 @@
 package mainlib
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
 	"log/slog"
 	"net"
 	"net/http"
@@ -23,7 +23,6 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
-	"go.opentelemetry.io/otel/metric"
 	metricsdk "go.opentelemetry.io/otel/sdk/metric"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -31,7 +30,14 @@ import (
 
 	"github.com/envoyproxy/ai-gateway/filterapi/x"
 	"github.com/envoyproxy/ai-gateway/internal/extproc"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/audit"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/capture"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/ledger"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/quota"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/responsecache"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/tokenizer"
 	"github.com/envoyproxy/ai-gateway/internal/metrics"
+	"github.com/envoyproxy/ai-gateway/internal/tracing"
 	"github.com/envoyproxy/ai-gateway/internal/version"
 )
 
@@ -42,8 +48,67 @@ type extProcFlags struct {
 	logLevel    slog.Level // log level for the external processor.
 	metricsPort int        // HTTP port for the metrics server.
 	healthPort  int        // HTTP port for the health check server.
+	// quotaRedisAddr is the address of the Redis-protocol server for the quota counters. Empty means in-memory.
+	quotaRedisAddr string
+	// responseCacheRedisAddr is the address of the Redis-protocol server for the cached responses. Empty means
+	// in-memory, where responseCacheMaxBytes is the maximum total size of the cached responses.
+	responseCacheRedisAddr string
+	responseCacheMaxBytes  int
+	// usageLedgerSink is the kind of the sink of the usage records, and usageLedgerEndpoint is its file path or URL.
+	// Empty sink means the usage ledger is disabled.
+	usageLedgerSink     string
+	usageLedgerEndpoint string
+	// usageLedgerConsumerHeader and usageLedgerConsumerJWTClaim identify the consumer in the usage records.
+	usageLedgerConsumerHeader   string
+	usageLedgerConsumerJWTClaim string
+	// usageLedgerFileMaxSizeMB and usageLedgerFileMaxBackups control the rotation of the file sink.
+	usageLedgerFileMaxSizeMB  int
+	usageLedgerFileMaxBackups int
+	// auditLogSink is the kind of the sink of the audit records, and auditLogEndpoint is its file path or URL.
+	// Empty sink means the audit log is disabled.
+	auditLogSink     string
+	auditLogEndpoint string
+	// auditLogFileMaxSizeMB and auditLogFileMaxBackups control the rotation of the file sink.
+	auditLogFileMaxSizeMB  int
+	auditLogFileMaxBackups int
+	// tracingEndpoint is the OTLP/HTTP endpoint of the spans of the requests. Empty means the tracing is disabled.
+	tracingEndpoint string
+	// tracingSampleRatio is the ratio of the traces sampled when the incoming request has no sampling decision.
+	tracingSampleRatio float64
+	// tracingCaptureContent is true if the prompts and the completions are recorded in the spans.
+	tracingCaptureContent bool
+	// metricsExporter is the comma-separated list of the exporters of the metrics, and metricsPrometheus and
+	// metricsOTLP tell which of them are enabled.
+	metricsExporter   string
+	metricsPrometheus bool
+	metricsOTLP       bool
+	// metricsOTLPEndpoint, metricsOTLPProtocol and metricsOTLPExportInterval configure the OTLP exporter.
+	// The empty endpoint and the zero interval default to the standard OTEL_* environment variables.
+	metricsOTLPEndpoint       string
+	metricsOTLPProtocol       string
+	metricsOTLPExportInterval time.Duration
+	// captureDir is the directory where the requests of the rules with the capture enabled are written. Empty means
+	// the capture is disabled. captureMaxBytes and captureMaxFiles are the limits of the directory.
+	captureDir      string
+	captureMaxBytes int64
+	captureMaxFiles int
 }
 
+const (
+	// usageLedgerSinkFile, usageLedgerSinkOTLP and usageLedgerSinkWebhook are the kinds of the usage ledger sinks.
+	usageLedgerSinkFile    = "file"
+	usageLedgerSinkOTLP    = "otlp"
+	usageLedgerSinkWebhook = "webhook"
+	// auditLogSinkFile and auditLogSinkOTLP are the kinds of the audit log sinks.
+	auditLogSinkFile = "file"
+	auditLogSinkOTLP = "otlp"
+	// metricsExporterPrometheus, metricsExporterOTLP and metricsExporterNone are the exporters of the metrics, which
+	// are the same as the values of the OTEL_METRICS_EXPORTER environment variable.
+	metricsExporterPrometheus = "prometheus"
+	metricsExporterOTLP       = "otlp"
+	metricsExporterNone       = "none"
+)
+
 // parseAndValidateFlags parses and validates the flags passed to the external processor.
 func parseAndValidateFlags(args []string) (extProcFlags, error) {
 	var (
@@ -70,6 +135,116 @@ func parseAndValidateFlags(args []string) (extProcFlags, error) {
 	)
 	fs.IntVar(&flags.metricsPort, "metricsPort", 1064, "port for the metrics server.")
 	fs.IntVar(&flags.healthPort, "healthPort", 1065, "port for the health check HTTP server.")
+	fs.StringVar(&flags.quotaRedisAddr,
+		"quotaRedisAddr",
+		"",
+		"address of the Redis-protocol server to store the quota counters, e.g. redis:6379. "+
+			"If empty, the counters are kept in memory and not shared across the external processors.",
+	)
+	fs.StringVar(&flags.responseCacheRedisAddr,
+		"responseCacheRedisAddr",
+		"",
+		"address of the Redis-protocol server to store the responses cached by the response caches of the routes, "+
+			"e.g. redis:6379. If empty, the responses are kept in memory and not shared across the external processors.",
+	)
+	fs.IntVar(&flags.responseCacheMaxBytes,
+		"responseCacheMaxBytes",
+		responsecache.DefaultMemoryStoreMaxBytes,
+		"maximum total size of the responses cached in memory when responseCacheRedisAddr is empty. "+
+			"The least recently used responses are evicted first.",
+	)
+	fs.StringVar(&flags.usageLedgerSink,
+		"usageLedgerSink",
+		"",
+		"sink of the usage records of the completed requests. One of 'file', 'otlp', or 'webhook'. "+
+			"If empty, the usage records are not exported.",
+	)
+	fs.StringVar(&flags.usageLedgerEndpoint,
+		"usageLedgerEndpoint",
+		"",
+		"path of the JSON lines file for the 'file' sink, the OTLP/HTTP endpoint such as http://otel-collector:4318 "+
+			"for the 'otlp' sink, or the URL receiving the CloudEvents for the 'webhook' sink.",
+	)
+	fs.StringVar(&flags.usageLedgerConsumerHeader,
+		"usageLedgerConsumerHeader",
+		"",
+		"name of the request header identifying the consumer in the usage records.",
+	)
+	fs.StringVar(&flags.usageLedgerConsumerJWTClaim,
+		"usageLedgerConsumerJWTClaim",
+		"",
+		"name of the claim of the verified JWT identifying the consumer in the usage records. "+
+			"The header takes precedence when both are specified.",
+	)
+	fs.IntVar(&flags.usageLedgerFileMaxSizeMB, "usageLedgerFileMaxSizeMB", 100,
+		"maximum size in megabytes of the usage ledger file before it is rotated.")
+	fs.IntVar(&flags.usageLedgerFileMaxBackups, "usageLedgerFileMaxBackups", 5,
+		"maximum number of the rotated usage ledger files to keep.")
+	fs.StringVar(&flags.auditLogSink,
+		"auditLogSink",
+		"",
+		"sink of the audit records, such as the tool calls and the conversations. Either 'file' or 'otlp'. "+
+			"If empty, the audit records are not exported.",
+	)
+	fs.StringVar(&flags.auditLogEndpoint,
+		"auditLogEndpoint",
+		"",
+		"path of the JSON lines file for the 'file' sink, or the OTLP/HTTP endpoint such as "+
+			"http://otel-collector:4318 for the 'otlp' sink of the audit records.",
+	)
+	fs.IntVar(&flags.auditLogFileMaxSizeMB, "auditLogFileMaxSizeMB", 100,
+		"maximum size in megabytes of the audit log file before it is rotated.")
+	fs.IntVar(&flags.auditLogFileMaxBackups, "auditLogFileMaxBackups", 5,
+		"maximum number of the rotated audit log files to keep.")
+	fs.StringVar(&flags.tracingEndpoint,
+		"tracingEndpoint",
+		"",
+		"OTLP/HTTP endpoint such as http://otel-collector:4318 to export the spans of the requests to. "+
+			"If empty, the requests are not traced.",
+	)
+	fs.Float64Var(&flags.tracingSampleRatio, "tracingSampleRatio", 1.0,
+		"ratio from 0 to 1 of the traces sampled when the incoming request is not already part of a sampled or unsampled trace.")
+	fs.BoolVar(&flags.tracingCaptureContent, "tracingCaptureContent", false,
+		"record the prompts and the completions as the events of the spans. They may contain sensitive data.")
+
+	fs.StringVar(&flags.metricsExporter,
+		"metricsExporter",
+		cmp.Or(os.Getenv("OTEL_METRICS_EXPORTER"), metricsExporterPrometheus),
+		"comma-separated list of the exporters of the metrics. Each is one of 'prometheus', 'otlp', or 'none'. "+
+			"The 'prometheus' exporter serves the metrics on the metrics port, and the 'otlp' exporter pushes them to "+
+			"the OTLP endpoint. Defaults to the OTEL_METRICS_EXPORTER environment variable or 'prometheus'.",
+	)
+	fs.StringVar(&flags.metricsOTLPEndpoint,
+		"metricsOTLPEndpoint",
+		"",
+		"OTLP endpoint such as http://otel-collector:4318 to push the metrics to. If empty, the standard "+
+			"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT environment variable is used.",
+	)
+	fs.StringVar(&flags.metricsOTLPProtocol,
+		"metricsOTLPProtocol",
+		cmp.Or(os.Getenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL"), os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"), metrics.OTLPProtocolHTTP),
+		"protocol of the OTLP metrics exporter. Either 'grpc' or 'http/protobuf'. Defaults to the standard "+
+			"OTEL_EXPORTER_OTLP_METRICS_PROTOCOL or OTEL_EXPORTER_OTLP_PROTOCOL environment variable or 'http/protobuf'.",
+	)
+	fs.DurationVar(&flags.metricsOTLPExportInterval, "metricsOTLPExportInterval", 0,
+		"interval between the pushes of the metrics to the OTLP endpoint. If zero, the standard "+
+			"OTEL_METRIC_EXPORT_INTERVAL environment variable or 60s is used.")
+	fs.StringVar(&flags.captureDir,
+		"captureDir",
+		"",
+		"directory where the requests of the route rules with the capture enabled are written for the replay by "+
+			"'aigw replay'. The captures contain the prompts and the completions. If empty, the requests are not captured.",
+	)
+	fs.Int64Var(&flags.captureMaxBytes,
+		"captureMaxBytes",
+		1<<30,
+		"maximum total size in bytes of the captures in the capture directory, after which the requests are no longer captured.",
+	)
+	fs.IntVar(&flags.captureMaxFiles,
+		"captureMaxFiles",
+		1000,
+		"maximum number of the captures in the capture directory, after which the requests are no longer captured.",
+	)
 
 	if err := fs.Parse(args); err != nil {
 		return extProcFlags{}, fmt.Errorf("failed to parse extProcFlags: %w", err)
@@ -81,6 +256,50 @@ func parseAndValidateFlags(args []string) (extProcFlags, error) {
 	if err := flags.logLevel.UnmarshalText([]byte(*logLevelPtr)); err != nil {
 		errs = append(errs, fmt.Errorf("failed to unmarshal log level: %w", err))
 	}
+	switch flags.usageLedgerSink {
+	case "":
+	case usageLedgerSinkFile, usageLedgerSinkOTLP, usageLedgerSinkWebhook:
+		if flags.usageLedgerEndpoint == "" {
+			errs = append(errs, fmt.Errorf("usageLedgerEndpoint must be provided for the usage ledger sink %q", flags.usageLedgerSink))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid usage ledger sink: %q", flags.usageLedgerSink))
+	}
+	switch flags.auditLogSink {
+	case "":
+	case auditLogSinkFile, auditLogSinkOTLP:
+		if flags.auditLogEndpoint == "" {
+			errs = append(errs, fmt.Errorf("auditLogEndpoint must be provided for the audit log sink %q", flags.auditLogSink))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid audit log sink: %q", flags.auditLogSink))
+	}
+	if flags.tracingSampleRatio < 0 || flags.tracingSampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracingSampleRatio must be between 0 and 1: %v", flags.tracingSampleRatio))
+	}
+	if flags.responseCacheMaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("responseCacheMaxBytes must be positive: %d", flags.responseCacheMaxBytes))
+	}
+	if flags.captureMaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("captureMaxBytes must be positive: %d", flags.captureMaxBytes))
+	}
+	if flags.captureMaxFiles <= 0 {
+		errs = append(errs, fmt.Errorf("captureMaxFiles must be positive: %d", flags.captureMaxFiles))
+	}
+	for _, e := range strings.Split(flags.metricsExporter, ",") {
+		switch strings.TrimSpace(e) {
+		case metricsExporterPrometheus:
+			flags.metricsPrometheus = true
+		case metricsExporterOTLP:
+			flags.metricsOTLP = true
+		case metricsExporterNone:
+		default:
+			errs = append(errs, fmt.Errorf("invalid metrics exporter: %q", e))
+		}
+	}
+	if flags.metricsOTLP && flags.metricsOTLPProtocol != metrics.OTLPProtocolGRPC && flags.metricsOTLPProtocol != metrics.OTLPProtocolHTTP {
+		errs = append(errs, fmt.Errorf("invalid OTLP metrics protocol: %q", flags.metricsOTLPProtocol))
+	}
 
 	return flags, errors.Join(errs...)
 }
@@ -126,7 +345,18 @@ func Main(ctx context.Context, args []string, stderr io.Writer) (err error) {
 		}
 	}
 
-	metricsServer, meter := startMetricsServer(fmt.Sprintf(":%d", flags.metricsPort), l)
+	meterProvider, registry, err := newMeterProvider(ctx, flags)
+	if err != nil {
+		return fmt.Errorf("failed to create meter provider: %w", err)
+	}
+	// The provider is shut down after the gRPC server stops, so that the metrics of the last requests are pushed.
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = meterProvider.Shutdown(shutdownCtx)
+	}()
+	meter := meterProvider.Meter("envoyproxy/ai-gateway")
+	metricsServer := startMetricsServer(fmt.Sprintf(":%d", flags.metricsPort), l, registry)
 	chatCompletionMetrics := metrics.NewChatCompletion(meter, x.NewCustomChatCompletionMetrics)
 	embeddingsMetrics := metrics.NewEmbeddings(meter)
 
@@ -134,6 +364,58 @@ func Main(ctx context.Context, args []string, stderr io.Writer) (err error) {
 	if err != nil {
 		return fmt.Errorf("failed to create external processor server: %w", err)
 	}
+	if flags.quotaRedisAddr != "" {
+		quotaStore := quota.NewRedisStore(flags.quotaRedisAddr)
+		defer func() { _ = quotaStore.Close() }()
+		server.SetQuotaStore(quotaStore)
+	}
+	if flags.responseCacheRedisAddr != "" {
+		responseCacheStore := responsecache.NewRedisStore(flags.responseCacheRedisAddr)
+		defer func() { _ = responseCacheStore.Close() }()
+		server.SetResponseCacheStore(responseCacheStore)
+	} else {
+		server.SetResponseCacheStore(responsecache.NewMemoryStore(flags.responseCacheMaxBytes))
+	}
+	server.SetTokenizers(tokenizer.NewRegistry(x.NewCustomTokenizer))
+	if flags.usageLedgerSink != "" {
+		sink, err := newUsageLedgerSink(flags)
+		if err != nil {
+			return fmt.Errorf("failed to create usage ledger sink: %w", err)
+		}
+		exporter := ledger.NewExporter(sink, l.With("component", "usage-ledger"))
+		// The exporter is closed after the gRPC server stops, so that the records of the last requests are exported.
+		defer func() { _ = exporter.Close() }()
+		server.SetUsageLedger(exporter, flags.usageLedgerConsumerHeader, flags.usageLedgerConsumerJWTClaim)
+	}
+	if flags.auditLogSink != "" {
+		sink, err := newAuditLogSink(flags)
+		if err != nil {
+			return fmt.Errorf("failed to create audit log sink: %w", err)
+		}
+		exporter := audit.NewExporter(sink, l.With("component", "audit-log"))
+		defer func() { _ = exporter.Close() }()
+		server.SetAuditLog(exporter)
+	}
+	if flags.tracingEndpoint != "" {
+		tp, err := tracing.NewTracerProvider(ctx, flags.tracingEndpoint, flags.tracingSampleRatio)
+		if err != nil {
+			return fmt.Errorf("failed to create tracer provider: %w", err)
+		}
+		// The provider is shut down after the gRPC server stops, so that the spans of the last requests are exported.
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = tp.Shutdown(shutdownCtx)
+		}()
+		server.SetTracing(tp.Tracer(tracing.ScopeName), flags.tracingCaptureContent)
+	}
+	if flags.captureDir != "" {
+		w, err := capture.NewWriter(flags.captureDir, flags.captureMaxBytes, flags.captureMaxFiles)
+		if err != nil {
+			return fmt.Errorf("failed to create capture writer: %w", err)
+		}
+		server.SetCapture(w)
+	}
 	server.Register("/v1/chat/completions", extproc.ChatCompletionProcessorFactory(chatCompletionMetrics))
 	server.Register("/v1/embeddings", extproc.EmbeddingsProcessorFactory(embeddingsMetrics))
 	server.Register("/v1/models", extproc.NewModelsProcessor)
@@ -163,6 +445,26 @@ func Main(ctx context.Context, args []string, stderr io.Writer) (err error) {
 	return s.Serve(lis)
 }
 
+// newUsageLedgerSink creates the sink of the usage records from the flags.
+func newUsageLedgerSink(flags extProcFlags) (ledger.Sink, error) {
+	switch flags.usageLedgerSink {
+	case usageLedgerSinkFile:
+		return ledger.NewFileSink(flags.usageLedgerEndpoint, int64(flags.usageLedgerFileMaxSizeMB)<<20, flags.usageLedgerFileMaxBackups)
+	case usageLedgerSinkOTLP:
+		return ledger.NewOTLPSink(flags.usageLedgerEndpoint), nil
+	default:
+		return ledger.NewWebhookSink(flags.usageLedgerEndpoint), nil
+	}
+}
+
+// newAuditLogSink creates the sink of the audit records specified by the flags.
+func newAuditLogSink(flags extProcFlags) (audit.Sink, error) {
+	if flags.auditLogSink == auditLogSinkOTLP {
+		return audit.NewOTLPSink(flags.auditLogEndpoint), nil
+	}
+	return audit.NewFileSink(flags.auditLogEndpoint, int64(flags.auditLogFileMaxSizeMB)<<20, flags.auditLogFileMaxBackups)
+}
+
 // listenAddress returns the network and address for the given address flag.
 func listenAddress(addrFlag string) (string, string) {
 	if strings.HasPrefix(addrFlag, "unix://") {
@@ -173,26 +475,44 @@ func listenAddress(addrFlag string) (string, string) {
 	return "tcp", addrFlag
 }
 
-// startMetricsServer starts the HTTP server for Prometheus metrics.
-func startMetricsServer(addr string, logger *slog.Logger) (*http.Server, metric.Meter) {
-	registry := prometheus.NewRegistry()
-	exporter, err := otelprom.New(otelprom.WithRegisterer(registry))
-	if err != nil {
-		log.Fatal("failed to create metrics exporter")
+// newMeterProvider creates the provider of the metrics exported by the exporters specified by the flags. The returned
+// registry is the one of the Prometheus exporter, which is nil if it is not enabled.
+func newMeterProvider(ctx context.Context, flags extProcFlags) (*metricsdk.MeterProvider, *prometheus.Registry, error) {
+	var opts []metricsdk.Option
+	var registry *prometheus.Registry
+	if flags.metricsPrometheus {
+		registry = prometheus.NewRegistry()
+		exporter, err := otelprom.New(otelprom.WithRegisterer(registry))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+		}
+		opts = append(opts, metricsdk.WithReader(exporter))
 	}
-	provider := metricsdk.NewMeterProvider(metricsdk.WithReader(exporter))
-	meter := provider.Meter("envoyproxy/ai-gateway")
+	if flags.metricsOTLP {
+		reader, err := metrics.NewOTLPReader(ctx, flags.metricsOTLPEndpoint, flags.metricsOTLPProtocol, flags.metricsOTLPExportInterval)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, metricsdk.WithReader(reader))
+	}
+	return metricsdk.NewMeterProvider(opts...), registry, nil
+}
 
+// startMetricsServer starts the HTTP server for the Prometheus metrics and the health check. The "/metrics" endpoint
+// is served only when the registry is not nil.
+func startMetricsServer(addr string, logger *slog.Logger, registry *prometheus.Registry) *http.Server {
 	// Create a new HTTP server for metrics.
 	mux := http.NewServeMux()
 
-	// Register the metrics handler.
-	mux.Handle("/metrics", promhttp.HandlerFor(
-		registry,
-		promhttp.HandlerOpts{
-			EnableOpenMetrics: true,
-		},
-	))
+	if registry != nil {
+		// Register the metrics handler.
+		mux.Handle("/metrics", promhttp.HandlerFor(
+			registry,
+			promhttp.HandlerOpts{
+				EnableOpenMetrics: true,
+			},
+		))
+	}
 
 	// Add a simple health check endpoint.
 	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
@@ -213,7 +533,7 @@ func startMetricsServer(addr string, logger *slog.Logger) (*http.Server, metric.
 		}
 	}()
 
-	return server, meter
+	return server
 }
 
 // startHealthCheckServer is a proxy for the gRPC health check server.
@@ -35,6 +35,7 @@ func Test_parseAndValidateFlags(t *testing.T) {
 			configPath string
 			addr       string
 			logLevel   slog.Level
+			quotaRedis string
 		}{
 			{
 				name:       "minimal extProcFlags",
@@ -77,10 +78,12 @@ func Test_parseAndValidateFlags(t *testing.T) {
 					"-configPath", "/path/to/config.yaml",
 					"-extProcAddr", "unix:///tmp/ext_proc.sock",
 					"-logLevel", "debug",
+					"-quotaRedisAddr", "redis:6379",
 				},
 				configPath: "/path/to/config.yaml",
 				addr:       "unix:///tmp/ext_proc.sock",
 				logLevel:   slog.LevelDebug,
+				quotaRedis: "redis:6379",
 			},
 		} {
 			t.Run(tc.name, func(t *testing.T) {
@@ -89,6 +92,7 @@ func Test_parseAndValidateFlags(t *testing.T) {
 				assert.Equal(t, tc.configPath, flags.configPath)
 				assert.Equal(t, tc.addr, flags.extProcAddr)
 				assert.Equal(t, tc.logLevel, flags.logLevel)
+				assert.Equal(t, tc.quotaRedis, flags.quotaRedisAddr)
 			})
 		}
 	})
@@ -98,6 +102,159 @@ func Test_parseAndValidateFlags(t *testing.T) {
 		assert.EqualError(t, err, `configPath must be provided
 failed to unmarshal log level: slog: level string "invalid": unknown name`)
 	})
+
+	t.Run("usage ledger", func(t *testing.T) {
+		flags, err := parseAndValidateFlags([]string{
+			"-configPath", "/path/to/config.yaml",
+			"-usageLedgerSink", "webhook",
+			"-usageLedgerEndpoint", "https://billing.example.com/usage",
+			"-usageLedgerConsumerHeader", "x-team",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "webhook", flags.usageLedgerSink)
+		assert.Equal(t, "https://billing.example.com/usage", flags.usageLedgerEndpoint)
+		assert.Equal(t, "x-team", flags.usageLedgerConsumerHeader)
+		assert.Equal(t, 100, flags.usageLedgerFileMaxSizeMB)
+		assert.Equal(t, 5, flags.usageLedgerFileMaxBackups)
+
+		_, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-usageLedgerSink", "file"})
+		assert.EqualError(t, err, `usageLedgerEndpoint must be provided for the usage ledger sink "file"`)
+		_, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-usageLedgerSink", "kafka"})
+		assert.EqualError(t, err, `invalid usage ledger sink: "kafka"`)
+	})
+
+	t.Run("audit log", func(t *testing.T) {
+		flags, err := parseAndValidateFlags([]string{
+			"-configPath", "/path/to/config.yaml",
+			"-auditLogSink", "file",
+			"-auditLogEndpoint", "/var/log/aigw/audit.jsonl",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "file", flags.auditLogSink)
+		assert.Equal(t, "/var/log/aigw/audit.jsonl", flags.auditLogEndpoint)
+		assert.Equal(t, 100, flags.auditLogFileMaxSizeMB)
+		assert.Equal(t, 5, flags.auditLogFileMaxBackups)
+
+		_, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-auditLogSink", "file"})
+		assert.EqualError(t, err, `auditLogEndpoint must be provided for the audit log sink "file"`)
+		flags, err = parseAndValidateFlags([]string{
+			"-configPath", "/path/to/config.yaml",
+			"-auditLogSink", "otlp",
+			"-auditLogEndpoint", "http://otel-collector:4318",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "otlp", flags.auditLogSink)
+		_, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-auditLogSink", "syslog"})
+		assert.EqualError(t, err, `invalid audit log sink: "syslog"`)
+	})
+
+	t.Run("tracing", func(t *testing.T) {
+		flags, err := parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml"})
+		require.NoError(t, err)
+		assert.Empty(t, flags.tracingEndpoint)
+		assert.InDelta(t, 1.0, flags.tracingSampleRatio, 0)
+		assert.False(t, flags.tracingCaptureContent)
+
+		flags, err = parseAndValidateFlags([]string{
+			"-configPath", "/path/to/config.yaml",
+			"-tracingEndpoint", "http://otel-collector:4318",
+			"-tracingSampleRatio", "0.25",
+			"-tracingCaptureContent",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "http://otel-collector:4318", flags.tracingEndpoint)
+		assert.InDelta(t, 0.25, flags.tracingSampleRatio, 0)
+		assert.True(t, flags.tracingCaptureContent)
+
+		_, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-tracingSampleRatio", "1.5"})
+		assert.EqualError(t, err, `tracingSampleRatio must be between 0 and 1: 1.5`)
+	})
+
+	t.Run("capture", func(t *testing.T) {
+		flags, err := parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml"})
+		require.NoError(t, err)
+		assert.Empty(t, flags.captureDir)
+
+		flags, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-captureDir", "/var/lib/aigw/captures"})
+		require.NoError(t, err)
+		assert.Equal(t, "/var/lib/aigw/captures", flags.captureDir)
+		assert.Equal(t, int64(1<<30), flags.captureMaxBytes)
+		assert.Equal(t, 1000, flags.captureMaxFiles)
+
+		flags, err = parseAndValidateFlags([]string{
+			"-configPath", "/path/to/config.yaml", "-captureDir", "/var/lib/aigw/captures",
+			"-captureMaxBytes", "1024", "-captureMaxFiles", "10",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1024), flags.captureMaxBytes)
+		assert.Equal(t, 10, flags.captureMaxFiles)
+
+		_, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-captureMaxFiles", "0"})
+		assert.EqualError(t, err, "captureMaxFiles must be positive: 0")
+	})
+
+	t.Run("response cache", func(t *testing.T) {
+		flags, err := parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml"})
+		require.NoError(t, err)
+		assert.Empty(t, flags.responseCacheRedisAddr)
+		assert.Equal(t, 64<<20, flags.responseCacheMaxBytes)
+
+		flags, err = parseAndValidateFlags([]string{
+			"-configPath", "/path/to/config.yaml",
+			"-responseCacheRedisAddr", "redis:6379",
+			"-responseCacheMaxBytes", "1024",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "redis:6379", flags.responseCacheRedisAddr)
+		assert.Equal(t, 1024, flags.responseCacheMaxBytes)
+
+		_, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-responseCacheMaxBytes", "0"})
+		assert.EqualError(t, err, "responseCacheMaxBytes must be positive: 0")
+	})
+
+	t.Run("metrics exporter", func(t *testing.T) {
+		t.Setenv("OTEL_METRICS_EXPORTER", "")
+		t.Setenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "")
+		t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "")
+		flags, err := parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml"})
+		require.NoError(t, err)
+		assert.True(t, flags.metricsPrometheus)
+		assert.False(t, flags.metricsOTLP)
+		assert.Equal(t, "http/protobuf", flags.metricsOTLPProtocol)
+
+		flags, err = parseAndValidateFlags([]string{
+			"-configPath", "/path/to/config.yaml",
+			"-metricsExporter", "prometheus, otlp",
+			"-metricsOTLPEndpoint", "http://otel-collector:4317",
+			"-metricsOTLPProtocol", "grpc",
+			"-metricsOTLPExportInterval", "15s",
+		})
+		require.NoError(t, err)
+		assert.True(t, flags.metricsPrometheus)
+		assert.True(t, flags.metricsOTLP)
+		assert.Equal(t, "http://otel-collector:4317", flags.metricsOTLPEndpoint)
+		assert.Equal(t, "grpc", flags.metricsOTLPProtocol)
+		assert.Equal(t, 15*time.Second, flags.metricsOTLPExportInterval)
+
+		// The standard environment variables are the defaults of the flags.
+		t.Setenv("OTEL_METRICS_EXPORTER", "otlp")
+		t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+		flags, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml"})
+		require.NoError(t, err)
+		assert.False(t, flags.metricsPrometheus)
+		assert.True(t, flags.metricsOTLP)
+		assert.Equal(t, "grpc", flags.metricsOTLPProtocol)
+
+		flags, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-metricsExporter", "none"})
+		require.NoError(t, err)
+		assert.False(t, flags.metricsPrometheus)
+		assert.False(t, flags.metricsOTLP)
+
+		_, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-metricsExporter", "statsd"})
+		assert.EqualError(t, err, `invalid metrics exporter: "statsd"`)
+		_, err = parseAndValidateFlags([]string{"-configPath", "/path/to/config.yaml", "-metricsOTLPProtocol", "http/json"})
+		assert.EqualError(t, err, `invalid OTLP metrics protocol: "http/json"`)
+	})
 }
 
 func TestListenAddress(t *testing.T) {
@@ -126,12 +283,13 @@ func TestListenAddress(t *testing.T) {
 }
 
 func TestStartMetricsServer(t *testing.T) {
-	s, m := startMetricsServer("127.0.0.1:", slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})))
+	provider, registry, err := newMeterProvider(t.Context(), extProcFlags{metricsPrometheus: true})
+	require.NoError(t, err)
+	s := startMetricsServer("127.0.0.1:", slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})), registry)
 	t.Cleanup(func() { _ = s.Shutdown(t.Context()) })
 
 	require.NotNil(t, s)
-	require.NotNil(t, m)
-	ccm := metrics.DefaultChatCompletion(m)
+	ccm := metrics.DefaultChatCompletion(provider.Meter("envoyproxy/ai-gateway"))
 	ccm.StartRequest(nil)
 	ccm.SetModel("test-model")
 	ccm.SetBackend(&filterapi.Backend{Name: "test-backend"})
@@ -159,6 +317,20 @@ func TestStartMetricsServer(t *testing.T) {
 	}
 }
 
+func TestStartMetricsServer_withoutPrometheus(t *testing.T) {
+	provider, registry, err := newMeterProvider(t.Context(), extProcFlags{
+		metricsOTLP: true, metricsOTLPEndpoint: "http://127.0.0.1:4318", metricsOTLPProtocol: metrics.OTLPProtocolHTTP,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, provider)
+	require.Nil(t, registry)
+	s := startMetricsServer("127.0.0.1:", slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})), registry)
+	t.Cleanup(func() { _ = s.Shutdown(t.Context()) })
+
+	require.HTTPSuccess(t, s.Handler.ServeHTTP, http.MethodGet, "/health", nil)
+	require.HTTPStatusCode(t, s.Handler.ServeHTTP, http.MethodGet, "/metrics", nil, http.StatusNotFound)
+}
+
 func TestStartHealthCheckServer(t *testing.T) {
 	for _, tc := range []string{"unix", "tcp"} {
 		t.Run(tc, func(t *testing.T) {
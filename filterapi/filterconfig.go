@@ -15,6 +15,7 @@
 package filterapi
 
 import (
+	"encoding/json"
 	"os"
 	"time"
 
@@ -46,6 +47,406 @@ type Config struct {
 	Backends []Backend `json:"backends,omitempty"`
 	// Models is the list of models that this route is aware of. Used to populate the "/models" endpoint in OpenAI-compatible APIs.
 	Models []Model `json:"models,omitempty"`
+	// Rules is the list of route rules that this listener is aware of. This is used to apply the per-rule
+	// configuration in the filter.
+	Rules []RouteRule `json:"rules,omitempty"`
+	// Quotas is the list of the quota policies enforced by the filter.
+	Quotas []QuotaPolicy `json:"quotas,omitempty"`
+	// Prices is the list of the model prices used to compute the cost of the requests.
+	Prices []ModelPrice `json:"prices,omitempty"`
+	// ConsumerKeys is the list of the consumer keys accepted by the filter. When this is not empty, the requests
+	// without any of the keys are rejected.
+	ConsumerKeys []ConsumerKey `json:"consumerKeys,omitempty"`
+}
+
+// RouteRule corresponds to AIGatewayRouteRule in api/v1alpha1/api.go, and holds the per-rule configuration
+// which is not tied with a specific backend.
+type RouteRule struct {
+	// Name is the unique name of the route rule.
+	Name RouteRuleName `json:"name"`
+	// Models is the list of model names that this rule matches on via the exact match of the model name header.
+	// This is used to resolve the rule at the router filter level before the routing decision is made.
+	Models []string `json:"models,omitempty"`
+	// HedgePolicy is the request hedging configuration of the rule. Optional.
+	HedgePolicy *HedgePolicy `json:"hedgePolicy,omitempty"`
+	// PrefixCacheAffinity is the prompt-prefix-based consistent hashing configuration of the rule. Optional.
+	PrefixCacheAffinity *PrefixCacheAffinity `json:"prefixCacheAffinity,omitempty"`
+	// Shadow is the traffic shadowing configuration of the rule. Optional.
+	Shadow *ShadowPolicy `json:"shadow,omitempty"`
+	// Experiment is the sticky experiment assignment configuration of the rule. Optional.
+	Experiment *Experiment `json:"experiment,omitempty"`
+	// Authorization is the claim-based authorization of the callers of the rule. Optional.
+	Authorization *Authorization `json:"authorization,omitempty"`
+	// Guardrails is the guardrails of the requests and the responses of the rule. Optional.
+	Guardrails *Guardrails `json:"guardrails,omitempty"`
+	// RequestLimits is the limits of the chat completion requests of the rule. Optional.
+	RequestLimits *RequestLimits `json:"requestLimits,omitempty"`
+	// ToolPolicy is the governance of the tools of the chat completion requests of the rule. Optional.
+	ToolPolicy *ToolPolicy `json:"toolPolicy,omitempty"`
+	// AuditLog is the recording of the conversations of the rule in the audit log. Optional.
+	AuditLog *AuditLog `json:"auditLog,omitempty"`
+	// MetricAttributes is the list of the attributes of the metrics extracted from the requests of the rule. Optional.
+	MetricAttributes []MetricAttribute `json:"metricAttributes,omitempty"`
+	// Capture is the capture of the requests of the rule for debugging. Optional.
+	Capture *Capture `json:"capture,omitempty"`
+	// ResponseCache is the cache of the chat completion responses of the rule. Optional.
+	ResponseCache *ResponseCache `json:"responseCache,omitempty"`
+}
+
+// ResponseCache corresponds to AIGatewayRouteResponseCache in api/v1alpha1/ai_gateway_route.go.
+type ResponseCache struct {
+	// TTL is the duration for which the cached response is returned.
+	TTL time.Duration `json:"ttl"`
+	// MaxEntryBytes is the maximum size of the response body to be cached.
+	MaxEntryBytes int `json:"maxEntryBytes"`
+	// ConsumerHeader is the name of the request header identifying the consumer sharing the cached responses.
+	// At most one of ConsumerHeader and ConsumerJWTClaim is set, and the responses are shared by all the callers
+	// when neither is set.
+	ConsumerHeader string `json:"consumerHeader,omitempty"`
+	// ConsumerJWTClaim is the name of the top-level claim of the verified JWT identifying the consumer.
+	ConsumerJWTClaim string `json:"consumerJWTClaim,omitempty"`
+	// Semantic is the semantic cache looked up when the request misses the exact match. Optional.
+	Semantic *SemanticCache `json:"semantic,omitempty"`
+}
+
+// SemanticCache corresponds to AIGatewayRouteSemanticCache in api/v1alpha1/ai_gateway_route.go.
+type SemanticCache struct {
+	// EmbeddingModel is the name of the embedding model.
+	EmbeddingModel string `json:"embeddingModel"`
+	// Endpoint is the URL of the embeddings endpoint of the Gateway.
+	Endpoint string `json:"endpoint"`
+	// SimilarityThreshold is the minimum cosine similarity for the cached response to be returned.
+	SimilarityThreshold float64 `json:"similarityThreshold"`
+	// MaxEntries is the maximum number of the embeddings kept for each scope.
+	MaxEntries int `json:"maxEntries"`
+	// Timeout is the timeout of the embedding request.
+	Timeout time.Duration `json:"timeout"`
+}
+
+// Capture corresponds to AIGatewayRouteCapture in api/v1alpha1/ai_gateway_route.go.
+type Capture struct {
+	// HeaderOnly is true if only the requests with the capture header are captured.
+	HeaderOnly bool `json:"headerOnly,omitempty"`
+	// IncludeOriginalRequest is true if the original request body is captured in addition to the rewritten one.
+	IncludeOriginalRequest bool `json:"includeOriginalRequest,omitempty"`
+}
+
+// MetricAttribute corresponds to AIGatewayRouteMetricAttribute in api/v1alpha1/ai_gateway_route.go.
+// Exactly one of Header or MetadataKey is set.
+type MetricAttribute struct {
+	// Name is the name of the attribute without the "ai_gateway." prefix.
+	Name string `json:"name"`
+	// Header is the name of the request header containing the value.
+	Header string `json:"header,omitempty"`
+	// MetadataNamespace is the namespace of the dynamic metadata containing the value.
+	MetadataNamespace string `json:"metadataNamespace,omitempty"`
+	// MetadataKey is the key of the dynamic metadata containing the value.
+	MetadataKey string `json:"metadataKey,omitempty"`
+	// AllowedValues is the list of the values recorded as they are. Optional.
+	AllowedValues []string `json:"allowedValues,omitempty"`
+	// MaxValues is the maximum number of the distinct values recorded.
+	MaxValues int `json:"maxValues"`
+	// Hash is true if the values are replaced with their hash.
+	Hash bool `json:"hash,omitempty"`
+}
+
+// AuditLog corresponds to AIGatewayRouteAuditLog in api/v1alpha1/ai_gateway_route.go.
+type AuditLog struct {
+	// Percentage is the percentage of the requests recorded, from 0 to 100.
+	Percentage int `json:"percentage"`
+	// RedactedFields is the list of the paths of the fields redacted in the records. Optional.
+	RedactedFields []string `json:"redactedFields,omitempty"`
+	// MaxBodyBytes is the maximum size in bytes of each of the request and the response in a record.
+	MaxBodyBytes int `json:"maxBodyBytes"`
+}
+
+// ToolPolicy corresponds to AIGatewayRouteToolPolicy in api/v1alpha1/ai_gateway_route.go.
+type ToolPolicy struct {
+	// AllowedTools is the list of the patterns of the names of the tools allowed. Optional.
+	AllowedTools []string `json:"allowedTools,omitempty"`
+	// DeniedTools is the list of the patterns of the names of the tools not allowed. Optional.
+	DeniedTools []string `json:"deniedTools,omitempty"`
+	// Arguments is the list of the JSON schemas of the arguments of the tool calls. Optional.
+	Arguments []ToolArgumentsSchema `json:"arguments,omitempty"`
+	// StripResponseToolCalls is true if the tool calls of the responses violating the policy are removed instead of
+	// failing the responses.
+	StripResponseToolCalls bool `json:"stripResponseToolCalls,omitempty"`
+}
+
+// ToolArgumentsSchema corresponds to ToolArgumentsSchema in api/v1alpha1/ai_gateway_route.go.
+type ToolArgumentsSchema struct {
+	// Tool is the pattern of the names of the tools the schema applies to.
+	Tool string `json:"tool"`
+	// Schema is the JSON schema of the arguments.
+	Schema json.RawMessage `json:"schema"`
+}
+
+// RequestLimits corresponds to AIGatewayRouteRequestLimits in api/v1alpha1/ai_gateway_route.go.
+// The zero values of the limits mean no limit.
+type RequestLimits struct {
+	// Clamp is true if the max tokens and the n are clamped and the parameters not allowed are removed instead of
+	// rejecting the request.
+	Clamp bool `json:"clamp,omitempty"`
+	// MaxBodyBytes is the maximum size of the request body in bytes.
+	MaxBodyBytes int64 `json:"maxBodyBytes,omitempty"`
+	// MaxPromptBytes is the maximum total size of the text content of the messages in bytes.
+	MaxPromptBytes int64 `json:"maxPromptBytes,omitempty"`
+	// MaxMessages is the maximum number of the messages.
+	MaxMessages int `json:"maxMessages,omitempty"`
+	// MaxImages is the maximum number of the image parts. This is nil if not limited since zero is a valid limit.
+	MaxImages *int `json:"maxImages,omitempty"`
+	// MaxTokens is the maximum of the max_tokens and the max_completion_tokens.
+	MaxTokens int64 `json:"maxTokens,omitempty"`
+	// MaxN is the maximum of the n.
+	MaxN int `json:"maxN,omitempty"`
+	// AllowedParameters is the list of the parameters allowed in addition to "model" and "messages". Optional.
+	AllowedParameters []string `json:"allowedParameters,omitempty"`
+	// ForbiddenParameters is the list of the parameters not allowed. Optional.
+	ForbiddenParameters []string `json:"forbiddenParameters,omitempty"`
+}
+
+// Authorization corresponds to AIGatewayRouteAuthorization in api/v1alpha1/ai_gateway_route.go.
+type Authorization struct {
+	// JWTClaim is the name of the top-level claim of the verified JWT containing the claim values of the caller.
+	JWTClaim string `json:"jwtClaim,omitempty"`
+	// Rules is the list of the rules granting the models to the callers.
+	Rules []AuthorizationRule `json:"rules"`
+}
+
+// AuthorizationRule corresponds to AIGatewayRouteAuthorizationRule in api/v1alpha1/ai_gateway_route.go.
+type AuthorizationRule struct {
+	// ClaimValues is the list of the claim values this rule applies to. Empty means all the callers.
+	ClaimValues []string `json:"claimValues,omitempty"`
+	// Models is the list of the patterns of the model names allowed by the rule, where "*" matches any sequence of
+	// characters. Empty means all the models.
+	Models []string `json:"models,omitempty"`
+	// MaxTokens caps the max tokens of the chat completion requests. Optional.
+	MaxTokens *int64 `json:"maxTokens,omitempty"`
+}
+
+// Guardrails corresponds to AIGatewayRouteGuardrails in api/v1alpha1/guardrails.go.
+type Guardrails struct {
+	// PII is the detection of the personally identifiable information in the requests. Optional.
+	PII *PIIGuardrail `json:"pii,omitempty"`
+	// Secrets is the detection of the secrets in the requests and the responses. Optional.
+	Secrets *SecretGuardrail `json:"secrets,omitempty"`
+	// External is the list of the external guardrail services consulted in order. Optional.
+	External []ExternalGuardrail `json:"external,omitempty"`
+}
+
+// ExternalGuardrail corresponds to ExternalGuardrail in api/v1alpha1/guardrails.go.
+type ExternalGuardrail struct {
+	// Name is the name of the guardrail.
+	Name string `json:"name"`
+	// Protocol is the protocol of the service.
+	Protocol ExternalGuardrailProtocol `json:"protocol"`
+	// Endpoint is the URL of the HTTP service or the address of the gRPC service.
+	Endpoint string `json:"endpoint"`
+	// Request is true if the service is called with the requests.
+	Request bool `json:"request,omitempty"`
+	// Response is true if the service is called with the non-streaming chat completion responses.
+	Response bool `json:"response,omitempty"`
+	// Timeout is the timeout of the call to the service.
+	Timeout time.Duration `json:"timeout"`
+	// FailOpen is true if the request or the response is allowed when the service fails.
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
+// ExternalGuardrailProtocol is the protocol of the external guardrail service.
+type ExternalGuardrailProtocol string
+
+const (
+	// ExternalGuardrailProtocolHTTP is the JSON over HTTP.
+	ExternalGuardrailProtocolHTTP ExternalGuardrailProtocol = "HTTP"
+	// ExternalGuardrailProtocolGRPC is the gRPC with the google.protobuf.Struct messages.
+	ExternalGuardrailProtocolGRPC ExternalGuardrailProtocol = "GRPC"
+)
+
+// SecretGuardrail corresponds to SecretGuardrail in api/v1alpha1/guardrails.go.
+type SecretGuardrail struct {
+	// Action specifies what is done when any secret is detected.
+	Action SecretAction `json:"action"`
+	// Detectors is the list of the detectors of the secrets. All the built-in detectors are used if empty.
+	Detectors []SecretDetector `json:"detectors,omitempty"`
+	// Request is true if the chat completion requests are scanned.
+	Request bool `json:"request,omitempty"`
+	// Response is true if the chat completion responses are scanned.
+	Response bool `json:"response,omitempty"`
+}
+
+// SecretAction specifies what is done when any secret is detected.
+type SecretAction string
+
+const (
+	// SecretActionBlock rejects the request or fails the response.
+	SecretActionBlock SecretAction = "Block"
+	// SecretActionRedact replaces the detected secrets with the placeholders.
+	SecretActionRedact SecretAction = "Redact"
+	// SecretActionAlert only records the detections.
+	SecretActionAlert SecretAction = "Alert"
+)
+
+// SecretDetector corresponds to SecretDetector in api/v1alpha1/guardrails.go.
+type SecretDetector struct {
+	// Type is the type of the detector.
+	Type SecretDetectorType `json:"type"`
+	// Name is the name of the custom detector. This is set only when the type is SecretDetectorTypeCustom.
+	Name string `json:"name,omitempty"`
+	// Pattern is the regular expression of the custom detector. This is set only when the type is SecretDetectorTypeCustom.
+	Pattern string `json:"pattern,omitempty"`
+	// MinEntropy is the minimum Shannon entropy of the secrets in bits per character. Zero means not checked.
+	MinEntropy float64 `json:"minEntropy,omitempty"`
+}
+
+// SecretDetectorType is the type of the detector of the secrets.
+type SecretDetectorType string
+
+const (
+	// SecretDetectorTypeAWSAccessKeyID detects the AWS access key IDs.
+	SecretDetectorTypeAWSAccessKeyID SecretDetectorType = "AWSAccessKeyID"
+	// SecretDetectorTypeAWSSecretAccessKey detects the AWS secret access keys.
+	SecretDetectorTypeAWSSecretAccessKey SecretDetectorType = "AWSSecretAccessKey"
+	// SecretDetectorTypeGitHubToken detects the GitHub tokens.
+	SecretDetectorTypeGitHubToken SecretDetectorType = "GitHubToken"
+	// SecretDetectorTypeGitLabToken detects the GitLab personal access tokens.
+	SecretDetectorTypeGitLabToken SecretDetectorType = "GitLabToken"
+	// SecretDetectorTypeSlackToken detects the Slack tokens.
+	SecretDetectorTypeSlackToken SecretDetectorType = "SlackToken"
+	// SecretDetectorTypeGoogleAPIKey detects the Google Cloud API keys.
+	SecretDetectorTypeGoogleAPIKey SecretDetectorType = "GoogleAPIKey"
+	// SecretDetectorTypeStripeAPIKey detects the Stripe live API keys.
+	SecretDetectorTypeStripeAPIKey SecretDetectorType = "StripeAPIKey"
+	// SecretDetectorTypeAnthropicAPIKey detects the Anthropic API keys.
+	SecretDetectorTypeAnthropicAPIKey SecretDetectorType = "AnthropicAPIKey"
+	// SecretDetectorTypeOpenAIAPIKey detects the OpenAI API keys.
+	SecretDetectorTypeOpenAIAPIKey SecretDetectorType = "OpenAIAPIKey"
+	// SecretDetectorTypePrivateKey detects the PEM-encoded private keys.
+	SecretDetectorTypePrivateKey SecretDetectorType = "PrivateKey"
+	// SecretDetectorTypeJWT detects the JSON Web Tokens.
+	SecretDetectorTypeJWT SecretDetectorType = "JWT"
+	// SecretDetectorTypeGenericSecret detects the high entropy values assigned to the secret-like variables.
+	SecretDetectorTypeGenericSecret SecretDetectorType = "GenericSecret"
+	// SecretDetectorTypeCustom detects the values matching the pattern.
+	SecretDetectorTypeCustom SecretDetectorType = "Custom"
+)
+
+// PIIGuardrail corresponds to PIIGuardrail in api/v1alpha1/guardrails.go.
+type PIIGuardrail struct {
+	// Action specifies what is done when any PII is detected in the request.
+	Action PIIAction `json:"action"`
+	// Detectors is the list of the detectors of the PII.
+	Detectors []PIIDetector `json:"detectors"`
+}
+
+// PIIAction specifies what is done when any PII is detected in the request.
+type PIIAction string
+
+const (
+	// PIIActionMask replaces the detected values with the placeholders.
+	PIIActionMask PIIAction = "Mask"
+	// PIIActionTokenize replaces the detected values with the tokens, which are replaced back in the response.
+	PIIActionTokenize PIIAction = "Tokenize"
+	// PIIActionReject rejects the request.
+	PIIActionReject PIIAction = "Reject"
+)
+
+// PIIDetector corresponds to PIIDetector in api/v1alpha1/guardrails.go.
+type PIIDetector struct {
+	// Type is the type of the detector.
+	Type PIIDetectorType `json:"type"`
+	// Name is the name of the custom detector. This is set only when the type is PIIDetectorTypeCustom.
+	Name string `json:"name,omitempty"`
+	// Pattern is the regular expression of the custom detector. This is set only when the type is PIIDetectorTypeCustom.
+	Pattern string `json:"pattern,omitempty"`
+	// Validator is the checksum validating the values matched by the custom detector. Optional.
+	Validator PIIValidator `json:"validator,omitempty"`
+}
+
+// PIIDetectorType is the type of the detector of the PII.
+type PIIDetectorType string
+
+const (
+	// PIIDetectorTypeEmail detects the email addresses.
+	PIIDetectorTypeEmail PIIDetectorType = "Email"
+	// PIIDetectorTypePhoneNumber detects the phone numbers.
+	PIIDetectorTypePhoneNumber PIIDetectorType = "PhoneNumber"
+	// PIIDetectorTypeCreditCard detects the credit card numbers.
+	PIIDetectorTypeCreditCard PIIDetectorType = "CreditCard"
+	// PIIDetectorTypeUSSocialSecurityNumber detects the US social security numbers.
+	PIIDetectorTypeUSSocialSecurityNumber PIIDetectorType = "USSocialSecurityNumber"
+	// PIIDetectorTypeIBAN detects the international bank account numbers.
+	PIIDetectorTypeIBAN PIIDetectorType = "IBAN"
+	// PIIDetectorTypeCustom detects the values matching the pattern.
+	PIIDetectorTypeCustom PIIDetectorType = "Custom"
+)
+
+// PIIValidator is the checksum validating the detected values.
+type PIIValidator string
+
+const (
+	// PIIValidatorLuhn is the Luhn checksum.
+	PIIValidatorLuhn PIIValidator = "Luhn"
+	// PIIValidatorMod97 is the ISO 7064 MOD 97-10 checksum.
+	PIIValidatorMod97 PIIValidator = "Mod97"
+)
+
+// Experiment corresponds to AIGatewayRouteRuleExperiment in api/v1alpha1/api.go.
+//
+// The filter assigns the end user to one of the variants, and Envoy selects the endpoints of the variant
+// via the subset load balancing on the dynamic metadata set by the filter.
+type Experiment struct {
+	// Name is the name of the experiment.
+	Name string `json:"name"`
+	// SubjectHeader is the name of the request header containing the identity of the end user.
+	// Either this or SubjectJWTClaim is set.
+	SubjectHeader string `json:"subjectHeader,omitempty"`
+	// SubjectJWTClaim is the name of the top-level claim of the verified JWT containing the identity of the end user.
+	SubjectJWTClaim string `json:"subjectJWTClaim,omitempty"`
+	// Variants is the list of the variants to which the end users are assigned.
+	Variants []ExperimentVariant `json:"variants"`
+}
+
+// ExperimentVariant is a variant of the Experiment.
+type ExperimentVariant struct {
+	// Name is the name of the variant, which is the name of the backend ref.
+	Name string `json:"name"`
+	// Weight is the relative weight of the variant in the assignment.
+	Weight int `json:"weight"`
+	// Key is the value of the endpoint metadata used by the subset load balancing, which is the per-rule name of the
+	// backend ref. This is unique even when the same backend is referenced multiple times in the rule.
+	Key string `json:"key"`
+}
+
+// ShadowPolicy corresponds to AIGatewayRouteRuleShadowPolicy in api/v1alpha1/api.go.
+//
+// Envoy mirrors all the requests matching the rule to the shadow backend, and the filter is responsible
+// for sampling them as well as for comparing the shadow responses with the primary ones.
+type ShadowPolicy struct {
+	// BackendName is the name of the shadow backend, which is listed in Config.Backends.
+	BackendName string `json:"backendName"`
+	// Percentage is the percentage of the requests to be mirrored to the shadow backend.
+	Percentage int `json:"percentage"`
+}
+
+// PrefixCacheAffinity corresponds to PrefixCacheAffinity in api/v1alpha1/api.go.
+//
+// The filter populates the hash key of the prompt prefix in the request header, and Envoy selects
+// the endpoint with the consistent hashing on it.
+type PrefixCacheAffinity struct {
+	// LeadingMessages is the number of the leading non-system messages hashed together with the system prompt.
+	LeadingMessages int `json:"leadingMessages"`
+}
+
+// HedgePolicy corresponds to AIGatewayRouteRuleHedgePolicy in api/v1alpha1/api.go.
+//
+// The hedged requests themselves are issued by Envoy when the response headers have not been received within
+// the timeout, and the filter is responsible for selecting the response of the attempt returned to the client,
+// as well as for accounting the estimated usage of the hedged attempts in the costs of the request.
+type HedgePolicy struct {
+	// FirstResponseTimeout is the duration to wait for the response headers before hedging.
+	FirstResponseTimeout time.Duration `json:"firstResponseTimeout"`
+	// MaxHedgedRequests is the maximum number of hedged requests in addition to the original request.
+	MaxHedgedRequests int `json:"maxHedgedRequests"`
 }
 
 // Model corresponds to the OpenAI model object in the OpenAI-compatible APIs
@@ -88,8 +489,114 @@ const (
 	LLMRequestCostTypeTotalToken LLMRequestCostType = "TotalToken"
 	// LLMRequestCostTypeCEL specifies that the request cost is calculated from the CEL expression.
 	LLMRequestCostTypeCEL LLMRequestCostType = "CEL"
+	// LLMRequestCostTypeEstimatedInputToken specifies that the request cost is the input token estimated
+	// before the request is sent upstream, which is replaced with the actual input token when the response completes.
+	LLMRequestCostTypeEstimatedInputToken LLMRequestCostType = "EstimatedInputToken"
+	// LLMRequestCostTypeReservedOutputToken specifies that the request cost is the max_tokens of the request
+	// before the request is sent upstream, which is replaced with the actual output token when the response completes.
+	LLMRequestCostTypeReservedOutputToken LLMRequestCostType = "ReservedOutputToken"
+	// LLMRequestCostTypeReservedTotalToken specifies that the request cost is the sum of the estimated input token
+	// and the max_tokens of the request before the request is sent upstream, which is replaced with the actual
+	// total token when the response completes.
+	LLMRequestCostTypeReservedTotalToken LLMRequestCostType = "ReservedTotalToken"
 )
 
+// QuotaPolicy corresponds to QuotaPolicy in api/v1alpha1/quota_policy.go.
+type QuotaPolicy struct {
+	// Name is the unique name of the policy in the form of "namespace/name", which is also used as part of the
+	// keys of the counters.
+	Name string `json:"name"`
+	// ConsumerHeader is the name of the request header containing the consumer key.
+	// Exactly one of ConsumerHeader, ConsumerJWTClaim and ConsumerClientIP is set.
+	ConsumerHeader string `json:"consumerHeader,omitempty"`
+	// ConsumerJWTClaim is the name of the top-level claim of the verified JWT containing the consumer key.
+	ConsumerJWTClaim string `json:"consumerJWTClaim,omitempty"`
+	// ConsumerClientIP specifies that the client IP address is used as the consumer key.
+	ConsumerClientIP bool `json:"consumerClientIP,omitempty"`
+	// Budgets is the list of the budgets applied to each consumer.
+	Budgets []QuotaBudget `json:"budgets"`
+}
+
+// QuotaBudget corresponds to QuotaBudget in api/v1alpha1/quota_policy.go.
+type QuotaBudget struct {
+	// Name is the name of the budget unique within the policy.
+	Name string `json:"name"`
+	// Models is the list of the model names this budget applies to. Empty means all the models.
+	Models []string `json:"models,omitempty"`
+	// Type specifies what is counted by the budget.
+	Type QuotaBudgetType `json:"type"`
+	// CostMetadataKey is the MetadataKey of the LLMRequestCost counted by the budget. This is set when the Type is
+	// QuotaBudgetTypeCost.
+	CostMetadataKey string `json:"costMetadataKey,omitempty"`
+	// Period specifies the period after which the budget is reset.
+	Period QuotaBudgetPeriod `json:"period"`
+	// Limit is the maximum amount of tokens or cost each consumer can use in the period.
+	Limit int64 `json:"limit"`
+}
+
+// QuotaBudgetType specifies what is counted by the QuotaBudget.
+type QuotaBudgetType string
+
+const (
+	// QuotaBudgetTypeToken specifies that the budget counts the total tokens.
+	QuotaBudgetTypeToken QuotaBudgetType = "Token"
+	// QuotaBudgetTypeCost specifies that the budget counts the calculated LLMRequestCost.
+	QuotaBudgetTypeCost QuotaBudgetType = "Cost"
+)
+
+// QuotaBudgetPeriod specifies the period after which the QuotaBudget is reset.
+type QuotaBudgetPeriod string
+
+const (
+	// QuotaBudgetPeriodDaily specifies that the budget is reset at 00:00 UTC every day.
+	QuotaBudgetPeriodDaily QuotaBudgetPeriod = "Daily"
+	// QuotaBudgetPeriodMonthly specifies that the budget is reset at 00:00 UTC on the first day of every month.
+	QuotaBudgetPeriodMonthly QuotaBudgetPeriod = "Monthly"
+)
+
+// ConsumerKey corresponds to ConsumerKey in api/v1alpha1/consumer_key.go.
+type ConsumerKey struct {
+	// Name is the unique name of the key in the form of "namespace/name", which is also used as part of the
+	// keys of the counters of the budgets.
+	Name string `json:"name"`
+	// Hash is the hex-encoded SHA-256 hash of the key.
+	Hash string `json:"hash"`
+	// Consumer is the identity of the consumer to which the key is issued.
+	Consumer string `json:"consumer"`
+	// Models is the list of the model names the key is allowed to use. Empty means all the models.
+	Models []string `json:"models,omitempty"`
+	// Rules is the list of the names of the route rules the key is allowed to use. Empty means all the rules.
+	Rules []RouteRuleName `json:"rules,omitempty"`
+	// Budgets is the list of the budgets applied to the key.
+	Budgets []QuotaBudget `json:"budgets,omitempty"`
+	// Labels are the additional metadata of the consumer populated in the request headers.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ExpiresAt is the time after which the key is rejected. Optional.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ModelPrice corresponds to ModelPrice in api/v1alpha1/pricing_catalog.go.
+//
+// The token prices are in micro-USD per token, i.e., USD per million tokens, and the other prices are in micro-USD.
+type ModelPrice struct {
+	// Model is the name of the model in the request.
+	Model string `json:"model"`
+	// Backends is the list of the names of the backends this price applies to. Empty means all the backends.
+	Backends []string `json:"backends,omitempty"`
+	// InputToken is the price of an input token.
+	InputToken float64 `json:"inputToken"`
+	// OutputToken is the price of an output token.
+	OutputToken float64 `json:"outputToken"`
+	// CachedInputToken is the price of an input token read from the prompt cache.
+	CachedInputToken float64 `json:"cachedInputToken"`
+	// ReasoningToken is the price of a reasoning token.
+	ReasoningToken float64 `json:"reasoningToken"`
+	// Image is the price of an image in the request.
+	Image float64 `json:"image,omitempty"`
+	// AudioSecond is the price of a second of the audio in the request.
+	AudioSecond float64 `json:"audioSecond,omitempty"`
+}
+
 // VersionedAPISchema corresponds to VersionedAPISchema in api/v1alpha1/api.go.
 type VersionedAPISchema struct {
 	// Name is the name of the API schema.
@@ -130,6 +637,27 @@ type Backend struct {
 	Schema VersionedAPISchema `json:"schema"`
 	// Auth is the authn/z configuration for the backend. Optional.
 	Auth *BackendAuth `json:"auth,omitempty"`
+	// RouteRuleName is the name of the route rule that this backend belongs to. Optional.
+	RouteRuleName RouteRuleName `json:"routeRuleName,omitempty"`
+	// ConcurrencyLimit is the concurrency limit of the backend. Optional.
+	ConcurrencyLimit *ConcurrencyLimit `json:"concurrencyLimit,omitempty"`
+}
+
+// ConcurrencyLimit corresponds to AIServiceBackendConcurrencyLimit in api/v1alpha1/ai_service_backend.go.
+type ConcurrencyLimit struct {
+	// Key identifies the limit. The backends with the same key share the limit, since they are
+	// generated from the same AIServiceBackend referenced by multiple route rules.
+	Key string `json:"key"`
+	// MaxInFlightRequests is the maximum number of the requests in flight to the backend.
+	MaxInFlightRequests int `json:"maxInFlightRequests"`
+	// QueueTimeout is the maximum duration for which the excess request waits in the queue.
+	QueueTimeout time.Duration `json:"queueTimeout,omitempty"`
+	// PriorityHeader is the name of the request header containing the priority class. Optional.
+	PriorityHeader string `json:"priorityHeader,omitempty"`
+	// PriorityJWTClaim is the name of the JWT claim containing the priority class. Optional.
+	PriorityJWTClaim string `json:"priorityJWTClaim,omitempty"`
+	// PriorityClasses is the list of the priority classes in the descending order of the priority.
+	PriorityClasses []string `json:"priorityClasses,omitempty"`
 }
 
 // BackendAuth corresponds partially to BackendSecurityPolicy in api/v1alpha1/api.go.
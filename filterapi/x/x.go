@@ -59,3 +59,18 @@ type EmbeddingsMetrics interface {
 	// RecordRequestCompletion records latency metrics for the entire request.
 	RecordRequestCompletion(ctx context.Context, success bool, extraAttrs ...attribute.KeyValue)
 }
+
+// NewCustomTokenizer is the function to create a custom tokenizer used to estimate the number of the input tokens
+// of the requests for the model before they are sent upstream. This is nil by default and can be set by the custom
+// build of external processor. The built-in tokenizer is used when this is nil or returns nil for the model.
+var NewCustomTokenizer NewCustomTokenizerFn
+
+// NewCustomTokenizerFn is the function to create a custom tokenizer for the given model. This is called per request,
+// so the implementation should reuse the tokenizers across the calls.
+type NewCustomTokenizerFn func(model string) Tokenizer
+
+// Tokenizer is the interface for counting the tokens of the text.
+type Tokenizer interface {
+	// CountTokens returns the number of the tokens of the text. This must be safe for concurrent use.
+	CountTokens(text string) int
+}
@@ -726,6 +726,24 @@ type ChatCompletionResponseUsage struct {
 	CompletionTokens int `json:"completion_tokens,omitempty"`
 	PromptTokens     int `json:"prompt_tokens,omitempty"`
 	TotalTokens      int `json:"total_tokens,omitempty"`
+	// PromptTokensDetails is the breakdown of the tokens used in the prompt.
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+	// CompletionTokensDetails is the breakdown of the tokens used in the completion.
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails is described in the OpenAI API documentation:
+// https://platform.openai.com/docs/api-reference/chat/object#chat/object-usage
+type PromptTokensDetails struct {
+	// CachedTokens is the number of the prompt tokens read from the prompt cache.
+	CachedTokens int `json:"cached_tokens,omitempty"`
+}
+
+// CompletionTokensDetails is described in the OpenAI API documentation:
+// https://platform.openai.com/docs/api-reference/chat/object#chat/object-usage
+type CompletionTokensDetails struct {
+	// ReasoningTokens is the number of the tokens generated by the model for reasoning.
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
 }
 
 // ChatCompletionResponseChunk is described in the OpenAI API documentation:
@@ -8,6 +8,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	egv1a1 "github.com/envoyproxy/gateway/api/v1alpha1"
@@ -248,10 +249,28 @@ func (c *AIGatewayRouteController) newHTTPRoute(ctx context.Context, dst *gwapiv
 		for j := range rule.Matches {
 			matches = append(matches, gwapiv1.HTTPRouteMatch{Headers: rule.Matches[j].Headers})
 		}
+		filters := rewriteFilters
+		if sp := rule.ShadowPolicy; sp != nil {
+			backend, err := c.backend(ctx, aiGatewayRoute.Namespace, sp.BackendRef.Name)
+			if err != nil {
+				return fmt.Errorf("AIServiceBackend %s.%s not found", sp.BackendRef.Name, aiGatewayRoute.Namespace)
+			}
+			// All the requests are mirrored, and the sampling is done by the extproc since it needs to
+			// know which requests are shadowed in order to compare the responses.
+			//
+			// Note that the mirror filter must come after the rewrite filter since Envoy Gateway names
+			// the mirror cluster after the index of the filter, which the extension server relies on.
+			filters = append(slices.Clone(rewriteFilters), gwapiv1.HTTPRouteFilter{
+				Type: gwapiv1.HTTPRouteFilterRequestMirror,
+				RequestMirror: &gwapiv1.HTTPRequestMirrorFilter{
+					BackendRef: backend.Spec.BackendRef,
+				},
+			})
+		}
 		rules = append(rules, gwapiv1.HTTPRouteRule{
 			BackendRefs: backendRefs,
 			Matches:     matches,
-			Filters:     rewriteFilters,
+			Filters:     filters,
 			Timeouts:    rule.GetTimeoutsOrDefault(),
 		})
 	}
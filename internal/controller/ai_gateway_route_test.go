@@ -8,6 +8,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"slices"
 	"testing"
 
 	egv1a1 "github.com/envoyproxy/gateway/api/v1alpha1"
@@ -77,7 +78,10 @@ func requireNewFakeClientWithIndexes(t *testing.T) client.Client {
 	builder := fake.NewClientBuilder().WithScheme(Scheme).
 		WithStatusSubresource(&aigv1a1.AIGatewayRoute{}).
 		WithStatusSubresource(&aigv1a1.AIServiceBackend{}).
-		WithStatusSubresource(&aigv1a1.BackendSecurityPolicy{})
+		WithStatusSubresource(&aigv1a1.BackendSecurityPolicy{}).
+		WithStatusSubresource(&aigv1a1.QuotaPolicy{}).
+		WithStatusSubresource(&aigv1a1.PricingCatalog{}).
+		WithStatusSubresource(&aigv1a1.ConsumerKey{})
 	err := ApplyIndexing(t.Context(), func(_ context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
 		builder = builder.WithIndex(obj, field, extractValue)
 		return nil
@@ -213,6 +217,10 @@ func Test_newHTTPRoute(t *testing.T) {
 						{
 							BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "foo", Weight: ptr.To[int32](1)}},
 							Timeouts:    &gwapiv1.HTTPRouteTimeouts{Request: &timeout1, BackendRequest: &timeout2},
+							ShadowPolicy: &aigv1a1.AIGatewayRouteRuleShadowPolicy{
+								BackendRef: aigv1a1.AIGatewayRouteRuleBackendRef{Name: "pineapple"},
+								Percentage: ptr.To[int32](10),
+							},
 							Matches: []aigv1a1.AIGatewayRouteRuleMatch{
 								{Headers: []gwapiv1.HTTPHeaderMatch{
 									{Name: "x-test", Value: "rule-2"},
@@ -290,7 +298,12 @@ func Test_newHTTPRoute(t *testing.T) {
 					},
 					BackendRefs: []gwapiv1.HTTPBackendRef{{BackendRef: gwapiv1.BackendRef{BackendObjectReference: gwapiv1.BackendObjectReference{Name: "some-backend4", Namespace: refNs}, Weight: ptr.To[int32](1)}}},
 					Timeouts:    &gwapiv1.HTTPRouteTimeouts{Request: &timeout1, BackendRequest: &timeout2},
-					Filters:     rewriteFilters,
+					Filters: append(slices.Clone(rewriteFilters), gwapiv1.HTTPRouteFilter{
+						Type: gwapiv1.HTTPRouteFilterRequestMirror,
+						RequestMirror: &gwapiv1.HTTPRequestMirrorFilter{
+							BackendRef: gwapiv1.BackendObjectReference{Name: "some-backend3", Namespace: refNs},
+						},
+					}),
 				},
 				{
 					// The default rule.
@@ -0,0 +1,95 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package controller
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	aigv1a1 "github.com/envoyproxy/ai-gateway/api/v1alpha1"
+)
+
+// ConsumerKeyController implements [reconcile.TypedReconciler] for [aigv1a1.ConsumerKey].
+//
+// The keys are rendered into the filter config of the targeted Gateways together with the hashes in the referenced
+// Secrets, so this only propagates the changes to the Gateway controller. The changes to the Secrets are propagated
+// by the secret controller via the event channel of this controller.
+//
+// Exported for testing purposes.
+type ConsumerKeyController struct {
+	client client.Client
+	kube   kubernetes.Interface
+	logger logr.Logger
+	// gatewayEventChan is a channel to send events to the gateway controller.
+	gatewayEventChan chan event.GenericEvent
+}
+
+// NewConsumerKeyController creates a new [reconcile.TypedReconciler] for [aigv1a1.ConsumerKey].
+func NewConsumerKeyController(client client.Client, kube kubernetes.Interface, logger logr.Logger, gatewayEventChan chan event.GenericEvent) *ConsumerKeyController {
+	return &ConsumerKeyController{
+		client:           client,
+		kube:             kube,
+		logger:           logger,
+		gatewayEventChan: gatewayEventChan,
+	}
+}
+
+// Reconcile implements the [reconcile.TypedReconciler] for [aigv1a1.ConsumerKey].
+func (c *ConsumerKeyController) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	var consumerKey aigv1a1.ConsumerKey
+	if err := c.client.Get(ctx, req.NamespacedName, &consumerKey); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			c.logger.Info("Deleting ConsumerKey",
+				"namespace", req.Namespace, "name", req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	c.logger.Info("Reconciling ConsumerKey", "namespace", req.Namespace, "name", req.Name)
+	if handleFinalizer(ctx, c.client, c.logger, &consumerKey, c.syncGateways) { // Propagate the ConsumerKey deletion to the Gateways.
+		return ctrl.Result{}, nil
+	}
+	if err := c.syncGateways(ctx, &consumerKey); err != nil {
+		c.logger.Error(err, "failed to sync ConsumerKey")
+		c.updateConsumerKeyStatus(ctx, &consumerKey, aigv1a1.ConditionTypeNotAccepted, err.Error())
+		return ctrl.Result{}, err
+	}
+	c.updateConsumerKeyStatus(ctx, &consumerKey, aigv1a1.ConditionTypeAccepted, "ConsumerKey reconciled successfully")
+	return ctrl.Result{}, nil
+}
+
+// syncGateways synchronizes the Gateways targeted by the ConsumerKey by sending events to the gateway controller.
+func (c *ConsumerKeyController) syncGateways(ctx context.Context, consumerKey *aigv1a1.ConsumerKey) error {
+	for _, ref := range consumerKey.Spec.TargetRefs {
+		var gw gwapiv1.Gateway
+		if err := c.client.Get(ctx, client.ObjectKey{Name: string(ref.Name), Namespace: consumerKey.Namespace}, &gw); err != nil {
+			if apierrors.IsNotFound(err) {
+				c.logger.Info("Gateway not found", "namespace", consumerKey.Namespace, "name", ref.Name)
+				continue
+			}
+			return err
+		}
+		c.logger.Info("syncing Gateway", "namespace", gw.Namespace, "name", gw.Name)
+		c.gatewayEventChan <- event.GenericEvent{Object: &gw}
+	}
+	return nil
+}
+
+// updateConsumerKeyStatus updates the status of the ConsumerKey.
+func (c *ConsumerKeyController) updateConsumerKeyStatus(ctx context.Context, consumerKey *aigv1a1.ConsumerKey, conditionType string, message string) {
+	consumerKey.Status.Conditions = newConditions(conditionType, message)
+	if err := c.client.Status().Update(ctx, consumerKey); err != nil {
+		c.logger.Error(err, "failed to update ConsumerKey status")
+	}
+}
@@ -8,6 +8,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	egv1a1 "github.com/envoyproxy/gateway/api/v1alpha1"
 	"github.com/go-logr/logr"
@@ -66,10 +67,74 @@ type Options struct {
 	EnvoyGatewayNamespace string
 	// UDSPath is the path to the UDS socket for the external processor.
 	UDSPath string
+	// ExtProcQuotaRedisAddr is the address of the Redis-protocol server where the external processor stores the
+	// QuotaPolicy counters. If empty, the counters are kept in the memory of each external processor.
+	ExtProcQuotaRedisAddr string
+	// ExtProcUsageLedger is the configuration of the usage records exported by the external processor.
+	ExtProcUsageLedger UsageLedgerOptions
+	// ExtProcAuditLog is the configuration of the audit records exported by the external processor.
+	ExtProcAuditLog AuditLogOptions
+	// ExtProcTracing is the configuration of the spans exported by the external processor.
+	ExtProcTracing TracingOptions
+	// ExtProcMetrics is the configuration of the exporters of the metrics of the external processor.
+	ExtProcMetrics MetricsOptions
+	// ExtProcCaptureDir is the directory where the external processor writes the captures of the requests of the
+	// AIGatewayRoutes with the capture enabled. If empty, the requests are not captured.
+	ExtProcCaptureDir string
+	// ExtProcResponseCacheRedisAddr is the address of the Redis-protocol server where the external processor stores
+	// the responses cached by the AIGatewayRoutes. If empty, the responses are kept in the memory of each external
+	// processor.
+	ExtProcResponseCacheRedisAddr string
 	// DisableMutatingWebhook disables the mutating webhook for the Gateway for testing purposes.
 	DisableMutatingWebhook bool
 }
 
+// UsageLedgerOptions is the configuration of the usage ledger of the external processor, which exports a usage
+// record per completed request for the chargeback. The fields correspond to the flags of the external processor.
+type UsageLedgerOptions struct {
+	// Sink is one of "file", "otlp", or "webhook". If empty, the usage records are not exported.
+	Sink string
+	// Endpoint is the file path, the OTLP/HTTP endpoint or the webhook URL of the sink.
+	Endpoint string
+	// ConsumerHeader and ConsumerJWTClaim identify the consumer in the usage records. Optional.
+	ConsumerHeader   string
+	ConsumerJWTClaim string
+}
+
+// AuditLogOptions is the configuration of the audit log of the external processor, which exports the audit records
+// such as the tool calls and the conversations. The fields correspond to the flags of the external processor.
+type AuditLogOptions struct {
+	// Sink is either "file" or "otlp". If empty, the audit records are not exported.
+	Sink string
+	// Endpoint is the file path or the OTLP/HTTP endpoint of the sink.
+	Endpoint string
+}
+
+// TracingOptions is the configuration of the tracing of the requests by the external processor. The fields
+// correspond to the flags of the external processor.
+type TracingOptions struct {
+	// Endpoint is the OTLP/HTTP endpoint of the spans. If empty, the requests are not traced.
+	Endpoint string
+	// SampleRatio is the ratio from 0 to 1 of the traces sampled when the incoming request has no sampling decision.
+	SampleRatio float64
+	// CaptureContent records the prompts and the completions as the events of the spans.
+	CaptureContent bool
+}
+
+// MetricsOptions is the configuration of the exporters of the metrics of the external processor. The fields
+// correspond to the flags of the external processor.
+type MetricsOptions struct {
+	// Exporter is the comma-separated list of "prometheus", "otlp", or "none". If empty, the external processor
+	// only serves the Prometheus metrics.
+	Exporter string
+	// OTLPEndpoint is the OTLP endpoint where the metrics are pushed to, e.g. "http://otel-collector:4318".
+	OTLPEndpoint string
+	// OTLPProtocol is either "grpc" or "http/protobuf". If empty, the external processor uses "http/protobuf".
+	OTLPProtocol string
+	// OTLPExportInterval is the interval between the pushes of the metrics. If zero, it is 60 seconds.
+	OTLPExportInterval time.Duration
+}
+
 // StartControllers starts the controllers for the AI Gateway.
 // This blocks until the manager is stopped.
 //
@@ -135,8 +200,9 @@ func StartControllers(ctx context.Context, mgr manager.Manager, config *rest.Con
 		return fmt.Errorf("failed to create controller for BackendSecurityPolicy: %w", err)
 	}
 
+	consumerKeyEventChan := make(chan event.GenericEvent, 100)
 	secretC := NewSecretController(c, kubernetes.NewForConfigOrDie(config), logger.
-		WithName("secret"), backendSecurityPolicyEventChan)
+		WithName("secret"), backendSecurityPolicyEventChan, consumerKeyEventChan)
 	// Do not use TypedControllerBuilderForCRD for secret, as changing a secret content doesn't change the generation.
 	if err = ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Secret{}).
@@ -144,6 +210,31 @@ func StartControllers(ctx context.Context, mgr manager.Manager, config *rest.Con
 		return fmt.Errorf("failed to create controller for Secret: %w", err)
 	}
 
+	quotaPolicyC := NewQuotaPolicyController(c, kubernetes.NewForConfigOrDie(config), logger.
+		WithName("quota-policy"), gatewayEventChan)
+	if err = TypedControllerBuilderForCRD(mgr, &aigv1a1.QuotaPolicy{}).
+		Complete(quotaPolicyC); err != nil {
+		return fmt.Errorf("failed to create controller for QuotaPolicy: %w", err)
+	}
+
+	pricingCatalogC := NewPricingCatalogController(c, kubernetes.NewForConfigOrDie(config), logger.
+		WithName("pricing-catalog"), gatewayEventChan)
+	if err = TypedControllerBuilderForCRD(mgr, &aigv1a1.PricingCatalog{}).
+		Complete(pricingCatalogC); err != nil {
+		return fmt.Errorf("failed to create controller for PricingCatalog: %w", err)
+	}
+
+	consumerKeyC := NewConsumerKeyController(c, kubernetes.NewForConfigOrDie(config), logger.
+		WithName("consumer-key"), gatewayEventChan)
+	if err = TypedControllerBuilderForCRD(mgr, &aigv1a1.ConsumerKey{}).
+		WatchesRawSource(source.Channel(
+			consumerKeyEventChan,
+			&handler.EnqueueRequestForObject{},
+		)).
+		Complete(consumerKeyC); err != nil {
+		return fmt.Errorf("failed to create controller for ConsumerKey: %w", err)
+	}
+
 	if !options.DisableMutatingWebhook {
 		h := admission.WithCustomDefaulter(Scheme, &corev1.Pod{}, newGatewayMutator(c, kubernetes.NewForConfigOrDie(config),
 			logger.WithName("gateway-mutator"),
@@ -152,6 +243,13 @@ func StartControllers(ctx context.Context, mgr manager.Manager, config *rest.Con
 			options.ExtProcLogLevel,
 			options.EnvoyGatewayNamespace,
 			options.UDSPath,
+			options.ExtProcQuotaRedisAddr,
+			options.ExtProcUsageLedger,
+			options.ExtProcAuditLog,
+			options.ExtProcTracing,
+			options.ExtProcMetrics,
+			options.ExtProcCaptureDir,
+			options.ExtProcResponseCacheRedisAddr,
 		))
 		mgr.GetWebhookServer().Register("/mutate", &webhook.Admission{Handler: h})
 	}
@@ -187,6 +285,18 @@ const (
 	// k8sClientIndexBackendSecurityPolicyToReferencingAIServiceBackend is the index name that maps from a BackendSecurityPolicy
 	// to the AIServiceBackend that references it.
 	k8sClientIndexBackendSecurityPolicyToReferencingAIServiceBackend = "BackendSecurityPolicyToReferencingAIServiceBackend"
+	// k8sClientIndexQuotaPolicyToTargetGateway is the index name that maps from a Gateway to the
+	// QuotaPolicy that targets it.
+	k8sClientIndexQuotaPolicyToTargetGateway = "GWAPIGatewayToTargetingQuotaPolicy"
+	// k8sClientIndexPricingCatalogToTargetGateway is the index name that maps from a Gateway to the
+	// PricingCatalog that targets it.
+	k8sClientIndexPricingCatalogToTargetGateway = "GWAPIGatewayToTargetingPricingCatalog"
+	// k8sClientIndexConsumerKeyToTargetGateway is the index name that maps from a Gateway to the
+	// ConsumerKey that targets it.
+	k8sClientIndexConsumerKeyToTargetGateway = "GWAPIGatewayToTargetingConsumerKey"
+	// k8sClientIndexSecretToReferencingConsumerKey is the index name that maps from a Secret to the
+	// ConsumerKey that references it.
+	k8sClientIndexSecretToReferencingConsumerKey = "SecretToReferencingConsumerKey"
 )
 
 // ApplyIndexing applies indexing to the given indexer. This is exported for testing purposes.
@@ -211,9 +321,64 @@ func ApplyIndexing(ctx context.Context, indexer func(ctx context.Context, obj cl
 	if err != nil {
 		return fmt.Errorf("failed to create index from Secret to BackendSecurityPolicy: %w", err)
 	}
+	err = indexer(ctx, &aigv1a1.QuotaPolicy{},
+		k8sClientIndexQuotaPolicyToTargetGateway, quotaPolicyToTargetGatewayIndexFunc)
+	if err != nil {
+		return fmt.Errorf("failed to create index from Gateway to QuotaPolicy: %w", err)
+	}
+	err = indexer(ctx, &aigv1a1.PricingCatalog{},
+		k8sClientIndexPricingCatalogToTargetGateway, pricingCatalogToTargetGatewayIndexFunc)
+	if err != nil {
+		return fmt.Errorf("failed to create index from Gateway to PricingCatalog: %w", err)
+	}
+	err = indexer(ctx, &aigv1a1.ConsumerKey{},
+		k8sClientIndexConsumerKeyToTargetGateway, consumerKeyToTargetGatewayIndexFunc)
+	if err != nil {
+		return fmt.Errorf("failed to create index from Gateway to ConsumerKey: %w", err)
+	}
+	err = indexer(ctx, &aigv1a1.ConsumerKey{},
+		k8sClientIndexSecretToReferencingConsumerKey, consumerKeyToSecretIndexFunc)
+	if err != nil {
+		return fmt.Errorf("failed to create index from Secret to ConsumerKey: %w", err)
+	}
 	return nil
 }
 
+func consumerKeyToTargetGatewayIndexFunc(o client.Object) []string {
+	consumerKey := o.(*aigv1a1.ConsumerKey)
+	var ret []string
+	for _, ref := range consumerKey.Spec.TargetRefs {
+		ret = append(ret, fmt.Sprintf("%s.%s", ref.Name, consumerKey.Namespace))
+	}
+	return ret
+}
+
+func consumerKeyToSecretIndexFunc(o client.Object) []string {
+	consumerKey := o.(*aigv1a1.ConsumerKey)
+	if consumerKey.Spec.SecretRef == nil {
+		return nil
+	}
+	return []string{getSecretNameAndNamespace(consumerKey.Spec.SecretRef, consumerKey.Namespace)}
+}
+
+func pricingCatalogToTargetGatewayIndexFunc(o client.Object) []string {
+	pricingCatalog := o.(*aigv1a1.PricingCatalog)
+	var ret []string
+	for _, ref := range pricingCatalog.Spec.TargetRefs {
+		ret = append(ret, fmt.Sprintf("%s.%s", ref.Name, pricingCatalog.Namespace))
+	}
+	return ret
+}
+
+func quotaPolicyToTargetGatewayIndexFunc(o client.Object) []string {
+	quotaPolicy := o.(*aigv1a1.QuotaPolicy)
+	var ret []string
+	for _, ref := range quotaPolicy.Spec.TargetRefs {
+		ret = append(ret, fmt.Sprintf("%s.%s", ref.Name, quotaPolicy.Namespace))
+	}
+	return ret
+}
+
 func aiGatewayRouteToAttachedGatewayIndexFunc(o client.Object) []string {
 	aiGatewayRoute := o.(*aigv1a1.AIGatewayRoute)
 	var ret []string
@@ -234,6 +399,9 @@ func aiGatewayRouteIndexFunc(o client.Object) []string {
 			key := fmt.Sprintf("%s.%s", backend.Name, aiGatewayRoute.Namespace)
 			ret = append(ret, key)
 		}
+		if sp := rule.ShadowPolicy; sp != nil {
+			ret = append(ret, fmt.Sprintf("%s.%s", sp.BackendRef.Name, aiGatewayRoute.Namespace))
+		}
 	}
 	return ret
 }
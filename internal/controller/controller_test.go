@@ -48,6 +48,9 @@ func Test_aiGatewayRouteIndexFunc(t *testing.T) {
 						{Name: "backend1", Weight: ptr.To[int32](1)},
 						{Name: "backend2", Weight: ptr.To[int32](1)},
 					},
+					ShadowPolicy: &aigv1a1.AIGatewayRouteRuleShadowPolicy{
+						BackendRef: aigv1a1.AIGatewayRouteRuleBackendRef{Name: "backend3"},
+					},
 				},
 			},
 		},
@@ -66,6 +69,12 @@ func Test_aiGatewayRouteIndexFunc(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, aiGatewayRoutes.Items, 1)
 	require.Equal(t, aiGatewayRoute.Name, aiGatewayRoutes.Items[0].Name)
+
+	err = c.List(t.Context(), &aiGatewayRoutes,
+		client.MatchingFields{k8sClientIndexBackendToReferencingAIGatewayRoute: "backend3.default"})
+	require.NoError(t, err)
+	require.Len(t, aiGatewayRoutes.Items, 1)
+	require.Equal(t, aiGatewayRoute.Name, aiGatewayRoutes.Items[0].Name)
 }
 
 func Test_backendSecurityPolicyIndexFunc(t *testing.T) {
@@ -8,7 +8,13 @@ package controller
 import (
 	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	egv1a1 "github.com/envoyproxy/gateway/api/v1alpha1"
 	"github.com/go-logr/logr"
@@ -91,7 +97,7 @@ func (c *GatewayController) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		c.logger.Info("No AIGatewayRoute attached to the Gateway", "namespace", gw.Namespace, "name", gw.Name)
 		return ctrl.Result{}, nil
 	}
-	if err := c.ensureExtensionPolicy(ctx, &gw); err != nil {
+	if err := c.ensureExtensionPolicy(ctx, &gw, routes.Items); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -114,7 +120,7 @@ func (c *GatewayController) Reconcile(ctx context.Context, req ctrl.Request) (ct
 const sideCarExtProcBackendName = "envoy-ai-gateway-extproc-backend"
 
 // ensureExtensionPolicy creates or updates the extension policy for the external process running as a sidecar.
-func (c *GatewayController) ensureExtensionPolicy(ctx context.Context, gw *gwapiv1.Gateway) (err error) {
+func (c *GatewayController) ensureExtensionPolicy(ctx context.Context, gw *gwapiv1.Gateway, routes []aigv1a1.AIGatewayRoute) (err error) {
 	// Ensure that the backend that makes Envoy talk to the UDS exists.
 	var backend egv1a1.Backend
 	if err = c.client.Get(ctx, client.ObjectKey{Name: sideCarExtProcBackendName, Namespace: gw.Namespace}, &backend); err != nil {
@@ -136,9 +142,33 @@ func (c *GatewayController) ensureExtensionPolicy(ctx context.Context, gw *gwapi
 		}
 	}
 
+	// The dynamic metadata of the verified JWT and the one referenced by the metric attributes are sent to the extproc.
+	accessibleNamespaces := requestMetadataNamespaces(routes)
+	writableNamespaces := []string{
+		aigv1a1.AIGatewayFilterMetadataNamespace,
+		// The extproc selects the endpoint subset of the experiment variant via this namespace.
+		internalapi.EnvoyLBMetadataNamespace,
+	}
 	perGatewayEEPName := fmt.Sprintf("ai-eg-eep-%s", gw.Name)
 	var existingPolicy egv1a1.EnvoyExtensionPolicy
 	if err = c.client.Get(ctx, client.ObjectKey{Name: perGatewayEEPName, Namespace: gw.Namespace}, &existingPolicy); err == nil {
+		if len(existingPolicy.Spec.ExtProc) == 0 {
+			return
+		}
+		// The policy created by the older versions lacks the namespaces added since then, so both are reconciled.
+		metadata := existingPolicy.Spec.ExtProc[0].Metadata
+		if metadata == nil {
+			metadata = &egv1a1.ExtProcMetadata{}
+			existingPolicy.Spec.ExtProc[0].Metadata = metadata
+		} else if slices.Equal(metadata.AccessibleNamespaces, accessibleNamespaces) &&
+			slices.Equal(metadata.WritableNamespaces, writableNamespaces) {
+			return
+		}
+		metadata.AccessibleNamespaces = accessibleNamespaces
+		metadata.WritableNamespaces = writableNamespaces
+		if err = c.client.Update(ctx, &existingPolicy); err != nil {
+			err = fmt.Errorf("failed to update extension policy: %w", err)
+		}
 		return
 	} else if client.IgnoreNotFound(err) != nil {
 		return fmt.Errorf("failed to get extension policy: %w", err)
@@ -162,7 +192,10 @@ func (c *GatewayController) ensureExtensionPolicy(ctx context.Context, gw *gwapi
 					Request:           &egv1a1.ProcessingModeOptions{Body: ptr.To(egv1a1.BufferedExtProcBodyProcessingMode)},
 					Response:          &egv1a1.ProcessingModeOptions{Body: ptr.To(egv1a1.BufferedExtProcBodyProcessingMode)},
 				},
-				Metadata: &egv1a1.ExtProcMetadata{WritableNamespaces: []string{aigv1a1.AIGatewayFilterMetadataNamespace}},
+				Metadata: &egv1a1.ExtProcMetadata{
+					AccessibleNamespaces: accessibleNamespaces,
+					WritableNamespaces:   writableNamespaces,
+				},
 				BackendCluster: egv1a1.BackendCluster{
 					BackendRefs: []egv1a1.BackendRef{{
 						BackendObjectReference: gwapiv1.BackendObjectReference{
@@ -207,6 +240,312 @@ func schemaToFilterAPI(schema aigv1a1.VersionedAPISchema) filterapi.VersionedAPI
 	return ret
 }
 
+// experimentToFilterAPI converts the experiment of the rule at the given index of the AIGatewayRoute to the
+// filterapi.Experiment. This returns nil if the rule has no experiment.
+func experimentToFilterAPI(route *aigv1a1.AIGatewayRoute, ruleIndex int) *filterapi.Experiment {
+	rule := &route.Spec.Rules[ruleIndex]
+	exp := rule.Experiment
+	if exp == nil {
+		return nil
+	}
+	ret := &filterapi.Experiment{
+		Name:            exp.Name,
+		SubjectHeader:   ptr.Deref(exp.Subject.Header, ""),
+		SubjectJWTClaim: ptr.Deref(exp.Subject.JWTClaim, ""),
+	}
+	for i := range rule.BackendRefs {
+		backendRef := &rule.BackendRefs[i]
+		// Only the primary backends are the variants, and the others are the fallbacks shared by all the variants.
+		if ptr.Deref(backendRef.Priority, 0) != 0 {
+			continue
+		}
+		ret.Variants = append(ret.Variants, filterapi.ExperimentVariant{
+			Name:   backendRef.Name,
+			Weight: int(ptr.Deref(backendRef.Weight, 1)),
+			Key:    internalapi.PerRouteRuleRefBackendName(route.Namespace, backendRef.Name, route.Name, ruleIndex, i),
+		})
+	}
+	return ret
+}
+
+// authorizationToFilterAPI converts the authorization of the AIGatewayRoute to filterapi.Authorization.
+func authorizationToFilterAPI(authz *aigv1a1.AIGatewayRouteAuthorization) *filterapi.Authorization {
+	if authz == nil {
+		return nil
+	}
+	ret := &filterapi.Authorization{JWTClaim: authz.Claim.JWTClaim}
+	for _, r := range authz.Rules {
+		ret.Rules = append(ret.Rules, filterapi.AuthorizationRule{
+			ClaimValues: r.ClaimValues,
+			Models:      r.Models,
+			MaxTokens:   r.MaxTokens,
+		})
+	}
+	return ret
+}
+
+// requestLimitsToFilterAPI converts the request limits of the AIGatewayRoute to the filter API representation.
+func requestLimitsToFilterAPI(l *aigv1a1.AIGatewayRouteRequestLimits) *filterapi.RequestLimits {
+	if l == nil {
+		return nil
+	}
+	ret := &filterapi.RequestLimits{
+		Clamp:               l.Mode == aigv1a1.RequestLimitsModeClamp,
+		MaxBodyBytes:        ptr.Deref(l.MaxBodyBytes, 0),
+		MaxPromptBytes:      ptr.Deref(l.MaxPromptBytes, 0),
+		MaxMessages:         int(ptr.Deref(l.MaxMessages, 0)),
+		MaxTokens:           ptr.Deref(l.MaxTokens, 0),
+		MaxN:                int(ptr.Deref(l.MaxN, 0)),
+		AllowedParameters:   l.AllowedParameters,
+		ForbiddenParameters: l.ForbiddenParameters,
+	}
+	if l.MaxImages != nil {
+		ret.MaxImages = ptr.To(int(*l.MaxImages))
+	}
+	return ret
+}
+
+// toolPolicyToFilterAPI converts the tool policy of the AIGatewayRoute to the filter API representation.
+func toolPolicyToFilterAPI(p *aigv1a1.AIGatewayRouteToolPolicy) *filterapi.ToolPolicy {
+	if p == nil {
+		return nil
+	}
+	ret := &filterapi.ToolPolicy{
+		AllowedTools:           p.AllowedTools,
+		DeniedTools:            p.DeniedTools,
+		StripResponseToolCalls: p.ResponseAction == aigv1a1.ToolPolicyResponseActionStrip,
+	}
+	for _, a := range p.Arguments {
+		ret.Arguments = append(ret.Arguments, filterapi.ToolArgumentsSchema{Tool: a.Tool, Schema: a.Schema.Raw})
+	}
+	return ret
+}
+
+// auditLogToFilterAPI converts the audit log of the AIGatewayRoute to the filter API representation.
+func auditLogToFilterAPI(l *aigv1a1.AIGatewayRouteAuditLog) *filterapi.AuditLog {
+	if l == nil {
+		return nil
+	}
+	return &filterapi.AuditLog{
+		Percentage:     int(ptr.Deref(l.Percentage, 100)),
+		RedactedFields: l.RedactedFields,
+		MaxBodyBytes:   int(ptr.Deref(l.MaxBodyBytes, 65536)),
+	}
+}
+
+// captureToFilterAPI converts the capture of the AIGatewayRoute to the filter API representation.
+func captureToFilterAPI(c *aigv1a1.AIGatewayRouteCapture) *filterapi.Capture {
+	if c == nil {
+		return nil
+	}
+	return &filterapi.Capture{
+		HeaderOnly:             c.Mode != aigv1a1.AIGatewayRouteCaptureModeAlways,
+		IncludeOriginalRequest: c.IncludeOriginalRequest,
+	}
+}
+
+// responseCacheToFilterAPI converts the response cache of the AIGatewayRoute to the filter API representation.
+func responseCacheToFilterAPI(rc *aigv1a1.AIGatewayRouteResponseCache) (*filterapi.ResponseCache, error) {
+	if rc == nil {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(string(ptr.Deref(rc.TTL, "5m")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ttl: %w", err)
+	}
+	ret := &filterapi.ResponseCache{TTL: ttl, MaxEntryBytes: int(ptr.Deref(rc.MaxEntryBytes, 1048576))}
+	if s := rc.Scope; s != nil {
+		ret.ConsumerHeader, ret.ConsumerJWTClaim = ptr.Deref(s.Header, ""), ptr.Deref(s.JWTClaim, "")
+	}
+	if s := rc.Semantic; s != nil {
+		threshold, err := strconv.ParseFloat(ptr.Deref(s.SimilarityThreshold, "0.95"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse similarity threshold: %w", err)
+		}
+		timeout, err := time.ParseDuration(string(ptr.Deref(s.Timeout, "1s")))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse semantic cache timeout: %w", err)
+		}
+		ret.Semantic = &filterapi.SemanticCache{
+			EmbeddingModel:      s.EmbeddingModel,
+			Endpoint:            ptr.Deref(s.Endpoint, "http://127.0.0.1:10080/v1/embeddings"),
+			SimilarityThreshold: threshold,
+			MaxEntries:          int(ptr.Deref(s.MaxEntries, 1000)),
+			Timeout:             timeout,
+		}
+	}
+	return ret, nil
+}
+
+// metricAttributesToFilterAPI converts the metric attributes of the AIGatewayRoute to the filter API representation.
+func metricAttributesToFilterAPI(attrs []aigv1a1.AIGatewayRouteMetricAttribute) []filterapi.MetricAttribute {
+	var ret []filterapi.MetricAttribute
+	for i := range attrs {
+		a := &attrs[i]
+		fa := filterapi.MetricAttribute{
+			Name:          a.Name,
+			Header:        ptr.Deref(a.Header, ""),
+			AllowedValues: a.AllowedValues,
+			MaxValues:     int(ptr.Deref(a.MaxValues, 100)),
+			Hash:          a.Hash,
+		}
+		if m := a.Metadata; m != nil {
+			fa.MetadataNamespace, fa.MetadataKey = m.Namespace, m.Key
+		}
+		ret = append(ret, fa)
+	}
+	return ret
+}
+
+// requestMetadataNamespaces returns the sorted namespaces of the dynamic metadata which must be accessible to the
+// external processor. These are the namespace of the JWT authentication, from which the JWT claims are read, and the
+// ones referenced by the metric attributes of the given AIGatewayRoutes.
+func requestMetadataNamespaces(routes []aigv1a1.AIGatewayRoute) []string {
+	ret := []string{internalapi.JWTAuthnMetadataNamespace}
+	for i := range routes {
+		for _, a := range routes[i].Spec.MetricAttributes {
+			if a.Metadata != nil && !slices.Contains(ret, a.Metadata.Namespace) {
+				ret = append(ret, a.Metadata.Namespace)
+			}
+		}
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// defaultExternalGuardrailTimeout is the default timeout of the call to the external guardrail service.
+const defaultExternalGuardrailTimeout = "1s"
+
+// guardrailsToFilterAPI converts the guardrails of the AIGatewayRoute to the filter API representation.
+func guardrailsToFilterAPI(g *aigv1a1.AIGatewayRouteGuardrails) (*filterapi.Guardrails, error) {
+	if g == nil {
+		return nil, nil
+	}
+	ret := &filterapi.Guardrails{}
+	if pii := g.PII; pii != nil {
+		ret.PII = &filterapi.PIIGuardrail{Action: filterapi.PIIAction(pii.Action)}
+		if ret.PII.Action == "" {
+			ret.PII.Action = filterapi.PIIActionMask
+		}
+		for _, d := range pii.Detectors {
+			fd := filterapi.PIIDetector{Type: filterapi.PIIDetectorType(d.Type)}
+			if c := d.Custom; c != nil {
+				fd.Name, fd.Pattern = c.Name, c.Pattern
+				fd.Validator = filterapi.PIIValidator(ptr.Deref(c.Validator, ""))
+			}
+			ret.PII.Detectors = append(ret.PII.Detectors, fd)
+		}
+	}
+	if secrets := g.Secrets; secrets != nil {
+		ret.Secrets = &filterapi.SecretGuardrail{Action: filterapi.SecretAction(secrets.Action)}
+		if ret.Secrets.Action == "" {
+			ret.Secrets.Action = filterapi.SecretActionBlock
+		}
+		for _, d := range secrets.Detectors {
+			fd := filterapi.SecretDetector{Type: filterapi.SecretDetectorType(d.Type)}
+			if c := d.Custom; c != nil {
+				fd.Name, fd.Pattern = c.Name, c.Pattern
+				if c.MinEntropy != nil {
+					minEntropy, err := strconv.ParseFloat(*c.MinEntropy, 64)
+					if err != nil {
+						return nil, fmt.Errorf("failed to parse min entropy of secret detector %s: %w", c.Name, err)
+					}
+					fd.MinEntropy = minEntropy
+				}
+			}
+			ret.Secrets.Detectors = append(ret.Secrets.Detectors, fd)
+		}
+		if len(secrets.Phases) == 0 {
+			ret.Secrets.Request, ret.Secrets.Response = true, true
+		}
+		for _, p := range secrets.Phases {
+			switch p {
+			case aigv1a1.SecretGuardrailPhaseRequest:
+				ret.Secrets.Request = true
+			case aigv1a1.SecretGuardrailPhaseResponse:
+				ret.Secrets.Response = true
+			}
+		}
+	}
+	for _, e := range g.External {
+		timeout, err := time.ParseDuration(string(ptr.Deref(e.Timeout, defaultExternalGuardrailTimeout)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timeout of external guardrail %s: %w", e.Name, err)
+		}
+		fe := filterapi.ExternalGuardrail{
+			Name:     e.Name,
+			Protocol: filterapi.ExternalGuardrailProtocol(e.Protocol),
+			Endpoint: e.Endpoint,
+			Timeout:  timeout,
+			FailOpen: e.FailureMode == aigv1a1.ExternalGuardrailFailOpen,
+		}
+		if fe.Protocol == "" {
+			fe.Protocol = filterapi.ExternalGuardrailProtocolHTTP
+		}
+		if len(e.Phases) == 0 {
+			fe.Request, fe.Response = true, true
+		}
+		for _, p := range e.Phases {
+			switch p {
+			case aigv1a1.ExternalGuardrailPhaseRequest:
+				fe.Request = true
+			case aigv1a1.ExternalGuardrailPhaseResponse:
+				fe.Response = true
+			}
+		}
+		ret.External = append(ret.External, fe)
+	}
+	return ret, nil
+}
+
+// backendRefToFilterAPI converts the given backend reference to the filterapi.Backend with the given name.
+func (c *GatewayController) backendRefToFilterAPI(ctx context.Context, namespace, name string,
+	ruleName filterapi.RouteRuleName, backendRef *aigv1a1.AIGatewayRouteRuleBackendRef,
+) (filterapi.Backend, error) {
+	b := filterapi.Backend{Name: name, ModelNameOverride: backendRef.ModelNameOverride, RouteRuleName: ruleName}
+	backendObj, err := c.backend(ctx, namespace, backendRef.Name)
+	if err != nil {
+		return b, fmt.Errorf("failed to get AIServiceBackend %s: %w", b.Name, err)
+	}
+	b.Schema = schemaToFilterAPI(backendObj.Spec.APISchema)
+	if bspRef := backendObj.Spec.BackendSecurityPolicyRef; bspRef != nil {
+		b.Auth, err = c.bspToFilterAPIBackendAuth(ctx, namespace, string(bspRef.Name))
+		if err != nil {
+			return b, fmt.Errorf("failed to create backend auth: %w", err)
+		}
+	}
+	if cl := backendObj.Spec.ConcurrencyLimit; cl != nil {
+		b.ConcurrencyLimit, err = concurrencyLimitToFilterAPI(namespace, backendRef.Name, cl)
+		if err != nil {
+			return b, fmt.Errorf("invalid concurrency limit of AIServiceBackend %s: %w", backendRef.Name, err)
+		}
+	}
+	return b, nil
+}
+
+// defaultConcurrencyQueueTimeout is the default queue timeout of the concurrency limit of AIServiceBackend.
+const defaultConcurrencyQueueTimeout = "10s"
+
+// concurrencyLimitToFilterAPI converts the concurrency limit of the given AIServiceBackend to the filterapi.ConcurrencyLimit.
+func concurrencyLimitToFilterAPI(namespace, name string, cl *aigv1a1.AIServiceBackendConcurrencyLimit) (*filterapi.ConcurrencyLimit, error) {
+	timeout, err := time.ParseDuration(string(ptr.Deref(cl.QueueTimeout, defaultConcurrencyQueueTimeout)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse queue timeout: %w", err)
+	}
+	ret := &filterapi.ConcurrencyLimit{
+		// All the backends generated from the same AIServiceBackend share the limit.
+		Key:                 fmt.Sprintf("%s/%s", namespace, name),
+		MaxInFlightRequests: int(cl.MaxInFlightRequests),
+		QueueTimeout:        timeout,
+	}
+	if p := cl.Priority; p != nil {
+		ret.PriorityHeader = ptr.Deref(p.Header, "")
+		ret.PriorityJWTClaim = ptr.Deref(p.JWTClaim, "")
+		ret.PriorityClasses = p.Classes
+	}
+	return ret, nil
+}
+
 // reconcileFilterConfigSecret updates the filter config secret for the external processor.
 func (c *GatewayController) reconcileFilterConfigSecret(ctx context.Context, gw *gwapiv1.Gateway, aiGatewayRoutes []aigv1a1.AIGatewayRoute, uuid string) error {
 	// Precondition: aiGatewayRoutes is not empty as we early return if it is empty.
@@ -217,11 +556,16 @@ func (c *GatewayController) reconcileFilterConfigSecret(ctx context.Context, gw
 	ec.ModelNameHeaderKey = aigv1a1.AIModelHeaderKey
 	var err error
 	llmCosts := map[string]struct{}{}
+	// serviceBackends maps the "namespace/name" of the AIServiceBackends to the names of the backends generated from them.
+	serviceBackends := map[string][]string{}
+	// routeRules maps the "namespace/name" of the AIGatewayRoutes to the names of their rules.
+	routeRules := map[string][]filterapi.RouteRuleName{}
 	for i := range aiGatewayRoutes {
 		aiGatewayRoute := &aiGatewayRoutes[i]
 		spec := aiGatewayRoute.Spec
 		for i := range spec.Rules {
 			rule := &spec.Rules[i]
+			fr := filterapi.RouteRule{Name: filterapi.RouteRuleName(internalapi.PerRouteRuleName(aiGatewayRoute.Namespace, aiGatewayRoute.Name, i))}
 			for _, m := range rule.Matches {
 				for _, h := range m.Headers {
 					// If explicitly set to something that is not an exact match, skip.
@@ -236,27 +580,62 @@ func (c *GatewayController) reconcileFilterConfigSecret(ctx context.Context, gw
 						CreatedAt: ptr.Deref[metav1.Time](rule.ModelsCreatedAt, aiGatewayRoute.CreationTimestamp).Time.UTC(),
 						OwnedBy:   ptr.Deref(rule.ModelsOwnedBy, defaultOwnedBy),
 					})
+					fr.Models = append(fr.Models, h.Value)
+				}
+			}
+			if hp := rule.HedgePolicy; hp != nil {
+				fr.HedgePolicy, err = hedgePolicyToFilterAPI(hp)
+				if err != nil {
+					return fmt.Errorf("invalid hedge policy in AIGatewayRoute %s: %w", aiGatewayRoute.Name, err)
+				}
+			}
+			if lb := rule.LoadBalancing; lb != nil && lb.PrefixCacheAffinity != nil {
+				fr.PrefixCacheAffinity = &filterapi.PrefixCacheAffinity{
+					LeadingMessages: int(ptr.Deref(lb.PrefixCacheAffinity.LeadingMessages, 1)),
 				}
 			}
+			fr.Experiment = experimentToFilterAPI(aiGatewayRoute, i)
+			fr.Authorization = authorizationToFilterAPI(spec.Authorization)
+			fr.Guardrails, err = guardrailsToFilterAPI(spec.Guardrails)
+			if err != nil {
+				return fmt.Errorf("invalid guardrails in AIGatewayRoute %s: %w", aiGatewayRoute.Name, err)
+			}
+			fr.RequestLimits = requestLimitsToFilterAPI(spec.RequestLimits)
+			fr.ToolPolicy = toolPolicyToFilterAPI(spec.ToolPolicy)
+			fr.AuditLog = auditLogToFilterAPI(spec.AuditLog)
+			fr.MetricAttributes = metricAttributesToFilterAPI(spec.MetricAttributes)
+			fr.Capture = captureToFilterAPI(spec.Capture)
+			fr.ResponseCache, err = responseCacheToFilterAPI(spec.ResponseCache)
+			if err != nil {
+				return fmt.Errorf("invalid response cache in AIGatewayRoute %s: %w", aiGatewayRoute.Name, err)
+			}
 			for j := range rule.BackendRefs {
 				backendRef := &rule.BackendRefs[j]
-				b := filterapi.Backend{}
-				b.Name = internalapi.PerRouteRuleRefBackendName(aiGatewayRoute.Namespace, backendRef.Name, aiGatewayRoute.Name, i, j)
-				b.ModelNameOverride = backendRef.ModelNameOverride
-				var backendObj *aigv1a1.AIServiceBackend
-				backendObj, err = c.backend(ctx, aiGatewayRoute.Namespace, backendRef.Name)
+				name := internalapi.PerRouteRuleRefBackendName(aiGatewayRoute.Namespace, backendRef.Name, aiGatewayRoute.Name, i, j)
+				var b filterapi.Backend
+				b, err = c.backendRefToFilterAPI(ctx, aiGatewayRoute.Namespace, name, fr.Name, backendRef)
 				if err != nil {
-					return fmt.Errorf("failed to get AIServiceBackend %s: %w", b.Name, err)
+					return err
 				}
-				b.Schema = schemaToFilterAPI(backendObj.Spec.APISchema)
-				if bspRef := backendObj.Spec.BackendSecurityPolicyRef; bspRef != nil {
-					b.Auth, err = c.bspToFilterAPIBackendAuth(ctx, aiGatewayRoute.Namespace, string(bspRef.Name))
-					if err != nil {
-						return fmt.Errorf("failed to create backend auth: %w", err)
-					}
+				ec.Backends = append(ec.Backends, b)
+				key := fmt.Sprintf("%s/%s", aiGatewayRoute.Namespace, backendRef.Name)
+				serviceBackends[key] = append(serviceBackends[key], name)
+			}
+			if sp := rule.ShadowPolicy; sp != nil {
+				name := internalapi.PerRouteRuleShadowBackendName(aiGatewayRoute.Namespace, sp.BackendRef.Name, aiGatewayRoute.Name, i)
+				var b filterapi.Backend
+				b, err = c.backendRefToFilterAPI(ctx, aiGatewayRoute.Namespace, name, fr.Name, &sp.BackendRef)
+				if err != nil {
+					return err
 				}
 				ec.Backends = append(ec.Backends, b)
+				key := fmt.Sprintf("%s/%s", aiGatewayRoute.Namespace, sp.BackendRef.Name)
+				serviceBackends[key] = append(serviceBackends[key], name)
+				fr.Shadow = &filterapi.ShadowPolicy{BackendName: name, Percentage: int(ptr.Deref(sp.Percentage, 100))}
 			}
+			ec.Rules = append(ec.Rules, fr)
+			routeKey := fmt.Sprintf("%s/%s", aiGatewayRoute.Namespace, aiGatewayRoute.Name)
+			routeRules[routeKey] = append(routeRules[routeKey], fr.Name)
 
 			for _, cost := range aiGatewayRoute.Spec.LLMRequestCosts {
 				fc := filterapi.LLMRequestCost{MetadataKey: cost.MetadataKey}
@@ -273,6 +652,12 @@ func (c *GatewayController) reconcileFilterConfigSecret(ctx context.Context, gw
 					fc.Type = filterapi.LLMRequestCostTypeOutputToken
 				case aigv1a1.LLMRequestCostTypeTotalToken:
 					fc.Type = filterapi.LLMRequestCostTypeTotalToken
+				case aigv1a1.LLMRequestCostTypeEstimatedInputToken:
+					fc.Type = filterapi.LLMRequestCostTypeEstimatedInputToken
+				case aigv1a1.LLMRequestCostTypeReservedOutputToken:
+					fc.Type = filterapi.LLMRequestCostTypeReservedOutputToken
+				case aigv1a1.LLMRequestCostTypeReservedTotalToken:
+					fc.Type = filterapi.LLMRequestCostTypeReservedTotalToken
 				case aigv1a1.LLMRequestCostTypeCEL:
 					fc.Type = filterapi.LLMRequestCostTypeCEL
 					expr := *cost.CEL
@@ -291,6 +676,79 @@ func (c *GatewayController) reconcileFilterConfigSecret(ctx context.Context, gw
 		}
 	}
 
+	var quotaPolicies aigv1a1.QuotaPolicyList
+	err = c.client.List(ctx, &quotaPolicies, client.MatchingFields{
+		k8sClientIndexQuotaPolicyToTargetGateway: fmt.Sprintf("%s.%s", gw.Name, gw.Namespace),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list QuotaPolicies: %w", err)
+	}
+	for i := range quotaPolicies.Items {
+		qp := quotaPolicyToFilterAPI(&quotaPolicies.Items[i])
+		if err = checkCostMetadataKeys(qp.Budgets, llmCosts); err != nil {
+			return fmt.Errorf("invalid QuotaPolicy %s: %w", qp.Name, err)
+		}
+		ec.Quotas = append(ec.Quotas, qp)
+	}
+
+	var pricingCatalogs aigv1a1.PricingCatalogList
+	err = c.client.List(ctx, &pricingCatalogs, client.MatchingFields{
+		k8sClientIndexPricingCatalogToTargetGateway: fmt.Sprintf("%s.%s", gw.Name, gw.Namespace),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list PricingCatalogs: %w", err)
+	}
+	slices.SortStableFunc(pricingCatalogs.Items, func(a, b aigv1a1.PricingCatalog) int {
+		if c := a.CreationTimestamp.Compare(b.CreationTimestamp.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	for i := range pricingCatalogs.Items {
+		pc := &pricingCatalogs.Items[i]
+		for j := range pc.Spec.Prices {
+			var p filterapi.ModelPrice
+			p, err = modelPriceToFilterAPI(&pc.Spec.Prices[j])
+			if err != nil {
+				return fmt.Errorf("invalid price in PricingCatalog %s: %w", pc.Name, err)
+			}
+			if ref := pc.Spec.Prices[j].BackendRef; ref != nil {
+				p.Backends = serviceBackends[fmt.Sprintf("%s/%s", pc.Namespace, *ref)]
+				if len(p.Backends) == 0 {
+					// The price must not apply to all the backends.
+					continue
+				}
+			}
+			ec.Prices = append(ec.Prices, p)
+		}
+	}
+
+	var consumerKeys aigv1a1.ConsumerKeyList
+	err = c.client.List(ctx, &consumerKeys, client.MatchingFields{
+		k8sClientIndexConsumerKeyToTargetGateway: fmt.Sprintf("%s.%s", gw.Name, gw.Namespace),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list ConsumerKeys: %w", err)
+	}
+	for i := range consumerKeys.Items {
+		ck := &consumerKeys.Items[i]
+		if ck.Spec.Disabled {
+			continue
+		}
+		// A key which cannot be resolved is left out rather than failing the whole filter config, which
+		// rejects the requests with the key.
+		var fk *filterapi.ConsumerKey
+		fk, err = c.consumerKeyToFilterAPI(ctx, ck, routeRules)
+		if err == nil {
+			err = checkCostMetadataKeys(fk.Budgets, llmCosts)
+		}
+		if err != nil {
+			c.logger.Info("skipping ConsumerKey", "namespace", ck.Namespace, "name", ck.Name, "reason", err.Error())
+			continue
+		}
+		ec.ConsumerKeys = append(ec.ConsumerKeys, *fk)
+	}
+
 	ec.MetadataNamespace = aigv1a1.AIGatewayFilterMetadataNamespace
 
 	marshaled, err := yaml.Marshal(ec)
@@ -324,6 +782,135 @@ func (c *GatewayController) reconcileFilterConfigSecret(ctx context.Context, gw
 	return nil
 }
 
+// modelPriceToFilterAPI converts the price of the model to the filter API representation, whose token prices
+// are in micro-USD per token and the other prices are in micro-USD.
+func modelPriceToFilterAPI(mp *aigv1a1.ModelPrice) (filterapi.ModelPrice, error) {
+	ret := filterapi.ModelPrice{Model: mp.Model}
+	for _, p := range []struct {
+		name  string
+		price *aigv1a1.USDPrice
+		dst   *float64
+		// scale converts the price in USD to the one in the filter API.
+		scale float64
+	}{
+		{"inputTokenPrice", &mp.InputTokenPrice, &ret.InputToken, 1},
+		{"outputTokenPrice", &mp.OutputTokenPrice, &ret.OutputToken, 1},
+		{"cachedInputTokenPrice", mp.CachedInputTokenPrice, &ret.CachedInputToken, 1},
+		{"reasoningTokenPrice", mp.ReasoningTokenPrice, &ret.ReasoningToken, 1},
+		{"imagePrice", mp.ImagePrice, &ret.Image, 1e6},
+		{"audioSecondPrice", mp.AudioSecondPrice, &ret.AudioSecond, 1e6},
+	} {
+		if p.price == nil {
+			continue
+		}
+		v, err := strconv.ParseFloat(string(*p.price), 64)
+		if err != nil {
+			return ret, fmt.Errorf("failed to parse %s of model %s: %w", p.name, mp.Model, err)
+		}
+		*p.dst = v * p.scale
+	}
+	if mp.CachedInputTokenPrice == nil {
+		ret.CachedInputToken = ret.InputToken
+	}
+	if mp.ReasoningTokenPrice == nil {
+		ret.ReasoningToken = ret.OutputToken
+	}
+	return ret, nil
+}
+
+// quotaPolicyToFilterAPI converts the QuotaPolicy to the filter API representation.
+func quotaPolicyToFilterAPI(qp *aigv1a1.QuotaPolicy) filterapi.QuotaPolicy {
+	ret := filterapi.QuotaPolicy{Name: fmt.Sprintf("%s/%s", qp.Namespace, qp.Name)}
+	switch ck := qp.Spec.ConsumerKey; ck.Type {
+	case aigv1a1.QuotaConsumerKeyTypeHeader:
+		ret.ConsumerHeader = ptr.Deref(ck.Header, "")
+	case aigv1a1.QuotaConsumerKeyTypeJWTClaim:
+		ret.ConsumerJWTClaim = ptr.Deref(ck.JWTClaim, "")
+	case aigv1a1.QuotaConsumerKeyTypeClientIP:
+		ret.ConsumerClientIP = true
+	}
+	for _, b := range qp.Spec.Budgets {
+		ret.Budgets = append(ret.Budgets, quotaBudgetToFilterAPI(&b))
+	}
+	return ret
+}
+
+// quotaBudgetToFilterAPI converts an aigv1a1.QuotaBudget to filterapi.QuotaBudget.
+func quotaBudgetToFilterAPI(b *aigv1a1.QuotaBudget) filterapi.QuotaBudget {
+	return filterapi.QuotaBudget{
+		Name:            b.Name,
+		Models:          b.Models,
+		Type:            filterapi.QuotaBudgetType(b.Type),
+		CostMetadataKey: ptr.Deref(b.CostMetadataKey, ""),
+		Period:          filterapi.QuotaBudgetPeriod(b.Period),
+		Limit:           b.Limit,
+	}
+}
+
+// checkCostMetadataKeys returns an error if any of the cost budgets counts the LLMRequestCost which is not configured
+// in the AIGatewayRoutes attached to the Gateway, since the extproc rejects such a budget which would never be consumed.
+func checkCostMetadataKeys(budgets []filterapi.QuotaBudget, llmCosts map[string]struct{}) error {
+	for i := range budgets {
+		b := &budgets[i]
+		if b.Type != filterapi.QuotaBudgetTypeCost {
+			continue
+		}
+		if _, ok := llmCosts[b.CostMetadataKey]; !ok {
+			return fmt.Errorf("LLMRequestCost %q counted by the budget %s does not exist", b.CostMetadataKey, b.Name)
+		}
+	}
+	return nil
+}
+
+// consumerKeyToFilterAPI converts the ConsumerKey to the filter API representation with the hash of the key read from
+// the referenced Secret. routeRules maps the "namespace/name" of the AIGatewayRoutes to the names of their rules.
+func (c *GatewayController) consumerKeyToFilterAPI(ctx context.Context, ck *aigv1a1.ConsumerKey, routeRules map[string][]filterapi.RouteRuleName) (*filterapi.ConsumerKey, error) {
+	ret := &filterapi.ConsumerKey{
+		Name:     fmt.Sprintf("%s/%s", ck.Namespace, ck.Name),
+		Consumer: ck.Spec.Consumer,
+		Models:   ck.Spec.Models,
+		Labels:   ck.Spec.Labels,
+	}
+	if ck.Spec.ExpiresAt != nil {
+		ret.ExpiresAt = ptr.To(ck.Spec.ExpiresAt.UTC())
+	}
+	for _, r := range ck.Spec.Routes {
+		ret.Rules = append(ret.Rules, routeRules[fmt.Sprintf("%s/%s", ck.Namespace, r)]...)
+	}
+	if len(ck.Spec.Routes) > 0 && len(ret.Rules) == 0 {
+		return nil, fmt.Errorf("none of the routes %v is attached to the Gateway", ck.Spec.Routes)
+	}
+	for _, b := range ck.Spec.Budgets {
+		ret.Budgets = append(ret.Budgets, quotaBudgetToFilterAPI(&b))
+	}
+	if ck.Spec.SecretRef == nil {
+		return nil, fmt.Errorf("secretRef is not set")
+	}
+	namespace := string(ptr.Deref(ck.Spec.SecretRef.Namespace, gwapiv1.Namespace(ck.Namespace)))
+	hash, err := c.getSecretData(ctx, namespace, string(ck.Spec.SecretRef.Name), aigv1a1.ConsumerKeyHashInSecret)
+	if err != nil {
+		return nil, err
+	}
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if raw, err := hex.DecodeString(hash); err != nil || len(raw) != sha256.Size {
+		return nil, fmt.Errorf("%s in secret %s is not a hex-encoded SHA-256 hash", aigv1a1.ConsumerKeyHashInSecret, ck.Spec.SecretRef.Name)
+	}
+	ret.Hash = hash
+	return ret, nil
+}
+
+// hedgePolicyToFilterAPI converts an aigv1a1.AIGatewayRouteRuleHedgePolicy to filterapi.HedgePolicy.
+func hedgePolicyToFilterAPI(hp *aigv1a1.AIGatewayRouteRuleHedgePolicy) (*filterapi.HedgePolicy, error) {
+	timeout, err := time.ParseDuration(string(hp.FirstResponseTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse first response timeout: %w", err)
+	}
+	return &filterapi.HedgePolicy{
+		FirstResponseTimeout: timeout,
+		MaxHedgedRequests:    int(ptr.Deref(hp.MaxHedgedRequests, 1)),
+	}, nil
+}
+
 func (c *GatewayController) bspToFilterAPIBackendAuth(ctx context.Context, namespace, bspName string) (*filterapi.BackendAuth, error) {
 	backendSecurityPolicy, err := c.backendSecurityPolicy(ctx, namespace, bspName)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"strconv"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
@@ -34,11 +35,26 @@ type gatewayMutator struct {
 	extProcLogLevel        string
 	envoyGatewayNamespace  string
 	udsPath                string
+	// extProcQuotaRedisAddr is the address of the Redis-protocol server for the QuotaPolicy counters. Optional.
+	extProcQuotaRedisAddr string
+	// extProcUsageLedger is the configuration of the usage ledger. Optional.
+	extProcUsageLedger UsageLedgerOptions
+	// extProcAuditLog is the configuration of the audit log. Optional.
+	extProcAuditLog AuditLogOptions
+	// extProcTracing is the configuration of the tracing. Optional.
+	extProcTracing TracingOptions
+	// extProcMetrics is the configuration of the exporters of the metrics. Optional.
+	extProcMetrics MetricsOptions
+	// extProcCaptureDir is the directory of the captures of the requests. Optional.
+	extProcCaptureDir string
+	// extProcResponseCacheRedisAddr is the address of the Redis-protocol server for the cached responses. Optional.
+	extProcResponseCacheRedisAddr string
 }
 
 func newGatewayMutator(c client.Client, kube kubernetes.Interface, logger logr.Logger,
 	extProcImage string, extProcImagePullPolicy corev1.PullPolicy, extProcLogLevel string, envoyGatewayNamespace string,
-	udsPath string,
+	udsPath string, extProcQuotaRedisAddr string, extProcUsageLedger UsageLedgerOptions, extProcAuditLog AuditLogOptions,
+	extProcTracing TracingOptions, extProcMetrics MetricsOptions, extProcCaptureDir string, extProcResponseCacheRedisAddr string,
 ) *gatewayMutator {
 	return &gatewayMutator{
 		c: c, codec: serializer.NewCodecFactory(Scheme),
@@ -49,6 +65,14 @@ func newGatewayMutator(c client.Client, kube kubernetes.Interface, logger logr.L
 		logger:                 logger,
 		envoyGatewayNamespace:  envoyGatewayNamespace,
 		udsPath:                udsPath,
+		extProcQuotaRedisAddr:  extProcQuotaRedisAddr,
+		extProcUsageLedger:     extProcUsageLedger,
+		extProcAuditLog:        extProcAuditLog,
+		extProcTracing:         extProcTracing,
+		extProcMetrics:         extProcMetrics,
+		extProcCaptureDir:      extProcCaptureDir,
+
+		extProcResponseCacheRedisAddr: extProcResponseCacheRedisAddr,
 	}
 }
 
@@ -126,6 +150,73 @@ func (g *gatewayMutator) mutatePod(ctx context.Context, pod *corev1.Pod, gateway
 		filterConfigFullPath  = filterConfigMountPath + "/" + FilterConfigKeyInSecret
 	)
 	udsMountPath := filepath.Dir(g.udsPath)
+	args := []string{
+		"-configPath", filterConfigFullPath,
+		"-logLevel", g.extProcLogLevel,
+		"-extProcAddr", "unix://" + g.udsPath,
+		"-metricsPort", fmt.Sprintf("%d", extProcMetricsPort),
+		"-healthPort", fmt.Sprintf("%d", extProcHealthPort),
+	}
+	if g.extProcQuotaRedisAddr != "" {
+		args = append(args, "-quotaRedisAddr", g.extProcQuotaRedisAddr)
+	}
+	if g.extProcResponseCacheRedisAddr != "" {
+		args = append(args, "-responseCacheRedisAddr", g.extProcResponseCacheRedisAddr)
+	}
+	if l := g.extProcUsageLedger; l.Sink != "" {
+		args = append(args, "-usageLedgerSink", l.Sink, "-usageLedgerEndpoint", l.Endpoint)
+		if l.ConsumerHeader != "" {
+			args = append(args, "-usageLedgerConsumerHeader", l.ConsumerHeader)
+		}
+		if l.ConsumerJWTClaim != "" {
+			args = append(args, "-usageLedgerConsumerJWTClaim", l.ConsumerJWTClaim)
+		}
+	}
+	if l := g.extProcAuditLog; l.Sink != "" {
+		args = append(args, "-auditLogSink", l.Sink, "-auditLogEndpoint", l.Endpoint)
+	}
+	if t := g.extProcTracing; t.Endpoint != "" {
+		args = append(args, "-tracingEndpoint", t.Endpoint, "-tracingSampleRatio", strconv.FormatFloat(t.SampleRatio, 'g', -1, 64))
+		if t.CaptureContent {
+			args = append(args, "-tracingCaptureContent")
+		}
+	}
+	if g.extProcCaptureDir != "" {
+		args = append(args, "-captureDir", g.extProcCaptureDir)
+	}
+	if m := g.extProcMetrics; m.Exporter != "" {
+		args = append(args, "-metricsExporter", m.Exporter)
+		if m.OTLPEndpoint != "" {
+			args = append(args, "-metricsOTLPEndpoint", m.OTLPEndpoint)
+		}
+		if m.OTLPProtocol != "" {
+			args = append(args, "-metricsOTLPProtocol", m.OTLPProtocol)
+		}
+		if m.OTLPExportInterval > 0 {
+			args = append(args, "-metricsOTLPExportInterval", m.OTLPExportInterval.String())
+		}
+	}
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      extProcUDSVolumeName,
+			MountPath: udsMountPath,
+			ReadOnly:  false,
+		},
+		{
+			Name:      filterConfigVolumeName,
+			MountPath: filterConfigMountPath,
+			ReadOnly:  true,
+		},
+	}
+	if g.extProcCaptureDir != "" {
+		// The captures are written to the volume, so that they can be copied out of the container for the replay.
+		const extProcCaptureVolumeName = mutationNamePrefix + "extproc-capture"
+		podspec.Volumes = append(podspec.Volumes, corev1.Volume{
+			Name:         extProcCaptureVolumeName,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: extProcCaptureVolumeName, MountPath: g.extProcCaptureDir})
+	}
 	podspec.Containers = append(podspec.Containers, corev1.Container{
 		Name:            extProcContainerName,
 		Image:           g.extProcImage,
@@ -133,25 +224,8 @@ func (g *gatewayMutator) mutatePod(ctx context.Context, pod *corev1.Pod, gateway
 		Ports: []corev1.ContainerPort{
 			{Name: "aigw-metrics", ContainerPort: extProcMetricsPort},
 		},
-		Args: []string{
-			"-configPath", filterConfigFullPath,
-			"-logLevel", g.extProcLogLevel,
-			"-extProcAddr", "unix://" + g.udsPath,
-			"-metricsPort", fmt.Sprintf("%d", extProcMetricsPort),
-			"-healthPort", fmt.Sprintf("%d", extProcHealthPort),
-		},
-		VolumeMounts: []corev1.VolumeMount{
-			{
-				Name:      extProcUDSVolumeName,
-				MountPath: udsMountPath,
-				ReadOnly:  false,
-			},
-			{
-				Name:      filterConfigVolumeName,
-				MountPath: filterConfigMountPath,
-				ReadOnly:  true,
-			},
-		},
+		Args:         args,
+		VolumeMounts: volumeMounts,
 		SecurityContext: &corev1.SecurityContext{
 			AllowPrivilegeEscalation: ptr.To(false),
 			Capabilities: &corev1.Capabilities{
@@ -27,7 +27,8 @@ func TestGatewayMutator_Default(t *testing.T) {
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&zap.Options{Development: true, Level: zapcore.DebugLevel})))
 	g := newGatewayMutator(
 		fakeClient, fakeKube, ctrl.Log, "docker.io/amagidevops/ai-gateway-extproc:latest", corev1.PullIfNotPresent,
-		"info", "envoy-gateway-system", "/tmp/extproc.sock",
+		"info", "envoy-gateway-system", "/tmp/extproc.sock", "", UsageLedgerOptions{}, AuditLogOptions{}, TracingOptions{},
+		MetricsOptions{}, "", "",
 	)
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "test-namespace"},
@@ -50,7 +51,12 @@ func TestGatewayMutator_mutatePod(t *testing.T) {
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&zap.Options{Development: true, Level: zapcore.DebugLevel})))
 	g := newGatewayMutator(
 		fakeClient, fakeKube, ctrl.Log, "docker.io/amagidevops/ai-gateway-extproc:latest", corev1.PullIfNotPresent,
-		"info", "envoy-gateway-system", "/tmp/extproc.sock",
+		"info", "envoy-gateway-system", "/tmp/extproc.sock", "",
+		UsageLedgerOptions{Sink: "otlp", Endpoint: "http://otel-collector:4318", ConsumerHeader: "x-team"},
+		AuditLogOptions{Sink: "file", Endpoint: "/var/log/aigw/audit.jsonl"},
+		TracingOptions{Endpoint: "http://otel-collector:4318", SampleRatio: 0.1},
+		MetricsOptions{Exporter: "prometheus,otlp", OTLPEndpoint: "http://otel-collector:4317", OTLPProtocol: "grpc"},
+		"/var/lib/aigw/captures", "redis:6379",
 	)
 
 	const gwName, gwNamespace = "test-gateway", "test-namespace"
@@ -81,4 +87,20 @@ func TestGatewayMutator_mutatePod(t *testing.T) {
 	}
 	err = g.mutatePod(t.Context(), pod, gwName, gwNamespace)
 	require.NoError(t, err)
+	require.Len(t, pod.Spec.Containers, 2)
+	require.Subset(t, pod.Spec.Containers[1].Args, []string{
+		"-usageLedgerSink", "otlp", "-usageLedgerEndpoint", "http://otel-collector:4318", "-usageLedgerConsumerHeader", "x-team",
+	})
+	require.NotContains(t, pod.Spec.Containers[1].Args, "-usageLedgerConsumerJWTClaim")
+	require.Subset(t, pod.Spec.Containers[1].Args, []string{"-auditLogSink", "file", "-auditLogEndpoint", "/var/log/aigw/audit.jsonl"})
+	require.Subset(t, pod.Spec.Containers[1].Args, []string{"-tracingEndpoint", "http://otel-collector:4318", "-tracingSampleRatio", "0.1"})
+	require.NotContains(t, pod.Spec.Containers[1].Args, "-tracingCaptureContent")
+	require.Subset(t, pod.Spec.Containers[1].Args, []string{
+		"-metricsExporter", "prometheus,otlp", "-metricsOTLPEndpoint", "http://otel-collector:4317", "-metricsOTLPProtocol", "grpc",
+	})
+	require.NotContains(t, pod.Spec.Containers[1].Args, "-metricsOTLPExportInterval")
+	require.Subset(t, pod.Spec.Containers[1].Args, []string{"-captureDir", "/var/lib/aigw/captures"})
+	require.Subset(t, pod.Spec.Containers[1].Args, []string{"-responseCacheRedisAddr", "redis:6379"})
+	require.Contains(t, pod.Spec.Containers[1].VolumeMounts,
+		corev1.VolumeMount{Name: mutationNamePrefix + "extproc-capture", MountPath: "/var/lib/aigw/captures"})
 }
@@ -9,13 +9,16 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	egv1a1 "github.com/envoyproxy/gateway/api/v1alpha1"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zapcore"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	fake2 "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/utils/ptr"
@@ -29,6 +32,7 @@ import (
 	aigv1a1 "github.com/envoyproxy/ai-gateway/api/v1alpha1"
 	"github.com/envoyproxy/ai-gateway/filterapi"
 	"github.com/envoyproxy/ai-gateway/internal/controller/rotators"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
 )
 
 func TestGatewayController_Reconcile(t *testing.T) {
@@ -86,7 +90,10 @@ func TestGatewayController_Reconcile(t *testing.T) {
 			Spec: aigv1a1.AIGatewayRouteSpec{
 				TargetRefs: targets,
 				Rules: []aigv1a1.AIGatewayRouteRule{
-					{BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "orange"}}},
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "orange"}},
+						HedgePolicy: &aigv1a1.AIGatewayRouteRuleHedgePolicy{FirstResponseTimeout: "500ms"},
+					},
 				},
 				APISchema: aigv1a1.VersionedAPISchema{Name: aigv1a1.APISchemaOpenAI},
 			},
@@ -132,6 +139,38 @@ func TestGatewayController_Reconcile(t *testing.T) {
 	require.Len(t, extPolicy.Spec.ExtProc, 1)
 	require.Len(t, extPolicy.Spec.ExtProc[0].BackendRefs, 1)
 	require.Equal(t, sideCarExtProcBackendName, string(extPolicy.Spec.ExtProc[0].BackendRefs[0].Name))
+	require.Equal(t, []string{"envoy.filters.http.jwt_authn"}, extPolicy.Spec.ExtProc[0].Metadata.AccessibleNamespaces)
+
+	// The namespaces of the dynamic metadata of the metric attributes are made accessible to the extproc.
+	var route aigv1a1.AIGatewayRoute
+	require.NoError(t, fakeClient.Get(t.Context(), client.ObjectKey{Name: "route2", Namespace: namespace}, &route))
+	route.Spec.MetricAttributes = []aigv1a1.AIGatewayRouteMetricAttribute{{
+		Name:     "team",
+		Metadata: &aigv1a1.AIGatewayRouteMetricAttributeMetadata{Namespace: "example.com/team", Key: "team"},
+	}}
+	require.NoError(t, fakeClient.Update(t.Context(), &route))
+	_, err = c.Reconcile(t.Context(), ctrl.Request{NamespacedName: client.ObjectKey{Name: okGwName, Namespace: namespace}})
+	require.NoError(t, err)
+	err = fakeClient.Get(t.Context(), client.ObjectKey{Name: fmt.Sprintf("ai-eg-eep-%s", okGwName), Namespace: namespace}, &extPolicy)
+	require.NoError(t, err)
+	require.Equal(t, []string{"envoy.filters.http.jwt_authn", "example.com/team"}, extPolicy.Spec.ExtProc[0].Metadata.AccessibleNamespaces)
+
+	// The policy created by the older versions is upgraded with both the accessible and the writable namespaces.
+	for _, metadata := range []*egv1a1.ExtProcMetadata{
+		nil,
+		{WritableNamespaces: []string{aigv1a1.AIGatewayFilterMetadataNamespace}},
+	} {
+		extPolicy.Spec.ExtProc[0].Metadata = metadata
+		require.NoError(t, fakeClient.Update(t.Context(), &extPolicy))
+		_, err = c.Reconcile(t.Context(), ctrl.Request{NamespacedName: client.ObjectKey{Name: okGwName, Namespace: namespace}})
+		require.NoError(t, err)
+		err = fakeClient.Get(t.Context(), client.ObjectKey{Name: fmt.Sprintf("ai-eg-eep-%s", okGwName), Namespace: namespace}, &extPolicy)
+		require.NoError(t, err)
+		require.Equal(t, &egv1a1.ExtProcMetadata{
+			AccessibleNamespaces: []string{"envoy.filters.http.jwt_authn", "example.com/team"},
+			WritableNamespaces:   []string{aigv1a1.AIGatewayFilterMetadataNamespace, internalapi.EnvoyLBMetadataNamespace},
+		}, extPolicy.Spec.ExtProc[0].Metadata)
+	}
 }
 
 func TestGatewayController_reconcileFilterConfigSecret(t *testing.T) {
@@ -150,6 +189,9 @@ func TestGatewayController_reconcileFilterConfigSecret(t *testing.T) {
 				Rules: []aigv1a1.AIGatewayRouteRule{
 					{
 						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "apple"}},
+						LoadBalancing: &aigv1a1.AIGatewayRouteRuleLoadBalancing{
+							PrefixCacheAffinity: &aigv1a1.PrefixCacheAffinity{LeadingMessages: ptr.To[int32](2)},
+						},
 						Matches: []aigv1a1.AIGatewayRouteRuleMatch{
 							{
 								Headers: []gwapiv1.HTTPHeaderMatch{
@@ -167,6 +209,7 @@ func TestGatewayController_reconcileFilterConfigSecret(t *testing.T) {
 					{MetadataKey: "foo", Type: aigv1a1.LLMRequestCostTypeInputToken},
 					{MetadataKey: "bar", Type: aigv1a1.LLMRequestCostTypeOutputToken},
 					{MetadataKey: "baz", Type: aigv1a1.LLMRequestCostTypeTotalToken},
+					{MetadataKey: "qux", Type: aigv1a1.LLMRequestCostTypeReservedTotalToken},
 				},
 			},
 		},
@@ -174,7 +217,13 @@ func TestGatewayController_reconcileFilterConfigSecret(t *testing.T) {
 			ObjectMeta: metav1.ObjectMeta{Name: "route2", Namespace: namespace},
 			Spec: aigv1a1.AIGatewayRouteSpec{
 				Rules: []aigv1a1.AIGatewayRouteRule{
-					{BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "orange"}}},
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "orange"}},
+						HedgePolicy: &aigv1a1.AIGatewayRouteRuleHedgePolicy{FirstResponseTimeout: "500ms"},
+						ShadowPolicy: &aigv1a1.AIGatewayRouteRuleShadowPolicy{
+							BackendRef: aigv1a1.AIGatewayRouteRuleBackendRef{Name: "apple", ModelNameOverride: "candidate"},
+						},
+					},
 				},
 				APISchema: aigv1a1.VersionedAPISchema{Name: aigv1a1.APISchemaOpenAI},
 				LLMRequestCosts: []aigv1a1.LLMRequestCost{
@@ -203,6 +252,78 @@ func TestGatewayController_reconcileFilterConfigSecret(t *testing.T) {
 		require.NoError(t, err)
 	}
 
+	err := fakeClient.Create(t.Context(), &aigv1a1.QuotaPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: namespace},
+		Spec: aigv1a1.QuotaPolicySpec{
+			TargetRefs:  []gwapiv1a2.LocalPolicyTargetReference{{Name: "gw", Kind: "Gateway", Group: "gateway.networking.k8s.io"}},
+			ConsumerKey: aigv1a1.QuotaConsumerKey{Type: aigv1a1.QuotaConsumerKeyTypeHeader, Header: ptr.To("x-tenant-id")},
+			Budgets: []aigv1a1.QuotaBudget{
+				{Name: "spend", Type: aigv1a1.QuotaBudgetTypeCost, CostMetadataKey: ptr.To("cat"), Period: aigv1a1.QuotaBudgetPeriodMonthly, Limit: 100},
+			},
+		},
+	})
+	require.NoError(t, err)
+	err = fakeClient.Create(t.Context(), &aigv1a1.PricingCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: "prices", Namespace: namespace},
+		Spec: aigv1a1.PricingCatalogSpec{
+			TargetRefs: []gwapiv1a2.LocalPolicyTargetReference{{Name: "gw", Kind: "Gateway", Group: "gateway.networking.k8s.io"}},
+			Prices: []aigv1a1.ModelPrice{
+				{Model: "mymodel", InputTokenPrice: "2.5", OutputTokenPrice: "10"},
+				{Model: "mymodel", BackendRef: ptr.To("apple"), InputTokenPrice: "2", OutputTokenPrice: "8"},
+				{Model: "mymodel", BackendRef: ptr.To("non-existent"), InputTokenPrice: "1", OutputTokenPrice: "1"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	const keyHash = "0a3f5b2c41e1ac4df1d7f6bdbd3b4c1ba5ffa8dbe46b57cd0d8f26b86e4fb8a2"
+	_, err = kube.CoreV1().Secrets(namespace).Create(t.Context(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-key", Namespace: namespace},
+		Data:       map[string][]byte{aigv1a1.ConsumerKeyHashInSecret: []byte(strings.ToUpper(keyHash) + "\n")},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	for _, ck := range []*aigv1a1.ConsumerKey{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: namespace},
+			Spec: aigv1a1.ConsumerKeySpec{
+				TargetRefs: []gwapiv1a2.LocalPolicyTargetReference{{Name: "gw", Kind: "Gateway", Group: "gateway.networking.k8s.io"}},
+				Consumer:   "team-a",
+				SecretRef:  &gwapiv1.SecretObjectReference{Name: "team-a-key"},
+				Routes:     []string{"route2"},
+				Budgets:    []aigv1a1.QuotaBudget{{Name: "daily", Type: aigv1a1.QuotaBudgetTypeToken, Period: aigv1a1.QuotaBudgetPeriodDaily, Limit: 1000}},
+				Labels:     map[string]string{"cost-center": "42"},
+				ExpiresAt:  &metav1.Time{Time: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "disabled", Namespace: namespace},
+			Spec: aigv1a1.ConsumerKeySpec{
+				TargetRefs: []gwapiv1a2.LocalPolicyTargetReference{{Name: "gw", Kind: "Gateway", Group: "gateway.networking.k8s.io"}},
+				Consumer:   "team-b",
+				SecretRef:  &gwapiv1.SecretObjectReference{Name: "team-a-key"},
+				Disabled:   true,
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unknown-cost", Namespace: namespace},
+			Spec: aigv1a1.ConsumerKeySpec{
+				TargetRefs: []gwapiv1a2.LocalPolicyTargetReference{{Name: "gw", Kind: "Gateway", Group: "gateway.networking.k8s.io"}},
+				Consumer:   "team-d",
+				SecretRef:  &gwapiv1.SecretObjectReference{Name: "team-a-key"},
+				Budgets:    []aigv1a1.QuotaBudget{{Name: "spend", Type: aigv1a1.QuotaBudgetTypeCost, CostMetadataKey: ptr.To("unknown"), Period: aigv1a1.QuotaBudgetPeriodDaily, Limit: 10}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "no-secret", Namespace: namespace},
+			Spec: aigv1a1.ConsumerKeySpec{
+				TargetRefs: []gwapiv1a2.LocalPolicyTargetReference{{Name: "gw", Kind: "Gateway", Group: "gateway.networking.k8s.io"}},
+				Consumer:   "team-c",
+				SecretRef:  &gwapiv1.SecretObjectReference{Name: "non-existent"},
+			},
+		},
+	} {
+		require.NoError(t, fakeClient.Create(t.Context(), ck))
+	}
+
 	for range 2 { // Reconcile twice to make sure the secret update path is working.
 		err := c.reconcileFilterConfigSecret(t.Context(), &gwapiv1.Gateway{
 			ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: namespace},
@@ -216,17 +337,480 @@ func TestGatewayController_reconcileFilterConfigSecret(t *testing.T) {
 		require.True(t, ok)
 		var fc filterapi.Config
 		require.NoError(t, yaml.Unmarshal([]byte(configStr), &fc))
-		require.Len(t, fc.LLMRequestCosts, 4)
+		require.Len(t, fc.LLMRequestCosts, 5)
 		require.Equal(t, filterapi.LLMRequestCostTypeInputToken, fc.LLMRequestCosts[0].Type)
 		require.Equal(t, filterapi.LLMRequestCostTypeOutputToken, fc.LLMRequestCosts[1].Type)
 		require.Equal(t, filterapi.LLMRequestCostTypeTotalToken, fc.LLMRequestCosts[2].Type)
-		require.Equal(t, filterapi.LLMRequestCostTypeCEL, fc.LLMRequestCosts[3].Type)
-		require.Equal(t, `backend == 'foo.default' ?  input_tokens + output_tokens : total_tokens`, fc.LLMRequestCosts[3].CEL)
+		require.Equal(t, filterapi.LLMRequestCostTypeReservedTotalToken, fc.LLMRequestCosts[3].Type)
+		require.Equal(t, filterapi.LLMRequestCostTypeCEL, fc.LLMRequestCosts[4].Type)
+		require.Equal(t, `backend == 'foo.default' ?  input_tokens + output_tokens : total_tokens`, fc.LLMRequestCosts[4].CEL)
 		require.Len(t, fc.Models, 1)
 		require.Equal(t, "mymodel", fc.Models[0].Name)
+		require.Equal(t, []filterapi.RouteRule{
+			{Name: "ns/route1/rule/0", Models: []string{"mymodel"}, PrefixCacheAffinity: &filterapi.PrefixCacheAffinity{LeadingMessages: 2}},
+			{
+				Name:        "ns/route2/rule/0",
+				HedgePolicy: &filterapi.HedgePolicy{FirstResponseTimeout: 500 * time.Millisecond, MaxHedgedRequests: 1},
+				Shadow:      &filterapi.ShadowPolicy{BackendName: "ns/apple/route/route2/rule/0/shadow", Percentage: 100},
+			},
+		}, fc.Rules)
+		require.Len(t, fc.Backends, 3)
+		require.Equal(t, filterapi.RouteRuleName("ns/route1/rule/0"), fc.Backends[0].RouteRuleName)
+		require.Equal(t, filterapi.RouteRuleName("ns/route2/rule/0"), fc.Backends[1].RouteRuleName)
+		require.Equal(t, "ns/apple/route/route2/rule/0/shadow", fc.Backends[2].Name)
+		require.Equal(t, "candidate", fc.Backends[2].ModelNameOverride)
+		require.Equal(t, filterapi.RouteRuleName("ns/route2/rule/0"), fc.Backends[2].RouteRuleName)
+		require.Len(t, fc.Quotas, 1)
+		require.Equal(t, "ns/quota", fc.Quotas[0].Name)
+		require.Equal(t, "x-tenant-id", fc.Quotas[0].ConsumerHeader)
+		require.Equal(t, "cat", fc.Quotas[0].Budgets[0].CostMetadataKey)
+		require.Equal(t, []filterapi.ModelPrice{
+			{Model: "mymodel", InputToken: 2.5, OutputToken: 10, CachedInputToken: 2.5, ReasoningToken: 10},
+			{
+				Model: "mymodel", Backends: []string{fc.Backends[0].Name, "ns/apple/route/route2/rule/0/shadow"},
+				InputToken: 2, OutputToken: 8, CachedInputToken: 2, ReasoningToken: 8,
+			},
+		}, fc.Prices)
+		require.Equal(t, []filterapi.ConsumerKey{
+			{
+				Name: "ns/team-a", Hash: keyHash, Consumer: "team-a", Rules: []filterapi.RouteRuleName{"ns/route2/rule/0"},
+				Budgets:   []filterapi.QuotaBudget{{Name: "daily", Type: filterapi.QuotaBudgetTypeToken, Period: filterapi.QuotaBudgetPeriodDaily, Limit: 1000}},
+				Labels:    map[string]string{"cost-center": "42"},
+				ExpiresAt: ptr.To(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)),
+			},
+		}, fc.ConsumerKeys)
+	}
+
+	// The QuotaPolicy whose cost budget counts the LLMRequestCost which does not exist is rejected.
+	err = fakeClient.Create(t.Context(), &aigv1a1.QuotaPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "unknown-cost", Namespace: namespace},
+		Spec: aigv1a1.QuotaPolicySpec{
+			TargetRefs:  []gwapiv1a2.LocalPolicyTargetReference{{Name: "gw", Kind: "Gateway", Group: "gateway.networking.k8s.io"}},
+			ConsumerKey: aigv1a1.QuotaConsumerKey{Type: aigv1a1.QuotaConsumerKeyTypeHeader, Header: ptr.To("x-tenant-id")},
+			Budgets: []aigv1a1.QuotaBudget{
+				{Name: "spend", Type: aigv1a1.QuotaBudgetTypeCost, CostMetadataKey: ptr.To("unknown"), Period: aigv1a1.QuotaBudgetPeriodMonthly, Limit: 100},
+			},
+		},
+	})
+	require.NoError(t, err)
+	err = c.reconcileFilterConfigSecret(t.Context(), &gwapiv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: namespace},
+	}, routes, "foouuid")
+	require.EqualError(t, err, `invalid QuotaPolicy ns/unknown-cost: LLMRequestCost "unknown" counted by the budget spend does not exist`)
+}
+
+func TestGatewayController_consumerKeyToFilterAPI(t *testing.T) {
+	kube := fake2.NewClientset()
+	c := NewGatewayController(requireNewFakeClientWithIndexes(t), kube, ctrl.Log,
+		"envoy-gateway-system", "/foo/bar/uds.sock", "docker.io/amagidevops/ai-gateway-extproc:latest")
+	_, err := kube.CoreV1().Secrets("other").Create(t.Context(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "invalid", Namespace: "other"},
+		Data:       map[string][]byte{aigv1a1.ConsumerKeyHashInSecret: []byte("sk-plain-text-key")},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		spec   aigv1a1.ConsumerKeySpec
+		expErr string
+	}{
+		{
+			name:   "no secret",
+			spec:   aigv1a1.ConsumerKeySpec{SecretRef: &gwapiv1.SecretObjectReference{Name: "missing"}},
+			expErr: "failed to get secret missing",
+		},
+		{
+			name:   "not a hash",
+			spec:   aigv1a1.ConsumerKeySpec{SecretRef: &gwapiv1.SecretObjectReference{Name: "invalid", Namespace: ptr.To[gwapiv1.Namespace]("other")}},
+			expErr: "apiKeyHash in secret invalid is not a hex-encoded SHA-256 hash",
+		},
+		{
+			name:   "no routes attached",
+			spec:   aigv1a1.ConsumerKeySpec{SecretRef: &gwapiv1.SecretObjectReference{Name: "invalid"}, Routes: []string{"route9"}},
+			expErr: "none of the routes [route9] is attached to the Gateway",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := c.consumerKeyToFilterAPI(t.Context(), &aigv1a1.ConsumerKey{
+				ObjectMeta: metav1.ObjectMeta{Name: "key", Namespace: "ns"},
+				Spec:       tc.spec,
+			}, map[string][]filterapi.RouteRuleName{"ns/route1": {"ns/route1/rule/0"}})
+			require.ErrorContains(t, err, tc.expErr)
+		})
 	}
 }
 
+func Test_modelPriceToFilterAPI(t *testing.T) {
+	p, err := modelPriceToFilterAPI(&aigv1a1.ModelPrice{
+		Model:                 "gpt-4o",
+		InputTokenPrice:       "2.5",
+		OutputTokenPrice:      "10",
+		CachedInputTokenPrice: ptr.To[aigv1a1.USDPrice]("1.25"),
+		ReasoningTokenPrice:   ptr.To[aigv1a1.USDPrice]("20"),
+		ImagePrice:            ptr.To[aigv1a1.USDPrice]("0.001"),
+		AudioSecondPrice:      ptr.To[aigv1a1.USDPrice]("0.0001"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "gpt-4o", p.Model)
+	require.Equal(t, 2.5, p.InputToken)
+	require.Equal(t, 10.0, p.OutputToken)
+	require.Equal(t, 1.25, p.CachedInputToken)
+	require.Equal(t, 20.0, p.ReasoningToken)
+	require.InDelta(t, 1000, p.Image, 1e-9)
+	require.InDelta(t, 100, p.AudioSecond, 1e-9)
+
+	_, err = modelPriceToFilterAPI(&aigv1a1.ModelPrice{Model: "gpt-4o", InputTokenPrice: "foo", OutputTokenPrice: "1"})
+	require.ErrorContains(t, err, "failed to parse inputTokenPrice of model gpt-4o")
+}
+
+func Test_quotaPolicyToFilterAPI(t *testing.T) {
+	qp := quotaPolicyToFilterAPI(&aigv1a1.QuotaPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "myquota", Namespace: "ns"},
+		Spec: aigv1a1.QuotaPolicySpec{
+			ConsumerKey: aigv1a1.QuotaConsumerKey{Type: aigv1a1.QuotaConsumerKeyTypeJWTClaim, JWTClaim: ptr.To("sub")},
+			Budgets: []aigv1a1.QuotaBudget{
+				{Name: "tokens", Models: []string{"gpt-4o"}, Type: aigv1a1.QuotaBudgetTypeToken, Period: aigv1a1.QuotaBudgetPeriodDaily, Limit: 1000},
+				{Name: "spend", Type: aigv1a1.QuotaBudgetTypeCost, CostMetadataKey: ptr.To("cost"), Period: aigv1a1.QuotaBudgetPeriodMonthly, Limit: 50},
+			},
+		},
+	})
+	require.Equal(t, filterapi.QuotaPolicy{
+		Name:             "ns/myquota",
+		ConsumerJWTClaim: "sub",
+		Budgets: []filterapi.QuotaBudget{
+			{Name: "tokens", Models: []string{"gpt-4o"}, Type: filterapi.QuotaBudgetTypeToken, Period: filterapi.QuotaBudgetPeriodDaily, Limit: 1000},
+			{Name: "spend", Type: filterapi.QuotaBudgetTypeCost, CostMetadataKey: "cost", Period: filterapi.QuotaBudgetPeriodMonthly, Limit: 50},
+		},
+	}, qp)
+
+	qp = quotaPolicyToFilterAPI(&aigv1a1.QuotaPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "byip", Namespace: "ns"},
+		Spec:       aigv1a1.QuotaPolicySpec{ConsumerKey: aigv1a1.QuotaConsumerKey{Type: aigv1a1.QuotaConsumerKeyTypeClientIP}},
+	})
+	require.Equal(t, filterapi.QuotaPolicy{Name: "ns/byip", ConsumerClientIP: true}, qp)
+}
+
+func Test_authorizationToFilterAPI(t *testing.T) {
+	require.Nil(t, authorizationToFilterAPI(nil))
+	require.Equal(t, &filterapi.Authorization{
+		JWTClaim: "groups",
+		Rules: []filterapi.AuthorizationRule{
+			{ClaimValues: []string{"interns"}, Models: []string{"gpt-4o-mini*"}, MaxTokens: ptr.To[int64](1024)},
+			{ClaimValues: []string{"staff"}},
+		},
+	}, authorizationToFilterAPI(&aigv1a1.AIGatewayRouteAuthorization{
+		Claim: aigv1a1.AIGatewayRouteAuthorizationClaim{JWTClaim: "groups"},
+		Rules: []aigv1a1.AIGatewayRouteAuthorizationRule{
+			{ClaimValues: []string{"interns"}, Models: []string{"gpt-4o-mini*"}, MaxTokens: ptr.To[int64](1024)},
+			{ClaimValues: []string{"staff"}},
+		},
+	}))
+}
+
+func Test_guardrailsToFilterAPI(t *testing.T) {
+	g, err := guardrailsToFilterAPI(nil)
+	require.NoError(t, err)
+	require.Nil(t, g)
+
+	g, err = guardrailsToFilterAPI(&aigv1a1.AIGatewayRouteGuardrails{
+		PII: &aigv1a1.PIIGuardrail{
+			Detectors: []aigv1a1.PIIDetector{
+				{Type: aigv1a1.PIIDetectorTypeEmail},
+				{Type: aigv1a1.PIIDetectorTypeCustom, Custom: &aigv1a1.PIICustomDetector{
+					Name: "EMPLOYEE_ID", Pattern: `E\d{6}`, Validator: ptr.To(aigv1a1.PIIValidatorLuhn),
+				}},
+			},
+		},
+		Secrets: &aigv1a1.SecretGuardrail{
+			Action: aigv1a1.SecretActionRedact,
+			Detectors: []aigv1a1.SecretDetector{
+				{Type: aigv1a1.SecretDetectorTypeGitHubToken},
+				{Type: aigv1a1.SecretDetectorTypeCustom, Custom: &aigv1a1.SecretCustomDetector{
+					Name: "ACME_TOKEN", Pattern: `acme_[a-z0-9]{32}`, MinEntropy: ptr.To("3.5"),
+				}},
+			},
+			Phases: []aigv1a1.SecretGuardrailPhase{aigv1a1.SecretGuardrailPhaseResponse},
+		},
+		External: []aigv1a1.ExternalGuardrail{
+			{Name: "defaults", Endpoint: "http://classifier:8080/check"},
+			{
+				Name: "jailbreak", Protocol: aigv1a1.ExternalGuardrailProtocolGRPC, Endpoint: "classifier:9090",
+				Phases:      []aigv1a1.ExternalGuardrailPhase{aigv1a1.ExternalGuardrailPhaseRequest},
+				Timeout:     ptr.To[gwapiv1.Duration]("250ms"),
+				FailureMode: aigv1a1.ExternalGuardrailFailOpen,
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &filterapi.Guardrails{
+		PII: &filterapi.PIIGuardrail{
+			Action: filterapi.PIIActionMask,
+			Detectors: []filterapi.PIIDetector{
+				{Type: filterapi.PIIDetectorTypeEmail},
+				{Type: filterapi.PIIDetectorTypeCustom, Name: "EMPLOYEE_ID", Pattern: `E\d{6}`, Validator: filterapi.PIIValidatorLuhn},
+			},
+		},
+		Secrets: &filterapi.SecretGuardrail{
+			Action: filterapi.SecretActionRedact,
+			Detectors: []filterapi.SecretDetector{
+				{Type: filterapi.SecretDetectorTypeGitHubToken},
+				{Type: filterapi.SecretDetectorTypeCustom, Name: "ACME_TOKEN", Pattern: `acme_[a-z0-9]{32}`, MinEntropy: 3.5},
+			},
+			Response: true,
+		},
+		External: []filterapi.ExternalGuardrail{
+			{
+				Name: "defaults", Protocol: filterapi.ExternalGuardrailProtocolHTTP, Endpoint: "http://classifier:8080/check",
+				Request: true, Response: true, Timeout: time.Second,
+			},
+			{
+				Name: "jailbreak", Protocol: filterapi.ExternalGuardrailProtocolGRPC, Endpoint: "classifier:9090",
+				Request: true, Timeout: 250 * time.Millisecond, FailOpen: true,
+			},
+		},
+	}, g)
+
+	_, err = guardrailsToFilterAPI(&aigv1a1.AIGatewayRouteGuardrails{External: []aigv1a1.ExternalGuardrail{
+		{Name: "broken", Endpoint: "http://classifier:8080/check", Timeout: ptr.To[gwapiv1.Duration]("foo")},
+	}})
+	require.ErrorContains(t, err, "failed to parse timeout of external guardrail broken")
+
+	g, err = guardrailsToFilterAPI(&aigv1a1.AIGatewayRouteGuardrails{Secrets: &aigv1a1.SecretGuardrail{}})
+	require.NoError(t, err)
+	require.Equal(t, &filterapi.SecretGuardrail{Action: filterapi.SecretActionBlock, Request: true, Response: true}, g.Secrets)
+}
+
+func Test_requestLimitsToFilterAPI(t *testing.T) {
+	require.Nil(t, requestLimitsToFilterAPI(nil))
+	require.Equal(t, &filterapi.RequestLimits{}, requestLimitsToFilterAPI(&aigv1a1.AIGatewayRouteRequestLimits{}))
+	require.Equal(t, &filterapi.RequestLimits{
+		Clamp:               true,
+		MaxBodyBytes:        1 << 20,
+		MaxPromptBytes:      1 << 16,
+		MaxMessages:         50,
+		MaxImages:           ptr.To(0),
+		MaxTokens:           4096,
+		MaxN:                1,
+		ForbiddenParameters: []string{"logprobs"},
+	}, requestLimitsToFilterAPI(&aigv1a1.AIGatewayRouteRequestLimits{
+		Mode:                aigv1a1.RequestLimitsModeClamp,
+		MaxBodyBytes:        ptr.To[int64](1 << 20),
+		MaxPromptBytes:      ptr.To[int64](1 << 16),
+		MaxMessages:         ptr.To[int32](50),
+		MaxImages:           ptr.To[int32](0),
+		MaxTokens:           ptr.To[int64](4096),
+		MaxN:                ptr.To[int32](1),
+		ForbiddenParameters: []string{"logprobs"},
+	}))
+}
+
+func Test_toolPolicyToFilterAPI(t *testing.T) {
+	require.Nil(t, toolPolicyToFilterAPI(nil))
+	require.Equal(t, &filterapi.ToolPolicy{}, toolPolicyToFilterAPI(&aigv1a1.AIGatewayRouteToolPolicy{
+		ResponseAction: aigv1a1.ToolPolicyResponseActionReject,
+	}))
+	require.Equal(t, &filterapi.ToolPolicy{
+		AllowedTools:           []string{"search_*"},
+		DeniedTools:            []string{"search_internal"},
+		Arguments:              []filterapi.ToolArgumentsSchema{{Tool: "search_*", Schema: []byte(`{"type":"object"}`)}},
+		StripResponseToolCalls: true,
+	}, toolPolicyToFilterAPI(&aigv1a1.AIGatewayRouteToolPolicy{
+		AllowedTools: []string{"search_*"},
+		DeniedTools:  []string{"search_internal"},
+		Arguments: []aigv1a1.ToolArgumentsSchema{
+			{Tool: "search_*", Schema: apiextensionsv1.JSON{Raw: []byte(`{"type":"object"}`)}},
+		},
+		ResponseAction: aigv1a1.ToolPolicyResponseActionStrip,
+	}))
+}
+
+func Test_auditLogToFilterAPI(t *testing.T) {
+	require.Nil(t, auditLogToFilterAPI(nil))
+	require.Equal(t, &filterapi.AuditLog{Percentage: 100, MaxBodyBytes: 65536}, auditLogToFilterAPI(&aigv1a1.AIGatewayRouteAuditLog{}))
+	require.Equal(t, &filterapi.AuditLog{
+		Percentage:     10,
+		RedactedFields: []string{"messages.*.content"},
+		MaxBodyBytes:   1024,
+	}, auditLogToFilterAPI(&aigv1a1.AIGatewayRouteAuditLog{
+		Percentage:     ptr.To[int32](10),
+		RedactedFields: []string{"messages.*.content"},
+		MaxBodyBytes:   ptr.To[int32](1024),
+	}))
+}
+
+func Test_captureToFilterAPI(t *testing.T) {
+	require.Nil(t, captureToFilterAPI(nil))
+	require.Equal(t, &filterapi.Capture{HeaderOnly: true}, captureToFilterAPI(&aigv1a1.AIGatewayRouteCapture{}))
+	require.Equal(t, &filterapi.Capture{HeaderOnly: true},
+		captureToFilterAPI(&aigv1a1.AIGatewayRouteCapture{Mode: aigv1a1.AIGatewayRouteCaptureModeHeader}))
+	require.Equal(t, &filterapi.Capture{},
+		captureToFilterAPI(&aigv1a1.AIGatewayRouteCapture{Mode: aigv1a1.AIGatewayRouteCaptureModeAlways}))
+	require.Equal(t, &filterapi.Capture{HeaderOnly: true, IncludeOriginalRequest: true},
+		captureToFilterAPI(&aigv1a1.AIGatewayRouteCapture{IncludeOriginalRequest: true}))
+}
+
+func Test_responseCacheToFilterAPI(t *testing.T) {
+	rc, err := responseCacheToFilterAPI(nil)
+	require.NoError(t, err)
+	require.Nil(t, rc)
+
+	rc, err = responseCacheToFilterAPI(&aigv1a1.AIGatewayRouteResponseCache{})
+	require.NoError(t, err)
+	require.Equal(t, &filterapi.ResponseCache{TTL: 5 * time.Minute, MaxEntryBytes: 1048576}, rc)
+
+	rc, err = responseCacheToFilterAPI(&aigv1a1.AIGatewayRouteResponseCache{
+		TTL:           ptr.To(gwapiv1.Duration("1h")),
+		MaxEntryBytes: ptr.To[int32](1024),
+		Scope:         &aigv1a1.AIGatewayRouteResponseCacheScope{JWTClaim: ptr.To("sub")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &filterapi.ResponseCache{TTL: time.Hour, MaxEntryBytes: 1024, ConsumerJWTClaim: "sub"}, rc)
+
+	_, err = responseCacheToFilterAPI(&aigv1a1.AIGatewayRouteResponseCache{TTL: ptr.To(gwapiv1.Duration("invalid"))})
+	require.ErrorContains(t, err, "failed to parse ttl")
+
+	t.Run("semantic", func(t *testing.T) {
+		rc, err := responseCacheToFilterAPI(&aigv1a1.AIGatewayRouteResponseCache{
+			Semantic: &aigv1a1.AIGatewayRouteSemanticCache{EmbeddingModel: "text-embedding-3-small"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &filterapi.SemanticCache{
+			EmbeddingModel:      "text-embedding-3-small",
+			Endpoint:            "http://127.0.0.1:10080/v1/embeddings",
+			SimilarityThreshold: 0.95,
+			MaxEntries:          1000,
+			Timeout:             time.Second,
+		}, rc.Semantic)
+
+		rc, err = responseCacheToFilterAPI(&aigv1a1.AIGatewayRouteResponseCache{
+			Semantic: &aigv1a1.AIGatewayRouteSemanticCache{
+				EmbeddingModel:      "text-embedding-3-small",
+				Endpoint:            ptr.To("http://127.0.0.1:18080/v1/embeddings"),
+				SimilarityThreshold: ptr.To("0.9"),
+				MaxEntries:          ptr.To[int32](10),
+				Timeout:             ptr.To(gwapiv1.Duration("500ms")),
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &filterapi.SemanticCache{
+			EmbeddingModel:      "text-embedding-3-small",
+			Endpoint:            "http://127.0.0.1:18080/v1/embeddings",
+			SimilarityThreshold: 0.9,
+			MaxEntries:          10,
+			Timeout:             500 * time.Millisecond,
+		}, rc.Semantic)
+
+		_, err = responseCacheToFilterAPI(&aigv1a1.AIGatewayRouteResponseCache{
+			Semantic: &aigv1a1.AIGatewayRouteSemanticCache{SimilarityThreshold: ptr.To("high")},
+		})
+		require.ErrorContains(t, err, "failed to parse similarity threshold")
+	})
+}
+
+func Test_metricAttributesToFilterAPI(t *testing.T) {
+	require.Nil(t, metricAttributesToFilterAPI(nil))
+	require.Equal(t, []filterapi.MetricAttribute{
+		{Name: "team", Header: "x-team-id", AllowedValues: []string{"a", "b"}, MaxValues: 100},
+		{Name: "api_key", MetadataNamespace: "envoy.filters.http.jwt_authn", MetadataKey: "sub", MaxValues: 10, Hash: true},
+	}, metricAttributesToFilterAPI([]aigv1a1.AIGatewayRouteMetricAttribute{
+		{Name: "team", Header: ptr.To("x-team-id"), AllowedValues: []string{"a", "b"}},
+		{
+			Name:      "api_key",
+			Metadata:  &aigv1a1.AIGatewayRouteMetricAttributeMetadata{Namespace: "envoy.filters.http.jwt_authn", Key: "sub"},
+			MaxValues: ptr.To[int32](10),
+			Hash:      true,
+		},
+	}))
+}
+
+func Test_requestMetadataNamespaces(t *testing.T) {
+	require.Equal(t, []string{"envoy.filters.http.jwt_authn"}, requestMetadataNamespaces([]aigv1a1.AIGatewayRoute{{}}))
+	attr := func(namespace string) aigv1a1.AIGatewayRouteMetricAttribute {
+		return aigv1a1.AIGatewayRouteMetricAttribute{Metadata: &aigv1a1.AIGatewayRouteMetricAttributeMetadata{Namespace: namespace}}
+	}
+	require.Equal(t, []string{"a", "b", "envoy.filters.http.jwt_authn"}, requestMetadataNamespaces([]aigv1a1.AIGatewayRoute{
+		{Spec: aigv1a1.AIGatewayRouteSpec{MetricAttributes: []aigv1a1.AIGatewayRouteMetricAttribute{
+			attr("b"), {Header: ptr.To("x-team-id")},
+		}}},
+		{Spec: aigv1a1.AIGatewayRouteSpec{MetricAttributes: []aigv1a1.AIGatewayRouteMetricAttribute{attr("a"), attr("b"), attr("envoy.filters.http.jwt_authn")}}},
+	}))
+}
+
+func Test_hedgePolicyToFilterAPI(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		hp, err := hedgePolicyToFilterAPI(&aigv1a1.AIGatewayRouteRuleHedgePolicy{
+			FirstResponseTimeout: "1m",
+			MaxHedgedRequests:    ptr.To[int32](3),
+		})
+		require.NoError(t, err)
+		require.Equal(t, &filterapi.HedgePolicy{FirstResponseTimeout: time.Minute, MaxHedgedRequests: 3}, hp)
+	})
+	t.Run("invalid timeout", func(t *testing.T) {
+		_, err := hedgePolicyToFilterAPI(&aigv1a1.AIGatewayRouteRuleHedgePolicy{FirstResponseTimeout: "foo"})
+		require.ErrorContains(t, err, "failed to parse first response timeout")
+	})
+}
+
+func Test_experimentToFilterAPI(t *testing.T) {
+	require.Nil(t, experimentToFilterAPI(&aigv1a1.AIGatewayRoute{Spec: aigv1a1.AIGatewayRouteSpec{Rules: []aigv1a1.AIGatewayRouteRule{{}}}}, 0))
+	exp := experimentToFilterAPI(&aigv1a1.AIGatewayRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "route", Namespace: "ns"},
+		Spec: aigv1a1.AIGatewayRouteSpec{Rules: []aigv1a1.AIGatewayRouteRule{{}, {
+			BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{
+				{Name: "control"},
+				{Name: "treatment", Weight: ptr.To[int32](3)},
+				// The same backend referenced multiple times is a distinct variant.
+				{Name: "treatment", ModelNameOverride: "other"},
+				{Name: "fallback", Priority: ptr.To[uint32](1)},
+			},
+			Experiment: &aigv1a1.AIGatewayRouteRuleExperiment{
+				Name:    "exp",
+				Subject: aigv1a1.AIGatewayRouteRuleExperimentSubject{JWTClaim: ptr.To("sub")},
+			},
+		}}},
+	}, 1)
+	require.Equal(t, &filterapi.Experiment{
+		Name:            "exp",
+		SubjectJWTClaim: "sub",
+		Variants: []filterapi.ExperimentVariant{
+			{Name: "control", Weight: 1, Key: "ns/control/route/route/rule/1/ref/0"},
+			{Name: "treatment", Weight: 3, Key: "ns/treatment/route/route/rule/1/ref/1"},
+			{Name: "treatment", Weight: 1, Key: "ns/treatment/route/route/rule/1/ref/2"},
+		},
+	}, exp)
+}
+
+func Test_concurrencyLimitToFilterAPI(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		cl, err := concurrencyLimitToFilterAPI("ns", "backend", &aigv1a1.AIServiceBackendConcurrencyLimit{MaxInFlightRequests: 8})
+		require.NoError(t, err)
+		require.Equal(t, &filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 8, QueueTimeout: 10 * time.Second}, cl)
+	})
+	t.Run("priority", func(t *testing.T) {
+		cl, err := concurrencyLimitToFilterAPI("ns", "backend", &aigv1a1.AIServiceBackendConcurrencyLimit{
+			MaxInFlightRequests: 8,
+			QueueTimeout:        ptr.To[gwapiv1.Duration]("0s"),
+			Priority: &aigv1a1.AIServiceBackendConcurrencyPriority{
+				JWTClaim: ptr.To("tier"),
+				Classes:  []string{"gold", "silver"},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &filterapi.ConcurrencyLimit{
+			Key:                 "ns/backend",
+			MaxInFlightRequests: 8,
+			PriorityJWTClaim:    "tier",
+			PriorityClasses:     []string{"gold", "silver"},
+		}, cl)
+	})
+	t.Run("invalid timeout", func(t *testing.T) {
+		_, err := concurrencyLimitToFilterAPI("ns", "backend", &aigv1a1.AIServiceBackendConcurrencyLimit{
+			QueueTimeout: ptr.To[gwapiv1.Duration]("foo"),
+		})
+		require.ErrorContains(t, err, "failed to parse queue timeout")
+	})
+}
+
 func TestGatewayController_bspToFilterAPIBackendAuth(t *testing.T) {
 	fakeClient := requireNewFakeClientWithIndexes(t)
 	kube := fake2.NewClientset()
@@ -0,0 +1,94 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package controller
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	aigv1a1 "github.com/envoyproxy/ai-gateway/api/v1alpha1"
+)
+
+// PricingCatalogController implements [reconcile.TypedReconciler] for [aigv1a1.PricingCatalog].
+//
+// The prices are rendered into the filter config of the targeted Gateways, so this only propagates the changes
+// to the Gateway controller.
+//
+// Exported for testing purposes.
+type PricingCatalogController struct {
+	client client.Client
+	kube   kubernetes.Interface
+	logger logr.Logger
+	// gatewayEventChan is a channel to send events to the gateway controller.
+	gatewayEventChan chan event.GenericEvent
+}
+
+// NewPricingCatalogController creates a new [reconcile.TypedReconciler] for [aigv1a1.PricingCatalog].
+func NewPricingCatalogController(client client.Client, kube kubernetes.Interface, logger logr.Logger, gatewayEventChan chan event.GenericEvent) *PricingCatalogController {
+	return &PricingCatalogController{
+		client:           client,
+		kube:             kube,
+		logger:           logger,
+		gatewayEventChan: gatewayEventChan,
+	}
+}
+
+// Reconcile implements the [reconcile.TypedReconciler] for [aigv1a1.PricingCatalog].
+func (c *PricingCatalogController) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	var pricingCatalog aigv1a1.PricingCatalog
+	if err := c.client.Get(ctx, req.NamespacedName, &pricingCatalog); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			c.logger.Info("Deleting PricingCatalog",
+				"namespace", req.Namespace, "name", req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	c.logger.Info("Reconciling PricingCatalog", "namespace", req.Namespace, "name", req.Name)
+	if handleFinalizer(ctx, c.client, c.logger, &pricingCatalog, c.syncGateways) { // Propagate the PricingCatalog deletion to the Gateways.
+		return ctrl.Result{}, nil
+	}
+	if err := c.syncGateways(ctx, &pricingCatalog); err != nil {
+		c.logger.Error(err, "failed to sync PricingCatalog")
+		c.updatePricingCatalogStatus(ctx, &pricingCatalog, aigv1a1.ConditionTypeNotAccepted, err.Error())
+		return ctrl.Result{}, err
+	}
+	c.updatePricingCatalogStatus(ctx, &pricingCatalog, aigv1a1.ConditionTypeAccepted, "PricingCatalog reconciled successfully")
+	return ctrl.Result{}, nil
+}
+
+// syncGateways synchronizes the Gateways targeted by the PricingCatalog by sending events to the gateway controller.
+func (c *PricingCatalogController) syncGateways(ctx context.Context, pricingCatalog *aigv1a1.PricingCatalog) error {
+	for _, ref := range pricingCatalog.Spec.TargetRefs {
+		var gw gwapiv1.Gateway
+		if err := c.client.Get(ctx, client.ObjectKey{Name: string(ref.Name), Namespace: pricingCatalog.Namespace}, &gw); err != nil {
+			if apierrors.IsNotFound(err) {
+				c.logger.Info("Gateway not found", "namespace", pricingCatalog.Namespace, "name", ref.Name)
+				continue
+			}
+			return err
+		}
+		c.logger.Info("syncing Gateway", "namespace", gw.Namespace, "name", gw.Name)
+		c.gatewayEventChan <- event.GenericEvent{Object: &gw}
+	}
+	return nil
+}
+
+// updatePricingCatalogStatus updates the status of the PricingCatalog.
+func (c *PricingCatalogController) updatePricingCatalogStatus(ctx context.Context, pricingCatalog *aigv1a1.PricingCatalog, conditionType string, message string) {
+	pricingCatalog.Status.Conditions = newConditions(conditionType, message)
+	if err := c.client.Status().Update(ctx, pricingCatalog); err != nil {
+		c.logger.Error(err, "failed to update PricingCatalog status")
+	}
+}
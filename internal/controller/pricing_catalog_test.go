@@ -0,0 +1,90 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	fake2 "k8s.io/client-go/kubernetes/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gwapiv1a2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	aigv1a1 "github.com/envoyproxy/ai-gateway/api/v1alpha1"
+	internaltesting "github.com/envoyproxy/ai-gateway/internal/testing"
+)
+
+func TestPricingCatalogController_Reconcile(t *testing.T) {
+	fakeClient := requireNewFakeClientWithIndexes(t)
+	eventChan := internaltesting.NewControllerEventChan[*gwapiv1.Gateway]()
+	c := NewPricingCatalogController(fakeClient, fake2.NewClientset(), ctrl.Log, eventChan.Ch)
+
+	gw := &gwapiv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"}}
+	require.NoError(t, fakeClient.Create(t.Context(), gw))
+	err := fakeClient.Create(t.Context(), &aigv1a1.PricingCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycatalog", Namespace: "default"},
+		Spec: aigv1a1.PricingCatalogSpec{
+			TargetRefs: []gwapiv1a2.LocalPolicyTargetReference{
+				{Name: "gw", Kind: "Gateway", Group: "gateway.networking.k8s.io"},
+				{Name: "non-existent", Kind: "Gateway", Group: "gateway.networking.k8s.io"},
+			},
+			Prices: []aigv1a1.ModelPrice{{Model: "gpt-4o", InputTokenPrice: "2.5", OutputTokenPrice: "10"}},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = c.Reconcile(t.Context(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "mycatalog"}})
+	require.NoError(t, err)
+	items := eventChan.RequireItemsEventually(t, 1)
+	require.Equal(t, "gw", items[0].Name)
+
+	var pc aigv1a1.PricingCatalog
+	require.NoError(t, fakeClient.Get(t.Context(), types.NamespacedName{Namespace: "default", Name: "mycatalog"}, &pc))
+	require.Len(t, pc.Status.Conditions, 1)
+	require.Equal(t, aigv1a1.ConditionTypeAccepted, pc.Status.Conditions[0].Type)
+	require.Equal(t, "PricingCatalog reconciled successfully", pc.Status.Conditions[0].Message)
+	require.Contains(t, pc.ObjectMeta.Finalizers, aiGatewayControllerFinalizer, "Finalizer should be set")
+
+	// Deleting the PricingCatalog should not fail even if it no longer exists.
+	require.NoError(t, fakeClient.Delete(t.Context(), &pc))
+	_, err = c.Reconcile(t.Context(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "mycatalog"}})
+	require.NoError(t, err)
+}
+
+func Test_pricingCatalogToTargetGatewayIndexFunc(t *testing.T) {
+	c := requireNewFakeClientWithIndexes(t)
+	for _, pc := range []*aigv1a1.PricingCatalog{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pc1", Namespace: "ns"},
+			Spec: aigv1a1.PricingCatalogSpec{
+				TargetRefs: []gwapiv1a2.LocalPolicyTargetReference{{Name: "gw1", Kind: "Gateway", Group: "gateway.networking.k8s.io"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pc2", Namespace: "ns"},
+			Spec: aigv1a1.PricingCatalogSpec{
+				TargetRefs: []gwapiv1a2.LocalPolicyTargetReference{
+					{Name: "gw1", Kind: "Gateway", Group: "gateway.networking.k8s.io"},
+					{Name: "gw2", Kind: "Gateway", Group: "gateway.networking.k8s.io"},
+				},
+			},
+		},
+	} {
+		require.NoError(t, c.Create(t.Context(), pc))
+	}
+
+	var list aigv1a1.PricingCatalogList
+	require.NoError(t, c.List(t.Context(), &list, client.MatchingFields{k8sClientIndexPricingCatalogToTargetGateway: "gw1.ns"}))
+	require.Len(t, list.Items, 2)
+	require.NoError(t, c.List(t.Context(), &list, client.MatchingFields{k8sClientIndexPricingCatalogToTargetGateway: "gw2.ns"}))
+	require.Len(t, list.Items, 1)
+	require.Equal(t, "pc2", list.Items[0].Name)
+}
@@ -0,0 +1,94 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package controller
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	aigv1a1 "github.com/envoyproxy/ai-gateway/api/v1alpha1"
+)
+
+// QuotaPolicyController implements [reconcile.TypedReconciler] for [aigv1a1.QuotaPolicy].
+//
+// The budgets are rendered into the filter config of the targeted Gateways, so this only propagates the changes
+// to the Gateway controller.
+//
+// Exported for testing purposes.
+type QuotaPolicyController struct {
+	client client.Client
+	kube   kubernetes.Interface
+	logger logr.Logger
+	// gatewayEventChan is a channel to send events to the gateway controller.
+	gatewayEventChan chan event.GenericEvent
+}
+
+// NewQuotaPolicyController creates a new [reconcile.TypedReconciler] for [aigv1a1.QuotaPolicy].
+func NewQuotaPolicyController(client client.Client, kube kubernetes.Interface, logger logr.Logger, gatewayEventChan chan event.GenericEvent) *QuotaPolicyController {
+	return &QuotaPolicyController{
+		client:           client,
+		kube:             kube,
+		logger:           logger,
+		gatewayEventChan: gatewayEventChan,
+	}
+}
+
+// Reconcile implements the [reconcile.TypedReconciler] for [aigv1a1.QuotaPolicy].
+func (c *QuotaPolicyController) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	var quotaPolicy aigv1a1.QuotaPolicy
+	if err := c.client.Get(ctx, req.NamespacedName, &quotaPolicy); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			c.logger.Info("Deleting QuotaPolicy",
+				"namespace", req.Namespace, "name", req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	c.logger.Info("Reconciling QuotaPolicy", "namespace", req.Namespace, "name", req.Name)
+	if handleFinalizer(ctx, c.client, c.logger, &quotaPolicy, c.syncGateways) { // Propagate the QuotaPolicy deletion to the Gateways.
+		return ctrl.Result{}, nil
+	}
+	if err := c.syncGateways(ctx, &quotaPolicy); err != nil {
+		c.logger.Error(err, "failed to sync QuotaPolicy")
+		c.updateQuotaPolicyStatus(ctx, &quotaPolicy, aigv1a1.ConditionTypeNotAccepted, err.Error())
+		return ctrl.Result{}, err
+	}
+	c.updateQuotaPolicyStatus(ctx, &quotaPolicy, aigv1a1.ConditionTypeAccepted, "QuotaPolicy reconciled successfully")
+	return ctrl.Result{}, nil
+}
+
+// syncGateways synchronizes the Gateways targeted by the QuotaPolicy by sending events to the gateway controller.
+func (c *QuotaPolicyController) syncGateways(ctx context.Context, quotaPolicy *aigv1a1.QuotaPolicy) error {
+	for _, ref := range quotaPolicy.Spec.TargetRefs {
+		var gw gwapiv1.Gateway
+		if err := c.client.Get(ctx, client.ObjectKey{Name: string(ref.Name), Namespace: quotaPolicy.Namespace}, &gw); err != nil {
+			if apierrors.IsNotFound(err) {
+				c.logger.Info("Gateway not found", "namespace", quotaPolicy.Namespace, "name", ref.Name)
+				continue
+			}
+			return err
+		}
+		c.logger.Info("syncing Gateway", "namespace", gw.Namespace, "name", gw.Name)
+		c.gatewayEventChan <- event.GenericEvent{Object: &gw}
+	}
+	return nil
+}
+
+// updateQuotaPolicyStatus updates the status of the QuotaPolicy.
+func (c *QuotaPolicyController) updateQuotaPolicyStatus(ctx context.Context, quotaPolicy *aigv1a1.QuotaPolicy, conditionType string, message string) {
+	quotaPolicy.Status.Conditions = newConditions(conditionType, message)
+	if err := c.client.Status().Update(ctx, quotaPolicy); err != nil {
+		c.logger.Error(err, "failed to update QuotaPolicy status")
+	}
+}
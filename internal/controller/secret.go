@@ -27,17 +27,19 @@ type secretController struct {
 	kubeClient                     kubernetes.Interface
 	logger                         logr.Logger
 	backendSecurityPolicyEventChan chan event.GenericEvent
+	consumerKeyEventChan           chan event.GenericEvent
 }
 
 // NewSecretController creates a new reconcile.TypedReconciler[reconcile.Request] for corev1.Secret.
 func NewSecretController(client client.Client, kubeClient kubernetes.Interface,
-	logger logr.Logger, backendSecurityPolicyEventChan chan event.GenericEvent,
+	logger logr.Logger, backendSecurityPolicyEventChan, consumerKeyEventChan chan event.GenericEvent,
 ) reconcile.TypedReconciler[reconcile.Request] {
 	return &secretController{
 		client:                         client,
 		kubeClient:                     kubeClient,
 		logger:                         logger,
 		backendSecurityPolicyEventChan: backendSecurityPolicyEventChan,
+		consumerKeyEventChan:           consumerKeyEventChan,
 	}
 }
 
@@ -46,7 +48,8 @@ func (c *secretController) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	var secret corev1.Secret
 	if err := c.client.Get(ctx, req.NamespacedName, &secret); err != nil {
 		if apierrors.IsNotFound(err) {
-			return ctrl.Result{}, nil
+			// The deletion of the Secret revokes the ConsumerKeys referencing it.
+			return ctrl.Result{}, c.syncConsumerKeys(ctx, req.Namespace, req.Name)
 		}
 		return ctrl.Result{}, err
 	}
@@ -74,5 +77,25 @@ func (c *secretController) syncSecret(ctx context.Context, namespace, name strin
 			"namespace", backendSecurityPolicy.Namespace, "name", backendSecurityPolicy.Name)
 		c.backendSecurityPolicyEventChan <- event.GenericEvent{Object: backendSecurityPolicy}
 	}
+	return c.syncConsumerKeys(ctx, namespace, name)
+}
+
+// syncConsumerKeys syncs the ConsumerKeys referencing the given secret.
+func (c *secretController) syncConsumerKeys(ctx context.Context, namespace, name string) error {
+	var consumerKeys aigv1a1.ConsumerKeyList
+	err := c.client.List(ctx, &consumerKeys,
+		client.MatchingFields{
+			k8sClientIndexSecretToReferencingConsumerKey: fmt.Sprintf("%s.%s", name, namespace),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to list ConsumerKeyList: %w", err)
+	}
+	for i := range consumerKeys.Items {
+		consumerKey := &consumerKeys.Items[i]
+		c.logger.Info("Syncing ConsumerKey",
+			"namespace", consumerKey.Namespace, "name", consumerKey.Name)
+		c.consumerKeyEventChan <- event.GenericEvent{Object: consumerKey}
+	}
 	return nil
 }
@@ -24,8 +24,9 @@ import (
 
 func TestSecretController_Reconcile(t *testing.T) {
 	eventCh := internaltesting.NewControllerEventChan[*aigv1a1.BackendSecurityPolicy]()
+	consumerKeyEventCh := internaltesting.NewControllerEventChan[*aigv1a1.ConsumerKey]()
 	fakeClient := requireNewFakeClientWithIndexes(t)
-	c := NewSecretController(fakeClient, fake2.NewClientset(), ctrl.Log, eventCh.Ch)
+	c := NewSecretController(fakeClient, fake2.NewClientset(), ctrl.Log, eventCh.Ch, consumerKeyEventCh.Ch)
 
 	err := fakeClient.Create(t.Context(), &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{Name: "mysecret", Namespace: "default"},
@@ -69,8 +70,26 @@ func TestSecretController_Reconcile(t *testing.T) {
 		return originals[i].Name < originals[j].Name
 	})
 	require.Equal(t, originals, actual)
+	require.Empty(t, consumerKeyEventCh.Ch)
 
-	// Test the case where the Secret is being deleted.
+	// Create a ConsumerKey that references the secret.
+	consumerKey := &aigv1a1.ConsumerKey{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "default"},
+		Spec: aigv1a1.ConsumerKeySpec{
+			Consumer:  "team-a",
+			SecretRef: &gwapiv1.SecretObjectReference{Name: "mysecret"},
+		},
+	}
+	require.NoError(t, fakeClient.Create(t.Context(), consumerKey))
+	_, err = c.Reconcile(t.Context(), reconcile.Request{NamespacedName: types.NamespacedName{
+		Namespace: "default", Name: "mysecret",
+	}})
+	require.NoError(t, err)
+	require.Len(t, eventCh.RequireItemsEventually(t, len(originals)), len(originals))
+	keys := consumerKeyEventCh.RequireItemsEventually(t, 1)
+	require.Equal(t, "team-a", keys[0].Name)
+
+	// Test the case where the Secret is being deleted, which revokes the ConsumerKey.
 	err = fakeClient.Delete(t.Context(), &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{Name: "mysecret", Namespace: "default"},
 	})
@@ -79,4 +98,6 @@ func TestSecretController_Reconcile(t *testing.T) {
 		Namespace: "default", Name: "mysecret",
 	}})
 	require.NoError(t, err)
+	keys = consumerKeyEventCh.RequireItemsEventually(t, 1)
+	require.Equal(t, "team-a", keys[0].Name)
 }
@@ -8,6 +8,7 @@ package extensionserver
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -17,10 +18,12 @@ import (
 	mutation_rulesv3 "github.com/envoyproxy/go-control-plane/envoy/config/common/mutation_rules/v3"
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	extprocv3http "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
 	header_mutationv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/header_mutation/v3"
 	upstream_codecv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/upstream_codec/v3"
 	httpconnectionmanagerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	previous_prioritiesv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/retry/priority/previous_priorities/v3"
 	httpv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
 	"github.com/go-logr/logr"
 	"google.golang.org/grpc/codes"
@@ -31,6 +34,7 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	aigv1a1 "github.com/envoyproxy/ai-gateway/api/v1alpha1"
@@ -143,6 +147,10 @@ func (s *Server) PostTranslateModify(_ context.Context, req *egextension.PostTra
 //     https://github.com/envoyproxy/gateway/issues/5523 as well as the endpoint set level metadata is supported in the extproc.
 //   - Insert the upstream external processor filter to the list of filters. https://github.com/envoyproxy/gateway/issues/5881
 //   - Insert the header mutation filter to the list of filters.
+//   - Configures the consistent hashing load balancing when the prefix cache affinity is enabled on the rule.
+//   - Configures the subset load balancing on the experiment variants when the experiment is configured on the rule.
+//   - Does the same for the mirror cluster of the rule with the shadow policy, so that the mirrored requests are
+//     translated for the shadow backend and their responses are compared with the primary ones.
 //
 // The result will look almost similar to envoy.yaml in the tests/extproc tests. Please refer to the config file for more details.
 func (s *Server) maybeModifyCluster(cluster *clusterv3.Cluster) {
@@ -155,7 +163,8 @@ func (s *Server) maybeModifyCluster(cluster *clusterv3.Cluster) {
 	}
 	httpRouteNamespace := parts[1]
 	httpRouteName := parts[2]
-	httpRouteRuleIndexStr := parts[4]
+	// The mirror cluster is in the format "httproute/<namespace>/<name>/rule/<index_of_rule>-mirror-<index_of_filter>".
+	httpRouteRuleIndexStr, _, isMirror := strings.Cut(parts[4], "-mirror-")
 	httpRouteRuleIndex, err := strconv.Atoi(httpRouteRuleIndexStr)
 	if err != nil {
 		s.log.Error(err, "failed to parse HTTPRoute rule index",
@@ -181,6 +190,14 @@ func (s *Server) maybeModifyCluster(cluster *clusterv3.Cluster) {
 		s.log.Info("LoadAssignment is nil", "cluster_name", cluster.Name)
 		return
 	}
+	if isMirror {
+		if httpRouteRule.ShadowPolicy == nil {
+			s.log.Info("mirror cluster for the rule without shadow policy", "cluster_name", cluster.Name)
+			return
+		}
+		s.maybeModifyShadowCluster(cluster, &aigwRoute, httpRouteRuleIndex)
+		return
+	}
 	if len(cluster.LoadAssignment.Endpoints) != len(httpRouteRule.BackendRefs) {
 		s.log.Info("LoadAssignment endpoints length does not match backend refs length",
 			"cluster_name", cluster.Name, "endpoints_length", len(cluster.LoadAssignment.Endpoints), "backend_refs_length", len(httpRouteRule.BackendRefs))
@@ -194,29 +211,91 @@ func (s *Server) maybeModifyCluster(cluster *clusterv3.Cluster) {
 		if backendRef.Priority != nil {
 			endpoints.Priority = *backendRef.Priority
 		}
-		// We populate the same metadata for all endpoints in the LoadAssignment.
-		// This is because currently, an extproc cannot retrieve the endpoint set level metadata.
-		for _, endpoint := range endpoints.LbEndpoints {
-			if endpoint.Metadata == nil {
-				endpoint.Metadata = &corev3.Metadata{}
-			}
-			if endpoint.Metadata.FilterMetadata == nil {
-				endpoint.Metadata.FilterMetadata = make(map[string]*structpb.Struct)
-			}
-			m, ok := endpoint.Metadata.FilterMetadata[internalapi.InternalEndpointMetadataNamespace]
-			if !ok {
-				m = &structpb.Struct{}
-				endpoint.Metadata.FilterMetadata[internalapi.InternalEndpointMetadataNamespace] = m
-			}
-			if m.Fields == nil {
-				m.Fields = make(map[string]*structpb.Value)
-			}
-			m.Fields[internalapi.InternalMetadataBackendNameKey] = structpb.NewStringValue(
-				internalapi.PerRouteRuleRefBackendName(namespace, name, aigwRoute.Name, httpRouteRuleIndex, i),
-			)
+		populateBackendNameMetadata(endpoints,
+			internalapi.PerRouteRuleRefBackendName(namespace, name, aigwRoute.Name, httpRouteRuleIndex, i))
+	}
+	if httpRouteRule.Experiment != nil {
+		applyExperimentLbSubset(cluster, &aigwRoute, httpRouteRuleIndex)
+	}
+
+	var prefixCacheAffinity *aigv1a1.PrefixCacheAffinity
+	if lb := httpRouteRule.LoadBalancing; lb != nil && lb.PrefixCacheAffinity != nil {
+		prefixCacheAffinity = lb.PrefixCacheAffinity
+		applyPrefixCacheAffinityLbPolicy(cluster, prefixCacheAffinity)
+	}
+
+	mode := &extprocv3http.ProcessingMode{
+		RequestHeaderMode: extprocv3http.ProcessingMode_SEND,
+		// At the upstream filter, it can access the original body in its memory, so it can perform the translation
+		// as well as the authentication at the request headers. Hence, there's no need to send the request body to the extproc.
+		RequestBodyMode: extprocv3http.ProcessingMode_NONE,
+		// Response will be handled at the router filter level so that we could avoid the shenanigans around the retry+the upstream filter.
+		ResponseHeaderMode: extprocv3http.ProcessingMode_SKIP,
+		ResponseBodyMode:   extprocv3http.ProcessingMode_NONE,
+	}
+	if httpRouteRule.HedgePolicy != nil {
+		// When hedged, multiple attempts are in flight concurrently, so the upstream filter needs to see the response headers
+		// to tell the router filter which attempt won the race.
+		mode.ResponseHeaderMode = extprocv3http.ProcessingMode_SEND
+	}
+	var requestAttributes []string
+	if prefixCacheAffinity != nil {
+		// The address of the selected endpoint is used to track the affinity hit ratio.
+		requestAttributes = append(requestAttributes, internalapi.UpstreamAddressAttribute)
+	}
+	s.insertUpstreamFilters(cluster, mode, requestAttributes)
+}
+
+// maybeModifyShadowCluster modifies the mirror cluster of the rule with the shadow policy, which consists of
+// the endpoints of the shadow backend.
+func (s *Server) maybeModifyShadowCluster(cluster *clusterv3.Cluster, aigwRoute *aigv1a1.AIGatewayRoute, ruleIndex int) {
+	sp := aigwRoute.Spec.Rules[ruleIndex].ShadowPolicy
+	if len(cluster.LoadAssignment.Endpoints) != 1 {
+		s.log.Info("LoadAssignment endpoints length of mirror cluster is not one",
+			"cluster_name", cluster.Name, "endpoints_length", len(cluster.LoadAssignment.Endpoints))
+		return
+	}
+	populateBackendNameMetadata(cluster.LoadAssignment.Endpoints[0],
+		internalapi.PerRouteRuleShadowBackendName(aigwRoute.Namespace, sp.BackendRef.Name, aigwRoute.Name, ruleIndex))
+	// The response of the mirrored request never reaches the router filter, so it is processed at the upstream
+	// filter level to be compared with the primary one. The body mode is overridden to streamed for the streaming
+	// responses by the extproc as in the router filter.
+	s.insertUpstreamFilters(cluster, &extprocv3http.ProcessingMode{
+		RequestHeaderMode:  extprocv3http.ProcessingMode_SEND,
+		RequestBodyMode:    extprocv3http.ProcessingMode_NONE,
+		ResponseHeaderMode: extprocv3http.ProcessingMode_SEND,
+		ResponseBodyMode:   extprocv3http.ProcessingMode_BUFFERED,
+	}, nil)
+}
+
+// populateBackendNameMetadata populates the backend name in the metadata of all the endpoints in the given set.
+//
+// We populate the same metadata for all endpoints in the LoadAssignment.
+// This is because currently, an extproc cannot retrieve the endpoint set level metadata.
+func populateBackendNameMetadata(endpoints *endpointv3.LocalityLbEndpoints, backendName string) {
+	for _, endpoint := range endpoints.LbEndpoints {
+		if endpoint.Metadata == nil {
+			endpoint.Metadata = &corev3.Metadata{}
+		}
+		if endpoint.Metadata.FilterMetadata == nil {
+			endpoint.Metadata.FilterMetadata = make(map[string]*structpb.Struct)
 		}
+		m, ok := endpoint.Metadata.FilterMetadata[internalapi.InternalEndpointMetadataNamespace]
+		if !ok {
+			m = &structpb.Struct{}
+			endpoint.Metadata.FilterMetadata[internalapi.InternalEndpointMetadataNamespace] = m
+		}
+		if m.Fields == nil {
+			m.Fields = make(map[string]*structpb.Value)
+		}
+		m.Fields[internalapi.InternalMetadataBackendNameKey] = structpb.NewStringValue(backendName)
 	}
+}
 
+// insertUpstreamFilters inserts the upstream external processor filter with the given processing mode as well as
+// the header mutation filter to the list of the upstream filters of the cluster.
+func (s *Server) insertUpstreamFilters(cluster *clusterv3.Cluster, mode *extprocv3http.ProcessingMode, requestAttributes []string) {
+	var err error
 	if cluster.TypedExtensionProtocolOptions == nil {
 		cluster.TypedExtensionProtocolOptions = make(map[string]*anypb.Any)
 	}
@@ -250,16 +329,8 @@ func (s *Server) maybeModifyCluster(cluster *clusterv3.Cluster) {
 		},
 	}
 	extProcConfig.AllowModeOverride = true
-	extProcConfig.RequestAttributes = []string{"xds.upstream_host_metadata"}
-	extProcConfig.ProcessingMode = &extprocv3http.ProcessingMode{
-		RequestHeaderMode: extprocv3http.ProcessingMode_SEND,
-		// At the upstream filter, it can access the original body in its memory, so it can perform the translation
-		// as well as the authentication at the request headers. Hence, there's no need to send the request body to the extproc.
-		RequestBodyMode: extprocv3http.ProcessingMode_NONE,
-		// Response will be handled at the router filter level so that we could avoid the shenanigans around the retry+the upstream filter.
-		ResponseHeaderMode: extprocv3http.ProcessingMode_SKIP,
-		ResponseBodyMode:   extprocv3http.ProcessingMode_NONE,
-	}
+	extProcConfig.RequestAttributes = append([]string{"xds.upstream_host_metadata"}, requestAttributes...)
+	extProcConfig.ProcessingMode = mode
 	extProcConfig.GrpcService = &corev3.GrpcService{
 		TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
 			EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{
@@ -327,6 +398,241 @@ func mustToAny(msg proto.Message) *anypb.Any {
 }
 
 // PostVirtualHostModify allows an extension to modify the virtual hosts in the xDS config.
-func (s *Server) PostVirtualHostModify(context.Context, *egextension.PostVirtualHostModifyRequest) (*egextension.PostVirtualHostModifyResponse, error) {
-	return nil, nil
+//
+// This configures the hedging, the hash policy of the prefix cache affinity, and the retry policy to spill over
+// the requests from the backends at their concurrency limit for the routes generated from the AIGatewayRoute rules.
+func (s *Server) PostVirtualHostModify(ctx context.Context, req *egextension.PostVirtualHostModifyRequest) (*egextension.PostVirtualHostModifyResponse, error) {
+	vh := req.VirtualHost
+	if vh == nil || len(vh.Routes) == 0 {
+		return nil, nil
+	}
+	aigwRoutes := make(map[client.ObjectKey]*aigv1a1.AIGatewayRoute)
+	aiServiceBackends := make(map[client.ObjectKey]*aigv1a1.AIServiceBackend)
+	var modified bool
+	for _, route := range vh.Routes {
+		action := route.GetRoute()
+		if action == nil {
+			continue
+		}
+		// The cluster name is in the format "httproute/<namespace>/<name>/rule/<index_of_rule>".
+		parts := strings.Split(action.GetCluster(), "/")
+		if len(parts) != 5 || parts[0] != "httproute" {
+			continue
+		}
+		ruleIndex, err := strconv.Atoi(parts[4])
+		if err != nil {
+			continue
+		}
+		key := client.ObjectKey{Namespace: parts[1], Name: parts[2]}
+		aigwRoute, ok := aigwRoutes[key]
+		if !ok {
+			aigwRoute = &aigv1a1.AIGatewayRoute{}
+			if err = s.k8sClient.Get(ctx, key, aigwRoute); err != nil {
+				s.log.Error(err, "failed to get AIGatewayRoute object", "namespace", key.Namespace, "name", key.Name)
+				aigwRoute = nil
+			}
+			aigwRoutes[key] = aigwRoute
+		}
+		if aigwRoute == nil || ruleIndex >= len(aigwRoute.Spec.Rules) {
+			continue
+		}
+		rule := &aigwRoute.Spec.Rules[ruleIndex]
+		if hp := rule.HedgePolicy; hp != nil {
+			if err = applyHedgePolicy(action, hp); err != nil {
+				s.log.Error(err, "failed to apply hedge policy", "route_name", route.Name)
+			} else {
+				modified = true
+			}
+		}
+		if lb := rule.LoadBalancing; lb != nil && lb.PrefixCacheAffinity != nil {
+			applyPrefixCacheAffinityHashPolicy(action)
+			modified = true
+		}
+		if fallbacks := s.concurrencySpillFallbacks(ctx, key.Namespace, rule, aiServiceBackends); fallbacks > 0 {
+			applyConcurrencySpillRetryPolicy(action, fallbacks)
+			modified = true
+		}
+	}
+	if !modified {
+		return nil, nil
+	}
+	return &egextension.PostVirtualHostModifyResponse{VirtualHost: vh}, nil
+}
+
+// applyHedgePolicy configures the route action so that Envoy issues a new request to the next priority
+// without cancelling the in-flight one when the response headers are not received within the first response timeout.
+func applyHedgePolicy(action *routev3.RouteAction, hp *aigv1a1.AIGatewayRouteRuleHedgePolicy) error {
+	timeout, err := time.ParseDuration(string(hp.FirstResponseTimeout))
+	if err != nil {
+		return fmt.Errorf("invalid first response timeout: %w", err)
+	}
+	maxHedged := uint32(1)
+	if hp.MaxHedgedRequests != nil {
+		maxHedged = uint32(*hp.MaxHedgedRequests) //nolint:gosec
+	}
+
+	action.HedgePolicy = &routev3.HedgePolicy{HedgeOnPerTryTimeout: true}
+	if action.RetryPolicy == nil {
+		action.RetryPolicy = &routev3.RetryPolicy{RetryOn: "connect-failure,reset"}
+	}
+	rp := action.RetryPolicy
+	rp.PerTryTimeout = durationpb.New(timeout)
+	if rp.NumRetries.GetValue() < maxHedged {
+		rp.NumRetries = wrapperspb.UInt32(maxHedged)
+	}
+	if rp.RetryPriority == nil {
+		// Hedged requests go to the next backend ref in the priority order.
+		rp.RetryPriority = &routev3.RetryPolicy_RetryPriority{
+			Name: "envoy.retry_priorities.previous_priorities",
+			ConfigType: &routev3.RetryPolicy_RetryPriority_TypedConfig{
+				TypedConfig: mustToAny(&previous_prioritiesv3.PreviousPrioritiesConfig{UpdateFrequency: 1}),
+			},
+		}
+	}
+	return nil
+}
+
+// concurrencySpillFallbacks returns the number of the priority levels of the backend refs of the rule to which
+// the requests can spill over from the backends with the concurrency limit. This returns zero if none of the
+// backends except the ones with the lowest priority has the concurrency limit.
+//
+// The AIServiceBackend objects are cached in the given map across the rules.
+func (s *Server) concurrencySpillFallbacks(ctx context.Context, namespace string, rule *aigv1a1.AIGatewayRouteRule,
+	cache map[client.ObjectKey]*aigv1a1.AIServiceBackend,
+) int {
+	priorities := make(map[uint32]struct{})
+	lowest := uint32(0)
+	for i := range rule.BackendRefs {
+		p := ptr.Deref(rule.BackendRefs[i].Priority, 0)
+		priorities[p] = struct{}{}
+		lowest = max(lowest, p)
+	}
+	if len(priorities) < 2 {
+		return 0
+	}
+	for i := range rule.BackendRefs {
+		ref := &rule.BackendRefs[i]
+		if ptr.Deref(ref.Priority, 0) == lowest {
+			continue
+		}
+		key := client.ObjectKey{Namespace: namespace, Name: ref.Name}
+		backend, ok := cache[key]
+		if !ok {
+			backend = &aigv1a1.AIServiceBackend{}
+			if err := s.k8sClient.Get(ctx, key, backend); err != nil {
+				s.log.Error(err, "failed to get AIServiceBackend object", "namespace", key.Namespace, "name", key.Name)
+				backend = nil
+			}
+			cache[key] = backend
+		}
+		if backend != nil && backend.Spec.ConcurrencyLimit != nil {
+			return len(priorities) - 1
+		}
+	}
+	return 0
+}
+
+// applyConcurrencySpillRetryPolicy configures the route action so that Envoy retries the request on the next priority
+// when the upstream extproc replies locally because the backend is at its concurrency limit.
+func applyConcurrencySpillRetryPolicy(action *routev3.RouteAction, fallbacks int) {
+	if action.RetryPolicy == nil {
+		action.RetryPolicy = &routev3.RetryPolicy{RetryOn: "connect-failure,reset"}
+	}
+	rp := action.RetryPolicy
+	switch {
+	case rp.RetryOn == "":
+		rp.RetryOn = "retriable-headers"
+	case !slices.Contains(strings.Split(rp.RetryOn, ","), "retriable-headers"):
+		rp.RetryOn += ",retriable-headers"
+	}
+	if !slices.ContainsFunc(rp.RetriableHeaders, func(h *routev3.HeaderMatcher) bool {
+		return h.Name == internalapi.ConcurrencySpillHeader
+	}) {
+		rp.RetriableHeaders = append(rp.RetriableHeaders, &routev3.HeaderMatcher{
+			Name:                 internalapi.ConcurrencySpillHeader,
+			HeaderMatchSpecifier: &routev3.HeaderMatcher_PresentMatch{PresentMatch: true},
+		})
+	}
+	if rp.NumRetries.GetValue() < uint32(fallbacks) { //nolint:gosec
+		rp.NumRetries = wrapperspb.UInt32(uint32(fallbacks)) //nolint:gosec
+	}
+	if rp.RetryPriority == nil {
+		rp.RetryPriority = &routev3.RetryPolicy_RetryPriority{
+			Name: "envoy.retry_priorities.previous_priorities",
+			ConfigType: &routev3.RetryPolicy_RetryPriority_TypedConfig{
+				TypedConfig: mustToAny(&previous_prioritiesv3.PreviousPrioritiesConfig{UpdateFrequency: 1}),
+			},
+		}
+	}
+}
+
+// applyPrefixCacheAffinityHashPolicy configures the route action to hash the prompt prefix key populated by the extproc.
+func applyPrefixCacheAffinityHashPolicy(action *routev3.RouteAction) {
+	for _, hp := range action.HashPolicy {
+		if hp.GetHeader().GetHeaderName() == internalapi.PrefixCacheAffinityKeyHeader {
+			return
+		}
+	}
+	action.HashPolicy = append(action.HashPolicy, &routev3.RouteAction_HashPolicy{
+		PolicySpecifier: &routev3.RouteAction_HashPolicy_Header_{
+			Header: &routev3.RouteAction_HashPolicy_Header{HeaderName: internalapi.PrefixCacheAffinityKeyHeader},
+		},
+	})
+}
+
+// applyPrefixCacheAffinityLbPolicy configures the cluster to select the endpoint with the consistent hashing
+// with the bounded load.
+func applyPrefixCacheAffinityLbPolicy(cluster *clusterv3.Cluster, pca *aigv1a1.PrefixCacheAffinity) {
+	// The typed load balancing policy takes precedence over the LbPolicy, so it needs to be cleared.
+	cluster.LoadBalancingPolicy = nil
+	cluster.LbPolicy = clusterv3.Cluster_MAGLEV
+	if cluster.CommonLbConfig == nil {
+		cluster.CommonLbConfig = &clusterv3.Cluster_CommonLbConfig{}
+	}
+	cluster.CommonLbConfig.ConsistentHashingLbConfig = &clusterv3.Cluster_CommonLbConfig_ConsistentHashingLbConfig{
+		HashBalanceFactor: wrapperspb.UInt32(uint32(ptr.Deref(pca.BoundedLoadFactor, 150))), //nolint:gosec
+	}
+}
+
+// applyExperimentLbSubset configures the subset load balancing of the cluster so that the extproc can select the
+// endpoints of the experiment variant which the end user is assigned to via the dynamic metadata.
+//
+// The primary backends are the variants, and each of their endpoints is labeled with its variant, which is the
+// per-rule name of the backend ref so that the same backend referenced multiple times is still distinguished.
+// The fallback backends with the non-zero priority are labeled with all the variants so that they remain the
+// fallbacks of every variant. The requests without the variant fall back to all the endpoints as usual.
+func applyExperimentLbSubset(cluster *clusterv3.Cluster, route *aigv1a1.AIGatewayRoute, ruleIndex int) {
+	rule := &route.Spec.Rules[ruleIndex]
+	variantKey := func(i int) string {
+		return internalapi.PerRouteRuleRefBackendName(route.Namespace, rule.BackendRefs[i].Name, route.Name, ruleIndex, i)
+	}
+	var variants []*structpb.Value
+	for i := range rule.BackendRefs {
+		if ptr.Deref(rule.BackendRefs[i].Priority, 0) == 0 {
+			variants = append(variants, structpb.NewStringValue(variantKey(i)))
+		}
+	}
+	for i, endpoints := range cluster.LoadAssignment.Endpoints {
+		backendRef := &rule.BackendRefs[i]
+		value := structpb.NewStringValue(variantKey(i))
+		if ptr.Deref(backendRef.Priority, 0) != 0 {
+			value = structpb.NewListValue(&structpb.ListValue{Values: variants})
+		}
+		for _, endpoint := range endpoints.LbEndpoints {
+			// The endpoint metadata is already populated by populateBackendNameMetadata.
+			m, ok := endpoint.Metadata.FilterMetadata[internalapi.EnvoyLBMetadataNamespace]
+			if !ok {
+				m = &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+				endpoint.Metadata.FilterMetadata[internalapi.EnvoyLBMetadataNamespace] = m
+			}
+			m.Fields[internalapi.ExperimentVariantMetadataKey] = value
+		}
+	}
+	cluster.LbSubsetConfig = &clusterv3.Cluster_LbSubsetConfig{
+		FallbackPolicy: clusterv3.Cluster_LbSubsetConfig_ANY_ENDPOINT,
+		SubsetSelectors: []*clusterv3.Cluster_LbSubsetConfig_LbSubsetSelector{
+			{Keys: []string{internalapi.ExperimentVariantMetadataKey}},
+		},
+		ListAsAny: true,
+	}
 }
@@ -7,15 +7,20 @@ package extensionserver
 
 import (
 	"bytes"
+	"fmt"
 	"log/slog"
 	"testing"
+	"time"
 
 	egextension "github.com/envoyproxy/gateway/proto/extension"
 	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	extprocv3http "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	httpv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
 	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -95,6 +100,157 @@ func TestServerPostVirtualHostModify(t *testing.T) {
 		require.Nil(t, res)
 		require.NoError(t, err)
 	})
+	t.Run("hedge policy", func(t *testing.T) {
+		c := newFakeClient()
+		err := c.Create(t.Context(), &aigv1a1.AIGatewayRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "myroute", Namespace: "ns"},
+			Spec: aigv1a1.AIGatewayRouteSpec{
+				Rules: []aigv1a1.AIGatewayRouteRule{
+					{BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "aaa"}}},
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{
+							{Name: "aaa", Priority: ptr.To[uint32](0)},
+							{Name: "bbb", Priority: ptr.To[uint32](1)},
+						},
+						HedgePolicy: &aigv1a1.AIGatewayRouteRuleHedgePolicy{
+							FirstResponseTimeout: "2s",
+							MaxHedgedRequests:    ptr.To[int32](2),
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		s := New(c, logr.Discard(), udsPath)
+		newRoute := func(cluster string) *routev3.Route {
+			return &routev3.Route{Action: &routev3.Route_Route{Route: &routev3.RouteAction{
+				ClusterSpecifier: &routev3.RouteAction_Cluster{Cluster: cluster},
+			}}}
+		}
+		t.Run("not hedged", func(t *testing.T) {
+			res, err := s.PostVirtualHostModify(t.Context(), &egextension.PostVirtualHostModifyRequest{
+				VirtualHost: &routev3.VirtualHost{Routes: []*routev3.Route{
+					newRoute("httproute/ns/myroute/rule/0"),
+					newRoute("httproute/ns/nonexistent/rule/1"),
+					newRoute("foo"),
+				}},
+			})
+			require.Nil(t, res)
+			require.NoError(t, err)
+		})
+		t.Run("hedged", func(t *testing.T) {
+			vh := &routev3.VirtualHost{Routes: []*routev3.Route{
+				newRoute("httproute/ns/myroute/rule/0"),
+				newRoute("httproute/ns/myroute/rule/1"),
+			}}
+			res, err := s.PostVirtualHostModify(t.Context(), &egextension.PostVirtualHostModifyRequest{VirtualHost: vh})
+			require.NoError(t, err)
+			require.NotNil(t, res)
+			require.Nil(t, res.VirtualHost.Routes[0].GetRoute().HedgePolicy)
+			action := res.VirtualHost.Routes[1].GetRoute()
+			require.True(t, action.HedgePolicy.HedgeOnPerTryTimeout)
+			require.Equal(t, 2*time.Second, action.RetryPolicy.PerTryTimeout.AsDuration())
+			require.Equal(t, uint32(2), action.RetryPolicy.NumRetries.GetValue())
+			require.Equal(t, "envoy.retry_priorities.previous_priorities", action.RetryPolicy.RetryPriority.Name)
+		})
+	})
+	t.Run("prefix cache affinity", func(t *testing.T) {
+		c := newFakeClient()
+		err := c.Create(t.Context(), &aigv1a1.AIGatewayRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "myroute", Namespace: "ns"},
+			Spec: aigv1a1.AIGatewayRouteSpec{
+				Rules: []aigv1a1.AIGatewayRouteRule{
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "vllm"}},
+						LoadBalancing: &aigv1a1.AIGatewayRouteRuleLoadBalancing{
+							PrefixCacheAffinity: &aigv1a1.PrefixCacheAffinity{},
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		s := New(c, logr.Discard(), udsPath)
+		vh := &routev3.VirtualHost{Routes: []*routev3.Route{
+			{Action: &routev3.Route_Route{Route: &routev3.RouteAction{
+				ClusterSpecifier: &routev3.RouteAction_Cluster{Cluster: "httproute/ns/myroute/rule/0"},
+			}}},
+		}}
+		res, err := s.PostVirtualHostModify(t.Context(), &egextension.PostVirtualHostModifyRequest{VirtualHost: vh})
+		require.NoError(t, err)
+		require.NotNil(t, res)
+		hashPolicy := res.VirtualHost.Routes[0].GetRoute().HashPolicy
+		require.Len(t, hashPolicy, 1)
+		require.Equal(t, internalapi.PrefixCacheAffinityKeyHeader, hashPolicy[0].GetHeader().HeaderName)
+
+		// Applying it again should not duplicate the hash policy.
+		res, err = s.PostVirtualHostModify(t.Context(), &egextension.PostVirtualHostModifyRequest{VirtualHost: vh})
+		require.NoError(t, err)
+		require.Len(t, res.VirtualHost.Routes[0].GetRoute().HashPolicy, 1)
+	})
+	t.Run("concurrency spill", func(t *testing.T) {
+		c := newFakeClient()
+		require.NoError(t, c.Create(t.Context(), &aigv1a1.AIServiceBackend{
+			ObjectMeta: metav1.ObjectMeta{Name: "limited", Namespace: "ns"},
+			Spec: aigv1a1.AIServiceBackendSpec{
+				ConcurrencyLimit: &aigv1a1.AIServiceBackendConcurrencyLimit{MaxInFlightRequests: 10},
+			},
+		}))
+		require.NoError(t, c.Create(t.Context(), &aigv1a1.AIServiceBackend{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlimited", Namespace: "ns"},
+		}))
+		err := c.Create(t.Context(), &aigv1a1.AIGatewayRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "myroute", Namespace: "ns"},
+			Spec: aigv1a1.AIGatewayRouteSpec{
+				Rules: []aigv1a1.AIGatewayRouteRule{
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{
+							{Name: "limited"},
+							{Name: "unlimited", Priority: ptr.To[uint32](1)},
+							{Name: "unlimited", Priority: ptr.To[uint32](2)},
+						},
+					},
+					// No fallback to spill over to.
+					{BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "limited"}}},
+					// Only the lowest priority backend has the limit.
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{
+							{Name: "unlimited"},
+							{Name: "limited", Priority: ptr.To[uint32](1)},
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		s := New(c, logr.Discard(), udsPath)
+		vh := &routev3.VirtualHost{}
+		for i := range 3 {
+			vh.Routes = append(vh.Routes, &routev3.Route{Action: &routev3.Route_Route{Route: &routev3.RouteAction{
+				ClusterSpecifier: &routev3.RouteAction_Cluster{Cluster: fmt.Sprintf("httproute/ns/myroute/rule/%d", i)},
+			}}})
+		}
+		res, err := s.PostVirtualHostModify(t.Context(), &egextension.PostVirtualHostModifyRequest{VirtualHost: vh})
+		require.NoError(t, err)
+		require.NotNil(t, res)
+		rp := res.VirtualHost.Routes[0].GetRoute().RetryPolicy
+		require.Equal(t, "connect-failure,reset,retriable-headers", rp.RetryOn)
+		require.Equal(t, uint32(2), rp.NumRetries.GetValue())
+		require.Equal(t, "envoy.retry_priorities.previous_priorities", rp.RetryPriority.Name)
+		require.Len(t, rp.RetriableHeaders, 1)
+		require.Equal(t, internalapi.ConcurrencySpillHeader, rp.RetriableHeaders[0].Name)
+		require.True(t, rp.RetriableHeaders[0].GetPresentMatch())
+		require.Nil(t, res.VirtualHost.Routes[1].GetRoute().RetryPolicy)
+		require.Nil(t, res.VirtualHost.Routes[2].GetRoute().RetryPolicy)
+
+		// Applying it again should not duplicate the retriable headers.
+		res, err = s.PostVirtualHostModify(t.Context(), &egextension.PostVirtualHostModifyRequest{VirtualHost: vh})
+		require.NoError(t, err)
+		rp = res.VirtualHost.Routes[0].GetRoute().RetryPolicy
+		require.Equal(t, "connect-failure,reset,retriable-headers", rp.RetryOn)
+		require.Len(t, rp.RetriableHeaders, 1)
+	})
 }
 
 func Test_maybeModifyCluster(t *testing.T) {
@@ -140,6 +296,10 @@ func Test_maybeModifyCluster(t *testing.T) {
 			Name:           "httproute/ns/myroute/rule/0",
 			LoadAssignment: &endpointv3.ClusterLoadAssignment{},
 		}, errLog: `LoadAssignment endpoints length does not match backend refs length`},
+		{c: &clusterv3.Cluster{
+			Name:           "httproute/ns/myroute/rule/0-mirror-1",
+			LoadAssignment: &endpointv3.ClusterLoadAssignment{},
+		}, errLog: `mirror cluster for the rule without shadow policy`},
 	} {
 		t.Run("error/"+tc.errLog, func(t *testing.T) {
 			var buf bytes.Buffer
@@ -183,5 +343,166 @@ func Test_maybeModifyCluster(t *testing.T) {
 		require.True(t, ok)
 		require.Len(t, mmd.Fields, 1)
 		require.Equal(t, "ns/aaa/route/myroute/rule/0/ref/0", mmd.Fields[internalapi.InternalMetadataBackendNameKey].GetStringValue())
+		require.Equal(t, extprocv3http.ProcessingMode_SKIP, upstreamExtProcConfig(t, cluster).ProcessingMode.ResponseHeaderMode)
+	})
+	t.Run("hedge policy", func(t *testing.T) {
+		hc := newFakeClient()
+		err := hc.Create(t.Context(), &aigv1a1.AIGatewayRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "hedged", Namespace: "ns"},
+			Spec: aigv1a1.AIGatewayRouteSpec{
+				Rules: []aigv1a1.AIGatewayRouteRule{
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "aaa"}},
+						HedgePolicy: &aigv1a1.AIGatewayRouteRuleHedgePolicy{FirstResponseTimeout: "1s"},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		cluster := &clusterv3.Cluster{
+			Name: "httproute/ns/hedged/rule/0",
+			LoadAssignment: &endpointv3.ClusterLoadAssignment{
+				Endpoints: []*endpointv3.LocalityLbEndpoints{{LbEndpoints: []*endpointv3.LbEndpoint{{}}}},
+			},
+		}
+		s := New(hc, logr.Discard(), udsPath)
+		s.maybeModifyCluster(cluster)
+		require.Equal(t, extprocv3http.ProcessingMode_SEND, upstreamExtProcConfig(t, cluster).ProcessingMode.ResponseHeaderMode)
+	})
+	t.Run("prefix cache affinity", func(t *testing.T) {
+		pc := newFakeClient()
+		err := pc.Create(t.Context(), &aigv1a1.AIGatewayRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "affinity", Namespace: "ns"},
+			Spec: aigv1a1.AIGatewayRouteSpec{
+				Rules: []aigv1a1.AIGatewayRouteRule{
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "vllm"}},
+						LoadBalancing: &aigv1a1.AIGatewayRouteRuleLoadBalancing{
+							PrefixCacheAffinity: &aigv1a1.PrefixCacheAffinity{BoundedLoadFactor: ptr.To[int32](125)},
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		cluster := &clusterv3.Cluster{
+			Name:     "httproute/ns/affinity/rule/0",
+			LbPolicy: clusterv3.Cluster_LEAST_REQUEST,
+			LoadAssignment: &endpointv3.ClusterLoadAssignment{
+				Endpoints: []*endpointv3.LocalityLbEndpoints{{LbEndpoints: []*endpointv3.LbEndpoint{{}}}},
+			},
+		}
+		s := New(pc, logr.Discard(), udsPath)
+		s.maybeModifyCluster(cluster)
+		require.Equal(t, clusterv3.Cluster_MAGLEV, cluster.LbPolicy)
+		require.Equal(t, uint32(125), cluster.CommonLbConfig.ConsistentHashingLbConfig.HashBalanceFactor.GetValue())
+		require.Contains(t, upstreamExtProcConfig(t, cluster).RequestAttributes, internalapi.UpstreamAddressAttribute)
+	})
+	t.Run("shadow policy", func(t *testing.T) {
+		sc := newFakeClient()
+		err := sc.Create(t.Context(), &aigv1a1.AIGatewayRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "shadowed", Namespace: "ns"},
+			Spec: aigv1a1.AIGatewayRouteSpec{
+				Rules: []aigv1a1.AIGatewayRouteRule{
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{{Name: "aaa"}},
+						ShadowPolicy: &aigv1a1.AIGatewayRouteRuleShadowPolicy{
+							BackendRef: aigv1a1.AIGatewayRouteRuleBackendRef{Name: "candidate"},
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		cluster := &clusterv3.Cluster{
+			Name: "httproute/ns/shadowed/rule/0-mirror-1",
+			LoadAssignment: &endpointv3.ClusterLoadAssignment{
+				Endpoints: []*endpointv3.LocalityLbEndpoints{{LbEndpoints: []*endpointv3.LbEndpoint{{}, {}}}},
+			},
+		}
+		s := New(sc, logr.Discard(), udsPath)
+		s.maybeModifyCluster(cluster)
+		for _, endpoint := range cluster.LoadAssignment.Endpoints[0].LbEndpoints {
+			mmd := endpoint.Metadata.FilterMetadata[internalapi.InternalEndpointMetadataNamespace]
+			require.Equal(t, "ns/candidate/route/shadowed/rule/0/shadow", mmd.Fields[internalapi.InternalMetadataBackendNameKey].GetStringValue())
+		}
+		mode := upstreamExtProcConfig(t, cluster).ProcessingMode
+		require.Equal(t, extprocv3http.ProcessingMode_SEND, mode.ResponseHeaderMode)
+		require.Equal(t, extprocv3http.ProcessingMode_BUFFERED, mode.ResponseBodyMode)
+
+		// The mirror cluster must have exactly one set of endpoints of the shadow backend.
+		var buf bytes.Buffer
+		s = New(sc, logr.FromSlogHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{})), udsPath)
+		s.maybeModifyCluster(&clusterv3.Cluster{
+			Name:           "httproute/ns/shadowed/rule/0-mirror-1",
+			LoadAssignment: &endpointv3.ClusterLoadAssignment{},
+		})
+		require.Contains(t, buf.String(), "LoadAssignment endpoints length of mirror cluster is not one")
 	})
+	t.Run("experiment", func(t *testing.T) {
+		ec := newFakeClient()
+		err := ec.Create(t.Context(), &aigv1a1.AIGatewayRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "experimented", Namespace: "ns"},
+			Spec: aigv1a1.AIGatewayRouteSpec{
+				Rules: []aigv1a1.AIGatewayRouteRule{
+					{
+						BackendRefs: []aigv1a1.AIGatewayRouteRuleBackendRef{
+							{Name: "aaa"},
+							// The same backend can be referenced multiple times, e.g. with the different model names.
+							{Name: "aaa"},
+							{Name: "fallback", Priority: ptr.To[uint32](1)},
+						},
+						Experiment: &aigv1a1.AIGatewayRouteRuleExperiment{
+							Name:    "exp",
+							Subject: aigv1a1.AIGatewayRouteRuleExperimentSubject{Header: ptr.To("x-user-id")},
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		cluster := &clusterv3.Cluster{
+			Name: "httproute/ns/experimented/rule/0",
+			LoadAssignment: &endpointv3.ClusterLoadAssignment{
+				Endpoints: []*endpointv3.LocalityLbEndpoints{
+					{LbEndpoints: []*endpointv3.LbEndpoint{{}}},
+					{LbEndpoints: []*endpointv3.LbEndpoint{{}}},
+					{LbEndpoints: []*endpointv3.LbEndpoint{{}}},
+				},
+			},
+		}
+		s := New(ec, logr.Discard(), udsPath)
+		s.maybeModifyCluster(cluster)
+		variant := func(i int) *structpb.Value {
+			md := cluster.LoadAssignment.Endpoints[i].LbEndpoints[0].Metadata.FilterMetadata[internalapi.EnvoyLBMetadataNamespace]
+			require.NotNil(t, md)
+			return md.Fields[internalapi.ExperimentVariantMetadataKey]
+		}
+		require.Equal(t, "ns/aaa/route/experimented/rule/0/ref/0", variant(0).GetStringValue())
+		require.Equal(t, "ns/aaa/route/experimented/rule/0/ref/1", variant(1).GetStringValue())
+		// The fallback endpoints are shared by all the variants.
+		require.Equal(t, []any{"ns/aaa/route/experimented/rule/0/ref/0", "ns/aaa/route/experimented/rule/0/ref/1"},
+			variant(2).GetListValue().AsSlice())
+		require.NotNil(t, cluster.LbSubsetConfig)
+		require.True(t, cluster.LbSubsetConfig.ListAsAny)
+		require.Equal(t, clusterv3.Cluster_LbSubsetConfig_ANY_ENDPOINT, cluster.LbSubsetConfig.FallbackPolicy)
+		require.Equal(t, []string{internalapi.ExperimentVariantMetadataKey}, cluster.LbSubsetConfig.SubsetSelectors[0].Keys)
+	})
+}
+
+// upstreamExtProcConfig returns the configuration of the upstream external processor filter inserted into the cluster.
+func upstreamExtProcConfig(t *testing.T, cluster *clusterv3.Cluster) *extprocv3http.ExternalProcessor {
+	raw, ok := cluster.TypedExtensionProtocolOptions["envoy.extensions.upstreams.http.v3.HttpProtocolOptions"]
+	require.True(t, ok)
+	po := &httpv3.HttpProtocolOptions{}
+	require.NoError(t, raw.UnmarshalTo(po))
+	for _, filter := range po.HttpFilters {
+		if filter.Name == "envoy.filters.http.ext_proc/aigateway" {
+			extProcConfig := &extprocv3http.ExternalProcessor{}
+			require.NoError(t, filter.GetTypedConfig().UnmarshalTo(extProcConfig))
+			return extProcConfig
+		}
+	}
+	t.Fatal("upstream external processor filter not found")
+	return nil
 }
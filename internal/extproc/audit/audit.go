@@ -0,0 +1,74 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package audit provides the export of the audit records of the requests, such as the tool calls made by the
+// models, which are kept for the compliance review.
+package audit
+
+import (
+	"time"
+)
+
+// Kind is the kind of the audit record.
+type Kind string
+
+const (
+	// KindToolCall is the kind of the record of a tool call.
+	KindToolCall Kind = "tool_call"
+	// KindConversation is the kind of the record of a chat completion request and its response.
+	KindConversation Kind = "conversation"
+)
+
+// Record is the audit record of a request.
+type Record struct {
+	// ID is the ID of the request, which is the value of the "x-request-id" header.
+	ID string `json:"id"`
+	// Time is the time when the record was made.
+	Time time.Time `json:"time"`
+	// Kind is the kind of the record, which tells which of the following fields is set.
+	Kind Kind `json:"kind"`
+	// Consumer is the consumer of the consumer key used by the request. This is empty if no consumer key is used.
+	Consumer string `json:"consumer,omitempty"`
+	// Route is the name of the route rule of the model.
+	Route string `json:"route,omitempty"`
+	// Model is the name of the model in the request.
+	Model string `json:"model"`
+	// Backend is the name of the backend which processed the request. This is empty if the request was not sent to
+	// any backend.
+	Backend string `json:"backend,omitempty"`
+	// ToolCall is the tool call when the kind is [KindToolCall].
+	ToolCall *ToolCall `json:"tool_call,omitempty"`
+	// Conversation is the conversation when the kind is [KindConversation].
+	Conversation *Conversation `json:"conversation,omitempty"`
+
+	// capture is the raw conversation converted into Conversation before the record is exported.
+	capture *ConversationCapture
+}
+
+// prepare converts the raw conversation captured, if any, into the Conversation.
+func (r *Record) prepare() {
+	if r.capture != nil {
+		r.Conversation = r.capture.conversation()
+		r.capture = nil
+	}
+}
+
+// ToolCall is the tool call checked by the tool policy of the route.
+type ToolCall struct {
+	// Phase is "request" if the tool call is in the messages of the request, or "response" if it is made by the model.
+	Phase string `json:"phase"`
+	// Choice is the index of the choice of the response which has the tool call.
+	Choice int64 `json:"choice,omitempty"`
+	// ID is the ID of the tool call. This is empty for the tools defined in the request.
+	ID string `json:"id,omitempty"`
+	// Name is the name of the tool.
+	Name string `json:"name"`
+	// Arguments is the JSON-encoded arguments of the tool call.
+	Arguments string `json:"arguments,omitempty"`
+	// Decision is the decision of the tool policy, which is "allowed", "stripped" or "rejected".
+	Decision string `json:"decision"`
+	// Reason is the reason why the tool call is not allowed. This is empty if it is allowed.
+	Reason string `json:"reason,omitempty"`
+}
@@ -0,0 +1,335 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// redactedValue is the value replacing the redacted fields.
+const redactedValue = "[REDACTED]"
+
+// Conversation is the chat completion request and its response recorded for the compliance review.
+type Conversation struct {
+	// Stream is true if the response was streamed. The streamed response is reassembled into a single chat completion
+	// object.
+	Stream bool `json:"stream"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+	// Request is the JSON-encoded original request of the client.
+	Request string `json:"request"`
+	// RequestTruncated is true if Request is truncated to the maximum size.
+	RequestTruncated bool `json:"request_truncated,omitempty"`
+	// Response is the response returned to the client, which is usually JSON-encoded.
+	Response string `json:"response"`
+	// ResponseTruncated is true if Response is truncated to the maximum size.
+	ResponseTruncated bool `json:"response_truncated,omitempty"`
+}
+
+// ConversationCapture is the raw conversation captured during the request processing, which is converted into the
+// [Conversation] by the [Exporter] in the background.
+type ConversationCapture struct {
+	// Request is the raw request body.
+	Request []byte
+	// Response is the raw response body, which is the server-sent events if Stream is true.
+	Response []byte
+	// ResponseTruncated is true if the response was too large to be captured entirely.
+	ResponseTruncated bool
+	// Stream is true if the response was streamed.
+	Stream bool
+	// Status is the HTTP status code of the response.
+	Status int
+	// RedactedFields is the list of the paths of the fields redacted in the request and the response, e.g.,
+	// "messages.*.content".
+	RedactedFields []string
+	// MaxBodyBytes is the maximum size in bytes of each of the request and the response recorded.
+	MaxBodyBytes int
+}
+
+// ExportConversation enqueues the record of the conversation to be exported. The redaction of the fields, the
+// reassembly of the streamed response and the truncation are done in the background, so that they never add latency
+// to the request processing. This never blocks.
+func (e *Exporter) ExportConversation(r *Record, c *ConversationCapture) {
+	r.Kind = KindConversation
+	r.capture = c
+	e.Export(r)
+}
+
+// conversation converts the capture into the conversation.
+func (c *ConversationCapture) conversation() *Conversation {
+	conv := &Conversation{Stream: c.Stream, Status: c.Status}
+	request := redactFields(c.Request, c.RedactedFields)
+	conv.Request, conv.RequestTruncated = truncate(request, c.MaxBodyBytes)
+	response := c.Response
+	if c.Stream && c.Status == 200 {
+		if reassembled := reassembleStream(response); reassembled != nil {
+			response = reassembled
+		}
+	}
+	response = redactFields(response, c.RedactedFields)
+	conv.Response, conv.ResponseTruncated = truncate(response, c.MaxBodyBytes)
+	conv.ResponseTruncated = conv.ResponseTruncated || c.ResponseTruncated
+	return conv
+}
+
+// truncate returns the body truncated to the maximum size at the boundary of the UTF-8 characters, and true if it is
+// truncated. Zero means no limit.
+func truncate(body []byte, maxSize int) (string, bool) {
+	if maxSize <= 0 || len(body) <= maxSize {
+		return string(body), false
+	}
+	end := maxSize
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+	return string(body[:end]), true
+}
+
+// redactFields returns the JSON body with the values of the fields at the paths replaced with [redactedValue]. The
+// body which is not valid JSON is returned as is.
+func redactFields(body []byte, paths []string) []byte {
+	if len(paths) == 0 || !gjson.ValidBytes(body) {
+		return body
+	}
+	for _, p := range paths {
+		for _, field := range expandPath(body, "", strings.Split(p, ".")) {
+			if redacted, err := sjson.SetBytes(body, field, redactedValue); err == nil {
+				body = redacted
+			}
+		}
+	}
+	return body
+}
+
+// expandPath returns the gjson paths of the fields matching the segments of the path following the prefix, where
+// the "*" segment matches any element of an array or any field of an object.
+func expandPath(body []byte, prefix string, segments []string) []string {
+	if len(segments) == 0 {
+		if prefix == "" {
+			return nil
+		}
+		return []string{prefix}
+	}
+	if segments[0] != "*" {
+		field := joinPath(prefix, escapePath(segments[0]))
+		if !gjson.GetBytes(body, field).Exists() {
+			return nil
+		}
+		return expandPath(body, field, segments[1:])
+	}
+	value := gjson.ParseBytes(body)
+	if prefix != "" {
+		value = gjson.GetBytes(body, prefix)
+	}
+	var fields []string
+	switch {
+	case value.IsArray():
+		for i := range value.Array() {
+			fields = append(fields, expandPath(body, joinPath(prefix, strconv.Itoa(i)), segments[1:])...)
+		}
+	case value.IsObject():
+		value.ForEach(func(key, _ gjson.Result) bool {
+			fields = append(fields, expandPath(body, joinPath(prefix, escapePath(key.String())), segments[1:])...)
+			return true
+		})
+	}
+	return fields
+}
+
+// joinPath joins the gjson path and the escaped name of the field.
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// escapePath escapes the characters of the name of the field which have special meanings in the gjson paths.
+func escapePath(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch r {
+		case '.', '*', '?', '|', '#', '@', '!', '=', '<', '>', '%', '\\', ':':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// reassembledCompletion is the chat completion object reassembled from the streamed chunks.
+type reassembledCompletion struct {
+	ID                string               `json:"id,omitempty"`
+	Object            string               `json:"object"`
+	Created           int64                `json:"created,omitempty"`
+	Model             string               `json:"model,omitempty"`
+	SystemFingerprint string               `json:"system_fingerprint,omitempty"`
+	Choices           []*reassembledChoice `json:"choices"`
+	Usage             json.RawMessage      `json:"usage,omitempty"`
+	// Error is the error event terminating the stream, if any.
+	Error json.RawMessage `json:"error,omitempty"`
+}
+
+type reassembledChoice struct {
+	Index        int64              `json:"index"`
+	Message      reassembledMessage `json:"message"`
+	FinishReason string             `json:"finish_reason,omitempty"`
+
+	content, refusal, reasoning strings.Builder
+	hasContent                  bool
+}
+
+type reassembledMessage struct {
+	Role             string                 `json:"role"`
+	Content          *string                `json:"content"`
+	Refusal          string                 `json:"refusal,omitempty"`
+	ReasoningContent string                 `json:"reasoning_content,omitempty"`
+	ToolCalls        []*reassembledToolCall `json:"tool_calls,omitempty"`
+}
+
+type reassembledToolCall struct {
+	index    int64
+	ID       string                  `json:"id,omitempty"`
+	Type     string                  `json:"type,omitempty"`
+	Function reassembledToolFunction `json:"function"`
+
+	arguments strings.Builder
+}
+
+type reassembledToolFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// reassembleStream reassembles the server-sent events of the streamed chat completion into a single chat completion
+// object. This returns nil if the body has no chunk.
+func reassembleStream(body []byte) []byte {
+	ret := &reassembledCompletion{Object: "chat.completion"}
+	choices := map[int64]*reassembledChoice{}
+	var found bool
+	for _, event := range bytes.Split(body, []byte("\n\n")) {
+		data, ok := eventData(event)
+		if !ok || string(data) == "[DONE]" || !gjson.ValidBytes(data) {
+			continue
+		}
+		chunk := gjson.ParseBytes(data)
+		if e := chunk.Get("error"); e.Exists() {
+			ret.Error, found = json.RawMessage(e.Raw), true
+			continue
+		}
+		found = true
+		if v := chunk.Get("id").String(); v != "" {
+			ret.ID = v
+		}
+		if v := chunk.Get("created").Int(); v != 0 {
+			ret.Created = v
+		}
+		if v := chunk.Get("model").String(); v != "" {
+			ret.Model = v
+		}
+		if v := chunk.Get("system_fingerprint").String(); v != "" {
+			ret.SystemFingerprint = v
+		}
+		if u := chunk.Get("usage"); u.IsObject() {
+			ret.Usage = json.RawMessage(u.Raw)
+		}
+		for _, c := range chunk.Get("choices").Array() {
+			index := c.Get("index").Int()
+			choice, ok := choices[index]
+			if !ok {
+				choice = &reassembledChoice{Index: index, Message: reassembledMessage{Role: "assistant"}}
+				choices[index] = choice
+				ret.Choices = append(ret.Choices, choice)
+			}
+			choice.append(c)
+		}
+	}
+	if !found {
+		return nil
+	}
+	for _, choice := range ret.Choices {
+		choice.finish()
+	}
+	if ret.Choices == nil {
+		ret.Choices = []*reassembledChoice{}
+	}
+	encoded, err := json.Marshal(ret)
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+// append appends the delta of the chunk to the choice.
+func (c *reassembledChoice) append(chunk gjson.Result) {
+	delta := chunk.Get("delta")
+	if v := delta.Get("role").String(); v != "" {
+		c.Message.Role = v
+	}
+	if v := delta.Get("content"); v.Type == gjson.String {
+		c.content.WriteString(v.String())
+		c.hasContent = true
+	}
+	c.refusal.WriteString(delta.Get("refusal").String())
+	c.reasoning.WriteString(delta.Get("reasoning_content").String())
+	for _, tc := range delta.Get("tool_calls").Array() {
+		index := tc.Get("index").Int()
+		var call *reassembledToolCall
+		for _, existing := range c.Message.ToolCalls {
+			if existing.index == index {
+				call = existing
+				break
+			}
+		}
+		if call == nil {
+			call = &reassembledToolCall{index: index}
+			c.Message.ToolCalls = append(c.Message.ToolCalls, call)
+		}
+		if v := tc.Get("id").String(); v != "" {
+			call.ID = v
+		}
+		if v := tc.Get("type").String(); v != "" {
+			call.Type = v
+		}
+		if v := tc.Get("function.name").String(); v != "" {
+			call.Function.Name = v
+		}
+		call.arguments.WriteString(tc.Get("function.arguments").String())
+	}
+	if v := chunk.Get("finish_reason").String(); v != "" {
+		c.FinishReason = v
+	}
+}
+
+// finish sets the accumulated text of the choice to the message.
+func (c *reassembledChoice) finish() {
+	if c.hasContent {
+		content := c.content.String()
+		c.Message.Content = &content
+	}
+	c.Message.Refusal = c.refusal.String()
+	c.Message.ReasoningContent = c.reasoning.String()
+	for _, call := range c.Message.ToolCalls {
+		call.Function.Arguments = call.arguments.String()
+	}
+}
+
+// eventData returns the data of the server-sent event. This returns false if the event has no data.
+func eventData(event []byte) ([]byte, bool) {
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		if data, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			return bytes.TrimSpace(data), true
+		}
+	}
+	return nil, false
+}
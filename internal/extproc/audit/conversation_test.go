@@ -0,0 +1,133 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package audit
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter_ExportConversation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path, 1<<20, 1)
+	require.NoError(t, err)
+	e := NewExporter(sink, slog.Default())
+	e.ExportConversation(&Record{ID: "a", Model: "gpt-4o", Backend: "openai"}, &ConversationCapture{
+		Request:        []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"my password is hunter2"}]}`),
+		Response:       []byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`),
+		Status:         200,
+		RedactedFields: []string{"messages.*.content"},
+	})
+	require.NoError(t, e.Close())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var r Record
+	require.NoError(t, json.Unmarshal(raw, &r))
+	require.Equal(t, KindConversation, r.Kind)
+	require.Equal(t, "openai", r.Backend)
+	require.Equal(t, &Conversation{
+		Status:   200,
+		Request:  `{"model":"gpt-4o","messages":[{"role":"user","content":"[REDACTED]"}]}`,
+		Response: `{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`,
+	}, r.Conversation)
+}
+
+func TestConversationCapture_conversation(t *testing.T) {
+	t.Run("stream", func(t *testing.T) {
+		c := &ConversationCapture{
+			Request: []byte(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`),
+			Response: []byte(`data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}
+
+data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"}}]}
+
+data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"search","arguments":"{\"q\":"}}]}}]}
+
+data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"x\"}"}}]},"finish_reason":"tool_calls"}]}
+
+data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}
+
+data: [DONE]
+
+`),
+			Stream:         true,
+			Status:         200,
+			RedactedFields: []string{"choices.*.message.tool_calls.*.function.arguments"},
+		}
+		conv := c.conversation()
+		require.True(t, conv.Stream)
+		require.False(t, conv.ResponseTruncated)
+		require.JSONEq(t, `{
+  "id": "c1", "object": "chat.completion", "created": 1, "model": "gpt-4o",
+  "choices": [{
+    "index": 0, "finish_reason": "tool_calls",
+    "message": {
+      "role": "assistant", "content": "Hello",
+      "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "search", "arguments": "[REDACTED]"}}]
+    }
+  }],
+  "usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}
+}`, conv.Response)
+	})
+	t.Run("stream terminated with error", func(t *testing.T) {
+		c := &ConversationCapture{
+			Response: []byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a\"}}]}\n\n" +
+				"data: {\"type\":\"error\",\"error\":{\"type\":\"invalid_request_error\",\"code\":\"secret_detected\"}}\n\n"),
+			Stream: true,
+			Status: 200,
+		}
+		require.JSONEq(t, `{
+  "object": "chat.completion",
+  "choices": [{"index": 0, "message": {"role": "assistant", "content": "a"}}],
+  "error": {"type": "invalid_request_error", "code": "secret_detected"}
+}`, c.conversation().Response)
+	})
+	t.Run("error response", func(t *testing.T) {
+		c := &ConversationCapture{Request: []byte(`{}`), Response: []byte(`upstream connect error`), Stream: true, Status: 503}
+		conv := c.conversation()
+		require.Equal(t, "upstream connect error", conv.Response)
+		require.Equal(t, 503, conv.Status)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		c := &ConversationCapture{
+			Request:           []byte(`{"messages":[{"role":"user","content":"こんにちは"}]}`),
+			Response:          []byte(`{"choices":[`),
+			ResponseTruncated: true,
+			MaxBodyBytes:      40,
+		}
+		conv := c.conversation()
+		require.True(t, conv.RequestTruncated)
+		// The truncation does not split the multibyte characters.
+		require.Equal(t, `{"messages":[{"role":"user","content":"`, conv.Request)
+		require.True(t, conv.ResponseTruncated)
+		require.Equal(t, `{"choices":[`, conv.Response)
+	})
+}
+
+func Test_redactFields(t *testing.T) {
+	body := []byte(`{"a":{"b.c":1,"d":[{"e":"x"},{"e":"y"},{"f":"z"}]},"g":{"h":{"i":true},"j":{"i":false}}}`)
+	for _, tc := range []struct {
+		paths []string
+		exp   string
+	}{
+		{paths: nil, exp: string(body)},
+		{paths: []string{"a.b.c"}, exp: string(body)},
+		{paths: []string{"a.d.*.e"}, exp: `{"a":{"b.c":1,"d":[{"e":"[REDACTED]"},{"e":"[REDACTED]"},{"f":"z"}]},"g":{"h":{"i":true},"j":{"i":false}}}`},
+		{paths: []string{"g.*.i", "x.y"}, exp: `{"a":{"b.c":1,"d":[{"e":"x"},{"e":"y"},{"f":"z"}]},"g":{"h":{"i":"[REDACTED]"},"j":{"i":"[REDACTED]"}}}`},
+		{paths: []string{"a"}, exp: `{"a":"[REDACTED]","g":{"h":{"i":true},"j":{"i":false}}}`},
+		{paths: []string{"*"}, exp: `{"a":"[REDACTED]","g":"[REDACTED]"}`},
+	} {
+		require.Equal(t, tc.exp, string(redactFields(body, tc.paths)), tc.paths)
+	}
+	// The field names with the dots cannot be specified, but they are matched by the wildcard.
+	require.Equal(t, `{"b.c":"[REDACTED]"}`, string(redactFields([]byte(`{"b.c":1}`), []string{"*"})))
+	require.Equal(t, `not json`, string(redactFields([]byte(`not json`), []string{"*"})))
+}
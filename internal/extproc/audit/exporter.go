@@ -0,0 +1,32 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package audit
+
+import (
+	"log/slog"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/export"
+)
+
+// Sink is the destination of the audit records.
+type Sink = export.Sink[Record]
+
+// Exporter exports the audit records to the [Sink] in the background.
+type Exporter struct {
+	*export.Exporter[Record]
+}
+
+// NewExporter creates a new [Exporter] and starts exporting the records to the sink.
+// The sink is closed when the exporter is closed.
+func NewExporter(sink Sink, logger *slog.Logger) *Exporter {
+	return &Exporter{export.NewExporter(sink, logger, "audit records", (*Record).prepare)}
+}
+
+// NewFileSink creates a new [Sink] which appends the records to the file at the given path as JSON lines.
+// See [export.NewFileSink] for the rotation of the file.
+func NewFileSink(path string, maxSize int64, maxBackups int) (Sink, error) {
+	return export.NewFileSink[Record](path, maxSize, maxBackups, "audit log file")
+}
@@ -0,0 +1,47 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	r := &Record{
+		ID: "a", Time: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), Kind: KindToolCall, Consumer: "team-a",
+		Route: "default/route/rule/0", Model: "gpt-4o",
+		ToolCall: &ToolCall{
+			Phase: "response", ID: "call_1", Name: "delete_file", Arguments: `{"path":"/"}`,
+			Decision: "stripped", Reason: "The tool delete_file is not allowed.",
+		},
+	}
+	s, err := NewFileSink(path, 1<<20, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Export(t.Context(), []*Record{r}))
+	require.NoError(t, s.Close())
+
+	line, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+  "id": "a", "time": "2025-07-01T00:00:00Z", "kind": "tool_call", "consumer": "team-a",
+  "route": "default/route/rule/0", "model": "gpt-4o",
+  "tool_call": {
+    "phase": "response", "id": "call_1", "name": "delete_file", "arguments": "{\"path\":\"/\"}",
+    "decision": "stripped", "reason": "The tool delete_file is not allowed."
+  }
+}`, string(line))
+
+	t.Run("invalid path", func(t *testing.T) {
+		_, err = NewFileSink(filepath.Join(t.TempDir(), "missing", "audit.jsonl"), 1, 0)
+		require.ErrorContains(t, err, "failed to open audit log file")
+	})
+}
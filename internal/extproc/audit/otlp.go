@@ -0,0 +1,159 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/export"
+)
+
+const (
+	// otlpEventName is the prefix of the event name of the log records, which is followed by the kind of the record.
+	otlpEventName = "aigw.audit."
+	// otlpScopeName is the name of the instrumentation scope of the log records.
+	otlpScopeName = "github.com/envoyproxy/ai-gateway/internal/extproc/audit"
+	// otlpServiceName is the service name of the resource of the log records.
+	otlpServiceName = "ai-gateway-extproc"
+	// maxErrorBodySize is the maximum size of the response body included in the error of the failed export.
+	maxErrorBodySize = 512
+)
+
+// NewOTLPSink creates a new [Sink] which sends the records as the OTLP log records in the protobuf encoding to the
+// OTLP/HTTP endpoint, e.g. "http://otel-collector:4318". The "/v1/logs" path is appended unless the endpoint already
+// has it.
+func NewOTLPSink(endpoint string) Sink {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/logs") {
+		url += "/v1/logs"
+	}
+	return &otlpSink{url: url, client: &http.Client{Timeout: export.Timeout}}
+}
+
+// otlpSink implements [Sink] by sending the records to the OTLP/HTTP endpoint.
+type otlpSink struct {
+	url    string
+	client *http.Client
+}
+
+// Export implements [Sink.Export].
+func (s *otlpSink) Export(ctx context.Context, records []*Record) error {
+	body, err := encodeOTLPLogs(records)
+	if err != nil {
+		return export.Permanent(fmt.Errorf("failed to encode records: %w", err))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return export.Permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send records: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+	err = fmt.Errorf("unexpected status code %d: %s", res.StatusCode, msg)
+	// The client errors other than the throttling are not resolved by retrying.
+	if res.StatusCode/100 == 4 && res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusRequestTimeout {
+		return export.Permanent(err)
+	}
+	return err
+}
+
+// Close implements [Sink.Close].
+func (s *otlpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// encodeOTLPLogs encodes the records as the OTLP export logs request. The fields of the record are set as the
+// attributes of the log record with the same names as the JSON ones, where the tool call and the conversation are
+// the nested lists of the attributes.
+func encodeOTLPLogs(records []*Record) ([]byte, error) {
+	logs := make([]*logspb.LogRecord, len(records))
+	for i, r := range records {
+		attrs := []*commonpb.KeyValue{
+			otlpString("id", r.ID),
+			otlpString("kind", string(r.Kind)),
+			otlpString("consumer", r.Consumer),
+			otlpString("route", r.Route),
+			otlpString("model", r.Model),
+			otlpString("backend", r.Backend),
+		}
+		if c := r.ToolCall; c != nil {
+			attrs = append(attrs, otlpList("tool_call",
+				otlpString("phase", c.Phase),
+				otlpInt("choice", c.Choice),
+				otlpString("id", c.ID),
+				otlpString("name", c.Name),
+				otlpString("arguments", c.Arguments),
+				otlpString("decision", c.Decision),
+				otlpString("reason", c.Reason),
+			))
+		}
+		if c := r.Conversation; c != nil {
+			attrs = append(attrs, otlpList("conversation",
+				otlpBool("stream", c.Stream),
+				otlpInt("status", int64(c.Status)),
+				otlpString("request", c.Request),
+				otlpBool("request_truncated", c.RequestTruncated),
+				otlpString("response", c.Response),
+				otlpBool("response_truncated", c.ResponseTruncated),
+			))
+		}
+		logs[i] = &logspb.LogRecord{
+			TimeUnixNano:         uint64(r.Time.UnixNano()), //nolint:gosec
+			ObservedTimeUnixNano: uint64(r.Time.UnixNano()), //nolint:gosec
+			SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+			SeverityText:         "INFO",
+			EventName:            otlpEventName + string(r.Kind),
+			Attributes:           attrs,
+		}
+	}
+	return proto.Marshal(&collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{otlpString("service.name", otlpServiceName)}},
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: otlpScopeName},
+				LogRecords: logs,
+			}},
+		}},
+	})
+}
+
+func otlpString(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func otlpInt(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}}}
+}
+
+func otlpBool(key string, value bool) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: value}}}
+}
+
+func otlpList(key string, values ...*commonpb.KeyValue) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{
+		Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: values}},
+	}}
+}
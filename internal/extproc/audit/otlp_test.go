@@ -0,0 +1,100 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package audit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/export"
+	internaltesting "github.com/envoyproxy/ai-gateway/internal/testing"
+)
+
+// kv returns the value of the attribute in the list, or nil if it does not exist.
+func kv(attrs []*commonpb.KeyValue, key string) *commonpb.AnyValue {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func TestOTLPSink(t *testing.T) {
+	records := []*Record{
+		{
+			ID: "a", Time: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), Kind: KindToolCall, Consumer: "team-a",
+			Route: "rule-0", Model: "gpt-4o",
+			ToolCall: &ToolCall{Phase: "response", Choice: 1, ID: "call_1", Name: "search", Decision: "allowed"},
+		},
+		{
+			ID: "b", Time: time.Date(2025, 7, 1, 0, 0, 1, 0, time.UTC), Kind: KindConversation, Model: "gpt-4o",
+			Backend: "openai", Conversation: &Conversation{Stream: true, Status: 200, Request: "{}", Response: "{", ResponseTruncated: true},
+		},
+	}
+	srv, req, body := internaltesting.NewRecordingServer(t, http.StatusOK)
+	for _, endpoint := range []string{srv.URL, srv.URL + "/", srv.URL + "/v1/logs"} {
+		s := NewOTLPSink(endpoint)
+		require.NoError(t, s.Export(t.Context(), records))
+		require.NoError(t, s.Close())
+		require.Equal(t, "/v1/logs", req.URL.Path)
+		require.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+	}
+
+	var exported collogspb.ExportLogsServiceRequest
+	require.NoError(t, proto.Unmarshal(*body, &exported))
+	require.Len(t, exported.ResourceLogs, 1)
+	require.Equal(t, "ai-gateway-extproc", exported.ResourceLogs[0].Resource.Attributes[0].Value.GetStringValue())
+	logs := exported.ResourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(t, logs, 2)
+
+	require.Equal(t, "aigw.audit.tool_call", logs[0].EventName)
+	require.Equal(t, uint64(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC).UnixNano()), logs[0].TimeUnixNano)
+	require.Equal(t, "team-a", kv(logs[0].Attributes, "consumer").GetStringValue())
+	toolCall := kv(logs[0].Attributes, "tool_call").GetKvlistValue().Values
+	require.Equal(t, "search", kv(toolCall, "name").GetStringValue())
+	require.Equal(t, int64(1), kv(toolCall, "choice").GetIntValue())
+	require.Nil(t, kv(logs[0].Attributes, "conversation"))
+
+	require.Equal(t, "aigw.audit.conversation", logs[1].EventName)
+	require.Equal(t, "openai", kv(logs[1].Attributes, "backend").GetStringValue())
+	conversation := kv(logs[1].Attributes, "conversation").GetKvlistValue().Values
+	require.True(t, kv(conversation, "stream").GetBoolValue())
+	require.Equal(t, int64(200), kv(conversation, "status").GetIntValue())
+	require.Equal(t, "{}", kv(conversation, "request").GetStringValue())
+	require.True(t, kv(conversation, "response_truncated").GetBoolValue())
+}
+
+func TestOTLPSink_errors(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		permanent bool
+	}{
+		{status: http.StatusBadRequest, permanent: true},
+		{status: http.StatusTooManyRequests},
+		{status: http.StatusServiceUnavailable},
+	} {
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			srv, _, _ := internaltesting.NewRecordingServer(t, tc.status)
+			err := NewOTLPSink(srv.URL).Export(t.Context(), []*Record{{ID: "a"}})
+			require.ErrorContains(t, err, "response")
+			require.Equal(t, tc.permanent, export.IsPermanent(err))
+		})
+	}
+	t.Run("unreachable", func(t *testing.T) {
+		srv, _, _ := internaltesting.NewRecordingServer(t, http.StatusOK)
+		srv.Close()
+		err := NewOTLPSink(srv.URL).Export(t.Context(), []*Record{{ID: "a"}})
+		require.ErrorContains(t, err, "failed to send records")
+		require.False(t, export.IsPermanent(err))
+	})
+}
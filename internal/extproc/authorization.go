@@ -0,0 +1,120 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+// callerClaimValues returns the claim values of the caller of the request for the authorization, which are only
+// taken from the verified JWT since the request headers can be set by the client. The JSON array claims result in
+// multiple values.
+func callerClaimValues(ctx context.Context, authz *filterapi.Authorization) []string {
+	claim := jwtClaim(ctx, authz.JWTClaim)
+	if claim == "" {
+		return nil
+	}
+	if strings.HasPrefix(claim, "[") {
+		var values []string
+		if err := json.Unmarshal([]byte(claim), &values); err == nil {
+			return values
+		}
+	}
+	return []string{claim}
+}
+
+// matchModelPattern returns true if the model matches the pattern, where "*" matches any sequence of characters.
+func matchModelPattern(pattern, model string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == model
+	}
+	if !strings.HasPrefix(model, parts[0]) {
+		return false
+	}
+	model = model[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(model, part)
+		if i < 0 {
+			return false
+		}
+		model = model[i+len(part):]
+	}
+	return strings.HasSuffix(model, parts[len(parts)-1])
+}
+
+// authorizeModel returns whether the caller of the request is allowed to use the model by the authorization,
+// and the cap of the max tokens, which is nil if the requests are not capped.
+func authorizeModel(ctx context.Context, authz *filterapi.Authorization, model string) (allowed bool, maxTokens *int64) {
+	claims := callerClaimValues(ctx, authz)
+	uncapped := false
+	for i := range authz.Rules {
+		r := &authz.Rules[i]
+		if len(r.ClaimValues) > 0 && !slices.ContainsFunc(claims, func(c string) bool { return slices.Contains(r.ClaimValues, c) }) {
+			continue
+		}
+		if len(r.Models) > 0 && !slices.ContainsFunc(r.Models, func(p string) bool { return matchModelPattern(p, model) }) {
+			continue
+		}
+		allowed = true
+		if r.MaxTokens == nil {
+			uncapped = true
+		} else if maxTokens == nil || *r.MaxTokens > *maxTokens {
+			maxTokens = r.MaxTokens
+		}
+	}
+	if uncapped {
+		maxTokens = nil
+	}
+	return allowed, maxTokens
+}
+
+// callerAllowsModel returns true if the caller of the request is allowed to use the model by the authorization
+// of the route rule of the model, if any.
+func callerAllowsModel(ctx context.Context, config *processorConfig, model string) bool {
+	rule := config.rulesByModel[model]
+	if rule == nil || rule.Authorization == nil {
+		return true
+	}
+	allowed, _ := authorizeModel(ctx, rule.Authorization, model)
+	return allowed
+}
+
+// authorizeCaller returns the local reply rejecting the request if the caller is not allowed to use the model,
+// or to request the max tokens, by the authorization of the route rule of the model. requestedMaxTokens is
+// nil for the requests without the max tokens, and checkMaxTokens is false for the APIs without them.
+func authorizeCaller(ctx context.Context, config *processorConfig, model string, checkMaxTokens bool, requestedMaxTokens *int64) *extprocv3.ProcessingResponse {
+	rule := config.rulesByModel[model]
+	if rule == nil || rule.Authorization == nil {
+		return nil
+	}
+	allowed, maxTokens := authorizeModel(ctx, rule.Authorization, model)
+	if !allowed {
+		return openAIErrorResponse(typev3.StatusCode_Forbidden, "model_not_allowed",
+			fmt.Sprintf("You are not allowed to use the model %q.", model))
+	}
+	if !checkMaxTokens || maxTokens == nil {
+		return nil
+	}
+	if requestedMaxTokens == nil {
+		return openAIErrorResponse(typev3.StatusCode_Forbidden, "max_tokens_exceeded",
+			fmt.Sprintf("You must specify max_completion_tokens of at most %d for the model %q.", *maxTokens, model))
+	}
+	if *requestedMaxTokens > *maxTokens {
+		return openAIErrorResponse(typev3.StatusCode_Forbidden, "max_tokens_exceeded",
+			fmt.Sprintf("The requested %d max tokens exceed the limit %d for the model %q.", *requestedMaxTokens, *maxTokens, model))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+
+	"context"
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"maps"
+)
+
+// authorizationTestFilterConfig returns the filter config where the "cheap" group may use "gpt-mini*" up to 100 max
+// tokens, the "eng" group may use any model, and everyone may use "free".
+func authorizationTestFilterConfig() *filterapi.Config {
+	return &filterapi.Config{
+		Rules: []filterapi.RouteRule{{Models: []string{"gpt-mini-1", "gpt-large", "free"}, Authorization: &filterapi.Authorization{
+			JWTClaim: "groups",
+			Rules: []filterapi.AuthorizationRule{
+				{ClaimValues: []string{"cheap"}, Models: []string{"gpt-mini*"}, MaxTokens: ptr.To[int64](100)},
+				{ClaimValues: []string{"eng"}},
+				{Models: []string{"free"}},
+			},
+		}}},
+		Models: []filterapi.Model{{Name: "gpt-mini-1"}, {Name: "gpt-large"}, {Name: "free"}, {Name: "open"}},
+	}
+}
+
+// withGroups returns the context of the request with the verified JWT whose "groups" claim has the groups.
+func withGroups(t *testing.T, groups ...string) context.Context {
+	values := make([]any, 0, len(groups))
+	for _, g := range groups {
+		values = append(values, g)
+	}
+	return withJWTClaims(t, map[string]any{"groups": values})
+}
+
+func Test_callerClaimValues(t *testing.T) {
+	ctx := withJWTClaims(t, map[string]any{"groups": []any{"cheap", "eng"}, "tier": "silver"})
+	require.Equal(t, []string{"cheap", "eng"}, callerClaimValues(ctx, &filterapi.Authorization{JWTClaim: "groups"}))
+	require.Equal(t, []string{"silver"}, callerClaimValues(ctx, &filterapi.Authorization{JWTClaim: "tier"}))
+	require.Empty(t, callerClaimValues(ctx, &filterapi.Authorization{JWTClaim: "missing"}))
+	// The request without the verified JWT has no claim values.
+	require.Empty(t, callerClaimValues(t.Context(), &filterapi.Authorization{JWTClaim: "tier"}))
+}
+
+func Test_matchModelPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, model string
+		exp            bool
+	}{
+		{"gpt-4o", "gpt-4o", true},
+		{"gpt-4o", "gpt-4o-mini", false},
+		{"*", "anything", true},
+		{"gpt-*", "gpt-4o", true},
+		{"gpt-*", "claude", false},
+		{"*-mini", "gpt-4o-mini", true},
+		{"*-mini", "gpt-4o", false},
+		{"gpt-*-mini*", "gpt-4o-mini-2024", true},
+		{"gpt-*-mini*", "gpt-4o", false},
+		{"a*a", "a", false},
+	} {
+		require.Equal(t, tc.exp, matchModelPattern(tc.pattern, tc.model), "%s %s", tc.pattern, tc.model)
+	}
+}
+
+func Test_authorizeModel(t *testing.T) {
+	authz := newTestConfig(t, authorizationTestFilterConfig()).rulesByModel["free"].Authorization
+	allowed, maxTokens := authorizeModel(withGroups(t, "cheap"), authz, "gpt-mini-1")
+	require.True(t, allowed)
+	require.Equal(t, int64(100), *maxTokens)
+	allowed, _ = authorizeModel(withGroups(t, "cheap"), authz, "gpt-large")
+	require.False(t, allowed)
+	// The rule without the cap lifts the cap of the other rules.
+	allowed, maxTokens = authorizeModel(withGroups(t, "cheap", "eng"), authz, "gpt-mini-1")
+	require.True(t, allowed)
+	require.Nil(t, maxTokens)
+	// The rule without the claim values applies to the callers without the claim.
+	allowed, _ = authorizeModel(t.Context(), authz, "free")
+	require.True(t, allowed)
+	allowed, _ = authorizeModel(t.Context(), authz, "gpt-large")
+	require.False(t, allowed)
+}
+
+func Test_chatCompletionProcessor_authorization(t *testing.T) {
+	config := newTestConfig(t, authorizationTestFilterConfig())
+	for _, tc := range []struct {
+		name    string
+		groups  []string
+		headers map[string]string
+		body    string
+		expCode string
+	}{
+		{name: "not allowed model", groups: []string{"cheap"}, body: `{"model":"gpt-large","messages":[]}`, expCode: "model_not_allowed"},
+		{name: "missing max tokens", groups: []string{"cheap"}, body: `{"model":"gpt-mini-1","messages":[]}`, expCode: "max_tokens_exceeded"},
+		{name: "exceeding max tokens", groups: []string{"cheap"}, body: `{"model":"gpt-mini-1","max_tokens":101,"messages":[]}`, expCode: "max_tokens_exceeded"},
+		{name: "exceeding max completion tokens", groups: []string{"cheap"}, body: `{"model":"gpt-mini-1","max_tokens":1,"max_completion_tokens":101,"messages":[]}`, expCode: "max_tokens_exceeded"},
+		{name: "within max tokens", groups: []string{"cheap"}, body: `{"model":"gpt-mini-1","max_completion_tokens":100,"messages":[]}`},
+		{name: "uncapped", groups: []string{"eng"}, body: `{"model":"gpt-large","messages":[]}`},
+		{name: "model without authorization", body: `{"model":"open","messages":[]}`},
+		// The claim is never taken from the request headers which can be set by the client.
+		{name: "claim header", headers: map[string]string{"x-groups": "eng"}, body: `{"model":"gpt-large","messages":[]}`, expCode: "model_not_allowed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			headers := map[string]string{":path": "/v1/chat/completions"}
+			maps.Copy(headers, tc.headers)
+			rp := &chatCompletionProcessorRouterFilter{
+				config:         config,
+				logger:         slog.Default(),
+				requestHeaders: headers,
+			}
+			ctx := t.Context()
+			if tc.groups != nil {
+				ctx = withGroups(t, tc.groups...)
+			}
+			res, err := rp.ProcessRequestBody(ctx, &extprocv3.HttpBody{Body: []byte(tc.body)})
+			require.NoError(t, err)
+			if tc.expCode == "" {
+				require.NotNil(t, res.GetRequestBody())
+				return
+			}
+			requireOpenAIError(t, res, typev3.StatusCode_Forbidden, tc.expCode)
+		})
+	}
+}
+
+func Test_embeddingsProcessor_authorization(t *testing.T) {
+	rp := &embeddingsProcessorRouterFilter{
+		config:         newTestConfig(t, authorizationTestFilterConfig()),
+		logger:         slog.Default(),
+		requestHeaders: map[string]string{":path": "/v1/embeddings"},
+	}
+	ctx := withGroups(t, "cheap")
+	res, err := rp.ProcessRequestBody(ctx, &extprocv3.HttpBody{Body: []byte(`{"model":"gpt-large","input":"hello"}`)})
+	require.NoError(t, err)
+	requireOpenAIError(t, res, typev3.StatusCode_Forbidden, "model_not_allowed")
+	// The max tokens are not checked for the embeddings.
+	res, err = rp.ProcessRequestBody(ctx, &extprocv3.HttpBody{Body: []byte(`{"model":"gpt-mini-1","input":"hello"}`)})
+	require.NoError(t, err)
+	require.NotNil(t, res.GetRequestBody())
+}
+
+func TestModels_authorization(t *testing.T) {
+	p, err := NewModelsProcessor(newTestConfig(t, authorizationTestFilterConfig()), map[string]string{}, slog.Default(), false)
+	require.NoError(t, err)
+	res, err := p.ProcessRequestHeaders(withGroups(t, "cheap"), nil)
+	require.NoError(t, err)
+	var models openai.ModelList
+	require.NoError(t, json.Unmarshal(res.GetImmediateResponse().Body, &models))
+	var ids []string
+	for _, m := range models.Data {
+		ids = append(ids, m.ID)
+	}
+	require.Equal(t, []string{"gpt-mini-1", "free", "open"}, ids)
+}
@@ -0,0 +1,227 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package capture provides the capture of the requests to the disk for debugging, which records each stage of the
+// processing of a request so that it can be replayed offline by the `aigw replay` command.
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+// fileExtension is the extension of the capture files.
+const fileExtension = ".json"
+
+// Record is the capture of a request, which is written to a file named after the request ID.
+type Record struct {
+	// ID is the ID of the request, which is the value of the "x-request-id" header.
+	ID string `json:"id"`
+	// Time is the time when the request arrived.
+	Time time.Time `json:"time"`
+	// Path is the path of the request, e.g., "/v1/chat/completions".
+	Path string `json:"path"`
+	// Route is the name of the route rule of the model.
+	Route string `json:"route,omitempty"`
+	// Model is the name of the model in the request.
+	Model string `json:"model"`
+	// Request is the request body translated for the backends, which is the one after the modifications by the
+	// gateway, e.g., the redaction of the PII and the secrets by the guardrails. This is empty if the request is
+	// rejected before it is translated.
+	Request []byte `json:"request,omitempty"`
+	// OriginalRequest is the original request body of the client before the modifications by the gateway. This is
+	// only captured when it is explicitly enabled on the route, since it may have the PII and the secrets as they are.
+	OriginalRequest []byte `json:"original_request,omitempty"`
+	// Attempts is the list of the attempts of the request to the backends in the order they were made, which has
+	// more than one element when the request is retried or hedged.
+	Attempts []*Attempt `json:"attempts,omitempty"`
+	// LocalReply is the body of the local reply returned to the client instead of the response of the backend, e.g.,
+	// when the request is rejected or the response is blocked by the gateway, and LocalReplyStatus is its status code.
+	LocalReply       []byte `json:"local_reply,omitempty"`
+	LocalReplyStatus int    `json:"local_reply_status,omitempty"`
+	// Truncated is true if the capture of any of the response bodies reached the maximum size, in which case the rest
+	// of the chunks are not captured.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Attempt is the capture of an attempt of the request to a backend.
+type Attempt struct {
+	// Backend is the name of the backend.
+	Backend string `json:"backend"`
+	// Schema is the API schema of the backend which the request is translated to.
+	Schema filterapi.VersionedAPISchema `json:"schema"`
+	// ModelNameOverride is the model name override of the backend.
+	ModelNameOverride string `json:"model_name_override,omitempty"`
+	// Retry is true if the attempt is a retry.
+	Retry bool `json:"retry,omitempty"`
+	// RequestHeaders is the headers set by the translation of the request, which doesn't include the ones set by
+	// the authentication of the backend so that the credentials are never written to the disk.
+	RequestHeaders map[string]string `json:"request_headers,omitempty"`
+	// RequestBody is the request body sent to the backend after the translation. This is empty if the original
+	// request body is sent as is.
+	RequestBody []byte `json:"request_body,omitempty"`
+	// ResponseHeaders is the response headers of the backend. This is empty if this attempt didn't return the
+	// response to the client, e.g., when it lost the race of the hedged attempts.
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	// ResponseChunks is the raw chunks of the response body of the backend before the translation, and
+	// ClientResponseChunks is the corresponding chunks returned to the client.
+	ResponseChunks       [][]byte `json:"response_chunks,omitempty"`
+	ClientResponseChunks [][]byte `json:"client_response_chunks,omitempty"`
+}
+
+// ErrLimitReached is returned by [Writer.Write] when the capture directory has reached its limits.
+var ErrLimitReached = errors.New("capture directory reached its limits")
+
+// Writer writes the capture records to the files in a directory.
+//
+// The directory is bounded by the total size and the number of the capture files, since the captures can be
+// triggered by the clients with the capture header. The records are not written once either of them is reached,
+// so that the existing captures are kept until they are removed by the operator.
+type Writer struct {
+	dir      string
+	maxBytes int64
+	maxFiles int
+
+	mu sync.Mutex
+	// sizes is the sizes of the capture files in the directory by the names, and bytes is the total of them.
+	sizes map[string]int64
+	bytes int64
+}
+
+// NewWriter creates a new [Writer] writing the records to the directory, which is created if it doesn't exist.
+// The capture files already in the directory count towards maxBytes and maxFiles.
+func NewWriter(dir string, maxBytes int64, maxFiles int) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	w := &Writer{dir: dir, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := w.scan(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// scan accounts the capture files in the directory from scratch, so that the ones removed by the operator are no
+// longer counted.
+func (w *Writer) scan() error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list capture directory: %w", err)
+	}
+	sizes, bytes := make(map[string]int64), int64(0)
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != fileExtension {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			// The file may have been removed after the listing.
+			continue
+		}
+		sizes[e.Name()] = info.Size()
+		bytes += info.Size()
+	}
+	w.sizes, w.bytes = sizes, bytes
+	return nil
+}
+
+// Write writes the record to the file named after its ID, replacing the existing one if any. This returns
+// [ErrLimitReached] if the file would exceed the limits of the directory.
+func (w *Writer) Write(r *Record) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode capture: %w", err)
+	}
+	name := fileName(r.ID)
+	prev, existed, ok := w.reserve(name, int64(len(raw)))
+	if !ok {
+		return ErrLimitReached
+	}
+	// The file is written to a temporary file and renamed, so that the readers never see a partial capture.
+	f, err := os.CreateTemp(w.dir, ".capture-*")
+	if err != nil {
+		return fmt.Errorf("failed to create capture file: %w", err)
+	}
+	_, err = f.Write(raw)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(w.dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		w.unreserve(name, int64(len(raw)), prev, existed)
+		return fmt.Errorf("failed to write capture file: %w", err)
+	}
+	return nil
+}
+
+// reserve accounts the file of the size in the directory, replacing the previous one of the same name if it
+// existed. This returns the size of the previous one, and false if the directory would exceed its limits.
+func (w *Writer) reserve(name string, size int64) (prev int64, existed, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	exceeds := func() bool {
+		prev, existed = w.sizes[name]
+		return w.bytes-prev+size > w.maxBytes || (!existed && len(w.sizes) >= w.maxFiles)
+	}
+	// The directory is scanned again before giving up, in case the captures have been removed.
+	if exceeds() && (w.scan() != nil || exceeds()) {
+		return 0, false, false
+	}
+	w.sizes[name] = size
+	w.bytes += size - prev
+	return prev, existed, true
+}
+
+// unreserve reverts the reservation of the file which failed to be written.
+func (w *Writer) unreserve(name string, size, prev int64, existed bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if existed {
+		w.sizes[name] = prev
+	} else {
+		delete(w.sizes, name)
+	}
+	w.bytes -= size - prev
+}
+
+// Read reads the record from the file at the path.
+func Read(path string) (*Record, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture file: %w", err)
+	}
+	var r Record
+	if err = json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode capture file %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// fileName returns the name of the capture file of the request ID. The characters other than the alphanumerics,
+// "-" and "_" are replaced with "_", so that the request ID never escapes the directory. The requests without the ID
+// are named after the current time and a random suffix, so that their captures never replace each other.
+func fileName(id string) string {
+	if id == "" {
+		id = fmt.Sprintf("unknown-%d-%08x", time.Now().UnixNano(), rand.Uint32()) //nolint:gosec
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, id) + fileExtension
+}
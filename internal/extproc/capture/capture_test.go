@@ -0,0 +1,101 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package capture
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+func TestWriter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "captures")
+	w, err := NewWriter(dir, 1<<20, 10)
+	require.NoError(t, err)
+
+	r := &Record{
+		ID:      "req-1",
+		Time:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Path:    "/v1/chat/completions",
+		Model:   "gpt",
+		Request: []byte(`{"model":"gpt"}`),
+		Attempts: []*Attempt{{
+			Backend:              "backend",
+			Schema:               filterapi.VersionedAPISchema{Name: filterapi.APISchemaAWSBedrock},
+			RequestBody:          []byte(`{"messages":[]}`),
+			ResponseHeaders:      map[string]string{":status": "200"},
+			ResponseChunks:       [][]byte{[]byte("a"), []byte("b")},
+			ClientResponseChunks: [][]byte{[]byte("c")},
+		}},
+	}
+	require.NoError(t, w.Write(r))
+	// The second write replaces the first one.
+	r.LocalReply, r.LocalReplyStatus = []byte("blocked"), 403
+	require.NoError(t, w.Write(r))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "req-1.json", entries[0].Name())
+
+	read, err := Read(filepath.Join(dir, "req-1.json"))
+	require.NoError(t, err)
+	require.Equal(t, r, read)
+
+	_, err = Read(filepath.Join(dir, "nonexistent.json"))
+	require.ErrorContains(t, err, "failed to read capture file")
+}
+
+func TestWriter_limits(t *testing.T) {
+	dir := t.TempDir()
+	// The capture files already in the directory count towards the limits, while the other files don't.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "existing.json"), make([]byte, 10), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), make([]byte, 1000), 0o600))
+	raw, err := json.Marshal(&Record{ID: "req-1"})
+	require.NoError(t, err)
+	size := int64(len(raw))
+
+	t.Run("files", func(t *testing.T) {
+		w, err := NewWriter(dir, 1<<20, 2)
+		require.NoError(t, err)
+		require.NoError(t, w.Write(&Record{ID: "req-1"}))
+		require.ErrorIs(t, w.Write(&Record{ID: "req-2"}), ErrLimitReached)
+		// The existing capture can still be replaced.
+		require.NoError(t, w.Write(&Record{ID: "req-1"}))
+		require.NoFileExists(t, filepath.Join(dir, "req-2.json"))
+	})
+	t.Run("bytes", func(t *testing.T) {
+		w, err := NewWriter(dir, 10+2*size, 10)
+		require.NoError(t, err)
+		// The directory already has existing.json and req-1.json.
+		require.NoError(t, w.Write(&Record{ID: "req-3"}))
+		require.ErrorIs(t, w.Write(&Record{ID: "req-4"}), ErrLimitReached)
+		require.ErrorIs(t, w.Write(&Record{ID: "req-3", Path: "/v1/chat/completions"}), ErrLimitReached)
+	})
+	t.Run("removed", func(t *testing.T) {
+		w, err := NewWriter(dir, 1<<20, 3)
+		require.NoError(t, err)
+		require.ErrorIs(t, w.Write(&Record{ID: "req-4"}), ErrLimitReached)
+		// The captures removed by the operator are no longer counted.
+		require.NoError(t, os.Remove(filepath.Join(dir, "req-1.json")))
+		require.NoError(t, w.Write(&Record{ID: "req-4"}))
+	})
+}
+
+func Test_fileName(t *testing.T) {
+	require.Equal(t, "abc-123_x.json", fileName("abc-123_x"))
+	require.Equal(t, "___etc_passwd.json", fileName("../etc/passwd"))
+	// The requests without the ID never share the file.
+	unknown := fileName("")
+	require.Regexp(t, `^unknown-[0-9]+-[0-9a-f]{8}\.json$`, unknown)
+	require.NotEqual(t, unknown, fileName(""))
+}
@@ -13,22 +13,34 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"strconv"
+	"sync"
+	"time"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	extprocv3http "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
 	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/envoyproxy/ai-gateway/filterapi"
-	"github.com/envoyproxy/ai-gateway/filterapi/x"
 	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
 	"github.com/envoyproxy/ai-gateway/internal/extproc/backendauth"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/capture"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/guardrail"
 	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
 	"github.com/envoyproxy/ai-gateway/internal/llmcostcel"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+	"github.com/envoyproxy/ai-gateway/internal/tracing"
+	"slices"
 )
 
 // ChatCompletionProcessorFactory returns a factory method to instantiate the chat completion processor.
-func ChatCompletionProcessorFactory(ccm x.ChatCompletionMetrics) ProcessorFactory {
+func ChatCompletionProcessorFactory(ccm metrics.ChatCompletionMetrics) ProcessorFactory {
+	affinity := newPrefixCacheAffinityTracker(prefixCacheAffinityTrackerSize)
 	return func(config *processorConfig, requestHeaders map[string]string, logger *slog.Logger, isUpstreamFilter bool) (Processor, error) {
 		if config.schema.Name != filterapi.APISchemaOpenAI {
 			return nil, fmt.Errorf("unsupported API schema: %s", config.schema.Name)
@@ -39,6 +51,8 @@ func ChatCompletionProcessorFactory(ccm x.ChatCompletionMetrics) ProcessorFactor
 				config:         config,
 				requestHeaders: requestHeaders,
 				logger:         logger,
+				metrics:        ccm,
+				requestStart:   time.Now(),
 			}, nil
 		}
 		return &chatCompletionProcessorUpstreamFilter{
@@ -46,6 +60,7 @@ func ChatCompletionProcessorFactory(ccm x.ChatCompletionMetrics) ProcessorFactor
 			requestHeaders: requestHeaders,
 			logger:         logger,
 			metrics:        ccm,
+			affinity:       affinity,
 		}, nil
 	}
 }
@@ -56,7 +71,8 @@ func ChatCompletionProcessorFactory(ccm x.ChatCompletionMetrics) ProcessorFactor
 type chatCompletionProcessorRouterFilter struct {
 	passThroughProcessor
 	// upstreamFilter is the upstream filter that is used to process the request at the upstream filter.
-	// This will be updated when the request is retried.
+	// This will be updated when the request is retried. When the request is routed to a rule with the hedge policy,
+	// this is only set from the hedge state on the response path.
 	//
 	// On the response handling path, we don't need to do any operation until successful, so we use the implementation
 	// of the upstream filter to handle the response at the router filter.
@@ -71,13 +87,100 @@ type chatCompletionProcessorRouterFilter struct {
 	// when the request is retried.
 	originalRequestBody    *openai.ChatCompletionRequest
 	originalRequestBodyRaw []byte
-	// upstreamFilterCount is the number of upstream filters that have been processed.
+	// upstreamFilterCount is the number of upstream filters that have been processed except the hedged attempts.
 	// This is used to determine if the request is a retry request.
 	upstreamFilterCount int
+	// hedge tracks the concurrent upstream attempts when the request is routed to a rule with the hedge policy.
+	hedge hedgeState
+	// prefixCacheAffinityKey is the hash key of the prompt prefix. This is set only when the prefix cache affinity
+	// is enabled on the rule matching the model.
+	prefixCacheAffinityKey string
+	// shadowOnce guards the sampling of the request for the traffic shadowing.
+	shadowOnce sync.Once
+	// shadow is the comparison of the primary and shadow responses. This is non-nil only when the request
+	// is sampled for the traffic shadowing.
+	shadow *shadowComparison
+	// experiment and experimentVariant are the experiment of the rule matching the model and the variant
+	// assigned to the end user. These are set only when the variant is assigned.
+	experiment, experimentVariant string
+	// quota is the state of the quota budgets applicable to the request. This is nil if no budget applies.
+	quota *quotaState
+	// tokenEstimate is the estimated token usage of the request. This is nil unless any of the request costs
+	// needs the estimation.
+	tokenEstimate *tokenEstimate
+	// media is the usage of the images and the audio of the request charged by the pricing catalog.
+	media mediaUsage
+	// requestStart is the time when the request arrived, which is used for the latency in the usage ledger.
+	requestStart time.Time
+	// consumerKey is the consumer key authenticating the request. This is nil if no consumer key is configured.
+	consumerKey *filterapi.ConsumerKey
+	// metrics records the detections of the guardrails and the lookups of the response cache before the backend
+	// is selected.
+	metrics routerFilterMetrics
+	// requestBodyRewritten is true if the request limits or the guardrails modified the request body, and piiVault
+	// keeps the original values of the PII tokenized in it, if any.
+	requestBodyRewritten bool
+	piiVault             *guardrail.PIIVault
+	// conversationAudit is the request sampled to be recorded in the audit log. This is nil if it is not recorded.
+	conversationAudit *conversationAudit
+	// routeMetricAttrs are the metric attributes configured on the route rule extracted from the request.
+	routeMetricAttrs []attribute.KeyValue
+	// capture is the capture of the request written to the disk. This is nil if the request is not captured.
+	capture *requestCapture
+	// responseCache is the lookup of the request in the response cache, which stores the response when the request
+	// missed the cache. This is nil if the response cache does not apply to the request.
+	responseCache *responseCache
+}
+
+// writeRequestCapture implements [requestCaptureWriter].
+func (c *chatCompletionProcessorRouterFilter) writeRequestCapture() {
+	if c.capture != nil {
+		c.capture.write()
+	}
+}
+
+// releaseQuotaReservation implements [quotaReservationReleaser].
+func (c *chatCompletionProcessorRouterFilter) releaseQuotaReservation() {
+	if c.quota != nil {
+		c.quota.release(context.Background(), c.logger)
+	}
 }
 
 // ProcessResponseHeaders implements [Processor.ProcessResponseHeaders].
-func (c *chatCompletionProcessorRouterFilter) ProcessResponseHeaders(ctx context.Context, headerMap *corev3.HeaderMap) (*extprocv3.ProcessingResponse, error) {
+func (c *chatCompletionProcessorRouterFilter) ProcessResponseHeaders(ctx context.Context, headerMap *corev3.HeaderMap) (res *extprocv3.ProcessingResponse, err error) {
+	var hedged bool
+	defer func() {
+		if err != nil {
+			return
+		}
+		if c.experimentVariant != "" {
+			setExperimentResponseHeaders(res, c.experiment, c.experimentVariant)
+		}
+		if c.quota != nil {
+			addResponseHeaders(res, c.quota.headers()...)
+		}
+		if c.responseCache != nil {
+			addResponseHeaders(res, c.responseCache.missHeader())
+		}
+		if hedged {
+			removeResponseHeaders(res, internalapi.HedgeAttemptHeader)
+		}
+	}()
+	// The upstream filters of the hedged attempts are set concurrently, so they are only tracked by the hedge state
+	// rather than by c.upstreamFilter. The response is the one of the attempt tagged by its upstream filter, which is
+	// not necessarily the last one started. If the response is not tagged, e.g. the local reply of the upstream
+	// filter, the last one started is used.
+	var attempt Processor
+	if tag, ok := headersToMap(headerMap)[internalapi.HedgeAttemptHeader]; ok {
+		hedged = true
+		attempt = c.hedge.claim(tag)
+	}
+	if attempt == nil {
+		attempt = c.hedge.latest()
+	}
+	if attempt != nil {
+		c.upstreamFilter = attempt
+	}
 	// If the request failed to route and/or immediate response was returned before the upstream filter was set,
 	// c.upstreamFilter can be nil.
 	if c.upstreamFilter != nil { // See the comment on the "upstreamFilter" field.
@@ -97,34 +200,161 @@ func (c *chatCompletionProcessorRouterFilter) ProcessResponseBody(ctx context.Co
 }
 
 // ProcessRequestBody implements [Processor.ProcessRequestBody].
-func (c *chatCompletionProcessorRouterFilter) ProcessRequestBody(_ context.Context, rawBody *extprocv3.HttpBody) (*extprocv3.ProcessingResponse, error) {
+func (c *chatCompletionProcessorRouterFilter) ProcessRequestBody(ctx context.Context, rawBody *extprocv3.HttpBody) (res *extprocv3.ProcessingResponse, err error) {
 	model, body, err := parseOpenAIChatCompletionBody(rawBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse request body: %w", err)
 	}
+	// The response cache is keyed on the request of the client before it is modified by the gateway.
+	clientRequest := rawBody.Body
 
 	c.requestHeaders[c.config.modelNameHeaderKey] = model
-
+	traceRequest(ctx, tracing.OperationChat, model, chatCompletionRequestAttributes(body)...)
+	if c.conversationAudit = sampleConversationAudit(c.config, model, rawBody.Body); c.conversationAudit != nil {
+		defer func() { c.conversationAudit.exportRejected(c.requestHeaders, res) }()
+	}
+	if c.capture = startRequestCapture(c.config, c.logger, model, c.requestHeaders, rawBody.Body); c.capture != nil {
+		defer func() { c.capture.recordLocalReply(res) }()
+	}
+	var rejected *extprocv3.ProcessingResponse
+	if c.consumerKey, rejected = authenticateConsumerKey(c.config, c.requestHeaders, time.Now()); rejected != nil {
+		return rejected, nil
+	}
 	var additionalHeaders []*corev3.HeaderValueOption
+	var removedHeaders []string
+	if c.consumerKey != nil {
+		if rejected = authorizeConsumerKey(c.config, c.consumerKey, model); rejected != nil {
+			return rejected, nil
+		}
+		additionalHeaders, removedHeaders = applyConsumerKey(c.consumerKey, c.requestHeaders)
+	}
+	var clamped []byte
+	if clamped, rejected = enforceRequestLimits(c.config, model, rawBody.Body); rejected != nil {
+		return rejected, nil
+	} else if clamped != nil {
+		rawBody = &extprocv3.HttpBody{Body: clamped}
+		if _, body, err = parseOpenAIChatCompletionBody(rawBody); err != nil {
+			return nil, fmt.Errorf("failed to parse clamped request body: %w", err)
+		}
+		c.requestBodyRewritten = true
+	}
+	requestedMaxTokens := body.MaxCompletionTokens
+	if requestedMaxTokens == nil || (body.MaxTokens != nil && *body.MaxTokens > *requestedMaxTokens) {
+		requestedMaxTokens = body.MaxTokens
+	}
+	if rejected = authorizeCaller(ctx, c.config, model, true, requestedMaxTokens); rejected != nil {
+		return rejected, nil
+	}
+	var metricAttrs []attribute.KeyValue
+	if c.consumerKey != nil {
+		metricAttrs = consumerKeyMetricAttributes(c.consumerKey)
+	}
+	c.routeMetricAttrs = routeMetricAttributes(ctx, c.config, metricAttributesChatCompletion, model, c.requestHeaders)
+	metricAttrs = append(metricAttrs, c.routeMetricAttrs...)
+	if rejected = enforceRequestToolPolicy(ctx, c.config, c.metrics, model, c.requestHeaders, rawBody.Body, metricAttrs...); rejected != nil {
+		return rejected, nil
+	}
+	secretsRedacted, rejected, err := applySecretGuardrail(ctx, c.config, c.logger, c.metrics, model, rawBody.Body, metricAttrs...)
+	if err != nil {
+		return nil, err
+	} else if rejected != nil {
+		return rejected, nil
+	}
+	if secretsRedacted != nil {
+		rawBody = &extprocv3.HttpBody{Body: secretsRedacted}
+		if _, body, err = parseOpenAIChatCompletionBody(rawBody); err != nil {
+			return nil, fmt.Errorf("failed to parse redacted request body: %w", err)
+		}
+		c.requestBodyRewritten = true
+	}
+	redacted, vault, rejected, err := applyPIIGuardrail(ctx, c.config, c.metrics, model, rawBody.Body, redactChatCompletionText, metricAttrs...)
+	if err != nil {
+		return nil, err
+	} else if rejected != nil {
+		return rejected, nil
+	}
+	if redacted != nil {
+		rawBody = &extprocv3.HttpBody{Body: redacted}
+		if _, body, err = parseOpenAIChatCompletionBody(rawBody); err != nil {
+			return nil, fmt.Errorf("failed to parse redacted request body: %w", err)
+		}
+		c.requestBodyRewritten, c.piiVault = true, vault
+	}
+	rewritten, rejected := applyExternalGuardrails(ctx, c.config, c.logger, c.metrics, guardrail.ExternalPhaseRequest,
+		externalGuardrailOperationChatCompletions, model, nil, rawBody.Body, metricAttrs...)
+	if rejected != nil {
+		return rejected, nil
+	}
+	if rewritten != nil {
+		rawBody = &extprocv3.HttpBody{Body: rewritten}
+		if _, body, err = parseOpenAIChatCompletionBody(rawBody); err != nil {
+			return nil, fmt.Errorf("failed to parse rewritten request body: %w", err)
+		}
+		c.requestBodyRewritten = true
+	}
+	if c.config.estimateTokens {
+		c.tokenEstimate = estimateChatCompletionTokens(c.config, model, body)
+	}
+	if c.quota, rejected = enforceQuotas(ctx, c.config, c.logger, model, c.consumerKey, c.requestHeaders, c.tokenEstimate); rejected != nil {
+		return rejected, nil
+	}
+	var cached []byte
+	if c.responseCache, cached = lookupResponseCache(ctx, c.config, c.logger, c.metrics, model, c.requestHeaders, clientRequest, metricAttrs...); cached != nil {
+		return c.responseCache.hitResponse(c.requestHeaders, body.Stream, cached)
+	}
+
 	additionalHeaders = append(additionalHeaders, &corev3.HeaderValueOption{
 		// Set the model name to the request header with the key `x-ai-eg-model`.
 		Header: &corev3.HeaderValue{Key: c.config.modelNameHeaderKey, RawValue: []byte(model)},
 	}, &corev3.HeaderValueOption{
 		Header: &corev3.HeaderValue{Key: originalPathHeader, RawValue: []byte(c.requestHeaders[":path"])},
 	})
+	rule := c.config.rulesByModel[model]
+	if rule != nil && rule.PrefixCacheAffinity != nil {
+		c.prefixCacheAffinityKey, err = prefixCacheAffinityKey(body, rule.PrefixCacheAffinity.LeadingMessages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate prefix cache affinity key: %w", err)
+		}
+		// Without the key, Envoy selects the endpoint as if the prefix cache affinity is not configured.
+		if c.prefixCacheAffinityKey != "" {
+			additionalHeaders = append(additionalHeaders, &corev3.HeaderValueOption{
+				Header: &corev3.HeaderValue{Key: internalapi.PrefixCacheAffinityKeyHeader, RawValue: []byte(c.prefixCacheAffinityKey)},
+			})
+		}
+	}
+	var dm *structpb.Struct
+	if rule != nil && rule.Experiment != nil {
+		// Requests without the subject are not part of the experiment, and are routed to any backend of the rule.
+		if subject := experimentSubject(ctx, rule.Experiment, c.requestHeaders); subject != "" {
+			if variant := assignExperimentVariant(rule.Experiment, subject); variant != nil {
+				c.experiment, c.experimentVariant = rule.Experiment.Name, variant.Name
+				dm = buildExperimentDynamicMetadata(c.config, c.experiment, variant)
+			}
+		}
+	}
+	if c.tokenEstimate != nil {
+		dm = buildTokenEstimationDynamicMetadata(c.config, dm, c.tokenEstimate)
+	}
+	c.media = countChatCompletionMedia(body)
 	c.originalRequestBody = body
 	c.originalRequestBodyRaw = rawBody.Body
+	if c.capture != nil {
+		c.capture.setRequest(rawBody.Body)
+	}
+	tracePrompt(ctx, c.config, rawBody.Body)
 	return &extprocv3.ProcessingResponse{
 		Response: &extprocv3.ProcessingResponse_RequestBody{
 			RequestBody: &extprocv3.BodyResponse{
 				Response: &extprocv3.CommonResponse{
 					HeaderMutation: &extprocv3.HeaderMutation{
-						SetHeaders: additionalHeaders,
+						SetHeaders:    additionalHeaders,
+						RemoveHeaders: removedHeaders,
 					},
 					ClearRouteCache: true,
 				},
 			},
 		},
+		DynamicMetadata: dm,
 	}, nil
 }
 
@@ -148,9 +378,83 @@ type chatCompletionProcessorUpstreamFilter struct {
 	// cost is the cost of the request that is accumulated during the processing of the response.
 	costs translator.LLMTokenUsage
 	// metrics tracking.
-	metrics x.ChatCompletionMetrics
+	metrics metrics.ChatCompletionMetrics
 	// stream is set to true if the request is a streaming request.
 	stream bool
+	// hedge is the hedge state shared with the router filter. This is non-nil only when the backend
+	// belongs to a rule with the hedge policy.
+	hedge *hedgeState
+	// hedgeAttempt is the index of this attempt in the hedge state, and isHedge is true if this attempt was started
+	// by the hedge policy rather than by the retry policy.
+	hedgeAttempt int
+	isHedge      bool
+	// hedgeResponseSeen is set to true once the response headers of this attempt are processed at the upstream filter level.
+	hedgeResponseSeen bool
+	// upstreamAddress is the address of the selected upstream host. This is only available when the prefix cache affinity is enabled.
+	upstreamAddress string
+	// affinity is the prefix cache affinity tracker shared across all requests.
+	affinity *prefixCacheAffinityTracker
+	// isShadow is true if this processes the request mirrored to the shadow backend of the rule.
+	isShadow bool
+	// quota is the quota state of the router filter charged when the response completes. This is nil for
+	// the shadow requests.
+	quota *quotaState
+	// tokenEstimate is the estimated token usage of the router filter reconciled with the actual usage when the
+	// response completes. This is nil for the shadow requests.
+	tokenEstimate *tokenEstimate
+	// price is the price of the model for the backend in the pricing catalog, and media is the usage of the images
+	// and the audio of the router filter charged by it. The price is nil if the model has no price.
+	price *filterapi.ModelPrice
+	media mediaUsage
+	// requestStart is the time when the request arrived at the router filter.
+	requestStart time.Time
+	// shadow is the comparison shared with the router filter. This is non-nil only when the request is sampled
+	// for the traffic shadowing, in which case shadowRecorder collects the response to be compared.
+	shadow         *shadowComparison
+	shadowRecorder *shadowResponseRecorder
+	// metricAttrs are the additional attributes of the metrics of the request, e.g. the experiment variant.
+	metricAttrs []attribute.KeyValue
+	// requestBodyRewritten is true if the router filter modified the request body, in which case the body is always
+	// replaced even if the translator does not modify it.
+	requestBodyRewritten bool
+	// piiDetokenizer replaces the tokens of the PII in the response with the original values. This is nil unless
+	// any PII is tokenized in the request.
+	piiDetokenizer *guardrail.PIIDetokenizer
+	// responseGuardrails is true if the non-streaming response is checked by the external guardrail services.
+	responseGuardrails bool
+	// toolPolicy is the tool policy of the rule of the model checking the tool calls of the response, and
+	// toolCallFilter applies it to the streaming response. Both are nil if the rule has no tool policy.
+	toolPolicy     *guardrail.ToolPolicy
+	toolCallFilter *guardrail.ToolCallFilter
+	// secrets is the scanner of the secret guardrail of the rule of the model scanning the response, and
+	// secretStreamScanner applies it to the streaming response. Both are nil unless the responses are scanned.
+	secrets             *guardrail.SecretScanner
+	secretStreamScanner *guardrail.SecretStreamScanner
+	// streamTerminated is true if the streaming response is terminated with the error event by the tool policy or the
+	// secret guardrail, in which case the response is not cached.
+	streamTerminated bool
+	// conversationAudit is the request sampled to be recorded in the audit log, and conversationResponse is the
+	// response returned to the client captured for it.
+	conversationAudit    *conversationAudit
+	conversationResponse conversationResponse
+	// backendSchema is the API schema of the backend, and responseSpan records the response on the span of the
+	// request. The latter is nil unless the request is traced.
+	backendSchema filterapi.APISchemaName
+	responseSpan  *chatCompletionResponseSpan
+	// capture is the capture of the request shared with the router filter, and captureAttempt is the attempt of
+	// this upstream filter in it. Both are nil if the request is not captured.
+	capture        *requestCapture
+	captureAttempt *capture.Attempt
+	// responseCache is the response cache of the router filter storing the response returned to the client. This is
+	// nil unless the request missed the cache.
+	responseCache *responseCache
+	// concurrencySlot holds the slot of the concurrency limit of the backend.
+	concurrencySlot
+}
+
+// setUpstreamAddress implements [upstreamAddressSetter].
+func (c *chatCompletionProcessorUpstreamFilter) setUpstreamAddress(address string) {
+	c.upstreamAddress = address
 }
 
 // selectTranslator selects the translator based on the output schema.
@@ -179,9 +483,19 @@ func (c *chatCompletionProcessorUpstreamFilter) selectTranslator(out filterapi.V
 // with the status CONTINUE_AND_REPLACE. This will allows Envoy to not send the request body again
 // to the extproc.
 func (c *chatCompletionProcessorUpstreamFilter) ProcessRequestHeaders(ctx context.Context, _ *corev3.HeaderMap) (res *extprocv3.ProcessingResponse, err error) {
+	if c.isShadow && c.shadow == nil {
+		// Envoy mirrors all the requests, so the ones which are not sampled are dropped here.
+		return &extprocv3.ProcessingResponse{
+			Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+				ImmediateResponse: &extprocv3.ImmediateResponse{
+					Status: &typev3.HttpStatus{Code: typev3.StatusCode_NoContent},
+				},
+			},
+		}, nil
+	}
 	defer func() {
 		if err != nil {
-			c.metrics.RecordRequestCompletion(ctx, false)
+			c.metrics.RecordRequestCompletion(ctx, false, c.metricAttrs...)
 		}
 	}()
 
@@ -189,7 +503,17 @@ func (c *chatCompletionProcessorUpstreamFilter) ProcessRequestHeaders(ctx contex
 	c.metrics.StartRequest(c.requestHeaders)
 	c.metrics.SetModel(c.requestHeaders[c.config.modelNameHeaderKey])
 
-	headerMutation, bodyMutation, err := c.translator.RequestBody(c.originalRequestBodyRaw, c.originalRequestBody, c.onRetry)
+	if spill, err := c.acquireConcurrencySlot(ctx, c.metrics, c.requestHeaders); err != nil {
+		return nil, fmt.Errorf("failed to acquire the concurrency slot: %w", err)
+	} else if spill != nil {
+		if c.hedge != nil {
+			c.hedge.responded(c.hedgeAttempt)
+		}
+		return spill, nil
+	}
+
+	// The hedged attempt is built from the original request body in the same way as the retry.
+	headerMutation, bodyMutation, err := c.translator.RequestBody(c.originalRequestBodyRaw, c.originalRequestBody, c.onRetry || c.isHedge)
 	if err != nil {
 		return nil, fmt.Errorf("failed to transform request: %w", err)
 	}
@@ -200,6 +524,13 @@ func (c *chatCompletionProcessorUpstreamFilter) ProcessRequestHeaders(ctx contex
 			c.requestHeaders[h.Header.Key] = string(h.Header.RawValue)
 		}
 	}
+	if bodyMutation == nil && c.requestBodyRewritten {
+		bodyMutation = rewrittenRequestBodyMutation(headerMutation, c.originalRequestBodyRaw)
+	}
+	if c.captureAttempt != nil {
+		// This is recorded before the authentication so that the credentials are never captured.
+		c.capture.recordRequest(c.captureAttempt, headerMutation, bodyMutation)
+	}
 	if h := c.handler; h != nil {
 		if err = h.Do(ctx, c.requestHeaders, headerMutation, bodyMutation); err != nil {
 			return nil, fmt.Errorf("failed to do auth request: %w", err)
@@ -231,9 +562,22 @@ func (c *chatCompletionProcessorUpstreamFilter) ProcessRequestBody(context.Conte
 
 // ProcessResponseHeaders implements [Processor.ProcessResponseHeaders].
 func (c *chatCompletionProcessorUpstreamFilter) ProcessResponseHeaders(ctx context.Context, headers *corev3.HeaderMap) (res *extprocv3.ProcessingResponse, err error) {
+	if c.hedge != nil && !c.hedgeResponseSeen {
+		// The response headers are sent to the upstream filter only for the rules with the hedge policy,
+		// and that always happens before the router filter sees them. The response headers are tagged with
+		// this attempt so that the router filter uses this upstream filter to process the rest of the response
+		// if Envoy returns this response to the client rather than retrying it or cancelling it.
+		c.hedgeResponseSeen = true
+		c.hedge.responded(c.hedgeAttempt)
+		return &extprocv3.ProcessingResponse{Response: &extprocv3.ProcessingResponse_ResponseHeaders{ResponseHeaders: &extprocv3.HeadersResponse{
+			Response: &extprocv3.CommonResponse{HeaderMutation: &extprocv3.HeaderMutation{SetHeaders: []*corev3.HeaderValueOption{{
+				Header: &corev3.HeaderValue{Key: internalapi.HedgeAttemptHeader, RawValue: []byte(strconv.Itoa(c.hedgeAttempt))},
+			}}}},
+		}}}, nil
+	}
 	defer func() {
 		if err != nil {
-			c.metrics.RecordRequestCompletion(ctx, false)
+			c.metrics.RecordRequestCompletion(ctx, false, c.metricAttrs...)
 		}
 	}()
 
@@ -241,6 +585,9 @@ func (c *chatCompletionProcessorUpstreamFilter) ProcessResponseHeaders(ctx conte
 	if enc := c.responseHeaders["content-encoding"]; enc != "" {
 		c.responseEncoding = enc
 	}
+	if c.captureAttempt != nil {
+		c.capture.recordResponseHeaders(c.captureAttempt, c.responseHeaders)
+	}
 	headerMutation, err := c.translator.ResponseHeaders(c.responseHeaders)
 	if err != nil {
 		return nil, fmt.Errorf("failed to transform response headers: %w", err)
@@ -260,10 +607,12 @@ func (c *chatCompletionProcessorUpstreamFilter) ProcessResponseHeaders(ctx conte
 // ProcessResponseBody implements [Processor.ProcessResponseBody].
 func (c *chatCompletionProcessorUpstreamFilter) ProcessResponseBody(ctx context.Context, body *extprocv3.HttpBody) (res *extprocv3.ProcessingResponse, err error) {
 	defer func() {
-		c.metrics.RecordRequestCompletion(ctx, err == nil)
+		c.metrics.RecordRequestCompletion(ctx, err == nil, c.metricAttrs...)
 	}()
 	var br io.Reader
 	var isGzip bool
+	// decoded is the response body before the translation, which is only needed for the shadow comparison.
+	var decoded []byte
 	switch c.responseEncoding {
 	case "gzip":
 		br, err = gzip.NewReader(bytes.NewReader(body.Body))
@@ -271,14 +620,106 @@ func (c *chatCompletionProcessorUpstreamFilter) ProcessResponseBody(ctx context.
 			return nil, fmt.Errorf("failed to decode gzip: %w", err)
 		}
 		isGzip = true
+		if c.shadowRecorder != nil || c.piiDetokenizer != nil || c.responseGuardrails || c.toolPolicy != nil || c.secrets != nil ||
+			c.conversationAudit != nil || c.responseCache != nil || trace.SpanFromContext(ctx).IsRecording() {
+			if decoded, err = io.ReadAll(br); err != nil {
+				return nil, fmt.Errorf("failed to decode gzip: %w", err)
+			}
+			br = bytes.NewReader(decoded)
+		}
 	default:
 		br = bytes.NewReader(body.Body)
+		decoded = body.Body
 	}
 
 	headerMutation, bodyMutation, tokenUsage, err := c.translator.ResponseBody(c.responseHeaders, br, body.EndOfStream)
 	if err != nil {
 		return nil, fmt.Errorf("failed to transform response: %w", err)
 	}
+	if c.shadowRecorder != nil {
+		if bm := bodyMutation.GetBody(); bm != nil {
+			c.shadowRecorder.append(bm)
+		} else {
+			c.shadowRecorder.append(decoded)
+		}
+	}
+	// blocked is the local reply replacing the response blocked by the external guardrail services, the tool policy or
+	// the secret guardrail.
+	var blocked *extprocv3.ProcessingResponse
+	if c.responseGuardrails && body.EndOfStream && c.responseHeaders[":status"] == "200" {
+		response := decoded
+		if bm := bodyMutation.GetBody(); bm != nil {
+			response = bm
+		}
+		var rewritten []byte
+		rewritten, blocked = applyExternalGuardrails(ctx, c.config, c.logger, c.metrics, guardrail.ExternalPhaseResponse,
+			externalGuardrailOperationChatCompletions, c.requestHeaders[c.config.modelNameHeaderKey], c.originalRequestBodyRaw, response, c.metricAttrs...)
+		if rewritten != nil {
+			bodyMutation = &extprocv3.BodyMutation{Mutation: &extprocv3.BodyMutation_Body{Body: rewritten}}
+		}
+	}
+	if c.toolPolicy != nil && c.responseHeaders[":status"] == "200" && blocked == nil {
+		model := c.requestHeaders[c.config.modelNameHeaderKey]
+		response := decoded
+		if bm := bodyMutation.GetBody(); bm != nil {
+			response = bm
+		}
+		if c.stream {
+			filtered, terminated := filterStreamToolCalls(ctx, c.config, c.metrics, c.toolCallFilter, c.toolPolicy, model,
+				c.requestHeaders, response, body.EndOfStream, c.metricAttrs...)
+			bodyMutation = &extprocv3.BodyMutation{Mutation: &extprocv3.BodyMutation_Body{Body: filtered}}
+			c.streamTerminated = c.streamTerminated || terminated
+		} else if body.EndOfStream {
+			var stripped []byte
+			stripped, blocked = enforceResponseToolPolicy(ctx, c.config, c.metrics, c.toolPolicy, model, c.requestHeaders, response, c.metricAttrs...)
+			if stripped != nil {
+				bodyMutation = &extprocv3.BodyMutation{Mutation: &extprocv3.BodyMutation_Body{Body: stripped}}
+			}
+		}
+	}
+	if c.secrets != nil && c.responseHeaders[":status"] == "200" && blocked == nil {
+		model := c.requestHeaders[c.config.modelNameHeaderKey]
+		response := decoded
+		if bm := bodyMutation.GetBody(); bm != nil {
+			response = bm
+		}
+		if c.stream {
+			scanned, terminated := scanStreamSecrets(ctx, c.logger, c.metrics, c.secretStreamScanner, c.secrets.Action(), model,
+				response, body.EndOfStream, c.metricAttrs...)
+			bodyMutation = &extprocv3.BodyMutation{Mutation: &extprocv3.BodyMutation_Body{Body: scanned}}
+			c.streamTerminated = c.streamTerminated || terminated
+		} else if body.EndOfStream {
+			var redacted []byte
+			if redacted, blocked = scanResponseSecrets(ctx, c.logger, c.metrics, c.secrets, model, response, c.metricAttrs...); redacted != nil {
+				bodyMutation = &extprocv3.BodyMutation{Mutation: &extprocv3.BodyMutation_Body{Body: redacted}}
+			}
+		}
+	}
+	if c.piiDetokenizer != nil {
+		bodyMutation = detokenizeResponseBody(c.piiDetokenizer, c.stream, bodyMutation, decoded, body.EndOfStream)
+	}
+	if c.conversationAudit != nil {
+		c.captureConversation(decoded, bodyMutation, blocked, body.EndOfStream)
+	}
+	if c.captureAttempt != nil {
+		if bm := bodyMutation.GetBody(); bm != nil {
+			c.capture.recordResponseBody(c.captureAttempt, body.Body, bm)
+		} else {
+			c.capture.recordResponseBody(c.captureAttempt, body.Body, body.Body)
+		}
+		c.capture.recordLocalReply(blocked)
+	}
+	if c.responseCache != nil && c.responseHeaders[":status"] == "200" {
+		// The response is stored decoded since the cached response is served without the content encoding.
+		if bm := bodyMutation.GetBody(); bm != nil {
+			c.responseCache.append(bm)
+		} else {
+			c.responseCache.append(decoded)
+		}
+		if body.EndOfStream && blocked == nil && !c.streamTerminated {
+			c.responseCache.store(ctx, c.logger)
+		}
+	}
 	if bodyMutation != nil && isGzip {
 		if headerMutation == nil {
 			headerMutation = &extprocv3.HeaderMutation{}
@@ -307,17 +748,65 @@ func (c *chatCompletionProcessorUpstreamFilter) ProcessResponseBody(ctx context.
 	c.costs.InputTokens += tokenUsage.InputTokens
 	c.costs.OutputTokens += tokenUsage.OutputTokens
 	c.costs.TotalTokens += tokenUsage.TotalTokens
+	c.costs.CachedInputTokens += tokenUsage.CachedInputTokens
+	c.costs.ReasoningTokens += tokenUsage.ReasoningTokens
+	if span := trace.SpanFromContext(ctx); span.IsRecording() && c.responseHeaders[":status"] == "200" && blocked == nil {
+		if c.responseSpan == nil {
+			c.responseSpan = newChatCompletionResponseSpan(span, c.backendSchema, c.stream, c.config.traceContent)
+		}
+		if bm := bodyMutation.GetBody(); bm != nil {
+			c.responseSpan.record(bm, body.EndOfStream, &c.costs)
+		} else {
+			c.responseSpan.record(decoded, body.EndOfStream, &c.costs)
+		}
+	}
 
 	// Update metrics with token usage.
-	c.metrics.RecordTokenUsage(ctx, tokenUsage.InputTokens, tokenUsage.OutputTokens, tokenUsage.TotalTokens)
+	c.metrics.RecordTokenUsage(ctx, tokenUsage.InputTokens, tokenUsage.OutputTokens, tokenUsage.TotalTokens, c.metricAttrs...)
 	if c.stream {
 		// Token latency is only recorded for streaming responses, otherwise it doesn't make sense since
 		// these metrics are defined as a difference between the two output events.
-		c.metrics.RecordTokenLatency(ctx, tokenUsage.OutputTokens)
+		c.metrics.RecordTokenLatency(ctx, tokenUsage.OutputTokens, c.metricAttrs...)
+	}
+
+	if body.EndOfStream && c.shadow != nil {
+		c.shadow.report(ctx, c.metrics,
+			c.shadowRecorder.result(c.backendName, c.responseHeaders[":status"] == "200", &c.costs), c.isShadow)
+	}
+
+	// The calibration is based on the actual usage of the response, so this precedes the hedged attempts.
+	if body.EndOfStream && c.tokenEstimate != nil {
+		c.config.tokenCalibrator.observe(c.tokenEstimate.model, c.tokenEstimate.rawInput, c.costs.InputTokens)
+	}
+
+	var pricing *llmcostcel.Pricing
+	if body.EndOfStream && !c.isShadow {
+		if pricing = computePricing(c.price, &c.costs, c.media); pricing != nil {
+			c.metrics.RecordCost(ctx, pricing.CostMicroUSD, c.metricAttrs...)
+		}
+	}
+
+	var hedgedAttempts int
+	if body.EndOfStream && c.hedge != nil {
+		hedgedAttempts = c.accountHedgedAttempts(ctx, pricing)
 	}
 
-	if body.EndOfStream && len(c.config.requestCosts) > 0 {
-		metadata, err := buildDynamicMetadata(c.config, &c.costs, c.requestHeaders, c.modelNameOverride, c.backendName)
+	var costContext *llmcostcel.RequestContext
+	if body.EndOfStream {
+		costContext = c.newRequestCostContext(pricing)
+	}
+
+	// The shadow requests are not charged since the quota is only set for the primary ones.
+	if body.EndOfStream && c.quota != nil {
+		c.quota.charge(ctx, c.logger, costContext)
+	}
+	if body.EndOfStream && !c.isShadow {
+		exportUsageRecord(ctx, c.config, usageLedgerOperationChatCompletion, costContext, c.modelNameOverride, c.responseHeaders, c.requestStart)
+	}
+
+	// The costs of the shadow requests are only tracked in the shadow comparison.
+	if body.EndOfStream && (len(c.config.requestCosts) > 0 || pricing != nil) && !c.isShadow {
+		metadata, err := buildDynamicMetadata(c.config, costContext, c.modelNameOverride)
 		if err != nil {
 			return nil, fmt.Errorf("failed to build dynamic metadata: %w", err)
 		}
@@ -327,35 +816,177 @@ func (c *chatCompletionProcessorUpstreamFilter) ProcessResponseBody(ctx context.
 		}
 		resp.DynamicMetadata = metadata
 	}
+	if hedgedAttempts > 0 {
+		if resp.DynamicMetadata == nil {
+			resp.DynamicMetadata = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+		}
+		mergeWithHedgedAttemptsMetadata(c.config, resp.DynamicMetadata, hedgedAttempts)
+	}
+	if blocked != nil {
+		// The usage of the blocked response is still accounted above since the backend has processed the request.
+		resp.Response = blocked.Response
+	}
 
 	return resp, nil
 }
 
+// captureConversation captures the part of the response returned to the client for the audit log, and exports the
+// record at the end of the stream.
+func (c *chatCompletionProcessorUpstreamFilter) captureConversation(decoded []byte, bodyMutation *extprocv3.BodyMutation,
+	blocked *extprocv3.ProcessingResponse, endOfStream bool,
+) {
+	if bm := bodyMutation.GetBody(); bm != nil {
+		c.conversationResponse.append(bm)
+	} else {
+		c.conversationResponse.append(decoded)
+	}
+	if !endOfStream {
+		return
+	}
+	status := conversationStatus(c.responseHeaders)
+	if ir := blocked.GetImmediateResponse(); ir != nil {
+		c.conversationResponse = conversationResponse{}
+		c.conversationResponse.append(ir.Body)
+		status = int(ir.GetStatus().GetCode())
+	}
+	c.conversationAudit.export(c.requestHeaders, c.backendName, c.stream, status, &c.conversationResponse)
+}
+
+// accountHedgedAttempts adds the estimated usage of the attempts started by the hedge policy to the costs of the
+// request and to the pricing if any, and returns the number of such attempts.
+//
+// The extra attempts were cancelled by Envoy before their response was processed, so their usage is unknown.
+// Since they were sent with the same prompt, each is estimated to have consumed the same number of input tokens
+// as the winning attempt, while their output tokens are not accounted. The estimation is recorded in the token
+// usage and the cost with the hedgedAttemptAttribute, and is charged to the quotas of the request with the rest.
+func (c *chatCompletionProcessorUpstreamFilter) accountHedgedAttempts(ctx context.Context, pricing *llmcostcel.Pricing) int {
+	hedged := c.hedge.hedgedAttempts()
+	if hedged == 0 {
+		return 0
+	}
+	inputTokens := uint32(hedged) * c.costs.InputTokens //nolint:gosec
+	attrs := append(slices.Clone(c.metricAttrs), hedgedAttemptAttribute)
+	c.metrics.RecordHedgedAttempts(ctx, hedged, c.metricAttrs...)
+	c.metrics.RecordTokenUsage(ctx, inputTokens, 0, inputTokens, attrs...)
+	if pricing != nil {
+		// Each attempt carried the same media as the winning one.
+		media := c.media
+		media.images *= uint32(hedged) //nolint:gosec
+		media.audioSeconds *= float64(hedged)
+		if p := computePricing(c.price, &translator.LLMTokenUsage{InputTokens: inputTokens, TotalTokens: inputTokens}, media); p != nil {
+			c.metrics.RecordCost(ctx, p.CostMicroUSD, attrs...)
+			pricing.CostMicroUSD += p.CostMicroUSD
+		}
+	}
+	c.costs.InputTokens += inputTokens
+	c.costs.TotalTokens += inputTokens
+	return hedged
+}
+
 // SetBackend implements [Processor.SetBackend].
 func (c *chatCompletionProcessorUpstreamFilter) SetBackend(ctx context.Context, b *filterapi.Backend, backendHandler backendauth.Handler, routeProcessor Processor) (err error) {
 	defer func() {
-		c.metrics.RecordRequestCompletion(ctx, err == nil)
+		c.metrics.RecordRequestCompletion(ctx, err == nil, c.metricAttrs...)
 	}()
 	rp, ok := routeProcessor.(*chatCompletionProcessorRouterFilter)
 	if !ok {
 		panic("BUG: expected routeProcessor to be of type *chatCompletionProcessorRouterFilter")
 	}
-	rp.upstreamFilterCount++
+	var rule *filterapi.RouteRule
+	if backend, ok := c.config.backends[b.Name]; ok {
+		rule = backend.rule
+		c.isShadow = backend.shadow
+		c.limiter = backend.limiter
+	}
+	if c.isShadow {
+		// The shadow request is processed independently of the primary one, so it must neither update the state
+		// of the router filter nor be recorded in the regular metrics.
+		c.metrics = shadowChatCompletionMetrics{c.metrics}
+	} else {
+		if rule != nil && rule.HedgePolicy != nil {
+			c.hedge = &rp.hedge
+			c.hedgeAttempt, c.isHedge = c.hedge.start(c, rule.HedgePolicy.FirstResponseTimeout, time.Now())
+			// Hedged attempts run concurrently, so the router filter must be updated with the lock held.
+			c.hedge.mu.Lock()
+			defer c.hedge.mu.Unlock()
+		}
+		if !c.isHedge {
+			rp.upstreamFilterCount++
+		}
+		c.quota = rp.quota
+		c.tokenEstimate = rp.tokenEstimate
+		c.price = findModelPrice(c.config, c.requestHeaders[c.config.modelNameHeaderKey], b.Name)
+		c.media = rp.media
+		c.requestStart = rp.requestStart
+		c.conversationAudit = rp.conversationAudit
+		c.responseCache = rp.responseCache
+		if rp.piiVault != nil {
+			c.piiDetokenizer = guardrail.NewPIIDetokenizer(rp.piiVault)
+		}
+	}
+	c.requestBodyRewritten = rp.requestBodyRewritten
+	if rule != nil && rule.Shadow != nil {
+		if c.shadow = rp.sampleShadow(rule.Shadow); c.shadow != nil {
+			c.shadowRecorder = newShadowResponseRecorder(rp.originalRequestBody)
+		}
+	}
+	if rp.experimentVariant != "" {
+		c.metricAttrs = experimentMetricAttributes(rp.experiment, rp.experimentVariant)
+	}
+	if rp.consumerKey != nil {
+		c.metricAttrs = append(c.metricAttrs, consumerKeyMetricAttributes(rp.consumerKey)...)
+	}
+	c.metricAttrs = append(c.metricAttrs, rp.routeMetricAttrs...)
 	c.metrics.SetBackend(b)
+	if rp.prefixCacheAffinityKey != "" && c.upstreamAddress != "" && !c.isShadow {
+		if hit, seen := c.affinity.observe(rp.prefixCacheAffinityKey, c.upstreamAddress); seen {
+			c.metrics.RecordPrefixCacheAffinity(ctx, hit)
+		}
+	}
 	c.modelNameOverride = b.ModelNameOverride
 	c.backendName = b.Name
+	c.backendSchema = b.Schema.Name
+	traceBackend(ctx, tracing.OperationChat, c.requestHeaders[c.config.modelNameHeaderKey], b)
 	if err = c.selectTranslator(b.Schema); err != nil {
 		return fmt.Errorf("failed to select translator: %w", err)
 	}
 	c.handler = backendHandler
 	c.originalRequestBody = rp.originalRequestBody
 	c.originalRequestBodyRaw = rp.originalRequestBodyRaw
-	c.onRetry = rp.upstreamFilterCount > 1
+	c.onRetry = !c.isShadow && rp.upstreamFilterCount > 1
 	c.stream = c.originalRequestBody.Stream
-	rp.upstreamFilter = c
+	if !c.isShadow {
+		// The router filter reads c.upstreamFilter without the lock, so the hedged attempts which may run concurrently
+		// with the response processing are only tracked by the hedge state.
+		if c.hedge == nil {
+			rp.upstreamFilter = c
+		}
+		c.responseGuardrails = !c.stream && hasExternalGuardrails(c.config, c.requestHeaders[c.config.modelNameHeaderKey], guardrail.ExternalPhaseResponse)
+		if c.toolPolicy = toolPolicyOf(c.config, c.requestHeaders[c.config.modelNameHeaderKey]); c.toolPolicy != nil && c.stream {
+			c.toolCallFilter = guardrail.NewToolCallFilter(c.toolPolicy)
+		}
+		if c.secrets = secretScannerOf(c.config, c.requestHeaders[c.config.modelNameHeaderKey]); c.secrets != nil && c.stream {
+			c.secretStreamScanner = guardrail.NewSecretStreamScanner(c.secrets)
+		}
+		if c.capture = rp.capture; c.capture != nil {
+			c.captureAttempt = c.capture.startAttempt(b, c.onRetry)
+		}
+	}
 	return
 }
 
+// newRequestCostContext creates the context to calculate the request costs from the accumulated usage.
+func (c *chatCompletionProcessorUpstreamFilter) newRequestCostContext(pricing *llmcostcel.Pricing) *llmcostcel.RequestContext {
+	cc := newRequestCostContext(c.config, &c.costs, pricing, c.requestHeaders, c.backendName)
+	cc.Request.Stream = c.stream
+	cc.Request.Retry = c.onRetry
+	cc.Request.Images = c.media.images
+	if body := c.originalRequestBody; body != nil && body.N != nil && *body.N > 0 {
+		cc.Request.N = uint32(*body.N) //nolint:gosec
+	}
+	return cc
+}
+
 func (c *chatCompletionProcessorUpstreamFilter) mergeWithTokenLatencyMetadata(metadata *structpb.Struct) {
 	timeToFirstTokenMs := c.metrics.GetTimeToFirstTokenMs()
 	interTokenLatencyMs := c.metrics.GetInterTokenLatencyMs()
@@ -369,6 +1000,17 @@ func (c *chatCompletionProcessorUpstreamFilter) mergeWithTokenLatencyMetadata(me
 	innerVal.Fields["token_latency_itl"] = &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: interTokenLatencyMs}}
 }
 
+// mergeWithHedgedAttemptsMetadata adds the number of the attempts started by the hedge policy to the metadata.
+func mergeWithHedgedAttemptsMetadata(config *processorConfig, metadata *structpb.Struct, hedgedAttempts int) {
+	ns := config.metadataNamespace
+	innerVal := metadata.Fields[ns].GetStructValue()
+	if innerVal == nil {
+		innerVal = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+		metadata.Fields[ns] = structpb.NewStructValue(innerVal)
+	}
+	innerVal.Fields["hedged_attempts"] = structpb.NewNumberValue(float64(hedgedAttempts))
+}
+
 func parseOpenAIChatCompletionBody(body *extprocv3.HttpBody) (modelName string, rb *openai.ChatCompletionRequest, err error) {
 	var openAIReq openai.ChatCompletionRequest
 	if err := json.Unmarshal(body.Body, &openAIReq); err != nil {
@@ -404,44 +1046,66 @@ func buildContentLengthDynamicMetadataOnRequest(config *processorConfig, content
 	return metadata
 }
 
-func buildDynamicMetadata(config *processorConfig, costs *translator.LLMTokenUsage, requestHeaders map[string]string, modelNameOverride, backendName string) (*structpb.Struct, error) {
-	metadataCost := make(map[string]*structpb.Value, len(config.requestCosts))
+// newRequestCostContext creates the context to calculate the request costs from the usage of the request.
+// pricing is the cost computed from the pricing catalog, which is nil if the model has no price.
+//
+// The attributes of the request specific to the endpoint are set by the caller.
+func newRequestCostContext(config *processorConfig, costs *translator.LLMTokenUsage, pricing *llmcostcel.Pricing, requestHeaders map[string]string, backendName string) *llmcostcel.RequestContext {
+	return &llmcostcel.RequestContext{
+		Model:             requestHeaders[config.modelNameHeaderKey],
+		Backend:           backendName,
+		InputTokens:       costs.InputTokens,
+		OutputTokens:      costs.OutputTokens,
+		TotalTokens:       costs.TotalTokens,
+		CachedInputTokens: costs.CachedInputTokens,
+		ReasoningTokens:   costs.ReasoningTokens,
+		Pricing:           pricing,
+		Request:           llmcostcel.Request{Headers: requestHeaders, N: 1},
+	}
+}
+
+// calculateRequestCost calculates the cost of the request for the given request cost configuration.
+// The costs estimated before the request is sent upstream are reconciled with the actual usage here.
+func calculateRequestCost(rc *processorConfigRequestCost, cc *llmcostcel.RequestContext) (uint32, error) {
+	switch rc.Type {
+	case filterapi.LLMRequestCostTypeInputToken, filterapi.LLMRequestCostTypeEstimatedInputToken:
+		return cc.InputTokens, nil
+	case filterapi.LLMRequestCostTypeOutputToken, filterapi.LLMRequestCostTypeReservedOutputToken:
+		return cc.OutputTokens, nil
+	case filterapi.LLMRequestCostTypeTotalToken, filterapi.LLMRequestCostTypeReservedTotalToken:
+		return cc.TotalTokens, nil
+	case filterapi.LLMRequestCostTypeCEL:
+		costU64, err := llmcostcel.EvaluateProgram(rc.celProg, cc)
+		if err != nil {
+			return 0, fmt.Errorf("failed to evaluate CEL expression: %w", err)
+		}
+		return uint32(costU64), nil //nolint:gosec
+	default:
+		return 0, fmt.Errorf("unknown request cost kind: %s", rc.Type)
+	}
+}
+
+func buildDynamicMetadata(config *processorConfig, cc *llmcostcel.RequestContext, modelNameOverride string) (*structpb.Struct, error) {
+	metadataCost := make(map[string]*structpb.Value, len(config.requestCosts)+1)
 	for i := range config.requestCosts {
 		rc := &config.requestCosts[i]
-		var cost uint32
-		switch rc.Type {
-		case filterapi.LLMRequestCostTypeInputToken:
-			cost = costs.InputTokens
-		case filterapi.LLMRequestCostTypeOutputToken:
-			cost = costs.OutputTokens
-		case filterapi.LLMRequestCostTypeTotalToken:
-			cost = costs.TotalTokens
-		case filterapi.LLMRequestCostTypeCEL:
-			costU64, err := llmcostcel.EvaluateProgram(
-				rc.celProg,
-				requestHeaders[config.modelNameHeaderKey],
-				backendName,
-				costs.InputTokens,
-				costs.OutputTokens,
-				costs.TotalTokens,
-			)
-			if err != nil {
-				return nil, fmt.Errorf("failed to evaluate CEL expression: %w", err)
-			}
-			cost = uint32(costU64) //nolint:gosec
-		default:
-			return nil, fmt.Errorf("unknown request cost kind: %s", rc.Type)
+		cost, err := calculateRequestCost(rc, cc)
+		if err != nil {
+			return nil, err
 		}
 		metadataCost[rc.MetadataKey] = &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: float64(cost)}}
 	}
+	if cc.Pricing != nil {
+		metadataCost[costMicroUSDMetadataKey] = structpb.NewNumberValue(float64(cc.Pricing.CostMicroUSD))
+	}
 
 	metadataRoute := make(map[string]*structpb.Value, 2)
 	if modelNameOverride != "" {
 		metadataRoute["model_name_override"] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: modelNameOverride}}
 	}
 
-	if backendName != "" {
-		metadataRoute["backend_name"] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: backendName}}
+	if cc.Backend != "" {
+		metadataRoute["backend_name"] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: cc.Backend}}
 	}
 
 	metadata := &structpb.Struct{
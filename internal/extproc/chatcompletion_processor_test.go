@@ -18,11 +18,16 @@ import (
 	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/utils/ptr"
 
+	"bytes"
+	"compress/gzip"
 	"github.com/envoyproxy/ai-gateway/filterapi"
 	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
 	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
 	"github.com/envoyproxy/ai-gateway/internal/llmcostcel"
+	"time"
 )
 
 func TestChatCompletion_Schema(t *testing.T) {
@@ -191,11 +196,15 @@ func Test_chatCompletionProcessorUpstreamFilter_ProcessResponseBody(t *testing.T
 		require.NoError(t, err)
 		celProgUint, err := llmcostcel.NewProgram("uint(9999)")
 		require.NoError(t, err)
+		celProgRequest, err := llmcostcel.NewProgram("request.stream && request.headers[?'x-tier'].orValue('') == 'gold' ? output_tokens * request.n : uint(0)")
+		require.NoError(t, err)
 		p := &chatCompletionProcessorUpstreamFilter{
-			translator: mt,
-			logger:     slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})),
-			metrics:    mm,
-			stream:     true,
+			translator:          mt,
+			logger:              slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})),
+			metrics:             mm,
+			stream:              true,
+			requestHeaders:      map[string]string{"x-tier": "gold"},
+			originalRequestBody: &openai.ChatCompletionRequest{N: ptr.To(2)},
 			config: &processorConfig{
 				metadataNamespace: "ai_gateway_llm_ns",
 				requestCosts: []processorConfigRequestCost{
@@ -209,6 +218,10 @@ func Test_chatCompletionProcessorUpstreamFilter_ProcessResponseBody(t *testing.T
 						celProg:        celProgUint,
 						LLMRequestCost: &filterapi.LLMRequestCost{Type: filterapi.LLMRequestCostTypeCEL, MetadataKey: "cel_uint"},
 					},
+					{
+						celProg:        celProgRequest,
+						LLMRequestCost: &filterapi.LLMRequestCost{Type: filterapi.LLMRequestCostTypeCEL, MetadataKey: "cel_request"},
+					},
 				},
 			},
 			backendName:       "some_backend",
@@ -232,6 +245,8 @@ func Test_chatCompletionProcessorUpstreamFilter_ProcessResponseBody(t *testing.T
 			GetStructValue().Fields["cel_int"].GetNumberValue())
 		require.Equal(t, float64(9999), md.Fields["ai_gateway_llm_ns"].
 			GetStructValue().Fields["cel_uint"].GetNumberValue())
+		require.Equal(t, float64(246), md.Fields["ai_gateway_llm_ns"].
+			GetStructValue().Fields["cel_request"].GetNumberValue())
 		require.Equal(t, "ai_gateway_llm", md.Fields["route"].GetStructValue().Fields["model_name_override"].GetStringValue())
 		require.Equal(t, "some_backend", md.Fields["route"].GetStructValue().Fields["backend_name"].GetStringValue())
 	})
@@ -246,6 +261,180 @@ func bodyFromModel(t *testing.T, model string, stream bool) []byte {
 	return bytes
 }
 
+func Test_chatCompletionProcessor_responseBodyChain(t *testing.T) {
+	const backendName = "backend"
+	newRule := func() filterapi.RouteRule {
+		guardrails := piiTestGuardrails(filterapi.PIIActionTokenize)
+		guardrails.Secrets = &filterapi.SecretGuardrail{Action: filterapi.SecretActionBlock, Response: true}
+		return filterapi.RouteRule{
+			Guardrails:    guardrails,
+			ToolPolicy:    searchToolPolicy(false),
+			ResponseCache: &filterapi.ResponseCache{TTL: time.Minute, MaxEntryBytes: 4096},
+		}
+	}
+	newRouter := func(config *processorConfig, metrics *mockChatCompletionMetrics) *chatCompletionProcessorRouterFilter {
+		return &chatCompletionProcessorRouterFilter{
+			config: config, logger: slog.Default(), metrics: metrics,
+			requestHeaders: map[string]string{":path": "/v1/chat/completions"},
+		}
+	}
+	newUpstream := func(t *testing.T, rp *chatCompletionProcessorRouterFilter, metrics *mockChatCompletionMetrics) *chatCompletionProcessorUpstreamFilter {
+		up := &chatCompletionProcessorUpstreamFilter{
+			config: rp.config, logger: slog.Default(), metrics: metrics, requestHeaders: rp.requestHeaders,
+		}
+		require.NoError(t, up.SetBackend(t.Context(), &filterapi.Backend{
+			Name: backendName, Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+		}, nil, rp))
+		_, err := up.ProcessRequestHeaders(t.Context(), nil)
+		require.NoError(t, err)
+		return up
+	}
+	// process processes the response at the router filter, and returns the response body sent to the client and the
+	// headers removed from the response.
+	process := func(t *testing.T, rp *chatCompletionProcessorRouterFilter, headers []*corev3.HeaderValue, chunks ...[]byte) (out []byte, removed []string) {
+		_, err := rp.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{Headers: headers})
+		require.NoError(t, err)
+		for i, chunk := range chunks {
+			res, err := rp.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{Body: chunk, EndOfStream: i == len(chunks)-1})
+			require.NoError(t, err)
+			common := res.GetResponseBody().Response
+			if bm := common.BodyMutation.GetBody(); bm != nil {
+				out = append(out, bm...)
+			} else {
+				out = append(out, chunk...)
+			}
+			removed = append(removed, common.HeaderMutation.GetRemoveHeaders()...)
+		}
+		return out, removed
+	}
+	// cached returns the response cached for the request, which is nil if the request misses the cache.
+	cached := func(t *testing.T, config *processorConfig, request string) []byte {
+		res, err := newRouter(config, &mockChatCompletionMetrics{}).ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(request)})
+		require.NoError(t, err)
+		return res.GetImmediateResponse().GetBody()
+	}
+	streamHeaders := []*corev3.HeaderValue{
+		{Key: ":status", RawValue: []byte("200")}, {Key: "content-type", RawValue: []byte("text/event-stream")},
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		const request = `{"model":"gpt","messages":[{"role":"user","content":"mail jane@example.com"}]}`
+		config := newTestRuleConfig(t, newRule())
+		metrics := &mockChatCompletionMetrics{}
+		rp := newRouter(config, metrics)
+		_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(request)})
+		require.NoError(t, err)
+		newUpstream(t, rp, metrics)
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		_, err = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"Sent to [PII_EMAIL_1]."}}]}`))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		// The non-streaming response is buffered by Envoy, so it is decoded at once.
+		out, removed := process(t, rp, []*corev3.HeaderValue{
+			{Key: ":status", RawValue: []byte("200")}, {Key: "content-encoding", RawValue: []byte("gzip")},
+		}, compressed.Bytes())
+		// The response is decoded to be detokenized, so it is sent without the content encoding.
+		require.JSONEq(t, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Sent to jane@example.com."}}]}`, string(out))
+		require.Contains(t, removed, "content-encoding")
+		require.Equal(t, out, cached(t, config, request))
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		const request = `{"model":"gpt","stream":true,"messages":[{"role":"user","content":"mail jane@example.com"}]}`
+		config := newTestRuleConfig(t, newRule())
+		metrics := &mockChatCompletionMetrics{}
+		rp := newRouter(config, metrics)
+		_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(request)})
+		require.NoError(t, err)
+		newUpstream(t, rp, metrics)
+
+		out, _ := process(t, rp, streamHeaders,
+			[]byte(`data: {"choices":[{"index":0,"delta":{"content":"Sent to [PII_EM"}}]}`+"\n\ndata: {\"choi"),
+			[]byte(`ces":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"search_web","arguments":"{}"}}]}}]}`+"\n\n"),
+			[]byte(`data: {"choices":[{"index":0,"delta":{"content":"AIL_1]."},"finish_reason":"tool_calls"}]}`+"\n\ndata: [DONE]\n\n"),
+		)
+		require.Contains(t, string(out), `"content":"Sent to "`)
+		require.Contains(t, string(out), `"content":"jane@example.com."`)
+		require.Contains(t, string(out), `"name":"search_web"`)
+		require.NotContains(t, string(out), "PII_EMAIL")
+		require.True(t, bytes.HasSuffix(out, []byte("data: [DONE]\n\n")))
+		require.Equal(t, out, cached(t, config, request))
+	})
+
+	for _, tc := range []struct {
+		name   string
+		chunks []string
+		code   string
+	}{
+		{
+			name: "stream blocked by secret",
+			chunks: []string{
+				`data: {"choices":[{"index":0,"delta":{"content":"Use ghp_0123456789"}}]}` + "\n\n",
+				`data: {"choices":[{"index":0,"delta":{"content":"abcdefghijklmnopqrstuvwxyz."},"finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n",
+			},
+			code: "secret_detected",
+		},
+		{
+			name: "stream blocked by tool policy",
+			chunks: []string{
+				`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"delete_all","arguments":"{}"}}]}}]}` + "\n\n",
+				`data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}` + "\n\ndata: [DONE]\n\n",
+			},
+			code: "tool_not_allowed",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			const request = `{"model":"gpt","stream":true,"messages":[{"role":"user","content":"hello"}]}`
+			config := newTestRuleConfig(t, newRule())
+			metrics := &mockChatCompletionMetrics{}
+			rp := newRouter(config, metrics)
+			_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(request)})
+			require.NoError(t, err)
+			newUpstream(t, rp, metrics)
+
+			chunks := make([][]byte, len(tc.chunks))
+			for i, chunk := range tc.chunks {
+				chunks[i] = []byte(chunk)
+			}
+			out, _ := process(t, rp, streamHeaders, chunks...)
+			require.Contains(t, string(out), `"type":"error"`)
+			require.Contains(t, string(out), `"code":"`+tc.code+`"`)
+			require.NotContains(t, string(out), "[DONE]")
+			// The stream terminated with the error event must not be served from the cache.
+			require.Nil(t, cached(t, config, request))
+		})
+	}
+
+	t.Run("hedged", func(t *testing.T) {
+		const request = `{"model":"gpt","messages":[{"role":"user","content":"hello"}]}`
+		rule := newRule()
+		rule.HedgePolicy = &filterapi.HedgePolicy{MaxHedgedRequests: 1}
+		config := newTestRuleConfig(t, rule)
+		metrics := &mockChatCompletionMetrics{}
+		rp := newRouter(config, metrics)
+		_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(request)})
+		require.NoError(t, err)
+		original, hedged := newUpstream(t, rp, metrics), newUpstream(t, rp, metrics)
+		require.True(t, hedged.isHedge)
+		for _, up := range []*chatCompletionProcessorUpstreamFilter{original, hedged} {
+			_, err = up.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{})
+			require.NoError(t, err)
+		}
+
+		// The response of the hedged attempt is returned to the client, and is the only one stored in the cache.
+		const response = `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+		out, _ := process(t, rp, []*corev3.HeaderValue{
+			{Key: ":status", RawValue: []byte("200")}, {Key: internalapi.HedgeAttemptHeader, RawValue: []byte("1")},
+		}, []byte(response))
+		require.Equal(t, hedged, rp.upstreamFilter)
+		require.JSONEq(t, response, string(out))
+		require.Equal(t, 1, metrics.hedgedAttempts)
+		require.Equal(t, []byte(response), cached(t, config, request))
+	})
+}
+
 func Test_chatCompletionProcessorUpstreamFilter_SetBackend(t *testing.T) {
 	headers := map[string]string{":path": "/foo"}
 	mm := &mockChatCompletionMetrics{}
@@ -0,0 +1,273 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"container/heap"
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+)
+
+// concurrencyLimiters holds the concurrency limiters of the backends across the configuration reloads, so that
+// the requests in flight are still accounted after the configuration is updated.
+type concurrencyLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*concurrencyLimiter
+}
+
+// newConcurrencyLimiters creates a new concurrencyLimiters.
+func newConcurrencyLimiters() *concurrencyLimiters {
+	return &concurrencyLimiters{limiters: make(map[string]*concurrencyLimiter)}
+}
+
+// get returns the limiter for the given limit, creating it if it does not exist yet.
+// The existing limiter is updated with the given limit.
+func (l *concurrencyLimiters) get(limit *filterapi.ConcurrencyLimit) *concurrencyLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiter, ok := l.limiters[limit.Key]
+	if !ok {
+		limiter = &concurrencyLimiter{}
+		l.limiters[limit.Key] = limiter
+	}
+	limiter.setLimit(limit)
+	return limiter
+}
+
+// retain removes the limiters whose keys are not in keys, i.e., the ones of the backends removed from the
+// configuration. The requests holding or waiting for the slots of the removed limiters still release them.
+func (l *concurrencyLimiters) retain(keys map[string]struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	maps.DeleteFunc(l.limiters, func(key string, _ *concurrencyLimiter) bool {
+		_, ok := keys[key]
+		return !ok
+	})
+}
+
+// concurrencyLimiter limits the number of the requests in flight to a backend. The excess requests wait in
+// the queue ordered by their priority, and then by their arrival.
+type concurrencyLimiter struct {
+	mu       sync.Mutex
+	limit    *filterapi.ConcurrencyLimit
+	inFlight int
+	queue    concurrencyWaitQueue
+	// seq is the arrival sequence number of the next queued request.
+	seq uint64
+}
+
+// setLimit updates the limit and admits the queued requests if the maximum is raised.
+func (l *concurrencyLimiter) setLimit(limit *filterapi.ConcurrencyLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.admitLocked()
+}
+
+// config returns the current limit.
+func (l *concurrencyLimiter) config() *filterapi.ConcurrencyLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// acquire acquires the slot for a request with the given priority. This waits in the queue up to the queue timeout,
+// and returns false if the slot could not be acquired in time. The acquired slot must be released by release.
+//
+// onQueued is called when the request starts waiting in the queue, and onDequeued when it stops waiting.
+func (l *concurrencyLimiter) acquire(ctx context.Context, priority int, onQueued, onDequeued func()) (bool, error) {
+	l.mu.Lock()
+	if l.inFlight < l.limit.MaxInFlightRequests && l.queue.Len() == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return true, nil
+	}
+	timeout := l.limit.QueueTimeout
+	if timeout <= 0 {
+		l.mu.Unlock()
+		return false, nil
+	}
+	w := &concurrencyWaiter{priority: priority, seq: l.seq, admitted: make(chan struct{})}
+	l.seq++
+	heap.Push(&l.queue, w)
+	l.mu.Unlock()
+
+	onQueued()
+	defer onDequeued()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-w.admitted:
+		return true, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.index < 0 {
+		// The slot was given to this request concurrently with the timeout.
+		return true, nil
+	}
+	heap.Remove(&l.queue, w.index)
+	return false, ctx.Err()
+}
+
+// release releases the slot acquired by acquire, and admits the next queued request if any.
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.admitLocked()
+}
+
+// admitLocked admits the queued requests as long as the slots are available. This must be called with the lock held.
+func (l *concurrencyLimiter) admitLocked() {
+	for l.inFlight < l.limit.MaxInFlightRequests && l.queue.Len() > 0 {
+		w := heap.Pop(&l.queue).(*concurrencyWaiter)
+		l.inFlight++
+		close(w.admitted)
+	}
+}
+
+// concurrencyWaiter is a request waiting in the queue of the concurrencyLimiter.
+type concurrencyWaiter struct {
+	priority int
+	seq      uint64
+	admitted chan struct{}
+	// index is the index in the queue, or -1 once it's removed from the queue.
+	index int
+}
+
+// concurrencyWaitQueue implements [heap.Interface] to order the waiters by the priority and then by the arrival.
+type concurrencyWaitQueue []*concurrencyWaiter
+
+// Len implements [heap.Interface].
+func (q concurrencyWaitQueue) Len() int { return len(q) }
+
+// Less implements [heap.Interface].
+func (q concurrencyWaitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+// Swap implements [heap.Interface].
+func (q concurrencyWaitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+// Push implements [heap.Interface].
+func (q *concurrencyWaitQueue) Push(v any) {
+	w := v.(*concurrencyWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+// Pop implements [heap.Interface].
+func (q *concurrencyWaitQueue) Pop() any {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*q = old[:n-1]
+	return w
+}
+
+// concurrencyPriority returns the priority of the request according to its priority class. The higher value means
+// the higher priority, and the requests whose class is not listed have the lowest priority of zero.
+func concurrencyPriority(ctx context.Context, limit *filterapi.ConcurrencyLimit, requestHeaders map[string]string) int {
+	var class string
+	switch {
+	case limit.PriorityHeader != "":
+		class = requestHeaders[strings.ToLower(limit.PriorityHeader)]
+	case limit.PriorityJWTClaim != "":
+		class = jwtClaim(ctx, limit.PriorityJWTClaim)
+	default:
+		return 0
+	}
+	if i := slices.Index(limit.PriorityClasses, class); i >= 0 {
+		return len(limit.PriorityClasses) - i
+	}
+	return 0
+}
+
+// concurrencySlotReleaser is implemented by the upstream filters which may hold the slot of the concurrency limit
+// of the backend. The slot is held until the upstream request finishes, i.e., the processing stream is closed.
+type concurrencySlotReleaser interface {
+	// releaseConcurrencySlot releases the slot if it's held. This is called when the processing stream is closed.
+	releaseConcurrencySlot()
+}
+
+// concurrencySlot is embedded in the upstream filters to acquire the slot of the concurrency limit of the backend.
+type concurrencySlot struct {
+	// limiter is the limiter of the selected backend. This is nil if the backend has no concurrency limit.
+	limiter  *concurrencyLimiter
+	acquired bool
+}
+
+// acquireConcurrencySlot acquires the slot for the request if the backend has the concurrency limit. This returns
+// the local reply to spill the request over to the lower priority backends if the slot could not be acquired in time.
+func (s *concurrencySlot) acquireConcurrencySlot(ctx context.Context, metrics metrics.ConcurrencyQueueMetrics, requestHeaders map[string]string) (*extprocv3.ProcessingResponse, error) {
+	if s.limiter == nil || s.acquired {
+		return nil, nil
+	}
+	limit := s.limiter.config()
+	start := time.Now()
+	var queued bool
+	ok, err := s.limiter.acquire(ctx, concurrencyPriority(ctx, limit, requestHeaders),
+		func() {
+			queued = true
+			metrics.AddConcurrencyQueueDepth(ctx, limit.Key, 1)
+		},
+		func() { metrics.AddConcurrencyQueueDepth(ctx, limit.Key, -1) },
+	)
+	if err != nil {
+		return nil, err
+	}
+	if queued || !ok {
+		metrics.RecordConcurrencyQueueWait(ctx, limit.Key, time.Since(start), ok)
+	}
+	if ok {
+		s.acquired = true
+		return nil, nil
+	}
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &extprocv3.ImmediateResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode_ServiceUnavailable},
+				Headers: &extprocv3.HeaderMutation{SetHeaders: []*corev3.HeaderValueOption{
+					{Header: &corev3.HeaderValue{Key: internalapi.ConcurrencySpillHeader, RawValue: []byte("true")}},
+				}},
+				Body: []byte("the backend is at its concurrency limit"),
+			},
+		},
+	}, nil
+}
+
+// releaseConcurrencySlot implements [concurrencySlotReleaser].
+func (s *concurrencySlot) releaseConcurrencySlot() {
+	if s.acquired {
+		s.acquired = false
+		s.limiter.release()
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+	"log/slog"
+)
+
+func noop() {}
+
+func Test_concurrencyLimiter(t *testing.T) {
+	t.Run("priority order", func(t *testing.T) {
+		l := newConcurrencyLimiters().get(&filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 1, QueueTimeout: time.Minute})
+		ok, err := l.acquire(t.Context(), 0, noop, noop)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		admitted := make(chan int, 3)
+		queued := make(chan struct{}, 3)
+		for _, priority := range []int{1, 3, 2} {
+			go func() {
+				ok, err := l.acquire(context.Background(), priority, func() { queued <- struct{}{} }, noop)
+				if err == nil && ok {
+					admitted <- priority
+				}
+			}()
+			// Wait for the request to be queued so that the arrival order is deterministic.
+			<-queued
+		}
+		for _, expected := range []int{3, 2, 1} {
+			l.release()
+			require.Equal(t, expected, <-admitted)
+		}
+	})
+
+	t.Run("same priority in arrival order", func(t *testing.T) {
+		l := newConcurrencyLimiters().get(&filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 1, QueueTimeout: time.Minute})
+		ok, _ := l.acquire(t.Context(), 0, noop, noop)
+		require.True(t, ok)
+		admitted := make(chan int, 2)
+		queued := make(chan struct{}, 2)
+		for i := range 2 {
+			go func() {
+				if ok, _ := l.acquire(context.Background(), 0, func() { queued <- struct{}{} }, noop); ok {
+					admitted <- i
+				}
+			}()
+			<-queued
+		}
+		l.release()
+		require.Equal(t, 0, <-admitted)
+		l.release()
+		require.Equal(t, 1, <-admitted)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		l := newConcurrencyLimiters().get(&filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 1, QueueTimeout: 10 * time.Millisecond})
+		ok, _ := l.acquire(t.Context(), 0, noop, noop)
+		require.True(t, ok)
+		var dequeued bool
+		ok, err := l.acquire(t.Context(), 0, noop, func() { dequeued = true })
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.True(t, dequeued)
+		require.Zero(t, l.queue.Len())
+	})
+
+	t.Run("no queueing", func(t *testing.T) {
+		l := newConcurrencyLimiters().get(&filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 1})
+		ok, _ := l.acquire(t.Context(), 0, noop, noop)
+		require.True(t, ok)
+		ok, err := l.acquire(t.Context(), 0, func() { t.Fatal("must not be queued") }, noop)
+		require.NoError(t, err)
+		require.False(t, ok)
+		l.release()
+		ok, _ = l.acquire(t.Context(), 0, noop, noop)
+		require.True(t, ok)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		l := newConcurrencyLimiters().get(&filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 1, QueueTimeout: time.Minute})
+		ok, _ := l.acquire(t.Context(), 0, noop, noop)
+		require.True(t, ok)
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		_, err := l.acquire(ctx, 0, noop, noop)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Zero(t, l.queue.Len())
+	})
+
+	t.Run("limit raised on reload", func(t *testing.T) {
+		limiters := newConcurrencyLimiters()
+		l := limiters.get(&filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 1, QueueTimeout: time.Minute})
+		ok, _ := l.acquire(t.Context(), 0, noop, noop)
+		require.True(t, ok)
+		admitted := make(chan struct{})
+		queued := make(chan struct{})
+		go func() {
+			if ok, _ := l.acquire(context.Background(), 0, func() { close(queued) }, noop); ok {
+				close(admitted)
+			}
+		}()
+		<-queued
+		// The limiter with the same key is shared across the reloads.
+		require.Same(t, l, limiters.get(&filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 2, QueueTimeout: time.Minute}))
+		<-admitted
+		require.Equal(t, 2, l.inFlight)
+	})
+
+	t.Run("evicted on reload", func(t *testing.T) {
+		s, err := NewServer(slog.Default())
+		require.NoError(t, err)
+		limit := &filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 1}
+		require.NoError(t, s.LoadConfig(t.Context(), &filterapi.Config{Backends: []filterapi.Backend{{Name: "backend", ConcurrencyLimit: limit}}}))
+		require.Contains(t, s.concurrencyLimiters.limiters, "ns/backend")
+		// The limiter of the backend removed from the configuration is no longer held.
+		require.NoError(t, s.LoadConfig(t.Context(), &filterapi.Config{Backends: []filterapi.Backend{{Name: "backend"}}}))
+		require.Empty(t, s.concurrencyLimiters.limiters)
+	})
+}
+
+func Test_concurrencyPriority(t *testing.T) {
+	classes := []string{"gold", "silver"}
+	byHeader := &filterapi.ConcurrencyLimit{PriorityHeader: "X-Tier", PriorityClasses: classes}
+	require.Equal(t, 2, concurrencyPriority(t.Context(), byHeader, map[string]string{"x-tier": "gold"}))
+	require.Equal(t, 1, concurrencyPriority(t.Context(), byHeader, map[string]string{"x-tier": "silver"}))
+	require.Equal(t, 0, concurrencyPriority(t.Context(), byHeader, map[string]string{"x-tier": "bronze"}))
+	require.Equal(t, 0, concurrencyPriority(t.Context(), byHeader, map[string]string{}))
+
+	byClaim := &filterapi.ConcurrencyLimit{PriorityJWTClaim: "tier", PriorityClasses: classes}
+	require.Equal(t, 1, concurrencyPriority(withJWTClaims(t, map[string]any{"tier": "silver"}), byClaim, map[string]string{}))
+
+	require.Equal(t, 0, concurrencyPriority(t.Context(), &filterapi.ConcurrencyLimit{}, map[string]string{"x-tier": "gold"}))
+}
+
+func Test_concurrencySlot(t *testing.T) {
+	limiter := newConcurrencyLimiters().get(&filterapi.ConcurrencyLimit{Key: "ns/backend", MaxInFlightRequests: 1, QueueTimeout: 10 * time.Millisecond})
+	mm := &mockConcurrencyQueueMetrics{}
+
+	// No limit.
+	var unlimited concurrencySlot
+	res, err := unlimited.acquireConcurrencySlot(t.Context(), mm, nil)
+	require.NoError(t, err)
+	require.Nil(t, res)
+	unlimited.releaseConcurrencySlot()
+
+	first := concurrencySlot{limiter: limiter}
+	res, err = first.acquireConcurrencySlot(t.Context(), mm, nil)
+	require.NoError(t, err)
+	require.Nil(t, res)
+	require.True(t, first.acquired)
+	// Not recorded when the slot is acquired without waiting.
+	require.Empty(t, mm.queueWaits)
+
+	second := concurrencySlot{limiter: limiter}
+	res, err = second.acquireConcurrencySlot(t.Context(), mm, nil)
+	require.NoError(t, err)
+	ir := res.GetImmediateResponse()
+	require.NotNil(t, ir)
+	require.Equal(t, typev3.StatusCode_ServiceUnavailable, ir.Status.Code)
+	require.Equal(t, internalapi.ConcurrencySpillHeader, ir.Headers.SetHeaders[0].Header.Key)
+	require.Equal(t, []bool{false}, mm.queueWaits)
+	require.Zero(t, mm.queueDepth)
+	// Releasing the slot which is not acquired is no-op.
+	second.releaseConcurrencySlot()
+	require.Equal(t, 1, limiter.inFlight)
+
+	first.releaseConcurrencySlot()
+	first.releaseConcurrencySlot()
+	require.Zero(t, limiter.inFlight)
+}
@@ -0,0 +1,110 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+)
+
+// consumerAttribute is the metric attribute of the consumer authenticated by the consumer key.
+const consumerAttribute = "ai_gateway.consumer"
+
+// consumerKeysByHash indexes the consumer keys by their hashes.
+func consumerKeysByHash(keys []filterapi.ConsumerKey) map[string]*filterapi.ConsumerKey {
+	if len(keys) == 0 {
+		return nil
+	}
+	ret := make(map[string]*filterapi.ConsumerKey, len(keys))
+	for i := range keys {
+		ret[keys[i].Hash] = &keys[i]
+	}
+	return ret
+}
+
+// authenticateConsumerKey returns the consumer key in the bearer token of the request. This returns nil without
+// the local reply if no consumer key is configured, and the local reply rejecting the request if the key is
+// missing, unknown or expired.
+func authenticateConsumerKey(config *processorConfig, requestHeaders map[string]string, now time.Time) (*filterapi.ConsumerKey, *extprocv3.ProcessingResponse) {
+	if len(config.consumerKeys) == 0 {
+		return nil, nil
+	}
+	token, ok := strings.CutPrefix(requestHeaders["authorization"], "Bearer ")
+	if !ok || token == "" {
+		return nil, openAIErrorResponse(typev3.StatusCode_Unauthorized, "invalid_api_key",
+			"You didn't provide an API key in the Authorization header using Bearer auth.")
+	}
+	sum := sha256.Sum256([]byte(token))
+	key := config.consumerKeys[hex.EncodeToString(sum[:])]
+	if key == nil {
+		return nil, openAIErrorResponse(typev3.StatusCode_Unauthorized, "invalid_api_key", "Incorrect API key provided.")
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return nil, openAIErrorResponse(typev3.StatusCode_Unauthorized, "invalid_api_key",
+			fmt.Sprintf("The API key has expired at %s.", key.ExpiresAt.Format(time.RFC3339)))
+	}
+	return key, nil
+}
+
+// authorizeConsumerKey returns the local reply rejecting the request if the key is not allowed to use the model,
+// or nil if it is allowed.
+func authorizeConsumerKey(config *processorConfig, key *filterapi.ConsumerKey, model string) *extprocv3.ProcessingResponse {
+	if len(key.Models) > 0 && !slices.Contains(key.Models, model) {
+		return openAIErrorResponse(typev3.StatusCode_Forbidden, "model_not_allowed",
+			fmt.Sprintf("The API key is not allowed to use the model %q.", model))
+	}
+	if len(key.Rules) > 0 {
+		if rule := config.rulesByModel[model]; rule == nil || !slices.Contains(key.Rules, rule.Name) {
+			return openAIErrorResponse(typev3.StatusCode_Forbidden, "model_not_allowed",
+				fmt.Sprintf("The API key is not allowed to use the route of the model %q.", model))
+		}
+	}
+	return nil
+}
+
+// consumerKeyAllowsModel returns true if the key is allowed to use the model.
+func consumerKeyAllowsModel(config *processorConfig, key *filterapi.ConsumerKey, model string) bool {
+	return authorizeConsumerKey(config, key, model) == nil
+}
+
+// applyConsumerKey populates the consumer identity of the key in the request headers, and returns the header
+// mutation to be sent upstream, which also removes the key itself from the request.
+func applyConsumerKey(key *filterapi.ConsumerKey, requestHeaders map[string]string) (set []*corev3.HeaderValueOption, remove []string) {
+	headers := map[string]string{
+		internalapi.ConsumerHeader:    key.Consumer,
+		internalapi.ConsumerKeyHeader: key.Name,
+	}
+	for k, v := range key.Labels {
+		headers[internalapi.ConsumerLabelHeaderPrefix+k] = v
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		requestHeaders[k] = headers[k]
+		set = append(set, &corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: k, RawValue: []byte(headers[k])}})
+	}
+	return set, []string{"authorization"}
+}
+
+// consumerKeyMetricAttributes returns the metric attributes of the consumer of the key.
+func consumerKeyMetricAttributes(key *filterapi.ConsumerKey) []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String(consumerAttribute, key.Consumer)}
+}
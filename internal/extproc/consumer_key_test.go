@@ -0,0 +1,162 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+)
+
+// consumerKeyTestFilterConfig returns the filter config with the consumer keys "sk-team-a" allowed to use "gpt" and
+// "sk-expired".
+func consumerKeyTestFilterConfig() *filterapi.Config {
+	hash := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	expired := time.Now().Add(-time.Minute)
+	return &filterapi.Config{
+		Rules:  []filterapi.RouteRule{{Models: []string{"gpt", "llama"}}},
+		Models: []filterapi.Model{{Name: "gpt"}, {Name: "llama"}},
+		ConsumerKeys: []filterapi.ConsumerKey{
+			{
+				Name: "ns/team-a", Hash: hash("sk-team-a"), Consumer: "team-a", Models: []string{"gpt", "unrouted"},
+				Rules: []filterapi.RouteRuleName{"ns/route/rule/0"}, Labels: map[string]string{"cost-center": "42"},
+			},
+			{Name: "ns/expired", Hash: hash("sk-expired"), Consumer: "team-b", ExpiresAt: &expired},
+		},
+	}
+}
+
+func requireOpenAIError(t *testing.T, res *extprocv3.ProcessingResponse, status typev3.StatusCode, code string) {
+	ir := res.GetImmediateResponse()
+	require.NotNil(t, ir)
+	require.Equal(t, status, ir.Status.Code)
+	var body openai.Error
+	require.NoError(t, json.Unmarshal(ir.Body, &body))
+	require.Equal(t, code, *body.Error.Code)
+}
+
+func Test_authenticateConsumerKey(t *testing.T) {
+	config := newTestConfig(t, consumerKeyTestFilterConfig())
+	now := time.Now()
+
+	key, res := authenticateConsumerKey(&processorConfig{}, map[string]string{}, now)
+	require.Nil(t, key)
+	require.Nil(t, res)
+
+	for _, authorization := range []string{"", "Basic c2stdGVhbS1h", "Bearer ", "Bearer sk-unknown", "Bearer sk-expired"} {
+		t.Run(authorization, func(t *testing.T) {
+			key, res = authenticateConsumerKey(config, map[string]string{"authorization": authorization}, now)
+			require.Nil(t, key)
+			requireOpenAIError(t, res, typev3.StatusCode_Unauthorized, "invalid_api_key")
+		})
+	}
+
+	key, res = authenticateConsumerKey(config, map[string]string{"authorization": "Bearer sk-team-a"}, now)
+	require.Nil(t, res)
+	require.Equal(t, "ns/team-a", key.Name)
+}
+
+func Test_authorizeConsumerKey(t *testing.T) {
+	config := newTestConfig(t, consumerKeyTestFilterConfig())
+	key, _ := authenticateConsumerKey(config, map[string]string{"authorization": "Bearer sk-team-a"}, time.Now())
+	require.Nil(t, authorizeConsumerKey(config, key, "gpt"))
+	// The model is not in the allowed models.
+	requireOpenAIError(t, authorizeConsumerKey(config, key, "llama"), typev3.StatusCode_Forbidden, "model_not_allowed")
+	// The model is allowed, but its route cannot be resolved.
+	requireOpenAIError(t, authorizeConsumerKey(config, key, "unrouted"), typev3.StatusCode_Forbidden, "model_not_allowed")
+}
+
+func Test_chatCompletionProcessor_consumerKey(t *testing.T) {
+	config := newTestConfig(t, consumerKeyTestFilterConfig())
+	newRouter := func(authorization string) *chatCompletionProcessorRouterFilter {
+		return &chatCompletionProcessorRouterFilter{
+			config:         config,
+			logger:         slog.Default(),
+			requestHeaders: map[string]string{":path": "/v1/chat/completions", "authorization": authorization},
+		}
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		res, err := newRouter("Bearer sk-unknown").ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: bodyFromModel(t, "gpt", false)})
+		require.NoError(t, err)
+		requireOpenAIError(t, res, typev3.StatusCode_Unauthorized, "invalid_api_key")
+		res, err = newRouter("Bearer sk-team-a").ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: bodyFromModel(t, "llama", false)})
+		require.NoError(t, err)
+		requireOpenAIError(t, res, typev3.StatusCode_Forbidden, "model_not_allowed")
+	})
+
+	t.Run("accepted", func(t *testing.T) {
+		rp := newRouter("Bearer sk-team-a")
+		res, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: bodyFromModel(t, "gpt", false)})
+		require.NoError(t, err)
+		mutation := res.GetRequestBody().Response.HeaderMutation
+		require.Equal(t, []string{"authorization"}, mutation.RemoveHeaders)
+		set := headers(mutation.SetHeaders)
+		require.Equal(t, "team-a", set["x-ai-eg-consumer"])
+		require.Equal(t, "ns/team-a", set["x-ai-eg-consumer-key"])
+		require.Equal(t, "42", set["x-ai-eg-consumer-label-cost-center"])
+		require.Equal(t, "team-a", rp.requestHeaders["x-ai-eg-consumer"])
+
+		up := &chatCompletionProcessorUpstreamFilter{
+			config: config, logger: slog.Default(), metrics: &mockChatCompletionMetrics{}, requestHeaders: rp.requestHeaders,
+		}
+		require.NoError(t, up.SetBackend(t.Context(), &filterapi.Backend{
+			Name:   "backend",
+			Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+		}, nil, rp))
+		require.Equal(t, []attribute.KeyValue{attribute.String(consumerAttribute, "team-a")}, up.metricAttrs)
+	})
+}
+
+func Test_embeddingsProcessor_consumerKey(t *testing.T) {
+	config := newTestConfig(t, consumerKeyTestFilterConfig())
+	rp := &embeddingsProcessorRouterFilter{
+		config:         config,
+		logger:         slog.Default(),
+		requestHeaders: map[string]string{":path": "/v1/embeddings"},
+	}
+	res, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(`{"model":"gpt","input":"hello"}`)})
+	require.NoError(t, err)
+	requireOpenAIError(t, res, typev3.StatusCode_Unauthorized, "invalid_api_key")
+
+	rp.requestHeaders["authorization"] = "Bearer sk-team-a"
+	res, err = rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(`{"model":"gpt","input":"hello"}`)})
+	require.NoError(t, err)
+	require.Equal(t, []string{"authorization"}, res.GetRequestBody().Response.HeaderMutation.RemoveHeaders)
+	require.Equal(t, "ns/team-a", rp.consumerKey.Name)
+}
+
+func TestModels_consumerKey(t *testing.T) {
+	config := newTestConfig(t, consumerKeyTestFilterConfig())
+	p, err := NewModelsProcessor(config, map[string]string{}, slog.Default(), false)
+	require.NoError(t, err)
+	res, err := p.ProcessRequestHeaders(t.Context(), nil)
+	require.NoError(t, err)
+	requireOpenAIError(t, res, typev3.StatusCode_Unauthorized, "invalid_api_key")
+
+	p, err = NewModelsProcessor(config, map[string]string{"authorization": "Bearer sk-team-a"}, slog.Default(), false)
+	require.NoError(t, err)
+	res, err = p.ProcessRequestHeaders(t.Context(), nil)
+	require.NoError(t, err)
+	var models openai.ModelList
+	require.NoError(t, json.Unmarshal(res.GetImmediateResponse().Body, &models))
+	require.Len(t, models.Data, 1)
+	require.Equal(t, "gpt", models.Data[0].ID)
+}
@@ -0,0 +1,106 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/audit"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+)
+
+// maxConversationResponseCapture is the maximum size of the response body captured for the audit log, beyond which
+// the rest of the response is not captured. This is much larger than the maximum size of the response recorded since
+// the streamed responses are reassembled into the much smaller chat completion objects in the background.
+const maxConversationResponseCapture = 32 << 20
+
+// conversationAudit is the chat completion request sampled to be recorded in the audit log with its response.
+type conversationAudit struct {
+	exporter *audit.Exporter
+	config   *filterapi.AuditLog
+	route    string
+	model    string
+	// request is the original request body of the client.
+	request []byte
+	// exported guards the export, so that only one record is made for the request.
+	exported sync.Once
+}
+
+// sampleConversationAudit samples the chat completion request to be recorded in the audit log according to the
+// route rule of the model. This returns nil if the request is not recorded.
+func sampleConversationAudit(config *processorConfig, model string, request []byte) *conversationAudit {
+	if config.auditLog == nil {
+		return nil
+	}
+	rule := config.rulesByModel[model]
+	if rule == nil || rule.AuditLog == nil || rand.IntN(100) >= rule.AuditLog.Percentage { //nolint:gosec
+		return nil
+	}
+	return &conversationAudit{
+		exporter: config.auditLog,
+		config:   rule.AuditLog,
+		route:    string(rule.Name),
+		model:    model,
+		request:  request,
+	}
+}
+
+// export exports the record of the conversation with the response returned to the client. The backend is empty if
+// the request is rejected before it is sent to any backend.
+func (a *conversationAudit) export(requestHeaders map[string]string, backend string, stream bool, status int, response *conversationResponse) {
+	a.exported.Do(func() {
+		a.exporter.ExportConversation(&audit.Record{
+			ID:       requestHeaders["x-request-id"],
+			Time:     time.Now(),
+			Consumer: requestHeaders[internalapi.ConsumerHeader],
+			Route:    a.route,
+			Model:    a.model,
+			Backend:  backend,
+		}, &audit.ConversationCapture{
+			Request:           a.request,
+			Response:          response.body,
+			ResponseTruncated: response.truncated,
+			Stream:            stream,
+			Status:            status,
+			RedactedFields:    a.config.RedactedFields,
+			MaxBodyBytes:      a.config.MaxBodyBytes,
+		})
+	})
+}
+
+// exportRejected exports the record of the conversation if the request is rejected by the local reply.
+func (a *conversationAudit) exportRejected(requestHeaders map[string]string, res *extprocv3.ProcessingResponse) {
+	if ir := res.GetImmediateResponse(); ir != nil {
+		a.export(requestHeaders, "", false, int(ir.GetStatus().GetCode()), &conversationResponse{body: ir.Body})
+	}
+}
+
+// conversationResponse is the response body captured for the audit log.
+type conversationResponse struct {
+	body []byte
+	// truncated is true if the response exceeded maxConversationResponseCapture.
+	truncated bool
+}
+
+// append appends the part of the response body. The response body is copied since the part can be reused.
+func (r *conversationResponse) append(part []byte) {
+	if remaining := maxConversationResponseCapture - len(r.body); len(part) > remaining {
+		part, r.truncated = part[:remaining], true
+	}
+	r.body = append(r.body, part...)
+}
+
+// conversationStatus returns the status code of the response headers.
+func conversationStatus(responseHeaders map[string]string) int {
+	status, _ := strconv.Atoi(responseHeaders[":status"])
+	return status
+}
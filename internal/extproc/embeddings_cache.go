@@ -0,0 +1,260 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+)
+
+// embeddingsCache is the lookup of the inputs of an embeddings request in the response cache of the route rule.
+//
+// Each input string is cached separately, so the batches sharing some of the inputs reuse their embeddings: the
+// inputs hitting the cache are served locally, only the missing ones are forwarded to the backend, and the response
+// is stitched back together in the order of the original request.
+type embeddingsCache struct {
+	config *processorConfig
+	cache  *filterapi.ResponseCache
+	// keys are the cache keys of the inputs in the order of the original request.
+	keys []string
+	// hits are the cached embeddings of the inputs in the order of the original request as the raw JSON values, where
+	// the inputs missing the cache are nil.
+	hits [][]byte
+	// misses are the indexes in the original request of the inputs forwarded to the backend, in the forwarded order.
+	misses []int
+}
+
+// lookupEmbeddingsCache looks up the inputs of the embeddings request in the response cache of the route rule of the
+// model. This returns nil if the response cache does not apply to the request, e.g., the inputs are the tokens rather
+// than the strings. The numbers of the inputs hitting and missing the cache are recorded in the metrics.
+//
+// The "Cache-Control" header of the request is respected in the same way as [lookupResponseCache].
+func lookupEmbeddingsCache(ctx context.Context, config *processorConfig, logger *slog.Logger, metrics metrics.ResponseCacheMetrics,
+	model string, requestHeaders map[string]string, request []byte, metricAttrs ...attribute.KeyValue,
+) *embeddingsCache {
+	rule := config.rulesByModel[model]
+	if rule == nil || rule.ResponseCache == nil || config.responseCacheStore == nil {
+		return nil
+	}
+	noCache, noStore := cacheControlDirectives(requestHeaders["cache-control"])
+	if noStore {
+		return nil
+	}
+	consumer := responseCacheConsumer(ctx, rule.ResponseCache, requestHeaders)
+	if consumer == "" {
+		return nil
+	}
+	inputs, ok := embeddingsInputs(request)
+	if !ok {
+		return nil
+	}
+	// The embeddings depend on the dimensions and the encoding format as well as the input.
+	dimensions := gjson.GetBytes(request, "dimensions").Raw
+	encodingFormat := gjson.GetBytes(request, "encoding_format").Str
+	c := &embeddingsCache{config: config, cache: rule.ResponseCache, keys: make([]string, len(inputs))}
+	for i, input := range inputs {
+		c.keys[i] = embeddingsCacheKey(rule.Name, model, consumer, dimensions, encodingFormat, input)
+	}
+	c.hits = make([][]byte, len(inputs))
+	if !noCache {
+		storeCtx, cancel := context.WithTimeout(ctx, responseCacheStoreTimeout)
+		defer cancel()
+		hits, err := config.responseCacheStore.GetMany(storeCtx, c.keys)
+		if err != nil {
+			// The inputs are sent to the backend rather than failing while the store is unavailable.
+			logger.Error("failed to get the cached embeddings", slog.String("error", err.Error()))
+		} else {
+			c.hits = hits
+		}
+	}
+	for i, hit := range c.hits {
+		if hit == nil {
+			c.misses = append(c.misses, i)
+		}
+	}
+	if !noCache {
+		if hits := len(inputs) - len(c.misses); hits > 0 {
+			metrics.RecordResponseCacheLookups(ctx, responseCacheExact, true, hits, metricAttrs...)
+		}
+		if len(c.misses) > 0 {
+			metrics.RecordResponseCacheLookups(ctx, responseCacheExact, false, len(c.misses), metricAttrs...)
+		}
+	}
+	return c
+}
+
+// embeddingsInputs returns the input strings of the embeddings request, or false if the input is not a string nor
+// an array of the strings.
+func embeddingsInputs(request []byte) ([]string, bool) {
+	input := gjson.GetBytes(request, "input")
+	if input.Type == gjson.String {
+		return []string{input.Str}, true
+	}
+	if !input.IsArray() {
+		return nil, false
+	}
+	var inputs []string
+	for _, in := range input.Array() {
+		if in.Type != gjson.String {
+			return nil, false
+		}
+		inputs = append(inputs, in.Str)
+	}
+	return inputs, len(inputs) > 0
+}
+
+// embeddingsCacheKey returns the key of the input of the embeddings request in the response cache.
+func embeddingsCacheKey(rule filterapi.RouteRuleName, model, consumer, dimensions, encodingFormat, input string) string {
+	h := sha256.New()
+	// The operation distinguishes the keys from the ones of the chat completions.
+	for _, part := range []string{"embeddings", string(rule), model, consumer, dimensions, encodingFormat, input} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// allHit returns true if all the inputs hit the cache, in which case the request is not sent to the backend.
+func (c *embeddingsCache) allHit() bool {
+	return len(c.misses) == 0
+}
+
+// hitResponse returns the local reply serving the embeddings of all the inputs from the cache, with zero tokens.
+func (c *embeddingsCache) hitResponse(requestHeaders map[string]string, model string) (*extprocv3.ProcessingResponse, error) {
+	body, err := json.Marshal(struct {
+		Object string                `json:"object"`
+		Data   []json.RawMessage     `json:"data"`
+		Model  string                `json:"model"`
+		Usage  openai.EmbeddingUsage `json:"usage"`
+	}{Object: "list", Data: c.stitchedData(nil), Model: model})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cached embeddings: %w", err)
+	}
+	return responseCacheHitResponse(c.config, requestHeaders, "application/json", body)
+}
+
+// missesRequest returns the request body whose input is replaced with the inputs missing the cache, or nil if no
+// input hit the cache and the request is forwarded as is.
+func (c *embeddingsCache) missesRequest(request []byte) ([]byte, error) {
+	if len(c.misses) == len(c.keys) {
+		return nil, nil
+	}
+	inputs, _ := embeddingsInputs(request)
+	misses := make([]string, len(c.misses))
+	for j, i := range c.misses {
+		misses[j] = inputs[i]
+	}
+	return sjson.SetBytes(request, "input", misses)
+}
+
+// header returns the response header telling whether the embeddings were served from the cache, which is "partial"
+// when only some of the inputs hit the cache.
+func (c *embeddingsCache) header() *corev3.HeaderValueOption {
+	value := "miss"
+	if len(c.misses) < len(c.keys) {
+		value = "partial"
+	}
+	return &corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: internalapi.ResponseCacheHeader, RawValue: []byte(value)}}
+}
+
+// stitch stores the embeddings of the inputs forwarded to the backend in the cache, and returns the response body
+// with the cached embeddings inserted in the order of the original request. This returns nil if no input hit the
+// cache, or the response does not have the embeddings of all the forwarded inputs, in which case nothing is stored.
+func (c *embeddingsCache) stitch(ctx context.Context, logger *slog.Logger, response []byte) []byte {
+	data := gjson.GetBytes(response, "data").Array()
+	if len(data) != len(c.misses) {
+		logger.Error("unexpected number of embeddings in the response",
+			slog.Int("expected", len(c.misses)), slog.Int("actual", len(data)))
+		return nil
+	}
+	// forwarded are the embedding objects of the forwarded inputs in the order of the forwarded request.
+	forwarded := make([]gjson.Result, len(data))
+	for j, d := range data {
+		index := j
+		if v := d.Get("index"); v.Exists() {
+			index = int(v.Int())
+		}
+		if index < 0 || index >= len(forwarded) {
+			logger.Error("unexpected index of the embedding in the response", slog.Int("index", index))
+			return nil
+		}
+		forwarded[index] = d
+	}
+	keys := make([]string, 0, len(c.misses))
+	values := make([][]byte, 0, len(c.misses))
+	for j, i := range c.misses {
+		value := []byte(forwarded[j].Get("embedding").Raw)
+		if len(value) == 0 || len(value) > c.cache.MaxEntryBytes {
+			continue
+		}
+		keys, values = append(keys, c.keys[i]), append(values, value)
+	}
+	if len(keys) > 0 {
+		storeCtx, cancel := context.WithTimeout(ctx, responseCacheStoreTimeout)
+		defer cancel()
+		// The errors are only logged since the response is already returned from the backend.
+		if err := c.config.responseCacheStore.SetMany(storeCtx, keys, values, c.cache.TTL); err != nil {
+			logger.Error("failed to store the embeddings in the cache", slog.String("error", err.Error()))
+		}
+	}
+	if len(c.misses) == len(c.keys) {
+		return nil
+	}
+	stitched, err := json.Marshal(c.stitchedData(forwarded))
+	if err != nil {
+		logger.Error("failed to marshal the stitched embeddings", slog.String("error", err.Error()))
+		return nil
+	}
+	body, err := sjson.SetRawBytes(response, "data", stitched)
+	if err != nil {
+		logger.Error("failed to stitch the embeddings", slog.String("error", err.Error()))
+		return nil
+	}
+	return body
+}
+
+// stitchedData returns the embedding objects of all the inputs in the order of the original request, where the
+// cached embeddings are filled from the hits and the others from the forwarded embedding objects.
+func (c *embeddingsCache) stitchedData(forwarded []gjson.Result) []json.RawMessage {
+	data := make([]json.RawMessage, len(c.keys))
+	j := 0
+	for i, hit := range c.hits {
+		if hit != nil {
+			var b bytes.Buffer
+			b.WriteString(`{"object":"embedding","index":`)
+			b.WriteString(strconv.Itoa(i))
+			b.WriteString(`,"embedding":`)
+			b.Write(hit)
+			b.WriteByte('}')
+			data[i] = b.Bytes()
+			continue
+		}
+		d, err := sjson.SetBytes([]byte(forwarded[j].Raw), "index", i)
+		if err != nil {
+			d = []byte(forwarded[j].Raw)
+		}
+		data[i] = d
+		j++
+	}
+	return data
+}
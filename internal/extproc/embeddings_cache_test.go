@@ -0,0 +1,143 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+)
+
+func Test_lookupEmbeddingsCache(t *testing.T) {
+	config := newTestRuleConfig(t, filterapi.RouteRule{ResponseCache: &filterapi.ResponseCache{TTL: time.Minute, MaxEntryBytes: 1024}})
+	metrics := &mockResponseCacheMetrics{}
+	lookup := func(model string, headers map[string]string, request string) *embeddingsCache {
+		return lookupEmbeddingsCache(t.Context(), config, slog.Default(), metrics, model, headers, []byte(request))
+	}
+
+	require.Nil(t, lookup("unknown", map[string]string{}, `{"model":"unknown","input":"a"}`))
+	require.Nil(t, lookup("gpt", map[string]string{"cache-control": "no-store"}, `{"model":"gpt","input":"a"}`))
+	// The token inputs are not cached.
+	require.Nil(t, lookup("gpt", map[string]string{}, `{"model":"gpt","input":[1,2,3]}`))
+	require.Nil(t, lookup("gpt", map[string]string{}, `{"model":"gpt","input":[]}`))
+
+	c := lookup("gpt", map[string]string{}, `{"model":"gpt","input":"a"}`)
+	require.NotNil(t, c)
+	require.Equal(t, []int{0}, c.misses)
+	require.Nil(t, c.stitch(t.Context(), slog.Default(), []byte(`{"data":[{"object":"embedding","index":0,"embedding":[0.1]}]}`)))
+
+	// The dimensions and the encoding format are part of the keys.
+	c = lookup("gpt", map[string]string{}, `{"model":"gpt","input":["a","a"]}`)
+	require.Empty(t, c.misses)
+	require.Equal(t, []int{0, 1}, lookup("gpt", map[string]string{}, `{"model":"gpt","input":["a","a"],"dimensions":256}`).misses)
+	require.Equal(t, []int{0}, lookup("gpt", map[string]string{}, `{"model":"gpt","input":"a","encoding_format":"base64"}`).misses)
+	// The no-cache directive skips the lookup.
+	require.Equal(t, []int{0}, lookup("gpt", map[string]string{"cache-control": "no-cache"}, `{"model":"gpt","input":"a"}`).misses)
+	require.Equal(t, map[string]int{"exact/true": 2, "exact/false": 4}, metrics.responseCacheLookups)
+
+	t.Run("unexpected response", func(t *testing.T) {
+		c := lookup("gpt", map[string]string{}, `{"model":"gpt","input":["x","a","y"]}`)
+		require.Equal(t, []int{0, 2}, c.misses)
+		require.Nil(t, c.stitch(t.Context(), slog.Default(), []byte(`{"data":[{"object":"embedding","index":0,"embedding":[0.1]}]}`)))
+		require.Nil(t, c.stitch(t.Context(), slog.Default(), []byte(`{"data":[{"index":0,"embedding":[0.1]},{"index":5,"embedding":[0.2]}]}`)))
+		require.Equal(t, []int{0, 2}, lookup("gpt", map[string]string{}, `{"model":"gpt","input":["x","a","y"]}`).misses)
+	})
+}
+
+func Test_embeddingsProcessor_responseCache(t *testing.T) {
+	config := newTestRuleConfig(t, filterapi.RouteRule{ResponseCache: &filterapi.ResponseCache{TTL: time.Minute, MaxEntryBytes: 1024}})
+	config.requestCosts = []processorConfigRequestCost{
+		{LLMRequestCost: &filterapi.LLMRequestCost{Type: filterapi.LLMRequestCostTypeInputToken, MetadataKey: "input"}},
+	}
+	metrics := &mockEmbeddingsMetrics{}
+	// send sends the request through the router filter and the upstream filter with the response of the backend, and
+	// returns the request body forwarded to the backend and the response returned to the client.
+	send := func(request, response string) (forwarded, header, returned string, res *extprocv3.ProcessingResponse) {
+		rp := &embeddingsProcessorRouterFilter{
+			config: config, logger: slog.Default(), metrics: metrics,
+			requestHeaders: map[string]string{":path": "/v1/embeddings"},
+		}
+		res, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(request)})
+		require.NoError(t, err)
+		if ir := res.GetImmediateResponse(); ir != nil {
+			return "", "", string(ir.Body), res
+		}
+		up := &embeddingsProcessorUpstreamFilter{
+			config: config, logger: slog.Default(), metrics: metrics, requestHeaders: rp.requestHeaders,
+		}
+		require.NoError(t, up.SetBackend(t.Context(), &filterapi.Backend{
+			Name: "backend", Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+		}, nil, rp))
+		res, err = up.ProcessRequestHeaders(t.Context(), nil)
+		require.NoError(t, err)
+		forwarded = request
+		if bm := res.GetRequestHeaders().Response.BodyMutation.GetBody(); bm != nil {
+			forwarded = string(bm)
+		}
+		res, err = rp.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":status", RawValue: []byte("200")}, {Key: "content-type", RawValue: []byte("application/json")},
+		}})
+		require.NoError(t, err)
+		header = cacheHeader(res.GetResponseHeaders().Response.HeaderMutation)
+		res, err = rp.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{Body: []byte(response), EndOfStream: true})
+		require.NoError(t, err)
+		returned = response
+		if bm := res.GetResponseBody().Response.BodyMutation.GetBody(); bm != nil {
+			returned = string(bm)
+		}
+		return forwarded, header, returned, res
+	}
+	inputTokens := func(res *extprocv3.ProcessingResponse) float64 {
+		return res.DynamicMetadata.Fields["ai_gateway_llm_ns"].GetStructValue().Fields["input"].GetNumberValue()
+	}
+
+	// The first request misses the cache, and the embeddings are stored per input.
+	const response1 = `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1]},{"object":"embedding","index":1,"embedding":[0.2]}],"model":"gpt","usage":{"prompt_tokens":2,"total_tokens":2}}`
+	forwarded, header, returned, res := send(`{"model":"gpt","input":["a","b"]}`, response1)
+	require.JSONEq(t, `{"model":"gpt","input":["a","b"]}`, forwarded)
+	require.Equal(t, "miss", header)
+	require.Equal(t, response1, returned)
+	require.Equal(t, float64(2), inputTokens(res))
+
+	// The second request only forwards the missing input, and the response is stitched in the original order.
+	forwarded, header, returned, res = send(`{"model":"gpt","input":["b","c","a"]}`,
+		`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.3]}],"model":"gpt","usage":{"prompt_tokens":1,"total_tokens":1}}`)
+	require.JSONEq(t, `{"model":"gpt","input":["c"]}`, forwarded)
+	require.Equal(t, "partial", header)
+	require.JSONEq(t, `{"object":"list","data":[
+		{"object":"embedding","index":0,"embedding":[0.2]},
+		{"object":"embedding","index":1,"embedding":[0.3]},
+		{"object":"embedding","index":2,"embedding":[0.1]}
+	],"model":"gpt","usage":{"prompt_tokens":1,"total_tokens":1}}`, returned)
+	require.Equal(t, float64(1), inputTokens(res))
+
+	// The request whose inputs all hit the cache is not sent to the backend, and costs zero tokens.
+	_, _, returned, res = send(`{"model":"gpt","input":["c","a"]}`, "")
+	require.JSONEq(t, `{"object":"list","data":[
+		{"object":"embedding","index":0,"embedding":[0.3]},
+		{"object":"embedding","index":1,"embedding":[0.1]}
+	],"model":"gpt","usage":{"prompt_tokens":0,"total_tokens":0}}`, returned)
+	require.Equal(t, "hit", cacheHeader(res.GetImmediateResponse().Headers))
+	require.Equal(t, float64(0), inputTokens(res))
+	require.Equal(t, map[string]int{"exact/false": 3, "exact/true": 4}, metrics.responseCacheLookups)
+}
+
+// cacheHeader returns the value of the response cache header set by the header mutation.
+func cacheHeader(m *extprocv3.HeaderMutation) string {
+	for _, h := range m.SetHeaders {
+		if h.Header.Key == internalapi.ResponseCacheHeader {
+			return string(h.Header.RawValue)
+		}
+	}
+	return ""
+}
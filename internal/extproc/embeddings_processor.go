@@ -13,20 +13,25 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"time"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/envoyproxy/ai-gateway/filterapi"
-	"github.com/envoyproxy/ai-gateway/filterapi/x"
 	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
 	"github.com/envoyproxy/ai-gateway/internal/extproc/backendauth"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/guardrail"
 	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/llmcostcel"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+	"github.com/envoyproxy/ai-gateway/internal/tracing"
 )
 
 // EmbeddingsProcessorFactory returns a factory method to instantiate the embeddings processor.
-func EmbeddingsProcessorFactory(em x.EmbeddingsMetrics) ProcessorFactory {
+func EmbeddingsProcessorFactory(em metrics.EmbeddingsMetrics) ProcessorFactory {
 	return func(config *processorConfig, requestHeaders map[string]string, logger *slog.Logger, isUpstreamFilter bool) (Processor, error) {
 		if config.schema.Name != filterapi.APISchemaOpenAI {
 			return nil, fmt.Errorf("unsupported API schema: %s", config.schema.Name)
@@ -37,6 +42,8 @@ func EmbeddingsProcessorFactory(em x.EmbeddingsMetrics) ProcessorFactory {
 				config:         config,
 				requestHeaders: requestHeaders,
 				logger:         logger,
+				metrics:        em,
+				requestStart:   time.Now(),
 			}, nil
 		}
 		return &embeddingsProcessorUpstreamFilter{
@@ -72,10 +79,50 @@ type embeddingsProcessorRouterFilter struct {
 	// upstreamFilterCount is the number of upstream filters that have been processed.
 	// This is used to determine if the request is a retry request.
 	upstreamFilterCount int
+	// quota is the state of the quota budgets applicable to the request. This is nil if no budget applies.
+	quota *quotaState
+	// tokenEstimate is the estimated token usage of the request. This is nil unless any of the request costs
+	// needs the estimation.
+	tokenEstimate *tokenEstimate
+	// requestStart is the time when the request arrived, which is used for the latency in the usage ledger.
+	requestStart time.Time
+	// consumerKey is the consumer key authenticating the request. This is nil if no consumer key is configured.
+	consumerKey *filterapi.ConsumerKey
+	// metrics records the detections of the guardrails and the lookups of the response cache before the backend is
+	// selected.
+	metrics routerFilterMetrics
+	// requestBodyRewritten is true if the guardrails modified the request body.
+	requestBodyRewritten bool
+	// routeMetricAttrs are the metric attributes configured on the route rule extracted from the request.
+	routeMetricAttrs []attribute.KeyValue
+	// responseCache is the lookup of the inputs in the response cache, where only the inputs missing the cache are
+	// forwarded to the backend. This is nil if the response cache does not apply to the request.
+	responseCache *embeddingsCache
+}
+
+// releaseQuotaReservation implements [quotaReservationReleaser].
+func (e *embeddingsProcessorRouterFilter) releaseQuotaReservation() {
+	if e.quota != nil {
+		e.quota.release(context.Background(), e.logger)
+	}
 }
 
 // ProcessResponseHeaders implements [Processor.ProcessResponseHeaders].
-func (e *embeddingsProcessorRouterFilter) ProcessResponseHeaders(ctx context.Context, headerMap *corev3.HeaderMap) (*extprocv3.ProcessingResponse, error) {
+func (e *embeddingsProcessorRouterFilter) ProcessResponseHeaders(ctx context.Context, headerMap *corev3.HeaderMap) (res *extprocv3.ProcessingResponse, err error) {
+	if e.quota != nil {
+		defer func() {
+			if err == nil {
+				addResponseHeaders(res, e.quota.headers()...)
+			}
+		}()
+	}
+	if e.responseCache != nil {
+		defer func() {
+			if err == nil {
+				addResponseHeaders(res, e.responseCache.header())
+			}
+		}()
+	}
 	// If the request failed to route and/or immediate response was returned before the upstream filter was set,
 	// e.upstreamFilter can be nil.
 	if e.upstreamFilter != nil { // See the comment on the "upstreamFilter" field.
@@ -95,21 +142,98 @@ func (e *embeddingsProcessorRouterFilter) ProcessResponseBody(ctx context.Contex
 }
 
 // ProcessRequestBody implements [Processor.ProcessRequestBody].
-func (e *embeddingsProcessorRouterFilter) ProcessRequestBody(_ context.Context, rawBody *extprocv3.HttpBody) (*extprocv3.ProcessingResponse, error) {
+func (e *embeddingsProcessorRouterFilter) ProcessRequestBody(ctx context.Context, rawBody *extprocv3.HttpBody) (*extprocv3.ProcessingResponse, error) {
 	model, body, err := parseOpenAIEmbeddingBody(rawBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse request body: %w", err)
 	}
 
 	e.requestHeaders[e.config.modelNameHeaderKey] = model
-
+	traceRequest(ctx, tracing.OperationEmbeddings, model)
+	var rejected *extprocv3.ProcessingResponse
+	if e.consumerKey, rejected = authenticateConsumerKey(e.config, e.requestHeaders, time.Now()); rejected != nil {
+		return rejected, nil
+	}
 	var additionalHeaders []*corev3.HeaderValueOption
+	var removedHeaders []string
+	if e.consumerKey != nil {
+		if rejected = authorizeConsumerKey(e.config, e.consumerKey, model); rejected != nil {
+			return rejected, nil
+		}
+		additionalHeaders, removedHeaders = applyConsumerKey(e.consumerKey, e.requestHeaders)
+	}
+	if rejected = authorizeCaller(ctx, e.config, model, false, nil); rejected != nil {
+		return rejected, nil
+	}
+	var metricAttrs []attribute.KeyValue
+	if e.consumerKey != nil {
+		metricAttrs = consumerKeyMetricAttributes(e.consumerKey)
+	}
+	e.routeMetricAttrs = routeMetricAttributes(ctx, e.config, metricAttributesEmbeddings, model, e.requestHeaders)
+	metricAttrs = append(metricAttrs, e.routeMetricAttrs...)
+	// The tokens are not used since the embeddings response contains no text.
+	redacted, _, rejected, err := applyPIIGuardrail(ctx, e.config, e.metrics, model, rawBody.Body, redactEmbeddingsText, metricAttrs...)
+	if err != nil {
+		return nil, err
+	} else if rejected != nil {
+		return rejected, nil
+	}
+	if redacted != nil {
+		rawBody = &extprocv3.HttpBody{Body: redacted}
+		if _, body, err = parseOpenAIEmbeddingBody(rawBody); err != nil {
+			return nil, fmt.Errorf("failed to parse redacted request body: %w", err)
+		}
+		e.requestBodyRewritten = true
+	}
+	rewritten, rejected := applyExternalGuardrails(ctx, e.config, e.logger, e.metrics, guardrail.ExternalPhaseRequest,
+		externalGuardrailOperationEmbeddings, model, nil, rawBody.Body, metricAttrs...)
+	if rejected != nil {
+		return rejected, nil
+	}
+	if rewritten != nil {
+		rawBody = &extprocv3.HttpBody{Body: rewritten}
+		if _, body, err = parseOpenAIEmbeddingBody(rawBody); err != nil {
+			return nil, fmt.Errorf("failed to parse rewritten request body: %w", err)
+		}
+		e.requestBodyRewritten = true
+	}
+	if e.config.estimateTokens {
+		e.tokenEstimate = estimateEmbeddingsTokens(e.config, model, body)
+	}
+	if e.quota, rejected = enforceQuotas(ctx, e.config, e.logger, model, e.consumerKey, e.requestHeaders, e.tokenEstimate); rejected != nil {
+		return rejected, nil
+	}
+	if e.responseCache = lookupEmbeddingsCache(ctx, e.config, e.logger, e.metrics, model, e.requestHeaders, rawBody.Body, metricAttrs...); e.responseCache != nil {
+		if e.responseCache.allHit() {
+			return e.responseCache.hitResponse(e.requestHeaders, model)
+		}
+		var misses []byte
+		if misses, err = e.responseCache.missesRequest(rawBody.Body); err != nil {
+			return nil, fmt.Errorf("failed to set the inputs missing the cache: %w", err)
+		}
+		if misses != nil {
+			rawBody = &extprocv3.HttpBody{Body: misses}
+			if _, body, err = parseOpenAIEmbeddingBody(rawBody); err != nil {
+				return nil, fmt.Errorf("failed to parse the request body of the inputs missing the cache: %w", err)
+			}
+			e.requestBodyRewritten = true
+			if e.tokenEstimate != nil {
+				// Only the inputs missing the cache are sent to the backend.
+				e.tokenEstimate = estimateEmbeddingsTokens(e.config, model, body)
+			}
+		}
+	}
+
 	additionalHeaders = append(additionalHeaders, &corev3.HeaderValueOption{
 		// Set the model name to the request header with the key `x-ai-eg-model`.
 		Header: &corev3.HeaderValue{Key: e.config.modelNameHeaderKey, RawValue: []byte(model)},
 	}, &corev3.HeaderValueOption{
 		Header: &corev3.HeaderValue{Key: originalPathHeader, RawValue: []byte(e.requestHeaders[":path"])},
 	})
+	var dm *structpb.Struct
+	if e.tokenEstimate != nil {
+		dm = buildTokenEstimationDynamicMetadata(e.config, nil, e.tokenEstimate)
+	}
 	e.originalRequestBody = body
 	e.originalRequestBodyRaw = rawBody.Body
 	return &extprocv3.ProcessingResponse{
@@ -117,12 +241,14 @@ func (e *embeddingsProcessorRouterFilter) ProcessRequestBody(_ context.Context,
 			RequestBody: &extprocv3.BodyResponse{
 				Response: &extprocv3.CommonResponse{
 					HeaderMutation: &extprocv3.HeaderMutation{
-						SetHeaders: additionalHeaders,
+						SetHeaders:    additionalHeaders,
+						RemoveHeaders: removedHeaders,
 					},
 					ClearRouteCache: true,
 				},
 			},
 		},
+		DynamicMetadata: dm,
 	}, nil
 }
 
@@ -145,8 +271,29 @@ type embeddingsProcessorUpstreamFilter struct {
 	onRetry bool
 	// cost is the cost of the request that is accumulated during the processing of the response.
 	costs translator.LLMTokenUsage
+	// quota is the quota state of the router filter charged when the response completes.
+	quota *quotaState
+	// tokenEstimate is the estimated token usage of the router filter reconciled with the actual usage when the
+	// response completes.
+	tokenEstimate *tokenEstimate
+	// price is the price of the model for the backend in the pricing catalog. This is nil if the model has no price.
+	price *filterapi.ModelPrice
+	// requestStart is the time when the request arrived at the router filter.
+	requestStart time.Time
 	// metrics tracking.
-	metrics x.EmbeddingsMetrics
+	metrics metrics.EmbeddingsMetrics
+	// metricAttrs are the additional attributes of the metrics of the request, e.g. the consumer.
+	metricAttrs []attribute.KeyValue
+	// requestBodyRewritten is true if the guardrails of the router filter modified the request body, in which case
+	// the body is always replaced even if the translator does not modify it.
+	requestBodyRewritten bool
+	// backendSchema is the API schema of the backend.
+	backendSchema filterapi.APISchemaName
+	// concurrencySlot holds the slot of the concurrency limit of the backend.
+	concurrencySlot
+	// responseCache is the lookup of the inputs in the response cache of the router filter, which stores the
+	// embeddings of the forwarded inputs and stitches the cached ones into the response.
+	responseCache *embeddingsCache
 }
 
 // selectTranslator selects the translator based on the output schema.
@@ -169,7 +316,7 @@ func (e *embeddingsProcessorUpstreamFilter) selectTranslator(out filterapi.Versi
 func (e *embeddingsProcessorUpstreamFilter) ProcessRequestHeaders(ctx context.Context, _ *corev3.HeaderMap) (res *extprocv3.ProcessingResponse, err error) {
 	defer func() {
 		if err != nil {
-			e.metrics.RecordRequestCompletion(ctx, false)
+			e.metrics.RecordRequestCompletion(ctx, false, e.metricAttrs...)
 		}
 	}()
 
@@ -177,6 +324,12 @@ func (e *embeddingsProcessorUpstreamFilter) ProcessRequestHeaders(ctx context.Co
 	e.metrics.StartRequest(e.requestHeaders)
 	e.metrics.SetModel(e.requestHeaders[e.config.modelNameHeaderKey])
 
+	if spill, err := e.acquireConcurrencySlot(ctx, e.metrics, e.requestHeaders); err != nil {
+		return nil, fmt.Errorf("failed to acquire the concurrency slot: %w", err)
+	} else if spill != nil {
+		return spill, nil
+	}
+
 	headerMutation, bodyMutation, err := e.translator.RequestBody(e.originalRequestBodyRaw, e.originalRequestBody, e.onRetry)
 	if err != nil {
 		return nil, fmt.Errorf("failed to transform request: %w", err)
@@ -188,6 +341,9 @@ func (e *embeddingsProcessorUpstreamFilter) ProcessRequestHeaders(ctx context.Co
 			e.requestHeaders[h.Header.Key] = string(h.Header.RawValue)
 		}
 	}
+	if bodyMutation == nil && e.requestBodyRewritten {
+		bodyMutation = rewrittenRequestBodyMutation(headerMutation, e.originalRequestBodyRaw)
+	}
 	if h := e.handler; h != nil {
 		if err = h.Do(ctx, e.requestHeaders, headerMutation, bodyMutation); err != nil {
 			return nil, fmt.Errorf("failed to do auth request: %w", err)
@@ -221,7 +377,7 @@ func (e *embeddingsProcessorUpstreamFilter) ProcessRequestBody(context.Context,
 func (e *embeddingsProcessorUpstreamFilter) ProcessResponseHeaders(ctx context.Context, headers *corev3.HeaderMap) (res *extprocv3.ProcessingResponse, err error) {
 	defer func() {
 		if err != nil {
-			e.metrics.RecordRequestCompletion(ctx, false)
+			e.metrics.RecordRequestCompletion(ctx, false, e.metricAttrs...)
 		}
 	}()
 
@@ -243,10 +399,12 @@ func (e *embeddingsProcessorUpstreamFilter) ProcessResponseHeaders(ctx context.C
 // ProcessResponseBody implements [Processor.ProcessResponseBody].
 func (e *embeddingsProcessorUpstreamFilter) ProcessResponseBody(ctx context.Context, body *extprocv3.HttpBody) (res *extprocv3.ProcessingResponse, err error) {
 	defer func() {
-		e.metrics.RecordRequestCompletion(ctx, err == nil)
+		e.metrics.RecordRequestCompletion(ctx, err == nil, e.metricAttrs...)
 	}()
 	var br io.Reader
 	var isGzip bool
+	// decoded is the response body before the translation, which is only needed for the response cache.
+	var decoded []byte
 	switch e.responseEncoding {
 	case "gzip":
 		br, err = gzip.NewReader(bytes.NewReader(body.Body))
@@ -254,14 +412,30 @@ func (e *embeddingsProcessorUpstreamFilter) ProcessResponseBody(ctx context.Cont
 			return nil, fmt.Errorf("failed to decode gzip: %w", err)
 		}
 		isGzip = true
+		if e.responseCache != nil {
+			if decoded, err = io.ReadAll(br); err != nil {
+				return nil, fmt.Errorf("failed to decode gzip: %w", err)
+			}
+			br = bytes.NewReader(decoded)
+		}
 	default:
 		br = bytes.NewReader(body.Body)
+		decoded = body.Body
 	}
 
 	headerMutation, bodyMutation, tokenUsage, err := e.translator.ResponseBody(e.responseHeaders, br, body.EndOfStream)
 	if err != nil {
 		return nil, fmt.Errorf("failed to transform response: %w", err)
 	}
+	if e.responseCache != nil && body.EndOfStream && e.responseHeaders[":status"] == "200" {
+		response := decoded
+		if bm := bodyMutation.GetBody(); bm != nil {
+			response = bm
+		}
+		if stitched := e.responseCache.stitch(ctx, e.logger, response); stitched != nil {
+			bodyMutation = &extprocv3.BodyMutation{Mutation: &extprocv3.BodyMutation_Body{Body: stitched}}
+		}
+	}
 	if bodyMutation != nil && isGzip {
 		if headerMutation == nil {
 			headerMutation = &extprocv3.HeaderMutation{}
@@ -291,10 +465,34 @@ func (e *embeddingsProcessorUpstreamFilter) ProcessResponseBody(ctx context.Cont
 	e.costs.TotalTokens += tokenUsage.TotalTokens
 
 	// Update metrics with token usage.
-	e.metrics.RecordTokenUsage(ctx, tokenUsage.InputTokens, tokenUsage.TotalTokens)
+	e.metrics.RecordTokenUsage(ctx, tokenUsage.InputTokens, tokenUsage.TotalTokens, e.metricAttrs...)
+	if body.EndOfStream && e.responseHeaders[":status"] == "200" {
+		traceEmbeddingsResponse(ctx, e.backendSchema, &e.costs)
+	}
 
-	if body.EndOfStream && len(e.config.requestCosts) > 0 {
-		resp.DynamicMetadata, err = buildDynamicMetadata(e.config, &e.costs, e.requestHeaders, e.modelNameOverride, e.backendName)
+	var pricing *llmcostcel.Pricing
+	if body.EndOfStream {
+		if pricing = computePricing(e.price, &e.costs, mediaUsage{}); pricing != nil {
+			e.metrics.RecordCost(ctx, pricing.CostMicroUSD, e.metricAttrs...)
+		}
+	}
+	var costContext *llmcostcel.RequestContext
+	if body.EndOfStream {
+		costContext = newRequestCostContext(e.config, &e.costs, pricing, e.requestHeaders, e.backendName)
+		costContext.Request.Retry = e.onRetry
+	}
+	if body.EndOfStream && e.quota != nil {
+		e.quota.charge(ctx, e.logger, costContext)
+	}
+	if body.EndOfStream && e.tokenEstimate != nil {
+		e.config.tokenCalibrator.observe(e.tokenEstimate.model, e.tokenEstimate.rawInput, e.costs.InputTokens)
+	}
+	if body.EndOfStream {
+		exportUsageRecord(ctx, e.config, usageLedgerOperationEmbeddings, costContext, e.modelNameOverride, e.responseHeaders, e.requestStart)
+	}
+
+	if body.EndOfStream && (len(e.config.requestCosts) > 0 || pricing != nil) {
+		resp.DynamicMetadata, err = buildDynamicMetadata(e.config, costContext, e.modelNameOverride)
 		if err != nil {
 			return nil, fmt.Errorf("failed to build dynamic metadata: %w", err)
 		}
@@ -306,22 +504,37 @@ func (e *embeddingsProcessorUpstreamFilter) ProcessResponseBody(ctx context.Cont
 // SetBackend implements [Processor.SetBackend].
 func (e *embeddingsProcessorUpstreamFilter) SetBackend(ctx context.Context, b *filterapi.Backend, backendHandler backendauth.Handler, routeProcessor Processor) (err error) {
 	defer func() {
-		e.metrics.RecordRequestCompletion(ctx, err == nil)
+		e.metrics.RecordRequestCompletion(ctx, err == nil, e.metricAttrs...)
 	}()
 	rp, ok := routeProcessor.(*embeddingsProcessorRouterFilter)
 	if !ok {
 		panic("BUG: expected routeProcessor to be of type *embeddingsProcessorRouterFilter")
 	}
 	rp.upstreamFilterCount++
+	e.quota = rp.quota
+	e.tokenEstimate = rp.tokenEstimate
+	e.requestStart = rp.requestStart
+	e.price = findModelPrice(e.config, e.requestHeaders[e.config.modelNameHeaderKey], b.Name)
+	if rp.consumerKey != nil {
+		e.metricAttrs = consumerKeyMetricAttributes(rp.consumerKey)
+	}
+	e.metricAttrs = append(e.metricAttrs, rp.routeMetricAttrs...)
+	if backend, ok := e.config.backends[b.Name]; ok {
+		e.limiter = backend.limiter
+	}
 	e.metrics.SetBackend(b)
 	e.modelNameOverride = b.ModelNameOverride
 	e.backendName = b.Name
+	e.backendSchema = b.Schema.Name
+	traceBackend(ctx, tracing.OperationEmbeddings, e.requestHeaders[e.config.modelNameHeaderKey], b)
 	if err = e.selectTranslator(b.Schema); err != nil {
 		return fmt.Errorf("failed to select translator: %w", err)
 	}
 	e.handler = backendHandler
 	e.originalRequestBody = rp.originalRequestBody
 	e.originalRequestBodyRaw = rp.originalRequestBodyRaw
+	e.requestBodyRewritten = rp.requestBodyRewritten
+	e.responseCache = rp.responseCache
 	e.onRetry = rp.upstreamFilterCount > 1
 	rp.upstreamFilter = e
 	return
@@ -0,0 +1,122 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+)
+
+const (
+	// experimentAttribute and experimentVariantAttribute are the metric attributes of the experiment assignment.
+	experimentAttribute        = "ai_gateway.experiment"
+	experimentVariantAttribute = "ai_gateway.experiment.variant"
+)
+
+// experimentSubject returns the identity of the end user of the request for the experiment assignment.
+// This returns an empty string if the identity is not available.
+func experimentSubject(ctx context.Context, exp *filterapi.Experiment, requestHeaders map[string]string) string {
+	if exp.SubjectHeader != "" {
+		return requestHeaders[strings.ToLower(exp.SubjectHeader)]
+	}
+	return jwtClaim(ctx, exp.SubjectJWTClaim)
+}
+
+// jwtClaim returns the value of the top-level claim of the JWT verified by the JWT authentication filter of Envoy.
+// Non-string values are returned in the JSON encoding. This returns an empty string if the request has no verified
+// JWT or the claim is not available.
+//
+// The claims are only read from the dynamic metadata set by the filter, and never decoded from the "Authorization"
+// header, which might carry a token that has not been verified. The payload is stored under the name of the JWT
+// provider, so the providers are looked up in the order of their names.
+func jwtClaim(ctx context.Context, claim string) string {
+	md, _ := ctx.Value(requestMetadataKey{}).(*corev3.Metadata)
+	providers := md.GetFilterMetadata()[internalapi.JWTAuthnMetadataNamespace].GetFields()
+	for _, name := range slices.Sorted(maps.Keys(providers)) {
+		v, ok := providers[name].GetStructValue().GetFields()[claim]
+		if !ok {
+			continue
+		}
+		switch kind := v.GetKind().(type) {
+		case *structpb.Value_StringValue:
+			return kind.StringValue
+		case *structpb.Value_NullValue:
+			return ""
+		default:
+			raw, _ := json.Marshal(v.AsInterface())
+			return string(raw)
+		}
+	}
+	return ""
+}
+
+// assignExperimentVariant deterministically assigns the end user identified by the subject to one of the variants
+// of the experiment according to their weights. This returns nil if no variant has a positive weight.
+func assignExperimentVariant(exp *filterapi.Experiment, subject string) *filterapi.ExperimentVariant {
+	var total uint64
+	for i := range exp.Variants {
+		total += uint64(max(exp.Variants[i].Weight, 0)) //nolint:gosec
+	}
+	if total == 0 {
+		return nil
+	}
+	h := fnv.New64a()
+	// The experiment name is hashed together so that the assignments of different experiments are independent.
+	_, _ = h.Write([]byte(exp.Name))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(subject))
+	point := h.Sum64() % total
+	for i := range exp.Variants {
+		w := uint64(max(exp.Variants[i].Weight, 0)) //nolint:gosec
+		if point < w {
+			return &exp.Variants[i]
+		}
+		point -= w
+	}
+	return nil // Unreachable.
+}
+
+// buildExperimentDynamicMetadata builds the dynamic metadata for the experiment assignment. The variant in the
+// EnvoyLBMetadataNamespace namespace is used by Envoy to select the endpoints of the variant.
+func buildExperimentDynamicMetadata(config *processorConfig, experiment string, variant *filterapi.ExperimentVariant) *structpb.Struct {
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		internalapi.EnvoyLBMetadataNamespace: structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			internalapi.ExperimentVariantMetadataKey: structpb.NewStringValue(variant.Key),
+		}}),
+		config.metadataNamespace: structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"experiment":         structpb.NewStringValue(experiment),
+			"experiment_variant": structpb.NewStringValue(variant.Name),
+		}}),
+	}}
+}
+
+// setExperimentResponseHeaders adds the response headers of the experiment assignment to the response.
+func setExperimentResponseHeaders(res *extprocv3.ProcessingResponse, experiment, variant string) {
+	addResponseHeaders(res,
+		&corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: internalapi.ExperimentHeader, RawValue: []byte(experiment)}},
+		&corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: internalapi.ExperimentVariantHeader, RawValue: []byte(variant)}},
+	)
+}
+
+// experimentMetricAttributes returns the metric attributes of the experiment assignment.
+func experimentMetricAttributes(experiment, variant string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(experimentAttribute, experiment),
+		attribute.String(experimentVariantAttribute, variant),
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package export provides the batching and retrying export of the records to the sinks in the background, which is
+// shared by the usage ledger and the audit log.
+package export
+
+import (
+	"context"
+	"errors"
+)
+
+// Sink is the destination of the records of type R.
+type Sink[R any] interface {
+	// Export exports the batch of the records. This is called from a single goroutine, and the records must not
+	// be retained after this returns.
+	//
+	// The batch is retried when this returns an error unless the error is wrapped with [Permanent].
+	Export(ctx context.Context, records []*R) error
+	// Close releases the resources held by the sink.
+	Close() error
+}
+
+// permanentError is the error which is not resolved by retrying the export.
+type permanentError struct{ err error }
+
+// Error implements [error].
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// Unwrap returns the wrapped error.
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps the error returned by [Sink.Export] so that the batch is not retried.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent returns true if the error is wrapped with [Permanent].
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
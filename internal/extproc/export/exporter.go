@@ -0,0 +1,168 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package export
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// exporterQueueSize is the number of the records buffered before they are dropped.
+	exporterQueueSize = 8192
+	// exporterBatchSize is the maximum number of the records exported at once.
+	exporterBatchSize = 256
+	// exporterFlushInterval is the maximum time the records are buffered before they are exported.
+	exporterFlushInterval = time.Second
+	// exporterMaxRetries is the number of the retries of a failed export, which are made with the exponential
+	// backoff starting from exporterInitialBackoff.
+	exporterMaxRetries     = 5
+	exporterInitialBackoff = 100 * time.Millisecond
+
+	// Timeout is the timeout of each export.
+	Timeout = 10 * time.Second
+)
+
+// Exporter exports the records of type R to the [Sink] in the background.
+//
+// The records are buffered and exported in batches, so that the request processing is never blocked by a slow
+// sink. When the buffer is full, the records are dropped and counted instead.
+type Exporter[R any] struct {
+	sink    Sink[R]
+	logger  *slog.Logger
+	name    string
+	prepare func(*R)
+	queue   chan *R
+	stop    chan struct{}
+	done    chan struct{}
+	stopped sync.Once
+	// dropped is the number of the records dropped since the last time it was logged.
+	dropped atomic.Uint64
+
+	// The parameters which are replaced in tests.
+	batchSize      int
+	flushInterval  time.Duration
+	initialBackoff time.Duration
+}
+
+// NewExporter creates a new [Exporter] and starts exporting the records to the sink.
+// The sink is closed when the exporter is closed.
+//
+// The name is the name of the records in the logs, e.g., "usage records". The prepare function, if not nil, is called
+// on each record in the background before it is exported, so that the expensive conversion of the record never adds
+// latency to the request processing.
+func NewExporter[R any](sink Sink[R], logger *slog.Logger, name string, prepare func(*R)) *Exporter[R] {
+	e := newExporter(sink, logger, name, prepare, exporterBatchSize, exporterFlushInterval, exporterInitialBackoff)
+	go e.run()
+	return e
+}
+
+func newExporter[R any](sink Sink[R], logger *slog.Logger, name string, prepare func(*R),
+	batchSize int, flushInterval, initialBackoff time.Duration,
+) *Exporter[R] {
+	return &Exporter[R]{
+		sink:           sink,
+		logger:         logger,
+		name:           name,
+		prepare:        prepare,
+		queue:          make(chan *R, exporterQueueSize),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+		batchSize:      batchSize,
+		flushInterval:  flushInterval,
+		initialBackoff: initialBackoff,
+	}
+}
+
+// Export enqueues the record to be exported. This never blocks.
+func (e *Exporter[R]) Export(r *R) {
+	select {
+	case e.queue <- r:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Close exports the buffered records, and closes the sink. The records enqueued after this is called are discarded.
+func (e *Exporter[R]) Close() error {
+	e.stopped.Do(func() { close(e.stop) })
+	<-e.done
+	return e.sink.Close()
+}
+
+// run exports the records in batches until the exporter is closed.
+func (e *Exporter[R]) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+	batch := make([]*R, 0, e.batchSize)
+	for {
+		select {
+		case r := <-e.queue:
+			if batch = append(batch, r); len(batch) >= e.batchSize {
+				e.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				e.flush(batch)
+				batch = batch[:0]
+			}
+			e.logDropped()
+		case <-e.stop:
+			for {
+				select {
+				case r := <-e.queue:
+					if batch = append(batch, r); len(batch) >= e.batchSize {
+						e.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					if len(batch) > 0 {
+						e.flush(batch)
+					}
+					e.logDropped()
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush exports the batch with the retries. The batch is dropped when all the attempts fail.
+func (e *Exporter[R]) flush(batch []*R) {
+	if e.prepare != nil {
+		for _, r := range batch {
+			e.prepare(r)
+		}
+	}
+	backoff := e.initialBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		err := e.sink.Export(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt == exporterMaxRetries || IsPermanent(err) {
+			e.logger.Error("failed to export "+e.name,
+				slog.Int("records", len(batch)), slog.Int("attempts", attempt+1), slog.String("error", err.Error()))
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// logDropped logs the number of the records dropped since the last time it was logged.
+func (e *Exporter[R]) logDropped() {
+	if n := e.dropped.Swap(0); n > 0 {
+		e.logger.Warn("dropped "+e.name+" as the export queue is full", slog.Uint64("records", n))
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testRecord is the record exported in the tests.
+type testRecord struct {
+	ID string `json:"id"`
+}
+
+// fakeSink is a [Sink] which records the IDs of the exported batches. The exports fail with err as many times as failures.
+type fakeSink struct {
+	mu       sync.Mutex
+	batches  [][]string
+	attempts int
+	failures int
+	err      error
+	closed   bool
+	// block is closed to unblock the exports when non-nil.
+	block chan struct{}
+}
+
+// Export implements [Sink.Export].
+func (s *fakeSink) Export(_ context.Context, records []*testRecord) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.attempts <= s.failures {
+		return s.err
+	}
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	s.batches = append(s.batches, ids)
+	return nil
+}
+
+// Close implements [Sink.Close].
+func (s *fakeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *fakeSink) exported() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
+
+func TestExporter(t *testing.T) {
+	t.Run("batch", func(t *testing.T) {
+		sink := &fakeSink{}
+		e := newExporter[testRecord](sink, slog.Default(), "test records", nil, 2, time.Hour, time.Millisecond)
+		go e.run()
+		for i := range 5 {
+			e.Export(&testRecord{ID: fmt.Sprint(i)})
+		}
+		require.Eventually(t, func() bool { return len(sink.exported()) == 2 }, time.Second, time.Millisecond)
+		// The remaining record is exported when the exporter is closed.
+		require.NoError(t, e.Close())
+		require.Equal(t, [][]string{{"0", "1"}, {"2", "3"}, {"4"}}, sink.exported())
+		require.True(t, sink.closed)
+	})
+	t.Run("flush interval", func(t *testing.T) {
+		sink := &fakeSink{}
+		e := newExporter[testRecord](sink, slog.Default(), "test records", nil, 100, 10*time.Millisecond, time.Millisecond)
+		go e.run()
+		e.Export(&testRecord{ID: "a"})
+		require.Eventually(t, func() bool { return len(sink.exported()) == 1 }, time.Second, time.Millisecond)
+		require.NoError(t, e.Close())
+	})
+	t.Run("prepare", func(t *testing.T) {
+		sink := &fakeSink{}
+		e := newExporter(sink, slog.Default(), "test records", func(r *testRecord) { r.ID += "-prepared" }, 1, time.Hour, time.Millisecond)
+		go e.run()
+		e.Export(&testRecord{ID: "a"})
+		require.NoError(t, e.Close())
+		require.Equal(t, [][]string{{"a-prepared"}}, sink.exported())
+	})
+	t.Run("retry", func(t *testing.T) {
+		sink := &fakeSink{failures: 2, err: errors.New("unavailable")}
+		e := newExporter[testRecord](sink, slog.Default(), "test records", nil, 1, time.Hour, time.Millisecond)
+		go e.run()
+		e.Export(&testRecord{ID: "a"})
+		require.NoError(t, e.Close())
+		require.Equal(t, [][]string{{"a"}}, sink.exported())
+		require.Equal(t, 3, sink.attempts)
+	})
+	t.Run("give up", func(t *testing.T) {
+		var buf bytes.Buffer
+		sink := &fakeSink{failures: 100, err: errors.New("unavailable")}
+		e := newExporter[testRecord](sink, slog.New(slog.NewTextHandler(&buf, nil)), "test records", nil, 1, time.Hour, time.Millisecond)
+		go e.run()
+		e.Export(&testRecord{ID: "a"})
+		require.NoError(t, e.Close())
+		require.Empty(t, sink.exported())
+		require.Equal(t, exporterMaxRetries+1, sink.attempts)
+		require.Contains(t, buf.String(), "failed to export test records")
+	})
+	t.Run("permanent error", func(t *testing.T) {
+		sink := &fakeSink{failures: 100, err: Permanent(errors.New("bad request"))}
+		e := newExporter[testRecord](sink, slog.Default(), "test records", nil, 1, time.Hour, time.Millisecond)
+		go e.run()
+		e.Export(&testRecord{ID: "a"})
+		require.NoError(t, e.Close())
+		require.Equal(t, 1, sink.attempts)
+	})
+	t.Run("drop when full", func(t *testing.T) {
+		var buf bytes.Buffer
+		sink := &fakeSink{block: make(chan struct{})}
+		e := newExporter[testRecord](sink, slog.New(slog.NewTextHandler(&buf, nil)), "test records", nil, 1, time.Hour, time.Millisecond)
+		go e.run()
+		// The exporter holds the first record in the blocked export, and the rest fill the queue.
+		e.Export(&testRecord{})
+		require.Eventually(t, func() bool { return len(e.queue) == 0 }, time.Second, time.Millisecond)
+		for range exporterQueueSize + 10 {
+			e.Export(&testRecord{})
+		}
+		require.Equal(t, uint64(10), e.dropped.Load())
+		close(sink.block)
+		require.NoError(t, e.Close())
+		require.Len(t, sink.exported(), exporterQueueSize+1)
+		require.Contains(t, buf.String(), "records=10")
+	})
+}
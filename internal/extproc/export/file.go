@@ -0,0 +1,108 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// NewFileSink creates a new [Sink] which appends the records to the file at the given path as JSON lines.
+//
+// The file is rotated when its size would exceed maxSize bytes. The rotated files are renamed to path.1, path.2, ...
+// with the larger suffix being the older one, and only maxBackups of them are kept. The name is the name of the file
+// in the errors, e.g., "usage ledger file".
+func NewFileSink[R any](path string, maxSize int64, maxBackups int, name string) (Sink[R], error) {
+	s := &fileSink[R]{path: path, maxSize: maxSize, maxBackups: maxBackups, name: name}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// fileSink implements [Sink] with the rotating JSON lines files.
+type fileSink[R any] struct {
+	path       string
+	name       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+	buf        bytes.Buffer
+}
+
+// Export implements [Sink.Export].
+func (s *fileSink[R]) Export(_ context.Context, records []*R) error {
+	s.buf.Reset()
+	enc := json.NewEncoder(&s.buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return Permanent(fmt.Errorf("failed to encode record: %w", err))
+		}
+	}
+	if s.size > 0 && s.size+int64(s.buf.Len()) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(s.buf.Bytes())
+	s.size += int64(n)
+	if err != nil {
+		return Permanent(fmt.Errorf("failed to write records: %w", err))
+	}
+	return nil
+}
+
+// Close implements [Sink.Close].
+func (s *fileSink[R]) Close() error {
+	return s.f.Close()
+}
+
+// open opens the file at the path for appending.
+func (s *fileSink[R]) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.name, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat %s: %w", s.name, err)
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files by one, and reopens the file at the path. The file is reopened even when the
+// rotation fails, so that the sink can be retried.
+func (s *fileSink[R]) rotate() error {
+	_ = s.f.Close()
+	var err error
+	if s.maxBackups > 0 {
+		for i := s.maxBackups - 1; i > 0; i-- {
+			_ = os.Rename(s.backupPath(i), s.backupPath(i+1))
+		}
+		err = os.Rename(s.path, s.backupPath(1))
+	} else {
+		err = os.Remove(s.path)
+	}
+	if openErr := s.open(); openErr != nil {
+		return openErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rotate %s: %w", s.name, err)
+	}
+	return nil
+}
+
+// backupPath returns the path of the i-th rotated file.
+func (s *fileSink[R]) backupPath(i int) string {
+	return s.path + "." + strconv.Itoa(i)
+}
@@ -0,0 +1,57 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package export
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	internaltesting "github.com/envoyproxy/ai-gateway/internal/testing"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	r := &testRecord{ID: "a"}
+	raw, err := json.Marshal(r)
+	require.NoError(t, err)
+	// Each file holds up to two records.
+	s, err := NewFileSink[testRecord](path, int64(2*(len(raw)+1)), 2, "test file")
+	require.NoError(t, err)
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		r.ID = id
+		require.NoError(t, s.Export(t.Context(), []*testRecord{r}))
+	}
+	require.NoError(t, s.Close())
+
+	require.Equal(t, []string{"g"}, internaltesting.ReadRecordIDs(t, path))
+	require.Equal(t, []string{"e", "f"}, internaltesting.ReadRecordIDs(t, path+".1"))
+	require.Equal(t, []string{"c", "d"}, internaltesting.ReadRecordIDs(t, path+".2"))
+	require.NoFileExists(t, path+".3")
+
+	t.Run("appends to the existing file", func(t *testing.T) {
+		s, err = NewFileSink[testRecord](path, 1<<20, 0, "test file")
+		require.NoError(t, err)
+		r.ID = "h"
+		require.NoError(t, s.Export(t.Context(), []*testRecord{r}))
+		require.NoError(t, s.Close())
+		require.Equal(t, []string{"g", "h"}, internaltesting.ReadRecordIDs(t, path))
+	})
+	t.Run("no backups", func(t *testing.T) {
+		s, err = NewFileSink[testRecord](path, 1, 0, "test file")
+		require.NoError(t, err)
+		r.ID = "i"
+		require.NoError(t, s.Export(t.Context(), []*testRecord{r}))
+		require.NoError(t, s.Close())
+		require.Equal(t, []string{"i"}, internaltesting.ReadRecordIDs(t, path))
+	})
+	t.Run("invalid path", func(t *testing.T) {
+		_, err = NewFileSink[testRecord](filepath.Join(t.TempDir(), "missing", "records.jsonl"), 1, 0, "test file")
+		require.ErrorContains(t, err, "failed to open test file")
+	})
+}
@@ -0,0 +1,190 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ExternalCheckMethod is the full name of the unary gRPC method of the external guardrail services, which is
+// equivalent to the following:
+//
+//	package envoy.ai_gateway.guardrail.v1;
+//
+//	service Guardrail {
+//	  rpc Check(google.protobuf.Struct) returns (google.protobuf.Struct);
+//	}
+//
+// The request and the response are in the same form as the JSON bodies of the HTTP services.
+const ExternalCheckMethod = "/envoy.ai_gateway.guardrail.v1.Guardrail/Check"
+
+// maxExternalVerdictSize is the maximum size of the verdict returned by the HTTP service.
+const maxExternalVerdictSize = 16 << 20
+
+// ExternalPhase is the phase in which the external guardrail service is called.
+type ExternalPhase string
+
+const (
+	// ExternalPhaseRequest is the phase before the request is routed to the backend.
+	ExternalPhaseRequest ExternalPhase = "request"
+	// ExternalPhaseResponse is the phase before the non-streaming response is returned to the client.
+	ExternalPhaseResponse ExternalPhase = "response"
+)
+
+// ExternalCheckRequest is the request to the external guardrail service.
+type ExternalCheckRequest struct {
+	// Phase is the phase in which the service is called.
+	Phase ExternalPhase `json:"phase"`
+	// Guardrail is the name of the guardrail.
+	Guardrail string `json:"guardrail"`
+	// RouteRule is the name of the route rule of the model.
+	RouteRule string `json:"route_rule"`
+	// Model is the model of the request.
+	Model string `json:"model"`
+	// Operation is the API of the request, either "chat_completions" or "embeddings".
+	Operation string `json:"operation"`
+	// Request is the OpenAI request body.
+	Request json.RawMessage `json:"request"`
+	// Response is the OpenAI response body. This is only set in the response phase.
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// VerdictAction is the action of the verdict of the external guardrail service.
+type VerdictAction string
+
+const (
+	// VerdictAllow allows the request or the response as is.
+	VerdictAllow VerdictAction = "allow"
+	// VerdictBlock rejects the request with the message of the verdict.
+	VerdictBlock VerdictAction = "block"
+	// VerdictRewrite replaces the request or the response with the one in the verdict.
+	VerdictRewrite VerdictAction = "rewrite"
+)
+
+// Verdict is the response of the external guardrail service.
+type Verdict struct {
+	// Action is the action of the verdict.
+	Action VerdictAction `json:"action"`
+	// Message is the message returned to the client when the action is block. Optional.
+	Message string `json:"message,omitempty"`
+	// Request is the rewritten request body when the action is rewrite in the request phase.
+	Request json.RawMessage `json:"request,omitempty"`
+	// Response is the rewritten response body when the action is rewrite in the response phase.
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Rewritten returns the rewritten body of the phase.
+func (v *Verdict) Rewritten(phase ExternalPhase) json.RawMessage {
+	if phase == ExternalPhaseRequest {
+		return v.Request
+	}
+	return v.Response
+}
+
+// Validate returns an error if the verdict is invalid in the phase.
+func (v *Verdict) Validate(phase ExternalPhase) error {
+	switch v.Action {
+	case VerdictAllow, VerdictBlock:
+		return nil
+	case VerdictRewrite:
+		if rewritten := bytes.TrimSpace(v.Rewritten(phase)); len(rewritten) == 0 || rewritten[0] != '{' {
+			return fmt.Errorf("rewrite verdict without the %s object", phase)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown verdict action %q", v.Action)
+	}
+}
+
+// ExternalClient calls an external guardrail service. The deadline of the call is set by the context.
+type ExternalClient interface {
+	// Check returns the verdict of the service on the request.
+	Check(ctx context.Context, req *ExternalCheckRequest) (*Verdict, error)
+}
+
+// NewHTTPExternalClient creates a new ExternalClient POSTing the JSON request to the URL of the HTTP service.
+func NewHTTPExternalClient(url string) ExternalClient {
+	return &httpExternalClient{url: url, client: http.DefaultClient}
+}
+
+type httpExternalClient struct {
+	url    string
+	client *http.Client
+}
+
+// Check implements [ExternalClient.Check].
+func (c *httpExternalClient) Check(ctx context.Context, req *ExternalCheckRequest) (*Verdict, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call the service: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	verdict := &Verdict{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxExternalVerdictSize)).Decode(verdict); err != nil {
+		return nil, fmt.Errorf("failed to decode verdict: %w", err)
+	}
+	return verdict, nil
+}
+
+// NewGRPCExternalClient creates a new ExternalClient calling the [ExternalCheckMethod] of the gRPC service at the
+// address without TLS. The connection is established lazily on the first call.
+func NewGRPCExternalClient(address string) (ExternalClient, error) {
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	return &grpcExternalClient{conn: conn}, nil
+}
+
+type grpcExternalClient struct {
+	conn *grpc.ClientConn
+}
+
+// Check implements [ExternalClient.Check].
+func (c *grpcExternalClient) Check(ctx context.Context, req *ExternalCheckRequest) (*Verdict, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	in := &structpb.Struct{}
+	if err = protojson.Unmarshal(body, in); err != nil {
+		return nil, fmt.Errorf("failed to convert request: %w", err)
+	}
+	out := &structpb.Struct{}
+	if err = c.conn.Invoke(ctx, ExternalCheckMethod, in, out); err != nil {
+		return nil, fmt.Errorf("failed to call the service: %w", err)
+	}
+	if body, err = protojson.Marshal(out); err != nil {
+		return nil, fmt.Errorf("failed to convert verdict: %w", err)
+	}
+	verdict := &Verdict{}
+	if err = json.Unmarshal(body, verdict); err != nil {
+		return nil, fmt.Errorf("failed to decode verdict: %w", err)
+	}
+	return verdict, nil
+}
@@ -0,0 +1,159 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// stubVerdict is the verdict of the stub services, rewriting the request with the "[safe]" content if the request
+// contains "rewrite", blocking it if it contains "block", and allowing it otherwise.
+func stubVerdict(req *ExternalCheckRequest) *Verdict {
+	switch {
+	case string(req.Request) == `{"content":"block"}`:
+		return &Verdict{Action: VerdictBlock, Message: "blocked by stub"}
+	case string(req.Request) == `{"content":"rewrite"}`:
+		return &Verdict{Action: VerdictRewrite, Request: json.RawMessage(`{"content":"[safe]"}`)}
+	default:
+		return &Verdict{Action: VerdictAllow}
+	}
+}
+
+// startGRPCStub starts the gRPC stub service on the local port and returns its address.
+func startGRPCStub(t *testing.T, verdict func(*ExternalCheckRequest) *Verdict) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "envoy.ai_gateway.guardrail.v1.Guardrail",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Check",
+			Handler: func(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				in := &structpb.Struct{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				body, _ := protojson.Marshal(in)
+				req := &ExternalCheckRequest{}
+				if err := json.Unmarshal(body, req); err != nil {
+					return nil, err
+				}
+				// The JSON objects in the Struct are re-encoded, so the request is compacted to compare it.
+				var compact map[string]any
+				_ = json.Unmarshal(req.Request, &compact)
+				req.Request, _ = json.Marshal(compact)
+				body, _ = json.Marshal(verdict(req))
+				out := &structpb.Struct{}
+				return out, protojson.Unmarshal(body, out)
+			},
+		}},
+	}, struct{}{})
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func TestExternalClient(t *testing.T) {
+	httpStub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("content-type"))
+		req := &ExternalCheckRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		require.Equal(t, ExternalPhaseRequest, req.Phase)
+		require.Equal(t, "classifier", req.Guardrail)
+		_ = json.NewEncoder(w).Encode(stubVerdict(req))
+	}))
+	t.Cleanup(httpStub.Close)
+	grpcClient, err := NewGRPCExternalClient(startGRPCStub(t, stubVerdict))
+	require.NoError(t, err)
+
+	for name, client := range map[string]ExternalClient{
+		"http": NewHTTPExternalClient(httpStub.URL),
+		"grpc": grpcClient,
+	} {
+		t.Run(name, func(t *testing.T) {
+			check := func(content string) *Verdict {
+				v, err := client.Check(t.Context(), &ExternalCheckRequest{
+					Phase: ExternalPhaseRequest, Guardrail: "classifier", Model: "gpt", Operation: "chat_completions",
+					Request: json.RawMessage(`{"content":"` + content + `"}`),
+				})
+				require.NoError(t, err)
+				require.NoError(t, v.Validate(ExternalPhaseRequest))
+				return v
+			}
+			require.Equal(t, VerdictAllow, check("hello").Action)
+			require.Equal(t, &Verdict{Action: VerdictBlock, Message: "blocked by stub"}, check("block"))
+			v := check("rewrite")
+			require.Equal(t, VerdictRewrite, v.Action)
+			require.JSONEq(t, `{"content":"[safe]"}`, string(v.Rewritten(ExternalPhaseRequest)))
+		})
+	}
+}
+
+func TestExternalClient_errors(t *testing.T) {
+	t.Run("http status", func(t *testing.T) {
+		stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(stub.Close)
+		_, err := NewHTTPExternalClient(stub.URL).Check(t.Context(), &ExternalCheckRequest{})
+		require.ErrorContains(t, err, "unexpected status code 500")
+	})
+	t.Run("http invalid verdict", func(t *testing.T) {
+		stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("not json"))
+		}))
+		t.Cleanup(stub.Close)
+		_, err := NewHTTPExternalClient(stub.URL).Check(t.Context(), &ExternalCheckRequest{})
+		require.ErrorContains(t, err, "failed to decode verdict")
+	})
+	t.Run("http timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		stub := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+			<-release
+		}))
+		t.Cleanup(stub.Close)
+		t.Cleanup(func() { close(release) })
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		_, err := NewHTTPExternalClient(stub.URL).Check(ctx, &ExternalCheckRequest{})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+	t.Run("grpc unavailable", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		require.NoError(t, lis.Close())
+		client, err := NewGRPCExternalClient(lis.Addr().String())
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+		_, err = client.Check(ctx, &ExternalCheckRequest{})
+		require.ErrorContains(t, err, "failed to call the service")
+	})
+}
+
+func TestVerdict_Validate(t *testing.T) {
+	require.NoError(t, (&Verdict{Action: VerdictAllow}).Validate(ExternalPhaseRequest))
+	require.NoError(t, (&Verdict{Action: VerdictBlock}).Validate(ExternalPhaseResponse))
+	require.NoError(t, (&Verdict{Action: VerdictRewrite, Response: json.RawMessage(`{}`)}).Validate(ExternalPhaseResponse))
+	require.ErrorContains(t, (&Verdict{Action: VerdictRewrite, Response: json.RawMessage(`{}`)}).Validate(ExternalPhaseRequest),
+		"rewrite verdict without the request object")
+	require.ErrorContains(t, (&Verdict{Action: VerdictRewrite, Request: json.RawMessage(`"x"`)}).Validate(ExternalPhaseRequest),
+		"rewrite verdict without the request object")
+	require.ErrorContains(t, (&Verdict{Action: "deny"}).Validate(ExternalPhaseRequest), `unknown verdict action "deny"`)
+}
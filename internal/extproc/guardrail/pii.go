@@ -0,0 +1,248 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package guardrail provides the detectors used by the guardrails of the AIGatewayRoutes to inspect the requests
+// and the responses.
+package guardrail
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+// piiDetector detects the values matching the pattern and passing the validation, if any.
+type piiDetector struct {
+	// name is the name used in the placeholders, the tokens and the metrics.
+	name     string
+	pattern  *regexp.Regexp
+	validate func(string) bool
+}
+
+// builtinPIIDetectors are the detectors of the built-in types.
+var builtinPIIDetectors = map[filterapi.PIIDetectorType]piiDetector{
+	filterapi.PIIDetectorTypeEmail: {
+		name:    "EMAIL",
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	},
+	filterapi.PIIDetectorTypePhoneNumber: {
+		name:    "PHONE_NUMBER",
+		pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?(?:\(\d{3}\)[ .\-]?|\b\d{3}[ .\-]?)\d{3}[ .\-]?\d{4}\b`),
+	},
+	filterapi.PIIDetectorTypeCreditCard: {
+		name:    "CREDIT_CARD",
+		pattern: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		validate: func(s string) bool {
+			digits := digitsOf(s)
+			return len(digits) >= 13 && len(digits) <= 19 && luhn(digits)
+		},
+	},
+	filterapi.PIIDetectorTypeUSSocialSecurityNumber: {
+		name:     "US_SSN",
+		pattern:  regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		validate: validUSSocialSecurityNumber,
+	},
+	filterapi.PIIDetectorTypeIBAN: {
+		name:     "IBAN",
+		pattern:  regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`),
+		validate: mod97,
+	},
+}
+
+// PIIRedactor detects the personally identifiable information in the text and redacts it according to the action
+// of the PIIGuardrail.
+type PIIRedactor struct {
+	action    filterapi.PIIAction
+	detectors []piiDetector
+}
+
+// NewPIIRedactor creates a new PIIRedactor for the guardrail. This returns an error if any custom pattern is invalid.
+func NewPIIRedactor(g *filterapi.PIIGuardrail) (*PIIRedactor, error) {
+	r := &PIIRedactor{action: g.Action}
+	for _, d := range g.Detectors {
+		if d.Type != filterapi.PIIDetectorTypeCustom {
+			builtin, ok := builtinPIIDetectors[d.Type]
+			if !ok {
+				return nil, fmt.Errorf("unknown PII detector type %q", d.Type)
+			}
+			r.detectors = append(r.detectors, builtin)
+			continue
+		}
+		pattern, err := regexp.Compile(d.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of PII detector %q: %w", d.Name, err)
+		}
+		custom := piiDetector{name: d.Name, pattern: pattern}
+		switch d.Validator {
+		case "":
+		case filterapi.PIIValidatorLuhn:
+			custom.validate = func(s string) bool {
+				digits := digitsOf(s)
+				return len(digits) > 1 && luhn(digits)
+			}
+		case filterapi.PIIValidatorMod97:
+			custom.validate = mod97
+		default:
+			return nil, fmt.Errorf("unknown validator %q of PII detector %q", d.Validator, d.Name)
+		}
+		r.detectors = append(r.detectors, custom)
+	}
+	return r, nil
+}
+
+// Action returns the action of the guardrail.
+func (r *PIIRedactor) Action() filterapi.PIIAction {
+	return r.action
+}
+
+// piiMatch is a value detected in the text.
+type piiMatch struct {
+	start, end int
+	name       string
+}
+
+// Redact returns the text with the detected values replaced according to the action, and adds the number of the
+// detected values per detector to the detections. The values are replaced with the tokens issued by the vault
+// when the action is Tokenize, and the text is returned as is when the action is Reject.
+func (r *PIIRedactor) Redact(text string, vault *PIIVault, detections map[string]int) string {
+	var matches []piiMatch
+	for _, d := range r.detectors {
+		for _, loc := range d.pattern.FindAllStringIndex(text, -1) {
+			if d.validate == nil || d.validate(text[loc[0]:loc[1]]) {
+				matches = append(matches, piiMatch{start: loc[0], end: loc[1], name: d.name})
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return text
+	}
+	// The earliest and then the longest match wins when the matches of the detectors overlap.
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m.start < last {
+			continue
+		}
+		detections[m.name]++
+		b.WriteString(text[last:m.start])
+		switch r.action {
+		case filterapi.PIIActionTokenize:
+			b.WriteString(vault.token(m.name, text[m.start:m.end]))
+		case filterapi.PIIActionReject:
+			b.WriteString(text[m.start:m.end])
+		default:
+			b.WriteString("[REDACTED_" + m.name + "]")
+		}
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// digitsOf returns the digits in the string.
+func digitsOf(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// luhn returns true if the digits pass the Luhn checksum.
+func luhn(digits string) bool {
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// mod97 returns true if the letters and the digits in the string pass the ISO 7064 MOD 97-10 checksum, where the
+// first four characters are moved to the end and the letters are converted to the numbers from 10 to 35.
+func mod97(s string) bool {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	if len(s) < 5 {
+		return false
+	}
+	rem := 0
+	for _, c := range s[4:] + s[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// validUSSocialSecurityNumber returns true if the number in the form of "AAA-GG-SSSS" has never been invalid, i.e.,
+// the area is neither 000, 666 nor 9xx, the group is not 00, and the serial is not 0000.
+func validUSSocialSecurityNumber(s string) bool {
+	area, group, serial := s[0:3], s[4:6], s[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// PIIVault keeps the original values of the tokens issued for a request, which is only kept in memory during the request.
+type PIIVault struct {
+	// tokens maps the original values to their tokens, so that the same value is replaced with the same token.
+	tokens map[string]string
+	// values maps the tokens to their original values.
+	values map[string]string
+	// counts is the number of the tokens issued per detector.
+	counts map[string]int
+}
+
+// NewPIIVault creates a new empty PIIVault.
+func NewPIIVault() *PIIVault {
+	return &PIIVault{tokens: map[string]string{}, values: map[string]string{}, counts: map[string]int{}}
+}
+
+// Len returns the number of the tokens issued.
+func (v *PIIVault) Len() int {
+	return len(v.values)
+}
+
+// token returns the token of the value detected by the detector, issuing a new one if not issued yet.
+func (v *PIIVault) token(name, value string) string {
+	if t, ok := v.tokens[value]; ok {
+		return t
+	}
+	v.counts[name]++
+	t := "[PII_" + name + "_" + strconv.Itoa(v.counts[name]) + "]"
+	v.tokens[value] = t
+	v.values[t] = value
+	return t
+}
+
+// Detokenize returns the text with the tokens issued by the vault replaced with their original values.
+func (v *PIIVault) Detokenize(text string) string {
+	return piiTokenPattern.ReplaceAllStringFunc(text, func(t string) string {
+		if value, ok := v.values[t]; ok {
+			return value
+		}
+		return t
+	})
+}
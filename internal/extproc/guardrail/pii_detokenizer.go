@@ -0,0 +1,137 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var (
+	// piiTokenPattern matches the tokens issued by the PIIVault.
+	piiTokenPattern = regexp.MustCompile(`\[PII_[A-Z][A-Z0-9_]*_\d+\]`)
+	// piiTokenPrefixPattern matches the trailing part of the text which can be the beginning of a token.
+	piiTokenPrefixPattern = regexp.MustCompile(`\[(?:P(?:I(?:I(?:_[A-Z0-9_]*)?)?)?)?$`)
+)
+
+// piiTokenMaxLength is the maximum length of the text held back as the beginning of a token. The longer text cannot
+// be a token since the names of the detectors are at most 32 characters.
+const piiTokenMaxLength = 64
+
+// PIIDetokenizer replaces the tokens in the OpenAI chat completion response with the original values kept in the
+// PIIVault.
+//
+// In the streaming response, a token can be split across the content of multiple chunks, and the chunks can be
+// split across the bodies received from Envoy. So, the events are read by the sseEventReader, and the content which
+// can be the beginning of a token is held back until the following content of the same choice arrives.
+type PIIDetokenizer struct {
+	vault *PIIVault
+	// events reads the events of the streaming response.
+	events sseEventReader
+	// pending is the content held back per index of the choice.
+	pending map[int64]string
+}
+
+// NewPIIDetokenizer creates a new PIIDetokenizer for the response of the request whose tokens are kept in the vault.
+func NewPIIDetokenizer(vault *PIIVault) *PIIDetokenizer {
+	return &PIIDetokenizer{vault: vault, pending: map[int64]string{}}
+}
+
+// Body returns the non-streaming JSON response body with the tokens replaced.
+func (d *PIIDetokenizer) Body(body []byte) []byte {
+	return piiTokenPattern.ReplaceAllFunc(body, func(t []byte) []byte {
+		value, ok := d.vault.values[string(t)]
+		if !ok {
+			return t
+		}
+		// The value is inserted in a JSON string, so it needs to be escaped.
+		escaped, _ := json.Marshal(value)
+		return escaped[1 : len(escaped)-1]
+	})
+}
+
+// Stream returns the events of the streaming response body with the tokens replaced. The chunk is the part of the
+// body received from Envoy, and the returned events may lag behind it until the end of the stream.
+func (d *PIIDetokenizer) Stream(chunk []byte, endOfStream bool) []byte {
+	var out []byte
+	for _, e := range d.events.read(chunk, endOfStream) {
+		out = append(out, d.event(&e)...)
+	}
+	if endOfStream {
+		out = append(out, d.flush()...)
+	}
+	return out
+}
+
+// event returns the event with the tokens in the content of the choices replaced.
+func (d *PIIDetokenizer) event(e *sseEvent) []byte {
+	if !e.hasData {
+		return e.raw
+	}
+	if string(e.data) == "[DONE]" {
+		// The content held back is sent before the end of the stream.
+		return append(d.flush(), e.raw...)
+	}
+	if !gjson.ValidBytes(e.data) {
+		return e.raw
+	}
+	data := e.data
+	modified := false
+	for k, choice := range gjson.GetBytes(data, "choices").Array() {
+		index := choice.Get("index").Int()
+		content := choice.Get("delta.content")
+		finished := choice.Get("finish_reason").Type == gjson.String
+		text := d.pending[index] + content.String()
+		hold := ""
+		if !finished {
+			if loc := piiTokenPrefixPattern.FindStringIndex(text); loc != nil && len(text)-loc[0] <= piiTokenMaxLength {
+				text, hold = text[:loc[0]], text[loc[0]:]
+			}
+		}
+		if hold == "" {
+			delete(d.pending, index)
+		} else {
+			d.pending[index] = hold
+		}
+		if !content.Exists() && text == "" {
+			continue
+		}
+		var err error
+		if data, err = sjson.SetBytes(data, fmt.Sprintf("choices.%d.delta.content", k), d.vault.Detokenize(text)); err != nil {
+			continue
+		}
+		modified = true
+	}
+	if !modified {
+		return e.raw
+	}
+	return e.withData(data)
+}
+
+// flush returns the events with the content held back, if any.
+func (d *PIIDetokenizer) flush() []byte {
+	if len(d.pending) == 0 {
+		return nil
+	}
+	indexes := make([]int64, 0, len(d.pending))
+	for index := range d.pending {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+	var b strings.Builder
+	for _, index := range indexes {
+		content, _ := json.Marshal(d.vault.Detokenize(d.pending[index]))
+		fmt.Fprintf(&b, `data: {"object":"chat.completion.chunk","choices":[{"index":%d,"delta":{"content":%s}}]}`+"\n\n", index, content)
+	}
+	d.pending = map[int64]string{}
+	return []byte(b.String())
+}
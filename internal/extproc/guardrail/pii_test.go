@@ -0,0 +1,165 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+// allBuiltinPIIDetectors returns the detectors of all the built-in types.
+func allBuiltinPIIDetectors() []filterapi.PIIDetector {
+	return []filterapi.PIIDetector{
+		{Type: filterapi.PIIDetectorTypeEmail},
+		{Type: filterapi.PIIDetectorTypePhoneNumber},
+		{Type: filterapi.PIIDetectorTypeCreditCard},
+		{Type: filterapi.PIIDetectorTypeUSSocialSecurityNumber},
+		{Type: filterapi.PIIDetectorTypeIBAN},
+	}
+}
+
+func TestPIIRedactor_Redact(t *testing.T) {
+	r, err := NewPIIRedactor(&filterapi.PIIGuardrail{Action: filterapi.PIIActionMask, Detectors: allBuiltinPIIDetectors()})
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		name, text, exp string
+		expDetections   map[string]int
+	}{
+		{name: "none", text: "hello world 12345", exp: "hello world 12345", expDetections: map[string]int{}},
+		{
+			name:          "email",
+			text:          "mail john.doe+ai@example.co.uk or jane@example.com",
+			exp:           "mail [REDACTED_EMAIL] or [REDACTED_EMAIL]",
+			expDetections: map[string]int{"EMAIL": 2},
+		},
+		{
+			name:          "phone",
+			text:          "call +1 (555) 123-4567 or 555.123.4567",
+			exp:           "call [REDACTED_PHONE_NUMBER] or [REDACTED_PHONE_NUMBER]",
+			expDetections: map[string]int{"PHONE_NUMBER": 2},
+		},
+		{
+			name:          "credit card",
+			text:          "card 4111 1111 1111 1111, not 4111 1111 1111 1112",
+			exp:           "card [REDACTED_CREDIT_CARD], not 4111 1111 1111 1112",
+			expDetections: map[string]int{"CREDIT_CARD": 1},
+		},
+		{
+			name:          "ssn",
+			text:          "ssn 123-45-6789, not 666-12-3456 nor 123-00-6789",
+			exp:           "ssn [REDACTED_US_SSN], not 666-12-3456 nor 123-00-6789",
+			expDetections: map[string]int{"US_SSN": 1},
+		},
+		{
+			name:          "iban",
+			text:          "iban GB82 WEST 1234 5698 7654 32 and DE89370400440532013000, not GB82 WEST 1234 5698 7654 33",
+			exp:           "iban [REDACTED_IBAN] and [REDACTED_IBAN], not GB82 WEST 1234 5698 7654 33",
+			expDetections: map[string]int{"IBAN": 2},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			detections := map[string]int{}
+			require.Equal(t, tc.exp, r.Redact(tc.text, nil, detections))
+			require.Equal(t, tc.expDetections, detections)
+		})
+	}
+}
+
+func TestPIIRedactor_custom(t *testing.T) {
+	r, err := NewPIIRedactor(&filterapi.PIIGuardrail{Action: filterapi.PIIActionMask, Detectors: []filterapi.PIIDetector{
+		{Type: filterapi.PIIDetectorTypeCustom, Name: "EMPLOYEE_ID", Pattern: `\bE-\d{6}\b`},
+		{Type: filterapi.PIIDetectorTypeCustom, Name: "ACCOUNT", Pattern: `\b\d{8}\b`, Validator: filterapi.PIIValidatorLuhn},
+	}})
+	require.NoError(t, err)
+	detections := map[string]int{}
+	require.Equal(t, "[REDACTED_EMPLOYEE_ID] owns [REDACTED_ACCOUNT] and 12345678",
+		r.Redact("E-123456 owns 12345674 and 12345678", nil, detections))
+	require.Equal(t, map[string]int{"EMPLOYEE_ID": 1, "ACCOUNT": 1}, detections)
+
+	_, err = NewPIIRedactor(&filterapi.PIIGuardrail{Detectors: []filterapi.PIIDetector{
+		{Type: filterapi.PIIDetectorTypeCustom, Name: "BROKEN", Pattern: `(`},
+	}})
+	require.ErrorContains(t, err, `invalid pattern of PII detector "BROKEN"`)
+	_, err = NewPIIRedactor(&filterapi.PIIGuardrail{Detectors: []filterapi.PIIDetector{{Type: "Unknown"}}})
+	require.ErrorContains(t, err, `unknown PII detector type "Unknown"`)
+}
+
+func TestPIIRedactor_overlap(t *testing.T) {
+	r, err := NewPIIRedactor(&filterapi.PIIGuardrail{Action: filterapi.PIIActionMask, Detectors: []filterapi.PIIDetector{
+		{Type: filterapi.PIIDetectorTypeCustom, Name: "DOMAIN", Pattern: `example\.com`},
+		{Type: filterapi.PIIDetectorTypeEmail},
+	}})
+	require.NoError(t, err)
+	detections := map[string]int{}
+	// The earlier match wins over the later one overlapping with it.
+	require.Equal(t, "[REDACTED_EMAIL] at [REDACTED_DOMAIN]", r.Redact("jane@example.com at example.com", nil, detections))
+	require.Equal(t, map[string]int{"EMAIL": 1, "DOMAIN": 1}, detections)
+}
+
+func TestPIIRedactor_tokenizeAndReject(t *testing.T) {
+	r, err := NewPIIRedactor(&filterapi.PIIGuardrail{Action: filterapi.PIIActionTokenize, Detectors: allBuiltinPIIDetectors()})
+	require.NoError(t, err)
+	vault := NewPIIVault()
+	detections := map[string]int{}
+	text := "jane@example.com, john@example.com and jane@example.com"
+	redacted := r.Redact(text, vault, detections)
+	require.Equal(t, "[PII_EMAIL_1], [PII_EMAIL_2] and [PII_EMAIL_1]", redacted)
+	require.Equal(t, map[string]int{"EMAIL": 3}, detections)
+	require.Equal(t, 2, vault.Len())
+	require.Equal(t, text, vault.Detokenize(redacted))
+	require.Equal(t, "[PII_EMAIL_3]", vault.Detokenize("[PII_EMAIL_3]"))
+
+	r, err = NewPIIRedactor(&filterapi.PIIGuardrail{Action: filterapi.PIIActionReject, Detectors: allBuiltinPIIDetectors()})
+	require.NoError(t, err)
+	detections = map[string]int{}
+	require.Equal(t, text, r.Redact(text, nil, detections))
+	require.Equal(t, map[string]int{"EMAIL": 3}, detections)
+}
+
+func TestPIIDetokenizer_Body(t *testing.T) {
+	vault := NewPIIVault()
+	vault.token("CUSTOM", `a"b`)
+	d := NewPIIDetokenizer(vault)
+	require.JSONEq(t, `{"choices":[{"message":{"content":"quote a\"b and [PII_CUSTOM_2]"}}]}`,
+		string(d.Body([]byte(`{"choices":[{"message":{"content":"quote [PII_CUSTOM_1] and [PII_CUSTOM_2]"}}]}`))))
+}
+
+func TestPIIDetokenizer_Stream(t *testing.T) {
+	vault := NewPIIVault()
+	vault.token("EMAIL", "jane@example.com")
+	d := NewPIIDetokenizer(vault)
+
+	chunk := func(content string) string {
+		return `data: {"choices":[{"index":0,"delta":{"content":"` + content + `"}}]}` + "\n\n"
+	}
+	var out []byte
+	// The token is split across the contents, and the events are split across the bodies.
+	body := chunk("Mail [P") + chunk("II_EMA") + chunk("IL_1] or [x]")
+	out = append(out, d.Stream([]byte(body[:10]), false)...)
+	out = append(out, d.Stream([]byte(body[10:]), false)...)
+	out = append(out, d.Stream([]byte(`data: {"choices":[{"index":0,"delta":{"content":" ["},"finish_reason":null}]}`+"\n\n"), false)...)
+	out = append(out, d.Stream([]byte("data: [DONE]\n\n"), true)...)
+	require.Equal(t, chunk("Mail ")+chunk("")+chunk("jane@example.com or [x]")+
+		`data: {"choices":[{"index":0,"delta":{"content":" "},"finish_reason":null}]}`+"\n\n"+
+		`data: {"object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"["}}]}`+"\n\n"+
+		"data: [DONE]\n\n", string(out))
+
+	// The held back content is sent with the finish reason.
+	d = NewPIIDetokenizer(vault)
+	out = d.Stream([]byte(chunk("[PII")+`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n"), true)
+	require.Equal(t, chunk("")+`data: {"choices":[{"index":0,"delta":{"content":"[PII"},"finish_reason":"stop"}]}`+"\n\n", string(out))
+
+	// The events terminated by "\r\n\r\n" are detokenized, even when the terminator is split across the bodies.
+	d = NewPIIDetokenizer(vault)
+	body = strings.ReplaceAll(chunk("Mail [PII_EMA")+chunk("IL_1]"), "\n", "\r\n")
+	out = d.Stream([]byte(body[:len(body)-1]), false)
+	out = append(out, d.Stream([]byte(body[len(body)-1:]), true)...)
+	require.Equal(t, chunk("Mail ")+chunk("jane@example.com"), string(out))
+}
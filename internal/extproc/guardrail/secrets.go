@@ -0,0 +1,220 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+// genericSecretMinEntropy is the minimum entropy of the values of the secret-like variables, which excludes the
+// placeholders such as "your-api-key-here" and the ordinary words.
+const genericSecretMinEntropy = 3.5
+
+// secretDetector detects the secrets matching the pattern. If the pattern has a capturing group, the secret is the
+// text of the first group, and the rest of the match is its context.
+type secretDetector struct {
+	// name is the name used in the placeholders and the metrics.
+	name    string
+	pattern *regexp.Regexp
+	// minEntropy is the minimum Shannon entropy of the secret in bits per character. Zero means not checked.
+	minEntropy float64
+}
+
+// builtinSecretDetectorTypes is the order of the built-in detectors used when no detector is specified. The specific
+// ones come before the generic one, so that the secret detected by both is reported by the specific one.
+var builtinSecretDetectorTypes = []filterapi.SecretDetectorType{
+	filterapi.SecretDetectorTypeAWSAccessKeyID,
+	filterapi.SecretDetectorTypeAWSSecretAccessKey,
+	filterapi.SecretDetectorTypeGitHubToken,
+	filterapi.SecretDetectorTypeGitLabToken,
+	filterapi.SecretDetectorTypeSlackToken,
+	filterapi.SecretDetectorTypeGoogleAPIKey,
+	filterapi.SecretDetectorTypeStripeAPIKey,
+	filterapi.SecretDetectorTypeAnthropicAPIKey,
+	filterapi.SecretDetectorTypeOpenAIAPIKey,
+	filterapi.SecretDetectorTypePrivateKey,
+	filterapi.SecretDetectorTypeJWT,
+	filterapi.SecretDetectorTypeGenericSecret,
+}
+
+// builtinSecretDetectors are the detectors of the built-in types.
+var builtinSecretDetectors = map[filterapi.SecretDetectorType]secretDetector{
+	filterapi.SecretDetectorTypeAWSAccessKeyID: {
+		name:    "AWS_ACCESS_KEY_ID",
+		pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|APKA|AROA)[0-9A-Z]{16}\b`),
+	},
+	filterapi.SecretDetectorTypeAWSSecretAccessKey: {
+		name:       "AWS_SECRET_ACCESS_KEY",
+		pattern:    regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})(?:[^A-Za-z0-9/+=]|$)`),
+		minEntropy: genericSecretMinEntropy,
+	},
+	filterapi.SecretDetectorTypeGitHubToken: {
+		name:    "GITHUB_TOKEN",
+		pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`),
+	},
+	filterapi.SecretDetectorTypeGitLabToken: {
+		name:    "GITLAB_TOKEN",
+		pattern: regexp.MustCompile(`\bglpat-[A-Za-z0-9_\-]{20,}`),
+	},
+	filterapi.SecretDetectorTypeSlackToken: {
+		name:    "SLACK_TOKEN",
+		pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9\-]{10,}`),
+	},
+	filterapi.SecretDetectorTypeGoogleAPIKey: {
+		name:    "GOOGLE_API_KEY",
+		pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`),
+	},
+	filterapi.SecretDetectorTypeStripeAPIKey: {
+		name:    "STRIPE_API_KEY",
+		pattern: regexp.MustCompile(`\b(?:sk|rk)_live_[0-9A-Za-z]{24,}\b`),
+	},
+	filterapi.SecretDetectorTypeAnthropicAPIKey: {
+		name:    "ANTHROPIC_API_KEY",
+		pattern: regexp.MustCompile(`\bsk-ant-(?:api|admin)\d{2}-[A-Za-z0-9_\-]{80,}`),
+	},
+	filterapi.SecretDetectorTypeOpenAIAPIKey: {
+		name:       "OPENAI_API_KEY",
+		pattern:    regexp.MustCompile(`\bsk-(?:proj-|svcacct-|admin-)?[A-Za-z0-9_\-]{32,}`),
+		minEntropy: genericSecretMinEntropy,
+	},
+	filterapi.SecretDetectorTypePrivateKey: {
+		name:    "PRIVATE_KEY",
+		pattern: regexp.MustCompile(`-----BEGIN[A-Z ]*PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END[A-Z ]*PRIVATE KEY(?: BLOCK)?-----`),
+	},
+	filterapi.SecretDetectorTypeJWT: {
+		name:    "JWT",
+		pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`),
+	},
+	filterapi.SecretDetectorTypeGenericSecret: {
+		name: "GENERIC_SECRET",
+		pattern: regexp.MustCompile(`(?i)\b[A-Za-z0-9_.\-]*(?:password|passwd|pwd|secret|token|api_?key|access_?key|private_?key|client_?secret|credentials?)` +
+			`[A-Za-z0-9_.\-]*["']?\s*[:=]\s*["']?([^\s"'\x60,;\[\]<>(){}]{12,})`),
+		minEntropy: genericSecretMinEntropy,
+	},
+}
+
+// SecretScanner detects the secrets in the text and handles them according to the action of the SecretGuardrail.
+type SecretScanner struct {
+	action    filterapi.SecretAction
+	detectors []secretDetector
+}
+
+// NewSecretScanner creates a new SecretScanner for the guardrail. This returns an error if any custom pattern is
+// invalid.
+func NewSecretScanner(g *filterapi.SecretGuardrail) (*SecretScanner, error) {
+	s := &SecretScanner{action: g.Action}
+	detectors := g.Detectors
+	if len(detectors) == 0 {
+		for _, t := range builtinSecretDetectorTypes {
+			detectors = append(detectors, filterapi.SecretDetector{Type: t})
+		}
+	}
+	for _, d := range detectors {
+		if d.Type != filterapi.SecretDetectorTypeCustom {
+			builtin, ok := builtinSecretDetectors[d.Type]
+			if !ok {
+				return nil, fmt.Errorf("unknown secret detector type %q", d.Type)
+			}
+			s.detectors = append(s.detectors, builtin)
+			continue
+		}
+		pattern, err := regexp.Compile(d.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of secret detector %q: %w", d.Name, err)
+		}
+		s.detectors = append(s.detectors, secretDetector{name: d.Name, pattern: pattern, minEntropy: d.MinEntropy})
+	}
+	return s, nil
+}
+
+// Action returns the action of the guardrail.
+func (s *SecretScanner) Action() filterapi.SecretAction {
+	return s.action
+}
+
+// Scan returns the text with the detected secrets replaced with the placeholders when the action is Redact, and adds
+// the number of the detected secrets per detector to the detections. The text is returned as is for the other
+// actions.
+func (s *SecretScanner) Scan(text string, detections map[string]int) string {
+	return s.scan("", text, detections)
+}
+
+// scan is the same as Scan, except that the preceding text already scanned is prepended as the context of the
+// patterns, e.g. the name of the variable. Only the secrets starting in the text are detected, and only the text is
+// returned.
+func (s *SecretScanner) scan(preceding, text string, detections map[string]int) string {
+	full := preceding + text
+	var matches []piiMatch
+	for _, d := range s.detectors {
+		for _, loc := range d.pattern.FindAllStringSubmatchIndex(full, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if start < len(preceding) {
+				continue
+			}
+			if d.minEntropy > 0 && shannonEntropy(full[start:end]) < d.minEntropy {
+				continue
+			}
+			matches = append(matches, piiMatch{start: start - len(preceding), end: end - len(preceding), name: d.name})
+		}
+	}
+	if len(matches) == 0 {
+		return text
+	}
+	// The earliest and then the longest match wins when the matches of the detectors overlap, and the former
+	// detector wins the tie.
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m.start < last {
+			continue
+		}
+		detections[m.name]++
+		b.WriteString(text[last:m.start])
+		if s.action == filterapi.SecretActionRedact {
+			b.WriteString("[REDACTED_" + m.name + "]")
+		} else {
+			b.WriteString(text[m.start:m.end])
+		}
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// shannonEntropy returns the Shannon entropy of the bytes of the string in bits per character.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var entropy float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
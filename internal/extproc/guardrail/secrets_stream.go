@@ -0,0 +1,199 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+const (
+	// secretMaxLength is the maximum length of the trailing word held back as the beginning of a secret. Only the
+	// last part of this length is held back from the longer word.
+	secretMaxLength = 512
+	// privateKeyMaxLength is the maximum length of the private key held back from its beginning line until its end
+	// line arrives.
+	privateKeyMaxLength = 16 << 10
+	// secretContextLength is the length of the content already sent which is kept as the context of the patterns,
+	// e.g. the name of the variable preceding the secret.
+	secretContextLength = 64
+)
+
+var (
+	// privateKeyHeaderPattern matches the beginning line of a private key.
+	privateKeyHeaderPattern = regexp.MustCompile(`^-----BEGIN[A-Z ]*-----`)
+	// privateKeyEndPattern matches the end line of a private key.
+	privateKeyEndPattern = regexp.MustCompile(`-----END[A-Z ]*PRIVATE KEY(?: BLOCK)?-----`)
+)
+
+// SecretStreamScanner detects the secrets in the content of the streaming OpenAI chat completion response with the
+// SecretScanner.
+//
+// A secret can be split across the content of multiple chunks, and the chunks can be split across the bodies
+// received from Envoy. So, the events are read by the sseEventReader, and the trailing word of the content, or the
+// private key whose end line has not arrived yet, is held back until the following content of the same choice arrives.
+type SecretStreamScanner struct {
+	scanner *SecretScanner
+	// events reads the events of the streaming response.
+	events sseEventReader
+	// pending is the content held back per index of the choice.
+	pending map[int64]string
+	// preceding is the last part of the content already scanned per index of the choice.
+	preceding map[int64]string
+	// blocked is true once a secret is detected with the Block action, after which the rest of the stream is discarded.
+	blocked bool
+}
+
+// NewSecretStreamScanner creates a new SecretStreamScanner for the streaming response.
+func NewSecretStreamScanner(scanner *SecretScanner) *SecretStreamScanner {
+	return &SecretStreamScanner{scanner: scanner, pending: map[int64]string{}, preceding: map[int64]string{}}
+}
+
+// Stream returns the events of the streaming response body with the secrets handled according to the action, and
+// adds the number of the detected secrets per detector to the detections. The chunk is the part of the body received
+// from Envoy, and the returned events may lag behind it until the end of the stream.
+//
+// When a secret is detected with the Block action, this returns true as blocked without the content containing it.
+// Then, the stream must be terminated after the returned events, and the rest of the stream is discarded.
+func (s *SecretStreamScanner) Stream(chunk []byte, endOfStream bool, detections map[string]int) (out []byte, blocked bool) {
+	if s.blocked {
+		return nil, true
+	}
+	for _, e := range s.events.read(chunk, endOfStream) {
+		if out, blocked = s.event(out, &e, detections); blocked {
+			return out, true
+		}
+	}
+	if endOfStream {
+		out, blocked = s.flush(out, detections)
+	}
+	return out, blocked
+}
+
+// event appends the event to out with the secrets in the content of the choices handled.
+func (s *SecretStreamScanner) event(out []byte, e *sseEvent, detections map[string]int) ([]byte, bool) {
+	if !e.hasData {
+		return append(out, e.raw...), false
+	}
+	if string(e.data) == "[DONE]" {
+		// The content held back is sent before the end of the stream.
+		var blocked bool
+		if out, blocked = s.flush(out, detections); blocked {
+			return out, true
+		}
+		return append(out, e.raw...), false
+	}
+	data := e.data
+	if !gjson.ValidBytes(data) {
+		return append(out, e.raw...), false
+	}
+	modified := false
+	for k, choice := range gjson.GetBytes(data, "choices").Array() {
+		index := choice.Get("index").Int()
+		content := choice.Get("delta.content")
+		text := s.pending[index] + content.String()
+		hold := ""
+		if choice.Get("finish_reason").Type != gjson.String {
+			i := secretHoldback(text)
+			text, hold = text[:i], text[i:]
+		}
+		if hold == "" {
+			delete(s.pending, index)
+		} else {
+			s.pending[index] = hold
+		}
+		if !content.Exists() && text == "" {
+			continue
+		}
+		scanned, blocked := s.scan(index, text, detections)
+		if blocked {
+			return out, true
+		}
+		var err error
+		if data, err = sjson.SetBytes(data, fmt.Sprintf("choices.%d.delta.content", k), scanned); err != nil {
+			continue
+		}
+		modified = true
+	}
+	if !modified {
+		return append(out, e.raw...), false
+	}
+	return append(out, e.withData(data)...), false
+}
+
+// scan scans the content of the choice following the content already scanned. This returns true as blocked if any
+// secret is detected with the Block action.
+func (s *SecretStreamScanner) scan(index int64, text string, detections map[string]int) (string, bool) {
+	if text == "" {
+		return text, false
+	}
+	found := make(map[string]int)
+	scanned := s.scanner.scan(s.preceding[index], text, found)
+	for name, count := range found {
+		detections[name] += count
+	}
+	if len(found) > 0 && s.scanner.action == filterapi.SecretActionBlock {
+		s.blocked = true
+		return "", true
+	}
+	preceding := s.preceding[index] + text
+	if len(preceding) > secretContextLength {
+		preceding = preceding[len(preceding)-secretContextLength:]
+	}
+	s.preceding[index] = preceding
+	return scanned, false
+}
+
+// flush appends the events with the content held back, if any, to out.
+func (s *SecretStreamScanner) flush(out []byte, detections map[string]int) ([]byte, bool) {
+	indexes := make([]int64, 0, len(s.pending))
+	for index := range s.pending {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+	for _, index := range indexes {
+		scanned, blocked := s.scan(index, s.pending[index], detections)
+		if blocked {
+			return out, true
+		}
+		content, _ := json.Marshal(scanned)
+		out = fmt.Appendf(out, `data: {"object":"chat.completion.chunk","choices":[{"index":%d,"delta":{"content":%s}}]}`+"\n\n", index, content)
+	}
+	s.pending = map[int64]string{}
+	return out, false
+}
+
+// secretHoldback returns the index of the trailing part of the content which can be the beginning of a secret.
+func secretHoldback(text string) int {
+	if i := strings.LastIndex(text, "-----BEGIN"); i >= 0 && len(text)-i <= privateKeyMaxLength {
+		key := text[i:]
+		header := privateKeyHeaderPattern.FindString(key)
+		if (header == "" || strings.Contains(header, "PRIVATE KEY")) && !privateKeyEndPattern.MatchString(key) {
+			return i
+		}
+	}
+	i := strings.LastIndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		i = 0
+	} else {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	if len(text)-i > secretMaxLength {
+		i = len(text) - secretMaxLength
+	}
+	return i
+}
@@ -0,0 +1,88 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"bytes"
+)
+
+// sseEventReader splits the streaming response body received from Envoy in parts into the server-sent events.
+//
+// The events are terminated by a blank line, and the lines can be terminated by either "\n" or "\r\n". An event can
+// be split across the bodies received from Envoy, so the incomplete event is buffered until its blank line arrives.
+type sseEventReader struct {
+	// buf is the incomplete event of the stream.
+	buf []byte
+}
+
+// sseEvent is a server-sent event of the stream.
+type sseEvent struct {
+	// raw is the event as received, including the blank line terminating it. This is absent from the last event of
+	// the stream which ends without one.
+	raw []byte
+	// data is the value of the data fields of the event joined by "\n", and hasData is false if it has none.
+	data    []byte
+	hasData bool
+}
+
+// read returns the events completed by the chunk. At the end of the stream, the rest of the buffer is returned as
+// the last event even without the blank line.
+func (r *sseEventReader) read(chunk []byte, endOfStream bool) []sseEvent {
+	r.buf = append(r.buf, chunk...)
+	var events []sseEvent
+	start, pos := 0, 0
+	for {
+		i := bytes.IndexByte(r.buf[pos:], '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimSuffix(r.buf[pos:pos+i], []byte("\r"))
+		pos += i + 1
+		if len(line) == 0 {
+			events = append(events, newSSEEvent(bytes.Clone(r.buf[start:pos])))
+			start = pos
+		}
+	}
+	r.buf = r.buf[start:]
+	if endOfStream && len(r.buf) > 0 {
+		events = append(events, newSSEEvent(r.buf))
+		r.buf = nil
+	}
+	return events
+}
+
+// newSSEEvent parses the data fields of the raw event.
+func newSSEEvent(raw []byte) sseEvent {
+	e := sseEvent{raw: raw}
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		value, ok := bytes.CutPrefix(bytes.TrimSuffix(line, []byte("\r")), []byte("data:"))
+		if !ok {
+			continue
+		}
+		if e.hasData {
+			e.data = append(e.data, '\n')
+		}
+		// A single space following the colon is not part of the value.
+		e.data = append(e.data, bytes.TrimPrefix(value, []byte(" "))...)
+		e.hasData = true
+	}
+	return e
+}
+
+// withData returns the event whose data is replaced with the given one. The other fields of the event are kept, and
+// the event is terminated by "\n\n".
+func (e *sseEvent) withData(data []byte) []byte {
+	var out []byte
+	for _, line := range bytes.Split(e.raw, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) == 0 || bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		out = append(append(out, line...), '\n')
+	}
+	out = append(append(out, "data: "...), data...)
+	return append(out, "\n\n"...)
+}
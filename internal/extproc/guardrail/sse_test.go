@@ -0,0 +1,45 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSEEventReader(t *testing.T) {
+	var r sseEventReader
+	raws := func(events []sseEvent) []string {
+		var ret []string
+		for _, e := range events {
+			ret = append(ret, string(e.raw))
+		}
+		return ret
+	}
+
+	// The event is buffered until its blank line arrives, whichever the line breaks are.
+	require.Empty(t, r.read([]byte("data: a\n"), false))
+	require.Equal(t, []string{"data: a\n\n"}, raws(r.read([]byte("\ndata: b\r\n\r"), false)))
+	require.Equal(t, []string{"data: b\r\n\r\n", "event: c\r\ndata: c\n\n"}, raws(r.read([]byte("\nevent: c\r\ndata: c\n\ndata: d"), false)))
+	// The rest of the buffer is the last event at the end of the stream.
+	events := r.read(nil, true)
+	require.Equal(t, []string{"data: d"}, raws(events))
+	require.Equal(t, "d", string(events[0].data))
+	require.Empty(t, r.read(nil, true))
+}
+
+func TestSSEEvent(t *testing.T) {
+	e := newSSEEvent([]byte("event: message\r\ndata: {\"a\":\r\ndata:1}\r\n\r\n"))
+	require.True(t, e.hasData)
+	require.Equal(t, "{\"a\":\n1}", string(e.data))
+	// The other fields are kept when the data is replaced.
+	require.Equal(t, "event: message\ndata: {\"a\":2}\n\n", string(e.withData([]byte(`{"a":2}`))))
+
+	e = newSSEEvent([]byte(": comment\n\n"))
+	require.False(t, e.hasData)
+	require.Empty(t, e.data)
+}
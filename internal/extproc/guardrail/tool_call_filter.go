@@ -0,0 +1,223 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ToolCallFilter checks the tool calls of the streaming OpenAI chat completion response against the [ToolPolicy].
+//
+// The arguments of a tool call are streamed as the deltas across multiple chunks, and the chunks can be split across
+// the bodies received from Envoy. So, the events are read by the sseEventReader, and the deltas of the tool calls are
+// held back until their choice finishes. Then, the tool calls allowed are sent at once in the chunk right before the one
+// with the finish reason.
+type ToolCallFilter struct {
+	policy *ToolPolicy
+	// events reads the events of the streaming response.
+	events sseEventReader
+	// pending is the tool calls being assembled per index of the choice.
+	pending map[int64][]*pendingToolCall
+	// template is the last chunk, whose id, created and model are copied to the chunks of the tool calls.
+	template []byte
+	// rejected is true once a tool call is rejected, after which the rest of the stream is discarded.
+	rejected bool
+}
+
+// pendingToolCall is the tool call assembled from the deltas.
+type pendingToolCall struct {
+	index     int64
+	id, name  string
+	arguments strings.Builder
+}
+
+// NewToolCallFilter creates a new ToolCallFilter for the streaming response.
+func NewToolCallFilter(policy *ToolPolicy) *ToolCallFilter {
+	return &ToolCallFilter{policy: policy, pending: map[int64][]*pendingToolCall{}}
+}
+
+// Stream returns the events of the streaming response body with the tool calls held back until their choices
+// finish, and the tool calls completed in the chunk. The chunk is the part of the body received from Envoy, and the
+// returned events may lag behind it until the end of the stream.
+//
+// When a tool call violates the policy and the tool calls are not stripped, this returns it as rejected. Then, the
+// stream must be terminated after the returned events, and the rest of the stream is discarded.
+func (f *ToolCallFilter) Stream(chunk []byte, endOfStream bool) (out []byte, calls []ToolCall, rejected *ToolCall) {
+	if f.rejected {
+		return nil, nil, nil
+	}
+	for _, e := range f.events.read(chunk, endOfStream) {
+		var eventCalls []ToolCall
+		out, eventCalls, rejected = f.event(out, &e)
+		if calls = append(calls, eventCalls...); rejected != nil {
+			return out, calls, rejected
+		}
+	}
+	if endOfStream {
+		var eventCalls []ToolCall
+		out, eventCalls, rejected = f.flush(out)
+		calls = append(calls, eventCalls...)
+	}
+	return out, calls, rejected
+}
+
+// event appends the event to out with the deltas of the tool calls removed, and the chunks of the tool calls of the
+// choices finished in the event before it. The event is dropped when nothing is left in it.
+func (f *ToolCallFilter) event(out []byte, e *sseEvent) ([]byte, []ToolCall, *ToolCall) {
+	if !e.hasData {
+		return append(out, e.raw...), nil, nil
+	}
+	if string(e.data) == "[DONE]" {
+		// The tool calls of the choices which did not finish are sent before the end of the stream.
+		out, calls, rejected := f.flush(out)
+		if rejected != nil {
+			return out, calls, rejected
+		}
+		return append(out, e.raw...), calls, nil
+	}
+	data := e.data
+	if !gjson.ValidBytes(data) {
+		return append(out, e.raw...), nil, nil
+	}
+	f.template = slices.Clone(data)
+	var calls []ToolCall
+	modified := false
+	for k, choice := range gjson.GetBytes(data, "choices").Array() {
+		index := choice.Get("index").Int()
+		if deltas := choice.Get("delta.tool_calls"); deltas.Exists() {
+			for _, d := range deltas.Array() {
+				f.appendDelta(index, d)
+			}
+			if b, err := sjson.DeleteBytes(data, fmt.Sprintf("choices.%d.delta.tool_calls", k)); err == nil {
+				data, modified = b, true
+			}
+		}
+		finishReason := choice.Get("finish_reason")
+		if finishReason.Type != gjson.String {
+			continue
+		}
+		var kept int
+		var choiceCalls []ToolCall
+		var rejected *ToolCall
+		out, kept, choiceCalls, rejected = f.finish(out, index)
+		if calls = append(calls, choiceCalls...); rejected != nil {
+			return out, calls, rejected
+		}
+		if len(choiceCalls) > 0 && kept == 0 && finishReason.Str == "tool_calls" {
+			// No tool is to be called since all the tool calls are stripped.
+			if b, err := sjson.SetBytes(data, fmt.Sprintf("choices.%d.finish_reason", k), "stop"); err == nil {
+				data, modified = b, true
+			}
+		}
+	}
+	if !modified {
+		return append(out, e.raw...), calls, nil
+	}
+	if emptyChunk(data) {
+		return out, calls, nil
+	}
+	return append(out, e.withData(data)...), calls, nil
+}
+
+// emptyChunk returns true if the chunk has neither the delta nor the finish reason of any choice, nor the usage.
+func emptyChunk(data []byte) bool {
+	if u := gjson.GetBytes(data, "usage"); u.Exists() && u.Type != gjson.Null {
+		return false
+	}
+	for _, choice := range gjson.GetBytes(data, "choices").Array() {
+		if d := choice.Get("delta"); d.Exists() && d.Raw != "{}" {
+			return false
+		}
+		if choice.Get("finish_reason").Type == gjson.String {
+			return false
+		}
+	}
+	return true
+}
+
+// appendDelta appends the delta of the tool call to the pending one of the choice.
+func (f *ToolCallFilter) appendDelta(choice int64, delta gjson.Result) {
+	index := delta.Get("index").Int()
+	calls := f.pending[choice]
+	i := slices.IndexFunc(calls, func(c *pendingToolCall) bool { return c.index == index })
+	if i < 0 {
+		calls = append(calls, &pendingToolCall{index: index})
+		f.pending[choice] = calls
+		i = len(calls) - 1
+	}
+	c := calls[i]
+	if id := delta.Get("id").String(); id != "" {
+		c.id = id
+	}
+	c.name += delta.Get("function.name").String()
+	c.arguments.WriteString(delta.Get("function.arguments").String())
+}
+
+// finish checks the pending tool calls of the choice, and appends the chunk of the tool calls kept to out.
+func (f *ToolCallFilter) finish(out []byte, choice int64) ([]byte, int, []ToolCall, *ToolCall) {
+	pending := f.pending[choice]
+	delete(f.pending, choice)
+	if len(pending) == 0 {
+		return out, 0, nil, nil
+	}
+	slices.SortFunc(pending, func(a, b *pendingToolCall) int { return int(a.index - b.index) })
+	calls := make([]ToolCall, 0, len(pending))
+	kept := make([]ToolCall, 0, len(pending))
+	for _, p := range pending {
+		call := ToolCall{Choice: choice, ID: p.id, Name: p.name, Arguments: p.arguments.String()}
+		f.policy.check(&call, false)
+		calls = append(calls, call)
+		if call.Violation == "" {
+			kept = append(kept, call)
+		} else if !f.policy.strip {
+			f.rejected = true
+			return out, 0, calls, &calls[len(calls)-1]
+		}
+	}
+	if len(kept) == 0 {
+		return out, 0, calls, nil
+	}
+	chunk := []byte(`{"object":"chat.completion.chunk"}`)
+	for _, key := range []string{"id", "created", "model", "system_fingerprint"} {
+		if v := gjson.GetBytes(f.template, key); v.Exists() {
+			chunk, _ = sjson.SetRawBytes(chunk, key, []byte(v.Raw))
+		}
+	}
+	chunk, _ = sjson.SetBytes(chunk, "choices.0.index", choice)
+	// The tool calls are renumbered since the ones stripped leave the gaps in the indexes.
+	for j, c := range kept {
+		chunk, _ = sjson.SetBytes(chunk, fmt.Sprintf("choices.0.delta.tool_calls.%d", j), map[string]any{
+			"index": j, "id": c.ID, "type": "function",
+			"function": map[string]string{"name": c.Name, "arguments": c.Arguments},
+		})
+	}
+	out = append(append(append(out, "data: "...), chunk...), "\n\n"...)
+	return out, len(kept), calls, nil
+}
+
+// flush appends the chunks of the tool calls of all the choices which did not finish to out.
+func (f *ToolCallFilter) flush(out []byte) ([]byte, []ToolCall, *ToolCall) {
+	choices := make([]int64, 0, len(f.pending))
+	for choice := range f.pending {
+		choices = append(choices, choice)
+	}
+	slices.Sort(choices)
+	var calls []ToolCall
+	for _, choice := range choices {
+		var choiceCalls []ToolCall
+		var rejected *ToolCall
+		out, _, choiceCalls, rejected = f.finish(out, choice)
+		if calls = append(calls, choiceCalls...); rejected != nil {
+			return out, calls, rejected
+		}
+	}
+	return out, calls, nil
+}
@@ -0,0 +1,241 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+// ToolViolation is the kind of the violation of the tool policy, which is also the code of the error returned to
+// the client.
+type ToolViolation string
+
+const (
+	// ToolViolationNotAllowed is the violation of the tool whose name is not allowed.
+	ToolViolationNotAllowed ToolViolation = "tool_not_allowed"
+	// ToolViolationInvalidArguments is the violation of the tool call whose arguments do not conform to the schemas.
+	ToolViolationInvalidArguments ToolViolation = "tool_arguments_invalid"
+)
+
+// ToolCall is the tool call or the tool definition checked by the [ToolPolicy].
+type ToolCall struct {
+	// Choice is the index of the choice of the response which has the tool call.
+	Choice int64
+	// ID is the ID of the tool call. This is empty for the tool definitions.
+	ID string
+	// Name is the name of the tool.
+	Name string
+	// Arguments is the JSON-encoded arguments of the tool call. This is empty for the tool definitions.
+	Arguments string
+	// Violation is the violation of the policy, or empty if the tool call is allowed.
+	Violation ToolViolation
+	// Reason is the human-readable reason of the violation.
+	Reason string
+}
+
+// ToolPolicy checks the tools of the OpenAI chat completion requests and the tool calls of their responses against
+// the allowed and the denied tools, and the schemas of the arguments.
+type ToolPolicy struct {
+	allowed, denied []string
+	schemas         []toolArgumentsSchema
+	strip           bool
+}
+
+// toolArgumentsSchema is the compiled schema of the arguments of the tools matching the pattern.
+type toolArgumentsSchema struct {
+	tool   string
+	schema *jsonschema.Schema
+}
+
+// NewToolPolicy compiles the tool policy.
+func NewToolPolicy(p *filterapi.ToolPolicy) (*ToolPolicy, error) {
+	ret := &ToolPolicy{allowed: p.AllowedTools, denied: p.DeniedTools, strip: p.StripResponseToolCalls}
+	for _, pattern := range slices.Concat(p.AllowedTools, p.DeniedTools) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid tool pattern %q: %w", pattern, err)
+		}
+	}
+	for i := range p.Arguments {
+		a := &p.Arguments[i]
+		if _, err := path.Match(a.Tool, ""); err != nil {
+			return nil, fmt.Errorf("invalid tool pattern %q: %w", a.Tool, err)
+		}
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(a.Schema))
+		if err != nil {
+			return nil, fmt.Errorf("invalid arguments schema of tool %s: %w", a.Tool, err)
+		}
+		// The compiler has no loader, so the schema cannot refer to the files or the URLs.
+		c := jsonschema.NewCompiler()
+		c.DefaultDraft(jsonschema.Draft2020)
+		url := fmt.Sprintf("arguments-%d.json", i)
+		if err = c.AddResource(url, doc); err != nil {
+			return nil, fmt.Errorf("invalid arguments schema of tool %s: %w", a.Tool, err)
+		}
+		schema, err := c.Compile(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid arguments schema of tool %s: %w", a.Tool, err)
+		}
+		ret.schemas = append(ret.schemas, toolArgumentsSchema{tool: a.Tool, schema: schema})
+	}
+	return ret, nil
+}
+
+// Strip returns true if the tool calls of the responses violating the policy are removed instead of failing the
+// responses.
+func (p *ToolPolicy) Strip() bool {
+	return p.strip
+}
+
+// allowedTool returns true if the tool of the name is allowed.
+func (p *ToolPolicy) allowedTool(name string) bool {
+	match := func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	if slices.ContainsFunc(p.denied, match) {
+		return false
+	}
+	return len(p.allowed) == 0 || slices.ContainsFunc(p.allowed, match)
+}
+
+// check sets the violation of the tool call, if any. The arguments are not checked for the tool definitions.
+func (p *ToolPolicy) check(call *ToolCall, definition bool) {
+	if !p.allowedTool(call.Name) {
+		call.Violation, call.Reason = ToolViolationNotAllowed, fmt.Sprintf("The tool %s is not allowed.", call.Name)
+		return
+	}
+	if definition {
+		return
+	}
+	var args any
+	for i := range p.schemas {
+		s := &p.schemas[i]
+		if ok, _ := path.Match(s.tool, call.Name); !ok {
+			continue
+		}
+		if args == nil {
+			var err error
+			if args, err = jsonschema.UnmarshalJSON(strings.NewReader(call.Arguments)); err != nil {
+				call.Violation = ToolViolationInvalidArguments
+				call.Reason = fmt.Sprintf("The arguments of the tool %s are not valid JSON.", call.Name)
+				return
+			}
+		}
+		if err := s.schema.Validate(args); err != nil {
+			call.Violation = ToolViolationInvalidArguments
+			call.Reason = fmt.Sprintf("The arguments of the tool %s are invalid: %s", call.Name, validationErrorReason(err))
+			return
+		}
+	}
+}
+
+// validationErrorReason returns the causes of the schema validation error in a line.
+func validationErrorReason(err error) string {
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err.Error()
+	}
+	// The first line only tells the schema which failed, and each of the following lines is a cause.
+	lines := strings.Split(ve.Error(), "\n")
+	causes := make([]string, 0, len(lines))
+	for _, line := range lines[1:] {
+		if line = strings.TrimLeft(strings.TrimSpace(line), "- "); line != "" {
+			causes = append(causes, line)
+		}
+	}
+	if len(causes) == 0 {
+		return lines[0]
+	}
+	return strings.Join(causes, "; ")
+}
+
+// CheckRequest returns the first violation of the chat completion request and the parameter which has it, if any.
+// Both the tools defined in the request and the tool calls in the messages of the assistant are checked.
+func (p *ToolPolicy) CheckRequest(body []byte) (violation *ToolCall, param string) {
+	for _, tool := range gjson.GetBytes(body, "tools").Array() {
+		call := &ToolCall{Name: tool.Get("function.name").String()}
+		if p.check(call, true); call.Violation != "" {
+			return call, "tools"
+		}
+	}
+	for _, msg := range gjson.GetBytes(body, "messages").Array() {
+		for _, tc := range msg.Get("tool_calls").Array() {
+			call := &ToolCall{ID: tc.Get("id").String(), Name: tc.Get("function.name").String(), Arguments: tc.Get("function.arguments").String()}
+			if p.check(call, false); call.Violation != "" {
+				return call, "messages"
+			}
+		}
+	}
+	return nil, ""
+}
+
+// CheckResponse checks the tool calls of the non-streaming chat completion response, and returns them.
+//
+// When the tool calls violating the policy are stripped, this also returns the response without them, which is
+// nil if none is stripped. Otherwise, the response must be failed if any of the tool calls has the violation.
+func (p *ToolPolicy) CheckResponse(body []byte) (stripped []byte, calls []ToolCall) {
+	stripped = body
+	modified := false
+	for k, choice := range gjson.GetBytes(body, "choices").Array() {
+		toolCalls := choice.Get("message.tool_calls")
+		if !toolCalls.IsArray() {
+			continue
+		}
+		index := choice.Get("index").Int()
+		var kept []string
+		for _, tc := range toolCalls.Array() {
+			call := ToolCall{
+				Choice: index, ID: tc.Get("id").String(),
+				Name: tc.Get("function.name").String(), Arguments: tc.Get("function.arguments").String(),
+			}
+			p.check(&call, false)
+			calls = append(calls, call)
+			if call.Violation == "" || !p.strip {
+				kept = append(kept, tc.Raw)
+			}
+		}
+		if len(kept) == len(toolCalls.Array()) {
+			continue
+		}
+		modified = true
+		stripped = stripToolCalls(stripped, fmt.Sprintf("choices.%d", k), "message.tool_calls", kept, choice.Get("finish_reason").String())
+	}
+	if !modified {
+		return nil, calls
+	}
+	return stripped, calls
+}
+
+// stripToolCalls replaces the tool calls of the choice at the path with the kept ones. When none is kept, the tool
+// calls are removed, and the finish reason of the tool calls is replaced with "stop" since no tool is to be called.
+func stripToolCalls(body []byte, choicePath, toolCallsPath string, kept []string, finishReason string) []byte {
+	if len(kept) > 0 {
+		if b, err := sjson.SetRawBytes(body, choicePath+"."+toolCallsPath, []byte("["+strings.Join(kept, ",")+"]")); err == nil {
+			body = b
+		}
+		return body
+	}
+	if b, err := sjson.DeleteBytes(body, choicePath+"."+toolCallsPath); err == nil {
+		body = b
+	}
+	if finishReason == "tool_calls" {
+		if b, err := sjson.SetBytes(body, choicePath+".finish_reason", "stop"); err == nil {
+			body = b
+		}
+	}
+	return body
+}
@@ -0,0 +1,277 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package guardrail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+// newTestToolPolicy returns the policy allowing the tools starting with "search_" or "read_" except "search_internal",
+// where the path of "read_file" must be under "/tmp/".
+func newTestToolPolicy(t *testing.T, strip bool) *ToolPolicy {
+	p, err := NewToolPolicy(&filterapi.ToolPolicy{
+		AllowedTools: []string{"search_*", "read_*"},
+		DeniedTools:  []string{"search_internal"},
+		Arguments: []filterapi.ToolArgumentsSchema{{
+			Tool:   "read_file",
+			Schema: []byte(`{"type":"object","properties":{"path":{"type":"string","pattern":"^/tmp/"}},"required":["path"]}`),
+		}},
+		StripResponseToolCalls: strip,
+	})
+	require.NoError(t, err)
+	return p
+}
+
+func TestNewToolPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy filterapi.ToolPolicy
+		expErr string
+	}{
+		{name: "invalid pattern", policy: filterapi.ToolPolicy{DeniedTools: []string{"["}}, expErr: `invalid tool pattern "["`},
+		{
+			name:   "invalid schema JSON",
+			policy: filterapi.ToolPolicy{Arguments: []filterapi.ToolArgumentsSchema{{Tool: "a", Schema: []byte(`{`)}}},
+			expErr: "invalid arguments schema of tool a",
+		},
+		{
+			name:   "invalid schema",
+			policy: filterapi.ToolPolicy{Arguments: []filterapi.ToolArgumentsSchema{{Tool: "a", Schema: []byte(`{"type":1}`)}}},
+			expErr: "invalid arguments schema of tool a",
+		},
+		{
+			name: "external reference",
+			policy: filterapi.ToolPolicy{Arguments: []filterapi.ToolArgumentsSchema{
+				{Tool: "a", Schema: []byte(`{"$ref":"file:///etc/schema.json"}`)},
+			}},
+			expErr: "invalid arguments schema of tool a",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewToolPolicy(&tc.policy)
+			require.ErrorContains(t, err, tc.expErr)
+		})
+	}
+}
+
+func TestToolPolicy_CheckRequest(t *testing.T) {
+	p := newTestToolPolicy(t, false)
+	for _, tc := range []struct {
+		name, body   string
+		expViolation ToolViolation
+		expParam     string
+		expName      string
+	}{
+		{
+			name: "allowed",
+			body: `{"tools":[{"type":"function","function":{"name":"search_web"}}],"messages":[
+  {"role":"assistant","tool_calls":[{"id":"1","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"/tmp/a\"}"}}]}
+]}`,
+		},
+		{
+			name:         "denied tool",
+			body:         `{"tools":[{"type":"function","function":{"name":"search_web"}},{"type":"function","function":{"name":"search_internal"}}]}`,
+			expViolation: ToolViolationNotAllowed, expParam: "tools", expName: "search_internal",
+		},
+		{
+			name:         "tool not allowed",
+			body:         `{"tools":[{"type":"function","function":{"name":"delete_file"}}]}`,
+			expViolation: ToolViolationNotAllowed, expParam: "tools", expName: "delete_file",
+		},
+		{
+			name: "tool call not allowed",
+			body: `{"messages":[
+  {"role":"assistant","tool_calls":[{"id":"1","type":"function","function":{"name":"delete_file","arguments":"{}"}}]}
+]}`,
+			expViolation: ToolViolationNotAllowed, expParam: "messages", expName: "delete_file",
+		},
+		{
+			name: "invalid arguments",
+			body: `{"messages":[
+  {"role":"assistant","tool_calls":[{"id":"1","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"/etc/passwd\"}"}}]}
+]}`,
+			expViolation: ToolViolationInvalidArguments, expParam: "messages", expName: "read_file",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			call, param := p.CheckRequest([]byte(tc.body))
+			if tc.expViolation == "" {
+				require.Nil(t, call)
+				return
+			}
+			require.NotNil(t, call)
+			require.Equal(t, tc.expViolation, call.Violation)
+			require.Equal(t, tc.expParam, param)
+			require.Equal(t, tc.expName, call.Name)
+		})
+	}
+}
+
+func TestToolPolicy_check(t *testing.T) {
+	p := newTestToolPolicy(t, false)
+	for _, tc := range []struct {
+		name, args, expReason string
+	}{
+		{name: "read_file", args: `{"path":"/tmp/a"}`},
+		{name: "read_dir", args: `not json`},
+		{name: "read_file", args: `not json`, expReason: "The arguments of the tool read_file are not valid JSON."},
+		{name: "read_file", args: `{}`, expReason: "The arguments of the tool read_file are invalid: at '': missing property 'path'"},
+		{name: "read_file", args: `{"path":"/etc/passwd"}`, expReason: "The arguments of the tool read_file are invalid: at '/path': "},
+		{name: "write_file", args: `{}`, expReason: "The tool write_file is not allowed."},
+	} {
+		call := &ToolCall{Name: tc.name, Arguments: tc.args}
+		p.check(call, false)
+		if tc.expReason == "" {
+			require.Empty(t, call.Violation, tc.args)
+		} else {
+			require.True(t, strings.HasPrefix(call.Reason, tc.expReason), call.Reason)
+		}
+	}
+}
+
+func TestToolPolicy_CheckResponse(t *testing.T) {
+	const body = `{"choices":[
+  {"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","tool_calls":[
+    {"id":"1","type":"function","function":{"name":"search_web","arguments":"{}"}},
+    {"id":"2","type":"function","function":{"name":"delete_file","arguments":"{}"}}
+  ]}},
+  {"index":1,"finish_reason":"tool_calls","message":{"role":"assistant","tool_calls":[
+    {"id":"3","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"/etc\"}"}}
+  ]}},
+  {"index":2,"finish_reason":"stop","message":{"role":"assistant","content":"hi"}}
+]}`
+	t.Run("strip", func(t *testing.T) {
+		stripped, calls := newTestToolPolicy(t, true).CheckResponse([]byte(body))
+		require.Len(t, calls, 3)
+		require.Empty(t, calls[0].Violation)
+		require.Equal(t, ToolViolationNotAllowed, calls[1].Violation)
+		require.Equal(t, int64(1), calls[2].Choice)
+		require.Equal(t, ToolViolationInvalidArguments, calls[2].Violation)
+		require.JSONEq(t, `{"choices":[
+  {"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","tool_calls":[
+    {"id":"1","type":"function","function":{"name":"search_web","arguments":"{}"}}
+  ]}},
+  {"index":1,"finish_reason":"stop","message":{"role":"assistant"}},
+  {"index":2,"finish_reason":"stop","message":{"role":"assistant","content":"hi"}}
+]}`, string(stripped))
+	})
+	t.Run("reject", func(t *testing.T) {
+		stripped, calls := newTestToolPolicy(t, false).CheckResponse([]byte(body))
+		require.Nil(t, stripped)
+		require.Len(t, calls, 3)
+		require.Equal(t, ToolViolationNotAllowed, calls[1].Violation)
+	})
+	t.Run("allowed", func(t *testing.T) {
+		stripped, calls := newTestToolPolicy(t, true).CheckResponse([]byte(`{"choices":[{"index":0,"message":{"content":"hi"}}]}`))
+		require.Nil(t, stripped)
+		require.Empty(t, calls)
+	})
+}
+
+// toolCallStream is the streaming response calling search_web and delete_file in the choice 0 while the choice 1
+// answers in the content.
+const toolCallStream = `data: {"id":"c","created":1,"model":"gpt","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"1","type":"function","function":{"name":"search_web","arguments":""}}]}}]}
+
+data: {"id":"c","created":1,"model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"q\":"}}]}}]}
+
+data: {"id":"c","created":1,"model":"gpt","choices":[{"index":1,"delta":{"content":"hello"}}]}
+
+data: {"id":"c","created":1,"model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"x\"}"}}]}}]}
+
+data: {"id":"c","created":1,"model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"2","type":"function","function":{"name":"delete_file","arguments":"{}"}}]}}]}
+
+data: {"id":"c","created":1,"model":"gpt","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}
+
+data: {"id":"c","created":1,"model":"gpt","choices":[{"index":1,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+
+// streamToolCallFilter streams the body to the filter in the chunks of the size.
+func streamToolCallFilter(f *ToolCallFilter, body string, size int) (out string, calls []ToolCall, rejected *ToolCall) {
+	for i := 0; i < len(body); i += size {
+		end := min(i+size, len(body))
+		o, c, r := f.Stream([]byte(body[i:end]), end == len(body))
+		out += string(o)
+		calls = append(calls, c...)
+		if r != nil {
+			rejected = r
+		}
+	}
+	return
+}
+
+func TestToolCallFilter(t *testing.T) {
+	t.Run("strip", func(t *testing.T) {
+		for _, size := range []int{1, 7, len(toolCallStream)} {
+			out, calls, rejected := streamToolCallFilter(NewToolCallFilter(newTestToolPolicy(t, true)), toolCallStream, size)
+			require.Nil(t, rejected)
+			require.Equal(t, []ToolCall{
+				{Choice: 0, ID: "1", Name: "search_web", Arguments: `{"q":"x"}`},
+				{Choice: 0, ID: "2", Name: "delete_file", Arguments: `{}`, Violation: ToolViolationNotAllowed, Reason: "The tool delete_file is not allowed."},
+			}, calls)
+			require.Equal(t, `data: {"id":"c","created":1,"model":"gpt","choices":[{"index":0,"delta":{"role":"assistant"}}]}
+
+data: {"id":"c","created":1,"model":"gpt","choices":[{"index":1,"delta":{"content":"hello"}}]}
+
+data: {"object":"chat.completion.chunk","id":"c","created":1,"model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"function":{"arguments":"{\"q\":\"x\"}","name":"search_web"},"id":"1","index":0,"type":"function"}]}}]}
+
+data: {"id":"c","created":1,"model":"gpt","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}
+
+data: {"id":"c","created":1,"model":"gpt","choices":[{"index":1,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`, out)
+		}
+	})
+	t.Run("crlf", func(t *testing.T) {
+		body := strings.ReplaceAll(toolCallStream, "\n", "\r\n")
+		for _, size := range []int{1, 7, len(body)} {
+			out, calls, rejected := streamToolCallFilter(NewToolCallFilter(newTestToolPolicy(t, true)), body, size)
+			require.Nil(t, rejected)
+			require.Len(t, calls, 2)
+			require.Contains(t, out, `"name":"search_web"`)
+			require.NotContains(t, out, "delete_file")
+			require.True(t, strings.HasSuffix(out, "data: [DONE]\r\n\r\n"))
+		}
+	})
+	t.Run("strip all", func(t *testing.T) {
+		body := strings.ReplaceAll(toolCallStream, "search_web", "search_internal")
+		out, calls, rejected := streamToolCallFilter(NewToolCallFilter(newTestToolPolicy(t, true)), body, len(body))
+		require.Nil(t, rejected)
+		require.Len(t, calls, 2)
+		require.NotContains(t, out, "tool_calls")
+		require.Contains(t, out, `{"index":0,"delta":{},"finish_reason":"stop"}`)
+	})
+	t.Run("reject", func(t *testing.T) {
+		f := NewToolCallFilter(newTestToolPolicy(t, false))
+		out, calls, rejected := streamToolCallFilter(f, toolCallStream, 10)
+		require.NotNil(t, rejected)
+		require.Equal(t, "delete_file", rejected.Name)
+		require.Len(t, calls, 2)
+		// The events after the rejection are discarded.
+		require.NotContains(t, out, "finish_reason")
+		require.NotContains(t, out, "[DONE]")
+		o, c, r := f.Stream([]byte("data: [DONE]\n\n"), true)
+		require.Nil(t, o)
+		require.Nil(t, c)
+		require.Nil(t, r)
+	})
+	t.Run("unfinished", func(t *testing.T) {
+		body := toolCallStream[:strings.Index(toolCallStream, `data: {"id":"c","created":1,"model":"gpt","choices":[{"index":0,"delta":{},"finish_reason"`)]
+		out, calls, rejected := streamToolCallFilter(NewToolCallFilter(newTestToolPolicy(t, true)), body, len(body))
+		require.Nil(t, rejected)
+		require.Len(t, calls, 2)
+		require.Contains(t, out, `"name":"search_web"`)
+	})
+}
@@ -0,0 +1,502 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/guardrail"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+)
+
+const (
+	// guardrailPII is the name of the PII guardrail in the metrics.
+	guardrailPII = "pii"
+	// guardrailSecrets is the name of the secret guardrail in the metrics.
+	guardrailSecrets = "secrets"
+	// guardrailExternal is the name of the external guardrails in the metrics.
+	guardrailExternal = "external"
+)
+
+// The operations of the requests sent to the external guardrail services.
+const (
+	externalGuardrailOperationChatCompletions = "chat_completions"
+	externalGuardrailOperationEmbeddings      = "embeddings"
+)
+
+// routeGuardrails is the guardrails of a route rule compiled from the configuration.
+type routeGuardrails struct {
+	// pii is the redactor of the PII guardrail. This is nil if the guardrail is not configured.
+	pii *guardrail.PIIRedactor
+	// secrets is the scanner of the secret guardrail. This is nil if the guardrail is not configured, and
+	// secretsInRequest and secretsInResponse are true if the requests and the responses are scanned, respectively.
+	secrets                             *guardrail.SecretScanner
+	secretsInRequest, secretsInResponse bool
+	// external is the external guardrail services consulted in order.
+	external []*externalGuardrail
+}
+
+// externalGuardrail is an external guardrail service with its client.
+type externalGuardrail struct {
+	*filterapi.ExternalGuardrail
+	client guardrail.ExternalClient
+}
+
+// enabledIn returns true if the service is called in the phase.
+func (e *externalGuardrail) enabledIn(phase guardrail.ExternalPhase) bool {
+	if phase == guardrail.ExternalPhaseRequest {
+		return e.Request
+	}
+	return e.Response
+}
+
+// check returns the verdict of the service within the timeout, or an error if the service fails or the verdict
+// is invalid.
+func (e *externalGuardrail) check(ctx context.Context, req *guardrail.ExternalCheckRequest) (*guardrail.Verdict, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+	verdict, err := e.client.Check(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err = verdict.Validate(req.Phase); err != nil {
+		return nil, err
+	}
+	return verdict, nil
+}
+
+// externalGuardrailClients holds the clients of the external guardrail services across the configuration reloads,
+// so that the connections to the gRPC services are reused. The connections no longer used by the configuration
+// become idle and are released by gRPC.
+type externalGuardrailClients struct {
+	mu      sync.Mutex
+	clients map[string]guardrail.ExternalClient
+}
+
+// newExternalGuardrailClients creates a new externalGuardrailClients.
+func newExternalGuardrailClients() *externalGuardrailClients {
+	return &externalGuardrailClients{clients: make(map[string]guardrail.ExternalClient)}
+}
+
+// get returns the client of the service, creating it if it does not exist yet.
+func (c *externalGuardrailClients) get(g *filterapi.ExternalGuardrail) (guardrail.ExternalClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := string(g.Protocol) + "|" + g.Endpoint
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+	var client guardrail.ExternalClient
+	switch g.Protocol {
+	case filterapi.ExternalGuardrailProtocolHTTP:
+		client = guardrail.NewHTTPExternalClient(g.Endpoint)
+	case filterapi.ExternalGuardrailProtocolGRPC:
+		var err error
+		if client, err = guardrail.NewGRPCExternalClient(g.Endpoint); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", g.Protocol)
+	}
+	c.clients[key] = client
+	return client, nil
+}
+
+// newRouteGuardrails compiles the guardrails of the route rules. The rules without the guardrails are omitted.
+func newRouteGuardrails(rules []filterapi.RouteRule, clients *externalGuardrailClients) (map[filterapi.RouteRuleName]*routeGuardrails, error) {
+	ret := make(map[filterapi.RouteRuleName]*routeGuardrails)
+	for i := range rules {
+		g := rules[i].Guardrails
+		if g == nil {
+			continue
+		}
+		rg := &routeGuardrails{}
+		if g.PII != nil {
+			var err error
+			if rg.pii, err = guardrail.NewPIIRedactor(g.PII); err != nil {
+				return nil, fmt.Errorf("invalid PII guardrail of rule %s: %w", rules[i].Name, err)
+			}
+		}
+		if g.Secrets != nil {
+			var err error
+			if rg.secrets, err = guardrail.NewSecretScanner(g.Secrets); err != nil {
+				return nil, fmt.Errorf("invalid secret guardrail of rule %s: %w", rules[i].Name, err)
+			}
+			rg.secretsInRequest, rg.secretsInResponse = g.Secrets.Request, g.Secrets.Response
+		}
+		for j := range g.External {
+			e := &externalGuardrail{ExternalGuardrail: &g.External[j]}
+			var err error
+			if e.client, err = clients.get(e.ExternalGuardrail); err != nil {
+				return nil, fmt.Errorf("invalid external guardrail %s of rule %s: %w", e.Name, rules[i].Name, err)
+			}
+			rg.external = append(rg.external, e)
+		}
+		ret[rules[i].Name] = rg
+	}
+	return ret, nil
+}
+
+// guardrailsOf returns the guardrails of the rule of the model, or nil if the rule has no guardrail.
+func guardrailsOf(config *processorConfig, model string) *routeGuardrails {
+	rule := config.rulesByModel[model]
+	if rule == nil {
+		return nil
+	}
+	return config.guardrails[rule.Name]
+}
+
+// hasExternalGuardrails returns true if any external guardrail service of the rule of the model is called in the phase.
+func hasExternalGuardrails(config *processorConfig, model string, phase guardrail.ExternalPhase) bool {
+	g := guardrailsOf(config, model)
+	return g != nil && slices.ContainsFunc(g.external, func(e *externalGuardrail) bool { return e.enabledIn(phase) })
+}
+
+// applyExternalGuardrails consults the external guardrail services of the rule of the model in the phase in order.
+// The body is the request body in the request phase and the response body in the response phase, where the request
+// is the request body sent to the backend.
+//
+// This returns the body rewritten by the services, which is nil if no service rewrites it, and the rewritten body is
+// passed to the following services. When a service blocks the body, or fails in the fail-closed mode, this returns
+// the local reply rejecting the request instead.
+func applyExternalGuardrails(ctx context.Context, config *processorConfig, logger *slog.Logger, metrics metrics.GuardrailMetrics,
+	phase guardrail.ExternalPhase, operation, model string, request, body []byte, metricAttrs ...attribute.KeyValue,
+) (rewritten []byte, rejected *extprocv3.ProcessingResponse) {
+	g := guardrailsOf(config, model)
+	if g == nil {
+		return nil, nil
+	}
+	for _, e := range g.external {
+		if !e.enabledIn(phase) {
+			continue
+		}
+		req := &guardrail.ExternalCheckRequest{
+			Phase:     phase,
+			Guardrail: e.Name,
+			RouteRule: string(config.rulesByModel[model].Name),
+			Model:     model,
+			Operation: operation,
+			Request:   request,
+		}
+		if phase == guardrail.ExternalPhaseRequest {
+			req.Request = body
+		} else {
+			req.Response = body
+		}
+		verdict, err := e.check(ctx, req)
+		if err != nil {
+			logger.Error("external guardrail failed", slog.String("guardrail", e.Name),
+				slog.String("phase", string(phase)), slog.Bool("fail_open", e.FailOpen), slog.String("error", err.Error()))
+			if e.FailOpen {
+				continue
+			}
+			return nil, openAIErrorResponse(typev3.StatusCode_ServiceUnavailable, "guardrail_unavailable",
+				fmt.Sprintf("The guardrail %s is unavailable.", e.Name))
+		}
+		switch verdict.Action {
+		case guardrail.VerdictBlock:
+			metrics.RecordGuardrailDetections(ctx, guardrailExternal, e.Name, "Block", 1, metricAttrs...)
+			message := verdict.Message
+			if message == "" {
+				message = fmt.Sprintf("The %s was blocked by the guardrail %s.", phase, e.Name)
+			}
+			return nil, openAIErrorResponse(typev3.StatusCode_BadRequest, "guardrail_blocked", message)
+		case guardrail.VerdictRewrite:
+			metrics.RecordGuardrailDetections(ctx, guardrailExternal, e.Name, "Rewrite", 1, metricAttrs...)
+			body = verdict.Rewritten(phase)
+			if phase == guardrail.ExternalPhaseRequest {
+				// The model cannot be rewritten since the request is already routed by it.
+				if b, err := sjson.SetBytes(body, "model", model); err == nil {
+					body = b
+				}
+			}
+			rewritten = body
+		}
+	}
+	return rewritten, nil
+}
+
+// textRedactor rewrites the texts in the request body specific to the API with the function.
+type textRedactor func(raw []byte, redact func(string) string) ([]byte, error)
+
+// applyPIIGuardrail detects the PII in the raw request body with the PII guardrail of the rule of the model, and
+// records the detections in the metrics.
+//
+// This returns the redacted body, which is nil if the body is not modified, and the vault keeping the original
+// values when the values are tokenized. When the action is Reject and any PII is detected, this returns the local
+// reply rejecting the request instead.
+func applyPIIGuardrail(ctx context.Context, config *processorConfig, metrics metrics.GuardrailMetrics, model string, raw []byte,
+	redactor textRedactor, metricAttrs ...attribute.KeyValue,
+) (redacted []byte, vault *guardrail.PIIVault, rejected *extprocv3.ProcessingResponse, err error) {
+	g := guardrailsOf(config, model)
+	if g == nil || g.pii == nil {
+		return nil, nil, nil, nil
+	}
+	action := g.pii.Action()
+	if action == filterapi.PIIActionTokenize {
+		vault = guardrail.NewPIIVault()
+	}
+	detections := make(map[string]int)
+	redacted, err = redactor(raw, func(text string) string {
+		return g.pii.Redact(text, vault, detections)
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to redact PII: %w", err)
+	}
+	if len(detections) == 0 {
+		return nil, nil, nil, nil
+	}
+	detectors := make([]string, 0, len(detections))
+	for d, count := range detections {
+		detectors = append(detectors, d)
+		metrics.RecordGuardrailDetections(ctx, guardrailPII, d, string(action), count, metricAttrs...)
+	}
+	if action == filterapi.PIIActionReject {
+		slices.Sort(detectors)
+		return nil, nil, openAIErrorResponse(typev3.StatusCode_BadRequest, "pii_detected",
+			fmt.Sprintf("The request contains personally identifiable information: %s.", strings.Join(detectors, ", "))), nil
+	}
+	if vault != nil && vault.Len() == 0 {
+		vault = nil
+	}
+	return redacted, vault, nil, nil
+}
+
+// applySecretGuardrail detects the secrets in the text of all the messages of the raw chat completion request body
+// with the secret guardrail of the rule of the model, and records the detections in the metrics and the logs.
+//
+// This returns the redacted body, which is nil if the body is not modified. When the action is Block and any
+// secret is detected, this returns the local reply rejecting the request instead.
+func applySecretGuardrail(ctx context.Context, config *processorConfig, logger *slog.Logger, metrics metrics.GuardrailMetrics, model string,
+	raw []byte, metricAttrs ...attribute.KeyValue,
+) (redacted []byte, rejected *extprocv3.ProcessingResponse, err error) {
+	g := guardrailsOf(config, model)
+	if g == nil || g.secrets == nil || !g.secretsInRequest {
+		return nil, nil, nil
+	}
+	detections := make(map[string]int)
+	redacted, err = redactChatCompletionMessagesText(raw, func(text string) string {
+		return g.secrets.Scan(text, detections)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to redact secrets: %w", err)
+	}
+	if len(detections) == 0 {
+		return nil, nil, nil
+	}
+	detectors := reportSecretDetections(ctx, logger, metrics, g.secrets.Action(), guardrail.ExternalPhaseRequest, model, detections, metricAttrs...)
+	switch g.secrets.Action() {
+	case filterapi.SecretActionBlock:
+		return nil, openAIErrorResponse(typev3.StatusCode_BadRequest, "secret_detected",
+			fmt.Sprintf("The request contains secrets: %s.", strings.Join(detectors, ", "))), nil
+	case filterapi.SecretActionRedact:
+		return redacted, nil, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// secretScannerOf returns the scanner of the secret guardrail of the rule of the model if the responses are
+// scanned, or nil otherwise.
+func secretScannerOf(config *processorConfig, model string) *guardrail.SecretScanner {
+	g := guardrailsOf(config, model)
+	if g == nil || !g.secretsInResponse {
+		return nil
+	}
+	return g.secrets
+}
+
+// scanResponseSecrets detects the secrets in the content of the non-streaming chat completion response, and returns
+// the redacted response, which is nil if the response is not modified. When the action is Block and any secret is
+// detected, this returns the local reply failing the response instead.
+func scanResponseSecrets(ctx context.Context, logger *slog.Logger, metrics metrics.GuardrailMetrics, s *guardrail.SecretScanner,
+	model string, body []byte, metricAttrs ...attribute.KeyValue,
+) (redacted []byte, rejected *extprocv3.ProcessingResponse) {
+	detections := make(map[string]int)
+	redacted, err := redactChatCompletionResponseText(body, func(text string) string {
+		return s.Scan(text, detections)
+	})
+	if err != nil {
+		logger.Error("failed to redact secrets in response", slog.String("error", err.Error()))
+		return nil, nil
+	}
+	if len(detections) == 0 {
+		return nil, nil
+	}
+	detectors := reportSecretDetections(ctx, logger, metrics, s.Action(), guardrail.ExternalPhaseResponse, model, detections, metricAttrs...)
+	switch s.Action() {
+	case filterapi.SecretActionBlock:
+		return nil, openAIErrorResponse(typev3.StatusCode_BadRequest, "secret_detected",
+			fmt.Sprintf("The response contains secrets: %s.", strings.Join(detectors, ", ")))
+	case filterapi.SecretActionRedact:
+		return redacted, nil
+	default:
+		return nil, nil
+	}
+}
+
+// scanStreamSecrets detects the secrets in the chunk of the streaming chat completion response with the scanner, and
+// returns the events to be sent. When the action is Block and any secret is detected, the stream is terminated with
+// the error event and this returns true as terminated.
+func scanStreamSecrets(ctx context.Context, logger *slog.Logger, metrics metrics.GuardrailMetrics, s *guardrail.SecretStreamScanner,
+	action filterapi.SecretAction, model string, chunk []byte, endOfStream bool, metricAttrs ...attribute.KeyValue,
+) (out []byte, terminated bool) {
+	detections := make(map[string]int)
+	out, blocked := s.Stream(chunk, endOfStream, detections)
+	if len(detections) == 0 {
+		return out, blocked
+	}
+	detectors := reportSecretDetections(ctx, logger, metrics, action, guardrail.ExternalPhaseResponse, model, detections, metricAttrs...)
+	if blocked {
+		out = append(out, errorEvent(typev3.StatusCode_BadRequest, "secret_detected",
+			fmt.Sprintf("The response contains secrets: %s.", strings.Join(detectors, ", ")))...)
+	}
+	return out, blocked
+}
+
+// reportSecretDetections records the detections of the secret guardrail in the metrics and the logs, and returns the
+// sorted names of the detectors. The logs never contain the detected secrets.
+func reportSecretDetections(ctx context.Context, logger *slog.Logger, metrics metrics.GuardrailMetrics, action filterapi.SecretAction,
+	phase guardrail.ExternalPhase, model string, detections map[string]int, metricAttrs ...attribute.KeyValue,
+) []string {
+	detectors := make([]string, 0, len(detections))
+	for d, count := range detections {
+		detectors = append(detectors, d)
+		metrics.RecordGuardrailDetections(ctx, guardrailSecrets, d, string(action), count, metricAttrs...)
+	}
+	slices.Sort(detectors)
+	logger.Warn("secrets detected", slog.String("phase", string(phase)), slog.String("model", model),
+		slog.String("action", string(action)), slog.String("detectors", strings.Join(detectors, ",")))
+	return detectors
+}
+
+// errorEvent returns the server-sent event of the OpenAI-compatible error, which terminates the streaming response
+// whose status is already sent.
+func errorEvent(status typev3.StatusCode, code, message string) []byte {
+	body := openAIErrorResponse(status, code, message).GetImmediateResponse().Body
+	return append(append([]byte("data: "), body...), "\n\n"...)
+}
+
+// redactChatCompletionText rewrites the text of the user and the tool messages of the chat completion request.
+func redactChatCompletionText(raw []byte, redact func(string) string) ([]byte, error) {
+	return redactMessagesText(raw, redact, func(role string) bool {
+		return role == openai.ChatMessageRoleUser || role == openai.ChatMessageRoleTool
+	})
+}
+
+// redactChatCompletionMessagesText rewrites the text of all the messages of the chat completion request.
+func redactChatCompletionMessagesText(raw []byte, redact func(string) string) ([]byte, error) {
+	return redactMessagesText(raw, redact, func(string) bool { return true })
+}
+
+// redactChatCompletionResponseText rewrites the content of the messages of the choices of the non-streaming chat
+// completion response.
+func redactChatCompletionResponseText(raw []byte, redact func(string) string) ([]byte, error) {
+	var err error
+	for i, choice := range gjson.GetBytes(raw, "choices").Array() {
+		content := choice.Get("message.content")
+		if content.Type != gjson.String {
+			continue
+		}
+		if raw, err = setRedactedText(raw, fmt.Sprintf("choices.%d.message.content", i), content.Str, redact); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// redactMessagesText rewrites the text of the messages of the chat completion request whose roles are included.
+func redactMessagesText(raw []byte, redact func(string) string, included func(role string) bool) ([]byte, error) {
+	var err error
+	for i, msg := range gjson.GetBytes(raw, "messages").Array() {
+		if !included(msg.Get("role").String()) {
+			continue
+		}
+		content := msg.Get("content")
+		if content.Type == gjson.String {
+			if raw, err = setRedactedText(raw, fmt.Sprintf("messages.%d.content", i), content.Str, redact); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for j, part := range content.Array() {
+			if part.Get("type").String() != "text" {
+				continue
+			}
+			if raw, err = setRedactedText(raw, fmt.Sprintf("messages.%d.content.%d.text", i, j), part.Get("text").String(), redact); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return raw, nil
+}
+
+// redactEmbeddingsText rewrites the text inputs of the embeddings request.
+func redactEmbeddingsText(raw []byte, redact func(string) string) ([]byte, error) {
+	input := gjson.GetBytes(raw, "input")
+	if input.Type == gjson.String {
+		return setRedactedText(raw, "input", input.Str, redact)
+	}
+	var err error
+	for i, in := range input.Array() {
+		if in.Type != gjson.String {
+			continue
+		}
+		if raw, err = setRedactedText(raw, fmt.Sprintf("input.%d", i), in.Str, redact); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// setRedactedText sets the redacted text at the path of the raw JSON only if the text is modified.
+func setRedactedText(raw []byte, path, text string, redact func(string) string) ([]byte, error) {
+	redacted := redact(text)
+	if redacted == text {
+		return raw, nil
+	}
+	return sjson.SetBytes(raw, path, redacted)
+}
+
+// rewrittenRequestBodyMutation returns the body mutation replacing the request body with the one rewritten by the
+// router filter, which is needed when the translator does not modify the body since Envoy would otherwise send the
+// original body.
+func rewrittenRequestBodyMutation(headerMutation *extprocv3.HeaderMutation, rewritten []byte) *extprocv3.BodyMutation {
+	headerMutation.SetHeaders = append(headerMutation.SetHeaders, &corev3.HeaderValueOption{Header: &corev3.HeaderValue{
+		Key: "content-length", RawValue: []byte(strconv.Itoa(len(rewritten))),
+	}})
+	return &extprocv3.BodyMutation{Mutation: &extprocv3.BodyMutation_Body{Body: rewritten}}
+}
+
+// detokenizeResponseBody replaces the tokens of the vault in the response body, which is either the body mutation
+// of the translator or the original body when the translator does not modify it.
+func detokenizeResponseBody(d *guardrail.PIIDetokenizer, stream bool, bodyMutation *extprocv3.BodyMutation, original []byte, endOfStream bool) *extprocv3.BodyMutation {
+	body := original
+	if bm := bodyMutation.GetBody(); bm != nil {
+		body = bm
+	}
+	if stream {
+		body = d.Stream(body, endOfStream)
+	} else {
+		body = d.Body(body)
+	}
+	return &extprocv3.BodyMutation{Mutation: &extprocv3.BodyMutation_Body{Body: body}}
+}
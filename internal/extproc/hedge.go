@@ -0,0 +1,137 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// hedgedAttemptAttribute is the metric attribute attached to the token usage and the cost estimated for the hedged
+// attempts, so that the extra cost of hedging is distinguishable from the usage of the response returned to the client.
+var hedgedAttemptAttribute = attribute.Bool("ai_gateway.hedged_attempt", true)
+
+// hedgeState tracks the upstream attempts of a single request routed to a rule with the hedge policy.
+//
+// The hedged attempts are issued by Envoy and run concurrently, and each of them has its own upstream filter.
+// Hence, this is shared between the router filter and all the upstream filters of the request, and must be
+// accessed with the mutex held.
+//
+// Each upstream filter tags the response headers of its attempt with its index in the attempts, and the router
+// filter claims the attempt whose response headers it receives. Envoy only forwards the final response of the
+// request to the router filter, i.e. neither the response with the retriable status nor the response of the
+// attempt cancelled by the other, so the claimed attempt is always the one returned to the client.
+type hedgeState struct {
+	mu sync.Mutex
+	// attempts are the upstream attempts including the original one in the order they are started.
+	attempts []*hedgeAttempt
+	// winner is the upstream filter of the attempt whose response is returned to the client.
+	winner Processor
+}
+
+// hedgeAttempt is an upstream attempt of the request routed to a rule with the hedge policy.
+type hedgeAttempt struct {
+	processor Processor
+	// start is the time when the attempt was started, from which the per-try timeout of the hedge policy elapses.
+	start time.Time
+	// responded is true once the attempt has received the response headers or has been replied locally, after which
+	// Envoy no longer hedges it.
+	responded bool
+	// hedged is true once another attempt has been started as the hedge of this attempt.
+	hedged bool
+	// isHedge is true if this attempt was started by the hedge policy rather than by the retry policy.
+	isHedge bool
+}
+
+// start adds the attempt of the upstream filter, and returns its index and whether it is a hedge of the in-flight
+// attempt rather than a retry.
+//
+// Envoy starts the hedge when the in-flight attempt has not received the response headers within the per-try
+// timeout, while it retries the attempt which failed, e.g. the connection failure or the retriable status, whatever
+// the time elapsed. Since the failures by the connection are not visible to the upstream filters, the attempt is
+// regarded as a hedge if an attempt which has been neither responded nor hedged yet has run for the timeout.
+// Otherwise, the oldest such attempt is regarded as failed.
+func (h *hedgeState) start(p Processor, timeout time.Duration, now time.Time) (index int, isHedge bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var failed *hedgeAttempt
+	for _, a := range h.attempts {
+		if a.responded || a.hedged {
+			continue
+		}
+		if now.Sub(a.start) >= timeout {
+			a.hedged, isHedge = true, true
+			break
+		}
+		if failed == nil {
+			failed = a
+		}
+	}
+	if !isHedge && failed != nil {
+		failed.responded = true
+	}
+	h.attempts = append(h.attempts, &hedgeAttempt{processor: p, start: now, isHedge: isHedge})
+	return len(h.attempts) - 1, isHedge
+}
+
+// responded marks the attempt as responded so that it is no longer regarded as in flight.
+func (h *hedgeState) responded(index int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if index < len(h.attempts) {
+		h.attempts[index].responded = true
+	}
+}
+
+// claim marks the attempt tagged with the value of the hedgeAttemptHeader as the winner, and returns its upstream
+// filter. This returns nil if the value does not refer to any attempt.
+func (h *hedgeState) claim(tag string) Processor {
+	index, err := strconv.Atoi(tag)
+	if err != nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if index < 0 || index >= len(h.attempts) {
+		return nil
+	}
+	h.winner = h.attempts[index].processor
+	return h.winner
+}
+
+// latest returns the upstream filter of the attempt started last, or nil if no attempt has been started.
+func (h *hedgeState) latest() Processor {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.attempts) == 0 {
+		return nil
+	}
+	return h.attempts[len(h.attempts)-1].processor
+}
+
+// getWinner returns the upstream filter of the winning attempt, or nil if the final response has not been received yet.
+func (h *hedgeState) getWinner() Processor {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.winner
+}
+
+// hedgedAttempts returns the number of the attempts started by the hedge policy. As only one attempt wins the race,
+// this is the number of the extra attempts sent to the backends by hedging.
+func (h *hedgeState) hedgedAttempts() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var n int
+	for _, a := range h.attempts {
+		if a.isHedge {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,216 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+)
+
+func Test_hedgeState(t *testing.T) {
+	const timeout = 500 * time.Millisecond
+	var h hedgeState
+	require.Nil(t, h.getWinner())
+	require.Zero(t, h.hedgedAttempts())
+
+	ps := make([]*chatCompletionProcessorUpstreamFilter, 5)
+	for i := range ps {
+		ps[i] = &chatCompletionProcessorUpstreamFilter{}
+	}
+	now := time.Now()
+	start := func(i int, elapsed time.Duration) bool {
+		index, isHedge := h.start(ps[i], timeout, now.Add(elapsed))
+		require.Equal(t, i, index)
+		return isHedge
+	}
+	require.False(t, start(0, 0))
+	// The attempt started before the timeout is the retry of the failed one, e.g. by the connection failure.
+	require.False(t, start(1, 30*time.Millisecond))
+	// The attempt started after the timeout of the in-flight attempt is its hedge.
+	require.True(t, start(2, 530*time.Millisecond))
+	// The in-flight attempt is only hedged once, so this is the retry of the hedged attempt which failed.
+	require.False(t, start(3, 540*time.Millisecond))
+	// The attempt which has received the response is not hedged.
+	h.responded(3)
+	require.False(t, start(4, 2*time.Second))
+	require.Equal(t, 1, h.hedgedAttempts())
+
+	require.Nil(t, h.claim("invalid"))
+	require.Nil(t, h.claim("5"))
+	require.Nil(t, h.getWinner())
+	require.Equal(t, ps[2], h.claim("2"))
+	require.Equal(t, ps[2], h.getWinner())
+}
+
+func Test_chatCompletionProcessor_hedge(t *testing.T) {
+	const backendName = "ns/backend/route/route1/rule/0/ref/0"
+	newConfig := func(timeout time.Duration) *processorConfig {
+		return &processorConfig{
+			metadataNamespace:  "ai_gateway_llm_ns",
+			modelNameHeaderKey: "x-model",
+			prices:             []filterapi.ModelPrice{{Model: "gpt", InputToken: 1, OutputToken: 2}},
+			backends: map[string]*processorConfigBackend{
+				backendName: {
+					b: &filterapi.Backend{Name: backendName},
+					rule: &filterapi.RouteRule{
+						Name:        "ns/route1/rule/0",
+						HedgePolicy: &filterapi.HedgePolicy{FirstResponseTimeout: timeout, MaxHedgedRequests: 1},
+					},
+				},
+			},
+		}
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	backend := &filterapi.Backend{
+		Name:   backendName,
+		Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+	}
+	newUnsetUpstream := func(config *processorConfig, mm *mockChatCompletionMetrics) *chatCompletionProcessorUpstreamFilter {
+		return &chatCompletionProcessorUpstreamFilter{
+			config:         config,
+			logger:         logger,
+			metrics:        mm,
+			requestHeaders: map[string]string{"x-model": "gpt"},
+		}
+	}
+	newUpstream := func(config *processorConfig, rp *chatCompletionProcessorRouterFilter, mm *mockChatCompletionMetrics) *chatCompletionProcessorUpstreamFilter {
+		u := newUnsetUpstream(config, mm)
+		require.NoError(t, u.SetBackend(t.Context(), backend, nil, rp))
+		return u
+	}
+
+	t.Run("hedged", func(t *testing.T) {
+		config := newConfig(0)
+		store := mapQuotaStore{}
+		config.quotaStore = store
+		rp := &chatCompletionProcessorRouterFilter{config: config, logger: logger, originalRequestBody: &openai.ChatCompletionRequest{}}
+		rp.quota = &quotaState{config: config, usages: []quotaUsage{{
+			budget: &filterapi.QuotaBudget{Name: "tokens", Type: filterapi.QuotaBudgetTypeToken, Limit: 100}, key: "tokens",
+		}}}
+		mm := &mockChatCompletionMetrics{}
+		original, hedged := newUpstream(config, rp, mm), newUpstream(config, rp, mm)
+		// The hedged attempt is not a retry.
+		require.False(t, original.isHedge)
+		require.True(t, hedged.isHedge)
+		require.False(t, hedged.onRetry)
+		require.Equal(t, 1, rp.upstreamFilterCount)
+
+		// Both attempts tag their response headers, regardless of the status.
+		for i, u := range []*chatCompletionProcessorUpstreamFilter{original, hedged} {
+			res, err := u.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{})
+			require.NoError(t, err)
+			setHeaders := res.GetResponseHeaders().Response.HeaderMutation.SetHeaders
+			require.Len(t, setHeaders, 1)
+			require.Equal(t, internalapi.HedgeAttemptHeader, setHeaders[0].Header.Key)
+			require.Equal(t, []byte{byte('0' + i)}, setHeaders[0].Header.RawValue)
+		}
+		// No attempt wins until the router filter receives the final response.
+		require.Nil(t, rp.hedge.getWinner())
+
+		// The router filter switches to the attempt whose response is returned to the client, and removes the tag.
+		headers := &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":status", RawValue: []byte("200")},
+			{Key: internalapi.HedgeAttemptHeader, RawValue: []byte("0")},
+		}}
+		mt := &mockTranslator{t: t, expHeaders: map[string]string{":status": "200", internalapi.HedgeAttemptHeader: "0"}}
+		original.translator = mt
+		res, err := rp.ProcessResponseHeaders(t.Context(), headers)
+		require.NoError(t, err)
+		require.Equal(t, original, rp.upstreamFilter)
+		require.Equal(t, original, rp.hedge.getWinner())
+		require.Equal(t, []string{internalapi.HedgeAttemptHeader}, res.GetResponseHeaders().Response.HeaderMutation.RemoveHeaders)
+
+		// The hedged attempt is estimated to have consumed the same input tokens, which are recorded apart from the
+		// usage of the response, and are charged to the costs and the quotas of the request.
+		inBody := &extprocv3.HttpBody{Body: []byte("some-body"), EndOfStream: true}
+		mt.expResponseBody = inBody
+		mt.retUsedToken = translator.LLMTokenUsage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}
+		res, err = rp.ProcessResponseBody(t.Context(), inBody)
+		require.NoError(t, err)
+		require.Equal(t, translator.LLMTokenUsage{InputTokens: 20, OutputTokens: 5, TotalTokens: 25}, original.costs)
+		require.Equal(t, 1, mm.tokenUsageCount)
+		require.Equal(t, 1, mm.hedgedAttempts)
+		require.Equal(t, uint32(10), mm.hedgedInputTokens)
+		require.Equal(t, []uint64{20, 10}, mm.costs)
+		require.Equal(t, int64(25), store["tokens"])
+		require.Equal(t, float64(1), res.DynamicMetadata.Fields["ai_gateway_llm_ns"].
+			GetStructValue().Fields["hedged_attempts"].GetNumberValue())
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		config := newConfig(time.Hour)
+		rp := &chatCompletionProcessorRouterFilter{config: config, logger: logger, originalRequestBody: &openai.ChatCompletionRequest{}}
+		mm := &mockChatCompletionMetrics{}
+		original, retried := newUpstream(config, rp, mm), newUpstream(config, rp, mm)
+		require.False(t, original.isHedge)
+		// The attempt started before the timeout is the retry of the failed one.
+		require.False(t, retried.isHedge)
+		require.True(t, retried.onRetry)
+		require.Equal(t, 2, rp.upstreamFilterCount)
+
+		mt := &mockTranslator{t: t, expHeaders: map[string]string{":status": "200", internalapi.HedgeAttemptHeader: "1"}}
+		retried.translator = mt
+		_, err := rp.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":status", RawValue: []byte("200")},
+			{Key: internalapi.HedgeAttemptHeader, RawValue: []byte("1")},
+		}})
+		require.NoError(t, err)
+		inBody := &extprocv3.HttpBody{Body: []byte("some-body"), EndOfStream: true}
+		mt.expResponseBody = inBody
+		mt.retUsedToken = translator.LLMTokenUsage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}
+		res, err := rp.ProcessResponseBody(t.Context(), inBody)
+		require.NoError(t, err)
+		require.Zero(t, mm.hedgedAttempts)
+		require.Equal(t, []uint64{20}, mm.costs)
+		require.NotContains(t, res.DynamicMetadata.Fields["ai_gateway_llm_ns"].GetStructValue().Fields, "hedged_attempts")
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		// The hedged attempt is started by Envoy concurrently with the response processing of the original attempt.
+		config := newConfig(0)
+		rp := &chatCompletionProcessorRouterFilter{config: config, logger: logger, originalRequestBody: &openai.ChatCompletionRequest{}}
+		original := newUpstream(config, rp, &mockChatCompletionMetrics{})
+		mt := &mockTranslator{t: t, expHeaders: map[string]string{":status": "200", internalapi.HedgeAttemptHeader: "0"}}
+		original.translator = mt
+
+		hedged := newUnsetUpstream(config, &mockChatCompletionMetrics{})
+		done := make(chan error)
+		go func() {
+			err := hedged.SetBackend(t.Context(), backend, nil, rp)
+			if err == nil {
+				_, err = hedged.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{})
+			}
+			done <- err
+		}()
+
+		_, err := original.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{})
+		require.NoError(t, err)
+		_, err = rp.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":status", RawValue: []byte("200")},
+			{Key: internalapi.HedgeAttemptHeader, RawValue: []byte("0")},
+		}})
+		require.NoError(t, err)
+		inBody := &extprocv3.HttpBody{Body: []byte("some-body"), EndOfStream: true}
+		mt.expResponseBody = inBody
+		_, err = rp.ProcessResponseBody(t.Context(), inBody)
+		require.NoError(t, err)
+		require.NoError(t, <-done)
+		// The response is processed by the claimed attempt whichever attempt started last.
+		require.Equal(t, original, rp.upstreamFilter)
+		require.Equal(t, original, rp.hedge.getWinner())
+	})
+}
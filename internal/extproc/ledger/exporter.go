@@ -0,0 +1,30 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package ledger
+
+import (
+	"log/slog"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/export"
+)
+
+// Sink is the destination of the usage records.
+type Sink = export.Sink[Record]
+
+// Exporter exports the usage records to the [Sink] in the background.
+type Exporter = export.Exporter[Record]
+
+// NewExporter creates a new [Exporter] and starts exporting the records to the sink.
+// The sink is closed when the exporter is closed.
+func NewExporter(sink Sink, logger *slog.Logger) *Exporter {
+	return export.NewExporter(sink, logger, "usage records", nil)
+}
+
+// NewFileSink creates a new [Sink] which appends the records to the file at the given path as JSON lines.
+// See [export.NewFileSink] for the rotation of the file.
+func NewFileSink(path string, maxSize int64, maxBackups int) (Sink, error) {
+	return export.NewFileSink[Record](path, maxSize, maxBackups, "usage ledger file")
+}
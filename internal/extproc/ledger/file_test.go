@@ -0,0 +1,43 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package ledger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	cost := uint64(1500)
+	r := &Record{
+		ID: "a", Time: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), Operation: "chat_completion", Consumer: "team-a",
+		Model: "gpt-4o", Backend: "openai", InputTokens: 10, OutputTokens: 5, TotalTokens: 15,
+		CostMicroUSD: &cost, Costs: map[string]uint32{"total": 15}, LatencyMs: 120, Status: 200,
+	}
+	s, err := NewFileSink(path, 1<<20, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Export(t.Context(), []*Record{r}))
+	require.NoError(t, s.Close())
+
+	line, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+  "id": "a", "time": "2025-07-01T00:00:00Z", "operation": "chat_completion", "consumer": "team-a",
+  "model": "gpt-4o", "backend": "openai", "input_tokens": 10, "output_tokens": 5, "total_tokens": 15,
+  "cached_input_tokens": 0, "reasoning_tokens": 0, "cost_micro_usd": 1500, "costs": {"total": 15},
+  "latency_ms": 120, "status": 200
+}`, string(line))
+
+	t.Run("invalid path", func(t *testing.T) {
+		_, err = NewFileSink(filepath.Join(t.TempDir(), "missing", "usage.jsonl"), 1, 0)
+		require.ErrorContains(t, err, "failed to open usage ledger file")
+	})
+}
@@ -0,0 +1,200 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package ledger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/export"
+)
+
+const (
+	// cloudEventType is the type of the CloudEvents sent by the webhook sink.
+	cloudEventType = "io.envoyproxy.aigateway.usage.v1"
+	// cloudEventSource is the source of the CloudEvents sent by the webhook sink.
+	cloudEventSource = "/envoy-ai-gateway/extproc"
+	// otlpEventName is the event name of the log records sent by the OTLP sink.
+	otlpEventName = "aigw.usage"
+	// otlpScopeName is the name of the instrumentation scope of the log records sent by the OTLP sink.
+	otlpScopeName = "github.com/envoyproxy/ai-gateway/internal/extproc/ledger"
+	// otlpServiceName is the service name of the resource of the log records sent by the OTLP sink.
+	otlpServiceName = "ai-gateway-extproc"
+	// maxErrorBodySize is the maximum size of the response body included in the error of the failed export.
+	maxErrorBodySize = 512
+)
+
+// NewWebhookSink creates a new [Sink] which sends the records to the URL as a batch of CloudEvents in the JSON
+// format, i.e., with the "application/cloudevents-batch+json" content type.
+func NewWebhookSink(url string) Sink {
+	return &httpSink{url: url, contentType: "application/cloudevents-batch+json", encode: encodeCloudEvents, client: newHTTPClient()}
+}
+
+// NewOTLPSink creates a new [Sink] which sends the records as the OTLP log records in the protobuf encoding to
+// the OTLP/HTTP endpoint, e.g. "http://otel-collector:4318". The "/v1/logs" path is appended unless the endpoint
+// already has it.
+func NewOTLPSink(endpoint string) Sink {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/logs") {
+		url += "/v1/logs"
+	}
+	return &httpSink{url: url, contentType: "application/x-protobuf", encode: encodeOTLPLogs, client: newHTTPClient()}
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: export.Timeout}
+}
+
+// httpSink implements [Sink] by sending the records encoded by encode to the URL.
+type httpSink struct {
+	url         string
+	contentType string
+	encode      func([]*Record) ([]byte, error)
+	client      *http.Client
+}
+
+// Export implements [Sink.Export].
+func (s *httpSink) Export(ctx context.Context, records []*Record) error {
+	body, err := s.encode(records)
+	if err != nil {
+		return export.Permanent(fmt.Errorf("failed to encode records: %w", err))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return export.Permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+	req.Header.Set("Content-Type", s.contentType)
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send records: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+	err = fmt.Errorf("unexpected status code %d: %s", res.StatusCode, msg)
+	// The client errors other than the throttling are not resolved by retrying.
+	if res.StatusCode/100 == 4 && res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusRequestTimeout {
+		return export.Permanent(err)
+	}
+	return err
+}
+
+// Close implements [Sink.Close].
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// cloudEvent is the CloudEvent in the JSON format with the record as the data.
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	Type            string    `json:"type"`
+	Source          string    `json:"source"`
+	ID              string    `json:"id"`
+	Time            time.Time `json:"time"`
+	Subject         string    `json:"subject,omitempty"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            *Record   `json:"data"`
+}
+
+// encodeCloudEvents encodes the records as a batch of CloudEvents. The consumer is set as the subject of the event.
+func encodeCloudEvents(records []*Record) ([]byte, error) {
+	events := make([]cloudEvent, len(records))
+	for i, r := range records {
+		events[i] = cloudEvent{
+			SpecVersion:     "1.0",
+			Type:            cloudEventType,
+			Source:          cloudEventSource,
+			ID:              r.ID,
+			Time:            r.Time,
+			Subject:         r.Consumer,
+			DataContentType: "application/json",
+			Data:            r,
+		}
+	}
+	return json.Marshal(events)
+}
+
+// encodeOTLPLogs encodes the records as the OTLP export logs request. The fields of the record are set as the
+// attributes of the log record with the same names as the JSON ones.
+func encodeOTLPLogs(records []*Record) ([]byte, error) {
+	logs := make([]*logspb.LogRecord, len(records))
+	for i, r := range records {
+		attrs := []*commonpb.KeyValue{
+			otlpString("id", r.ID),
+			otlpString("operation", r.Operation),
+			otlpString("consumer", r.Consumer),
+			otlpString("route", r.Route),
+			otlpString("model", r.Model),
+			otlpString("backend", r.Backend),
+			otlpString("backend_model", r.BackendModel),
+			otlpBool("stream", r.Stream),
+			otlpInt("input_tokens", int64(r.InputTokens)),
+			otlpInt("output_tokens", int64(r.OutputTokens)),
+			otlpInt("total_tokens", int64(r.TotalTokens)),
+			otlpInt("cached_input_tokens", int64(r.CachedInputTokens)),
+			otlpInt("reasoning_tokens", int64(r.ReasoningTokens)),
+			otlpInt("latency_ms", r.LatencyMs),
+			otlpInt("status", int64(r.Status)),
+		}
+		if r.CostMicroUSD != nil {
+			attrs = append(attrs, otlpInt("cost_micro_usd", int64(*r.CostMicroUSD))) //nolint:gosec
+		}
+		if len(r.Costs) > 0 {
+			costs := make([]*commonpb.KeyValue, 0, len(r.Costs))
+			for k, v := range r.Costs {
+				costs = append(costs, otlpInt(k, int64(v)))
+			}
+			attrs = append(attrs, &commonpb.KeyValue{Key: "costs", Value: &commonpb.AnyValue{
+				Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: costs}},
+			}})
+		}
+		logs[i] = &logspb.LogRecord{
+			TimeUnixNano:         uint64(r.Time.UnixNano()), //nolint:gosec
+			ObservedTimeUnixNano: uint64(r.Time.UnixNano()), //nolint:gosec
+			SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+			SeverityText:         "INFO",
+			EventName:            otlpEventName,
+			Attributes:           attrs,
+		}
+	}
+	return proto.Marshal(&collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{otlpString("service.name", otlpServiceName)}},
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: otlpScopeName},
+				LogRecords: logs,
+			}},
+		}},
+	})
+}
+
+func otlpString(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func otlpInt(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}}}
+}
+
+func otlpBool(key string, value bool) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: value}}}
+}
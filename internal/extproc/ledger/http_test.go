@@ -0,0 +1,125 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package ledger
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/export"
+	internaltesting "github.com/envoyproxy/ai-gateway/internal/testing"
+)
+
+func newTestRecords() []*Record {
+	cost := uint64(1500)
+	return []*Record{
+		{
+			ID: "a", Time: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), Operation: "chat_completion", Consumer: "team-a",
+			Route: "rule-0", Model: "gpt-4o", Backend: "openai", Stream: true, InputTokens: 10, OutputTokens: 5, TotalTokens: 15,
+			CostMicroUSD: &cost, Costs: map[string]uint32{"total": 15}, LatencyMs: 120, Status: 200,
+		},
+		{ID: "b", Time: time.Date(2025, 7, 1, 0, 0, 1, 0, time.UTC), Operation: "embeddings", Model: "e5", Backend: "local", Status: 500},
+	}
+}
+
+// kv returns the value of the attribute of the log record, or nil if it does not exist.
+func kv(l *logspb.LogRecord, key string) *commonpb.AnyValue {
+	for _, a := range l.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func TestWebhookSink(t *testing.T) {
+	srv, req, body := internaltesting.NewRecordingServer(t, http.StatusAccepted)
+	s := NewWebhookSink(srv.URL + "/usage")
+	require.NoError(t, s.Export(t.Context(), newTestRecords()))
+	require.NoError(t, s.Close())
+	require.Equal(t, "/usage", req.URL.Path)
+	require.Equal(t, "application/cloudevents-batch+json", req.Header.Get("Content-Type"))
+	require.JSONEq(t, `[
+  {
+    "specversion": "1.0", "type": "io.envoyproxy.aigateway.usage.v1", "source": "/envoy-ai-gateway/extproc",
+    "id": "a", "time": "2025-07-01T00:00:00Z", "subject": "team-a", "datacontenttype": "application/json",
+    "data": {
+      "id": "a", "time": "2025-07-01T00:00:00Z", "operation": "chat_completion", "consumer": "team-a", "route": "rule-0",
+      "model": "gpt-4o", "backend": "openai", "stream": true, "input_tokens": 10, "output_tokens": 5, "total_tokens": 15,
+      "cached_input_tokens": 0, "reasoning_tokens": 0, "cost_micro_usd": 1500, "costs": {"total": 15},
+      "latency_ms": 120, "status": 200
+    }
+  },
+  {
+    "specversion": "1.0", "type": "io.envoyproxy.aigateway.usage.v1", "source": "/envoy-ai-gateway/extproc",
+    "id": "b", "time": "2025-07-01T00:00:01Z", "datacontenttype": "application/json",
+    "data": {
+      "id": "b", "time": "2025-07-01T00:00:01Z", "operation": "embeddings", "model": "e5", "backend": "local",
+      "input_tokens": 0, "output_tokens": 0, "total_tokens": 0, "cached_input_tokens": 0, "reasoning_tokens": 0,
+      "latency_ms": 0, "status": 500
+    }
+  }
+]`, string(*body))
+}
+
+func TestHTTPSink_errors(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		permanent bool
+	}{
+		{status: http.StatusBadRequest, permanent: true},
+		{status: http.StatusUnauthorized, permanent: true},
+		{status: http.StatusTooManyRequests},
+		{status: http.StatusServiceUnavailable},
+	} {
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			srv, _, _ := internaltesting.NewRecordingServer(t, tc.status)
+			err := NewWebhookSink(srv.URL).Export(t.Context(), newTestRecords())
+			require.ErrorContains(t, err, "response")
+			require.Equal(t, tc.permanent, export.IsPermanent(err))
+		})
+	}
+	t.Run("unreachable", func(t *testing.T) {
+		srv, _, _ := internaltesting.NewRecordingServer(t, http.StatusOK)
+		srv.Close()
+		err := NewWebhookSink(srv.URL).Export(t.Context(), newTestRecords())
+		require.ErrorContains(t, err, "failed to send records")
+		require.False(t, export.IsPermanent(err))
+	})
+}
+
+func TestOTLPSink(t *testing.T) {
+	srv, req, body := internaltesting.NewRecordingServer(t, http.StatusOK)
+	for _, endpoint := range []string{srv.URL, srv.URL + "/", srv.URL + "/v1/logs"} {
+		s := NewOTLPSink(endpoint)
+		require.NoError(t, s.Export(t.Context(), newTestRecords()))
+		require.Equal(t, "/v1/logs", req.URL.Path)
+		require.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+	}
+
+	var exported collogspb.ExportLogsServiceRequest
+	require.NoError(t, proto.Unmarshal(*body, &exported))
+	require.Len(t, exported.ResourceLogs, 1)
+	require.Equal(t, "ai-gateway-extproc", exported.ResourceLogs[0].Resource.Attributes[0].Value.GetStringValue())
+	logs := exported.ResourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(t, logs, 2)
+	require.Equal(t, "aigw.usage", logs[0].EventName)
+	require.Equal(t, uint64(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC).UnixNano()), logs[0].TimeUnixNano)
+	require.Equal(t, "team-a", kv(logs[0], "consumer").GetStringValue())
+	require.Equal(t, int64(10), kv(logs[0], "input_tokens").GetIntValue())
+	require.True(t, kv(logs[0], "stream").GetBoolValue())
+	require.Equal(t, int64(1500), kv(logs[0], "cost_micro_usd").GetIntValue())
+	require.Equal(t, int64(15), kv(logs[0], "costs").GetKvlistValue().Values[0].Value.GetIntValue())
+	require.Nil(t, kv(logs[1], "cost_micro_usd"))
+	require.Equal(t, int64(500), kv(logs[1], "status").GetIntValue())
+}
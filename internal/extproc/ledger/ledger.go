@@ -0,0 +1,50 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package ledger provides the export of the usage records of the completed requests, which are used to charge the
+// consumers back for their usage of the models.
+package ledger
+
+import (
+	"time"
+)
+
+// Record is the usage record of a completed request.
+type Record struct {
+	// ID is the ID of the request, which is the value of the "x-request-id" header.
+	ID string `json:"id"`
+	// Time is the time when the request completed.
+	Time time.Time `json:"time"`
+	// Operation is the operation of the request, e.g. "chat_completion" or "embeddings".
+	Operation string `json:"operation"`
+	// Consumer is the identity of the consumer who made the request. This is empty if it cannot be identified.
+	Consumer string `json:"consumer,omitempty"`
+	// Route is the name of the route rule which the backend belongs to.
+	Route string `json:"route,omitempty"`
+	// Model is the name of the model in the request.
+	Model string `json:"model"`
+	// Backend is the name of the backend which served the request, and BackendModel is the name of the model sent to
+	// the backend when it is overridden.
+	Backend      string `json:"backend"`
+	BackendModel string `json:"backend_model,omitempty"`
+	// Stream is true if the response was streamed.
+	Stream bool `json:"stream,omitempty"`
+	// The token usage reported by the backend. The cached input tokens and the reasoning tokens are part of the
+	// input and output tokens respectively.
+	InputTokens       uint32 `json:"input_tokens"`
+	OutputTokens      uint32 `json:"output_tokens"`
+	TotalTokens       uint32 `json:"total_tokens"`
+	CachedInputTokens uint32 `json:"cached_input_tokens"`
+	ReasoningTokens   uint32 `json:"reasoning_tokens"`
+	// CostMicroUSD is the cost of the request in micro-USD computed from the pricing catalog. This is nil if the
+	// model has no price.
+	CostMicroUSD *uint64 `json:"cost_micro_usd,omitempty"`
+	// Costs are the request costs configured in the LLMRequestCosts keyed by their metadata keys.
+	Costs map[string]uint32 `json:"costs,omitempty"`
+	// LatencyMs is the time in milliseconds from when the request arrived until the response completed.
+	LatencyMs int64 `json:"latency_ms"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+}
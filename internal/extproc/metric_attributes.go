@@ -0,0 +1,138 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+const (
+	// metricAttributePrefix is the prefix of the names of the metric attributes configured on the route.
+	metricAttributePrefix = "ai_gateway."
+	// metricAttributeOtherValue is the value recorded instead of the values not allowed or over the max values.
+	metricAttributeOtherValue = "_OTHER"
+)
+
+// The metrics recording the metric attributes, whose distinct values are tracked separately.
+const (
+	metricAttributesChatCompletion = "chat_completion"
+	metricAttributesEmbeddings     = "embeddings"
+)
+
+// metricAttributeKey identifies the attribute of the route rule recorded in the metric.
+type metricAttributeKey struct {
+	metric string
+	rule   filterapi.RouteRuleName
+	name   string
+}
+
+// metricAttributeValues tracks the distinct values recorded for each metric attribute to bound the cardinality of
+// the metrics. This is shared across the configuration reloads since the recorded time series outlive them.
+//
+// The values are tracked per metric, route rule and attribute name, so that the attributes of the same name
+// configured on different route rules do not share their max values.
+type metricAttributeValues struct {
+	mu     sync.Mutex
+	values map[metricAttributeKey]map[string]struct{}
+}
+
+func newMetricAttributeValues() *metricAttributeValues {
+	return &metricAttributeValues{values: make(map[metricAttributeKey]map[string]struct{})}
+}
+
+// admit returns the value if it has been recorded before or the attribute has less than maxValues distinct values,
+// and otherwise metricAttributeOtherValue.
+func (m *metricAttributeValues) admit(key metricAttributeKey, value string, maxValues int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen, ok := m.values[key]
+	if !ok {
+		seen = make(map[string]struct{})
+		m.values[key] = seen
+	}
+	if _, ok = seen[value]; ok {
+		return value
+	}
+	if len(seen) >= maxValues {
+		return metricAttributeOtherValue
+	}
+	seen[value] = struct{}{}
+	return value
+}
+
+// requestMetadataKey is the context key of the dynamic metadata sent by Envoy with the request headers.
+type requestMetadataKey struct{}
+
+// withRequestMetadata returns the context carrying the dynamic metadata of the request.
+func withRequestMetadata(ctx context.Context, md *corev3.Metadata) context.Context {
+	if len(md.GetFilterMetadata()) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, requestMetadataKey{}, md)
+}
+
+// requestMetadataValue returns the string representation of the value of the dynamic metadata of the request.
+func requestMetadataValue(ctx context.Context, namespace, key string) string {
+	md, _ := ctx.Value(requestMetadataKey{}).(*corev3.Metadata)
+	v := md.GetFilterMetadata()[namespace].GetFields()[key]
+	switch kind := v.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		return kind.StringValue
+	case *structpb.Value_NumberValue:
+		return strconv.FormatFloat(kind.NumberValue, 'f', -1, 64)
+	}
+	return ""
+}
+
+// routeMetricAttributes returns the metric attributes configured on the route rule of the model extracted from the
+// request, which are recorded in the given metric. The attributes whose values are not found are omitted.
+func routeMetricAttributes(ctx context.Context, config *processorConfig, metric, model string, headers map[string]string) []attribute.KeyValue {
+	rule := config.rulesByModel[model]
+	if rule == nil || len(rule.MetricAttributes) == 0 {
+		return nil
+	}
+	var ret []attribute.KeyValue
+	for i := range rule.MetricAttributes {
+		a := &rule.MetricAttributes[i]
+		var value string
+		if a.Header != "" {
+			value = headers[strings.ToLower(a.Header)]
+		} else {
+			value = requestMetadataValue(ctx, a.MetadataNamespace, a.MetadataKey)
+		}
+		if value == "" {
+			continue
+		}
+		key := metricAttributeKey{metric: metric, rule: rule.Name, name: a.Name}
+		ret = append(ret, attribute.String(metricAttributePrefix+a.Name, guardMetricAttributeValue(config.metricAttributeValues, key, a, value)))
+	}
+	return ret
+}
+
+// guardMetricAttributeValue returns the value recorded for the attribute after applying the allowed values, the
+// hashing and the max values in this order.
+func guardMetricAttributeValue(values *metricAttributeValues, key metricAttributeKey, a *filterapi.MetricAttribute, value string) string {
+	if len(a.AllowedValues) > 0 && !slices.Contains(a.AllowedValues, value) {
+		return metricAttributeOtherValue
+	}
+	if a.Hash {
+		sum := sha256.Sum256([]byte(value))
+		value = hex.EncodeToString(sum[:])[:16]
+	}
+	return values.admit(key, value, a.MaxValues)
+}
@@ -0,0 +1,144 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"log/slog"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+// metricAttributesTestRule returns the rule where the requests to "gpt" have the "team" attribute from the
+// "x-team-id" header and the "user" attribute from the "sub" key of the JWT metadata.
+func metricAttributesTestRule() filterapi.RouteRule {
+	return filterapi.RouteRule{MetricAttributes: []filterapi.MetricAttribute{
+		{Name: "team", Header: "x-team-id", AllowedValues: []string{"team-a", "team-b"}, MaxValues: 100},
+		{Name: "user", MetadataNamespace: "envoy.filters.http.jwt_authn", MetadataKey: "sub", MaxValues: 100, Hash: true},
+	}}
+}
+
+func newJWTMetadata(t *testing.T, fields map[string]any) *corev3.Metadata {
+	s, err := structpb.NewStruct(fields)
+	require.NoError(t, err)
+	return &corev3.Metadata{FilterMetadata: map[string]*structpb.Struct{"envoy.filters.http.jwt_authn": s}}
+}
+
+func Test_metricAttributeValues_admit(t *testing.T) {
+	m := newMetricAttributeValues()
+	team := metricAttributeKey{metric: metricAttributesChatCompletion, rule: "ns/route/rule/0", name: "team"}
+	require.Equal(t, "a", m.admit(team, "a", 2))
+	require.Equal(t, "b", m.admit(team, "b", 2))
+	require.Equal(t, metricAttributeOtherValue, m.admit(team, "c", 2))
+	// The values seen before are still recorded after the max values is reached.
+	require.Equal(t, "a", m.admit(team, "a", 2))
+	// Each attribute has its own values.
+	require.Equal(t, "c", m.admit(metricAttributeKey{metric: team.metric, rule: team.rule, name: "user"}, "c", 2))
+	// The attributes of the same name have their own values in each route rule and metric.
+	require.Equal(t, "c", m.admit(metricAttributeKey{metric: team.metric, rule: "ns/route/rule/1", name: "team"}, "c", 2))
+	require.Equal(t, "c", m.admit(metricAttributeKey{metric: metricAttributesEmbeddings, rule: team.rule, name: "team"}, "c", 2))
+}
+
+func Test_guardMetricAttributeValue(t *testing.T) {
+	m := newMetricAttributeValues()
+	allowed := &filterapi.MetricAttribute{Name: "team", AllowedValues: []string{"team-a"}, MaxValues: 100}
+	allowedKey := metricAttributeKey{metric: metricAttributesChatCompletion, rule: "ns/route/rule/0", name: "team"}
+	require.Equal(t, "team-a", guardMetricAttributeValue(m, allowedKey, allowed, "team-a"))
+	require.Equal(t, metricAttributeOtherValue, guardMetricAttributeValue(m, allowedKey, allowed, "team-c"))
+
+	hashed := &filterapi.MetricAttribute{Name: "key", MaxValues: 1, Hash: true}
+	hashedKey := metricAttributeKey{metric: metricAttributesChatCompletion, rule: "ns/route/rule/0", name: "key"}
+	require.Equal(t, "8879f6a4ae35c420", guardMetricAttributeValue(m, hashedKey, hashed, "sk-team-a"))
+	require.Equal(t, metricAttributeOtherValue, guardMetricAttributeValue(m, hashedKey, hashed, "sk-team-b"))
+}
+
+func Test_routeMetricAttributes(t *testing.T) {
+	config := newTestRuleConfig(t, metricAttributesTestRule())
+	headers := map[string]string{"x-team-id": "team-a"}
+	require.Nil(t, routeMetricAttributes(t.Context(), config, metricAttributesChatCompletion, "llama", headers))
+	require.Equal(t, []attribute.KeyValue{attribute.String("ai_gateway.team", "team-a")},
+		routeMetricAttributes(t.Context(), config, metricAttributesChatCompletion, "gpt", headers))
+	// The header name is case-insensitive while the request headers are lower-cased.
+	config.rulesByModel["gpt"].MetricAttributes[0].Header = "X-Team-ID"
+	require.Equal(t, []attribute.KeyValue{attribute.String("ai_gateway.team", "team-a")},
+		routeMetricAttributes(t.Context(), config, metricAttributesChatCompletion, "gpt", headers))
+
+	ctx := withRequestMetadata(t.Context(), newJWTMetadata(t, map[string]any{"sub": "alice"}))
+	require.Equal(t, []attribute.KeyValue{
+		attribute.String("ai_gateway.team", "_OTHER"),
+		attribute.String("ai_gateway.user", "2bd806c97f0e00af"),
+	}, routeMetricAttributes(ctx, config, metricAttributesChatCompletion, "gpt", map[string]string{"x-team-id": "team-c"}))
+
+	// The numbers are recorded as they are, while the other types are ignored.
+	require.Equal(t, "42", requestMetadataValue(withRequestMetadata(t.Context(), newJWTMetadata(t, map[string]any{"sub": 42})),
+		"envoy.filters.http.jwt_authn", "sub"))
+	require.Empty(t, requestMetadataValue(withRequestMetadata(t.Context(), newJWTMetadata(t, map[string]any{"sub": true})),
+		"envoy.filters.http.jwt_authn", "sub"))
+	require.Empty(t, requestMetadataValue(t.Context(), "envoy.filters.http.jwt_authn", "sub"))
+
+	// The max values of the attribute is not shared with the other route rules having the attribute of the same name.
+	rule := metricAttributesTestRule()
+	rule.MetricAttributes[0].AllowedValues, rule.MetricAttributes[0].MaxValues = nil, 1
+	other := rule
+	other.Name, other.Models = "ns/route/rule/1", []string{"llama"}
+	config = newTestConfig(t, &filterapi.Config{Rules: []filterapi.RouteRule{rule, other}})
+	require.Equal(t, []attribute.KeyValue{attribute.String("ai_gateway.team", "team-a")},
+		routeMetricAttributes(t.Context(), config, metricAttributesChatCompletion, "gpt", headers))
+	require.Equal(t, []attribute.KeyValue{attribute.String("ai_gateway.team", "team-b")},
+		routeMetricAttributes(t.Context(), config, metricAttributesChatCompletion, "llama", map[string]string{"x-team-id": "team-b"}))
+	require.Equal(t, []attribute.KeyValue{attribute.String("ai_gateway.team", "_OTHER")},
+		routeMetricAttributes(t.Context(), config, metricAttributesChatCompletion, "gpt", map[string]string{"x-team-id": "team-b"}))
+	// Nor with the other metrics.
+	require.Equal(t, []attribute.KeyValue{attribute.String("ai_gateway.team", "team-b")},
+		routeMetricAttributes(t.Context(), config, metricAttributesEmbeddings, "gpt", map[string]string{"x-team-id": "team-b"}))
+}
+
+func Test_chatCompletionProcessor_metricAttributes(t *testing.T) {
+	config := newTestRuleConfig(t, metricAttributesTestRule())
+	rp := &chatCompletionProcessorRouterFilter{
+		config:         config,
+		logger:         slog.Default(),
+		requestHeaders: map[string]string{":path": "/v1/chat/completions", "x-team-id": "team-b"},
+	}
+	_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: bodyFromModel(t, "gpt", false)})
+	require.NoError(t, err)
+
+	up := &chatCompletionProcessorUpstreamFilter{
+		config: config, logger: slog.Default(), metrics: &mockChatCompletionMetrics{}, requestHeaders: rp.requestHeaders,
+	}
+	require.NoError(t, up.SetBackend(t.Context(), &filterapi.Backend{
+		Name:   "backend",
+		Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+	}, nil, rp))
+	require.Equal(t, []attribute.KeyValue{attribute.String("ai_gateway.team", "team-b")}, up.metricAttrs)
+}
+
+func Test_embeddingsProcessor_metricAttributes(t *testing.T) {
+	config := newTestRuleConfig(t, metricAttributesTestRule())
+	rp := &embeddingsProcessorRouterFilter{
+		config:         config,
+		logger:         slog.Default(),
+		requestHeaders: map[string]string{":path": "/v1/embeddings"},
+	}
+	ctx := withRequestMetadata(t.Context(), newJWTMetadata(t, map[string]any{"sub": "alice"}))
+	_, err := rp.ProcessRequestBody(ctx, &extprocv3.HttpBody{Body: []byte(`{"model":"gpt","input":"hello"}`)})
+	require.NoError(t, err)
+
+	up := &embeddingsProcessorUpstreamFilter{
+		config: config, logger: slog.Default(), metrics: &mockEmbeddingsMetrics{}, requestHeaders: rp.requestHeaders,
+	}
+	require.NoError(t, up.SetBackend(t.Context(), &filterapi.Backend{
+		Name:   "backend",
+		Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+	}, nil, rp))
+	require.Equal(t, []attribute.KeyValue{attribute.String("ai_gateway.user", "2bd806c97f0e00af")}, up.metricAttrs)
+}
@@ -7,6 +7,7 @@ package extproc
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"testing"
@@ -19,10 +20,11 @@ import (
 	"google.golang.org/grpc/metadata"
 
 	"github.com/envoyproxy/ai-gateway/filterapi"
-	"github.com/envoyproxy/ai-gateway/filterapi/x"
 	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
 	"github.com/envoyproxy/ai-gateway/internal/extproc/backendauth"
 	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+	"slices"
 )
 
 var (
@@ -159,8 +161,76 @@ func (m mockExternalProcessingStream) RecvMsg(any) error { panic("TODO") }
 
 var _ extprocv3.ExternalProcessor_ProcessServer = &mockExternalProcessingStream{}
 
+// mockConcurrencyQueueMetrics implements [metrics.ConcurrencyQueueMetrics] for testing.
+type mockConcurrencyQueueMetrics struct {
+	// queueDepth is the sum of the recorded deltas of the queue depth.
+	queueDepth int64
+	// queueWaits is the list of the recorded queue waits, true if admitted.
+	queueWaits []bool
+}
+
+// AddConcurrencyQueueDepth implements [metrics.ConcurrencyQueueMetrics].
+func (m *mockConcurrencyQueueMetrics) AddConcurrencyQueueDepth(_ context.Context, _ string, delta int64) {
+	m.queueDepth += delta
+}
+
+// RecordConcurrencyQueueWait implements [metrics.ConcurrencyQueueMetrics].
+func (m *mockConcurrencyQueueMetrics) RecordConcurrencyQueueWait(_ context.Context, _ string, _ time.Duration, admitted bool) {
+	m.queueWaits = append(m.queueWaits, admitted)
+}
+
+// mockCostMetrics implements [metrics.CostMetrics] for testing.
+type mockCostMetrics struct {
+	// costs is the list of the recorded costs in micro-USD.
+	costs []uint64
+}
+
+// RecordCost implements [metrics.CostMetrics].
+func (m *mockCostMetrics) RecordCost(_ context.Context, costMicroUSD uint64, _ ...attribute.KeyValue) {
+	m.costs = append(m.costs, costMicroUSD)
+}
+
+// mockGuardrailMetrics implements [metrics.GuardrailMetrics] for testing.
+type mockGuardrailMetrics struct {
+	// detections is the number of the recorded detections keyed by "guardrail/detector/action".
+	detections map[string]int
+}
+
+// RecordGuardrailDetections implements [metrics.GuardrailMetrics].
+func (m *mockGuardrailMetrics) RecordGuardrailDetections(_ context.Context, guardrail, detector, action string, count int, _ ...attribute.KeyValue) {
+	if m.detections == nil {
+		m.detections = map[string]int{}
+	}
+	m.detections[guardrail+"/"+detector+"/"+action] += count
+}
+
+// mockResponseCacheMetrics implements [metrics.ResponseCacheMetrics] for testing.
+type mockResponseCacheMetrics struct {
+	// responseCacheLookups is the number of the recorded lookups keyed by "cache/hit".
+	responseCacheLookups map[string]int
+	// responseCacheSimilarities is the recorded similarities of the semantic cache.
+	responseCacheSimilarities []float64
+}
+
+// RecordResponseCacheLookups implements [metrics.ResponseCacheMetrics].
+func (m *mockResponseCacheMetrics) RecordResponseCacheLookups(_ context.Context, cache string, hit bool, count int, _ ...attribute.KeyValue) {
+	if m.responseCacheLookups == nil {
+		m.responseCacheLookups = map[string]int{}
+	}
+	m.responseCacheLookups[fmt.Sprintf("%s/%v", cache, hit)] += count
+}
+
+// RecordResponseCacheSimilarity implements [metrics.ResponseCacheMetrics].
+func (m *mockResponseCacheMetrics) RecordResponseCacheSimilarity(_ context.Context, similarity float64, _ ...attribute.KeyValue) {
+	m.responseCacheSimilarities = append(m.responseCacheSimilarities, similarity)
+}
+
 // mockChatCompletionMetrics implements [metrics.ChatCompletion] for testing.
 type mockChatCompletionMetrics struct {
+	mockConcurrencyQueueMetrics
+	mockCostMetrics
+	mockGuardrailMetrics
+	mockResponseCacheMetrics
 	requestStart        time.Time
 	model               string
 	backend             string
@@ -170,6 +240,17 @@ type mockChatCompletionMetrics struct {
 	tokenLatencyCount   int
 	timeToFirstToken    float64
 	interTokenLatency   float64
+	// prefixCacheAffinityHits and prefixCacheAffinityMisses are the number of recorded prefix cache affinity hits and misses.
+	prefixCacheAffinityHits   int
+	prefixCacheAffinityMisses int
+	// shadowComparisons is the list of the recorded pairs of primary and shadow results.
+	shadowComparisons [][2]*metrics.ShadowResult
+	// tokenUsageAttrs is the extra attributes of the last recorded token usage.
+	tokenUsageAttrs []attribute.KeyValue
+	// hedgedAttempts is the sum of the recorded hedged attempts.
+	hedgedAttempts int
+	// hedgedInputTokens is the sum of the input tokens recorded with the attribute of the hedged attempts.
+	hedgedInputTokens uint32
 }
 
 // StartRequest implements [metrics.ChatCompletion].
@@ -182,8 +263,13 @@ func (m *mockChatCompletionMetrics) SetModel(model string) { m.model = model }
 func (m *mockChatCompletionMetrics) SetBackend(backend *filterapi.Backend) { m.backend = backend.Name }
 
 // RecordTokenUsage implements [metrics.ChatCompletion].
-func (m *mockChatCompletionMetrics) RecordTokenUsage(_ context.Context, _, _, _ uint32, _ ...attribute.KeyValue) {
+func (m *mockChatCompletionMetrics) RecordTokenUsage(_ context.Context, inputTokens, _, _ uint32, extraAttrs ...attribute.KeyValue) {
+	if slices.Contains(extraAttrs, hedgedAttemptAttribute) {
+		m.hedgedInputTokens += inputTokens
+		return
+	}
 	m.tokenUsageCount++
+	m.tokenUsageAttrs = extraAttrs
 }
 
 // RecordTokenLatency implements [metrics.ChatCompletion].
@@ -191,6 +277,25 @@ func (m *mockChatCompletionMetrics) RecordTokenLatency(_ context.Context, _ uint
 	m.tokenLatencyCount++
 }
 
+// RecordPrefixCacheAffinity implements [metrics.ChatCompletion].
+func (m *mockChatCompletionMetrics) RecordPrefixCacheAffinity(_ context.Context, hit bool, _ ...attribute.KeyValue) {
+	if hit {
+		m.prefixCacheAffinityHits++
+	} else {
+		m.prefixCacheAffinityMisses++
+	}
+}
+
+// RecordHedgedAttempts implements [metrics.ChatCompletion].
+func (m *mockChatCompletionMetrics) RecordHedgedAttempts(_ context.Context, attempts int, _ ...attribute.KeyValue) {
+	m.hedgedAttempts += attempts
+}
+
+// RecordShadowComparison implements [metrics.ChatCompletion].
+func (m *mockChatCompletionMetrics) RecordShadowComparison(_ context.Context, _ string, primary, shadow *metrics.ShadowResult, _ ...attribute.KeyValue) {
+	m.shadowComparisons = append(m.shadowComparisons, [2]*metrics.ShadowResult{primary, shadow})
+}
+
 // GetTimeToFirstTokenMs implements [metrics.ChatCompletion].
 func (m *mockChatCompletionMetrics) GetTimeToFirstTokenMs() float64 {
 	m.timeToFirstToken = 1.0
@@ -246,7 +351,7 @@ func (m *mockChatCompletionMetrics) RequireTokensRecorded(t *testing.T, count in
 	require.Equal(t, count, m.tokenLatencyCount)
 }
 
-var _ x.ChatCompletionMetrics = &mockChatCompletionMetrics{}
+var _ metrics.ChatCompletionMetrics = &mockChatCompletionMetrics{}
 
 // mockEmbeddingTranslator implements [translator.OpenAIEmbeddingTranslator] for testing.
 type mockEmbeddingTranslator struct {
@@ -282,8 +387,12 @@ func (m mockEmbeddingTranslator) ResponseBody(_ map[string]string, body io.Reade
 	return m.retHeaderMutation, m.retBodyMutation, m.retUsedToken, m.retErr
 }
 
-// mockEmbeddingsMetrics implements [x.EmbeddingsMetrics] for testing.
+// mockEmbeddingsMetrics implements [metrics.EmbeddingsMetrics] for testing.
 type mockEmbeddingsMetrics struct {
+	mockConcurrencyQueueMetrics
+	mockCostMetrics
+	mockGuardrailMetrics
+	mockResponseCacheMetrics
 	requestStart        time.Time
 	model               string
 	backend             string
@@ -292,21 +401,21 @@ type mockEmbeddingsMetrics struct {
 	tokenUsageCount     int
 }
 
-// StartRequest implements [x.EmbeddingsMetrics].
+// StartRequest implements [metrics.EmbeddingsMetrics].
 func (m *mockEmbeddingsMetrics) StartRequest(_ map[string]string) { m.requestStart = time.Now() }
 
-// SetModel implements [x.EmbeddingsMetrics].
+// SetModel implements [metrics.EmbeddingsMetrics].
 func (m *mockEmbeddingsMetrics) SetModel(model string) { m.model = model }
 
-// SetBackend implements [x.EmbeddingsMetrics].
+// SetBackend implements [metrics.EmbeddingsMetrics].
 func (m *mockEmbeddingsMetrics) SetBackend(backend *filterapi.Backend) { m.backend = backend.Name }
 
-// RecordTokenUsage implements [x.EmbeddingsMetrics].
+// RecordTokenUsage implements [metrics.EmbeddingsMetrics].
 func (m *mockEmbeddingsMetrics) RecordTokenUsage(_ context.Context, _, _ uint32, _ ...attribute.KeyValue) {
 	m.tokenUsageCount++
 }
 
-// RecordRequestCompletion implements [x.EmbeddingsMetrics].
+// RecordRequestCompletion implements [metrics.EmbeddingsMetrics].
 func (m *mockEmbeddingsMetrics) RecordRequestCompletion(_ context.Context, success bool, _ ...attribute.KeyValue) {
 	if success {
 		m.requestSuccessCount++
@@ -348,4 +457,4 @@ func (m *mockEmbeddingsMetrics) RequireTokensRecorded(t *testing.T, count int) {
 	require.Equal(t, count, m.tokenUsageCount)
 }
 
-var _ x.EmbeddingsMetrics = &mockEmbeddingsMetrics{}
+var _ metrics.EmbeddingsMetrics = &mockEmbeddingsMetrics{}
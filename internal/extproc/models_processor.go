@@ -11,12 +11,14 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"google.golang.org/grpc/codes"
 
+	"github.com/envoyproxy/ai-gateway/filterapi"
 	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
 )
 
@@ -27,37 +29,60 @@ import (
 // Processor are not implemented. Those should never be called.
 type modelsProcessor struct {
 	passThroughProcessor
-	logger *slog.Logger
-	models openai.ModelList
+	config         *processorConfig
+	requestHeaders map[string]string
+	logger         *slog.Logger
+	// key is the ConsumerKey authenticating the request, if any.
+	key *filterapi.ConsumerKey
+	// rejected is the local reply rejecting the request without the valid consumer key, if any.
+	rejected *extprocv3.ProcessingResponse
 }
 
 var _ Processor = (*modelsProcessor)(nil)
 
 // NewModelsProcessor creates a new processor that returns the list of declared models.
-func NewModelsProcessor(config *processorConfig, _ map[string]string, logger *slog.Logger, isUpstreamFilter bool) (Processor, error) {
+// When the consumer keys or the authorization of the routes are configured, only the models allowed for the
+// caller of the request are listed.
+func NewModelsProcessor(config *processorConfig, requestHeaders map[string]string, logger *slog.Logger, isUpstreamFilter bool) (Processor, error) {
 	if isUpstreamFilter {
 		return passThroughProcessor{}, nil
 	}
+	key, rejected := authenticateConsumerKey(config, requestHeaders, time.Now())
+	return &modelsProcessor{config: config, requestHeaders: requestHeaders, logger: logger, key: key, rejected: rejected}, nil
+}
+
+// allowedModels returns the list of the declared models allowed for the caller of the request. The context carries
+// the dynamic metadata of the request, from which the JWT claims of the authorization are read.
+func (m *modelsProcessor) allowedModels(ctx context.Context) openai.ModelList {
 	models := openai.ModelList{
 		Object: "list",
-		Data:   make([]openai.Model, 0, len(config.declaredModels)),
+		Data:   make([]openai.Model, 0, len(m.config.declaredModels)),
 	}
-	for _, m := range config.declaredModels {
+	for _, d := range m.config.declaredModels {
+		if m.key != nil && !consumerKeyAllowsModel(m.config, m.key, d.Name) {
+			continue
+		}
+		if !callerAllowsModel(ctx, m.config, d.Name) {
+			continue
+		}
 		models.Data = append(models.Data, openai.Model{
-			ID:      m.Name,
+			ID:      d.Name,
 			Object:  "model",
-			OwnedBy: m.OwnedBy,
-			Created: openai.JSONUNIXTime(m.CreatedAt),
+			OwnedBy: d.OwnedBy,
+			Created: openai.JSONUNIXTime(d.CreatedAt),
 		})
 	}
-	return &modelsProcessor{logger: logger, models: models}, nil
+	return models
 }
 
 // ProcessRequestHeaders implements [Processor.ProcessRequestHeaders].
-func (m *modelsProcessor) ProcessRequestHeaders(_ context.Context, _ *corev3.HeaderMap) (*extprocv3.ProcessingResponse, error) {
+func (m *modelsProcessor) ProcessRequestHeaders(ctx context.Context, _ *corev3.HeaderMap) (*extprocv3.ProcessingResponse, error) {
+	if m.rejected != nil {
+		return m.rejected, nil
+	}
 	m.logger.Info("Serving list of declared models")
 
-	body, err := json.Marshal(m.models)
+	body, err := json.Marshal(m.allowedModels(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal body: %w", err)
 	}
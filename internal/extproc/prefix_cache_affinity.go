@@ -0,0 +1,109 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"container/list"
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+)
+
+// prefixCacheAffinityKey returns the hash key of the prompt prefix of the given request, which consists of
+// all the system and developer messages as well as the given number of the leading other messages. This returns
+// the empty key if the prefix has no message, e.g., the leading messages is zero and the request has no system
+// prompt, since all such requests would otherwise be sent to the same replica.
+//
+// The key is used by Envoy to select the endpoint with the consistent hashing, so that the requests sharing
+// the same conversation prefix are sent to the same replica of the inference server to maximize the KV-cache hit rate.
+func prefixCacheAffinityKey(body *openai.ChatCompletionRequest, leadingMessages int) (string, error) {
+	h := fnv.New64a()
+	hashed := false
+	for i := range body.Messages {
+		msg := &body.Messages[i]
+		switch msg.Type {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleDeveloper:
+		default:
+			if leadingMessages <= 0 {
+				continue
+			}
+			leadingMessages--
+		}
+		raw, err := json.Marshal(msg.Value)
+		if err != nil {
+			return "", err
+		}
+		_, _ = h.Write([]byte(msg.Type))
+		_, _ = h.Write(raw)
+		// Separate the messages so that the different splits of the same content do not collide.
+		_, _ = h.Write([]byte{0})
+		hashed = true
+	}
+	if !hashed {
+		return "", nil
+	}
+	return strconv.FormatUint(h.Sum64(), 16), nil
+}
+
+// prefixCacheAffinityTrackerSize is the maximum number of the prompt prefixes tracked by the prefixCacheAffinityTracker.
+const prefixCacheAffinityTrackerSize = 10000
+
+// upstreamAddressSetter is implemented by the upstream filters which need the address of the selected upstream host.
+type upstreamAddressSetter interface {
+	// setUpstreamAddress sets the address of the upstream host selected by Envoy. This is called before SetBackend.
+	setUpstreamAddress(address string)
+}
+
+// prefixCacheAffinityTracker tracks the upstream host which the latest request with each prompt prefix was sent to,
+// in order to measure the affinity hit ratio. The least recently used prefixes are evicted when it's full.
+//
+// This is shared across all requests, so this is safe for concurrent use.
+type prefixCacheAffinityTracker struct {
+	mu      sync.Mutex
+	maxSize int
+	// lru is the list of *prefixCacheAffinityEntry where the front is the most recently used.
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type prefixCacheAffinityEntry struct {
+	key, address string
+}
+
+// newPrefixCacheAffinityTracker creates a new prefixCacheAffinityTracker tracking at most maxSize prefixes.
+func newPrefixCacheAffinityTracker(maxSize int) *prefixCacheAffinityTracker {
+	return &prefixCacheAffinityTracker{
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// observe records that the request with the given prefix key is sent to the given address.
+//
+// This returns seen=true if the prefix has been observed before, in which case hit is true if the previous
+// request with the same prefix was sent to the same address.
+func (p *prefixCacheAffinityTracker) observe(key, address string) (hit, seen bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if elem, ok := p.entries[key]; ok {
+		entry := elem.Value.(*prefixCacheAffinityEntry)
+		hit = entry.address == address
+		entry.address = address
+		p.lru.MoveToFront(elem)
+		return hit, true
+	}
+	if p.lru.Len() >= p.maxSize {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.entries, oldest.Value.(*prefixCacheAffinityEntry).key)
+	}
+	p.entries[key] = p.lru.PushFront(&prefixCacheAffinityEntry{key: key, address: address})
+	return false, false
+}
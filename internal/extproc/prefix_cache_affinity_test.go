@@ -0,0 +1,127 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+)
+
+func Test_prefixCacheAffinityKey(t *testing.T) {
+	parse := func(messages string) *openai.ChatCompletionRequest {
+		var body openai.ChatCompletionRequest
+		require.NoError(t, json.Unmarshal([]byte(`{"model":"m","messages":`+messages+`}`), &body))
+		return &body
+	}
+	key := func(messages string, leadingMessages int) string {
+		k, err := prefixCacheAffinityKey(parse(messages), leadingMessages)
+		require.NoError(t, err)
+		return k
+	}
+
+	base := key(`[{"role":"system","content":"be nice"},{"role":"user","content":"hi"}]`, 1)
+	require.NotEmpty(t, base)
+	// The trailing messages beyond the leading ones do not affect the key.
+	require.Equal(t, base, key(`[{"role":"system","content":"be nice"},{"role":"user","content":"hi"},
+{"role":"assistant","content":"hello"},{"role":"user","content":"how are you?"}]`, 1))
+	// Different system prompt results in a different key.
+	require.NotEqual(t, base, key(`[{"role":"system","content":"be rude"},{"role":"user","content":"hi"}]`, 1))
+	// Different leading message results in a different key.
+	require.NotEqual(t, base, key(`[{"role":"system","content":"be nice"},{"role":"user","content":"bye"}]`, 1))
+	// Only the system prompt is hashed with zero leading messages.
+	require.Equal(t,
+		key(`[{"role":"system","content":"be nice"},{"role":"user","content":"bye"}]`, 0),
+		key(`[{"role":"system","content":"be nice"},{"role":"user","content":"hi"}]`, 0),
+	)
+	// Nothing is hashed without the system prompt and the leading messages, so there is no key.
+	require.Empty(t, key(`[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}]`, 0))
+	require.Empty(t, key(`[]`, 1))
+}
+
+func Test_prefixCacheAffinityTracker(t *testing.T) {
+	p := newPrefixCacheAffinityTracker(2)
+
+	hit, seen := p.observe("a", "10.0.0.1:8000")
+	require.False(t, hit)
+	require.False(t, seen)
+	hit, seen = p.observe("a", "10.0.0.1:8000")
+	require.True(t, hit)
+	require.True(t, seen)
+	hit, seen = p.observe("a", "10.0.0.2:8000")
+	require.False(t, hit)
+	require.True(t, seen)
+
+	// "b" and "c" are added, so "a", which is the least recently used, is evicted.
+	_, _ = p.observe("b", "10.0.0.1:8000")
+	_, _ = p.observe("c", "10.0.0.1:8000")
+	require.Len(t, p.entries, 2)
+	_, seen = p.observe("a", "10.0.0.2:8000")
+	require.False(t, seen)
+}
+
+func Test_chatCompletionProcessor_prefixCacheAffinity(t *testing.T) {
+	rule := &filterapi.RouteRule{
+		Name:                "ns/route1/rule/0",
+		Models:              []string{"some-model"},
+		PrefixCacheAffinity: &filterapi.PrefixCacheAffinity{LeadingMessages: 1},
+	}
+	config := &processorConfig{
+		modelNameHeaderKey: "x-ai-eg-model",
+		rulesByModel:       map[string]*filterapi.RouteRule{"some-model": rule},
+	}
+	rp := &chatCompletionProcessorRouterFilter{
+		config:         config,
+		requestHeaders: map[string]string{":path": "/v1/chat/completions"},
+		logger:         slog.Default(),
+	}
+	resp, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{
+		Body: []byte(`{"model":"some-model","messages":[{"role":"system","content":"be nice"},{"role":"user","content":"hi"}]}`),
+	})
+	require.NoError(t, err)
+	setHeaders := resp.GetRequestBody().GetResponse().GetHeaderMutation().SetHeaders
+	require.Len(t, setHeaders, 3)
+	require.Equal(t, internalapi.PrefixCacheAffinityKeyHeader, setHeaders[2].Header.Key)
+	require.Equal(t, rp.prefixCacheAffinityKey, string(setHeaders[2].Header.RawValue))
+	require.NotEmpty(t, rp.prefixCacheAffinityKey)
+
+	mm := &mockChatCompletionMetrics{}
+	affinity := newPrefixCacheAffinityTracker(10)
+	for _, address := range []string{"10.0.0.1:8000", "10.0.0.1:8000", "10.0.0.2:8000"} {
+		u := &chatCompletionProcessorUpstreamFilter{config: config, metrics: mm, affinity: affinity}
+		u.setUpstreamAddress(address)
+		err = u.SetBackend(t.Context(), &filterapi.Backend{
+			Name:   "some-backend",
+			Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+		}, nil, rp)
+		require.NoError(t, err)
+	}
+	// The first request is not recorded as the prefix has not been seen before.
+	require.Equal(t, 1, mm.prefixCacheAffinityHits)
+	require.Equal(t, 1, mm.prefixCacheAffinityMisses)
+
+	// The header is not set when there is no prefix to hash, so that Envoy does not send all such requests to
+	// the same endpoint.
+	rule.PrefixCacheAffinity.LeadingMessages = 0
+	rp = &chatCompletionProcessorRouterFilter{
+		config:         config,
+		requestHeaders: map[string]string{":path": "/v1/chat/completions"},
+		logger:         slog.Default(),
+	}
+	resp, err = rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{
+		Body: []byte(`{"model":"some-model","messages":[{"role":"user","content":"hi"}]}`),
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.GetRequestBody().GetResponse().GetHeaderMutation().SetHeaders, 2)
+	require.Empty(t, rp.prefixCacheAffinityKey)
+}
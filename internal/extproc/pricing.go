@@ -0,0 +1,142 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/llmcostcel"
+)
+
+// costMicroUSDMetadataKey is the key of the dynamic metadata for the cost of the request in micro-USD computed from
+// the pricing catalog.
+const costMicroUSDMetadataKey = "cost_micro_usd"
+
+// wavHeaderPeekSize is the number of the base64 characters decoded to find the header of the WAV audio, which is
+// enough for the RIFF header followed by the fmt chunk and a few metadata chunks.
+const wavHeaderPeekSize = 4096
+
+// mediaUsage is the usage of the non-text inputs of the request, which are charged separately from the tokens.
+type mediaUsage struct {
+	// images is the number of the images in the request.
+	images uint32
+	// audioSeconds is the total duration of the audio in the request. Only the WAV audio is counted.
+	audioSeconds float64
+}
+
+// findModelPrice returns the price of the model for the backend, or nil if the model has no price. The price for
+// the backend takes precedence over the one for all the backends.
+func findModelPrice(config *processorConfig, model, backendName string) *filterapi.ModelPrice {
+	var ret *filterapi.ModelPrice
+	for i := range config.prices {
+		p := &config.prices[i]
+		if p.Model != model {
+			continue
+		}
+		if len(p.Backends) == 0 {
+			if ret == nil {
+				ret = p
+			}
+		} else if slices.Contains(p.Backends, backendName) {
+			return p
+		}
+	}
+	return ret
+}
+
+// computePricing computes the cost of the request from the price and the usage. This returns nil if price is nil.
+func computePricing(price *filterapi.ModelPrice, costs *translator.LLMTokenUsage, media mediaUsage) *llmcostcel.Pricing {
+	if price == nil {
+		return nil
+	}
+	cachedInput := min(costs.CachedInputTokens, costs.InputTokens)
+	reasoning := min(costs.ReasoningTokens, costs.OutputTokens)
+	cost := float64(costs.InputTokens-cachedInput)*price.InputToken +
+		float64(cachedInput)*price.CachedInputToken +
+		float64(costs.OutputTokens-reasoning)*price.OutputToken +
+		float64(reasoning)*price.ReasoningToken +
+		float64(media.images)*price.Image +
+		media.audioSeconds*price.AudioSecond
+	return &llmcostcel.Pricing{
+		CostMicroUSD:          uint64(math.Round(cost)),
+		InputTokenPrice:       price.InputToken,
+		OutputTokenPrice:      price.OutputToken,
+		CachedInputTokenPrice: price.CachedInputToken,
+		ReasoningTokenPrice:   price.ReasoningToken,
+	}
+}
+
+// countChatCompletionMedia counts the images and the duration of the audio in the user messages of the request.
+func countChatCompletionMedia(body *openai.ChatCompletionRequest) (ret mediaUsage) {
+	for i := range body.Messages {
+		m, ok := body.Messages[i].Value.(openai.ChatCompletionUserMessageParam)
+		if !ok {
+			continue
+		}
+		parts, ok := m.Content.Value.([]openai.ChatCompletionContentPartUserUnionParam)
+		if !ok {
+			continue
+		}
+		for j := range parts {
+			switch {
+			case parts[j].ImageContent != nil:
+				ret.images++
+			case parts[j].InputAudioContent != nil:
+				audio := &parts[j].InputAudioContent.InputAudio
+				if strings.EqualFold(string(audio.Format), string(openai.ChatCompletionContentPartInputAudioInputAudioFormatWAV)) {
+					ret.audioSeconds += wavDurationSeconds(audio.Data)
+				}
+			}
+		}
+	}
+	return
+}
+
+// wavDurationSeconds returns the duration of the base64 encoded WAV audio from the byte rate in the fmt chunk and
+// the size of the data chunk. This returns zero if the audio is malformed.
+//
+// Only the beginning of the audio is decoded since the size of the whole audio is known from the length of the
+// base64 string.
+func wavDurationSeconds(data string) float64 {
+	peek := data[:min(len(data), wavHeaderPeekSize)]
+	header, err := base64.StdEncoding.DecodeString(peek)
+	if err != nil {
+		return 0
+	}
+	if len(header) < 12 || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return 0
+	}
+	total := base64.StdEncoding.DecodedLen(len(data)) - strings.Count(data[max(0, len(data)-2):], "=")
+	var byteRate uint32
+	for off := 12; off+8 <= len(header); {
+		id, size := string(header[off:off+4]), binary.LittleEndian.Uint32(header[off+4:off+8])
+		off += 8
+		switch id {
+		case "fmt ":
+			if off+12 > len(header) {
+				return 0
+			}
+			byteRate = binary.LittleEndian.Uint32(header[off+8 : off+12])
+		case "data":
+			if byteRate == 0 {
+				return 0
+			}
+			// The size of the data chunk is not reliable for the streamed audio, so it is bounded by the actual size.
+			dataSize := min(int64(size), int64(total-off))
+			return float64(dataSize) / float64(byteRate)
+		}
+		// The chunks are aligned to the even size.
+		off += int(size) + int(size&1)
+	}
+	return 0
+}
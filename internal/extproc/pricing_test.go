@@ -0,0 +1,151 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/llmcostcel"
+)
+
+// newTestWAV returns the base64 encoded WAV audio of the given duration with 16kHz 16-bit mono samples.
+func newTestWAV(seconds float64) string {
+	const byteRate = 16000 * 2
+	dataSize := uint32(seconds * byteRate)
+	b := make([]byte, 0, 44+dataSize)
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, 36+dataSize)
+	b = append(b, "WAVE"...)
+	b = append(b, "fmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1)     // PCM.
+	b = binary.LittleEndian.AppendUint16(b, 1)     // Mono.
+	b = binary.LittleEndian.AppendUint32(b, 16000) // Sample rate.
+	b = binary.LittleEndian.AppendUint32(b, byteRate)
+	b = binary.LittleEndian.AppendUint16(b, 2)  // Block align.
+	b = binary.LittleEndian.AppendUint16(b, 16) // Bits per sample.
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, dataSize)
+	b = append(b, make([]byte, dataSize)...)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func Test_findModelPrice(t *testing.T) {
+	config := &processorConfig{prices: []filterapi.ModelPrice{
+		{Model: "gpt-4o", InputToken: 2.5},
+		{Model: "gpt-4o", InputToken: 5},
+		{Model: "gpt-4o", Backends: []string{"azure"}, InputToken: 2},
+		{Model: "o3", Backends: []string{"openai"}, InputToken: 1},
+	}}
+	require.Equal(t, 2.5, findModelPrice(config, "gpt-4o", "openai").InputToken)
+	require.Equal(t, 2.0, findModelPrice(config, "gpt-4o", "azure").InputToken)
+	require.Equal(t, 1.0, findModelPrice(config, "o3", "openai").InputToken)
+	require.Nil(t, findModelPrice(config, "o3", "azure"))
+	require.Nil(t, findModelPrice(config, "unknown", "openai"))
+}
+
+func Test_computePricing(t *testing.T) {
+	require.Nil(t, computePricing(nil, &translator.LLMTokenUsage{InputTokens: 100}, mediaUsage{}))
+
+	price := &filterapi.ModelPrice{
+		InputToken: 2.5, OutputToken: 10, CachedInputToken: 1.25, ReasoningToken: 20,
+		Image: 1000, AudioSecond: 100,
+	}
+	costs := &translator.LLMTokenUsage{InputTokens: 1000, OutputTokens: 200, CachedInputTokens: 400, ReasoningTokens: 50}
+	p := computePricing(price, costs, mediaUsage{images: 2, audioSeconds: 1.5})
+	// 600 * 2.5 + 400 * 1.25 + 150 * 10 + 50 * 20 + 2 * 1000 + 1.5 * 100.
+	require.Equal(t, &llmcostcel.Pricing{
+		CostMicroUSD:    6650,
+		InputTokenPrice: 2.5, OutputTokenPrice: 10, CachedInputTokenPrice: 1.25, ReasoningTokenPrice: 20,
+	}, p)
+
+	t.Run("details exceeding the total", func(t *testing.T) {
+		p = computePricing(price, &translator.LLMTokenUsage{InputTokens: 10, CachedInputTokens: 20}, mediaUsage{})
+		require.Equal(t, uint64(13), p.CostMicroUSD)
+	})
+}
+
+func Test_countChatCompletionMedia(t *testing.T) {
+	var body openai.ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "model": "gpt-4o-audio-preview",
+  "messages": [
+    {"role": "system", "content": "you are helpful"},
+    {"role": "user", "content": [
+      {"type": "text", "text": "what are these"},
+      {"type": "image_url", "image_url": {"url": "https://example.com/a.png"}},
+      {"type": "image_url", "image_url": {"url": "https://example.com/b.png"}},
+      {"type": "input_audio", "input_audio": {"data": "`+newTestWAV(2)+`", "format": "wav"}},
+      {"type": "input_audio", "input_audio": {"data": "AAAA", "format": "mp3"}}
+    ]},
+    {"role": "user", "content": "and this"}
+  ]
+}`), &body))
+	m := countChatCompletionMedia(&body)
+	require.Equal(t, uint32(2), m.images)
+	require.InDelta(t, 2.0, m.audioSeconds, 1e-9)
+}
+
+func Test_wavDurationSeconds(t *testing.T) {
+	require.InDelta(t, 0.5, wavDurationSeconds(newTestWAV(0.5)), 1e-9)
+	require.InDelta(t, 10.0, wavDurationSeconds(newTestWAV(10)), 1e-9)
+	require.Zero(t, wavDurationSeconds("not base64"))
+	require.Zero(t, wavDurationSeconds(base64.StdEncoding.EncodeToString([]byte("RIFF\x00\x00\x00\x00WAVEdata\x00\x00\x00\x00"))))
+
+	t.Run("truncated data chunk", func(t *testing.T) {
+		raw, err := base64.StdEncoding.DecodeString(newTestWAV(1))
+		require.NoError(t, err)
+		require.InDelta(t, 0.5, wavDurationSeconds(base64.StdEncoding.EncodeToString(raw[:44+16000])), 1e-9)
+	})
+}
+
+func Test_chatCompletionProcessor_pricing(t *testing.T) {
+	const backendName = "some-backend"
+	config := &processorConfig{
+		modelNameHeaderKey: "x-ai-eg-model",
+		metadataNamespace:  "ai_gateway_llm_ns",
+		backends:           map[string]*processorConfigBackend{backendName: {b: &filterapi.Backend{Name: backendName, Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI}}}},
+		prices:             []filterapi.ModelPrice{{Model: "some-model", InputToken: 2, OutputToken: 8, CachedInputToken: 1, ReasoningToken: 8, Image: 500}},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	rp := &chatCompletionProcessorRouterFilter{
+		config:         config,
+		logger:         logger,
+		requestHeaders: map[string]string{":path": "/v1/chat/completions", "x-ai-eg-model": "some-model"},
+	}
+	_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{
+		Body: []byte(`{"model":"some-model","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), rp.media.images)
+
+	mm := &mockChatCompletionMetrics{}
+	up := &chatCompletionProcessorUpstreamFilter{
+		config:         config,
+		logger:         logger,
+		requestHeaders: rp.requestHeaders,
+		metrics:        mm,
+	}
+	require.NoError(t, up.SetBackend(t.Context(), config.backends[backendName].b, nil, rp))
+	up.translator = &mockTranslator{t: t, retUsedToken: translator.LLMTokenUsage{InputTokens: 100, OutputTokens: 10, TotalTokens: 110, CachedInputTokens: 50}}
+	res, err := up.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{EndOfStream: true})
+	require.NoError(t, err)
+	// 50 * 2 + 50 * 1 + 10 * 8 + 500.
+	ns := res.DynamicMetadata.Fields["ai_gateway_llm_ns"].GetStructValue().Fields
+	require.Equal(t, float64(730), ns[costMicroUSDMetadataKey].GetNumberValue())
+	require.Equal(t, []uint64{730}, mm.costs)
+}
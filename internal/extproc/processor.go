@@ -7,14 +7,23 @@ package extproc
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/google/cel-go/cel"
 
 	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/audit"
 	"github.com/envoyproxy/ai-gateway/internal/extproc/backendauth"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/capture"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/guardrail"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/quota"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/responsecache"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/tokenizer"
 )
 
 // processorConfig is the configuration for the processor.
@@ -27,11 +36,52 @@ type processorConfig struct {
 	requestCosts       []processorConfigRequestCost
 	declaredModels     []filterapi.Model
 	backends           map[string]*processorConfigBackend
+	// rulesByModel maps the model name to the route rule matching on it, which is used to apply the per-rule
+	// configuration at the router filter before the routing decision is made.
+	rulesByModel map[string]*filterapi.RouteRule
+	// quotas is the list of the quota policies enforced at the router filter, and quotaStore is the store of
+	// their counters.
+	quotas     []filterapi.QuotaPolicy
+	quotaStore quota.Store
+	// responseCacheStore is the store of the responses cached by the response caches of the route rules.
+	responseCacheStore responsecache.Store
+	// semanticIndex is the index of the embeddings of the requests cached by the semantic caches of the route rules.
+	semanticIndex *responsecache.SemanticIndex
+	// estimateTokens is true if any of the request costs is estimated before the request is sent upstream.
+	// tokenizers and tokenCalibrator are used for the estimation.
+	estimateTokens  bool
+	tokenizers      *tokenizer.Registry
+	tokenCalibrator *tokenCalibrator
+	// prices are the prices of the models in the pricing catalog, which are used to compute the cost of the requests.
+	prices []filterapi.ModelPrice
+	// consumerKeys maps the hashes of the consumer keys to them. When this is not empty, the requests without
+	// any of the keys are rejected at the router filter.
+	consumerKeys map[string]*filterapi.ConsumerKey
+	// usageLedger is the export of the usage records of the completed requests. This is nil if it is not enabled.
+	usageLedger *usageLedger
+	// guardrails maps the names of the route rules to their guardrails compiled from the configuration.
+	guardrails map[filterapi.RouteRuleName]*routeGuardrails
+	// toolPolicies maps the names of the route rules to their tool policies compiled from the configuration.
+	toolPolicies map[filterapi.RouteRuleName]*guardrail.ToolPolicy
+	// auditLog is the export of the audit records. This is nil if it is not enabled.
+	auditLog *audit.Exporter
+	// traceContent is true if the prompts and the completions are recorded in the spans of the requests.
+	traceContent bool
+	// metricAttributeValues tracks the distinct values of the metric attributes configured on the route rules.
+	metricAttributeValues *metricAttributeValues
+	// capture writes the captures of the requests to the disk. This is nil if the capture is disabled.
+	capture *capture.Writer
 }
 
 type processorConfigBackend struct {
 	b       *filterapi.Backend
 	handler backendauth.Handler
+	// rule is the route rule that this backend belongs to. This can be nil if the rule is not known.
+	rule *filterapi.RouteRule
+	// shadow is true if this is the shadow backend of the rule, which receives the mirrored requests.
+	shadow bool
+	// limiter is the concurrency limiter of the backend. This is nil if the backend has no concurrency limit.
+	limiter *concurrencyLimiter
 }
 
 // processorConfigRequestCost is the configuration for the request cost.
@@ -91,3 +141,71 @@ func (p passThroughProcessor) ProcessResponseBody(context.Context, *extprocv3.Ht
 func (p passThroughProcessor) SetBackend(context.Context, *filterapi.Backend, backendauth.Handler, Processor) error {
 	return nil
 }
+
+// addResponseHeaders adds the headers to the response headers processing response. This is no-op if the response
+// is not the one for the response headers.
+func addResponseHeaders(res *extprocv3.ProcessingResponse, headers ...*corev3.HeaderValueOption) {
+	rh := res.GetResponseHeaders()
+	if rh == nil {
+		return
+	}
+	if rh.Response == nil {
+		rh.Response = &extprocv3.CommonResponse{}
+	}
+	if rh.Response.HeaderMutation == nil {
+		rh.Response.HeaderMutation = &extprocv3.HeaderMutation{}
+	}
+	rh.Response.HeaderMutation.SetHeaders = append(rh.Response.HeaderMutation.SetHeaders, headers...)
+}
+
+// removeResponseHeaders removes the headers from the response headers processing response. This is no-op if the
+// response is not the one for the response headers.
+func removeResponseHeaders(res *extprocv3.ProcessingResponse, headers ...string) {
+	rh := res.GetResponseHeaders()
+	if rh == nil {
+		return
+	}
+	if rh.Response == nil {
+		rh.Response = &extprocv3.CommonResponse{}
+	}
+	if rh.Response.HeaderMutation == nil {
+		rh.Response.HeaderMutation = &extprocv3.HeaderMutation{}
+	}
+	rh.Response.HeaderMutation.RemoveHeaders = append(rh.Response.HeaderMutation.RemoveHeaders, headers...)
+}
+
+// openAIErrorResponse returns the local reply rejecting the request with the OpenAI-compatible error.
+func openAIErrorResponse(status typev3.StatusCode, code, message string) *extprocv3.ProcessingResponse {
+	return openAIParamErrorResponse(status, code, "", message)
+}
+
+// openAIParamErrorResponse is the same as openAIErrorResponse but with the parameter of the request causing the
+// error, if any.
+func openAIParamErrorResponse(status typev3.StatusCode, code, param, message string) *extprocv3.ProcessingResponse {
+	errType := "invalid_request_error"
+	switch {
+	case status == typev3.StatusCode_Forbidden:
+		errType = "permission_error"
+	case status >= typev3.StatusCode_InternalServerError:
+		errType = "api_error"
+	}
+	body := openai.Error{
+		Type:  "error",
+		Error: openai.ErrorType{Type: errType, Code: &code, Message: message},
+	}
+	if param != "" {
+		body.Error.Param = &param
+	}
+	raw, _ := json.Marshal(body)
+	headers := &extprocv3.HeaderMutation{}
+	setHeader(headers, "content-type", "application/json")
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &extprocv3.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: status},
+				Headers: headers,
+				Body:    raw,
+			},
+		},
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/llmcostcel"
+)
+
+const (
+	// quotaCounterKeyPrefix is the prefix of the keys of the quota counters in the store.
+	quotaCounterKeyPrefix = "aigw:quota:"
+	// quotaCounterExpiryGrace is the extra time for which the counters are kept after the period ends,
+	// so that the requests in flight at the end of the period are charged to the right counter.
+	quotaCounterExpiryGrace = time.Hour
+	// quotaStoreTimeout is the timeout of the operations on the quota store.
+	quotaStoreTimeout = time.Second
+	// consumerKeyQuotaPrefix is the prefix of the names of the consumer keys in the keys of the counters, which
+	// distinguishes them from the ones of the quota policies.
+	consumerKeyQuotaPrefix = "consumerkey/"
+)
+
+// quotaUsage is the usage of a budget applicable to the request.
+type quotaUsage struct {
+	budget *filterapi.QuotaBudget
+	// key is the key of the counter of the budget for the consumer in the current period.
+	key string
+	// used is the amount used in the current period before this request, including the amounts reserved by the
+	// requests in flight.
+	used int64
+	// reserved is the amount reserved by this request when it was admitted, which is settled after the response.
+	reserved int64
+	// resetAt is the time at which the current period ends.
+	resetAt time.Time
+}
+
+// remaining returns the amount which can be still used in the current period.
+func (u *quotaUsage) remaining() int64 {
+	return max(0, u.budget.Limit-u.used)
+}
+
+// quotaState is the state of the quota budgets applicable to the request, which is created by the router filter
+// when the request arrives, and charged by the upstream filter when the response completes.
+type quotaState struct {
+	config *processorConfig
+	usages []quotaUsage
+	now    time.Time
+	// settled is true once the reservations have been settled by either charge or release. The upstream filter
+	// which charges the response and the router filter which releases the reservation run concurrently.
+	settled atomic.Bool
+}
+
+// quotaReservationReleaser is implemented by the router filters which may hold the reservations of the quota budgets.
+type quotaReservationReleaser interface {
+	// releaseQuotaReservation releases the reservations which have not been settled by the response, e.g., when
+	// the request failed or was replied locally. This is called when the processing stream is closed.
+	releaseQuotaReservation()
+}
+
+// enforceQuotas reserves the quota budgets applicable to the request at the router filter. This returns the state
+// to be charged when the response completes, and the local reply if any of the budgets is exhausted.
+// consumerKey is the consumer key authenticating the request whose budgets are also checked, which can be nil.
+// estimate is the token estimate of the request reserved from the token budgets, which can be nil.
+func enforceQuotas(ctx context.Context, config *processorConfig, logger *slog.Logger, model string, consumerKey *filterapi.ConsumerKey, requestHeaders map[string]string, estimate *tokenEstimate) (*quotaState, *extprocv3.ProcessingResponse) {
+	if len(config.quotas) == 0 && (consumerKey == nil || len(consumerKey.Budgets) == 0) {
+		return nil, nil
+	}
+	q, err := reserveQuotas(ctx, config, logger, model, consumerKey, requestHeaders, estimate, time.Now())
+	if err != nil {
+		// The budgets are not enforced rather than failing all the requests while the store is unavailable.
+		logger.Error("failed to reserve quotas", slog.String("error", err.Error()))
+		return nil, nil
+	}
+	if q != nil {
+		if u := q.exhausted(); u != nil {
+			// The rejected request consumes nothing, so the reservation is released right away.
+			q.release(ctx, logger)
+			return q, q.exceededResponse(u)
+		}
+	}
+	return q, nil
+}
+
+// reserveQuotas reserves the amounts of the request from the counters of the budgets applicable to the request for
+// the given model. This returns nil if no budget applies to the request.
+//
+// The reservation is added to the counters atomically, so each of the concurrent requests observes the reservations
+// of the others instead of all of them being admitted against the same remaining amount. The reservation is settled
+// with the actual consumption by charge, or released by release if the request completes without the response.
+func reserveQuotas(ctx context.Context, config *processorConfig, logger *slog.Logger, model string, consumerKey *filterapi.ConsumerKey, requestHeaders map[string]string, estimate *tokenEstimate, now time.Time) (*quotaState, error) {
+	var usages []quotaUsage
+	addUsages := func(prefix string, budgets []filterapi.QuotaBudget, consumer string) {
+		for j := range budgets {
+			b := &budgets[j]
+			if len(b.Models) > 0 && !slices.Contains(b.Models, model) {
+				continue
+			}
+			period, resetAt := quotaPeriod(b.Period, now)
+			usages = append(usages, quotaUsage{
+				budget:  b,
+				key:     prefix + ":" + b.Name + ":" + period + ":" + consumer,
+				resetAt: resetAt,
+			})
+		}
+	}
+	for i := range config.quotas {
+		policy := &config.quotas[i]
+		if consumer := quotaConsumer(ctx, policy, requestHeaders); consumer != "" {
+			addUsages(quotaCounterKeyPrefix+policy.Name, policy.Budgets, consumer)
+		}
+	}
+	if consumerKey != nil {
+		// The budgets of the consumer key are counted per key, so the key itself is the consumer.
+		addUsages(quotaCounterKeyPrefix+consumerKeyQuotaPrefix+consumerKey.Name, consumerKey.Budgets, consumerKey.Name)
+	}
+	if len(usages) == 0 {
+		return nil, nil
+	}
+	q := &quotaState{config: config, usages: usages, now: now}
+	storeCtx, cancel := context.WithTimeout(ctx, quotaStoreTimeout)
+	defer cancel()
+	for i := range usages {
+		u := &usages[i]
+		u.reserved = quotaReservation(u.budget, estimate)
+		value, err := config.quotaStore.Add(storeCtx, u.key, u.reserved, u.resetAt.Add(quotaCounterExpiryGrace))
+		if err != nil {
+			// The reservations made so far are released since the budgets are not enforced for the request.
+			q.usages = usages[:i]
+			q.release(ctx, logger)
+			return nil, fmt.Errorf("failed to reserve quota counters: %w", err)
+		}
+		u.used = value - u.reserved
+	}
+	return q, nil
+}
+
+// quotaReservation returns the amount reserved from the budget when the request is admitted. The token budgets
+// reserve the estimated input and the reserved output tokens if the token estimation is enabled, and otherwise
+// a single unit is reserved so that the requests admitted concurrently still observe each other.
+func quotaReservation(budget *filterapi.QuotaBudget, estimate *tokenEstimate) int64 {
+	if budget.Type == filterapi.QuotaBudgetTypeToken && estimate != nil {
+		return max(1, int64(estimate.input)+int64(estimate.reservedOutput))
+	}
+	return 1
+}
+
+// quotaConsumer returns the consumer key of the request for the policy, or empty if it cannot be identified.
+func quotaConsumer(ctx context.Context, policy *filterapi.QuotaPolicy, requestHeaders map[string]string) string {
+	switch {
+	case policy.ConsumerHeader != "":
+		return requestHeaders[strings.ToLower(policy.ConsumerHeader)]
+	case policy.ConsumerJWTClaim != "":
+		return jwtClaim(ctx, policy.ConsumerJWTClaim)
+	case policy.ConsumerClientIP:
+		// Envoy appends the address of the downstream peer to the x-forwarded-for header, so the last entry is
+		// the one which cannot be spoofed by the client.
+		xff := requestHeaders["x-forwarded-for"]
+		return strings.TrimSpace(xff[strings.LastIndexByte(xff, ',')+1:])
+	}
+	return ""
+}
+
+// quotaPeriod returns the identifier of the current period and the time at which it ends.
+func quotaPeriod(period filterapi.QuotaBudgetPeriod, now time.Time) (string, time.Time) {
+	now = now.UTC()
+	y, m, d := now.Date()
+	if period == filterapi.QuotaBudgetPeriodMonthly {
+		return now.Format("200601"), time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return now.Format("20060102"), time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// exhausted returns the usage of the budget whose remaining amount is less than the reservation of the request, or
+// nil if none is. Without the token estimate, a single unit is reserved, so this is the budget which is used up.
+// If multiple budgets are exhausted, this returns the one which resets last, i.e., until when the consumer has to wait.
+func (q *quotaState) exhausted() *quotaUsage {
+	var ret *quotaUsage
+	for i := range q.usages {
+		u := &q.usages[i]
+		if u.remaining() < u.reserved && (ret == nil || u.resetAt.After(ret.resetAt)) {
+			ret = u
+		}
+	}
+	return ret
+}
+
+// headers returns the x-ratelimit-* headers describing the most constrained budget per type.
+func (q *quotaState) headers() []*corev3.HeaderValueOption {
+	var ret []*corev3.HeaderValueOption
+	for _, t := range []filterapi.QuotaBudgetType{filterapi.QuotaBudgetTypeToken, filterapi.QuotaBudgetTypeCost} {
+		var u *quotaUsage
+		for i := range q.usages {
+			c := &q.usages[i]
+			if c.budget.Type == t && (u == nil || c.remaining() < u.remaining()) {
+				u = c
+			}
+		}
+		if u == nil {
+			continue
+		}
+		suffix := "tokens"
+		if t == filterapi.QuotaBudgetTypeCost {
+			suffix = "cost"
+		}
+		// The reset time is in the same format as the one of OpenAI, e.g., "6m0s".
+		reset := u.resetAt.Sub(q.now).Round(time.Second)
+		ret = append(ret,
+			&corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: "x-ratelimit-limit-" + suffix, RawValue: []byte(strconv.FormatInt(u.budget.Limit, 10))}},
+			&corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: "x-ratelimit-remaining-" + suffix, RawValue: []byte(strconv.FormatInt(u.remaining(), 10))}},
+			&corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: "x-ratelimit-reset-" + suffix, RawValue: []byte(reset.String())}},
+		)
+	}
+	return ret
+}
+
+// exceededResponse returns the local reply rejecting the request since the budget of the usage is exhausted.
+func (q *quotaState) exceededResponse(u *quotaUsage) *extprocv3.ProcessingResponse {
+	body, _ := json.Marshal(openai.Error{
+		Type: "error",
+		Error: openai.ErrorType{
+			Type: "insufficient_quota",
+			Message: fmt.Sprintf("%s quota %q is exhausted, which resets at %s",
+				strings.ToLower(string(u.budget.Period)), u.budget.Name, u.resetAt.Format(time.RFC3339)),
+		},
+	})
+	headers := &extprocv3.HeaderMutation{SetHeaders: q.headers()}
+	setHeader(headers, "content-type", "application/json")
+	setHeader(headers, "retry-after", strconv.FormatInt(int64(u.resetAt.Sub(q.now).Round(time.Second)/time.Second), 10))
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &extprocv3.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode_TooManyRequests},
+				Headers: headers,
+				Body:    body,
+			},
+		},
+	}
+}
+
+// validateCostBudgets returns an error if any of the cost budgets counts the request cost which is not configured,
+// since such a budget would never be consumed.
+func validateCostBudgets(budgets []filterapi.QuotaBudget, costs []processorConfigRequestCost) error {
+	for i := range budgets {
+		b := &budgets[i]
+		if b.Type != filterapi.QuotaBudgetTypeCost {
+			continue
+		}
+		if !slices.ContainsFunc(costs, func(rc processorConfigRequestCost) bool { return rc.MetadataKey == b.CostMetadataKey }) {
+			return fmt.Errorf("budget %s counts the unknown request cost %q", b.Name, b.CostMetadataKey)
+		}
+	}
+	return nil
+}
+
+// charge settles the reservations of the budgets with the consumption of the request. The errors are only logged
+// since the response is already sent to the client.
+func (q *quotaState) charge(ctx context.Context, logger *slog.Logger, cc *llmcostcel.RequestContext) {
+	q.settle(ctx, logger, func(u *quotaUsage) int64 {
+		switch u.budget.Type {
+		case filterapi.QuotaBudgetTypeToken:
+			return int64(cc.TotalTokens)
+		case filterapi.QuotaBudgetTypeCost:
+			idx := slices.IndexFunc(q.config.requestCosts, func(rc processorConfigRequestCost) bool {
+				return rc.MetadataKey == u.budget.CostMetadataKey
+			})
+			if idx < 0 {
+				return 0
+			}
+			cost, err := calculateRequestCost(&q.config.requestCosts[idx], cc)
+			if err != nil {
+				logger.Error("failed to calculate the cost for the quota", slog.String("budget", u.budget.Name), slog.String("error", err.Error()))
+				return 0
+			}
+			return int64(cost)
+		}
+		return 0
+	})
+}
+
+// release releases the reservations of the budgets, which is a no-op once they have been settled by charge.
+func (q *quotaState) release(ctx context.Context, logger *slog.Logger) {
+	q.settle(ctx, logger, func(*quotaUsage) int64 { return 0 })
+}
+
+// settle adds the difference between the amount consumed by the request and the reserved one to the counters of
+// the budgets. This only takes effect once per request.
+func (q *quotaState) settle(ctx context.Context, logger *slog.Logger, consumed func(*quotaUsage) int64) {
+	if !q.settled.CompareAndSwap(false, true) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, quotaStoreTimeout)
+	defer cancel()
+	for i := range q.usages {
+		u := &q.usages[i]
+		delta := consumed(u) - u.reserved
+		if delta == 0 {
+			continue
+		}
+		if _, err := q.config.quotaStore.Add(ctx, u.key, delta, u.resetAt.Add(quotaCounterExpiryGrace)); err != nil {
+			logger.Error("failed to settle the quota", slog.String("budget", u.budget.Name), slog.String("error", err.Error()))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/resp"
+)
+
+// NewRedisStore creates a new [Store] which keeps the counters in the server speaking the Redis protocol (RESP),
+// such as Redis or Valkey, at the given address in the form of "host:port".
+//
+// The counters are shared across the external processor instances connected to the same server. This only relies
+// on the INCRBY and EXPIREAT commands, and the connections are established lazily.
+func NewRedisStore(addr string) Store {
+	return &redisStore{c: resp.NewClient(addr)}
+}
+
+// redisStore implements [Store] with the RESP client.
+type redisStore struct {
+	c *resp.Client
+}
+
+// Add implements [Store.Add].
+func (s *redisStore) Add(ctx context.Context, key string, delta int64, expireAt time.Time) (int64, error) {
+	replies, err := s.c.Do(ctx,
+		[]string{"INCRBY", key, strconv.FormatInt(delta, 10)},
+		[]string{"EXPIREAT", key, strconv.FormatInt(expireAt.Unix(), 10)},
+	)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := replies[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCRBY reply: %v", replies[0])
+	}
+	return value, nil
+}
+
+// Close implements [Store.Close].
+func (s *redisStore) Close() error {
+	return s.c.Close()
+}
@@ -0,0 +1,61 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package quota
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/resp/resptest"
+)
+
+func TestRedisStore(t *testing.T) {
+	srv := resptest.NewServer(t)
+	s := NewRedisStore(srv.Addr())
+	defer func() { require.NoError(t, s.Close()) }()
+
+	expireAt := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	v, err := s.Add(t.Context(), "a", 10, expireAt)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), v)
+	v, err = s.Add(t.Context(), "a", -5, expireAt)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), v)
+	require.Equal(t, fmt.Sprintf("EXPIREAT %d", expireAt.Unix()), srv.Expiration("a"))
+	// The connection is reused across the calls.
+	require.Equal(t, 1, srv.Conns())
+
+	t.Run("error reply", func(t *testing.T) {
+		rs := s.(*redisStore)
+		_, err := rs.c.Do(t.Context(), []string{"UNKNOWN"})
+		require.ErrorContains(t, err, "redis: ERR unknown command 'UNKNOWN'")
+		// The connection is still usable after the error reply.
+		v, err := s.Add(t.Context(), "a", 1, expireAt)
+		require.NoError(t, err)
+		require.Equal(t, int64(6), v)
+	})
+
+	t.Run("connection failure", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := lis.Addr().String()
+		require.NoError(t, lis.Close())
+		_, err = NewRedisStore(addr).Add(t.Context(), "a", 1, expireAt)
+		require.ErrorContains(t, err, "failed to connect")
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		_, err := NewRedisStore(srv.Addr()).Add(ctx, "a", 1, expireAt)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package quota provides the stores of the counters used to enforce the QuotaPolicy budgets.
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store is the interface for the store of the counters of the quota budgets.
+//
+// The counters are keyed by the budget, the consumer and the period, and they are expected to expire
+// after the period ends.
+type Store interface {
+	// Add adds the delta to the counter for the given key, and sets the counter to expire at the given time.
+	// This returns the value of the counter after the addition. The addition is atomic, so the concurrent callers
+	// observe each other's deltas. The value of a counter which does not exist is zero.
+	Add(ctx context.Context, key string, delta int64, expireAt time.Time) (int64, error)
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// memorySweepInterval is the minimum interval between the sweeps of the expired counters in the memoryStore.
+const memorySweepInterval = time.Minute
+
+// NewMemoryStore creates a new [Store] which keeps the counters in the memory of the process.
+//
+// The counters are not shared across the external processor instances, so the budgets are enforced per instance.
+func NewMemoryStore() Store {
+	return &memoryStore{counters: make(map[string]*memoryCounter), now: time.Now}
+}
+
+type (
+	// memoryStore implements [Store] in memory.
+	memoryStore struct {
+		mu        sync.Mutex
+		counters  map[string]*memoryCounter
+		lastSweep time.Time
+		// now is the function to get the current time, which is replaced in tests.
+		now func() time.Time
+	}
+	memoryCounter struct {
+		value    int64
+		expireAt time.Time
+	}
+)
+
+// Add implements [Store.Add].
+func (m *memoryStore) Add(_ context.Context, key string, delta int64, expireAt time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if now.Sub(m.lastSweep) >= memorySweepInterval {
+		for k, c := range m.counters {
+			if !now.Before(c.expireAt) {
+				delete(m.counters, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	c, ok := m.counters[key]
+	if !ok || !now.Before(c.expireAt) {
+		c = &memoryCounter{}
+		m.counters[key] = c
+	}
+	c.value += delta
+	c.expireAt = expireAt
+	return c.value, nil
+}
+
+// Close implements [Store.Close].
+func (m *memoryStore) Close() error { return nil }
@@ -0,0 +1,64 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package quota
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore().(*memoryStore)
+	s.now = func() time.Time { return now }
+	add := func(key string, delta int64, expireAt time.Time) int64 {
+		v, err := s.Add(t.Context(), key, delta, expireAt)
+		require.NoError(t, err)
+		return v
+	}
+
+	require.Equal(t, int64(10), add("a", 10, now.Add(time.Hour)))
+	require.Equal(t, int64(15), add("a", 5, now.Add(time.Hour)))
+	require.Equal(t, int64(1), add("b", 1, now.Add(2*time.Hour)))
+	// The negative delta settles the amount reserved before.
+	require.Equal(t, int64(12), add("a", -3, now.Add(time.Hour)))
+	require.Equal(t, int64(0), add("c", 0, now.Add(time.Hour)))
+
+	// The expired counter starts over on the next addition.
+	now = now.Add(time.Hour)
+	require.Equal(t, int64(2), add("b", 1, now.Add(time.Hour)))
+	require.NotContains(t, s.counters, "a", "the expired counter must be swept")
+	require.Equal(t, int64(3), add("a", 3, now.Add(time.Hour)))
+	require.NoError(t, s.Close())
+}
+
+func TestMemoryStore_concurrent(t *testing.T) {
+	s := NewMemoryStore()
+	expireAt := time.Now().Add(time.Hour)
+	// Each of the concurrent additions observes a distinct value, so exactly one of them can be admitted as the
+	// first one.
+	values := make(chan int64, 100)
+	var wg sync.WaitGroup
+	for range cap(values) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := s.Add(t.Context(), "a", 1, expireAt)
+			require.NoError(t, err)
+			values <- v
+		}()
+	}
+	wg.Wait()
+	close(values)
+	seen := map[int64]bool{}
+	for v := range values {
+		seen[v] = true
+	}
+	require.Len(t, seen, cap(values))
+}
@@ -0,0 +1,325 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/quota"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+)
+
+func Test_quotaConsumer(t *testing.T) {
+	byHeader := &filterapi.QuotaPolicy{ConsumerHeader: "X-Team"}
+	require.Equal(t, "team-a", quotaConsumer(t.Context(), byHeader, map[string]string{"x-team": "team-a"}))
+	require.Empty(t, quotaConsumer(t.Context(), byHeader, map[string]string{}))
+
+	byClaim := &filterapi.QuotaPolicy{ConsumerJWTClaim: "tier"}
+	require.Equal(t, "silver", quotaConsumer(withJWTClaims(t, map[string]any{"tier": "silver"}), byClaim, map[string]string{}))
+	require.Empty(t, quotaConsumer(t.Context(), byClaim, map[string]string{}))
+
+	byIP := &filterapi.QuotaPolicy{ConsumerClientIP: true}
+	require.Equal(t, "10.0.0.1", quotaConsumer(t.Context(), byIP, map[string]string{"x-forwarded-for": "10.0.0.1"}))
+	require.Equal(t, "10.0.0.2", quotaConsumer(t.Context(), byIP, map[string]string{"x-forwarded-for": "1.2.3.4, 10.0.0.2"}))
+	require.Empty(t, quotaConsumer(t.Context(), byIP, map[string]string{}))
+
+	require.Empty(t, quotaConsumer(t.Context(), &filterapi.QuotaPolicy{}, map[string]string{"x-team": "team-a"}))
+}
+
+func Test_quotaPeriod(t *testing.T) {
+	now := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+	id, resetAt := quotaPeriod(filterapi.QuotaBudgetPeriodDaily, now)
+	require.Equal(t, "20251231", id)
+	require.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), resetAt)
+	id, resetAt = quotaPeriod(filterapi.QuotaBudgetPeriodMonthly, now)
+	require.Equal(t, "202512", id)
+	require.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), resetAt)
+
+	// The periods follow the calendar in UTC regardless of the location of the given time.
+	id, _ = quotaPeriod(filterapi.QuotaBudgetPeriodDaily, now.In(time.FixedZone("UTC+9", 9*60*60)))
+	require.Equal(t, "20251231", id)
+}
+
+// failingQuotaStore is a [quota.Store] which always fails.
+type failingQuotaStore struct{}
+
+func (failingQuotaStore) Add(context.Context, string, int64, time.Time) (int64, error) {
+	return 0, errors.New("unavailable")
+}
+
+func (failingQuotaStore) Close() error { return nil }
+
+// quotaTestFilterConfig returns the filter config where the consumers of the "x-team" header have the daily token
+// budget of all the models and the monthly cost budget of "gpt".
+func quotaTestFilterConfig() *filterapi.Config {
+	return &filterapi.Config{
+		ModelNameHeaderKey: "x-model",
+		LLMRequestCosts: []filterapi.LLMRequestCost{
+			{MetadataKey: "weighted", Type: filterapi.LLMRequestCostTypeCEL, CEL: "input_tokens + output_tokens * uint(2)"},
+		},
+		Quotas: []filterapi.QuotaPolicy{{
+			Name:           "ns/policy",
+			ConsumerHeader: "x-team",
+			Budgets: []filterapi.QuotaBudget{
+				{Name: "daily-tokens", Type: filterapi.QuotaBudgetTypeToken, Period: filterapi.QuotaBudgetPeriodDaily, Limit: 100},
+				{Name: "gpt-spend", Models: []string{"gpt"}, Type: filterapi.QuotaBudgetTypeCost, CostMetadataKey: "weighted", Period: filterapi.QuotaBudgetPeriodMonthly, Limit: 1000},
+			},
+		}},
+	}
+}
+
+// withQuotaStore returns the setup of [newTestConfig] which sets the quota store.
+func withQuotaStore(store quota.Store) func(*Server) {
+	return func(s *Server) { s.SetQuotaStore(store) }
+}
+
+func Test_validateCostBudgets(t *testing.T) {
+	s, err := NewServer(slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, s.LoadConfig(t.Context(), quotaTestFilterConfig()))
+
+	// The cost budget counting the request cost which is not configured is rejected since it would never be consumed.
+	fc := quotaTestFilterConfig()
+	fc.Quotas[0].Budgets[1].CostMetadataKey = "unknown"
+	require.EqualError(t, s.LoadConfig(t.Context(), fc),
+		`invalid quota policy ns/policy: budget gpt-spend counts the unknown request cost "unknown"`)
+
+	fc = quotaTestFilterConfig()
+	fc.ConsumerKeys = []filterapi.ConsumerKey{{Name: "ns/key", Budgets: []filterapi.QuotaBudget{
+		{Name: "spend", Type: filterapi.QuotaBudgetTypeCost, Period: filterapi.QuotaBudgetPeriodDaily, Limit: 10},
+	}}}
+	require.EqualError(t, s.LoadConfig(t.Context(), fc),
+		`invalid consumer key ns/key: budget spend counts the unknown request cost ""`)
+}
+
+func Test_reserveQuotas(t *testing.T) {
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	store := mapQuotaStore{}
+	config := newTestConfig(t, quotaTestFilterConfig(), withQuotaStore(store))
+	reserve := func(model string, key *filterapi.ConsumerKey, headers map[string]string, estimate *tokenEstimate, now time.Time) *quotaState {
+		q, err := reserveQuotas(t.Context(), config, slog.Default(), model, key, headers, estimate, now)
+		require.NoError(t, err)
+		return q
+	}
+
+	t.Run("no consumer", func(t *testing.T) {
+		require.Nil(t, reserve("gpt", nil, map[string]string{}, nil, now))
+	})
+
+	t.Run("model not matching", func(t *testing.T) {
+		q := reserve("llama", nil, map[string]string{"x-team": "a"}, nil, now)
+		require.Len(t, q.usages, 1)
+		require.Equal(t, "aigw:quota:ns/policy:daily-tokens:20250115:a", q.usages[0].key)
+		// A single unit is reserved without the token estimate, which is released if the request is not charged.
+		require.Equal(t, int64(1), store[q.usages[0].key])
+		q.release(t.Context(), slog.Default())
+		require.Equal(t, int64(0), store[q.usages[0].key])
+	})
+
+	t.Run("charge and exhaust", func(t *testing.T) {
+		headers := map[string]string{"x-team": "b", "x-model": "gpt"}
+		q := reserve("gpt", nil, headers, nil, now)
+		require.Len(t, q.usages, 2)
+		require.Nil(t, q.exhausted())
+		requireQuotaHeaders(t, map[string]string{
+			"x-ratelimit-limit-tokens": "100", "x-ratelimit-remaining-tokens": "100", "x-ratelimit-reset-tokens": "12h0m0s",
+			"x-ratelimit-limit-cost": "1000", "x-ratelimit-remaining-cost": "1000", "x-ratelimit-reset-cost": "396h0m0s",
+		}, q)
+
+		q.charge(t.Context(), slog.Default(), newRequestCostContext(config, &translator.LLMTokenUsage{InputTokens: 40, OutputTokens: 80, TotalTokens: 120}, nil, headers, "backend"))
+		require.Equal(t, int64(120), store[q.usages[0].key])
+		require.Equal(t, int64(200), store[q.usages[1].key])
+		// The reservation is only settled once.
+		q.release(t.Context(), slog.Default())
+		require.Equal(t, int64(120), store[q.usages[0].key])
+
+		q = reserve("gpt", nil, headers, nil, now)
+		u := q.exhausted()
+		require.NotNil(t, u)
+		require.Equal(t, "daily-tokens", u.budget.Name)
+		requireQuotaHeaders(t, map[string]string{
+			"x-ratelimit-limit-tokens": "100", "x-ratelimit-remaining-tokens": "0", "x-ratelimit-reset-tokens": "12h0m0s",
+			"x-ratelimit-limit-cost": "1000", "x-ratelimit-remaining-cost": "800", "x-ratelimit-reset-cost": "396h0m0s",
+		}, q)
+		q.release(t.Context(), slog.Default())
+		require.Equal(t, int64(120), store[q.usages[0].key])
+
+		res := q.exceededResponse(u)
+		ir := res.GetImmediateResponse()
+		require.Equal(t, typev3.StatusCode_TooManyRequests, ir.Status.Code)
+		require.JSONEq(t, `{"type":"error","error":{"type":"insufficient_quota","message":"daily quota \"daily-tokens\" is exhausted, which resets at 2025-01-16T00:00:00Z"}}`, string(ir.Body))
+		headerValues := map[string]string{}
+		for _, h := range ir.Headers.SetHeaders {
+			headerValues[h.Header.Key] = string(h.Header.RawValue)
+		}
+		require.Equal(t, "43200", headerValues["retry-after"])
+		require.Equal(t, "0", headerValues["x-ratelimit-remaining-tokens"])
+
+		// The consumption of the other consumer is counted separately.
+		require.Nil(t, reserve("gpt", nil, map[string]string{"x-team": "c"}, nil, now).exhausted())
+
+		// The budget is reset in the next period.
+		require.Nil(t, reserve("gpt", nil, headers, nil, now.Add(12*time.Hour)).exhausted())
+	})
+
+	t.Run("concurrent requests", func(t *testing.T) {
+		headers := map[string]string{"x-team": "e"}
+		estimate := &tokenEstimate{input: 40, reservedOutput: 10}
+		// The requests in flight observe the estimated tokens reserved by each other before any of them is charged.
+		first := reserve("llama", nil, headers, estimate, now)
+		require.Nil(t, first.exhausted())
+		second := reserve("llama", nil, headers, estimate, now)
+		require.Nil(t, second.exhausted())
+		require.Equal(t, int64(50), second.usages[0].used)
+		third := reserve("llama", nil, headers, estimate, now)
+		require.NotNil(t, third.exhausted())
+		third.release(t.Context(), slog.Default())
+		require.Equal(t, int64(100), store[first.usages[0].key])
+
+		// The reservation is settled with the actual consumption.
+		first.charge(t.Context(), slog.Default(), newRequestCostContext(config, &translator.LLMTokenUsage{TotalTokens: 10}, nil, headers, "backend"))
+		require.Equal(t, int64(60), store[first.usages[0].key])
+
+		// The request whose reservation exceeds the remaining amount is rejected even if the budget is not used up,
+		// while the one reserving a single unit without the estimate is admitted.
+		fourth := reserve("llama", nil, headers, estimate, now)
+		require.Equal(t, int64(60), fourth.usages[0].used)
+		require.NotNil(t, fourth.exhausted())
+		fourth.release(t.Context(), slog.Default())
+		fifth := reserve("llama", nil, headers, nil, now)
+		require.Nil(t, fifth.exhausted())
+		fifth.release(t.Context(), slog.Default())
+
+		second.release(t.Context(), slog.Default())
+		require.Equal(t, int64(10), store[first.usages[0].key])
+	})
+
+	t.Run("consumer key", func(t *testing.T) {
+		key := &filterapi.ConsumerKey{
+			Name: "ns/key", Consumer: "team-a",
+			Budgets: []filterapi.QuotaBudget{{Name: "daily", Type: filterapi.QuotaBudgetTypeToken, Period: filterapi.QuotaBudgetPeriodDaily, Limit: 10}},
+		}
+		q := reserve("llama", key, map[string]string{"x-team": "d"}, nil, now)
+		require.Len(t, q.usages, 2)
+		require.Equal(t, "aigw:quota:ns/policy:daily-tokens:20250115:d", q.usages[0].key)
+		require.Equal(t, "aigw:quota:consumerkey/ns/key:daily:20250115:ns/key", q.usages[1].key)
+
+		// The budgets of the key apply even without any quota policy.
+		q, res := enforceQuotas(t.Context(), &processorConfig{quotaStore: store}, slog.Default(), "llama", key, map[string]string{}, nil)
+		require.Nil(t, res)
+		require.Len(t, q.usages, 1)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		_, err := reserveQuotas(t.Context(), newTestConfig(t, quotaTestFilterConfig(), withQuotaStore(failingQuotaStore{})), slog.Default(), "gpt", nil, map[string]string{"x-team": "a"}, nil, now)
+		require.ErrorContains(t, err, "unavailable")
+	})
+}
+
+func requireQuotaHeaders(t *testing.T, expected map[string]string, q *quotaState) {
+	actual := map[string]string{}
+	for _, h := range q.headers() {
+		actual[h.Header.Key] = string(h.Header.RawValue)
+	}
+	require.Equal(t, expected, actual)
+}
+
+func Test_enforceQuotas(t *testing.T) {
+	t.Run("no quota", func(t *testing.T) {
+		q, res := enforceQuotas(t.Context(), &processorConfig{}, slog.Default(), "gpt", nil, map[string]string{}, nil)
+		require.Nil(t, q)
+		require.Nil(t, res)
+	})
+	t.Run("fail open", func(t *testing.T) {
+		q, res := enforceQuotas(t.Context(), newTestConfig(t, quotaTestFilterConfig(), withQuotaStore(failingQuotaStore{})), slog.Default(), "gpt", nil, map[string]string{"x-team": "a"}, nil)
+		require.Nil(t, q)
+		require.Nil(t, res)
+	})
+
+	t.Run("end to end", func(t *testing.T) {
+		store := mapQuotaStore{}
+		config := newTestConfig(t, quotaTestFilterConfig(), withQuotaStore(store))
+		config.backends = map[string]*processorConfigBackend{"backend": {b: &filterapi.Backend{Name: "backend"}}}
+		headers := map[string]string{"x-team": "a", ":path": "/v1/chat/completions"}
+		rp := &chatCompletionProcessorRouterFilter{config: config, requestHeaders: headers, logger: slog.Default()}
+		res, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: bodyFromModel(t, "gpt", false)})
+		require.NoError(t, err)
+		require.NotNil(t, res.GetRequestBody())
+		require.NotNil(t, rp.quota)
+
+		u := &chatCompletionProcessorUpstreamFilter{
+			config: config, logger: slog.Default(), metrics: &mockChatCompletionMetrics{}, requestHeaders: headers,
+		}
+		require.NoError(t, u.SetBackend(t.Context(), &filterapi.Backend{
+			Name:   "backend",
+			Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+		}, nil, rp))
+		_, err = u.ProcessRequestHeaders(t.Context(), &corev3.HeaderMap{})
+		require.NoError(t, err)
+		res, err = rp.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{
+			Headers: []*corev3.HeaderValue{{Key: ":status", Value: "200"}},
+		})
+		require.NoError(t, err)
+		var rateLimitHeaders int
+		for _, h := range res.GetResponseHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+			if strings.HasPrefix(h.Header.Key, "x-ratelimit-") {
+				rateLimitHeaders++
+			}
+		}
+		require.Equal(t, 6, rateLimitHeaders)
+		_, err = rp.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{
+			Body:        []byte(`{"usage":{"prompt_tokens":40,"completion_tokens":80,"total_tokens":120}}`),
+			EndOfStream: true,
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(120), store[rp.quota.usages[0].key])
+		require.Equal(t, int64(200), store[rp.quota.usages[1].key])
+
+		// The reservation settled by the response is not released again when the stream is closed.
+		rp.releaseQuotaReservation()
+		require.Equal(t, int64(120), store[rp.quota.usages[0].key])
+
+		rp = &chatCompletionProcessorRouterFilter{config: config, requestHeaders: headers, logger: slog.Default()}
+		res, err = rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: bodyFromModel(t, "gpt", false)})
+		require.NoError(t, err)
+		require.Equal(t, typev3.StatusCode_TooManyRequests, res.GetImmediateResponse().Status.Code)
+		require.Equal(t, int64(120), store[rp.quota.usages[0].key])
+	})
+
+	t.Run("released without response", func(t *testing.T) {
+		store := mapQuotaStore{}
+		config := newTestConfig(t, quotaTestFilterConfig(), withQuotaStore(store))
+		rp := &chatCompletionProcessorRouterFilter{config: config, requestHeaders: map[string]string{"x-team": "a"}, logger: slog.Default()}
+		_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: bodyFromModel(t, "gpt", false)})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), store[rp.quota.usages[0].key])
+		// The request which fails upstream is never charged, so its reservation is released when the stream is closed.
+		rp.releaseQuotaReservation()
+		require.Equal(t, int64(0), store[rp.quota.usages[0].key])
+		require.Equal(t, int64(0), store[rp.quota.usages[1].key])
+	})
+}
+
+// mapQuotaStore is a [quota.Store] which never expires the counters.
+type mapQuotaStore map[string]int64
+
+func (m mapQuotaStore) Add(_ context.Context, key string, delta int64, _ time.Time) (int64, error) {
+	m[key] += delta
+	return m[key], nil
+}
+
+func (m mapQuotaStore) Close() error { return nil }
@@ -0,0 +1,209 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/capture"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+)
+
+// maxCaptureResponseBytes is the maximum total size of the response chunks captured for a request, after which the
+// rest of the chunks are not captured.
+const maxCaptureResponseBytes = 32 << 20
+
+// requestCaptureWriter is implemented by the router filters which may capture the request. The capture is written
+// when the processing stream is closed, so that it has the whole response including the retries.
+type requestCaptureWriter interface {
+	// writeRequestCapture writes the capture if the request is captured.
+	writeRequestCapture()
+}
+
+// requestCapture is the capture of a request shared by the router filter and the upstream filters of its attempts,
+// which may run concurrently when the request is hedged.
+type requestCapture struct {
+	writer *capture.Writer
+	logger *slog.Logger
+	mu     sync.Mutex
+	record capture.Record
+	// responseBytes is the total size of the response chunks captured so far.
+	responseBytes int
+	written       sync.Once
+}
+
+// startRequestCapture starts the capture of the request if the capture is enabled on the route rule of the model,
+// and the request has the capture header when it is required. This returns nil if the request is not captured.
+//
+// The original request body is only recorded when it is enabled on the rule, since the request body translated for
+// the backends is recorded by setRequest after the PII and the secrets are redacted.
+func startRequestCapture(config *processorConfig, logger *slog.Logger, model string, headers map[string]string, original []byte) *requestCapture {
+	if config.capture == nil {
+		return nil
+	}
+	rule := config.rulesByModel[model]
+	if rule == nil || rule.Capture == nil || (rule.Capture.HeaderOnly && headers[internalapi.CaptureHeader] != "true") {
+		return nil
+	}
+	c := &requestCapture{writer: config.capture, logger: logger, record: capture.Record{
+		ID:    headers["x-request-id"],
+		Time:  time.Now(),
+		Path:  headers[":path"],
+		Route: string(rule.Name),
+		Model: model,
+	}}
+	if rule.Capture.IncludeOriginalRequest {
+		c.record.OriginalRequest = original
+	}
+	return c
+}
+
+// setRequest records the request body translated for the backends, which is the one after the modifications by the
+// gateway.
+func (c *requestCapture) setRequest(body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record.Request = body
+}
+
+// startAttempt records the attempt of the request to the backend, and returns it to be filled by the upstream filter.
+func (c *requestCapture) startAttempt(b *filterapi.Backend, retry bool) *capture.Attempt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a := &capture.Attempt{Backend: b.Name, Schema: b.Schema, ModelNameOverride: b.ModelNameOverride, Retry: retry}
+	c.record.Attempts = append(c.record.Attempts, a)
+	return a
+}
+
+// recordRequest records the headers and the body of the request translated for the backend of the attempt.
+func (c *requestCapture) recordRequest(a *capture.Attempt, headerMutation *extprocv3.HeaderMutation, bodyMutation *extprocv3.BodyMutation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, h := range headerMutation.GetSetHeaders() {
+		if a.RequestHeaders == nil {
+			a.RequestHeaders = make(map[string]string)
+		}
+		a.RequestHeaders[h.Header.Key] = string(h.Header.RawValue)
+	}
+	a.RequestBody = bodyMutation.GetBody()
+}
+
+// recordResponseHeaders records the response headers of the backend of the attempt.
+func (c *requestCapture) recordResponseHeaders(a *capture.Attempt, headers map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a.ResponseHeaders = maps.Clone(headers)
+}
+
+// recordResponseBody records the chunk of the response body of the backend of the attempt and the corresponding
+// chunk returned to the client.
+func (c *requestCapture) recordResponseBody(a *capture.Attempt, raw, client []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.record.Truncated {
+		return
+	}
+	if c.responseBytes += len(raw) + len(client); c.responseBytes > maxCaptureResponseBytes {
+		c.record.Truncated = true
+		return
+	}
+	a.ResponseChunks = append(a.ResponseChunks, bytes.Clone(raw))
+	a.ClientResponseChunks = append(a.ClientResponseChunks, bytes.Clone(client))
+}
+
+// recordLocalReply records the local reply returned to the client instead of the response of the backend, if any.
+func (c *requestCapture) recordLocalReply(res *extprocv3.ProcessingResponse) {
+	if ir := res.GetImmediateResponse(); ir != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.record.LocalReply, c.record.LocalReplyStatus = ir.Body, int(ir.GetStatus().GetCode())
+	}
+}
+
+// write writes the capture to the disk. This is only done once per request.
+func (c *requestCapture) write() {
+	c.written.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if err := c.writer.Write(&c.record); errors.Is(err, capture.ErrLimitReached) {
+			c.logger.Warn("dropped the request capture as the capture directory reached its limits")
+		} else if err != nil {
+			c.logger.Error("failed to write the request capture", slog.String("error", err.Error()))
+		}
+	})
+}
+
+// ReplayChatCompletionAttempt translates the request of the chat completion capture and the captured response of
+// the backend of the attempt again with the current translators, and returns the result as an attempt which can be
+// compared with the captured one.
+//
+// The result has only the translated request and the response chunks returned to the client. The latter doesn't
+// reflect the modifications of the response by the gateway other than the translation, such as by the guardrails.
+func ReplayChatCompletionAttempt(r *capture.Record, a *capture.Attempt) (*capture.Attempt, error) {
+	request := r.Request
+	_, body, err := parseOpenAIChatCompletionBody(&extprocv3.HttpBody{Body: request})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse request body: %w", err)
+	}
+	c := &chatCompletionProcessorUpstreamFilter{modelNameOverride: a.ModelNameOverride}
+	if err = c.selectTranslator(a.Schema); err != nil {
+		return nil, fmt.Errorf("failed to select translator: %w", err)
+	}
+
+	replayed := &capture.Attempt{
+		Backend: a.Backend, Schema: a.Schema, ModelNameOverride: a.ModelNameOverride, Retry: a.Retry,
+		ResponseHeaders: a.ResponseHeaders, ResponseChunks: a.ResponseChunks,
+	}
+	headerMutation, bodyMutation, err := c.translator.RequestBody(request, body, a.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform request: %w", err)
+	}
+	for _, h := range headerMutation.GetSetHeaders() {
+		if replayed.RequestHeaders == nil {
+			replayed.RequestHeaders = make(map[string]string)
+		}
+		replayed.RequestHeaders[h.Header.Key] = string(h.Header.RawValue)
+	}
+	replayed.RequestBody = bodyMutation.GetBody()
+	if a.ResponseHeaders == nil {
+		return replayed, nil
+	}
+
+	// The translators may modify the headers as they do in the upstream filter.
+	headers := maps.Clone(a.ResponseHeaders)
+	if _, err = c.translator.ResponseHeaders(headers); err != nil {
+		return nil, fmt.Errorf("failed to transform response headers: %w", err)
+	}
+	for i, chunk := range a.ResponseChunks {
+		var br io.Reader = bytes.NewReader(chunk)
+		if headers["content-encoding"] == "gzip" {
+			if br, err = gzip.NewReader(br); err != nil {
+				return nil, fmt.Errorf("failed to decode gzip: %w", err)
+			}
+		}
+		_, bodyMutation, _, err = c.translator.ResponseBody(headers, br, i == len(a.ResponseChunks)-1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform response: %w", err)
+		}
+		if bm := bodyMutation.GetBody(); bm != nil {
+			replayed.ClientResponseChunks = append(replayed.ClientResponseChunks, bm)
+		} else {
+			replayed.ClientResponseChunks = append(replayed.ClientResponseChunks, chunk)
+		}
+	}
+	return replayed, nil
+}
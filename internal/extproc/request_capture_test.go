@@ -0,0 +1,202 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+
+	"fmt"
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/capture"
+)
+
+// withCaptureDir returns the setup of [newTestConfig] which captures the requests to the directory.
+func withCaptureDir(t *testing.T, dir string) func(*Server) {
+	return func(s *Server) {
+		w, err := capture.NewWriter(dir, 1<<20, 10)
+		require.NoError(t, err)
+		s.SetCapture(w)
+	}
+}
+
+func Test_startRequestCapture(t *testing.T) {
+	config := newTestRuleConfig(t, filterapi.RouteRule{})
+	config.rulesByModel["gpt"].Capture = &filterapi.Capture{}
+	// The capture is not enabled.
+	require.Nil(t, startRequestCapture(config, slog.Default(), "gpt", map[string]string{}, nil))
+
+	config = newTestRuleConfig(t, filterapi.RouteRule{Capture: &filterapi.Capture{}}, withCaptureDir(t, t.TempDir()))
+	require.NotNil(t, startRequestCapture(config, slog.Default(), "gpt", map[string]string{}, nil))
+	require.Nil(t, startRequestCapture(config, slog.Default(), "unknown", map[string]string{}, nil))
+
+	config.rulesByModel["gpt"].Capture.HeaderOnly = true
+	require.Nil(t, startRequestCapture(config, slog.Default(), "gpt", map[string]string{}, nil))
+	require.Nil(t, startRequestCapture(config, slog.Default(), "gpt", map[string]string{"x-ai-eg-capture": "false"}, nil))
+	require.NotNil(t, startRequestCapture(config, slog.Default(), "gpt", map[string]string{"x-ai-eg-capture": "true"}, nil))
+
+	config.rulesByModel["gpt"].Capture = nil
+	require.Nil(t, startRequestCapture(config, slog.Default(), "gpt", map[string]string{"x-ai-eg-capture": "true"}, nil))
+}
+
+func Test_chatCompletionProcessor_requestCapture(t *testing.T) {
+	const request = `{"model":"gpt","messages":[{"role":"user","content":"hello"}]}`
+	const bedrockResponse = `{"output":{"message":{"role":"assistant","content":[{"text":"hi"}]}},"usage":{"inputTokens":1,"outputTokens":1,"totalTokens":2}}`
+
+	t.Run("response", func(t *testing.T) {
+		dir := t.TempDir()
+		config := newTestRuleConfig(t, filterapi.RouteRule{Capture: &filterapi.Capture{}}, withCaptureDir(t, dir))
+		metrics := &mockChatCompletionMetrics{}
+		rp := &chatCompletionProcessorRouterFilter{
+			config: config, logger: slog.Default(), metrics: metrics,
+			requestHeaders: map[string]string{":path": "/v1/chat/completions", "x-request-id": "req-1"},
+		}
+		_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(request)})
+		require.NoError(t, err)
+		require.NotNil(t, rp.capture)
+
+		up := &chatCompletionProcessorUpstreamFilter{
+			config: config, logger: slog.Default(), metrics: metrics, requestHeaders: rp.requestHeaders,
+		}
+		require.NoError(t, up.SetBackend(t.Context(), &filterapi.Backend{
+			Name: "backend", Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaAWSBedrock},
+		}, nil, rp))
+		_, err = up.ProcessRequestHeaders(t.Context(), nil)
+		require.NoError(t, err)
+		_, err = up.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":status", RawValue: []byte("200")}, {Key: "content-type", RawValue: []byte("application/json")},
+		}})
+		require.NoError(t, err)
+		res, err := up.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{Body: []byte(bedrockResponse), EndOfStream: true})
+		require.NoError(t, err)
+		rp.writeRequestCapture()
+
+		r, err := capture.Read(filepath.Join(dir, "req-1.json"))
+		require.NoError(t, err)
+		require.Equal(t, "req-1", r.ID)
+		require.Equal(t, "/v1/chat/completions", r.Path)
+		require.Equal(t, "ns/route/rule/0", r.Route)
+		require.Equal(t, "gpt", r.Model)
+		require.JSONEq(t, request, string(r.Request))
+		require.Nil(t, r.OriginalRequest)
+		require.Nil(t, r.LocalReply)
+		require.Len(t, r.Attempts, 1)
+		a := r.Attempts[0]
+		require.Equal(t, "backend", a.Backend)
+		require.Equal(t, filterapi.APISchemaAWSBedrock, a.Schema.Name)
+		require.False(t, a.Retry)
+		require.Equal(t, "/model/gpt/converse", a.RequestHeaders[":path"])
+		require.Contains(t, string(a.RequestBody), `"hello"`)
+		require.Equal(t, "200", a.ResponseHeaders[":status"])
+		require.Equal(t, [][]byte{[]byte(bedrockResponse)}, a.ResponseChunks)
+		require.Equal(t, [][]byte{res.GetResponseBody().Response.BodyMutation.GetBody()}, a.ClientResponseChunks)
+
+		// The replay with the same translator reproduces the captured translation.
+		replayed, err := ReplayChatCompletionAttempt(r, a)
+		require.NoError(t, err)
+		require.Equal(t, a.RequestHeaders, replayed.RequestHeaders)
+		require.Equal(t, a.RequestBody, replayed.RequestBody)
+		require.Equal(t, a.ClientResponseChunks, replayed.ClientResponseChunks)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		dir := t.TempDir()
+		config := newTestRuleConfig(t, filterapi.RouteRule{
+			Capture:       &filterapi.Capture{HeaderOnly: true},
+			RequestLimits: &filterapi.RequestLimits{MaxBodyBytes: 1},
+		}, withCaptureDir(t, dir))
+		rp := &chatCompletionProcessorRouterFilter{
+			config: config, logger: slog.Default(), metrics: &mockChatCompletionMetrics{},
+			requestHeaders: map[string]string{":path": "/v1/chat/completions", "x-request-id": "req-2", "x-ai-eg-capture": "true"},
+		}
+		res, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(request)})
+		require.NoError(t, err)
+		require.NotNil(t, res.GetImmediateResponse())
+		rp.writeRequestCapture()
+
+		r, err := capture.Read(filepath.Join(dir, "req-2.json"))
+		require.NoError(t, err)
+		// The request rejected before the translation is not captured unless the original request is.
+		require.Nil(t, r.Request)
+		require.Nil(t, r.OriginalRequest)
+		require.Empty(t, r.Attempts)
+		require.Equal(t, res.GetImmediateResponse().Body, r.LocalReply)
+		require.Equal(t, int(res.GetImmediateResponse().GetStatus().GetCode()), r.LocalReplyStatus)
+	})
+}
+
+func Test_chatCompletionProcessor_requestCaptureRedacted(t *testing.T) {
+	const request = `{"model":"gpt","messages":[{"role":"user","content":"mail jane@example.com"}]}`
+	for _, includeOriginal := range []bool{false, true} {
+		t.Run(fmt.Sprintf("include original %v", includeOriginal), func(t *testing.T) {
+			dir := t.TempDir()
+			config := newTestRuleConfig(t, filterapi.RouteRule{
+				Guardrails: piiTestGuardrails(filterapi.PIIActionMask),
+				Capture:    &filterapi.Capture{IncludeOriginalRequest: includeOriginal},
+			}, withCaptureDir(t, dir))
+			rp := &chatCompletionProcessorRouterFilter{
+				config: config, logger: slog.Default(), metrics: &mockChatCompletionMetrics{},
+				requestHeaders: map[string]string{":path": "/v1/chat/completions", "x-request-id": "req-1"},
+			}
+			_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{Body: []byte(request)})
+			require.NoError(t, err)
+			rp.writeRequestCapture()
+
+			r, err := capture.Read(filepath.Join(dir, "req-1.json"))
+			require.NoError(t, err)
+			// The request is captured after the redaction of the PII.
+			require.NotContains(t, string(r.Request), "jane@example.com")
+			if includeOriginal {
+				require.JSONEq(t, request, string(r.OriginalRequest))
+			} else {
+				require.Nil(t, r.OriginalRequest)
+			}
+		})
+	}
+}
+
+func Test_requestCapture_truncated(t *testing.T) {
+	c := &requestCapture{}
+	a := c.startAttempt(&filterapi.Backend{Name: "backend"}, false)
+	c.recordResponseBody(a, []byte("raw"), []byte("client"))
+	c.recordResponseBody(a, make([]byte, maxCaptureResponseBytes), nil)
+	c.recordResponseBody(a, []byte("raw"), []byte("client"))
+	require.True(t, c.record.Truncated)
+	require.Equal(t, [][]byte{[]byte("raw")}, a.ResponseChunks)
+	require.Equal(t, [][]byte{[]byte("client")}, a.ClientResponseChunks)
+}
+
+func TestReplayChatCompletionAttempt(t *testing.T) {
+	r := &capture.Record{Request: []byte(`{"model":"gpt","messages":[{"role":"user","content":"hello"}]}`)}
+	_, err := ReplayChatCompletionAttempt(r, &capture.Attempt{Schema: filterapi.VersionedAPISchema{Name: "Unknown"}})
+	require.ErrorContains(t, err, "failed to select translator")
+	_, err = ReplayChatCompletionAttempt(&capture.Record{Request: []byte("{")}, &capture.Attempt{})
+	require.ErrorContains(t, err, "failed to parse request body")
+
+	// The attempts without the response only have the translated request.
+	replayed, err := ReplayChatCompletionAttempt(r, &capture.Attempt{
+		Backend: "backend", Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+		ModelNameOverride: "gpt-4o",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "backend", replayed.Backend)
+	require.Contains(t, string(replayed.RequestBody), `"gpt-4o"`)
+	require.Nil(t, replayed.ClientResponseChunks)
+
+	// The captured request is translated rather than the original one.
+	r.OriginalRequest = r.Request
+	r.Request = []byte(`{"model":"gpt","messages":[{"role":"user","content":"[REDACTED]"}]}`)
+	replayed, err = ReplayChatCompletionAttempt(r, &capture.Attempt{
+		Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaAWSBedrock},
+	})
+	require.NoError(t, err)
+	require.Contains(t, string(replayed.RequestBody), `"[REDACTED]"`)
+}
@@ -0,0 +1,127 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"fmt"
+	"slices"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+// enforceRequestLimits checks the raw chat completion request body against the request limits of the rule of the
+// model.
+//
+// This returns the request body with the max tokens and the n clamped and the parameters not allowed removed when
+// the limits are in the clamp mode, which is nil if the body is not modified. When the request violates the limits,
+// this returns the local reply rejecting the request with 400 Bad Request instead.
+func enforceRequestLimits(config *processorConfig, model string, raw []byte) (clamped []byte, rejected *extprocv3.ProcessingResponse) {
+	rule := config.rulesByModel[model]
+	if rule == nil || rule.RequestLimits == nil {
+		return nil, nil
+	}
+	l := rule.RequestLimits
+	if l.MaxBodyBytes > 0 && int64(len(raw)) > l.MaxBodyBytes {
+		return nil, requestLimitError("request_too_large", "",
+			fmt.Sprintf("The request body is %d bytes, exceeding the limit of %d bytes.", len(raw), l.MaxBodyBytes))
+	}
+	messages := gjson.GetBytes(raw, "messages").Array()
+	if l.MaxMessages > 0 && len(messages) > l.MaxMessages {
+		return nil, requestLimitError("too_many_messages", "messages",
+			fmt.Sprintf("The request has %d messages, exceeding the limit of %d.", len(messages), l.MaxMessages))
+	}
+	promptBytes, images := promptSize(messages)
+	if l.MaxPromptBytes > 0 && promptBytes > l.MaxPromptBytes {
+		return nil, requestLimitError("prompt_too_large", "messages",
+			fmt.Sprintf("The text of the messages is %d bytes, exceeding the limit of %d bytes.", promptBytes, l.MaxPromptBytes))
+	}
+	if l.MaxImages != nil && images > *l.MaxImages {
+		return nil, requestLimitError("too_many_images", "messages",
+			fmt.Sprintf("The request has %d images, exceeding the limit of %d.", images, *l.MaxImages))
+	}
+
+	modified := false
+	var notAllowed []string
+	gjson.ParseBytes(raw).ForEach(func(key, _ gjson.Result) bool {
+		if !parameterAllowed(l, key.Str) {
+			notAllowed = append(notAllowed, key.Str)
+		}
+		return true
+	})
+	for _, param := range notAllowed {
+		if !l.Clamp {
+			return nil, requestLimitError("parameter_not_allowed", param, fmt.Sprintf("The parameter %s is not allowed.", param))
+		}
+		if b, err := sjson.DeleteBytes(raw, gjson.Escape(param)); err == nil {
+			raw, modified = b, true
+		}
+	}
+	for _, limit := range []struct {
+		param string
+		max   int64
+	}{
+		{param: "max_tokens", max: l.MaxTokens},
+		{param: "max_completion_tokens", max: l.MaxTokens},
+		{param: "n", max: int64(l.MaxN)},
+	} {
+		v := gjson.GetBytes(raw, limit.param)
+		if limit.max == 0 || v.Type != gjson.Number || v.Int() <= limit.max {
+			continue
+		}
+		if !l.Clamp {
+			return nil, requestLimitError(limit.param+"_too_large", limit.param,
+				fmt.Sprintf("The %s %d exceeds the limit of %d.", limit.param, v.Int(), limit.max))
+		}
+		if b, err := sjson.SetBytes(raw, limit.param, limit.max); err == nil {
+			raw, modified = b, true
+		}
+	}
+	if !modified {
+		return nil, nil
+	}
+	return raw, nil
+}
+
+// parameterAllowed returns true if the top-level parameter of the request is allowed by the limits.
+func parameterAllowed(l *filterapi.RequestLimits, param string) bool {
+	if param == "model" || param == "messages" {
+		return true
+	}
+	if len(l.AllowedParameters) > 0 {
+		return slices.Contains(l.AllowedParameters, param)
+	}
+	return !slices.Contains(l.ForbiddenParameters, param)
+}
+
+// promptSize returns the total size in bytes of the text content of the messages, and the number of the image parts.
+func promptSize(messages []gjson.Result) (textBytes int64, images int) {
+	for _, msg := range messages {
+		content := msg.Get("content")
+		if content.Type == gjson.String {
+			textBytes += int64(len(content.Str))
+			continue
+		}
+		for _, part := range content.Array() {
+			switch part.Get("type").String() {
+			case "text":
+				textBytes += int64(len(part.Get("text").String()))
+			case "image_url":
+				images++
+			}
+		}
+	}
+	return
+}
+
+// requestLimitError returns the local reply rejecting the request violating the limits.
+func requestLimitError(code, param, message string) *extprocv3.ProcessingResponse {
+	return openAIParamErrorResponse(typev3.StatusCode_BadRequest, code, param, message)
+}
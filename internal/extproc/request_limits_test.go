@@ -0,0 +1,154 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+)
+
+func Test_enforceRequestLimits(t *testing.T) {
+	limits := filterapi.RequestLimits{
+		MaxBodyBytes:        1024,
+		MaxPromptBytes:      10,
+		MaxMessages:         2,
+		MaxImages:           ptr.To(1),
+		MaxTokens:           100,
+		MaxN:                2,
+		ForbiddenParameters: []string{"logprobs", "top_logprobs"},
+	}
+	image := `{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}`
+	for _, tc := range []struct {
+		name, body        string
+		expCode, expParam string
+		expClamped        string
+		allowedParameters []string
+	}{
+		{name: "within limits", body: `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_tokens":100,"n":2}`},
+		{name: "other model", body: `{"model":"other","messages":[{"role":"user","content":"hello world!"}]}`},
+		{
+			name: "body", body: `{"model":"gpt","messages":[{"role":"user","content":"` + strings.Repeat("a", 1024) + `"}]}`,
+			expCode: "request_too_large",
+		},
+		{
+			name:    "messages",
+			body:    `{"model":"gpt","messages":[{"role":"system","content":"a"},{"role":"user","content":"b"},{"role":"user","content":"c"}]}`,
+			expCode: "too_many_messages", expParam: "messages",
+		},
+		{
+			name:    "prompt",
+			body:    `{"model":"gpt","messages":[{"role":"system","content":"hello"},{"role":"user","content":[{"type":"text","text":"world!"}]}]}`,
+			expCode: "prompt_too_large", expParam: "messages",
+		},
+		{
+			name:    "images",
+			body:    `{"model":"gpt","messages":[{"role":"user","content":[` + image + `,` + image + `]}]}`,
+			expCode: "too_many_images", expParam: "messages",
+		},
+		{
+			name:    "forbidden parameter",
+			body:    `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"logprobs":true}`,
+			expCode: "parameter_not_allowed", expParam: "logprobs",
+			expClamped: `{"model":"gpt","messages":[{"role":"user","content":"hello"}]}`,
+		},
+		{
+			name:              "not allowed parameter",
+			body:              `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"temperature":0.5,"seed":1}`,
+			allowedParameters: []string{"temperature"},
+			expCode:           "parameter_not_allowed", expParam: "seed",
+			expClamped: `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"temperature":0.5}`,
+		},
+		{
+			name:    "max tokens",
+			body:    `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_tokens":100000}`,
+			expCode: "max_tokens_too_large", expParam: "max_tokens",
+			expClamped: `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_tokens":100}`,
+		},
+		{
+			name:    "max completion tokens",
+			body:    `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_completion_tokens":101}`,
+			expCode: "max_completion_tokens_too_large", expParam: "max_completion_tokens",
+			expClamped: `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_completion_tokens":100}`,
+		},
+		{
+			name:    "n and forbidden parameter",
+			body:    `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"n":8,"logprobs":true}`,
+			expCode: "parameter_not_allowed", expParam: "logprobs",
+			expClamped: `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"n":2}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, clamp := range []bool{false, true} {
+				l := limits
+				l.Clamp = clamp
+				if tc.allowedParameters != nil {
+					l.AllowedParameters, l.ForbiddenParameters = tc.allowedParameters, nil
+				}
+				clamped, rejected := enforceRequestLimits(newTestRuleConfig(t, filterapi.RouteRule{RequestLimits: &l}), modelOf(t, tc.body), []byte(tc.body))
+				switch {
+				case tc.expCode == "":
+					require.Nil(t, rejected)
+					require.Nil(t, clamped)
+				case clamp && tc.expClamped != "":
+					require.Nil(t, rejected)
+					require.JSONEq(t, tc.expClamped, string(clamped))
+				default:
+					require.Nil(t, clamped)
+					requireOpenAIError(t, rejected, typev3.StatusCode_BadRequest, tc.expCode)
+					var body openai.Error
+					require.NoError(t, json.Unmarshal(rejected.GetImmediateResponse().Body, &body))
+					if tc.expParam == "" {
+						require.Nil(t, body.Error.Param)
+					} else {
+						require.Equal(t, tc.expParam, *body.Error.Param)
+					}
+				}
+			}
+		})
+	}
+}
+
+// modelOf returns the model of the request body.
+func modelOf(t *testing.T, body string) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	return req.Model
+}
+
+func Test_chatCompletionProcessor_requestLimits(t *testing.T) {
+	config := newTestRuleConfig(t, filterapi.RouteRule{RequestLimits: &filterapi.RequestLimits{Clamp: true, MaxTokens: 100}})
+	metrics := &mockChatCompletionMetrics{}
+	rp := &chatCompletionProcessorRouterFilter{
+		config:         config,
+		logger:         slog.Default(),
+		metrics:        metrics,
+		requestHeaders: map[string]string{":path": "/v1/chat/completions"},
+	}
+	_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{
+		Body: []byte(`{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_tokens":100000}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(100), *rp.originalRequestBody.MaxTokens)
+
+	// The clamped body is sent even though the OpenAI translator does not modify it.
+	up := newGuardrailUpstreamTest(t, rp, metrics)
+	res, err := up.ProcessRequestHeaders(t.Context(), nil)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_tokens":100}`,
+		string(res.GetRequestHeaders().Response.BodyMutation.GetBody()))
+}
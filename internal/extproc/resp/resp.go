@@ -0,0 +1,186 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package resp provides a minimal client of the Redis serialization protocol (RESP) spoken by the servers such as
+// Redis or Valkey, which is shared by the stores of the external processor backed by such servers.
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxIdleConns is the maximum number of the idle connections kept by the Client.
+	maxIdleConns = 16
+	// timeout is the timeout of the dial and each round trip when the context has no deadline.
+	timeout = time.Second
+)
+
+type (
+	// Client is the client of the server at an address. The connections are established lazily and reused.
+	Client struct {
+		addr string
+		idle chan *conn
+	}
+	conn struct {
+		conn net.Conn
+		r    *bufio.Reader
+		w    *bufio.Writer
+	}
+	// Error is the error reply from the server.
+	Error string
+)
+
+// Error implements [error].
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// NewClient creates a new [Client] of the server at the given address in the form of "host:port".
+func NewClient(addr string) *Client {
+	return &Client{addr: addr, idle: make(chan *conn, maxIdleConns)}
+}
+
+// Close closes the idle connections.
+func (s *Client) Close() error {
+	for {
+		select {
+		case c := <-s.idle:
+			_ = c.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Do sends the commands in a pipeline and returns their replies. The reply is a string for the simple and bulk
+// strings, int64 for the integers, []any for the arrays, nil for the null values, and [Error] for the errors.
+// An error reply to any of the commands is returned as the error after all the replies are read.
+func (s *Client) Do(ctx context.Context, cmds ...[]string) ([]any, error) {
+	c, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(timeout)
+	}
+	replies, err := c.roundTrip(deadline, cmds)
+	if err != nil {
+		_ = c.conn.Close()
+		return nil, err
+	}
+	select {
+	case s.idle <- c:
+	default:
+		_ = c.conn.Close()
+	}
+	var errs []error
+	for _, r := range replies {
+		if e, ok := r.(Error); ok {
+			errs = append(errs, e)
+		}
+	}
+	return replies, errors.Join(errs...)
+}
+
+// dial returns an idle connection or establishes a new one.
+func (s *Client) dial(ctx context.Context) (*conn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+	d := net.Dialer{Timeout: timeout}
+	nc, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: failed to connect to %s: %w", s.addr, err)
+	}
+	return &conn{conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}, nil
+}
+
+// roundTrip writes the commands and reads the same number of replies.
+func (c *conn) roundTrip(deadline time.Time, cmds [][]string) ([]any, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		writeCommand(c.w, cmd)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, fmt.Errorf("redis: failed to write commands: %w", err)
+	}
+	replies := make([]any, len(cmds))
+	for i := range cmds {
+		var err error
+		if replies[i], err = ReadReply(c.r); err != nil {
+			return nil, fmt.Errorf("redis: failed to read reply: %w", err)
+		}
+	}
+	return replies, nil
+}
+
+// writeCommand writes the command as an array of bulk strings.
+func writeCommand(w *bufio.Writer, cmd []string) {
+	_, _ = fmt.Fprintf(w, "*%d\r\n", len(cmd))
+	for _, arg := range cmd {
+		_, _ = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// ReadReply reads a reply in the same form as the replies returned by [Client.Do].
+func ReadReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply line %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return Error(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed bulk string length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed array length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		ret := make([]any, n)
+		for i := range ret {
+			if ret[i], err = ReadReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", kind)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package resp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadReply(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		exp any
+	}{
+		{in: "+OK\r\n", exp: "OK"},
+		{in: "-ERR foo\r\n", exp: Error("ERR foo")},
+		{in: ":42\r\n", exp: int64(42)},
+		{in: "$3\r\nfoo\r\n", exp: "foo"},
+		{in: "$-1\r\n", exp: nil},
+		{in: "*2\r\n$1\r\na\r\n:1\r\n", exp: []any{"a", int64(1)}},
+		{in: "*-1\r\n", exp: nil},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			v, err := ReadReply(bufio.NewReader(strings.NewReader(tc.in)))
+			require.NoError(t, err)
+			require.Equal(t, tc.exp, v)
+		})
+	}
+	for _, in := range []string{"", "?x\r\n", "+OK\n", "$x\r\n", "*x\r\n", "$5\r\nfoo\r\n"} {
+		_, err := ReadReply(bufio.NewReader(strings.NewReader(in)))
+		require.Error(t, err, in)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package resptest provides a fake server speaking the Redis serialization protocol for the tests of the stores
+// backed by the Redis servers.
+package resptest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/resp"
+)
+
+// Server is a fake server speaking the subset of the Redis commands used by the stores, which are GET, SET with the
+// expiration, INCRBY and EXPIREAT.
+type Server struct {
+	lis    net.Listener
+	mu     sync.Mutex
+	values map[string]string
+	// expirations is the arguments of the last expiration of the keys, e.g., "PX 90000" or "EXPIREAT 1735776000".
+	expirations map[string]string
+	// conns is the number of the accepted connections.
+	conns int
+}
+
+// NewServer starts a new [Server] which is closed when the test finishes.
+func NewServer(t *testing.T) *Server {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &Server{lis: lis, values: map[string]string{}, expirations: map[string]string{}}
+	t.Cleanup(func() { _ = lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// Addr returns the address of the server.
+func (s *Server) Addr() string { return s.lis.Addr().String() }
+
+// Expiration returns the arguments of the last expiration of the key.
+func (s *Server) Expiration(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expirations[key]
+}
+
+// Conns returns the number of the connections accepted so far.
+func (s *Server) Conns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		v, err := resp.ReadReply(r)
+		if err != nil {
+			return
+		}
+		args, _ := v.([]any)
+		s.mu.Lock()
+		switch cmd := args[0].(string); cmd {
+		case "GET":
+			if v, ok := s.values[args[1].(string)]; ok {
+				_, _ = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				_, _ = w.WriteString("$-1\r\n")
+			}
+		case "SET":
+			s.values[args[1].(string)] = args[2].(string)
+			var expiration []string
+			for _, a := range args[3:] {
+				expiration = append(expiration, a.(string))
+			}
+			s.expirations[args[1].(string)] = strings.Join(expiration, " ")
+			_, _ = w.WriteString("+OK\r\n")
+		case "INCRBY":
+			value, _ := strconv.ParseInt(s.values[args[1].(string)], 10, 64)
+			delta, _ := strconv.ParseInt(args[2].(string), 10, 64)
+			value += delta
+			s.values[args[1].(string)] = strconv.FormatInt(value, 10)
+			_, _ = fmt.Fprintf(w, ":%d\r\n", value)
+		case "EXPIREAT":
+			s.expirations[args[1].(string)] = "EXPIREAT " + args[2].(string)
+			_, _ = w.WriteString(":1\r\n")
+		default:
+			_, _ = fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", cmd)
+		}
+		s.mu.Unlock()
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
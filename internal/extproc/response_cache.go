@@ -0,0 +1,326 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/responsecache"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+)
+
+const (
+	// responseCacheStoreTimeout is the timeout of the operations on the response cache store.
+	responseCacheStoreTimeout = time.Second
+	// responseCacheExact is the kind of the response cache keyed on the exact request recorded in the metrics.
+	responseCacheExact = "exact"
+	// responseCacheSemantic is the kind of the response cache looked up by the similarity of the last user message
+	// recorded in the metrics.
+	responseCacheSemantic = "semantic"
+	// responseCacheHitMetadataKey is the key of the dynamic metadata set to true when the response is served from
+	// the response cache.
+	responseCacheHitMetadataKey = "response_cache_hit"
+)
+
+// routerFilterMetrics is the interface for the metrics recorded by the router filters before the backend is selected.
+type routerFilterMetrics interface {
+	metrics.GuardrailMetrics
+	metrics.ResponseCacheMetrics
+}
+
+// responseCache is the lookup of a request in the response cache of the route rule, which stores the response of
+// the backend returned to the client when the request missed the cache.
+type responseCache struct {
+	config *processorConfig
+	cache  *filterapi.ResponseCache
+	key    string
+	// semanticScope and embedding are the scope of the request and the embedding of its last user message in the
+	// semantic index, which are set when the response is added to the semantic index on store.
+	semanticScope string
+	embedding     []float64
+	// response is the response body returned to the client accumulated to be stored, and overflowed is true if it
+	// exceeds the max entry size of the cache.
+	response   []byte
+	overflowed bool
+}
+
+// lookupResponseCache looks up the request in the response cache of the route rule of the model. This returns nil
+// if the response cache does not apply to the request, as well as the cached response body if the request hits.
+// The result of the lookup is recorded in the metrics.
+//
+// The lookup is skipped for the requests with the "Cache-Control: no-cache" header, whose responses still replace
+// the cached ones, while the requests with the "Cache-Control: no-store" header neither look up nor store the cache.
+// When the rule has the semantic cache, the request missing the exact match is looked up in the semantic index.
+func lookupResponseCache(ctx context.Context, config *processorConfig, logger *slog.Logger, metrics metrics.ResponseCacheMetrics,
+	model string, requestHeaders map[string]string, request []byte, metricAttrs ...attribute.KeyValue,
+) (*responseCache, []byte) {
+	rule := config.rulesByModel[model]
+	if rule == nil || rule.ResponseCache == nil || config.responseCacheStore == nil {
+		return nil, nil
+	}
+	noCache, noStore := cacheControlDirectives(requestHeaders["cache-control"])
+	if noStore {
+		return nil, nil
+	}
+	consumer := responseCacheConsumer(ctx, rule.ResponseCache, requestHeaders)
+	if consumer == "" {
+		// The responses of the requests whose consumer cannot be identified must not be shared with the others.
+		return nil, nil
+	}
+	key, err := responseCacheKey(rule.Name, model, consumer, request)
+	if err != nil {
+		logger.Error("failed to calculate the response cache key", slog.String("error", err.Error()))
+		return nil, nil
+	}
+	c := &responseCache{config: config, cache: rule.ResponseCache, key: key}
+	var cached []byte
+	if !noCache {
+		cached = c.get(ctx, logger, key)
+		metrics.RecordResponseCacheLookups(ctx, responseCacheExact, cached != nil, 1, metricAttrs...)
+	}
+	if cached == nil && rule.ResponseCache.Semantic != nil {
+		cached = c.lookupSemantic(ctx, logger, metrics, rule.Name, model, consumer, requestHeaders, request, noCache, metricAttrs...)
+	}
+	return c, cached
+}
+
+// lookupSemantic embeds the last user message of the request and looks up the most similar cached request in the
+// same scope, returning its cached response if the similarity reaches the threshold. The lookup is skipped when
+// skipLookup is true, but the embedding is still kept so that the response is added to the semantic index.
+//
+// The request is sent to the backend without the semantic cache when the embedding fails, so that the outage of the
+// embedding backends does not affect the chat completions.
+func (c *responseCache) lookupSemantic(ctx context.Context, logger *slog.Logger, metrics metrics.ResponseCacheMetrics,
+	rule filterapi.RouteRuleName, model, consumer string, requestHeaders map[string]string, request []byte, skipLookup bool,
+	metricAttrs ...attribute.KeyValue,
+) []byte {
+	sc := c.cache.Semantic
+	text, scope, err := semanticCacheScope(rule, model, consumer, request)
+	if err != nil {
+		logger.Error("failed to calculate the semantic cache scope", slog.String("error", err.Error()))
+		return nil
+	}
+	if text == "" {
+		return nil
+	}
+	header := http.Header{}
+	if auth := requestHeaders["authorization"]; auth != "" {
+		header.Set("authorization", auth)
+	}
+	embedCtx, cancel := context.WithTimeout(ctx, sc.Timeout)
+	defer cancel()
+	embedding, err := responsecache.NewHTTPEmbedder(sc.Endpoint).Embed(embedCtx, sc.EmbeddingModel, text, header)
+	if err != nil {
+		logger.Error("failed to embed the last user message for the semantic cache", slog.String("error", err.Error()))
+		return nil
+	}
+	c.semanticScope, c.embedding = scope, embedding
+	if skipLookup {
+		return nil
+	}
+	var cached []byte
+	if key, similarity, ok := c.config.semanticIndex.Search(scope, embedding); ok {
+		metrics.RecordResponseCacheSimilarity(ctx, similarity, metricAttrs...)
+		if similarity >= sc.SimilarityThreshold {
+			if cached = c.get(ctx, logger, key); cached == nil {
+				// The cached response has expired or been evicted from the store.
+				c.config.semanticIndex.Remove(scope, key)
+			}
+		}
+	}
+	metrics.RecordResponseCacheLookups(ctx, responseCacheSemantic, cached != nil, 1, metricAttrs...)
+	return cached
+}
+
+// semanticCacheScope returns the text of the last user message of the request and the scope of the request in the
+// semantic index, which is the hash of the request without the content of the last user message. Only the requests
+// identical except for the last user message are compared by the similarity.
+//
+// The text is empty if the request has no user message, or the last user message has the non-text parts such as
+// the images, which are not embedded.
+func semanticCacheScope(rule filterapi.RouteRuleName, model, consumer string, request []byte) (text, scope string, err error) {
+	messages := gjson.GetBytes(request, "messages").Array()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Get("role").Str != "user" {
+			continue
+		}
+		content := messages[i].Get("content")
+		if content.Type == gjson.String {
+			text = content.Str
+		} else {
+			var texts []string
+			for _, part := range content.Array() {
+				if part.Get("type").Str != "text" {
+					return "", "", nil
+				}
+				texts = append(texts, part.Get("text").Str)
+			}
+			text = strings.Join(texts, "\n")
+		}
+		rest, err := sjson.DeleteBytes(request, fmt.Sprintf("messages.%d.content", i))
+		if err != nil {
+			return "", "", fmt.Errorf("failed to remove the last user message: %w", err)
+		}
+		scope, err = responseCacheKey(rule, model, consumer, rest)
+		return text, scope, err
+	}
+	return "", "", nil
+}
+
+// get returns the cached response of the key, or nil if it is not found. The errors are only logged since the
+// request is sent to the backend rather than failing while the store is unavailable.
+func (c *responseCache) get(ctx context.Context, logger *slog.Logger, key string) []byte {
+	ctx, cancel := context.WithTimeout(ctx, responseCacheStoreTimeout)
+	defer cancel()
+	cached, err := c.config.responseCacheStore.Get(ctx, key)
+	if err != nil {
+		logger.Error("failed to get the cached response", slog.String("error", err.Error()))
+	}
+	return cached
+}
+
+// responseCacheConsumer returns the consumer of the request sharing the cached responses, which is "*" when the
+// cached responses are shared by all the callers, or empty if the consumer cannot be identified.
+func responseCacheConsumer(ctx context.Context, rc *filterapi.ResponseCache, requestHeaders map[string]string) string {
+	switch {
+	case rc.ConsumerHeader != "":
+		return requestHeaders[strings.ToLower(rc.ConsumerHeader)]
+	case rc.ConsumerJWTClaim != "":
+		return jwtClaim(ctx, rc.ConsumerJWTClaim)
+	default:
+		return "*"
+	}
+}
+
+// cacheControlDirectives returns whether the Cache-Control header value has the no-cache and no-store directives.
+func cacheControlDirectives(value string) (noCache, noStore bool) {
+	for _, d := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(d)) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noStore = true
+		}
+	}
+	return
+}
+
+// responseCacheKey returns the key of the request in the response cache. The request body is normalized so that the
+// same JSON regardless of the order of the fields and the whitespaces has the same key.
+func responseCacheKey(rule filterapi.RouteRuleName, model, consumer string, request []byte) (string, error) {
+	d := json.NewDecoder(bytes.NewReader(request))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return "", fmt.Errorf("failed to decode request body: %w", err)
+	}
+	// The keys of the maps are sorted by the encoder.
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request body: %w", err)
+	}
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(rule), []byte(model), []byte(consumer), normalized} {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hitResponse returns the local reply serving the cached response body. The cost metadata is set with zero tokens
+// so that the cached responses are not charged to the rate limits.
+func (c *responseCache) hitResponse(requestHeaders map[string]string, stream bool, cached []byte) (*extprocv3.ProcessingResponse, error) {
+	contentType := "application/json"
+	if stream {
+		contentType = "text/event-stream"
+	}
+	return responseCacheHitResponse(c.config, requestHeaders, contentType, cached)
+}
+
+// responseCacheHitResponse returns the local reply serving the response body from the response cache, whose cost
+// metadata is set with zero tokens.
+func responseCacheHitResponse(config *processorConfig, requestHeaders map[string]string, contentType string, body []byte) (*extprocv3.ProcessingResponse, error) {
+	headers := &extprocv3.HeaderMutation{}
+	setHeader(headers, "content-type", contentType)
+	setHeader(headers, internalapi.ResponseCacheHeader, "hit")
+	metadata, err := buildDynamicMetadata(config, newRequestCostContext(config, &translator.LLMTokenUsage{}, nil, requestHeaders, ""), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build dynamic metadata: %w", err)
+	}
+	if metadata == nil {
+		metadata = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	}
+	ns := metadata.Fields[config.metadataNamespace].GetStructValue()
+	if ns == nil {
+		ns = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+		metadata.Fields[config.metadataNamespace] = structpb.NewStructValue(ns)
+	}
+	ns.Fields[responseCacheHitMetadataKey] = structpb.NewBoolValue(true)
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &extprocv3.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode_OK},
+				Headers: headers,
+				Body:    body,
+			},
+		},
+		DynamicMetadata: metadata,
+	}, nil
+}
+
+// missHeader returns the response header marking the response from the backend.
+func (c *responseCache) missHeader() *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: internalapi.ResponseCacheHeader, RawValue: []byte("miss")}}
+}
+
+// append appends the chunk of the response body returned to the client.
+func (c *responseCache) append(chunk []byte) {
+	if c.overflowed {
+		return
+	}
+	if len(c.response)+len(chunk) > c.cache.MaxEntryBytes {
+		c.overflowed, c.response = true, nil
+		return
+	}
+	c.response = append(c.response, chunk...)
+}
+
+// store stores the accumulated response body in the cache. The errors are only logged since the response is already
+// sent to the client.
+func (c *responseCache) store(ctx context.Context, logger *slog.Logger) {
+	if c.overflowed || len(c.response) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, responseCacheStoreTimeout)
+	defer cancel()
+	if err := c.config.responseCacheStore.Set(ctx, c.key, c.response, c.cache.TTL); err != nil {
+		logger.Error("failed to store the response in the cache", slog.String("error", err.Error()))
+		return
+	}
+	if c.embedding != nil {
+		c.config.semanticIndex.Add(c.semanticScope, c.embedding, c.key, c.cache.TTL, c.cache.Semantic.MaxEntries)
+	}
+}
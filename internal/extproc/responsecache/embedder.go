@@ -0,0 +1,74 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package responsecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+)
+
+// maxEmbeddingResponseSize is the maximum size of the response of the embeddings endpoint.
+const maxEmbeddingResponseSize = 16 << 20
+
+// Embedder embeds the text for the [SemanticIndex]. The deadline of the call is set by the context.
+type Embedder interface {
+	// Embed returns the embedding of the input by the model. The header is added to the embedding request.
+	Embed(ctx context.Context, model, input string, header http.Header) ([]float64, error)
+}
+
+// NewHTTPEmbedder creates a new [Embedder] POSTing the OpenAI embedding request to the URL of the embeddings
+// endpoint, which is usually the one of the Gateway itself so that the embedding backends of the Gateway are used.
+func NewHTTPEmbedder(url string) Embedder {
+	return &httpEmbedder{url: url, client: http.DefaultClient}
+}
+
+type httpEmbedder struct {
+	url    string
+	client *http.Client
+}
+
+// Embed implements [Embedder.Embed].
+func (e *httpEmbedder) Embed(ctx context.Context, model, input string, header http.Header) ([]float64, error) {
+	body, err := json.Marshal(struct {
+		Model string `json:"model"`
+		Input string `json:"input"`
+	}{Model: model, Input: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("content-type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call the embeddings endpoint: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var res openai.EmbeddingResponse
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxEmbeddingResponseSize)).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(res.Data) != 1 || len(res.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("unexpected number of embeddings %d", len(res.Data))
+	}
+	return res.Data[0].Embedding, nil
+}
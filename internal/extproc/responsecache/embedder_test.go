@@ -0,0 +1,48 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package responsecache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPEmbedder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+			Input string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "application/json", r.Header.Get("content-type"))
+		require.Equal(t, "Bearer key", r.Header.Get("authorization"))
+		switch req.Input {
+		case "hello":
+			require.Equal(t, "text-embedding-3-small", req.Model)
+			_, _ = w.Write([]byte(`{"object":"list","data":[{"object":"embedding","embedding":[0.1,0.2],"index":0}]}`))
+		case "empty":
+			_, _ = w.Write([]byte(`{"object":"list","data":[]}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	e := NewHTTPEmbedder(srv.URL)
+	header := http.Header{"Authorization": []string{"Bearer key"}}
+	v, err := e.Embed(t.Context(), "text-embedding-3-small", "hello", header)
+	require.NoError(t, err)
+	require.Equal(t, []float64{0.1, 0.2}, v)
+
+	_, err = e.Embed(t.Context(), "text-embedding-3-small", "empty", header)
+	require.ErrorContains(t, err, "unexpected number of embeddings 0")
+	_, err = e.Embed(t.Context(), "text-embedding-3-small", "other", header)
+	require.ErrorContains(t, err, "unexpected status code 401")
+}
@@ -0,0 +1,87 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package responsecache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/resp"
+)
+
+// redisKeyPrefix is the prefix of the keys of the entries in the server, so that they don't collide with the keys
+// of the other users of the same server.
+const redisKeyPrefix = "aigw:responsecache:"
+
+// NewRedisStore creates a new [Store] which keeps the entries in the server speaking the Redis protocol (RESP),
+// such as Redis or Valkey, at the given address in the form of "host:port".
+//
+// The entries are shared across the external processor instances connected to the same server, and their eviction
+// beyond the TTL is up to the configuration of the server such as maxmemory-policy. This only relies on the GET and
+// SET commands pipelined for the multiple entries, and the connections are established lazily.
+func NewRedisStore(addr string) Store {
+	return &redisStore{c: resp.NewClient(addr)}
+}
+
+// redisStore implements [Store] with the RESP client.
+type redisStore struct {
+	c *resp.Client
+}
+
+// Get implements [Store.Get].
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	values, err := s.GetMany(ctx, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// Set implements [Store.Set].
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.SetMany(ctx, []string{key}, [][]byte{value}, ttl)
+}
+
+// GetMany implements [Store.GetMany]. The GET commands are sent in a pipeline.
+func (s *redisStore) GetMany(ctx context.Context, keys []string) ([][]byte, error) {
+	cmds := make([][]string, len(keys))
+	for i, key := range keys {
+		cmds[i] = []string{"GET", redisKeyPrefix + key}
+	}
+	replies, err := s.c.Do(ctx, cmds...)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for i, r := range replies {
+		switch v := r.(type) {
+		case nil:
+		case string:
+			values[i] = []byte(v)
+		default:
+			return nil, fmt.Errorf("redis: unexpected GET reply: %v", v)
+		}
+	}
+	return values, nil
+}
+
+// SetMany implements [Store.SetMany]. The SET commands are sent in a pipeline.
+func (s *redisStore) SetMany(ctx context.Context, keys []string, values [][]byte, ttl time.Duration) error {
+	px := strconv.FormatInt(ttl.Milliseconds(), 10)
+	cmds := make([][]string, len(keys))
+	for i, key := range keys {
+		cmds[i] = []string{"SET", redisKeyPrefix + key, string(values[i]), "PX", px}
+	}
+	_, err := s.c.Do(ctx, cmds...)
+	return err
+}
+
+// Close implements [Store.Close].
+func (s *redisStore) Close() error {
+	return s.c.Close()
+}
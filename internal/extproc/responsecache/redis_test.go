@@ -0,0 +1,47 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package responsecache
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/resp/resptest"
+)
+
+func TestRedisStore(t *testing.T) {
+	srv := resptest.NewServer(t)
+	s := NewRedisStore(srv.Addr())
+	defer func() { require.NoError(t, s.Close()) }()
+
+	v, err := s.Get(t.Context(), "a")
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	require.NoError(t, s.Set(t.Context(), "a", []byte("data: {}\r\n\r\n"), 90*time.Second))
+	v, err = s.Get(t.Context(), "a")
+	require.NoError(t, err)
+	require.Equal(t, []byte("data: {}\r\n\r\n"), v)
+	require.Equal(t, "PX 90000", srv.Expiration("aigw:responsecache:a"))
+
+	require.NoError(t, s.SetMany(t.Context(), []string{"b", "c"}, [][]byte{[]byte("[0.1]"), []byte("[0.2]")}, time.Minute))
+	values, err := s.GetMany(t.Context(), []string{"c", "d", "b"})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("[0.2]"), nil, []byte("[0.1]")}, values)
+	require.Equal(t, "PX 60000", srv.Expiration("aigw:responsecache:b"))
+
+	t.Run("connection failure", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := lis.Addr().String()
+		require.NoError(t, lis.Close())
+		_, err = NewRedisStore(addr).Get(t.Context(), "a")
+		require.ErrorContains(t, err, "failed to connect")
+	})
+}
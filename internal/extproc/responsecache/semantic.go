@@ -0,0 +1,151 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package responsecache
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// semanticIndexSweepInterval is the interval at which the expired entries of all the scopes are removed, since the
+// scopes which are no longer searched would otherwise keep their entries forever.
+const semanticIndexSweepInterval = time.Minute
+
+// SemanticIndex is the in-memory index of the embeddings of the cached requests, which finds the cached request
+// most similar to a new one by the cosine similarity of their embeddings. This is safe for concurrent use.
+//
+// The embeddings are grouped by the scope, and only the ones in the same scope are compared. Each entry refers to
+// the key of the cached response in the [Store] rather than holding the response itself.
+type SemanticIndex struct {
+	mu     sync.Mutex
+	scopes map[string][]semanticEntry
+	// nextSweep is the time after which the expired entries of all the scopes are removed on the next addition.
+	nextSweep time.Time
+	// now is the function to get the current time, which is replaced in tests.
+	now func() time.Time
+}
+
+type semanticEntry struct {
+	// vector is the embedding normalized to the unit length.
+	vector   []float64
+	key      string
+	expireAt time.Time
+}
+
+// NewSemanticIndex creates a new empty [SemanticIndex].
+func NewSemanticIndex() *SemanticIndex {
+	return &SemanticIndex{scopes: make(map[string][]semanticEntry), now: time.Now}
+}
+
+// Search returns the key of the entry in the scope most similar to the embedding together with the cosine
+// similarity, or false if the scope has no entry. The expired entries are removed on the way.
+//
+// The scope is scanned linearly, which is fast enough for the thousands of the entries per scope.
+func (s *SemanticIndex) Search(scope string, embedding []float64) (key string, similarity float64, ok bool) {
+	vector := normalize(embedding)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	entries := s.scopes[scope]
+	live := entries[:0]
+	for _, e := range entries {
+		if !now.Before(e.expireAt) {
+			continue
+		}
+		live = append(live, e)
+		if len(e.vector) != len(vector) {
+			// The embedding model of the rule has been changed.
+			continue
+		}
+		var dot float64
+		for i := range vector {
+			dot += vector[i] * e.vector[i]
+		}
+		if !ok || dot > similarity {
+			key, similarity, ok = e.key, dot, true
+		}
+	}
+	s.set(scope, live)
+	return
+}
+
+// Add adds the entry of the embedding referring to the key to the scope, which expires after the ttl. When the
+// scope already has maxEntries entries, the oldest ones are evicted. The existing entry of the same key is replaced.
+func (s *SemanticIndex) Add(scope string, embedding []float64, key string, ttl time.Duration, maxEntries int) {
+	vector := normalize(embedding)
+	if vector == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if !now.Before(s.nextSweep) {
+		s.sweep(now)
+		s.nextSweep = now.Add(semanticIndexSweepInterval)
+	}
+	entries := s.remove(s.scopes[scope], key)
+	entries = append(entries, semanticEntry{vector: vector, key: key, expireAt: now.Add(ttl)})
+	if over := len(entries) - maxEntries; over > 0 {
+		entries = append(entries[:0], entries[over:]...)
+	}
+	s.set(scope, entries)
+}
+
+// Remove removes the entry referring to the key from the scope, e.g., when the cached response has been evicted
+// from the [Store].
+func (s *SemanticIndex) Remove(scope string, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(scope, s.remove(s.scopes[scope], key))
+}
+
+// sweep removes the expired entries of all the scopes.
+func (s *SemanticIndex) sweep(now time.Time) {
+	for scope, entries := range s.scopes {
+		live := entries[:0]
+		for _, e := range entries {
+			if now.Before(e.expireAt) {
+				live = append(live, e)
+			}
+		}
+		s.set(scope, live)
+	}
+}
+
+func (s *SemanticIndex) remove(entries []semanticEntry, key string) []semanticEntry {
+	for i := range entries {
+		if entries[i].key == key {
+			return append(entries[:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
+
+func (s *SemanticIndex) set(scope string, entries []semanticEntry) {
+	if len(entries) == 0 {
+		delete(s.scopes, scope)
+		return
+	}
+	s.scopes[scope] = entries
+}
+
+// normalize returns the copy of the vector scaled to the unit length, or nil if the vector is zero.
+func normalize(v []float64) []float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+	ret := make([]float64, len(v))
+	for i, x := range v {
+		ret[i] = x / norm
+	}
+	return ret
+}
@@ -0,0 +1,72 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package responsecache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemanticIndex(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSemanticIndex()
+	s.now = func() time.Time { return now }
+
+	_, _, ok := s.Search("scope", []float64{1, 0})
+	require.False(t, ok)
+
+	s.Add("scope", []float64{2, 0}, "a", time.Hour, 2)
+	s.Add("scope", []float64{1, 1}, "b", 2*time.Hour, 2)
+	s.Add("other", []float64{0, 1}, "c", time.Hour, 2)
+	// The zero vector cannot be compared.
+	s.Add("scope", []float64{0, 0}, "zero", time.Hour, 2)
+
+	key, similarity, ok := s.Search("scope", []float64{3, 1})
+	require.True(t, ok)
+	require.Equal(t, "a", key)
+	require.InDelta(t, 0.9487, similarity, 0.0001)
+	key, similarity, ok = s.Search("scope", []float64{0, 1})
+	require.True(t, ok)
+	require.Equal(t, "b", key)
+	require.InDelta(t, 0.7071, similarity, 0.0001)
+	// The embeddings of the different dimensions are not compared.
+	_, _, ok = s.Search("scope", []float64{1, 0, 0})
+	require.False(t, ok)
+
+	// The oldest entry "a" is evicted when the scope exceeds the max entries.
+	s.Add("scope", []float64{1, 0.1}, "d", time.Hour, 2)
+	key, _, _ = s.Search("scope", []float64{1, 0})
+	require.Equal(t, "d", key)
+	require.Len(t, s.scopes["scope"], 2)
+
+	// Adding the existing key replaces the entry.
+	s.Add("scope", []float64{0, 1}, "d", time.Hour, 2)
+	require.Len(t, s.scopes["scope"], 2)
+	key, similarity, _ = s.Search("scope", []float64{0, 1})
+	require.Equal(t, "d", key)
+	require.InDelta(t, 1, similarity, 0.0001)
+
+	s.Remove("scope", "d")
+	key, _, _ = s.Search("scope", []float64{0, 1})
+	require.Equal(t, "b", key)
+
+	// The expired entries are removed on search.
+	now = now.Add(time.Hour)
+	_, _, ok = s.Search("other", []float64{0, 1})
+	require.False(t, ok)
+	require.NotContains(t, s.scopes, "other")
+	key, _, ok = s.Search("scope", []float64{0, 1})
+	require.True(t, ok)
+	require.Equal(t, "b", key)
+
+	// The expired entries of the scopes no longer searched are swept on the addition.
+	s.Add("stale", []float64{1, 0}, "e", time.Minute, 2)
+	now = now.Add(2 * time.Minute)
+	s.Add("scope", []float64{1, 0}, "f", time.Hour, 2)
+	require.NotContains(t, s.scopes, "stale")
+}
@@ -0,0 +1,125 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package responsecache provides the stores of the responses cached by the ResponseCache of the AIGatewayRoutes,
+// and the index of the embeddings of the cached requests for the semantic cache.
+package responsecache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Store is the interface for the store of the cached responses.
+//
+// The entries are keyed by the hash of the request and its scope, and they are expected to expire after the TTL.
+type Store interface {
+	// Get returns the value of the entry for the given key, or nil if the entry does not exist or has expired.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set sets the value of the entry for the given key, which expires after the ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// GetMany returns the values of the entries for the given keys in the same order, where the value is nil if the
+	// entry does not exist or has expired.
+	GetMany(ctx context.Context, keys []string) ([][]byte, error)
+	// SetMany sets the values of the entries for the given keys in the same order, which expire after the ttl.
+	SetMany(ctx context.Context, keys []string, values [][]byte, ttl time.Duration) error
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// DefaultMemoryStoreMaxBytes is the default maximum total size of the entries in the store created by
+// [NewMemoryStore].
+const DefaultMemoryStoreMaxBytes = 64 << 20
+
+// NewMemoryStore creates a new [Store] which keeps the entries in the memory of the process up to the total size of
+// maxBytes, where the least recently used entries are evicted first.
+//
+// The entries are not shared across the external processor instances, so the responses are cached per instance.
+func NewMemoryStore(maxBytes int) Store {
+	return &memoryStore{maxBytes: maxBytes, entries: make(map[string]*list.Element), lru: list.New(), now: time.Now}
+}
+
+type (
+	// memoryStore implements [Store] in memory.
+	memoryStore struct {
+		mu       sync.Mutex
+		maxBytes int
+		size     int
+		entries  map[string]*list.Element
+		// lru is the list of the entries where the front is the most recently used one.
+		lru *list.List
+		// now is the function to get the current time, which is replaced in tests.
+		now func() time.Time
+	}
+	memoryEntry struct {
+		key      string
+		value    []byte
+		expireAt time.Time
+	}
+)
+
+// Get implements [Store.Get].
+func (m *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := e.Value.(*memoryEntry)
+	if !m.now().Before(entry.expireAt) {
+		m.remove(e)
+		return nil, nil
+	}
+	m.lru.MoveToFront(e)
+	return entry.value, nil
+}
+
+// Set implements [Store.Set].
+func (m *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok {
+		m.remove(e)
+	}
+	if len(value) > m.maxBytes {
+		return nil
+	}
+	m.entries[key] = m.lru.PushFront(&memoryEntry{key: key, value: value, expireAt: m.now().Add(ttl)})
+	m.size += len(value)
+	for m.size > m.maxBytes {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+// GetMany implements [Store.GetMany].
+func (m *memoryStore) GetMany(ctx context.Context, keys []string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], _ = m.Get(ctx, key)
+	}
+	return values, nil
+}
+
+// SetMany implements [Store.SetMany].
+func (m *memoryStore) SetMany(ctx context.Context, keys []string, values [][]byte, ttl time.Duration) error {
+	for i, key := range keys {
+		_ = m.Set(ctx, key, values[i], ttl)
+	}
+	return nil
+}
+
+// remove removes the entry from the store. This must be called with the lock held.
+func (m *memoryStore) remove(e *list.Element) {
+	entry := m.lru.Remove(e).(*memoryEntry)
+	delete(m.entries, entry.key)
+	m.size -= len(entry.value)
+}
+
+// Close implements [Store.Close].
+func (m *memoryStore) Close() error { return nil }
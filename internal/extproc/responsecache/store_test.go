@@ -0,0 +1,58 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package responsecache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(10).(*memoryStore)
+	s.now = func() time.Time { return now }
+
+	v, err := s.Get(t.Context(), "a")
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	require.NoError(t, s.Set(t.Context(), "a", []byte("aaaa"), time.Hour))
+	require.NoError(t, s.Set(t.Context(), "b", []byte("bbbb"), 2*time.Hour))
+	v, err = s.Get(t.Context(), "a")
+	require.NoError(t, err)
+	require.Equal(t, []byte("aaaa"), v)
+
+	// The least recently used entry "b" is evicted to make room for "c".
+	require.NoError(t, s.Set(t.Context(), "c", []byte("cccc"), time.Hour))
+	v, err = s.Get(t.Context(), "b")
+	require.NoError(t, err)
+	require.Nil(t, v)
+	require.Equal(t, 8, s.size)
+
+	// The entry larger than the store is not kept.
+	require.NoError(t, s.Set(t.Context(), "d", make([]byte, 11), time.Hour))
+	require.NotContains(t, s.entries, "d")
+
+	// Setting the existing key replaces the entry.
+	require.NoError(t, s.Set(t.Context(), "a", []byte("a"), time.Hour))
+	require.Equal(t, 5, s.size)
+
+	// The expired entry is removed on read.
+	now = now.Add(time.Hour)
+	v, err = s.Get(t.Context(), "c")
+	require.NoError(t, err)
+	require.Nil(t, v)
+	require.NotContains(t, s.entries, "c")
+	require.Equal(t, 1, s.size)
+
+	require.NoError(t, s.SetMany(t.Context(), []string{"e", "f"}, [][]byte{[]byte("e"), []byte("f")}, time.Hour))
+	values, err := s.GetMany(t.Context(), []string{"f", "g", "e"})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("f"), nil, []byte("e")}, values)
+	require.NoError(t, s.Close())
+}
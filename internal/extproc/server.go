@@ -20,13 +20,20 @@ import (
 	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/google/cel-go/cel"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/prototext"
 
 	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/audit"
 	"github.com/envoyproxy/ai-gateway/internal/extproc/backendauth"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/capture"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/ledger"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/quota"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/responsecache"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/tokenizer"
 	"github.com/envoyproxy/ai-gateway/internal/internalapi"
 	"github.com/envoyproxy/ai-gateway/internal/llmcostcel"
 )
@@ -43,6 +50,23 @@ type Server struct {
 	processorFactories            map[string]ProcessorFactory
 	routerProcessorsPerReqID      map[string]Processor
 	routerProcessorsPerReqIDMutex sync.RWMutex
+	concurrencyLimiters           *concurrencyLimiters
+	quotaStore                    quota.Store
+	responseCacheStore            responsecache.Store
+	semanticIndex                 *responsecache.SemanticIndex
+	tokenizers                    *tokenizer.Registry
+	tokenCalibrator               *tokenCalibrator
+	usageLedger                   *usageLedger
+	auditLog                      *audit.Exporter
+	externalGuardrailClients      *externalGuardrailClients
+	metricAttributeValues         *metricAttributeValues
+	captureWriter                 *capture.Writer
+	// tracer creates the spans of the streams. This is nil if the tracing is disabled.
+	tracer       trace.Tracer
+	traceContent bool
+	// routerMetadataPerReqID is the dynamic metadata sent to the router filter of the request, which is inherited by
+	// its upstream filters, e.g., for the JWT claims. This is guarded by routerProcessorsPerReqIDMutex.
+	routerMetadataPerReqID map[string]*corev3.Metadata
 }
 
 // NewServer creates a new external processor server.
@@ -51,13 +75,36 @@ func NewServer(logger *slog.Logger) (*Server, error) {
 		logger:                   logger,
 		processorFactories:       make(map[string]ProcessorFactory),
 		routerProcessorsPerReqID: make(map[string]Processor),
+		routerMetadataPerReqID:   make(map[string]*corev3.Metadata),
+		concurrencyLimiters:      newConcurrencyLimiters(),
+		quotaStore:               quota.NewMemoryStore(),
+		responseCacheStore:       responsecache.NewMemoryStore(responsecache.DefaultMemoryStoreMaxBytes),
+		semanticIndex:            responsecache.NewSemanticIndex(),
+		tokenizers:               tokenizer.NewRegistry(nil),
+		tokenCalibrator:          newTokenCalibrator(),
+		externalGuardrailClients: newExternalGuardrailClients(),
+		metricAttributeValues:    newMetricAttributeValues(),
 	}
 	return srv, nil
 }
 
 // LoadConfig updates the configuration of the external processor.
 func (s *Server) LoadConfig(ctx context.Context, config *filterapi.Config) error {
+	rules := make(map[filterapi.RouteRuleName]*filterapi.RouteRule, len(config.Rules))
+	rulesByModel := make(map[string]*filterapi.RouteRule)
+	for i := range config.Rules {
+		r := &config.Rules[i]
+		rules[r.Name] = r
+		for _, m := range r.Models {
+			// The first matching rule takes precedence as in the route matching of Envoy.
+			if _, ok := rulesByModel[m]; !ok {
+				rulesByModel[m] = r
+			}
+		}
+	}
+
 	backends := make(map[string]*processorConfigBackend, len(config.Backends))
+	concurrencyLimitKeys := make(map[string]struct{})
 	for _, backend := range config.Backends {
 		b := backend
 		var h backendauth.Handler
@@ -68,12 +115,22 @@ func (s *Server) LoadConfig(ctx context.Context, config *filterapi.Config) error
 				return fmt.Errorf("cannot create backend auth handler: %w", err)
 			}
 		}
-		backends[b.Name] = &processorConfigBackend{b: &b, handler: h}
+		rule := rules[b.RouteRuleName]
+		backends[b.Name] = &processorConfigBackend{
+			b: &b, handler: h, rule: rule,
+			shadow: rule != nil && rule.Shadow != nil && rule.Shadow.BackendName == b.Name,
+		}
+		if b.ConcurrencyLimit != nil {
+			backends[b.Name].limiter = s.concurrencyLimiters.get(b.ConcurrencyLimit)
+			concurrencyLimitKeys[b.ConcurrencyLimit.Key] = struct{}{}
+		}
 	}
 
 	costs := make([]processorConfigRequestCost, 0, len(config.LLMRequestCosts))
+	var estimateTokens bool
 	for i := range config.LLMRequestCosts {
 		c := &config.LLMRequestCosts[i]
+		estimateTokens = estimateTokens || isTokenEstimationCostType(c.Type)
 		var prog cel.Program
 		if c.CEL != "" {
 			var err error
@@ -84,20 +141,101 @@ func (s *Server) LoadConfig(ctx context.Context, config *filterapi.Config) error
 		}
 		costs = append(costs, processorConfigRequestCost{LLMRequestCost: c, celProg: prog})
 	}
+	for i := range config.Quotas {
+		if err := validateCostBudgets(config.Quotas[i].Budgets, costs); err != nil {
+			return fmt.Errorf("invalid quota policy %s: %w", config.Quotas[i].Name, err)
+		}
+	}
+	for i := range config.ConsumerKeys {
+		if err := validateCostBudgets(config.ConsumerKeys[i].Budgets, costs); err != nil {
+			return fmt.Errorf("invalid consumer key %s: %w", config.ConsumerKeys[i].Name, err)
+		}
+	}
+
+	guardrails, err := newRouteGuardrails(config.Rules, s.externalGuardrailClients)
+	if err != nil {
+		return fmt.Errorf("cannot compile guardrails: %w", err)
+	}
+	toolPolicies, err := newToolPolicies(config.Rules)
+	if err != nil {
+		return fmt.Errorf("cannot compile tool policies: %w", err)
+	}
 
 	newConfig := &processorConfig{
-		uuid:               config.UUID,
-		schema:             config.Schema,
-		modelNameHeaderKey: config.ModelNameHeaderKey,
-		backends:           backends,
-		metadataNamespace:  config.MetadataNamespace,
-		requestCosts:       costs,
-		declaredModels:     config.Models,
+		uuid:                  config.UUID,
+		schema:                config.Schema,
+		modelNameHeaderKey:    config.ModelNameHeaderKey,
+		backends:              backends,
+		metadataNamespace:     config.MetadataNamespace,
+		requestCosts:          costs,
+		declaredModels:        config.Models,
+		rulesByModel:          rulesByModel,
+		quotas:                config.Quotas,
+		quotaStore:            s.quotaStore,
+		responseCacheStore:    s.responseCacheStore,
+		semanticIndex:         s.semanticIndex,
+		estimateTokens:        estimateTokens,
+		tokenizers:            s.tokenizers,
+		tokenCalibrator:       s.tokenCalibrator,
+		prices:                config.Prices,
+		consumerKeys:          consumerKeysByHash(config.ConsumerKeys),
+		usageLedger:           s.usageLedger,
+		guardrails:            guardrails,
+		toolPolicies:          toolPolicies,
+		auditLog:              s.auditLog,
+		traceContent:          s.traceContent,
+		metricAttributeValues: s.metricAttributeValues,
+		capture:               s.captureWriter,
 	}
+	s.concurrencyLimiters.retain(concurrencyLimitKeys)
 	s.config = newConfig // This is racey, but we don't care.
 	return nil
 }
 
+// SetQuotaStore sets the store of the counters of the quota budgets, which is in-memory by default.
+// This must be called before the configuration is loaded.
+func (s *Server) SetQuotaStore(store quota.Store) {
+	s.quotaStore = store
+}
+
+// SetResponseCacheStore sets the store of the responses cached by the response caches of the routes, which is
+// in-memory by default. This must be called before the configuration is loaded.
+func (s *Server) SetResponseCacheStore(store responsecache.Store) {
+	s.responseCacheStore = store
+}
+
+// SetTokenizers sets the registry of the tokenizers used to estimate the input tokens of the requests.
+// This must be called before the configuration is loaded.
+func (s *Server) SetTokenizers(tokenizers *tokenizer.Registry) {
+	s.tokenizers = tokenizers
+}
+
+// SetUsageLedger enables the export of the usage records of the completed requests to the exporter.
+// The consumer of the request is identified by the value of the consumerHeader or the consumerJWTClaim of the
+// bearer token, either of which can be empty. This must be called before the configuration is loaded.
+func (s *Server) SetUsageLedger(exporter *ledger.Exporter, consumerHeader, consumerJWTClaim string) {
+	s.usageLedger = &usageLedger{exporter: exporter, consumerHeader: consumerHeader, consumerJWTClaim: consumerJWTClaim}
+}
+
+// SetAuditLog enables the export of the audit records, such as the tool calls of the responses, to the exporter.
+// This must be called before the configuration is loaded.
+func (s *Server) SetAuditLog(exporter *audit.Exporter) {
+	s.auditLog = exporter
+}
+
+// SetTracing enables the tracing of the requests with the tracer. The prompts and the completions are recorded as
+// the events of the spans if captureContent is true. This must be called before the configuration is loaded.
+func (s *Server) SetTracing(tracer trace.Tracer, captureContent bool) {
+	s.tracer = tracer
+	s.traceContent = captureContent
+}
+
+// SetCapture enables the capture of the requests of the route rules with the capture enabled to the writer.
+// This must be called before the configuration is loaded.
+func (s *Server) SetCapture(w *capture.Writer) {
+	s.captureWriter = w
+}
+
 // Register a new processor for the given request path.
 func (s *Server) Register(path string, newProcessor ProcessorFactory) {
 	s.processorFactories[path] = newProcessor
@@ -140,11 +278,26 @@ func (s *Server) Process(stream extprocv3.ExternalProcessor_ProcessServer) error
 	var isUpstreamFilter bool
 	var reqID string
 	var logger *slog.Logger
+	// span is the span of the stream. This is nil if the tracing is disabled.
+	var span trace.Span
 	defer func() {
+		if span != nil {
+			span.End()
+		}
+		if r, ok := p.(concurrencySlotReleaser); ok {
+			r.releaseConcurrencySlot()
+		}
+		if w, ok := p.(requestCaptureWriter); ok {
+			w.writeRequestCapture()
+		}
+		if r, ok := p.(quotaReservationReleaser); ok {
+			r.releaseQuotaReservation()
+		}
 		if !isUpstreamFilter {
 			s.routerProcessorsPerReqIDMutex.Lock()
 			defer s.routerProcessorsPerReqIDMutex.Unlock()
 			delete(s.routerProcessorsPerReqID, reqID)
+			delete(s.routerMetadataPerReqID, reqID)
 		}
 	}()
 
@@ -191,14 +344,23 @@ func (s *Server) Process(stream extprocv3.ExternalProcessor_ProcessServer) error
 				s.logger.Error("cannot get processor", slog.String("error", err.Error()))
 				return status.Error(codes.NotFound, err.Error())
 			}
+			if s.tracer != nil {
+				ctx, span = startProcessSpan(ctx, s.tracer, headersMap, isUpstreamFilter)
+			}
 			if isUpstreamFilter {
+				ctx = withRequestMetadata(ctx, s.routerMetadata(reqID))
 				if err = s.setBackend(ctx, p, reqID, req); err != nil {
+					traceProcessing(ctx, span, req, nil, err, isUpstreamFilter)
 					s.logger.Error("error processing request message", slog.String("error", err.Error()))
 					return status.Errorf(codes.Unknown, "error processing request message: %v", err)
 				}
 			} else {
+				// The dynamic metadata is only sent to the router filter, e.g., for the metric attributes and the
+				// JWT claims, so it is kept for the upstream filters of the request.
+				ctx = withRequestMetadata(ctx, req.GetMetadataContext())
 				s.routerProcessorsPerReqIDMutex.Lock()
 				s.routerProcessorsPerReqID[reqID] = p
+				s.routerMetadataPerReqID[reqID] = req.GetMetadataContext()
 				s.routerProcessorsPerReqIDMutex.Unlock()
 			}
 		}
@@ -208,6 +370,7 @@ func (s *Server) Process(stream extprocv3.ExternalProcessor_ProcessServer) error
 
 		// At this point, p is guaranteed to be a valid processor either from the concrete processor or the passThroughProcessor.
 		resp, err := s.processMsg(ctx, logger, p, req)
+		traceProcessing(ctx, span, req, resp, err, isUpstreamFilter)
 		if err != nil {
 			s.logger.Error("error processing request message", slog.String("error", err.Error()))
 			return status.Errorf(codes.Unknown, "error processing request message: %v", err)
@@ -269,6 +432,13 @@ func (s *Server) processMsg(ctx context.Context, l *slog.Logger, p Processor, re
 	}
 }
 
+// routerMetadata returns the dynamic metadata sent to the router filter of the request, or nil if not found.
+func (s *Server) routerMetadata(reqID string) *corev3.Metadata {
+	s.routerProcessorsPerReqIDMutex.RLock()
+	defer s.routerProcessorsPerReqIDMutex.RUnlock()
+	return s.routerMetadataPerReqID[reqID]
+}
+
 // setBackend retrieves the backend from the request attributes and sets it in the processor. This is only called
 // if the processor is an upstream filter.
 func (s *Server) setBackend(ctx context.Context, p Processor, reqID string, req *extprocv3.ProcessingRequest) error {
@@ -303,6 +473,12 @@ func (s *Server) setBackend(ctx context.Context, p Processor, reqID string, req
 		return status.Errorf(codes.Internal, "unknown backend: %s", backendName.GetStringValue())
 	}
 
+	if address, ok := attributes.Fields[internalapi.UpstreamAddressAttribute]; ok {
+		if setter, ok := p.(upstreamAddressSetter); ok {
+			setter.setUpstreamAddress(address.GetStringValue())
+		}
+	}
+
 	s.routerProcessorsPerReqIDMutex.RLock()
 	defer s.routerProcessorsPerReqIDMutex.RUnlock()
 	routerProcessor, ok := s.routerProcessorsPerReqID[reqID]
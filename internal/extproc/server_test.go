@@ -40,6 +40,43 @@ func requireNewServerWithMockProcessor(t *testing.T) (*Server, *mockProcessor) {
 	return s, m.(*mockProcessor)
 }
 
+// newTestConfig returns the config loaded by the server from the filter config, so that the features of the rules
+// are compiled as in production. The filter config defaults to the model name header "x-ai-eg-model", the metadata
+// namespace "ai_gateway_llm_ns", and the backend "backend" of the first rule, and each rule defaults to the rule
+// "ns/route/rule/0" of the model "gpt". The setups are called on the server before the config is loaded, e.g., to
+// set the audit log.
+func newTestConfig(t *testing.T, fc *filterapi.Config, setups ...func(*Server)) *processorConfig {
+	s, err := NewServer(slog.Default())
+	require.NoError(t, err)
+	for _, setup := range setups {
+		setup(s)
+	}
+	if fc.ModelNameHeaderKey == "" {
+		fc.ModelNameHeaderKey = "x-ai-eg-model"
+	}
+	if fc.MetadataNamespace == "" {
+		fc.MetadataNamespace = "ai_gateway_llm_ns"
+	}
+	for i := range fc.Rules {
+		if fc.Rules[i].Name == "" {
+			fc.Rules[i].Name = "ns/route/rule/0"
+		}
+		if fc.Rules[i].Models == nil {
+			fc.Rules[i].Models = []string{"gpt"}
+		}
+	}
+	if fc.Backends == nil && len(fc.Rules) > 0 {
+		fc.Backends = []filterapi.Backend{{Name: "backend", RouteRuleName: fc.Rules[0].Name}}
+	}
+	require.NoError(t, s.LoadConfig(t.Context(), fc))
+	return s.config
+}
+
+// newTestRuleConfig returns the config of [newTestConfig] with the single rule.
+func newTestRuleConfig(t *testing.T, rule filterapi.RouteRule, setups ...func(*Server)) *processorConfig {
+	return newTestConfig(t, &filterapi.Config{Rules: []filterapi.RouteRule{rule}}, setups...)
+}
+
 func TestServer_LoadConfig(t *testing.T) {
 	now := time.Now()
 
@@ -86,7 +123,7 @@ func TestServer_LoadConfig(t *testing.T) {
 		require.Equal(t, "1 + 1", s.config.requestCosts[1].CEL)
 		prog := s.config.requestCosts[1].celProg
 		require.NotNil(t, prog)
-		val, err := llmcostcel.EvaluateProgram(prog, "", "", 1, 1, 1)
+		val, err := llmcostcel.EvaluateProgram(prog, &llmcostcel.RequestContext{InputTokens: 1, OutputTokens: 1, TotalTokens: 1})
 		require.NoError(t, err)
 		require.Equal(t, uint64(2), val)
 		require.Equal(t, config.Models, s.config.declaredModels)
@@ -330,6 +367,14 @@ func TestServer_setBackend(t *testing.T) {
 	}
 }
 
+func TestServer_routerMetadata(t *testing.T) {
+	s, _ := requireNewServerWithMockProcessor(t)
+	require.Nil(t, s.routerMetadata("aaaaaaaaaaaa"))
+	md := &corev3.Metadata{FilterMetadata: map[string]*structpb.Struct{internalapi.JWTAuthnMetadataNamespace: {}}}
+	s.routerMetadataPerReqID["aaaaaaaaaaaa"] = md
+	require.Equal(t, md, s.routerMetadata("aaaaaaaaaaaa"))
+}
+
 func TestServer_ProcessorSelection(t *testing.T) {
 	s, err := NewServer(slog.Default())
 	require.NoError(t, err)
@@ -0,0 +1,197 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+)
+
+// shadowComparison pairs the primary response and the shadow response of a request sampled for the traffic shadowing.
+//
+// Envoy sends the primary request and the mirrored one concurrently, and each of them is processed by its own
+// upstream filter. This is shared by both of them, so this is safe for concurrent use.
+type shadowComparison struct {
+	mu       sync.Mutex
+	model    string
+	primary  *metrics.ShadowResult
+	shadow   *metrics.ShadowResult
+	recorded bool
+}
+
+// report sets the result of either the primary or the shadow response, and records the comparison
+// once both of them are available.
+func (s *shadowComparison) report(ctx context.Context, metrics metrics.ChatCompletionMetrics, result *metrics.ShadowResult, isShadow bool) {
+	s.mu.Lock()
+	if isShadow {
+		s.shadow = result
+	} else {
+		s.primary = result
+	}
+	ready := !s.recorded && s.primary != nil && s.shadow != nil
+	if ready {
+		s.recorded = true
+	}
+	s.mu.Unlock()
+	if ready {
+		metrics.RecordShadowComparison(ctx, s.model, s.primary, s.shadow)
+	}
+}
+
+// sampleShadow decides whether the request is sampled for the traffic shadowing according to the given policy,
+// and returns the comparison shared by the primary and the shadow upstream filters if so.
+//
+// The primary and the shadow requests reach the upstream filters concurrently, so the decision is made only once
+// by whichever comes first.
+func (c *chatCompletionProcessorRouterFilter) sampleShadow(sp *filterapi.ShadowPolicy) *shadowComparison {
+	c.shadowOnce.Do(func() {
+		if rand.IntN(100) < sp.Percentage { //nolint:gosec
+			c.shadow = &shadowComparison{model: c.requestHeaders[c.config.modelNameHeaderKey]}
+		}
+	})
+	return c.shadow
+}
+
+// shadowResponseRecorder collects the response of either the primary or the shadow request to be compared.
+type shadowResponseRecorder struct {
+	start        time.Time
+	stream       bool
+	jsonExpected bool
+	// body is the response body in the OpenAI format.
+	body []byte
+}
+
+// newShadowResponseRecorder creates a new shadowResponseRecorder for the given request.
+func newShadowResponseRecorder(req *openai.ChatCompletionRequest) *shadowResponseRecorder {
+	r := &shadowResponseRecorder{start: time.Now(), stream: req.Stream}
+	if rf := req.ResponseFormat; rf != nil {
+		r.jsonExpected = rf.Type == openai.ChatCompletionResponseFormatTypeJSONObject ||
+			rf.Type == openai.ChatCompletionResponseFormatTypeJSONSchema
+	}
+	return r
+}
+
+// append appends the chunk of the response body in the OpenAI format.
+func (r *shadowResponseRecorder) append(body []byte) {
+	r.body = append(r.body, body...)
+}
+
+// result builds the summary of the response.
+func (r *shadowResponseRecorder) result(backend string, success bool, usage *translator.LLMTokenUsage) *metrics.ShadowResult {
+	ret := &metrics.ShadowResult{
+		Backend:      backend,
+		Success:      success,
+		Latency:      time.Since(r.start),
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+	}
+	if !success {
+		return ret
+	}
+	var content strings.Builder
+	if r.stream {
+		for _, line := range bytes.Split(r.body, []byte("\n")) {
+			data, ok := bytes.CutPrefix(line, []byte("data:"))
+			data = bytes.TrimSpace(data)
+			if !ok || bytes.Equal(data, []byte("[DONE]")) {
+				continue
+			}
+			var chunk openai.ChatCompletionResponseChunk
+			if err := json.Unmarshal(data, &chunk); err != nil || len(chunk.Choices) == 0 {
+				continue
+			}
+			choice := &chunk.Choices[0]
+			if choice.Delta != nil && choice.Delta.Content != nil {
+				content.WriteString(*choice.Delta.Content)
+			}
+			if choice.FinishReason != "" {
+				ret.FinishReason = string(choice.FinishReason)
+			}
+		}
+	} else {
+		var resp openai.ChatCompletionResponse
+		if err := json.Unmarshal(r.body, &resp); err == nil && len(resp.Choices) > 0 {
+			ret.FinishReason = string(resp.Choices[0].FinishReason)
+			if c := resp.Choices[0].Message.Content; c != nil {
+				content.WriteString(*c)
+			}
+		}
+	}
+	if r.jsonExpected {
+		valid := json.Valid([]byte(content.String()))
+		ret.JSONValid = &valid
+	}
+	return ret
+}
+
+// shadowChatCompletionMetrics wraps the metrics.ChatCompletionMetrics for the upstream filter of the shadow requests.
+//
+// This discards everything but the shadow comparison so that the shadow requests do not affect the regular metrics.
+type shadowChatCompletionMetrics struct {
+	metrics.ChatCompletionMetrics
+}
+
+// StartRequest implements [metrics.ChatCompletionMetrics.StartRequest].
+func (shadowChatCompletionMetrics) StartRequest(map[string]string) {}
+
+// SetModel implements [metrics.ChatCompletionMetrics.SetModel].
+func (shadowChatCompletionMetrics) SetModel(string) {}
+
+// SetBackend implements [metrics.ChatCompletionMetrics.SetBackend].
+func (shadowChatCompletionMetrics) SetBackend(*filterapi.Backend) {}
+
+// RecordTokenUsage implements [metrics.ChatCompletionMetrics.RecordTokenUsage].
+func (shadowChatCompletionMetrics) RecordTokenUsage(context.Context, uint32, uint32, uint32, ...attribute.KeyValue) {
+}
+
+// RecordRequestCompletion implements [metrics.ChatCompletionMetrics.RecordRequestCompletion].
+func (shadowChatCompletionMetrics) RecordRequestCompletion(context.Context, bool, ...attribute.KeyValue) {
+}
+
+// RecordTokenLatency implements [metrics.ChatCompletionMetrics.RecordTokenLatency].
+func (shadowChatCompletionMetrics) RecordTokenLatency(context.Context, uint32, ...attribute.KeyValue) {
+}
+
+// RecordPrefixCacheAffinity implements [metrics.ChatCompletionMetrics.RecordPrefixCacheAffinity].
+func (shadowChatCompletionMetrics) RecordPrefixCacheAffinity(context.Context, bool, ...attribute.KeyValue) {
+}
+
+// RecordHedgedAttempts implements [metrics.ChatCompletionMetrics.RecordHedgedAttempts].
+func (shadowChatCompletionMetrics) RecordHedgedAttempts(context.Context, int, ...attribute.KeyValue) {
+}
+
+// RecordCost implements [metrics.CostMetrics.RecordCost].
+func (shadowChatCompletionMetrics) RecordCost(context.Context, uint64, ...attribute.KeyValue) {}
+
+// RecordGuardrailDetections implements [metrics.GuardrailMetrics.RecordGuardrailDetections].
+func (shadowChatCompletionMetrics) RecordGuardrailDetections(context.Context, string, string, string, int, ...attribute.KeyValue) {
+}
+
+// RecordResponseCacheLookups implements [metrics.ResponseCacheMetrics.RecordResponseCacheLookups].
+func (shadowChatCompletionMetrics) RecordResponseCacheLookups(context.Context, string, bool, int, ...attribute.KeyValue) {
+}
+
+// RecordResponseCacheSimilarity implements [metrics.ResponseCacheMetrics.RecordResponseCacheSimilarity].
+func (shadowChatCompletionMetrics) RecordResponseCacheSimilarity(context.Context, float64, ...attribute.KeyValue) {
+}
+
+// GetTimeToFirstTokenMs implements [metrics.ChatCompletionMetrics.GetTimeToFirstTokenMs].
+func (shadowChatCompletionMetrics) GetTimeToFirstTokenMs() float64 { return 0 }
+
+// GetInterTokenLatencyMs implements [metrics.ChatCompletionMetrics.GetInterTokenLatencyMs].
+func (shadowChatCompletionMetrics) GetInterTokenLatencyMs() float64 { return 0 }
@@ -0,0 +1,227 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+)
+
+func Test_shadowResponseRecorder(t *testing.T) {
+	jsonRequest := &openai.ChatCompletionRequest{
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	}
+	usage := &translator.LLMTokenUsage{InputTokens: 10, OutputTokens: 20}
+	for _, tc := range []struct {
+		name         string
+		req          *openai.ChatCompletionRequest
+		success      bool
+		body         []string
+		finishReason string
+		jsonValid    *bool
+	}{
+		{
+			name:         "non-streaming",
+			req:          &openai.ChatCompletionRequest{},
+			success:      true,
+			body:         []string{`{"choices":[{"finish_reason":"stop",`, `"message":{"content":"hi"}}]}`},
+			finishReason: "stop",
+		},
+		{
+			name:         "non-streaming json",
+			req:          jsonRequest,
+			success:      true,
+			body:         []string{`{"choices":[{"finish_reason":"stop","message":{"content":"{\"a\":1}"}}]}`},
+			finishReason: "stop",
+			jsonValid:    ptr.To(true),
+		},
+		{
+			name:         "non-streaming invalid json",
+			req:          jsonRequest,
+			success:      true,
+			body:         []string{`{"choices":[{"finish_reason":"length","message":{"content":"{\"a\":"}}]}`},
+			finishReason: "length",
+			jsonValid:    ptr.To(false),
+		},
+		{
+			name:    "streaming json",
+			req:     &openai.ChatCompletionRequest{Stream: true, ResponseFormat: jsonRequest.ResponseFormat},
+			success: true,
+			body: []string{
+				"data: {\"choices\":[{\"delta\":{\"content\":\"{\\\"a\\\"\"}}]}\n\n",
+				"data: {\"choices\":[{\"delta\":{\"content\":\":1}\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n",
+			},
+			finishReason: "stop",
+			jsonValid:    ptr.To(true),
+		},
+		{
+			name: "failure",
+			req:  jsonRequest,
+			body: []string{`{"error":{"message":"oops"}}`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newShadowResponseRecorder(tc.req)
+			for _, b := range tc.body {
+				r.append([]byte(b))
+			}
+			res := r.result("some-backend", tc.success, usage)
+			require.Equal(t, "some-backend", res.Backend)
+			require.Equal(t, tc.success, res.Success)
+			require.Equal(t, uint32(10), res.InputTokens)
+			require.Equal(t, uint32(20), res.OutputTokens)
+			require.Equal(t, tc.finishReason, res.FinishReason)
+			require.Equal(t, tc.jsonValid, res.JSONValid)
+			require.Positive(t, res.Latency)
+		})
+	}
+}
+
+func Test_shadowComparison(t *testing.T) {
+	mm := &mockChatCompletionMetrics{}
+	s := &shadowComparison{model: "some-model"}
+	shadow := &metrics.ShadowResult{Backend: "shadow"}
+	primary := &metrics.ShadowResult{Backend: "primary"}
+	s.report(t.Context(), mm, shadow, true)
+	require.Empty(t, mm.shadowComparisons)
+	s.report(t.Context(), mm, primary, false)
+	require.Equal(t, [][2]*metrics.ShadowResult{{primary, shadow}}, mm.shadowComparisons)
+	// The comparison is recorded only once.
+	s.report(t.Context(), mm, primary, false)
+	require.Len(t, mm.shadowComparisons, 1)
+}
+
+func Test_chatCompletionProcessor_shadow(t *testing.T) {
+	const (
+		primaryBackendName = "ns/primary/route/route1/rule/0/ref/0"
+		shadowBackendName  = "ns/candidate/route/route1/rule/0/shadow"
+	)
+	newConfig := func(percentage int) *processorConfig {
+		rule := &filterapi.RouteRule{
+			Name:   "ns/route1/rule/0",
+			Shadow: &filterapi.ShadowPolicy{BackendName: shadowBackendName, Percentage: percentage},
+		}
+		return &processorConfig{
+			modelNameHeaderKey: "x-ai-eg-model",
+			metadataNamespace:  "ai_gateway_llm_ns",
+			requestCosts: []processorConfigRequestCost{
+				{LLMRequestCost: &filterapi.LLMRequestCost{Type: filterapi.LLMRequestCostTypeOutputToken, MetadataKey: "output_token_usage"}},
+			},
+			backends: map[string]*processorConfigBackend{
+				primaryBackendName: {b: &filterapi.Backend{Name: primaryBackendName}, rule: rule},
+				shadowBackendName:  {b: &filterapi.Backend{Name: shadowBackendName}, rule: rule, shadow: true},
+			},
+		}
+	}
+	const requestBody = `{"model":"some-model","messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_object"}}`
+	newRouterFilter := func(config *processorConfig) *chatCompletionProcessorRouterFilter {
+		var body openai.ChatCompletionRequest
+		require.NoError(t, json.Unmarshal([]byte(requestBody), &body))
+		return &chatCompletionProcessorRouterFilter{
+			config:                 config,
+			logger:                 slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})),
+			requestHeaders:         map[string]string{"x-ai-eg-model": "some-model"},
+			originalRequestBody:    &body,
+			originalRequestBodyRaw: []byte(requestBody),
+		}
+	}
+	newUpstreamFilter := func(rp *chatCompletionProcessorRouterFilter, mm metrics.ChatCompletionMetrics, backendName string) *chatCompletionProcessorUpstreamFilter {
+		u := &chatCompletionProcessorUpstreamFilter{
+			config:         rp.config,
+			logger:         rp.logger,
+			metrics:        mm,
+			requestHeaders: map[string]string{"x-ai-eg-model": "some-model"},
+		}
+		err := u.SetBackend(t.Context(), &filterapi.Backend{
+			Name:   backendName,
+			Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+		}, nil, rp)
+		require.NoError(t, err)
+		return u
+	}
+
+	t.Run("sampled", func(t *testing.T) {
+		rp := newRouterFilter(newConfig(100))
+		mm := &mockChatCompletionMetrics{}
+		shadow := newUpstreamFilter(rp, mm, shadowBackendName)
+		primary := newUpstreamFilter(rp, mm, primaryBackendName)
+		require.True(t, shadow.isShadow)
+		require.NotNil(t, rp.shadow)
+		require.Equal(t, rp.shadow, shadow.shadow)
+		require.Equal(t, rp.shadow, primary.shadow)
+		// The shadow request does not affect the state of the primary request.
+		require.Equal(t, primary, rp.upstreamFilter)
+		require.Equal(t, 1, rp.upstreamFilterCount)
+		require.False(t, primary.onRetry)
+
+		for _, u := range []*chatCompletionProcessorUpstreamFilter{shadow, primary} {
+			res, err := u.ProcessRequestHeaders(t.Context(), &corev3.HeaderMap{})
+			require.NoError(t, err)
+			require.NotNil(t, res.GetRequestHeaders())
+			_, err = u.ProcessResponseHeaders(t.Context(), &corev3.HeaderMap{
+				Headers: []*corev3.HeaderValue{{Key: ":status", Value: "200"}},
+			})
+			require.NoError(t, err)
+		}
+
+		res, err := shadow.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{
+			Body:        []byte(`{"choices":[{"finish_reason":"length","message":{"content":"{"}}],"usage":{"prompt_tokens":10,"completion_tokens":30}}`),
+			EndOfStream: true,
+		})
+		require.NoError(t, err)
+		// The costs of the shadow request are not populated in the dynamic metadata.
+		require.Nil(t, res.DynamicMetadata)
+		require.Empty(t, mm.shadowComparisons)
+
+		res, err = primary.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{
+			Body:        []byte(`{"choices":[{"finish_reason":"stop","message":{"content":"{}"}}],"usage":{"prompt_tokens":10,"completion_tokens":5}}`),
+			EndOfStream: true,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, res.DynamicMetadata)
+
+		// Only the primary request is recorded in the regular metrics.
+		require.Equal(t, 1, mm.tokenUsageCount)
+		require.Len(t, mm.shadowComparisons, 1)
+		p, s := mm.shadowComparisons[0][0], mm.shadowComparisons[0][1]
+		require.Equal(t, primaryBackendName, p.Backend)
+		require.Equal(t, "stop", p.FinishReason)
+		require.Equal(t, uint32(5), p.OutputTokens)
+		require.Equal(t, ptr.To(true), p.JSONValid)
+		require.Equal(t, shadowBackendName, s.Backend)
+		require.True(t, s.Success)
+		require.Equal(t, "length", s.FinishReason)
+		require.Equal(t, uint32(30), s.OutputTokens)
+		require.Equal(t, ptr.To(false), s.JSONValid)
+	})
+
+	t.Run("not sampled", func(t *testing.T) {
+		rp := newRouterFilter(newConfig(0))
+		mm := &mockChatCompletionMetrics{}
+		primary := newUpstreamFilter(rp, mm, primaryBackendName)
+		shadow := newUpstreamFilter(rp, mm, shadowBackendName)
+		require.Nil(t, rp.shadow)
+		require.Nil(t, primary.shadow)
+
+		// The mirrored request is dropped.
+		res, err := shadow.ProcessRequestHeaders(t.Context(), &corev3.HeaderMap{})
+		require.NoError(t, err)
+		require.Equal(t, typev3.StatusCode_NoContent, res.GetImmediateResponse().GetStatus().GetCode())
+	})
+}
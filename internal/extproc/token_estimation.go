@@ -0,0 +1,253 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/filterapi/x"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+)
+
+const (
+	// tokensPerMessage is the number of the tokens used by the chat template per message, such as the role and the
+	// delimiters. tokensPerName is the additional one for the message with the name, and tokensPerReplyPriming is the
+	// one to prime the reply of the assistant. These are the values documented by OpenAI for the recent models.
+	tokensPerMessage      = 3
+	tokensPerName         = 1
+	tokensPerReplyPriming = 3
+)
+
+// tokenEstimate is the estimation of the token usage of the request made at the router filter before the request
+// is sent upstream.
+type tokenEstimate struct {
+	model string
+	// rawInput is the number of the input tokens counted by the tokenizer, and input is the one adjusted by the
+	// calibration factor of the model.
+	rawInput, input uint32
+	// reservedOutput is the maximum number of the output tokens requested by max_tokens or max_completion_tokens.
+	// This is zero if the request doesn't specify it.
+	reservedOutput uint32
+}
+
+// isTokenEstimationCostType returns true if the request cost of the type is estimated before the request is sent upstream.
+func isTokenEstimationCostType(t filterapi.LLMRequestCostType) bool {
+	switch t {
+	case filterapi.LLMRequestCostTypeEstimatedInputToken,
+		filterapi.LLMRequestCostTypeReservedOutputToken,
+		filterapi.LLMRequestCostTypeReservedTotalToken:
+		return true
+	}
+	return false
+}
+
+// estimateChatCompletionTokens estimates the token usage of the chat completion request.
+func estimateChatCompletionTokens(config *processorConfig, model string, body *openai.ChatCompletionRequest) *tokenEstimate {
+	t := config.tokenizers.ForModel(model)
+	n := tokensPerReplyPriming
+	for i := range body.Messages {
+		n += tokensPerMessage + countMessageTokens(t, body.Messages[i].Value)
+	}
+	if len(body.Tools) > 0 {
+		// The tool definitions are rendered into the system prompt in the provider specific format, so this
+		// approximates them with the JSON representation.
+		if raw, err := json.Marshal(body.Tools); err == nil {
+			n += t.CountTokens(string(raw))
+		}
+	}
+	e := &tokenEstimate{model: model, rawInput: uint32(n)} //nolint:gosec
+	switch {
+	case body.MaxCompletionTokens != nil:
+		e.reservedOutput = clampUint32(*body.MaxCompletionTokens)
+	case body.MaxTokens != nil:
+		e.reservedOutput = clampUint32(*body.MaxTokens)
+	}
+	e.input = config.tokenCalibrator.calibrate(model, e.rawInput)
+	return e
+}
+
+// estimateEmbeddingsTokens estimates the token usage of the embeddings request.
+func estimateEmbeddingsTokens(config *processorConfig, model string, body *openai.EmbeddingRequest) *tokenEstimate {
+	t := config.tokenizers.ForModel(model)
+	var n int
+	switch v := body.Input.Value.(type) {
+	case string:
+		n = t.CountTokens(v)
+	case []string:
+		for _, s := range v {
+			n += t.CountTokens(s)
+		}
+	}
+	e := &tokenEstimate{model: model, rawInput: uint32(n)} //nolint:gosec
+	e.input = config.tokenCalibrator.calibrate(model, e.rawInput)
+	return e
+}
+
+// countMessageTokens counts the tokens of the text parts of the message. The non-text parts such as images
+// and audio are not counted as their cost is model specific.
+func countMessageTokens(t x.Tokenizer, msg any) int {
+	var n int
+	countName := func(name string) {
+		if name != "" {
+			n += tokensPerName + t.CountTokens(name)
+		}
+	}
+	switch m := msg.(type) {
+	case openai.ChatCompletionSystemMessageParam:
+		countName(m.Name)
+		n += countStringOrArrayTokens(t, m.Content.Value)
+	case openai.ChatCompletionDeveloperMessageParam:
+		countName(m.Name)
+		n += countStringOrArrayTokens(t, m.Content.Value)
+	case openai.ChatCompletionToolMessageParam:
+		n += countStringOrArrayTokens(t, m.Content.Value)
+	case openai.ChatCompletionUserMessageParam:
+		countName(m.Name)
+		switch c := m.Content.Value.(type) {
+		case string:
+			n += t.CountTokens(c)
+		case []openai.ChatCompletionContentPartUserUnionParam:
+			for i := range c {
+				if c[i].TextContent != nil {
+					n += t.CountTokens(c[i].TextContent.Text)
+				}
+			}
+		}
+	case openai.ChatCompletionAssistantMessageParam:
+		countName(m.Name)
+		switch c := m.Content.Value.(type) {
+		case string:
+			n += t.CountTokens(c)
+		case openai.ChatCompletionAssistantMessageParamContent:
+			if c.Text != nil {
+				n += t.CountTokens(*c.Text)
+			}
+		}
+		for i := range m.ToolCalls {
+			n += t.CountTokens(m.ToolCalls[i].Function.Name) + t.CountTokens(m.ToolCalls[i].Function.Arguments)
+		}
+	}
+	return n
+}
+
+// countStringOrArrayTokens counts the tokens of the value of [openai.StringOrArray].
+func countStringOrArrayTokens(t x.Tokenizer, v any) int {
+	var n int
+	switch c := v.(type) {
+	case string:
+		n = t.CountTokens(c)
+	case []string:
+		for _, s := range c {
+			n += t.CountTokens(s)
+		}
+	case []openai.ChatCompletionContentPartTextParam:
+		for i := range c {
+			n += t.CountTokens(c[i].Text)
+		}
+	}
+	return n
+}
+
+// buildTokenEstimationDynamicMetadata sets the estimated costs of the request to the dynamic metadata, so that
+// they can be used for the admission before the request is sent upstream. The same metadata keys are overwritten
+// with the actual usage when the response completes.
+func buildTokenEstimationDynamicMetadata(config *processorConfig, dm *structpb.Struct, e *tokenEstimate) *structpb.Struct {
+	fields := make(map[string]*structpb.Value)
+	for i := range config.requestCosts {
+		rc := &config.requestCosts[i]
+		var cost uint32
+		switch rc.Type {
+		case filterapi.LLMRequestCostTypeEstimatedInputToken:
+			cost = e.input
+		case filterapi.LLMRequestCostTypeReservedOutputToken:
+			cost = e.reservedOutput
+		case filterapi.LLMRequestCostTypeReservedTotalToken:
+			cost = e.input + e.reservedOutput
+		default:
+			continue
+		}
+		fields[rc.MetadataKey] = structpb.NewNumberValue(float64(cost))
+	}
+	if len(fields) == 0 {
+		return dm
+	}
+	if dm == nil {
+		dm = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	}
+	if ns := dm.Fields[config.metadataNamespace].GetStructValue(); ns != nil {
+		for k, v := range fields {
+			ns.Fields[k] = v
+		}
+	} else {
+		dm.Fields[config.metadataNamespace] = structpb.NewStructValue(&structpb.Struct{Fields: fields})
+	}
+	return dm
+}
+
+// clampUint32 converts the int64 to uint32 by clamping it to the range of uint32.
+func clampUint32(v int64) uint32 {
+	return uint32(max(0, min(v, math.MaxUint32))) //nolint:gosec
+}
+
+const (
+	// tokenCalibrationMaxModels is the maximum number of the models whose calibration factors are tracked.
+	tokenCalibrationMaxModels = 1024
+	// tokenCalibrationSmoothing is the weight of the latest observation in the exponential moving average
+	// of the calibration factor.
+	tokenCalibrationSmoothing = 0.1
+	// tokenCalibrationMinFactor and tokenCalibrationMaxFactor bound the calibration factor so that a few
+	// outliers, e.g., the requests with large images, do not skew the estimation too much.
+	tokenCalibrationMinFactor = 0.5
+	tokenCalibrationMaxFactor = 2.0
+)
+
+// tokenCalibrator reconciles the estimated input tokens with the actual usage reported by the backends, and
+// corrects the subsequent estimations per model with the ratio between them.
+//
+// This is shared across all requests and the config reloads, so this is safe for concurrent use.
+type tokenCalibrator struct {
+	mu      sync.Mutex
+	factors map[string]float64
+}
+
+// newTokenCalibrator creates a new tokenCalibrator.
+func newTokenCalibrator() *tokenCalibrator {
+	return &tokenCalibrator{factors: make(map[string]float64)}
+}
+
+// calibrate returns the number of the input tokens corrected by the calibration factor of the model.
+func (c *tokenCalibrator) calibrate(model string, rawInput uint32) uint32 {
+	c.mu.Lock()
+	f, ok := c.factors[model]
+	c.mu.Unlock()
+	if !ok {
+		return rawInput
+	}
+	return uint32(math.Round(float64(rawInput) * f))
+}
+
+// observe updates the calibration factor of the model with the actual number of the input tokens of the request
+// whose estimation by the tokenizer was rawInput.
+func (c *tokenCalibrator) observe(model string, rawInput, actualInput uint32) {
+	if rawInput == 0 || actualInput == 0 {
+		return
+	}
+	ratio := min(max(float64(actualInput)/float64(rawInput), tokenCalibrationMinFactor), tokenCalibrationMaxFactor)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.factors[model]
+	switch {
+	case ok:
+		c.factors[model] = f + tokenCalibrationSmoothing*(ratio-f)
+	case len(c.factors) < tokenCalibrationMaxModels:
+		c.factors[model] = ratio
+	}
+}
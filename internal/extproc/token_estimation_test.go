@@ -0,0 +1,164 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/filterapi/x"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/tokenizer"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+)
+
+// wordTokenizer implements [x.Tokenizer] by counting the words, which makes the expected values easy to follow.
+type wordTokenizer struct{}
+
+// CountTokens implements [x.Tokenizer.CountTokens].
+func (wordTokenizer) CountTokens(text string) int { return len(strings.Fields(text)) }
+
+// tokenEstimationTestFilterConfig returns the filter config with the costs of the estimated tokens.
+func tokenEstimationTestFilterConfig() *filterapi.Config {
+	return &filterapi.Config{LLMRequestCosts: []filterapi.LLMRequestCost{
+		{MetadataKey: "estimated_input", Type: filterapi.LLMRequestCostTypeEstimatedInputToken},
+		{MetadataKey: "reserved_output", Type: filterapi.LLMRequestCostTypeReservedOutputToken},
+		{MetadataKey: "reserved_total", Type: filterapi.LLMRequestCostTypeReservedTotalToken},
+		{MetadataKey: "output", Type: filterapi.LLMRequestCostTypeOutputToken},
+	}}
+}
+
+// withWordTokenizer is the setup of [newTestConfig] which estimates the tokens with the [wordTokenizer].
+func withWordTokenizer(s *Server) {
+	s.SetTokenizers(tokenizer.NewRegistry(func(string) x.Tokenizer { return wordTokenizer{} }))
+}
+
+func Test_estimateChatCompletionTokens(t *testing.T) {
+	config := newTestConfig(t, tokenEstimationTestFilterConfig(), withWordTokenizer)
+	var body openai.ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "model": "some-model",
+  "max_tokens": 100,
+  "messages": [
+    {"role": "system", "content": "you are helpful"},
+    {"role": "user", "name": "alice", "content": [{"type": "text", "text": "what is this"}, {"type": "image_url", "image_url": {"url": "https://example.com/a.png"}}]},
+    {"role": "assistant", "content": "a cat", "tool_calls": [{"id": "1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\": \"cat\"}"}}]},
+    {"role": "tool", "tool_call_id": "1", "content": "a small animal"}
+  ]
+}`), &body))
+
+	e := estimateChatCompletionTokens(config, "some-model", &body)
+	// 4 messages * 3 + 3 (priming) + 3 (system) + 2 (name) + 3 (user) + 2 (assistant) + 1 + 2 (tool call) + 3 (tool).
+	require.Equal(t, &tokenEstimate{model: "some-model", rawInput: 31, input: 31, reservedOutput: 100}, e)
+
+	t.Run("max_completion_tokens takes precedence", func(t *testing.T) {
+		body.MaxCompletionTokens = ptr.To[int64](200)
+		e = estimateChatCompletionTokens(config, "some-model", &body)
+		require.Equal(t, uint32(200), e.reservedOutput)
+	})
+	t.Run("calibrated", func(t *testing.T) {
+		config.tokenCalibrator.observe("some-model", 31, 62)
+		e = estimateChatCompletionTokens(config, "some-model", &body)
+		require.Equal(t, uint32(31), e.rawInput)
+		require.Equal(t, uint32(62), e.input)
+	})
+}
+
+func Test_estimateEmbeddingsTokens(t *testing.T) {
+	config := newTestConfig(t, tokenEstimationTestFilterConfig(), withWordTokenizer)
+	e := estimateEmbeddingsTokens(config, "some-model", &openai.EmbeddingRequest{Input: openai.StringOrArray{Value: "hello world"}})
+	require.Equal(t, &tokenEstimate{model: "some-model", rawInput: 2, input: 2}, e)
+	e = estimateEmbeddingsTokens(config, "some-model", &openai.EmbeddingRequest{Input: openai.StringOrArray{Value: []string{"a b", "c"}}})
+	require.Equal(t, uint32(3), e.input)
+}
+
+func Test_buildTokenEstimationDynamicMetadata(t *testing.T) {
+	config := newTestConfig(t, tokenEstimationTestFilterConfig(), withWordTokenizer)
+	e := &tokenEstimate{input: 10, reservedOutput: 5}
+	dm := buildTokenEstimationDynamicMetadata(config, nil, e)
+	ns := dm.Fields["ai_gateway_llm_ns"].GetStructValue().Fields
+	require.Len(t, ns, 3)
+	require.Equal(t, float64(10), ns["estimated_input"].GetNumberValue())
+	require.Equal(t, float64(5), ns["reserved_output"].GetNumberValue())
+	require.Equal(t, float64(15), ns["reserved_total"].GetNumberValue())
+
+	t.Run("merged", func(t *testing.T) {
+		dm = buildTokenEstimationDynamicMetadata(config, buildExperimentDynamicMetadata(config, "exp", &filterapi.ExperimentVariant{Name: "a", Key: "ns/a/route/route1/rule/0/ref/0"}), e)
+		ns = dm.Fields["ai_gateway_llm_ns"].GetStructValue().Fields
+		require.Len(t, ns, 5)
+		require.Equal(t, "exp", ns["experiment"].GetStringValue())
+		require.Equal(t, float64(10), ns["estimated_input"].GetNumberValue())
+	})
+	t.Run("no estimated costs", func(t *testing.T) {
+		config.requestCosts = config.requestCosts[3:]
+		require.Nil(t, buildTokenEstimationDynamicMetadata(config, nil, e))
+	})
+}
+
+func Test_tokenCalibrator(t *testing.T) {
+	c := newTokenCalibrator()
+	require.Equal(t, uint32(100), c.calibrate("m", 100))
+	c.observe("m", 0, 10)
+	c.observe("m", 10, 0)
+	require.Equal(t, uint32(100), c.calibrate("m", 100))
+
+	// The first observation is taken as is, and the subsequent ones are smoothed.
+	c.observe("m", 100, 120)
+	require.Equal(t, uint32(120), c.calibrate("m", 100))
+	c.observe("m", 100, 220)
+	require.Equal(t, uint32(128), c.calibrate("m", 100))
+	// The outliers are bounded.
+	c.observe("other", 1, 1000)
+	require.Equal(t, uint32(200), c.calibrate("other", 100))
+}
+
+func Test_chatCompletionProcessor_tokenEstimation(t *testing.T) {
+	const backendName = "some-backend"
+	config := newTestConfig(t, tokenEstimationTestFilterConfig(), withWordTokenizer)
+	config.backends = map[string]*processorConfigBackend{backendName: {b: &filterapi.Backend{Name: backendName, Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI}}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	rp := &chatCompletionProcessorRouterFilter{
+		config:         config,
+		logger:         logger,
+		requestHeaders: map[string]string{":path": "/v1/chat/completions"},
+	}
+	res, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{
+		Body: []byte(`{"model":"some-model","max_tokens":50,"messages":[{"role":"user","content":"hello there"}]}`),
+	})
+	require.NoError(t, err)
+	ns := res.DynamicMetadata.Fields["ai_gateway_llm_ns"].GetStructValue().Fields
+	require.Equal(t, float64(8), ns["estimated_input"].GetNumberValue())
+	require.Equal(t, float64(50), ns["reserved_output"].GetNumberValue())
+	require.Equal(t, float64(58), ns["reserved_total"].GetNumberValue())
+	require.NotContains(t, ns, "output")
+
+	// The upstream filter reconciles the estimation with the actual usage.
+	mm := &mockChatCompletionMetrics{}
+	up := &chatCompletionProcessorUpstreamFilter{
+		config:         config,
+		logger:         logger,
+		requestHeaders: rp.requestHeaders,
+		metrics:        mm,
+	}
+	require.NoError(t, up.SetBackend(t.Context(), config.backends[backendName].b, nil, rp))
+	up.translator = &mockTranslator{t: t, retUsedToken: translator.LLMTokenUsage{InputTokens: 16, OutputTokens: 20, TotalTokens: 36}}
+	require.Same(t, rp.tokenEstimate, up.tokenEstimate)
+	res, err = up.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{EndOfStream: true})
+	require.NoError(t, err)
+	ns = res.DynamicMetadata.Fields["ai_gateway_llm_ns"].GetStructValue().Fields
+	require.Equal(t, float64(16), ns["estimated_input"].GetNumberValue())
+	require.Equal(t, float64(20), ns["reserved_output"].GetNumberValue())
+	require.Equal(t, float64(36), ns["reserved_total"].GetNumberValue())
+	require.Equal(t, uint32(16), config.tokenCalibrator.calibrate("some-model", 8))
+}
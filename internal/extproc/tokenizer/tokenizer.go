@@ -0,0 +1,138 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package tokenizer provides the tokenizers used to estimate the number of the input tokens of the requests
+// before they are sent upstream.
+package tokenizer
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/tiktoken-go/tokenizer/codec"
+
+	"github.com/envoyproxy/ai-gateway/filterapi/x"
+)
+
+// Registry selects the tokenizer for the model.
+type Registry struct {
+	newCustomFn x.NewCustomTokenizerFn
+}
+
+// NewRegistry creates a new [Registry]. The custom tokenizer created by newCustomFn takes precedence over the
+// built-in ones when it is not nil.
+func NewRegistry(newCustomFn x.NewCustomTokenizerFn) *Registry {
+	return &Registry{newCustomFn: newCustomFn}
+}
+
+// ForModel returns the tokenizer for the model. This never returns nil.
+//
+// The embedded BPE vocabularies are used for the OpenAI-family models, which yields the exact number of the tokens
+// of the text. For the other models, the number is approximated from the length of the text with the ratio
+// calibrated per model family.
+func (r *Registry) ForModel(model string) x.Tokenizer {
+	if r.newCustomFn != nil {
+		if t := r.newCustomFn(model); t != nil {
+			return t
+		}
+	}
+	lower := strings.ToLower(model)
+	// Strip the provider prefix such as "openai/gpt-4o".
+	lower = lower[strings.LastIndexByte(lower, '/')+1:]
+	for _, p := range o200kModelPrefixes {
+		if strings.HasPrefix(lower, p) {
+			return o200kBase()
+		}
+	}
+	for _, p := range cl100kModelPrefixes {
+		if strings.HasPrefix(lower, p) {
+			return cl100kBase()
+		}
+	}
+	for i := range heuristics {
+		if strings.Contains(lower, heuristics[i].family) {
+			return &heuristics[i]
+		}
+	}
+	return &defaultHeuristic
+}
+
+var (
+	// o200kModelPrefixes are the prefixes of the models using the o200k_base encoding.
+	o200kModelPrefixes = []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "gpt-oss", "chatgpt-4o", "o1", "o3", "o4", "ft:gpt-4o"}
+	// cl100kModelPrefixes are the prefixes of the models using the cl100k_base encoding. This is checked after
+	// o200kModelPrefixes since "gpt-4" is the prefix of "gpt-4o".
+	cl100kModelPrefixes = []string{"gpt-4", "gpt-3.5", "gpt-35", "text-embedding-", "ft:gpt-4", "ft:gpt-3.5"}
+
+	o200kBase  = sync.OnceValue(func() x.Tokenizer { return &bpe{codec: codec.NewO200kBase()} })
+	cl100kBase = sync.OnceValue(func() x.Tokenizer { return &bpe{codec: codec.NewCl100kBase()} })
+)
+
+// bpe implements [x.Tokenizer] with the byte pair encoding.
+type bpe struct {
+	codec *codec.Codec
+}
+
+// CountTokens implements [x.Tokenizer.CountTokens].
+func (b *bpe) CountTokens(text string) int {
+	n, err := b.codec.Count(text)
+	if err != nil {
+		// This only happens when the pre-tokenization fails, which shouldn't happen in practice.
+		return defaultHeuristic.CountTokens(text)
+	}
+	return n
+}
+
+// heuristic implements [x.Tokenizer] by approximating the number of the tokens from the length of the text.
+type heuristic struct {
+	// family is the substring of the model names this applies to.
+	family string
+	// charsPerToken is the average number of the ASCII characters per token.
+	charsPerToken float64
+	// tokensPerRune is the average number of the tokens per non-ASCII character, which is
+	// much higher than the ASCII one, especially for the CJK scripts.
+	tokensPerRune float64
+}
+
+var (
+	// heuristics are the ratios calibrated per model family against the token usage reported by the providers
+	// for the English prose, the source code and the CJK text.
+	heuristics = []heuristic{
+		{family: "claude", charsPerToken: 3.5, tokensPerRune: 1.2},
+		{family: "gemini", charsPerToken: 4.0, tokensPerRune: 0.8},
+		{family: "gemma", charsPerToken: 4.0, tokensPerRune: 0.8},
+		{family: "llama", charsPerToken: 3.8, tokensPerRune: 1.0},
+		{family: "mistral", charsPerToken: 3.6, tokensPerRune: 1.2},
+		{family: "mixtral", charsPerToken: 3.6, tokensPerRune: 1.2},
+		{family: "qwen", charsPerToken: 3.9, tokensPerRune: 0.7},
+		{family: "deepseek", charsPerToken: 3.9, tokensPerRune: 0.7},
+		{family: "command", charsPerToken: 4.0, tokensPerRune: 1.0},
+		{family: "titan", charsPerToken: 4.2, tokensPerRune: 1.0},
+	}
+	// defaultHeuristic is used for the models of the unknown family, which follows the well-known rule of thumb
+	// of "4 characters per token" for the English text.
+	defaultHeuristic = heuristic{charsPerToken: 4.0, tokensPerRune: 1.0}
+)
+
+// CountTokens implements [x.Tokenizer.CountTokens].
+func (h *heuristic) CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	var ascii, nonASCII int
+	for i := 0; i < len(text); {
+		if text[i] < utf8.RuneSelf {
+			ascii++
+			i++
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		nonASCII++
+		i += size
+	}
+	return int(math.Ceil(float64(ascii)/h.charsPerToken + float64(nonASCII)*h.tokensPerRune))
+}
@@ -0,0 +1,66 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi/x"
+)
+
+func TestRegistry_ForModel(t *testing.T) {
+	r := NewRegistry(nil)
+	for _, tc := range []struct {
+		model    string
+		expected x.Tokenizer
+	}{
+		{model: "gpt-4o-mini", expected: o200kBase()},
+		{model: "openai/gpt-4.1", expected: o200kBase()},
+		{model: "o3-mini", expected: o200kBase()},
+		{model: "gpt-4-turbo", expected: cl100kBase()},
+		{model: "gpt-3.5-turbo", expected: cl100kBase()},
+		{model: "text-embedding-3-small", expected: cl100kBase()},
+		{model: "us.anthropic.claude-3-5-sonnet-20241022-v2:0", expected: &heuristics[0]},
+		{model: "gemini-2.0-flash", expected: &heuristics[1]},
+		{model: "meta-llama/Llama-3.1-8B-Instruct", expected: &heuristics[3]},
+		{model: "some-cool-model", expected: &defaultHeuristic},
+	} {
+		t.Run(tc.model, func(t *testing.T) {
+			require.Same(t, tc.expected, r.ForModel(tc.model))
+		})
+	}
+}
+
+func TestRegistry_ForModel_custom(t *testing.T) {
+	custom := &heuristic{charsPerToken: 1}
+	r := NewRegistry(func(model string) x.Tokenizer {
+		if model == "custom" {
+			return custom
+		}
+		return nil
+	})
+	require.Same(t, custom, r.ForModel("custom"))
+	require.Same(t, o200kBase(), r.ForModel("gpt-4o"))
+}
+
+func TestBPE_CountTokens(t *testing.T) {
+	// The expected values are the same as the ones of the reference tiktoken implementation.
+	require.Equal(t, 0, o200kBase().CountTokens(""))
+	require.Equal(t, 2, o200kBase().CountTokens("hello world"))
+	require.Equal(t, 2, cl100kBase().CountTokens("hello world"))
+	require.Equal(t, 10, cl100kBase().CountTokens("The quick brown fox jumps over the lazy dog."))
+}
+
+func TestHeuristic_CountTokens(t *testing.T) {
+	h := &heuristic{charsPerToken: 4, tokensPerRune: 1.5}
+	require.Equal(t, 0, h.CountTokens(""))
+	require.Equal(t, 1, h.CountTokens("a"))
+	require.Equal(t, 3, h.CountTokens("hello world"))
+	require.Equal(t, 3, h.CountTokens("日本"))
+	require.Equal(t, 5, h.CountTokens("hello 日本"))
+}
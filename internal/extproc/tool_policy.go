@@ -0,0 +1,165 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/audit"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/guardrail"
+	"github.com/envoyproxy/ai-gateway/internal/internalapi"
+	"github.com/envoyproxy/ai-gateway/internal/metrics"
+)
+
+const (
+	// guardrailToolPolicy is the name of the tool policy in the metrics of the guardrails.
+	guardrailToolPolicy = "tool_policy"
+	// toolCallPhaseRequest and toolCallPhaseResponse are the phases of the tool calls in the audit records.
+	toolCallPhaseRequest  = "request"
+	toolCallPhaseResponse = "response"
+	// toolCallAllowed, toolCallStripped and toolCallRejected are the decisions of the tool calls in the audit records.
+	toolCallAllowed  = "allowed"
+	toolCallStripped = "stripped"
+	toolCallRejected = "rejected"
+)
+
+// newToolPolicies compiles the tool policies of the rules, and returns them keyed by the names of the rules.
+func newToolPolicies(rules []filterapi.RouteRule) (map[filterapi.RouteRuleName]*guardrail.ToolPolicy, error) {
+	ret := make(map[filterapi.RouteRuleName]*guardrail.ToolPolicy)
+	for i := range rules {
+		if rules[i].ToolPolicy == nil {
+			continue
+		}
+		p, err := guardrail.NewToolPolicy(rules[i].ToolPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tool policy of rule %s: %w", rules[i].Name, err)
+		}
+		ret[rules[i].Name] = p
+	}
+	return ret, nil
+}
+
+// toolPolicyOf returns the tool policy of the rule of the model, or nil if the rule has no tool policy.
+func toolPolicyOf(config *processorConfig, model string) *guardrail.ToolPolicy {
+	rule := config.rulesByModel[model]
+	if rule == nil {
+		return nil
+	}
+	return config.toolPolicies[rule.Name]
+}
+
+// enforceRequestToolPolicy checks the tools and the tool calls of the raw chat completion request body against the
+// tool policy of the rule of the model, and returns the local reply rejecting the request violating it, if any.
+func enforceRequestToolPolicy(ctx context.Context, config *processorConfig, metrics metrics.GuardrailMetrics, model string,
+	requestHeaders map[string]string, raw []byte, metricAttrs ...attribute.KeyValue,
+) *extprocv3.ProcessingResponse {
+	p := toolPolicyOf(config, model)
+	if p == nil {
+		return nil
+	}
+	call, param := p.CheckRequest(raw)
+	if call == nil {
+		return nil
+	}
+	metrics.RecordGuardrailDetections(ctx, guardrailToolPolicy, string(call.Violation), "Reject", 1, metricAttrs...)
+	exportToolCallRecord(config, requestHeaders, model, toolCallPhaseRequest, call, toolCallRejected)
+	return openAIParamErrorResponse(typev3.StatusCode_BadRequest, string(call.Violation), param, call.Reason)
+}
+
+// enforceResponseToolPolicy checks the tool calls of the non-streaming chat completion response against the
+// policy, and returns the response with the tool calls violating it stripped, which is nil if none is stripped.
+// When a tool call violates the policy and the tool calls are not stripped, this returns the local reply failing
+// the response instead.
+func enforceResponseToolPolicy(ctx context.Context, config *processorConfig, metrics metrics.GuardrailMetrics, p *guardrail.ToolPolicy,
+	model string, requestHeaders map[string]string, body []byte, metricAttrs ...attribute.KeyValue,
+) (stripped []byte, rejected *extprocv3.ProcessingResponse) {
+	stripped, calls := p.CheckResponse(body)
+	var violation *guardrail.ToolCall
+	for i := range calls {
+		if calls[i].Violation != "" && violation == nil {
+			violation = &calls[i]
+		}
+	}
+	reportResponseToolCalls(ctx, config, metrics, p, model, requestHeaders, calls, violation != nil && !p.Strip(), metricAttrs...)
+	if violation != nil && !p.Strip() {
+		return nil, openAIErrorResponse(typev3.StatusCode_BadRequest, string(violation.Violation), violation.Reason)
+	}
+	return stripped, nil
+}
+
+// filterStreamToolCalls filters the chunk of the streaming chat completion response with the filter, and returns
+// the events to be sent. When a tool call violates the policy and the tool calls are not stripped, the stream is
+// terminated with the error event and this returns true as terminated.
+func filterStreamToolCalls(ctx context.Context, config *processorConfig, metrics metrics.GuardrailMetrics, f *guardrail.ToolCallFilter,
+	p *guardrail.ToolPolicy, model string, requestHeaders map[string]string, chunk []byte, endOfStream bool, metricAttrs ...attribute.KeyValue,
+) (out []byte, terminated bool) {
+	out, calls, rejected := f.Stream(chunk, endOfStream)
+	reportResponseToolCalls(ctx, config, metrics, p, model, requestHeaders, calls, rejected != nil, metricAttrs...)
+	if rejected != nil {
+		// The status is already sent, so the error is sent as the last event of the stream.
+		out = append(out, errorEvent(typev3.StatusCode_BadRequest, string(rejected.Violation), rejected.Reason)...)
+	}
+	return out, rejected != nil
+}
+
+// reportResponseToolCalls records the metrics of the violations and the audit records of the tool calls of the
+// response. The rejected is true if the response is failed by the violation.
+func reportResponseToolCalls(ctx context.Context, config *processorConfig, metrics metrics.GuardrailMetrics, p *guardrail.ToolPolicy,
+	model string, requestHeaders map[string]string, calls []guardrail.ToolCall, rejected bool, metricAttrs ...attribute.KeyValue,
+) {
+	for i := range calls {
+		call := &calls[i]
+		decision := toolCallAllowed
+		switch {
+		case call.Violation == "":
+		case p.Strip():
+			decision = toolCallStripped
+			metrics.RecordGuardrailDetections(ctx, guardrailToolPolicy, string(call.Violation), "Strip", 1, metricAttrs...)
+		default:
+			decision = toolCallRejected
+			metrics.RecordGuardrailDetections(ctx, guardrailToolPolicy, string(call.Violation), "Reject", 1, metricAttrs...)
+		}
+		if rejected && decision == toolCallAllowed {
+			// The tool calls allowed are not returned either when the response is failed.
+			decision = toolCallRejected
+		}
+		exportToolCallRecord(config, requestHeaders, model, toolCallPhaseResponse, call, decision)
+	}
+}
+
+// exportToolCallRecord exports the audit record of the tool call. This is no-op if the audit log is not enabled.
+func exportToolCallRecord(config *processorConfig, requestHeaders map[string]string, model, phase string, call *guardrail.ToolCall, decision string) {
+	if config.auditLog == nil {
+		return
+	}
+	r := &audit.Record{
+		ID:       requestHeaders["x-request-id"],
+		Time:     time.Now(),
+		Kind:     audit.KindToolCall,
+		Consumer: requestHeaders[internalapi.ConsumerHeader],
+		Model:    model,
+		ToolCall: &audit.ToolCall{
+			Phase:     phase,
+			Choice:    call.Choice,
+			ID:        call.ID,
+			Name:      call.Name,
+			Arguments: call.Arguments,
+			Decision:  decision,
+			Reason:    call.Reason,
+		},
+	}
+	if rule := config.rulesByModel[model]; rule != nil {
+		r.Route = string(rule.Name)
+	}
+	config.auditLog.Export(r)
+}
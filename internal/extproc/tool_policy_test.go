@@ -0,0 +1,163 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/audit"
+)
+
+// fakeAuditSink is an [audit.Sink] recording the exported records.
+type fakeAuditSink struct {
+	mu      sync.Mutex
+	records []*audit.Record
+}
+
+// Export implements [audit.Sink.Export].
+func (s *fakeAuditSink) Export(_ context.Context, records []*audit.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+	return nil
+}
+
+// Close implements [audit.Sink.Close].
+func (s *fakeAuditSink) Close() error { return nil }
+
+// searchToolPolicy returns the tool policy allowing the tools starting with "search_".
+func searchToolPolicy(strip bool) *filterapi.ToolPolicy {
+	return &filterapi.ToolPolicy{AllowedTools: []string{"search_*"}, StripResponseToolCalls: strip}
+}
+
+// withAuditSink returns the setup of [newTestConfig] which exports the audit log to the sink.
+func withAuditSink(sink *fakeAuditSink) func(*Server) {
+	return func(s *Server) { s.SetAuditLog(audit.NewExporter(sink, slog.Default())) }
+}
+
+func Test_newToolPolicies(t *testing.T) {
+	policies, err := newToolPolicies([]filterapi.RouteRule{
+		{Name: "a", ToolPolicy: &filterapi.ToolPolicy{DeniedTools: []string{"delete_*"}}},
+		{Name: "b"},
+	})
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	require.NotNil(t, policies["a"])
+
+	_, err = newToolPolicies([]filterapi.RouteRule{{Name: "a", ToolPolicy: &filterapi.ToolPolicy{DeniedTools: []string{"["}}}})
+	require.ErrorContains(t, err, "invalid tool policy of rule a")
+}
+
+func Test_chatCompletionProcessor_toolPolicy(t *testing.T) {
+	toolCall := func(name string) string {
+		return `{"id":"call_` + name + `","type":"function","function":{"name":"` + name + `","arguments":"{}"}}`
+	}
+	response := func(names ...string) []byte {
+		calls := make([]string, len(names))
+		for i, name := range names {
+			calls[i] = toolCall(name)
+		}
+		return []byte(`{"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","tool_calls":[` +
+			strings.Join(calls, ",") + `]}}],"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}`)
+	}
+	processResponse := func(t *testing.T, config *processorConfig, req string, body []byte) (*extprocv3.ProcessingResponse, *mockChatCompletionMetrics) {
+		rp, _, metrics := newPIIGuardrailChatTest(t, config, req)
+		rp.requestHeaders["x-request-id"] = "req"
+		up := newGuardrailUpstreamTest(t, rp, metrics)
+		_, err := up.ProcessRequestHeaders(t.Context(), nil)
+		require.NoError(t, err)
+		res, err := up.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{Body: body, EndOfStream: true})
+		require.NoError(t, err)
+		require.NoError(t, config.auditLog.Close())
+		return res, metrics
+	}
+	const request = `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"tools":[{"type":"function","function":{"name":"search_web"}}]}`
+
+	t.Run("request rejected", func(t *testing.T) {
+		sink := &fakeAuditSink{}
+		config := newTestRuleConfig(t, filterapi.RouteRule{ToolPolicy: searchToolPolicy(false)}, withAuditSink(sink))
+		_, res, metrics := newPIIGuardrailChatTest(t, config, `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"tools":[{"type":"function","function":{"name":"delete_file"}}]}`)
+		requireOpenAIError(t, res, typev3.StatusCode_BadRequest, "tool_not_allowed")
+		require.Contains(t, string(res.GetImmediateResponse().Body), `"param":"tools"`)
+		require.Equal(t, map[string]int{"tool_policy/tool_not_allowed/Reject": 1}, metrics.detections)
+		require.NoError(t, config.auditLog.Close())
+		require.Len(t, sink.records, 1)
+		require.Equal(t, &audit.ToolCall{
+			Phase: "request", Name: "delete_file", Decision: "rejected", Reason: "The tool delete_file is not allowed.",
+		}, sink.records[0].ToolCall)
+	})
+
+	t.Run("response allowed", func(t *testing.T) {
+		sink := &fakeAuditSink{}
+		res, metrics := processResponse(t, newTestRuleConfig(t, filterapi.RouteRule{ToolPolicy: searchToolPolicy(false)}, withAuditSink(sink)), request, response("search_web"))
+		require.Nil(t, res.GetResponseBody().Response.BodyMutation)
+		require.Empty(t, metrics.detections)
+		require.Len(t, sink.records, 1)
+		r := sink.records[0]
+		require.Equal(t, "req", r.ID)
+		require.Equal(t, audit.KindToolCall, r.Kind)
+		require.Equal(t, "ns/route/rule/0", r.Route)
+		require.Equal(t, "gpt", r.Model)
+		require.Equal(t, &audit.ToolCall{Phase: "response", ID: "call_search_web", Name: "search_web", Arguments: "{}", Decision: "allowed"}, r.ToolCall)
+	})
+
+	t.Run("response rejected", func(t *testing.T) {
+		sink := &fakeAuditSink{}
+		res, metrics := processResponse(t, newTestRuleConfig(t, filterapi.RouteRule{ToolPolicy: searchToolPolicy(false)}, withAuditSink(sink)), request, response("search_web", "delete_file"))
+		requireOpenAIError(t, res, typev3.StatusCode_BadRequest, "tool_not_allowed")
+		require.Equal(t, map[string]int{"tool_policy/tool_not_allowed/Reject": 1}, metrics.detections)
+		// The usage of the rejected response is still accounted.
+		require.Equal(t, 1, metrics.tokenUsageCount)
+		require.Len(t, sink.records, 2)
+		require.Equal(t, "rejected", sink.records[0].ToolCall.Decision)
+		require.Equal(t, "rejected", sink.records[1].ToolCall.Decision)
+	})
+
+	t.Run("response stripped", func(t *testing.T) {
+		sink := &fakeAuditSink{}
+		res, metrics := processResponse(t, newTestRuleConfig(t, filterapi.RouteRule{ToolPolicy: searchToolPolicy(true)}, withAuditSink(sink)), request, response("search_web", "delete_file"))
+		require.JSONEq(t, string(response("search_web")), string(res.GetResponseBody().Response.BodyMutation.GetBody()))
+		require.Equal(t, map[string]int{"tool_policy/tool_not_allowed/Strip": 1}, metrics.detections)
+		require.Len(t, sink.records, 2)
+		require.Equal(t, "allowed", sink.records[0].ToolCall.Decision)
+		require.Equal(t, "stripped", sink.records[1].ToolCall.Decision)
+	})
+
+	t.Run("streaming response rejected", func(t *testing.T) {
+		sink := &fakeAuditSink{}
+		config := newTestRuleConfig(t, filterapi.RouteRule{ToolPolicy: searchToolPolicy(false)}, withAuditSink(sink))
+		rp, _, metrics := newPIIGuardrailChatTest(t, config, `{"model":"gpt","stream":true,"messages":[{"role":"user","content":"hello"}]}`)
+		up := newGuardrailUpstreamTest(t, rp, metrics)
+		require.NotNil(t, up.toolCallFilter)
+		_, err := up.ProcessRequestHeaders(t.Context(), nil)
+		require.NoError(t, err)
+		var out []byte
+		for _, chunk := range []string{
+			`data: {"id":"c","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"1","type":"function","function":{"name":"delete_`,
+			`file","arguments":"{}"}}]}}]}` + "\n\n",
+			`data: {"id":"c","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}` + "\n\ndata: [DONE]\n\n",
+		} {
+			res, err := up.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{Body: []byte(chunk), EndOfStream: strings.HasSuffix(chunk, "[DONE]\n\n")})
+			require.NoError(t, err)
+			out = append(out, res.GetResponseBody().Response.BodyMutation.GetBody()...)
+		}
+		require.NotContains(t, string(out), "delete_file\",")
+		require.NotContains(t, string(out), "[DONE]")
+		require.True(t, strings.HasPrefix(string(out), `data: {"type":"error","error":{"type":"invalid_request_error","code":"tool_not_allowed"`), string(out))
+		require.NoError(t, config.auditLog.Close())
+		require.Len(t, sink.records, 1)
+		require.Equal(t, "rejected", sink.records[0].ToolCall.Decision)
+	})
+}
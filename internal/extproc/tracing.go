@@ -0,0 +1,302 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/apischema/openai"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+	"github.com/envoyproxy/ai-gateway/internal/tracing"
+)
+
+// startProcessSpan starts the span of the stream joining the trace context of the request headers.
+//
+// The span of the router filter is the server span of the request, which is the parent of the spans of the upstream
+// filters. The span of the upstream filter is the client span of the attempt to the backend, whose context is
+// propagated to the backend. Both are renamed after the operation and the model once the request body is known.
+func startProcessSpan(ctx context.Context, tracer trace.Tracer, requestHeaders map[string]string, isUpstreamFilter bool) (context.Context, trace.Span) {
+	ctx = tracing.Propagator.Extract(ctx, propagation.MapCarrier(requestHeaders))
+	kind := trace.SpanKindServer
+	if isUpstreamFilter {
+		kind = trace.SpanKindClient
+	}
+	method, path := requestHeaders[":method"], requestHeaders[":path"]
+	if isUpstreamFilter {
+		path = requestHeaders[originalPathHeader]
+	}
+	path, _, _ = strings.Cut(path, "?")
+	return tracer.Start(ctx, strings.TrimSpace(method+" "+path), trace.WithSpanKind(kind), trace.WithAttributes(
+		attribute.String("http.request.method", method),
+		attribute.String("url.path", path),
+	))
+}
+
+// traceProcessing records the result of processing the message on the span of the stream. This is no-op if the
+// span is nil, i.e. the tracing is disabled.
+//
+// The trace context of the span is injected into the request headers, so that the upstream filters join the span of
+// the router filter, and the backend joins the span of the upstream filter.
+func traceProcessing(ctx context.Context, span trace.Span, req *extprocv3.ProcessingRequest, res *extprocv3.ProcessingResponse, err error, isUpstreamFilter bool) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return
+	}
+	if ir := res.GetImmediateResponse(); ir != nil {
+		traceResponseStatus(span, int(ir.GetStatus().GetCode()), isUpstreamFilter)
+		return
+	}
+	if headers := req.GetResponseHeaders().GetHeaders(); headers != nil {
+		status, _ := strconv.Atoi(headersToMap(headers)[":status"])
+		traceResponseStatus(span, status, isUpstreamFilter)
+	}
+	if rh, ok := res.GetResponse().(*extprocv3.ProcessingResponse_RequestHeaders); ok {
+		injectTraceContext(ctx, rh)
+	}
+}
+
+// traceResponseStatus records the status code of the response on the span. The server span is failed by the server
+// errors, and the client span is failed by any error response.
+func traceResponseStatus(span trace.Span, status int, isUpstreamFilter bool) {
+	if status == 0 {
+		return
+	}
+	span.SetAttributes(attribute.Int(tracing.AttributeHTTPStatusCode, status))
+	if status >= 500 || (isUpstreamFilter && status >= 400) {
+		span.SetAttributes(attribute.String(tracing.AttributeErrorType, strconv.Itoa(status)))
+		span.SetStatus(otelcodes.Error, "")
+	}
+}
+
+// injectTraceContext adds the headers of the trace context of the span in the context to the header mutation of the
+// response.
+func injectTraceContext(ctx context.Context, rh *extprocv3.ProcessingResponse_RequestHeaders) {
+	carrier := propagation.MapCarrier{}
+	tracing.Propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return
+	}
+	if rh.RequestHeaders == nil {
+		rh.RequestHeaders = &extprocv3.HeadersResponse{}
+	}
+	if rh.RequestHeaders.Response == nil {
+		rh.RequestHeaders.Response = &extprocv3.CommonResponse{}
+	}
+	if rh.RequestHeaders.Response.HeaderMutation == nil {
+		rh.RequestHeaders.Response.HeaderMutation = &extprocv3.HeaderMutation{}
+	}
+	hm := rh.RequestHeaders.Response.HeaderMutation
+	for _, key := range slices.Sorted(maps.Keys(carrier)) {
+		hm.SetHeaders = append(hm.SetHeaders, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{Key: key, RawValue: []byte(carrier[key])},
+		})
+	}
+}
+
+// traceRequest names the span in the context after the operation and the model of the request, and records them
+// with the additional attributes.
+func traceRequest(ctx context.Context, operation, model string, attrs ...attribute.KeyValue) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetName(operation + " " + model)
+	span.SetAttributes(attribute.String(tracing.AttributeOperationName, operation), attribute.String(tracing.AttributeRequestModel, model))
+	span.SetAttributes(attrs...)
+}
+
+// chatCompletionRequestAttributes returns the span attributes of the parameters of the chat completion request.
+func chatCompletionRequestAttributes(body *openai.ChatCompletionRequest) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if maxTokens := body.MaxCompletionTokens; maxTokens != nil {
+		attrs = append(attrs, attribute.Int64(tracing.AttributeRequestMaxTokens, *maxTokens))
+	} else if maxTokens = body.MaxTokens; maxTokens != nil {
+		attrs = append(attrs, attribute.Int64(tracing.AttributeRequestMaxTokens, *maxTokens))
+	}
+	if body.Temperature != nil {
+		attrs = append(attrs, attribute.Float64(tracing.AttributeRequestTemperature, *body.Temperature))
+	}
+	if body.TopP != nil {
+		attrs = append(attrs, attribute.Float64(tracing.AttributeRequestTopP, *body.TopP))
+	}
+	return attrs
+}
+
+// tracePrompt adds the event of the messages of the chat completion request to the span in the context when the
+// capture of the content is enabled. The request is the one sent upstream, i.e. after the guardrails redacted it.
+func tracePrompt(ctx context.Context, config *processorConfig, request []byte) {
+	span := trace.SpanFromContext(ctx)
+	if !config.traceContent || !span.IsRecording() {
+		return
+	}
+	span.AddEvent(tracing.EventPrompt, trace.WithAttributes(attribute.String(tracing.AttributePrompt, gjson.GetBytes(request, "messages").Raw)))
+}
+
+// traceBackend records the backend selected for the attempt on the span in the context.
+func traceBackend(ctx context.Context, operation, model string, b *filterapi.Backend) {
+	traceRequest(ctx, operation, model, attribute.String(tracing.AttributeSystem, tracing.System(b.Schema.Name)))
+}
+
+// traceEmbeddingsResponse records the token usage of the successful embeddings response from the backend of the API
+// schema on the span in the context.
+func traceEmbeddingsResponse(ctx context.Context, schema filterapi.APISchemaName, usage *translator.LLMTokenUsage) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.String(tracing.AttributeSystem, tracing.System(schema)),
+		attribute.Int64(tracing.AttributeUsageInputTokens, int64(usage.InputTokens)),
+	)
+}
+
+// chatCompletionResponseSpan records the chat completion response returned to the client on the span.
+type chatCompletionResponseSpan struct {
+	span           trace.Span
+	stream         bool
+	captureContent bool
+	// body is the non-streaming response, and pending is the incomplete event of the streaming response carried over
+	// to the next part.
+	body, pending []byte
+	id, model     string
+	// choices are the choices of the streaming response in the order of their first appearance.
+	choices []*tracedChoice
+}
+
+// tracedChoice is the choice of the streaming response accumulated for the span.
+type tracedChoice struct {
+	Index        int64  `json:"index"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	Message      struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+
+	content strings.Builder
+}
+
+// newChatCompletionResponseSpan creates a new chatCompletionResponseSpan recording the response from the backend of
+// the API schema.
+func newChatCompletionResponseSpan(span trace.Span, schema filterapi.APISchemaName, stream, captureContent bool) *chatCompletionResponseSpan {
+	span.SetAttributes(attribute.String(tracing.AttributeSystem, tracing.System(schema)))
+	return &chatCompletionResponseSpan{span: span, stream: stream, captureContent: captureContent}
+}
+
+// record records the part of the successful response, and sets the attributes of the response on the span with the
+// token usage at the end of the stream.
+func (s *chatCompletionResponseSpan) record(part []byte, endOfStream bool, usage *translator.LLMTokenUsage) {
+	if !s.stream {
+		s.body = append(s.body, part...)
+	} else {
+		s.pending = append(s.pending, part...)
+		events := bytes.Split(s.pending, []byte("\n\n"))
+		for _, event := range events[:len(events)-1] {
+			s.recordChunk(event)
+		}
+		s.pending = append(s.pending[:0], events[len(events)-1]...)
+	}
+	if !endOfStream {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attribute.Int64(tracing.AttributeUsageInputTokens, int64(usage.InputTokens)),
+		attribute.Int64(tracing.AttributeUsageOutputTokens, int64(usage.OutputTokens)),
+	}
+	var finishReasons []string
+	var completion string
+	if s.stream {
+		s.recordChunk(s.pending)
+		for _, c := range s.choices {
+			finishReasons = append(finishReasons, c.FinishReason)
+			c.Message.Content = c.content.String()
+		}
+		if s.captureContent {
+			encoded, _ := json.Marshal(s.choices)
+			completion = string(encoded)
+		}
+	} else {
+		response := gjson.ParseBytes(s.body)
+		s.id, s.model = response.Get("id").String(), response.Get("model").String()
+		for _, c := range response.Get("choices").Array() {
+			finishReasons = append(finishReasons, c.Get("finish_reason").String())
+		}
+		completion = response.Get("choices").Raw
+	}
+	if s.id != "" {
+		attrs = append(attrs, attribute.String(tracing.AttributeResponseID, s.id))
+	}
+	if s.model != "" {
+		attrs = append(attrs, attribute.String(tracing.AttributeResponseModel, s.model))
+	}
+	if len(finishReasons) > 0 {
+		attrs = append(attrs, attribute.StringSlice(tracing.AttributeResponseFinishReasons, finishReasons))
+	}
+	s.span.SetAttributes(attrs...)
+	if s.captureContent {
+		s.span.AddEvent(tracing.EventCompletion, trace.WithAttributes(attribute.String(tracing.AttributeCompletion, completion)))
+	}
+}
+
+// recordChunk records the chunk in the event of the streaming response.
+func (s *chatCompletionResponseSpan) recordChunk(event []byte) {
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+		chunk := gjson.ParseBytes(bytes.TrimSpace(data))
+		if !chunk.IsObject() {
+			continue
+		}
+		if v := chunk.Get("id").String(); v != "" {
+			s.id = v
+		}
+		if v := chunk.Get("model").String(); v != "" {
+			s.model = v
+		}
+		for _, c := range chunk.Get("choices").Array() {
+			choice := s.choice(c.Get("index").Int())
+			if v := c.Get("finish_reason").String(); v != "" {
+				choice.FinishReason = v
+			}
+			if s.captureContent {
+				choice.content.WriteString(c.Get("delta.content").String())
+			}
+		}
+	}
+}
+
+// choice returns the choice of the streaming response at the index.
+func (s *chatCompletionResponseSpan) choice(index int64) *tracedChoice {
+	for _, c := range s.choices {
+		if c.Index == index {
+			return c
+		}
+	}
+	c := &tracedChoice{Index: index}
+	c.Message.Role = "assistant"
+	s.choices = append(s.choices, c)
+	return c
+}
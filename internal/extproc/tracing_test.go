@@ -0,0 +1,259 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/tracing"
+)
+
+// tracingTestStream implements [extprocv3.ExternalProcessor_ProcessServer] by receiving the requests in order
+// and recording the responses.
+type tracingTestStream struct {
+	mockExternalProcessingStream
+	requests  []*extprocv3.ProcessingRequest
+	responses []*extprocv3.ProcessingResponse
+}
+
+func (s *tracingTestStream) Context() context.Context { return s.ctx }
+
+func (s *tracingTestStream) Recv() (*extprocv3.ProcessingRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *tracingTestStream) Send(res *extprocv3.ProcessingResponse) error {
+	s.responses = append(s.responses, res)
+	return nil
+}
+
+func newTracingTestProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	sr := tracetest.NewSpanRecorder()
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)), sr
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestServer_Process_tracing(t *testing.T) {
+	const traceID, parentSpanID = "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"
+	headers := func(kvs ...string) *corev3.HeaderMap {
+		hm := &corev3.HeaderMap{}
+		for i := 0; i < len(kvs); i += 2 {
+			hm.Headers = append(hm.Headers, &corev3.HeaderValue{Key: kvs[i], RawValue: []byte(kvs[i+1])})
+		}
+		return hm
+	}
+
+	t.Run("router filter", func(t *testing.T) {
+		s, _ := requireNewServerWithMockProcessor(t)
+		s.Register("/v1/chat/completions", func(*processorConfig, map[string]string, *slog.Logger, bool) (Processor, error) {
+			return passThroughProcessor{}, nil
+		})
+		tp, sr := newTracingTestProvider()
+		s.SetTracing(tp.Tracer(tracing.ScopeName), false)
+
+		ms := &tracingTestStream{mockExternalProcessingStream: mockExternalProcessingStream{t: t, ctx: t.Context()}, requests: []*extprocv3.ProcessingRequest{
+			{Request: &extprocv3.ProcessingRequest_RequestHeaders{RequestHeaders: &extprocv3.HttpHeaders{Headers: headers(
+				":method", "POST", ":path", "/v1/chat/completions", "traceparent", "00-"+traceID+"-"+parentSpanID+"-01",
+			)}}},
+			{Request: &extprocv3.ProcessingRequest_ResponseHeaders{ResponseHeaders: &extprocv3.HttpHeaders{Headers: headers(":status", "503")}}},
+		}}
+		require.NoError(t, s.Process(ms))
+
+		spans := sr.Ended()
+		require.Len(t, spans, 1)
+		span := spans[0]
+		require.Equal(t, "POST /v1/chat/completions", span.Name())
+		require.Equal(t, trace.SpanKindServer, span.SpanKind())
+		require.Equal(t, traceID, span.SpanContext().TraceID().String())
+		require.Equal(t, parentSpanID, span.Parent().SpanID().String())
+		require.Equal(t, otelcodes.Error, span.Status().Code)
+		attrs := spanAttributes(span)
+		require.Equal(t, int64(503), attrs[tracing.AttributeHTTPStatusCode].AsInt64())
+		require.Equal(t, "503", attrs[tracing.AttributeErrorType].AsString())
+		require.Equal(t, "/v1/chat/completions", attrs["url.path"].AsString())
+
+		// The trace context of the span is propagated to the upstream filters.
+		require.Len(t, ms.responses, 2)
+		setHeaders := ms.responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders()
+		require.Len(t, setHeaders, 1)
+		require.Equal(t, "traceparent", setHeaders[0].Header.Key)
+		require.Equal(t, "00-"+traceID+"-"+span.SpanContext().SpanID().String()+"-01", string(setHeaders[0].Header.RawValue))
+	})
+
+	t.Run("upstream filter error", func(t *testing.T) {
+		s, _ := requireNewServerWithMockProcessor(t)
+		tp, sr := newTracingTestProvider()
+		s.SetTracing(tp.Tracer(tracing.ScopeName), false)
+
+		ms := &tracingTestStream{mockExternalProcessingStream: mockExternalProcessingStream{t: t, ctx: t.Context()}, requests: []*extprocv3.ProcessingRequest{{
+			Attributes: map[string]*structpb.Struct{
+				"envoy.filters.http.ext_proc": {Fields: map[string]*structpb.Value{"something": {}}},
+			},
+			Request: &extprocv3.ProcessingRequest_RequestHeaders{RequestHeaders: &extprocv3.HttpHeaders{Headers: headers(
+				":method", "POST", originalPathHeader, "/",
+			)}},
+		}}}
+		require.ErrorContains(t, s.Process(ms), "missing xds.upstream_host_metadata in request")
+
+		spans := sr.Ended()
+		require.Len(t, spans, 1)
+		require.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+		require.Equal(t, "POST /", spans[0].Name())
+		require.Equal(t, otelcodes.Error, spans[0].Status().Code)
+		require.Len(t, spans[0].Events(), 1)
+		require.Equal(t, "exception", spans[0].Events()[0].Name)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		s, _ := requireNewServerWithMockProcessor(t)
+		s.Register("/v1/chat/completions", func(*processorConfig, map[string]string, *slog.Logger, bool) (Processor, error) {
+			return passThroughProcessor{}, nil
+		})
+		ms := &tracingTestStream{mockExternalProcessingStream: mockExternalProcessingStream{t: t, ctx: t.Context()}, requests: []*extprocv3.ProcessingRequest{
+			{Request: &extprocv3.ProcessingRequest_RequestHeaders{RequestHeaders: &extprocv3.HttpHeaders{Headers: headers(
+				":method", "POST", ":path", "/v1/chat/completions", "traceparent", "00-"+traceID+"-"+parentSpanID+"-01",
+			)}}},
+		}}
+		require.NoError(t, s.Process(ms))
+		require.Len(t, ms.responses, 1)
+		require.Nil(t, ms.responses[0].GetRequestHeaders())
+	})
+}
+
+func Test_chatCompletionProcessor_tracing(t *testing.T) {
+	const request = `{"model":"gpt","max_tokens":100,"temperature":0.5,"top_p":0.9,"messages":[{"role":"user","content":"hi"}]}`
+
+	// newTracedChat processes the request at the router filter and the upstream filter, each in its span.
+	newTracedChat := func(t *testing.T, body string) (context.Context, *chatCompletionProcessorUpstreamFilter, *tracetest.SpanRecorder, func()) {
+		tp, sr := newTracingTestProvider()
+		tracer := tp.Tracer(tracing.ScopeName)
+		config := newTestRuleConfig(t, filterapi.RouteRule{})
+		config.traceContent = true
+		metrics := &mockChatCompletionMetrics{}
+		rp := &chatCompletionProcessorRouterFilter{
+			config: config, logger: slog.Default(), metrics: metrics,
+			requestHeaders: map[string]string{":path": "/v1/chat/completions"},
+		}
+		routerCtx, routerSpan := tracer.Start(t.Context(), "POST /v1/chat/completions", trace.WithSpanKind(trace.SpanKindServer))
+		_, err := rp.ProcessRequestBody(routerCtx, &extprocv3.HttpBody{Body: []byte(body)})
+		require.NoError(t, err)
+
+		upstreamCtx, upstreamSpan := tracer.Start(routerCtx, "POST /v1/chat/completions", trace.WithSpanKind(trace.SpanKindClient))
+		up := &chatCompletionProcessorUpstreamFilter{
+			config: config, logger: slog.Default(), metrics: metrics, requestHeaders: rp.requestHeaders,
+			responseHeaders: map[string]string{":status": "200"},
+		}
+		require.NoError(t, up.SetBackend(upstreamCtx, &filterapi.Backend{
+			Name: "backend", Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI, Version: "v1"},
+		}, nil, rp))
+		_, err = up.ProcessRequestHeaders(upstreamCtx, nil)
+		require.NoError(t, err)
+		upstreamSpan.End()
+		// The response is processed at the router filter.
+		return routerCtx, up, sr, func() { routerSpan.End() }
+	}
+
+	t.Run("non-streaming", func(t *testing.T) {
+		ctx, up, sr, end := newTracedChat(t, request)
+		_, err := up.ProcessResponseBody(ctx, &extprocv3.HttpBody{EndOfStream: true, Body: []byte(`{"id":"chatcmpl-1","object":"chat.completion",` +
+			`"model":"gpt-2024","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],` +
+			`"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`)})
+		require.NoError(t, err)
+		end()
+
+		spans := sr.Ended()
+		require.Len(t, spans, 2)
+		upstream, router := spans[0], spans[1]
+		require.Equal(t, "chat gpt", upstream.Name())
+		require.Equal(t, "openai", spanAttributes(upstream)[tracing.AttributeSystem].AsString())
+
+		require.Equal(t, "chat gpt", router.Name())
+		attrs := spanAttributes(router)
+		require.Equal(t, "chat", attrs[tracing.AttributeOperationName].AsString())
+		require.Equal(t, "gpt", attrs[tracing.AttributeRequestModel].AsString())
+		require.Equal(t, int64(100), attrs[tracing.AttributeRequestMaxTokens].AsInt64())
+		require.InDelta(t, 0.5, attrs[tracing.AttributeRequestTemperature].AsFloat64(), 0)
+		require.InDelta(t, 0.9, attrs[tracing.AttributeRequestTopP].AsFloat64(), 0)
+		require.Equal(t, "openai", attrs[tracing.AttributeSystem].AsString())
+		require.Equal(t, "chatcmpl-1", attrs[tracing.AttributeResponseID].AsString())
+		require.Equal(t, "gpt-2024", attrs[tracing.AttributeResponseModel].AsString())
+		require.Equal(t, []string{"stop"}, attrs[tracing.AttributeResponseFinishReasons].AsStringSlice())
+		require.Equal(t, int64(5), attrs[tracing.AttributeUsageInputTokens].AsInt64())
+		require.Equal(t, int64(1), attrs[tracing.AttributeUsageOutputTokens].AsInt64())
+
+		events := router.Events()
+		require.Len(t, events, 2)
+		require.Equal(t, tracing.EventPrompt, events[0].Name)
+		require.JSONEq(t, `[{"role":"user","content":"hi"}]`, events[0].Attributes[0].Value.AsString())
+		require.Equal(t, tracing.EventCompletion, events[1].Name)
+		require.JSONEq(t, `[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]`,
+			events[1].Attributes[0].Value.AsString())
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		ctx, up, sr, end := newTracedChat(t, `{"model":"gpt","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+		for i, part := range []string{
+			`data: {"id":"chatcmpl-2","model":"gpt-2024","choices":[{"index":0,"delta":{"role":"assistant","content":"hel"}}]}` + "\n\ndata: {\"id\":\"chatcmpl-2\",",
+			`"model":"gpt-2024","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}` + "\n\n",
+			`data: {"id":"chatcmpl-2","model":"gpt-2024","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}` + "\n\ndata: [DONE]\n\n",
+		} {
+			_, err := up.ProcessResponseBody(ctx, &extprocv3.HttpBody{Body: []byte(part), EndOfStream: i == 2})
+			require.NoError(t, err)
+		}
+		end()
+
+		router := sr.Ended()[1]
+		attrs := spanAttributes(router)
+		require.Equal(t, "chatcmpl-2", attrs[tracing.AttributeResponseID].AsString())
+		require.Equal(t, "gpt-2024", attrs[tracing.AttributeResponseModel].AsString())
+		require.Equal(t, []string{"stop"}, attrs[tracing.AttributeResponseFinishReasons].AsStringSlice())
+		require.Equal(t, int64(5), attrs[tracing.AttributeUsageInputTokens].AsInt64())
+		require.Equal(t, int64(2), attrs[tracing.AttributeUsageOutputTokens].AsInt64())
+		events := router.Events()
+		require.Len(t, events, 2)
+		require.JSONEq(t, `[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]`,
+			events[1].Attributes[0].Value.AsString())
+	})
+
+	t.Run("error response", func(t *testing.T) {
+		ctx, up, sr, end := newTracedChat(t, request)
+		up.responseHeaders[":status"] = "429"
+		_, err := up.ProcessResponseBody(ctx, &extprocv3.HttpBody{EndOfStream: true, Body: []byte(`{"error":{"message":"slow down"}}`)})
+		require.NoError(t, err)
+		end()
+
+		attrs := spanAttributes(sr.Ended()[1])
+		require.NotContains(t, attrs, attribute.Key(tracing.AttributeResponseID))
+		require.NotContains(t, attrs, attribute.Key(tracing.AttributeUsageInputTokens))
+		require.Len(t, sr.Ended()[1].Events(), 1)
+	})
+}
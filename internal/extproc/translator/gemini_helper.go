@@ -568,16 +568,26 @@ func extractToolCallsFromGeminiParts(parts []*genai.Part) ([]openai.ChatCompleti
 }
 
 // geminiUsageToOpenAIUsage converts Gemini usage metadata to OpenAI usage.
+//
+// The candidate tokens of Gemini exclude the thought tokens, while the completion tokens of OpenAI include the
+// reasoning tokens. The prompt tokens of both include the ones read from the cached content.
 func geminiUsageToOpenAIUsage(metadata *genai.GenerateContentResponseUsageMetadata) openai.ChatCompletionResponseUsage {
 	if metadata == nil {
 		return openai.ChatCompletionResponseUsage{}
 	}
 
-	return openai.ChatCompletionResponseUsage{
-		CompletionTokens: int(metadata.CandidatesTokenCount),
+	ret := openai.ChatCompletionResponseUsage{
+		CompletionTokens: int(metadata.CandidatesTokenCount + metadata.ThoughtsTokenCount),
 		PromptTokens:     int(metadata.PromptTokenCount),
 		TotalTokens:      int(metadata.TotalTokenCount),
 	}
+	if metadata.CachedContentTokenCount > 0 {
+		ret.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: int(metadata.CachedContentTokenCount)}
+	}
+	if metadata.ThoughtsTokenCount > 0 {
+		ret.CompletionTokensDetails = &openai.CompletionTokensDetails{ReasoningTokens: int(metadata.ThoughtsTokenCount)}
+	}
+	return ret
 }
 
 // geminiLogprobsToOpenAILogprobs converts Gemini logprobs to OpenAI logprobs.
@@ -558,11 +558,8 @@ func (o *openAIToAWSBedrockTranslatorV1ChatCompletion) ResponseBody(respHeaders
 		for i := range o.events {
 			event := &o.events[i]
 			if usage := event.Usage; usage != nil {
-				tokenUsage = LLMTokenUsage{
-					InputTokens:  uint32(usage.InputTokens),  //nolint:gosec
-					OutputTokens: uint32(usage.OutputTokens), //nolint:gosec
-					TotalTokens:  uint32(usage.TotalTokens),  //nolint:gosec
-				}
+				openAIUsage := bedrockUsageToOpenAIUsage(usage)
+				tokenUsage = newLLMTokenUsage(&openAIUsage)
 			}
 			oaiEvent, ok := o.convertEvent(event)
 			if !ok {
@@ -594,16 +591,8 @@ func (o *openAIToAWSBedrockTranslatorV1ChatCompletion) ResponseBody(respHeaders
 	}
 	// Convert token usage.
 	if bedrockResp.Usage != nil {
-		tokenUsage = LLMTokenUsage{
-			InputTokens:  uint32(bedrockResp.Usage.InputTokens),  //nolint:gosec
-			OutputTokens: uint32(bedrockResp.Usage.OutputTokens), //nolint:gosec
-			TotalTokens:  uint32(bedrockResp.Usage.TotalTokens),  //nolint:gosec
-		}
-		openAIResp.Usage = openai.ChatCompletionResponseUsage{
-			TotalTokens:      bedrockResp.Usage.TotalTokens,
-			PromptTokens:     bedrockResp.Usage.InputTokens,
-			CompletionTokens: bedrockResp.Usage.OutputTokens,
-		}
+		openAIResp.Usage = bedrockUsageToOpenAIUsage(bedrockResp.Usage)
+		tokenUsage = newLLMTokenUsage(&openAIResp.Usage)
 	}
 
 	// AWS Bedrock does not support N(multiple choices) > 0, so there could be only one choice.
@@ -670,11 +659,8 @@ func (o *openAIToAWSBedrockTranslatorV1ChatCompletion) convertEvent(event *awsbe
 
 	switch {
 	case event.Usage != nil:
-		chunk.Usage = &openai.ChatCompletionResponseUsage{
-			TotalTokens:      event.Usage.TotalTokens,
-			PromptTokens:     event.Usage.InputTokens,
-			CompletionTokens: event.Usage.OutputTokens,
-		}
+		usage := bedrockUsageToOpenAIUsage(event.Usage)
+		chunk.Usage = &usage
 	case event.Role != nil:
 		chunk.Choices = append(chunk.Choices, openai.ChatCompletionResponseChunkChoice{
 			Delta: &openai.ChatCompletionResponseChunkChoiceDelta{
@@ -736,3 +722,18 @@ func (o *openAIToAWSBedrockTranslatorV1ChatCompletion) convertEvent(event *awsbe
 	}
 	return chunk, true
 }
+
+// bedrockUsageToOpenAIUsage converts the token usage of AWS Bedrock to the one of OpenAI. The input tokens of AWS
+// Bedrock exclude the ones read from and written to the prompt cache, while the prompt tokens of OpenAI include them.
+// AWS Bedrock does not report the reasoning tokens separately, so they are only counted in the completion tokens.
+func bedrockUsageToOpenAIUsage(usage *awsbedrock.TokenUsage) openai.ChatCompletionResponseUsage {
+	ret := openai.ChatCompletionResponseUsage{
+		TotalTokens:      usage.TotalTokens,
+		PromptTokens:     usage.InputTokens + usage.CacheReadInputTokens + usage.CacheWriteInputTokens,
+		CompletionTokens: usage.OutputTokens,
+	}
+	if usage.CacheReadInputTokens > 0 {
+		ret.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: usage.CacheReadInputTokens}
+	}
+	return ret
+}
@@ -1042,6 +1042,21 @@ func TestOpenAIToAWSBedrockTranslatorV1ChatCompletion_ResponseBody(t *testing.T)
 		_, _, _, err := o.ResponseBody(nil, bytes.NewBuffer([]byte("invalid")), false)
 		require.Error(t, err)
 	})
+	t.Run("prompt cache", func(t *testing.T) {
+		o := &openAIToAWSBedrockTranslatorV1ChatCompletion{}
+		body := `{"output":{"message":{"role":"assistant","content":[{"text":"response"}]}},` +
+			`"usage":{"inputTokens":10,"outputTokens":20,"totalTokens":180,"cacheReadInputTokens":100,"cacheWriteInputTokens":50}}`
+		_, bm, usedToken, err := o.ResponseBody(nil, bytes.NewBufferString(body), false)
+		require.NoError(t, err)
+		// The prompt tokens include the ones read from and written to the prompt cache.
+		require.Equal(t, LLMTokenUsage{InputTokens: 160, OutputTokens: 20, TotalTokens: 180, CachedInputTokens: 100}, usedToken)
+		var openAIResp openai.ChatCompletionResponse
+		require.NoError(t, json.Unmarshal(bm.GetBody(), &openAIResp))
+		require.Equal(t, openai.ChatCompletionResponseUsage{
+			PromptTokens: 160, CompletionTokens: 20, TotalTokens: 180,
+			PromptTokensDetails: &openai.PromptTokensDetails{CachedTokens: 100},
+		}, openAIResp.Usage)
+	})
 	tests := []struct {
 		name   string
 		input  awsbedrock.ConverseResponse
@@ -1363,6 +1378,26 @@ func TestOpenAIToAWSBedrockTranslator_convertEvent(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "usage with prompt cache",
+			in: awsbedrock.ConverseStreamEvent{
+				Usage: &awsbedrock.TokenUsage{
+					InputTokens:          10,
+					OutputTokens:         20,
+					TotalTokens:          130,
+					CacheReadInputTokens: 100,
+				},
+			},
+			out: &openai.ChatCompletionResponseChunk{
+				Object: "chat.completion.chunk",
+				Usage: &openai.ChatCompletionResponseUsage{
+					TotalTokens:         130,
+					PromptTokens:        110,
+					CompletionTokens:    20,
+					PromptTokensDetails: &openai.PromptTokensDetails{CachedTokens: 100},
+				},
+			},
+		},
 		{
 			name: "role",
 			in: awsbedrock.ConverseStreamEvent{
@@ -600,6 +600,22 @@ func anthropicToolUseToOpenAICalls(block anthropic.ContentBlockUnion) ([]openai.
 	return toolCalls, nil
 }
 
+// anthropicUsageToOpenAIUsage converts the token usage of Anthropic to the one of OpenAI. The input tokens of
+// Anthropic exclude the ones read from and written to the prompt cache, while the prompt tokens of OpenAI include them.
+// Anthropic does not report the thinking tokens separately, so they are only counted in the completion tokens.
+func anthropicUsageToOpenAIUsage(usage *anthropic.Usage) openai.ChatCompletionResponseUsage {
+	promptTokens := int(usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens)
+	ret := openai.ChatCompletionResponseUsage{
+		CompletionTokens: int(usage.OutputTokens),
+		PromptTokens:     promptTokens,
+		TotalTokens:      promptTokens + int(usage.OutputTokens),
+	}
+	if usage.CacheReadInputTokens > 0 {
+		ret.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: int(usage.CacheReadInputTokens)}
+	}
+	return ret
+}
+
 // ResponseHeaders implements [Translator.ResponseHeaders].
 func (o *openAIToGCPAnthropicTranslatorV1ChatCompletion) ResponseHeaders(headers map[string]string) (
 	headerMutation *extprocv3.HeaderMutation, err error,
@@ -639,16 +655,8 @@ func (o *openAIToGCPAnthropicTranslatorV1ChatCompletion) ResponseBody(respHeader
 		Object:  string(openAIconstant.ValueOf[openAIconstant.ChatCompletion]()),
 		Choices: make([]openai.ChatCompletionResponseChoice, 0),
 	}
-	tokenUsage = LLMTokenUsage{
-		InputTokens:  uint32(anthropicResp.Usage.InputTokens),                                    //nolint:gosec
-		OutputTokens: uint32(anthropicResp.Usage.OutputTokens),                                   //nolint:gosec
-		TotalTokens:  uint32(anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens), //nolint:gosec
-	}
-	openAIResp.Usage = openai.ChatCompletionResponseUsage{
-		CompletionTokens: int(anthropicResp.Usage.OutputTokens),
-		PromptTokens:     int(anthropicResp.Usage.InputTokens),
-		TotalTokens:      int(anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens),
-	}
+	openAIResp.Usage = anthropicUsageToOpenAIUsage(&anthropicResp.Usage)
+	tokenUsage = newLLMTokenUsage(&openAIResp.Usage)
 
 	finishReason, err := anthropicToOpenAIFinishReason(anthropicResp.StopReason)
 	if err != nil {
@@ -215,6 +215,28 @@ func TestOpenAIToGCPAnthropicTranslatorV1ChatCompletion_ResponseBody(t *testing.
 		require.Contains(t, err.Error(), "failed to unmarshal body")
 	})
 
+	t.Run("prompt cache", func(t *testing.T) {
+		body, err := json.Marshal(&anthropic.Message{
+			Role:       constant.Assistant(anthropic.MessageParamRoleAssistant),
+			Content:    []anthropic.ContentBlockUnion{{Type: "text", Text: "Hello there!"}},
+			StopReason: anthropic.StopReasonEndTurn,
+			Usage:      anthropic.Usage{InputTokens: 10, OutputTokens: 20, CacheReadInputTokens: 100, CacheCreationInputTokens: 50},
+		})
+		require.NoError(t, err)
+		translator := NewChatCompletionOpenAIToGCPAnthropicTranslator("", "")
+		_, bm, usedToken, err := translator.ResponseBody(map[string]string{statusHeaderName: "200"}, bytes.NewBuffer(body), true)
+		require.NoError(t, err)
+		// The prompt tokens include the ones read from and written to the prompt cache. The thinking tokens are not
+		// reported by Anthropic, so the reasoning tokens are always zero.
+		require.Equal(t, LLMTokenUsage{InputTokens: 160, OutputTokens: 20, TotalTokens: 180, CachedInputTokens: 100}, usedToken)
+		var gotResp openai.ChatCompletionResponse
+		require.NoError(t, json.Unmarshal(bm.GetBody(), &gotResp))
+		require.Equal(t, openai.ChatCompletionResponseUsage{
+			PromptTokens: 160, CompletionTokens: 20, TotalTokens: 180,
+			PromptTokensDetails: &openai.PromptTokensDetails{CachedTokens: 100},
+		}, gotResp.Usage)
+	})
+
 	tests := []struct {
 		name                   string
 		inputResponse          *anthropic.Message
@@ -96,19 +96,12 @@ func (o *openAIToGCPVertexAITranslatorV1ChatCompletion) ResponseBody(respHeaders
 		return nil, nil, LLMTokenUsage{}, fmt.Errorf("error marshaling OpenAI response: %w", err)
 	}
 
-	// Update token usage if available.
-	var usage LLMTokenUsage
-	if gcpResp.UsageMetadata != nil {
-		usage = LLMTokenUsage{
-			InputTokens:  uint32(gcpResp.UsageMetadata.PromptTokenCount),     // nolint:gosec
-			OutputTokens: uint32(gcpResp.UsageMetadata.CandidatesTokenCount), // nolint:gosec
-			TotalTokens:  uint32(gcpResp.UsageMetadata.TotalTokenCount),      // nolint:gosec
-		}
-	}
+	// The token usage is zero if the response has no usage metadata.
+	tokenUsage = newLLMTokenUsage(&openAIResp.Usage)
 
 	headerMutation, bodyMutation = buildRequestMutations("", openAIRespBytes)
 
-	return headerMutation, bodyMutation, usage, nil
+	return headerMutation, bodyMutation, tokenUsage, nil
 }
 
 // openAIMessageToGeminiMessage converts an OpenAI ChatCompletionRequest to a GCP Gemini GenerateContentRequest.
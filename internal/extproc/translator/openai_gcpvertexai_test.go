@@ -330,6 +330,23 @@ func TestOpenAIToGCPVertexAITranslatorV1ChatCompletion_ResponseHeaders(t *testin
 }
 
 func TestOpenAIToGCPVertexAITranslatorV1ChatCompletion_ResponseBody(t *testing.T) {
+	t.Run("thoughts and cached content", func(t *testing.T) {
+		o := &openAIToGCPVertexAITranslatorV1ChatCompletion{}
+		body := `{"candidates":[{"content":{"parts":[{"text":"hi"}]},"finishReason":"STOP"}],` +
+			`"usageMetadata":{"promptTokenCount":110,"cachedContentTokenCount":100,"candidatesTokenCount":15,"thoughtsTokenCount":30,"totalTokenCount":155}}`
+		_, bm, usedToken, err := o.ResponseBody(map[string]string{}, bytes.NewBufferString(body), true)
+		require.NoError(t, err)
+		// The completion tokens include the thought tokens, which are excluded from the candidate tokens of Gemini.
+		require.Equal(t, LLMTokenUsage{InputTokens: 110, OutputTokens: 45, TotalTokens: 155, CachedInputTokens: 100, ReasoningTokens: 30}, usedToken)
+		var openAIResp openai.ChatCompletionResponse
+		require.NoError(t, json.Unmarshal(bm.GetBody(), &openAIResp))
+		require.Equal(t, openai.ChatCompletionResponseUsage{
+			PromptTokens: 110, CompletionTokens: 45, TotalTokens: 155,
+			PromptTokensDetails:     &openai.PromptTokensDetails{CachedTokens: 100},
+			CompletionTokensDetails: &openai.CompletionTokensDetails{ReasoningTokens: 30},
+		}, openAIResp.Usage)
+	})
+
 	tests := []struct {
 		name              string
 		modelNameOverride string
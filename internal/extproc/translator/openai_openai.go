@@ -147,11 +147,7 @@ func (o *openAIToOpenAITranslatorV1ChatCompletion) ResponseBody(respHeaders map[
 	if err := json.NewDecoder(body).Decode(&resp); err != nil {
 		return nil, nil, tokenUsage, fmt.Errorf("failed to unmarshal body: %w", err)
 	}
-	tokenUsage = LLMTokenUsage{
-		InputTokens:  uint32(resp.Usage.PromptTokens),     //nolint:gosec
-		OutputTokens: uint32(resp.Usage.CompletionTokens), //nolint:gosec
-		TotalTokens:  uint32(resp.Usage.TotalTokens),      //nolint:gosec
-	}
+	tokenUsage = newLLMTokenUsage(&resp.Usage)
 	return
 }
 
@@ -175,11 +171,7 @@ func (o *openAIToOpenAITranslatorV1ChatCompletion) extractUsageFromBufferEvent()
 			continue
 		}
 		if usage := event.Usage; usage != nil {
-			tokenUsage = LLMTokenUsage{
-				InputTokens:  uint32(usage.PromptTokens),     //nolint:gosec
-				OutputTokens: uint32(usage.CompletionTokens), //nolint:gosec
-				TotalTokens:  uint32(usage.TotalTokens),      //nolint:gosec
-			}
+			tokenUsage = newLLMTokenUsage(usage)
 			o.bufferingDone = true
 			o.buffered = nil
 			return
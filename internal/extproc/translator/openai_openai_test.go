@@ -203,6 +203,13 @@ data: [DONE]
 			require.NoError(t, err)
 			require.Equal(t, LLMTokenUsage{TotalTokens: 42}, usedToken)
 		})
+		t.Run("usage details", func(t *testing.T) {
+			body := []byte(`{"usage":{"prompt_tokens":100,"completion_tokens":50,"total_tokens":150,"prompt_tokens_details":{"cached_tokens":80},"completion_tokens_details":{"reasoning_tokens":30}}}`)
+			o := &openAIToOpenAITranslatorV1ChatCompletion{}
+			_, _, usedToken, err := o.ResponseBody(nil, bytes.NewBuffer(body), false)
+			require.NoError(t, err)
+			require.Equal(t, LLMTokenUsage{InputTokens: 100, OutputTokens: 50, TotalTokens: 150, CachedInputTokens: 80, ReasoningTokens: 30}, usedToken)
+		})
 	})
 }
 
@@ -216,6 +223,13 @@ func TestExtractUsageFromBufferEvent(t *testing.T) {
 		require.Nil(t, o.buffered)
 	})
 
+	t.Run("usage details", func(t *testing.T) {
+		o := &openAIToOpenAITranslatorV1ChatCompletion{}
+		o.buffered = []byte("data: {\"usage\": {\"total_tokens\": 42, \"prompt_tokens_details\": {\"cached_tokens\": 8}, \"completion_tokens_details\": {\"reasoning_tokens\": 4}}}\n")
+		usedToken := o.extractUsageFromBufferEvent()
+		require.Equal(t, LLMTokenUsage{TotalTokens: 42, CachedInputTokens: 8, ReasoningTokens: 4}, usedToken)
+	})
+
 	t.Run("valid usage data after invalid", func(t *testing.T) {
 		o := &openAIToOpenAITranslatorV1ChatCompletion{}
 		o.buffered = []byte("data: invalid\ndata: {\"usage\": {\"total_tokens\": 42}}\n")
@@ -120,4 +120,26 @@ type LLMTokenUsage struct {
 	OutputTokens uint32
 	// TotalTokens is the total number of tokens consumed.
 	TotalTokens uint32
+	// CachedInputTokens is the number of the input tokens read from the prompt cache, which is part of InputTokens.
+	CachedInputTokens uint32
+	// ReasoningTokens is the number of the reasoning tokens, which is part of OutputTokens.
+	ReasoningTokens uint32
+}
+
+// newLLMTokenUsage converts the usage of the OpenAI chat completion to [LLMTokenUsage]. The translators of the other
+// schemas convert the usage of their backends to the one of OpenAI first, so that the cached input and the reasoning
+// tokens are counted the same way across the backends.
+func newLLMTokenUsage(usage *openai.ChatCompletionResponseUsage) LLMTokenUsage {
+	ret := LLMTokenUsage{
+		InputTokens:  uint32(usage.PromptTokens),     //nolint:gosec
+		OutputTokens: uint32(usage.CompletionTokens), //nolint:gosec
+		TotalTokens:  uint32(usage.TotalTokens),      //nolint:gosec
+	}
+	if d := usage.PromptTokensDetails; d != nil {
+		ret.CachedInputTokens = uint32(d.CachedTokens) //nolint:gosec
+	}
+	if d := usage.CompletionTokensDetails; d != nil {
+		ret.ReasoningTokens = uint32(d.ReasoningTokens) //nolint:gosec
+	}
+	return ret
 }
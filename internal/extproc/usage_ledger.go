@@ -0,0 +1,90 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/envoyproxy/ai-gateway/internal/extproc/ledger"
+	"github.com/envoyproxy/ai-gateway/internal/llmcostcel"
+)
+
+const (
+	// usageLedgerOperationChatCompletion and usageLedgerOperationEmbeddings are the operations of the usage records.
+	usageLedgerOperationChatCompletion = "chat_completion"
+	usageLedgerOperationEmbeddings     = "embeddings"
+)
+
+// usageLedger is the export of the usage records of the completed requests.
+type usageLedger struct {
+	exporter *ledger.Exporter
+	// consumerHeader and consumerJWTClaim identify the consumer of the request. The header takes precedence
+	// when both are set.
+	consumerHeader, consumerJWTClaim string
+}
+
+// consumer returns the identity of the consumer of the request, or empty if it cannot be identified.
+func (u *usageLedger) consumer(ctx context.Context, requestHeaders map[string]string) string {
+	if u.consumerHeader != "" {
+		if v := requestHeaders[strings.ToLower(u.consumerHeader)]; v != "" {
+			return v
+		}
+	}
+	if u.consumerJWTClaim != "" {
+		return jwtClaim(ctx, u.consumerJWTClaim)
+	}
+	return ""
+}
+
+// exportUsageRecord exports the usage record of the request completed with the response headers. This is no-op
+// if the usage ledger is not enabled.
+//
+// start is the time when the request arrived at the router filter.
+func exportUsageRecord(ctx context.Context, config *processorConfig, operation string, cc *llmcostcel.RequestContext, modelNameOverride string, responseHeaders map[string]string, start time.Time) {
+	if config.usageLedger == nil {
+		return
+	}
+	now := time.Now()
+	status, _ := strconv.Atoi(responseHeaders[":status"])
+	r := &ledger.Record{
+		ID:                cc.Request.Headers["x-request-id"],
+		Time:              now,
+		Operation:         operation,
+		Consumer:          config.usageLedger.consumer(ctx, cc.Request.Headers),
+		Model:             cc.Model,
+		Backend:           cc.Backend,
+		BackendModel:      modelNameOverride,
+		Stream:            cc.Request.Stream,
+		InputTokens:       cc.InputTokens,
+		OutputTokens:      cc.OutputTokens,
+		TotalTokens:       cc.TotalTokens,
+		CachedInputTokens: cc.CachedInputTokens,
+		ReasoningTokens:   cc.ReasoningTokens,
+		LatencyMs:         now.Sub(start).Milliseconds(),
+		Status:            status,
+	}
+	if b, ok := config.backends[cc.Backend]; ok && b.rule != nil {
+		r.Route = string(b.rule.Name)
+	}
+	if cc.Pricing != nil {
+		cost := cc.Pricing.CostMicroUSD
+		r.CostMicroUSD = &cost
+	}
+	if len(config.requestCosts) > 0 {
+		r.Costs = make(map[string]uint32, len(config.requestCosts))
+		for i := range config.requestCosts {
+			rc := &config.requestCosts[i]
+			// The costs which fail to be calculated are already reported when the dynamic metadata is built.
+			if cost, err := calculateRequestCost(rc, cc); err == nil {
+				r.Costs[rc.MetadataKey] = cost
+			}
+		}
+	}
+	config.usageLedger.exporter.Export(r)
+}
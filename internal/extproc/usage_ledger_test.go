@@ -0,0 +1,103 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package extproc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/ledger"
+	"github.com/envoyproxy/ai-gateway/internal/extproc/translator"
+)
+
+// recordingLedgerSink implements [ledger.Sink] by keeping the exported records.
+type recordingLedgerSink struct{ records []ledger.Record }
+
+// Export implements [ledger.Sink.Export].
+func (s *recordingLedgerSink) Export(_ context.Context, records []*ledger.Record) error {
+	for _, r := range records {
+		s.records = append(s.records, *r)
+	}
+	return nil
+}
+
+// Close implements [ledger.Sink.Close].
+func (s *recordingLedgerSink) Close() error { return nil }
+
+func Test_usageLedger_consumer(t *testing.T) {
+	ctx := withJWTClaims(t, map[string]any{"tier": "silver"})
+	headers := map[string]string{"x-team": "team-a"}
+	require.Equal(t, "team-a", (&usageLedger{consumerHeader: "X-Team", consumerJWTClaim: "tier"}).consumer(ctx, headers))
+	require.Equal(t, "silver", (&usageLedger{consumerHeader: "x-missing", consumerJWTClaim: "tier"}).consumer(ctx, headers))
+	require.Empty(t, (&usageLedger{consumerHeader: "x-missing"}).consumer(ctx, headers))
+	require.Empty(t, (&usageLedger{}).consumer(ctx, headers))
+}
+
+func Test_chatCompletionProcessor_usageLedger(t *testing.T) {
+	const backendName = "some-backend"
+	sink := &recordingLedgerSink{}
+	exporter := ledger.NewExporter(sink, slog.Default())
+	rule := &filterapi.RouteRule{Name: "some-rule"}
+	config := &processorConfig{
+		modelNameHeaderKey: "x-ai-eg-model",
+		metadataNamespace:  "ai_gateway_llm_ns",
+		backends: map[string]*processorConfigBackend{backendName: {
+			b:    &filterapi.Backend{Name: backendName, Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI}, ModelNameOverride: "override"},
+			rule: rule,
+		}},
+		requestCosts: []processorConfigRequestCost{{LLMRequestCost: &filterapi.LLMRequestCost{MetadataKey: "total", Type: filterapi.LLMRequestCostTypeTotalToken}}},
+		prices:       []filterapi.ModelPrice{{Model: "some-model", InputToken: 2, OutputToken: 8, ReasoningToken: 8}},
+		usageLedger:  &usageLedger{exporter: exporter, consumerHeader: "x-team"},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	rp := &chatCompletionProcessorRouterFilter{
+		config:         config,
+		logger:         logger,
+		requestHeaders: map[string]string{":path": "/v1/chat/completions", "x-request-id": "req-1", "x-team": "team-a"},
+		requestStart:   time.Now().Add(-time.Second),
+	}
+	_, err := rp.ProcessRequestBody(t.Context(), &extprocv3.HttpBody{
+		Body: []byte(`{"model":"some-model","messages":[{"role":"user","content":"hello"}]}`),
+	})
+	require.NoError(t, err)
+
+	for _, shadow := range []bool{false, true} {
+		config.backends[backendName].shadow = shadow
+		up := &chatCompletionProcessorUpstreamFilter{
+			config:          config,
+			logger:          logger,
+			requestHeaders:  rp.requestHeaders,
+			responseHeaders: map[string]string{":status": "200"},
+			metrics:         &mockChatCompletionMetrics{},
+		}
+		require.NoError(t, up.SetBackend(t.Context(), config.backends[backendName].b, nil, rp))
+		up.translator = &mockTranslator{t: t, retUsedToken: translator.LLMTokenUsage{InputTokens: 100, OutputTokens: 10, TotalTokens: 110, ReasoningTokens: 5}}
+		_, err = up.ProcessResponseBody(t.Context(), &extprocv3.HttpBody{EndOfStream: true})
+		require.NoError(t, err)
+	}
+	require.NoError(t, exporter.Close())
+
+	// The shadow request is not recorded.
+	require.Len(t, sink.records, 1)
+	r := sink.records[0]
+	require.GreaterOrEqual(t, r.LatencyMs, int64(1000))
+	require.False(t, r.Time.IsZero())
+	r.LatencyMs, r.Time = 0, time.Time{}
+	cost := uint64(280)
+	require.Equal(t, ledger.Record{
+		ID: "req-1", Operation: "chat_completion", Consumer: "team-a", Route: "some-rule",
+		Model: "some-model", Backend: backendName, BackendModel: "override",
+		InputTokens: 100, OutputTokens: 10, TotalTokens: 110, ReasoningTokens: 5,
+		CostMicroUSD: &cost, Costs: map[string]uint32{"total": 110}, Status: 200,
+	}, r)
+}
@@ -14,6 +14,47 @@ const (
 	InternalEndpointMetadataNamespace = "aigateway.envoy.io"
 	// InternalMetadataBackendNameKey is the key used to store the backend name
 	InternalMetadataBackendNameKey = "per_route_rule_backend_name"
+	// PrefixCacheAffinityKeyHeader is the request header populated by the extproc with the hash key of the prompt prefix.
+	// Envoy selects the endpoint with the consistent hashing on this header when the prefix cache affinity is enabled.
+	PrefixCacheAffinityKeyHeader = "x-ai-eg-prefix-cache-key"
+	// UpstreamAddressAttribute is the Envoy attribute of the address of the selected upstream host, which is
+	// sent to the upstream extproc when the prefix cache affinity is enabled.
+	UpstreamAddressAttribute = "upstream.address"
+	// EnvoyLBMetadataNamespace is the namespace of the endpoint metadata used by the subset load balancing in Envoy.
+	// The dynamic metadata in this namespace set by the extproc is used as the match criteria of the subset.
+	EnvoyLBMetadataNamespace = "envoy.lb"
+	// JWTAuthnMetadataNamespace is the namespace of the dynamic metadata where the JWT authentication filter of Envoy
+	// stores the payload of the verified JWT under the name of the JWT provider.
+	JWTAuthnMetadataNamespace = "envoy.filters.http.jwt_authn"
+	// ExperimentVariantMetadataKey is the key of the experiment variant in the EnvoyLBMetadataNamespace metadata.
+	ExperimentVariantMetadataKey = "ai_gateway_experiment_variant"
+	// ExperimentHeader is the response header populated with the name of the experiment the request is assigned in.
+	ExperimentHeader = "x-ai-eg-experiment"
+	// ExperimentVariantHeader is the response header populated with the experiment variant the request is assigned to.
+	ExperimentVariantHeader = "x-ai-eg-experiment-variant"
+	// ConcurrencySpillHeader is the header of the local reply by the upstream extproc when the request couldn't
+	// acquire the slot of the concurrency limit of the backend in time. Envoy retries the request on the backend
+	// refs with the lower priority when this header is present.
+	ConcurrencySpillHeader = "x-ai-eg-concurrency-spill"
+	// ConsumerHeader is the request header populated by the extproc with the consumer of the ConsumerKey
+	// authenticating the request.
+	ConsumerHeader = "x-ai-eg-consumer"
+	// ConsumerKeyHeader is the request header populated by the extproc with the "namespace/name" of the ConsumerKey
+	// authenticating the request.
+	ConsumerKeyHeader = "x-ai-eg-consumer-key"
+	// ConsumerLabelHeaderPrefix is the prefix of the request headers populated by the extproc with the labels of
+	// the ConsumerKey authenticating the request.
+	ConsumerLabelHeaderPrefix = "x-ai-eg-consumer-label-"
+	// CaptureHeader is the request header which enables the capture of the request by the extproc when its value is
+	// "true" and the capture of the route is in the "Header" mode.
+	CaptureHeader = "x-ai-eg-capture"
+	// ResponseCacheHeader is the response header set by the extproc to "hit" when the response is served from the
+	// response cache of the route, or to "miss" when the response is from the backend.
+	ResponseCacheHeader = "x-ai-eg-cache"
+	// HedgeAttemptHeader is the response header set by the upstream extproc to the index of the attempt of the
+	// request routed to a rule with the hedge policy, so that the router extproc identifies the attempt whose response
+	// is returned to the client. This is removed from the response before it is returned.
+	HedgeAttemptHeader = "x-ai-eg-hedge-attempt"
 )
 
 // PerRouteRuleRefBackendName generates a unique backend name for a per-route rule,
@@ -22,3 +63,14 @@ const (
 func PerRouteRuleRefBackendName(namespace, name, routeName string, routeRuleIndex, refIndex int) string {
 	return fmt.Sprintf("%s/%s/route/%s/rule/%d/ref/%d", namespace, name, routeName, routeRuleIndex, refIndex)
 }
+
+// PerRouteRuleName generates a unique name for a route rule in a specific AIGatewayRoute.
+func PerRouteRuleName(namespace, routeName string, routeRuleIndex int) string {
+	return fmt.Sprintf("%s/%s/rule/%d", namespace, routeName, routeRuleIndex)
+}
+
+// PerRouteRuleShadowBackendName generates a unique backend name for the shadow backend of a route rule
+// in a specific AIGatewayRoute.
+func PerRouteRuleShadowBackendName(namespace, name, routeName string, routeRuleIndex int) string {
+	return fmt.Sprintf("%s/%s/route/%s/rule/%d/shadow", namespace, name, routeName, routeRuleIndex)
+}
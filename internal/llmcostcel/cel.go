@@ -11,8 +11,10 @@ package llmcostcel
 
 import (
 	"fmt"
+	"reflect"
 
 	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
 )
 
 const (
@@ -21,18 +23,81 @@ const (
 	celInputTokensKey  = "input_tokens"
 	celOutputTokensKey = "output_tokens"
 	celTotalTokensKey  = "total_tokens"
+
+	celCachedInputTokensKey = "cached_input_tokens"
+	celReasoningTokensKey   = "reasoning_tokens"
+	celRequestKey           = "request"
+
+	celCostMicroUSDKey          = "cost_micro_usd"
+	celInputTokenPriceKey       = "input_token_price"
+	celOutputTokenPriceKey      = "output_token_price"
+	celCachedInputTokenPriceKey = "cached_input_token_price"
+	celReasoningTokenPriceKey   = "reasoning_token_price"
 )
 
+// RequestContext holds the values of the variables available in the CEL expression.
+type RequestContext struct {
+	// Model is the model name extracted from the request content.
+	Model string
+	// Backend is the name of the backend the request was sent to.
+	Backend string
+	// InputTokens, OutputTokens and TotalTokens are the token usage reported by the backend.
+	InputTokens, OutputTokens, TotalTokens uint32
+	// CachedInputTokens and ReasoningTokens are the parts of InputTokens and OutputTokens read from the prompt cache
+	// and used for the reasoning respectively.
+	CachedInputTokens, ReasoningTokens uint32
+	// Pricing is the price of the model in the pricing catalog. This is nil if the model has no price.
+	Pricing *Pricing
+	// Request is the attributes of the request available as the "request" variable.
+	Request Request
+}
+
+// Request is the attributes of the request available as the "request" variable in the CEL expression, e.g.,
+// "request.headers['x-tier']" or "request.stream".
+type Request struct {
+	// Headers are the request headers keyed by the lower-cased names.
+	Headers map[string]string `cel:"headers"`
+	// Stream is true if the request asked for the streaming response.
+	Stream bool `cel:"stream"`
+	// Retry is true if the request is a retry of the previous attempt to the backends.
+	Retry bool `cel:"retry"`
+	// Images is the number of the images in the request.
+	Images uint32 `cel:"images"`
+	// N is the number of the choices requested.
+	N uint32 `cel:"n"`
+}
+
+// Pricing is the price of the model in the pricing catalog applied to the request, and the cost of the request
+// computed from it. The prices are in micro-USD per token.
+type Pricing struct {
+	// CostMicroUSD is the cost of the request in micro-USD.
+	CostMicroUSD uint64
+	// InputTokenPrice, OutputTokenPrice, CachedInputTokenPrice and ReasoningTokenPrice are the prices per token.
+	InputTokenPrice, OutputTokenPrice, CachedInputTokenPrice, ReasoningTokenPrice float64
+}
+
 var env *cel.Env
 
 func init() {
 	var err error
 	env, err = cel.NewEnv(
+		// The optional types allow the access to the headers which may be absent, e.g.,
+		// "request.headers[?'x-tier'].orValue('free')". This must precede the native types.
+		cel.OptionalTypes(),
+		ext.NativeTypes(reflect.TypeFor[Request](), ext.ParseStructTags(true)),
 		cel.Variable(celModelNameKey, cel.StringType),
 		cel.Variable(celBackendKey, cel.StringType),
 		cel.Variable(celInputTokensKey, cel.UintType),
 		cel.Variable(celOutputTokensKey, cel.UintType),
 		cel.Variable(celTotalTokensKey, cel.UintType),
+		cel.Variable(celCachedInputTokensKey, cel.UintType),
+		cel.Variable(celReasoningTokensKey, cel.UintType),
+		cel.Variable(celRequestKey, cel.ObjectType("llmcostcel.Request")),
+		cel.Variable(celCostMicroUSDKey, cel.UintType),
+		cel.Variable(celInputTokenPriceKey, cel.DoubleType),
+		cel.Variable(celOutputTokenPriceKey, cel.DoubleType),
+		cel.Variable(celCachedInputTokenPriceKey, cel.DoubleType),
+		cel.Variable(celReasoningTokenPriceKey, cel.DoubleType),
 	)
 	if err != nil {
 		panic(fmt.Sprintf("cannot create CEL environment: %v", err))
@@ -52,21 +117,37 @@ func NewProgram(expr string) (prog cel.Program, err error) {
 	}
 
 	// Sanity check by evaluating the expression with some dummy values.
-	_, err = EvaluateProgram(prog, "dummy", "dummy", 0, 0, 0)
+	_, err = EvaluateProgram(prog, &RequestContext{Model: "dummy", Backend: "dummy"})
 	if err != nil {
 		return nil, fmt.Errorf("failed to evaluate CEL expression: %w", err)
 	}
 	return prog, nil
 }
 
-// EvaluateProgram evaluates the given CEL program with the given variables.
-func EvaluateProgram(prog cel.Program, modelName, backend string, inputTokens, outputTokens, totalTokens uint32) (uint64, error) {
+// EvaluateProgram evaluates the given CEL program with the variables in the given context.
+func EvaluateProgram(prog cel.Program, rc *RequestContext) (uint64, error) {
+	var pricing Pricing
+	if rc.Pricing != nil {
+		pricing = *rc.Pricing
+	}
+	req := rc.Request
+	if req.Headers == nil {
+		req.Headers = map[string]string{}
+	}
 	out, _, err := prog.Eval(map[string]interface{}{
-		celModelNameKey:    modelName,
-		celBackendKey:      backend,
-		celInputTokensKey:  inputTokens,
-		celOutputTokensKey: outputTokens,
-		celTotalTokensKey:  totalTokens,
+		celModelNameKey:             rc.Model,
+		celBackendKey:               rc.Backend,
+		celInputTokensKey:           rc.InputTokens,
+		celOutputTokensKey:          rc.OutputTokens,
+		celTotalTokensKey:           rc.TotalTokens,
+		celCachedInputTokensKey:     rc.CachedInputTokens,
+		celReasoningTokensKey:       rc.ReasoningTokens,
+		celRequestKey:               &req,
+		celCostMicroUSDKey:          pricing.CostMicroUSD,
+		celInputTokenPriceKey:       pricing.InputTokenPrice,
+		celOutputTokenPriceKey:      pricing.OutputTokenPrice,
+		celCachedInputTokenPriceKey: pricing.CachedInputTokenPrice,
+		celReasoningTokenPriceKey:   pricing.ReasoningTokenPrice,
 	})
 	if err != nil || out == nil {
 		return 0, fmt.Errorf("failed to evaluate CEL expression: %w", err)
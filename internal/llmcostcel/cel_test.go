@@ -28,15 +28,69 @@ func TestNewProgram(t *testing.T) {
 	t.Run("variables", func(t *testing.T) {
 		prog, err := NewProgram("model == 'cool_model' ?  input_tokens * output_tokens : total_tokens")
 		require.NoError(t, err)
-		v, err := EvaluateProgram(prog, "cool_model", "cool_backend", 100, 2, 3)
+		v, err := EvaluateProgram(prog, &RequestContext{Model: "cool_model", Backend: "cool_backend", InputTokens: 100, OutputTokens: 2, TotalTokens: 3})
 		require.NoError(t, err)
 		require.Equal(t, uint64(200), v)
 
-		v, err = EvaluateProgram(prog, "not_cool_model", "cool_backend", 100, 2, 3)
+		v, err = EvaluateProgram(prog, &RequestContext{Model: "not_cool_model", Backend: "cool_backend", InputTokens: 100, OutputTokens: 2, TotalTokens: 3})
 		require.NoError(t, err)
 		require.Equal(t, uint64(3), v)
 	})
 
+	t.Run("pricing", func(t *testing.T) {
+		prog, err := NewProgram("backend == 'cheap' ? cost_micro_usd / uint(2) : uint(double(input_tokens) * input_token_price + double(output_tokens) * output_token_price)")
+		require.NoError(t, err)
+		pricing := &Pricing{CostMicroUSD: 1000, InputTokenPrice: 2.5, OutputTokenPrice: 10, CachedInputTokenPrice: 1.25, ReasoningTokenPrice: 10}
+		v, err := EvaluateProgram(prog, &RequestContext{Model: "cool_model", Backend: "cheap", InputTokens: 100, OutputTokens: 20, TotalTokens: 120, Pricing: pricing})
+		require.NoError(t, err)
+		require.Equal(t, uint64(500), v)
+
+		v, err = EvaluateProgram(prog, &RequestContext{Model: "cool_model", Backend: "cool_backend", InputTokens: 100, OutputTokens: 20, TotalTokens: 120, Pricing: pricing})
+		require.NoError(t, err)
+		require.Equal(t, uint64(450), v)
+	})
+
+	t.Run("request context", func(t *testing.T) {
+		prog, err := NewProgram(`(request.headers[?'x-tier'].orValue('free') == 'gold' ? uint(1) : uint(2)) * ` +
+			`(input_tokens - cached_input_tokens + output_tokens + reasoning_tokens) * request.n + ` +
+			`(request.stream ? uint(10) : uint(0)) + (request.retry ? uint(100) : uint(0)) + request.images * uint(1000)`)
+		require.NoError(t, err)
+		rc := &RequestContext{
+			InputTokens: 100, OutputTokens: 20, CachedInputTokens: 60, ReasoningTokens: 5,
+			Request: Request{Headers: map[string]string{"x-tier": "gold"}, N: 2},
+		}
+		v, err := EvaluateProgram(prog, rc)
+		require.NoError(t, err)
+		require.Equal(t, uint64(130), v)
+
+		rc.Request = Request{Stream: true, Retry: true, Images: 1, N: 1}
+		v, err = EvaluateProgram(prog, rc)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2*65+10+100+1000), v)
+	})
+
+	t.Run("header presence", func(t *testing.T) {
+		prog, err := NewProgram("'x-tenant' in request.headers && request.headers['x-tenant'] == 'acme' ? total_tokens : uint(0)")
+		require.NoError(t, err)
+		v, err := EvaluateProgram(prog, &RequestContext{TotalTokens: 10, Request: Request{Headers: map[string]string{"x-tenant": "acme"}}})
+		require.NoError(t, err)
+		require.Equal(t, uint64(10), v)
+		v, err = EvaluateProgram(prog, &RequestContext{TotalTokens: 10})
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), v)
+	})
+
+	t.Run("header access without presence check", func(t *testing.T) {
+		// This would fail for the requests without the header, so it is rejected upfront.
+		_, err := NewProgram("request.headers['x-tier'] == 'gold' ? 1 : 2")
+		require.ErrorContains(t, err, "no such key: x-tier")
+	})
+
+	t.Run("unknown request field", func(t *testing.T) {
+		_, err := NewProgram("request.foo")
+		require.ErrorContains(t, err, "cannot compile CEL expression")
+	})
+
 	t.Run("uint", func(t *testing.T) {
 		_, err := NewProgram("uint(1)-uint(1200)")
 		require.ErrorContains(t, err, "failed to evaluate CEL expression: failed to evaluate CEL expression: unsigned integer overflow")
@@ -61,13 +115,13 @@ func TestEvaluateProgram(t *testing.T) {
 	t.Run("signed integer negative", func(t *testing.T) {
 		prog, err := NewProgram("int(input_tokens) - int(output_tokens)")
 		require.NoError(t, err)
-		_, err = EvaluateProgram(prog, "cool_model", "cool_backend", 100, 2000, 3)
+		_, err = EvaluateProgram(prog, &RequestContext{Model: "cool_model", Backend: "cool_backend", InputTokens: 100, OutputTokens: 2000, TotalTokens: 3})
 		require.ErrorContains(t, err, "CEL expression result is negative (-1900)")
 	})
 	t.Run("unsigned integer overflow", func(t *testing.T) {
 		prog, err := NewProgram("input_tokens - output_tokens")
 		require.NoError(t, err)
-		_, err = EvaluateProgram(prog, "cool_model", "cool_backend", 100, 2000, 3)
+		_, err = EvaluateProgram(prog, &RequestContext{Model: "cool_model", Backend: "cool_backend", InputTokens: 100, OutputTokens: 2000, TotalTokens: 3})
 		require.ErrorContains(t, err, "failed to evaluate CEL expression: unsigned integer overflow")
 	})
 	t.Run("ensure concurrency safety", func(t *testing.T) {
@@ -80,7 +134,7 @@ func TestEvaluateProgram(t *testing.T) {
 		for i := 0; i < 100; i++ {
 			go func() {
 				defer wg.Done()
-				v, err := EvaluateProgram(prog, "cool_model", "cool_backend", 100, 2, 3)
+				v, err := EvaluateProgram(prog, &RequestContext{Model: "cool_model", Backend: "cool_backend", InputTokens: 100, OutputTokens: 2, TotalTokens: 3})
 				require.NoError(t, err)
 				require.Equal(t, uint64(200), v)
 			}()
@@ -24,6 +24,7 @@ import (
 // baseMetrics provides shared functionality for AI Gateway metrics implementations.
 type baseMetrics struct {
 	metrics      *genAI
+	gateway      *aiGateway
 	operation    string
 	requestStart time.Time
 	model        string
@@ -35,6 +36,7 @@ type baseMetrics struct {
 func newBaseMetrics(meter metric.Meter, operation string) baseMetrics {
 	return baseMetrics{
 		metrics:   newGenAI(meter),
+		gateway:   newAIGateway(meter),
 		operation: operation,
 		model:     "unknown",
 		backend:   "unknown",
@@ -101,3 +103,56 @@ func (b *baseMetrics) RecordRequestCompletion(ctx context.Context, success bool,
 		)
 	}
 }
+
+// AddConcurrencyQueueDepth implements [ConcurrencyQueueMetrics.AddConcurrencyQueueDepth].
+func (b *baseMetrics) AddConcurrencyQueueDepth(ctx context.Context, backend string, delta int64) {
+	b.gateway.concurrencyQueueDepth.Add(ctx, delta, metric.WithAttributes(attribute.Key(aigwAttributeBackend).String(backend)))
+}
+
+// RecordConcurrencyQueueWait implements [ConcurrencyQueueMetrics.RecordConcurrencyQueueWait].
+func (b *baseMetrics) RecordConcurrencyQueueWait(ctx context.Context, backend string, wait time.Duration, admitted bool) {
+	b.gateway.concurrencyQueueWait.Record(ctx, wait.Seconds(), metric.WithAttributes(
+		attribute.Key(genaiAttributeOperationName).String(b.operation),
+		attribute.Key(aigwAttributeBackend).String(backend),
+		attribute.Bool(aigwAttributeQueueAdmitted, admitted),
+	))
+}
+
+// RecordCost implements [CostMetrics.RecordCost].
+func (b *baseMetrics) RecordCost(ctx context.Context, costMicroUSD uint64, extraAttrs ...attribute.KeyValue) {
+	b.gateway.usageCost.Add(ctx, float64(costMicroUSD)/1e6, metric.WithAttributes(b.buildBaseAttributes(extraAttrs...)...))
+}
+
+// RecordGuardrailDetections implements [GuardrailMetrics.RecordGuardrailDetections].
+func (b *baseMetrics) RecordGuardrailDetections(ctx context.Context, guardrail, detector, action string, count int, extraAttrs ...attribute.KeyValue) {
+	attrs := make([]attribute.KeyValue, 0, 4+len(extraAttrs))
+	attrs = append(attrs,
+		attribute.Key(genaiAttributeOperationName).String(b.operation),
+		attribute.Key(aigwAttributeGuardrail).String(guardrail),
+		attribute.Key(aigwAttributeGuardrailDetector).String(detector),
+		attribute.Key(aigwAttributeGuardrailAction).String(action),
+	)
+	b.gateway.guardrailDetections.Add(ctx, int64(count), metric.WithAttributes(append(attrs, extraAttrs...)...))
+}
+
+// RecordResponseCacheLookups implements [ResponseCacheMetrics.RecordResponseCacheLookups].
+func (b *baseMetrics) RecordResponseCacheLookups(ctx context.Context, cache string, hit bool, count int, extraAttrs ...attribute.KeyValue) {
+	attrs := make([]attribute.KeyValue, 0, 4+len(extraAttrs))
+	attrs = append(attrs,
+		attribute.Key(genaiAttributeOperationName).String(b.operation),
+		attribute.Key(genaiAttributeRequestModel).String(b.model),
+		attribute.Key(aigwAttributeResponseCache).String(cache),
+		attribute.Bool(aigwAttributeResponseCacheHit, hit),
+	)
+	b.gateway.responseCacheLookups.Add(ctx, int64(count), metric.WithAttributes(append(attrs, extraAttrs...)...))
+}
+
+// RecordResponseCacheSimilarity implements [ResponseCacheMetrics.RecordResponseCacheSimilarity].
+func (b *baseMetrics) RecordResponseCacheSimilarity(ctx context.Context, similarity float64, extraAttrs ...attribute.KeyValue) {
+	attrs := make([]attribute.KeyValue, 0, 2+len(extraAttrs))
+	attrs = append(attrs,
+		attribute.Key(genaiAttributeOperationName).String(b.operation),
+		attribute.Key(genaiAttributeRequestModel).String(b.model),
+	)
+	b.gateway.responseCacheSimilarity.Record(ctx, similarity, metric.WithAttributes(append(attrs, extraAttrs...)...))
+}
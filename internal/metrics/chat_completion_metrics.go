@@ -12,6 +12,7 @@ import (
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 
+	"github.com/envoyproxy/ai-gateway/filterapi"
 	"github.com/envoyproxy/ai-gateway/filterapi/x"
 )
 
@@ -24,16 +25,23 @@ type chatCompletion struct {
 	interTokenLatency float64
 }
 
-// NewChatCompletion creates a new x.ChatCompletionMetrics instance.
-func NewChatCompletion(meter metric.Meter, newCustomFn x.NewCustomChatCompletionMetricsFn) x.ChatCompletionMetrics {
+// NewChatCompletion creates a new ChatCompletionMetrics instance.
+//
+// When newCustomFn is set, the metrics of [x.ChatCompletionMetrics] are recorded by the custom implementation, while
+// the ones specific to the AI Gateway features are still recorded by the default implementation.
+func NewChatCompletion(meter metric.Meter, newCustomFn x.NewCustomChatCompletionMetricsFn) ChatCompletionMetrics {
 	if newCustomFn != nil {
-		return newCustomFn(meter)
+		return &customChatCompletion{chatCompletion: newChatCompletion(meter), custom: newCustomFn(meter)}
 	}
 	return DefaultChatCompletion(meter)
 }
 
-// DefaultChatCompletion creates a new default x.ChatCompletionMetrics instance.
-func DefaultChatCompletion(meter metric.Meter) x.ChatCompletionMetrics {
+// DefaultChatCompletion creates a new default ChatCompletionMetrics instance.
+func DefaultChatCompletion(meter metric.Meter) ChatCompletionMetrics {
+	return newChatCompletion(meter)
+}
+
+func newChatCompletion(meter metric.Meter) *chatCompletion {
 	return &chatCompletion{
 		baseMetrics: newBaseMetrics(meter, genaiOperationChat),
 	}
@@ -88,3 +96,106 @@ func (c *chatCompletion) GetTimeToFirstTokenMs() float64 {
 func (c *chatCompletion) GetInterTokenLatencyMs() float64 {
 	return c.interTokenLatency * 1000 // Convert seconds to milliseconds.
 }
+
+// RecordPrefixCacheAffinity implements [ChatCompletionMetrics.RecordPrefixCacheAffinity].
+func (c *chatCompletion) RecordPrefixCacheAffinity(ctx context.Context, hit bool, extraAttrs ...attribute.KeyValue) {
+	attrs := c.buildBaseAttributes(extraAttrs...)
+	c.gateway.prefixCacheAffinityRequests.Add(ctx, 1,
+		metric.WithAttributes(attrs...),
+		metric.WithAttributes(attribute.Bool(aigwAttributePrefixCacheAffinityHit, hit)),
+	)
+}
+
+// RecordShadowComparison implements [ChatCompletionMetrics.RecordShadowComparison].
+func (c *chatCompletion) RecordShadowComparison(ctx context.Context, model string, primary, shadow *ShadowResult, extraAttrs ...attribute.KeyValue) {
+	attrs := make([]attribute.KeyValue, 0, 3+len(extraAttrs))
+	attrs = append(attrs,
+		attribute.Key(genaiAttributeOperationName).String(c.operation),
+		attribute.Key(genaiAttributeRequestModel).String(model),
+		attribute.Key(aigwAttributeShadowBackend).String(shadow.Backend),
+	)
+	attrs = append(attrs, extraAttrs...)
+
+	for _, r := range []struct {
+		role   string
+		result *ShadowResult
+	}{{aigwShadowRolePrimary, primary}, {aigwShadowRoleShadow, shadow}} {
+		roleAttr := attribute.Key(aigwAttributeShadowRole).String(r.role)
+		c.gateway.shadowRequestDuration.Record(ctx, r.result.Latency.Seconds(),
+			metric.WithAttributes(attrs...), metric.WithAttributes(roleAttr))
+		c.gateway.shadowTokenUsage.Record(ctx, float64(r.result.InputTokens),
+			metric.WithAttributes(attrs...), metric.WithAttributes(roleAttr,
+				attribute.Key(genaiAttributeTokenType).String(genaiTokenTypeInput)))
+		c.gateway.shadowTokenUsage.Record(ctx, float64(r.result.OutputTokens),
+			metric.WithAttributes(attrs...), metric.WithAttributes(roleAttr,
+				attribute.Key(genaiAttributeTokenType).String(genaiTokenTypeOutput)))
+	}
+
+	comparisonAttrs := []attribute.KeyValue{
+		attribute.Bool(aigwAttributeShadowSuccess, shadow.Success),
+		attribute.Bool(aigwAttributeShadowFinishReasonSame, primary.FinishReason == shadow.FinishReason),
+	}
+	if primary.JSONValid != nil {
+		comparisonAttrs = append(comparisonAttrs, attribute.Bool(aigwAttributeShadowPrimaryJSONValid, *primary.JSONValid))
+	}
+	if shadow.JSONValid != nil {
+		comparisonAttrs = append(comparisonAttrs, attribute.Bool(aigwAttributeShadowJSONValid, *shadow.JSONValid))
+	}
+	c.gateway.shadowComparisons.Add(ctx, 1, metric.WithAttributes(attrs...), metric.WithAttributes(comparisonAttrs...))
+}
+
+// RecordHedgedAttempts implements [ChatCompletionMetrics.RecordHedgedAttempts].
+func (c *chatCompletion) RecordHedgedAttempts(ctx context.Context, attempts int, extraAttrs ...attribute.KeyValue) {
+	c.gateway.hedgedAttempts.Add(ctx, int64(attempts), metric.WithAttributes(c.buildBaseAttributes(extraAttrs...)...))
+}
+
+// customChatCompletion records the metrics of [x.ChatCompletionMetrics] by the custom implementation, and the ones
+// specific to the AI Gateway features by the embedded default implementation. The request state is set on both so
+// that the latter have the same model and backend.
+type customChatCompletion struct {
+	*chatCompletion
+	custom x.ChatCompletionMetrics
+}
+
+// StartRequest implements [x.ChatCompletionMetrics.StartRequest].
+func (c *customChatCompletion) StartRequest(headers map[string]string) {
+	c.chatCompletion.StartRequest(headers)
+	c.custom.StartRequest(headers)
+}
+
+// SetModel implements [x.ChatCompletionMetrics.SetModel].
+func (c *customChatCompletion) SetModel(model string) {
+	c.chatCompletion.SetModel(model)
+	c.custom.SetModel(model)
+}
+
+// SetBackend implements [x.ChatCompletionMetrics.SetBackend].
+func (c *customChatCompletion) SetBackend(backend *filterapi.Backend) {
+	c.chatCompletion.SetBackend(backend)
+	c.custom.SetBackend(backend)
+}
+
+// RecordTokenUsage implements [x.ChatCompletionMetrics.RecordTokenUsage].
+func (c *customChatCompletion) RecordTokenUsage(ctx context.Context, inputTokens, outputTokens, totalTokens uint32, extraAttrs ...attribute.KeyValue) {
+	c.custom.RecordTokenUsage(ctx, inputTokens, outputTokens, totalTokens, extraAttrs...)
+}
+
+// RecordRequestCompletion implements [x.ChatCompletionMetrics.RecordRequestCompletion].
+func (c *customChatCompletion) RecordRequestCompletion(ctx context.Context, success bool, extraAttrs ...attribute.KeyValue) {
+	c.custom.RecordRequestCompletion(ctx, success, extraAttrs...)
+}
+
+// RecordTokenLatency implements [x.ChatCompletionMetrics.RecordTokenLatency].
+func (c *customChatCompletion) RecordTokenLatency(ctx context.Context, tokens uint32, extraAttrs ...attribute.KeyValue) {
+	c.custom.RecordTokenLatency(ctx, tokens, extraAttrs...)
+}
+
+// GetTimeToFirstTokenMs implements [x.ChatCompletionMetrics.GetTimeToFirstTokenMs].
+func (c *customChatCompletion) GetTimeToFirstTokenMs() float64 {
+	return c.custom.GetTimeToFirstTokenMs()
+}
+
+// GetInterTokenLatencyMs implements [x.ChatCompletionMetrics.GetInterTokenLatencyMs].
+func (c *customChatCompletion) GetInterTokenLatencyMs() float64 {
+	return c.custom.GetInterTokenLatencyMs()
+}
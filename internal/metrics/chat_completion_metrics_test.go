@@ -6,16 +6,22 @@
 package metrics
 
 import (
+	"context"
+	"fmt"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"k8s.io/utils/ptr"
 
 	"github.com/envoyproxy/ai-gateway/filterapi"
+	"github.com/envoyproxy/ai-gateway/filterapi/x"
 )
 
 func TestNewProcessorMetrics(t *testing.T) {
@@ -167,6 +173,300 @@ func TestGetTimeToFirstTokenMsAndGetInterTokenLatencyMs(t *testing.T) {
 }
 
 // getHistogramValues returns the count and sum of a histogram metric with the given attributes.
+func TestRecordPrefixCacheAffinity(t *testing.T) {
+	var (
+		mr    = metric.NewManualReader()
+		meter = metric.NewMeterProvider(metric.WithReader(mr)).Meter("test")
+		pm    = DefaultChatCompletion(meter).(*chatCompletion)
+
+		attrs = []attribute.KeyValue{
+			attribute.Key(genaiAttributeOperationName).String(genaiOperationChat),
+			attribute.Key(genaiAttributeSystemName).String(genaiSystemOpenAI),
+			attribute.Key(genaiAttributeRequestModel).String("test-model"),
+			attribute.Key("x_amg_id").String("unknown"),
+		}
+		hitAttrs  = attribute.NewSet(append(attrs, attribute.Bool(aigwAttributePrefixCacheAffinityHit, true))...)
+		missAttrs = attribute.NewSet(append(attrs, attribute.Bool(aigwAttributePrefixCacheAffinityHit, false))...)
+	)
+
+	pm.SetModel("test-model")
+	pm.SetBackend(&filterapi.Backend{Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI}})
+	pm.RecordPrefixCacheAffinity(t.Context(), true)
+	pm.RecordPrefixCacheAffinity(t.Context(), true)
+	pm.RecordPrefixCacheAffinity(t.Context(), false)
+
+	assert.Equal(t, int64(2), getCounterValue(t, mr, aigwMetricPrefixCacheAffinityRequests, hitAttrs))
+	assert.Equal(t, int64(1), getCounterValue(t, mr, aigwMetricPrefixCacheAffinityRequests, missAttrs))
+}
+
+func TestRecordHedgedAttempts(t *testing.T) {
+	var (
+		mr    = metric.NewManualReader()
+		meter = metric.NewMeterProvider(metric.WithReader(mr)).Meter("test")
+		pm    = DefaultChatCompletion(meter).(*chatCompletion)
+
+		attrs = attribute.NewSet(
+			attribute.Key(genaiAttributeOperationName).String(genaiOperationChat),
+			attribute.Key(genaiAttributeSystemName).String(genaiSystemOpenAI),
+			attribute.Key(genaiAttributeRequestModel).String("test-model"),
+			attribute.Key("x_amg_id").String("unknown"),
+		)
+	)
+
+	pm.SetModel("test-model")
+	pm.SetBackend(&filterapi.Backend{Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI}})
+	pm.RecordHedgedAttempts(t.Context(), 1)
+	pm.RecordHedgedAttempts(t.Context(), 2)
+
+	assert.Equal(t, int64(3), getCounterValue(t, mr, aigwMetricHedgedAttempts, attrs))
+}
+
+func TestRecordShadowComparison(t *testing.T) {
+	var (
+		mr    = metric.NewManualReader()
+		meter = metric.NewMeterProvider(metric.WithReader(mr)).Meter("test")
+		pm    = DefaultChatCompletion(meter).(*chatCompletion)
+
+		attrs = []attribute.KeyValue{
+			attribute.Key(genaiAttributeOperationName).String(genaiOperationChat),
+			attribute.Key(genaiAttributeRequestModel).String("test-model"),
+			attribute.Key(aigwAttributeShadowBackend).String("candidate"),
+		}
+		primaryAttrs = append(slices.Clone(attrs), attribute.Key(aigwAttributeShadowRole).String(aigwShadowRolePrimary))
+		shadowAttrs  = append(slices.Clone(attrs), attribute.Key(aigwAttributeShadowRole).String(aigwShadowRoleShadow))
+	)
+
+	primary := &ShadowResult{Backend: "primary", Success: true, Latency: time.Second, InputTokens: 10, OutputTokens: 5, FinishReason: "stop", JSONValid: ptr.To(true)}
+	shadow := &ShadowResult{Backend: "candidate", Success: true, Latency: 2 * time.Second, InputTokens: 10, OutputTokens: 8, FinishReason: "length", JSONValid: ptr.To(false)}
+	pm.RecordShadowComparison(t.Context(), "test-model", primary, shadow)
+
+	count, sum := getHistogramValues(t, mr, aigwMetricShadowRequestDuration, attribute.NewSet(primaryAttrs...))
+	assert.Equal(t, uint64(1), count)
+	assert.Equal(t, 1.0, sum)
+	count, sum = getHistogramValues(t, mr, aigwMetricShadowRequestDuration, attribute.NewSet(shadowAttrs...))
+	assert.Equal(t, uint64(1), count)
+	assert.Equal(t, 2.0, sum)
+	_, sum = getHistogramValues(t, mr, aigwMetricShadowTokenUsage,
+		attribute.NewSet(append(shadowAttrs, attribute.Key(genaiAttributeTokenType).String(genaiTokenTypeOutput))...))
+	assert.Equal(t, 8.0, sum)
+	_, sum = getHistogramValues(t, mr, aigwMetricShadowTokenUsage,
+		attribute.NewSet(append(primaryAttrs, attribute.Key(genaiAttributeTokenType).String(genaiTokenTypeInput))...))
+	assert.Equal(t, 10.0, sum)
+
+	comparisonAttrs := attribute.NewSet(append(attrs,
+		attribute.Bool(aigwAttributeShadowSuccess, true),
+		attribute.Bool(aigwAttributeShadowFinishReasonSame, false),
+		attribute.Bool(aigwAttributeShadowPrimaryJSONValid, true),
+		attribute.Bool(aigwAttributeShadowJSONValid, false),
+	)...)
+	assert.Equal(t, int64(1), getCounterValue(t, mr, aigwMetricShadowComparisons, comparisonAttrs))
+}
+
+func TestConcurrencyQueueMetrics(t *testing.T) {
+	var (
+		mr    = metric.NewManualReader()
+		meter = metric.NewMeterProvider(metric.WithReader(mr)).Meter("test")
+		pm    = DefaultChatCompletion(meter).(*chatCompletion)
+
+		depthAttrs = attribute.NewSet(attribute.Key(aigwAttributeBackend).String("ns/backend"))
+		waitAttrs  = func(admitted bool) attribute.Set {
+			return attribute.NewSet(
+				attribute.Key(genaiAttributeOperationName).String(genaiOperationChat),
+				attribute.Key(aigwAttributeBackend).String("ns/backend"),
+				attribute.Bool(aigwAttributeQueueAdmitted, admitted),
+			)
+		}
+	)
+
+	pm.AddConcurrencyQueueDepth(t.Context(), "ns/backend", 1)
+	pm.AddConcurrencyQueueDepth(t.Context(), "ns/backend", 1)
+	pm.AddConcurrencyQueueDepth(t.Context(), "ns/backend", -1)
+	assert.Equal(t, int64(1), getCounterValue(t, mr, aigwMetricConcurrencyQueueDepth, depthAttrs))
+
+	pm.RecordConcurrencyQueueWait(t.Context(), "ns/backend", 2*time.Second, true)
+	pm.RecordConcurrencyQueueWait(t.Context(), "ns/backend", 10*time.Second, false)
+	count, sum := getHistogramValues(t, mr, aigwMetricConcurrencyQueueWait, waitAttrs(true))
+	assert.Equal(t, uint64(1), count)
+	assert.Equal(t, 2.0, sum)
+	count, sum = getHistogramValues(t, mr, aigwMetricConcurrencyQueueWait, waitAttrs(false))
+	assert.Equal(t, uint64(1), count)
+	assert.Equal(t, 10.0, sum)
+}
+
+func TestRecordCost(t *testing.T) {
+	var (
+		mr    = metric.NewManualReader()
+		meter = metric.NewMeterProvider(metric.WithReader(mr)).Meter("test")
+		pm    = DefaultChatCompletion(meter).(*chatCompletion)
+
+		attrs = attribute.NewSet(
+			attribute.Key(genaiAttributeOperationName).String(genaiOperationChat),
+			attribute.Key(genaiAttributeSystemName).String(genaiSystemOpenAI),
+			attribute.Key(genaiAttributeRequestModel).String("test-model"),
+			attribute.Key("x_amg_id").String("unknown"),
+		)
+	)
+
+	pm.SetModel("test-model")
+	pm.SetBackend(&filterapi.Backend{Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI}})
+	pm.RecordCost(t.Context(), 1_500_000)
+	pm.RecordCost(t.Context(), 250_000)
+
+	var data metricdata.ResourceMetrics
+	require.NoError(t, mr.Collect(t.Context(), &data))
+	for _, sm := range data.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != aigwMetricUsageCost {
+				continue
+			}
+			dps := m.Data.(metricdata.Sum[float64]).DataPoints
+			require.Len(t, dps, 1)
+			assert.True(t, dps[0].Attributes.Equals(&attrs))
+			assert.InDelta(t, 1.75, dps[0].Value, 1e-9)
+			return
+		}
+	}
+	t.Fatalf("no datapoint found for %s", aigwMetricUsageCost)
+}
+
+func TestRecordGuardrailDetections(t *testing.T) {
+	var (
+		mr    = metric.NewManualReader()
+		meter = metric.NewMeterProvider(metric.WithReader(mr)).Meter("test")
+		pm    = DefaultChatCompletion(meter).(*chatCompletion)
+
+		attrs = attribute.NewSet(
+			attribute.Key(genaiAttributeOperationName).String(genaiOperationChat),
+			attribute.Key(aigwAttributeGuardrail).String("pii"),
+			attribute.Key(aigwAttributeGuardrailDetector).String("EMAIL"),
+			attribute.Key(aigwAttributeGuardrailAction).String("Mask"),
+		)
+	)
+
+	pm.RecordGuardrailDetections(t.Context(), "pii", "EMAIL", "Mask", 2)
+	pm.RecordGuardrailDetections(t.Context(), "pii", "EMAIL", "Mask", 1)
+	assert.Equal(t, int64(3), getCounterValue(t, mr, aigwMetricGuardrailDetections, attrs))
+}
+
+func TestRecordResponseCacheLookups(t *testing.T) {
+	var (
+		mr    = metric.NewManualReader()
+		meter = metric.NewMeterProvider(metric.WithReader(mr)).Meter("test")
+		pm    = DefaultChatCompletion(meter).(*chatCompletion)
+
+		attrs = func(hit bool) attribute.Set {
+			return attribute.NewSet(
+				attribute.Key(genaiAttributeOperationName).String(genaiOperationChat),
+				attribute.Key(genaiAttributeRequestModel).String("gpt"),
+				attribute.Key(aigwAttributeResponseCache).String("exact"),
+				attribute.Bool(aigwAttributeResponseCacheHit, hit),
+			)
+		}
+	)
+
+	pm.SetModel("gpt")
+	pm.RecordResponseCacheLookups(t.Context(), "exact", true, 1)
+	pm.RecordResponseCacheLookups(t.Context(), "exact", true, 2)
+	pm.RecordResponseCacheLookups(t.Context(), "exact", false, 1)
+	assert.Equal(t, int64(3), getCounterValue(t, mr, aigwMetricResponseCacheLookups, attrs(true)))
+	assert.Equal(t, int64(1), getCounterValue(t, mr, aigwMetricResponseCacheLookups, attrs(false)))
+
+	pm.RecordResponseCacheSimilarity(t.Context(), 0.9)
+	pm.RecordResponseCacheSimilarity(t.Context(), 0.8)
+	count, sum := getHistogramValues(t, mr, aigwMetricResponseCacheSimilarity, attribute.NewSet(
+		attribute.Key(genaiAttributeOperationName).String(genaiOperationChat),
+		attribute.Key(genaiAttributeRequestModel).String("gpt"),
+	))
+	assert.Equal(t, uint64(2), count)
+	assert.InDelta(t, 1.7, sum, 1e-9)
+}
+
+func TestNewChatCompletion_custom(t *testing.T) {
+	var (
+		mr     = metric.NewManualReader()
+		meter  = metric.NewMeterProvider(metric.WithReader(mr)).Meter("test")
+		custom = &testCustomChatCompletion{}
+		pm     = NewChatCompletion(meter, func(otelmetric.Meter) x.ChatCompletionMetrics { return custom })
+	)
+
+	pm.StartRequest(nil)
+	pm.SetModel("gpt")
+	pm.SetBackend(&filterapi.Backend{Name: "custom"})
+	pm.RecordTokenUsage(t.Context(), 10, 5, 15)
+	pm.RecordRequestCompletion(t.Context(), true)
+	require.Equal(t, []string{"StartRequest", "SetModel gpt", "SetBackend custom", "RecordTokenUsage 10 5 15", "RecordRequestCompletion true"}, custom.calls)
+	require.Equal(t, 42.0, pm.GetTimeToFirstTokenMs())
+	// The token usage is only recorded by the custom implementation.
+	var data metricdata.ResourceMetrics
+	require.NoError(t, mr.Collect(t.Context(), &data))
+	for _, sm := range data.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			require.NotEqual(t, genaiMetricClientTokenUsage, m.Name)
+		}
+	}
+
+	// The metrics of the AI Gateway features are recorded by the default implementation with the request state.
+	pm.RecordResponseCacheLookups(t.Context(), "exact", true, 1)
+	assert.Equal(t, int64(1), getCounterValue(t, mr, aigwMetricResponseCacheLookups, attribute.NewSet(
+		attribute.Key(genaiAttributeOperationName).String(genaiOperationChat),
+		attribute.Key(genaiAttributeRequestModel).String("gpt"),
+		attribute.Key(aigwAttributeResponseCache).String("exact"),
+		attribute.Bool(aigwAttributeResponseCacheHit, true),
+	)))
+}
+
+// testCustomChatCompletion is the custom x.ChatCompletionMetrics recording the calls.
+type testCustomChatCompletion struct{ calls []string }
+
+func (m *testCustomChatCompletion) StartRequest(map[string]string) {
+	m.calls = append(m.calls, "StartRequest")
+}
+
+func (m *testCustomChatCompletion) SetModel(model string) {
+	m.calls = append(m.calls, "SetModel "+model)
+}
+
+func (m *testCustomChatCompletion) SetBackend(backend *filterapi.Backend) {
+	m.calls = append(m.calls, "SetBackend "+backend.Name)
+}
+
+func (m *testCustomChatCompletion) RecordTokenUsage(_ context.Context, in, out, total uint32, _ ...attribute.KeyValue) {
+	m.calls = append(m.calls, fmt.Sprintf("RecordTokenUsage %d %d %d", in, out, total))
+}
+
+func (m *testCustomChatCompletion) RecordRequestCompletion(_ context.Context, success bool, _ ...attribute.KeyValue) {
+	m.calls = append(m.calls, fmt.Sprintf("RecordRequestCompletion %t", success))
+}
+
+func (m *testCustomChatCompletion) RecordTokenLatency(context.Context, uint32, ...attribute.KeyValue) {
+	m.calls = append(m.calls, "RecordTokenLatency")
+}
+
+func (m *testCustomChatCompletion) GetTimeToFirstTokenMs() float64 { return 42 }
+
+func (m *testCustomChatCompletion) GetInterTokenLatencyMs() float64 { return 1 }
+
+// getCounterValue returns the value of the counter metric with the given attributes.
+func getCounterValue(t *testing.T, reader metric.Reader, metric string, attrs attribute.Set) int64 {
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(t.Context(), &data))
+
+	for _, sm := range data.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != metric {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				if dp.Attributes.Equals(&attrs) {
+					return dp.Value
+				}
+			}
+		}
+	}
+	t.Fatalf("no datapoint found for attributes: %v", attrs)
+	return 0
+}
+
 func getHistogramValues(t *testing.T, reader metric.Reader, metric string, attrs attribute.Set) (uint64, float64) {
 	var data metricdata.ResourceMetrics
 	require.NoError(t, reader.Collect(t.Context(), &data))
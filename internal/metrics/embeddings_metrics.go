@@ -10,8 +10,6 @@ import (
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
-
-	"github.com/envoyproxy/ai-gateway/filterapi/x"
 )
 
 // embeddings is the implementation for the embeddings AI Gateway metrics.
@@ -20,7 +18,7 @@ type embeddings struct {
 }
 
 // NewEmbeddings creates a new Embeddings instance.
-func NewEmbeddings(meter metric.Meter) x.EmbeddingsMetrics {
+func NewEmbeddings(meter metric.Meter) EmbeddingsMetrics {
 	return &embeddings{
 		baseMetrics: newBaseMetrics(meter, genaiOperationEmbedding),
 	}
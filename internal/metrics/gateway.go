@@ -0,0 +1,169 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package metrics
+
+import "go.opentelemetry.io/otel/metric"
+
+const (
+	// Metric names and attributes specific to the AI Gateway which are not covered by the Semantic Conventions.
+
+	aigwMetricPrefixCacheAffinityRequests = "ai_gateway.prefix_cache_affinity.requests"
+	aigwMetricShadowRequestDuration       = "ai_gateway.shadow.request.duration"
+	aigwMetricShadowTokenUsage            = "ai_gateway.shadow.token.usage" // #nosec G101: Potential hardcoded credentials
+	aigwMetricShadowComparisons           = "ai_gateway.shadow.comparisons"
+	aigwMetricConcurrencyQueueDepth       = "ai_gateway.backend.queue.depth"
+	aigwMetricConcurrencyQueueWait        = "ai_gateway.backend.queue.wait.duration"
+	aigwMetricUsageCost                   = "gen_ai.usage.cost"
+	aigwMetricGuardrailDetections         = "ai_gateway.guardrail.detections"
+	aigwMetricResponseCacheLookups        = "ai_gateway.response_cache.lookups"
+	aigwMetricResponseCacheSimilarity     = "ai_gateway.response_cache.similarity"
+	aigwMetricHedgedAttempts              = "ai_gateway.hedge.attempts"
+
+	aigwAttributePrefixCacheAffinityHit = "ai_gateway.prefix_cache_affinity.hit"
+	aigwAttributeShadowRole             = "ai_gateway.shadow.role"
+	aigwAttributeShadowBackend          = "ai_gateway.shadow.backend"
+	aigwAttributeShadowSuccess          = "ai_gateway.shadow.success"
+	aigwAttributeShadowFinishReasonSame = "ai_gateway.shadow.finish_reason_match"
+	aigwAttributeShadowPrimaryJSONValid = "ai_gateway.shadow.primary_json_valid"
+	aigwAttributeShadowJSONValid        = "ai_gateway.shadow.shadow_json_valid"
+	aigwAttributeBackend                = "ai_gateway.backend"
+	aigwAttributeQueueAdmitted          = "ai_gateway.backend.queue.admitted"
+	aigwAttributeGuardrail              = "ai_gateway.guardrail"
+	aigwAttributeGuardrailDetector      = "ai_gateway.guardrail.detector"
+	aigwAttributeGuardrailAction        = "ai_gateway.guardrail.action"
+	aigwAttributeResponseCache          = "ai_gateway.response_cache"
+	aigwAttributeResponseCacheHit       = "ai_gateway.response_cache.hit"
+
+	aigwShadowRolePrimary = "primary"
+	aigwShadowRoleShadow  = "shadow"
+)
+
+// aiGateway holds metrics specific to the AI Gateway features.
+type aiGateway struct {
+	// prefixCacheAffinityRequests is the number of requests routed with the prefix cache affinity whose prompt prefix
+	// has been seen before, partitioned by whether the same endpoint as the previous request was selected.
+	// The affinity hit ratio is the ratio of the hit=true partition over the total.
+	prefixCacheAffinityRequests metric.Int64Counter
+	// shadowRequestDuration is the latency of the primary and shadow requests compared by the traffic shadowing,
+	// partitioned by the role.
+	shadowRequestDuration metric.Float64Histogram
+	// shadowTokenUsage is the token usage of the primary and shadow requests compared by the traffic shadowing,
+	// partitioned by the role and the token type. This is the only metric where the shadow token usage is recorded.
+	shadowTokenUsage metric.Float64Histogram
+	// shadowComparisons is the number of the compared pairs of primary and shadow responses, partitioned by
+	// the success of the shadow request, whether the finish reasons match, and the JSON validity of both responses.
+	shadowComparisons metric.Int64Counter
+	// concurrencyQueueDepth is the number of the requests waiting in the queue of the backend with the concurrency limit.
+	concurrencyQueueDepth metric.Int64UpDownCounter
+	// concurrencyQueueWait is the duration for which the requests waited in the queue of the backend with the
+	// concurrency limit, partitioned by whether the request was admitted or spilled over.
+	concurrencyQueueWait metric.Float64Histogram
+	// usageCost is the cost of the requests in USD computed from the prices in the pricing catalog.
+	usageCost metric.Float64Counter
+	// guardrailDetections is the number of the values detected by the guardrails, partitioned by the guardrail,
+	// the detector and the action taken on them.
+	guardrailDetections metric.Int64Counter
+	// responseCacheLookups is the number of the lookups in the response caches, partitioned by the kind of the cache
+	// and whether they hit. The hit ratio is the ratio of the hit=true partition over the total.
+	responseCacheLookups metric.Int64Counter
+	// responseCacheSimilarity is the cosine similarity of the most similar cached request found by the semantic
+	// cache, which helps to tune the similarity threshold.
+	responseCacheSimilarity metric.Float64Histogram
+	// hedgedAttempts is the number of the extra attempts sent to the backends by the hedge policies.
+	hedgedAttempts metric.Int64Counter
+}
+
+// newAIGateway creates a new aiGateway metrics instance.
+func newAIGateway(meter metric.Meter) *aiGateway {
+	return &aiGateway{
+		prefixCacheAffinityRequests: mustRegisterCounter(meter,
+			aigwMetricPrefixCacheAffinityRequests,
+			metric.WithDescription("Number of requests with a previously seen prompt prefix, by whether the same endpoint was selected."),
+			metric.WithUnit("{request}"),
+		),
+		shadowRequestDuration: mustRegisterHistogram(meter,
+			aigwMetricShadowRequestDuration,
+			metric.WithDescription("Time spent by the backend to process the request compared by the traffic shadowing."),
+			metric.WithUnit("s"),
+			metric.WithExplicitBucketBoundaries(0.01, 0.02, 0.04, 0.08, 0.16, 0.32, 0.64, 1.28, 2.56, 5.12, 10.24, 20.48, 40.96, 81.92),
+		),
+		shadowTokenUsage: mustRegisterHistogram(meter,
+			aigwMetricShadowTokenUsage,
+			metric.WithDescription("Number of tokens processed by the requests compared by the traffic shadowing."),
+			metric.WithUnit("token"),
+			metric.WithExplicitBucketBoundaries(1, 4, 16, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216, 67108864),
+		),
+		shadowComparisons: mustRegisterCounter(meter,
+			aigwMetricShadowComparisons,
+			metric.WithDescription("Number of the compared pairs of the primary and shadow responses."),
+			metric.WithUnit("{request}"),
+		),
+		concurrencyQueueDepth: mustRegisterUpDownCounter(meter,
+			aigwMetricConcurrencyQueueDepth,
+			metric.WithDescription("Number of the requests waiting for the concurrency limit of the backend."),
+			metric.WithUnit("{request}"),
+		),
+		concurrencyQueueWait: mustRegisterHistogram(meter,
+			aigwMetricConcurrencyQueueWait,
+			metric.WithDescription("Time spent by the request waiting for the concurrency limit of the backend."),
+			metric.WithUnit("s"),
+			metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60),
+		),
+		usageCost: mustRegisterFloat64Counter(meter,
+			aigwMetricUsageCost,
+			metric.WithDescription("Cost of the requests computed from the prices of the models."),
+			metric.WithUnit("USD"),
+		),
+		guardrailDetections: mustRegisterCounter(meter,
+			aigwMetricGuardrailDetections,
+			metric.WithDescription("Number of the values detected in the requests and the responses by the guardrails."),
+			metric.WithUnit("{detection}"),
+		),
+		responseCacheLookups: mustRegisterCounter(meter,
+			aigwMetricResponseCacheLookups,
+			metric.WithDescription("Number of the lookups in the response caches, by whether the cached response was found."),
+			metric.WithUnit("{lookup}"),
+		),
+		responseCacheSimilarity: mustRegisterHistogram(meter,
+			aigwMetricResponseCacheSimilarity,
+			metric.WithDescription("Cosine similarity of the most similar cached request found by the semantic cache."),
+			metric.WithUnit("1"),
+			metric.WithExplicitBucketBoundaries(0.5, 0.6, 0.7, 0.75, 0.8, 0.85, 0.9, 0.92, 0.94, 0.95, 0.96, 0.97, 0.98, 0.99),
+		),
+		hedgedAttempts: mustRegisterCounter(meter,
+			aigwMetricHedgedAttempts,
+			metric.WithDescription("Number of the extra attempts sent to the backends by the hedge policies."),
+			metric.WithUnit("{attempt}"),
+		),
+	}
+}
+
+// mustRegisterCounter registers a counter with the meter and panics if it fails.
+func mustRegisterCounter(meter metric.Meter, name string, options ...metric.Int64CounterOption) metric.Int64Counter {
+	c, err := meter.Int64Counter(name, options...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// mustRegisterFloat64Counter registers a float64 counter with the meter and panics if it fails.
+func mustRegisterFloat64Counter(meter metric.Meter, name string, options ...metric.Float64CounterOption) metric.Float64Counter {
+	c, err := meter.Float64Counter(name, options...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// mustRegisterUpDownCounter registers an up-down counter with the meter and panics if it fails.
+func mustRegisterUpDownCounter(meter metric.Meter, name string, options ...metric.Int64UpDownCounterOption) metric.Int64UpDownCounter {
+	c, err := meter.Int64UpDownCounter(name, options...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,106 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/envoyproxy/ai-gateway/filterapi/x"
+)
+
+// ChatCompletionMetrics is the [x.ChatCompletionMetrics] extended with the recorders of the metrics specific to the
+// AI Gateway features.
+//
+// The recorders are kept out of the public interface so that the custom implementations set by
+// [x.NewCustomChatCompletionMetrics] keep compiling as the features are added. They are always recorded by the
+// built-in instruments, see [NewChatCompletion].
+type ChatCompletionMetrics interface {
+	x.ChatCompletionMetrics
+	GatewayMetrics
+
+	// RecordPrefixCacheAffinity records whether the request whose prompt prefix has been seen before was routed
+	// to the same endpoint as the previous one. This is only called when the prefix cache affinity is enabled.
+	RecordPrefixCacheAffinity(ctx context.Context, hit bool, extraAttrs ...attribute.KeyValue)
+	// RecordShadowComparison records the comparison between the primary response and the shadow response of
+	// the request mirrored by the traffic shadowing. This is called once both responses have been processed.
+	//
+	// The shadow requests are not recorded in the other metrics, so their token usage is only available here.
+	RecordShadowComparison(ctx context.Context, model string, primary, shadow *ShadowResult, extraAttrs ...attribute.KeyValue)
+	// RecordHedgedAttempts records the number of the extra attempts sent to the backends by the hedge policy of the
+	// rule. Their estimated token usage is recorded by RecordTokenUsage with the attribute of the hedged attempts.
+	RecordHedgedAttempts(ctx context.Context, attempts int, extraAttrs ...attribute.KeyValue)
+}
+
+// EmbeddingsMetrics is the [x.EmbeddingsMetrics] extended with the recorders of the metrics specific to the
+// AI Gateway features.
+type EmbeddingsMetrics interface {
+	x.EmbeddingsMetrics
+	GatewayMetrics
+}
+
+// GatewayMetrics is the interface for the metrics of the AI Gateway features shared by all the operations.
+type GatewayMetrics interface {
+	ConcurrencyQueueMetrics
+	CostMetrics
+	GuardrailMetrics
+	ResponseCacheMetrics
+}
+
+// ConcurrencyQueueMetrics is the interface for the metrics of the queue of the backends with the concurrency limit.
+type ConcurrencyQueueMetrics interface {
+	// AddConcurrencyQueueDepth adds the delta to the number of the requests waiting in the queue of the backend.
+	// The backend is the key of the concurrency limit, which identifies the AIServiceBackend.
+	AddConcurrencyQueueDepth(ctx context.Context, backend string, delta int64)
+	// RecordConcurrencyQueueWait records the duration for which the request waited in the queue of the backend,
+	// and whether the request was admitted to the backend or spilled over.
+	RecordConcurrencyQueueWait(ctx context.Context, backend string, wait time.Duration, admitted bool)
+}
+
+// CostMetrics is the interface for the metrics of the cost of the requests computed from the pricing catalog.
+type CostMetrics interface {
+	// RecordCost records the cost of the request in micro-USD. This is only called for the models with the price.
+	RecordCost(ctx context.Context, costMicroUSD uint64, extraAttrs ...attribute.KeyValue)
+}
+
+// GuardrailMetrics is the interface for the metrics of the guardrails of the AIGatewayRoutes.
+type GuardrailMetrics interface {
+	// RecordGuardrailDetections records the number of the detections by the detector of the guardrail in a request,
+	// and the action taken on them. This is called by the router filter before the backend is selected.
+	RecordGuardrailDetections(ctx context.Context, guardrail, detector, action string, count int, extraAttrs ...attribute.KeyValue)
+}
+
+// ResponseCacheMetrics is the interface for the metrics of the response caches of the AIGatewayRoutes.
+type ResponseCacheMetrics interface {
+	// RecordResponseCacheLookups records the number of the lookups in the response cache and whether they hit.
+	// The cache is the kind of the cache, either "exact" or "semantic". This is called by the router filter before
+	// the backend is selected.
+	RecordResponseCacheLookups(ctx context.Context, cache string, hit bool, count int, extraAttrs ...attribute.KeyValue)
+	// RecordResponseCacheSimilarity records the cosine similarity of the most similar cached request found by the
+	// semantic cache, regardless of whether it exceeds the similarity threshold.
+	RecordResponseCacheSimilarity(ctx context.Context, similarity float64, extraAttrs ...attribute.KeyValue)
+}
+
+// ShadowResult is the summary of a response compared by the traffic shadowing.
+type ShadowResult struct {
+	// Backend is the name of the backend which served the response.
+	Backend string
+	// Success is true if the backend responded successfully.
+	Success bool
+	// Latency is the time spent from sending the request to the backend to receiving the end of the response.
+	Latency time.Duration
+	// InputTokens is the number of the input tokens reported by the backend.
+	InputTokens uint32
+	// OutputTokens is the number of the output tokens reported by the backend.
+	OutputTokens uint32
+	// FinishReason is the finish reason of the first choice in the response. Empty if unknown.
+	FinishReason string
+	// JSONValid is true if the content of the first choice is a valid JSON. This is nil unless the request
+	// asked for the structured outputs.
+	JSONValid *bool
+}
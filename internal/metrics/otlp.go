@@ -0,0 +1,79 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+)
+
+const (
+	// OTLPProtocolGRPC and OTLPProtocolHTTP are the protocols of the OTLP metrics exporter, which are the same as the
+	// values of the OTEL_EXPORTER_OTLP_PROTOCOL environment variable.
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http/protobuf"
+)
+
+// NewOTLPReader creates the reader periodically pushing the metrics to the OTLP endpoint with the protocol.
+//
+// The endpoint is the URL such as http://otel-collector:4318, and the "/v1/metrics" path is appended for the
+// OTLP/HTTP protocol. If the endpoint is empty, it is taken from the standard OTEL_EXPORTER_OTLP_METRICS_ENDPOINT or
+// OTEL_EXPORTER_OTLP_ENDPOINT environment variables as well as the other settings such as the headers. Likewise, the
+// zero interval defaults to the OTEL_METRIC_EXPORT_INTERVAL environment variable or 60 seconds.
+func NewOTLPReader(ctx context.Context, endpoint, protocol string, interval time.Duration) (metricsdk.Reader, error) {
+	var u *url.URL
+	if endpoint != "" {
+		var err error
+		if u, err = url.Parse(endpoint); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid OTLP metrics endpoint %q", endpoint)
+		}
+	}
+
+	var exporter metricsdk.Exporter
+	var err error
+	switch protocol {
+	case OTLPProtocolGRPC:
+		var opts []otlpmetricgrpc.Option
+		if u != nil {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(u.Host))
+			if u.Scheme == "http" {
+				opts = append(opts, otlpmetricgrpc.WithInsecure())
+			}
+		}
+		exporter, err = otlpmetricgrpc.New(ctx, opts...)
+	case OTLPProtocolHTTP:
+		var opts []otlpmetrichttp.Option
+		if u != nil {
+			path := strings.TrimSuffix(u.Path, "/")
+			if !strings.HasSuffix(path, "/v1/metrics") {
+				path += "/v1/metrics"
+			}
+			opts = append(opts, otlpmetrichttp.WithEndpoint(u.Host), otlpmetrichttp.WithURLPath(path))
+			if u.Scheme == "http" {
+				opts = append(opts, otlpmetrichttp.WithInsecure())
+			}
+		}
+		exporter, err = otlpmetrichttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("invalid OTLP metrics protocol %q", protocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP metrics exporter: %w", err)
+	}
+
+	var opts []metricsdk.PeriodicReaderOption
+	if interval > 0 {
+		opts = append(opts, metricsdk.WithInterval(interval))
+	}
+	return metricsdk.NewPeriodicReader(exporter, opts...), nil
+}
@@ -0,0 +1,71 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+func TestNewOTLPReader(t *testing.T) {
+	t.Run("http", func(t *testing.T) {
+		received := make(chan *colmetricspb.ExportMetricsServiceRequest, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/otlp/v1/metrics" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			var req colmetricspb.ExportMetricsServiceRequest
+			require.NoError(t, proto.Unmarshal(body, &req))
+			received <- &req
+		}))
+		defer srv.Close()
+
+		reader, err := NewOTLPReader(t.Context(), srv.URL+"/otlp/", OTLPProtocolHTTP, 0)
+		require.NoError(t, err)
+		provider := metricsdk.NewMeterProvider(metricsdk.WithReader(reader))
+		ccm := DefaultChatCompletion(provider.Meter("envoyproxy/ai-gateway"))
+		ccm.StartRequest(nil)
+		ccm.SetModel("gpt")
+		ccm.SetBackend(&filterapi.Backend{Name: "backend", Schema: filterapi.VersionedAPISchema{Name: filterapi.APISchemaOpenAI}})
+		ccm.RecordTokenUsage(t.Context(), 10, 5, 15)
+		// The metrics are pushed on the shutdown without waiting for the interval.
+		require.NoError(t, provider.Shutdown(t.Context()))
+
+		req := <-received
+		var names []string
+		for _, sm := range req.ResourceMetrics[0].ScopeMetrics {
+			for _, m := range sm.Metrics {
+				names = append(names, m.Name)
+			}
+		}
+		require.Contains(t, names, genaiMetricClientTokenUsage)
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		reader, err := NewOTLPReader(t.Context(), "http://127.0.0.1:4317", OTLPProtocolGRPC, 0)
+		require.NoError(t, err)
+		require.NotNil(t, reader)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewOTLPReader(t.Context(), "otel-collector", OTLPProtocolHTTP, 0)
+		require.EqualError(t, err, `invalid OTLP metrics endpoint "otel-collector"`)
+		_, err = NewOTLPReader(t.Context(), "", "http/json", 0)
+		require.EqualError(t, err, `invalid OTLP metrics protocol "http/json"`)
+	})
+}
@@ -0,0 +1,51 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package internaltesting
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// NewRecordingServer starts a server which records the last request and responds with the status. This is used to
+// test the sinks exporting the records over HTTP.
+func NewRecordingServer(t *testing.T, status int) (*httptest.Server, *http.Request, *[]byte) {
+	var (
+		lastReq  http.Request
+		lastBody []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastReq = *r
+		lastBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("response"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &lastReq, &lastBody
+}
+
+// ReadRecordIDs returns the "id" fields of the records in the JSON lines file.
+func ReadRecordIDs(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	var ids []string
+	for s := bufio.NewScanner(f); s.Scan(); {
+		var r struct {
+			ID string `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal(s.Bytes(), &r))
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
@@ -0,0 +1,109 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+// Package tracing provides the OpenTelemetry tracing of the requests processed by the external processor according
+// to the Semantic Conventions for Generative AI Spans.
+// See: https://opentelemetry.io/docs/specs/semconv/gen-ai/gen-ai-spans/
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+const (
+	// ScopeName is the name of the instrumentation scope of the spans.
+	ScopeName = "github.com/envoyproxy/ai-gateway/internal/extproc"
+	// serviceName is the service name of the resource of the spans.
+	serviceName = "ai-gateway-extproc"
+)
+
+// Span attributes and event names according to the Semantic Conventions for Generative AI Spans.
+const (
+	AttributeOperationName         = "gen_ai.operation.name"
+	AttributeSystem                = "gen_ai.system"
+	AttributeRequestModel          = "gen_ai.request.model"
+	AttributeRequestMaxTokens      = "gen_ai.request.max_tokens"
+	AttributeRequestTemperature    = "gen_ai.request.temperature"
+	AttributeRequestTopP           = "gen_ai.request.top_p"
+	AttributeResponseID            = "gen_ai.response.id"
+	AttributeResponseModel         = "gen_ai.response.model"
+	AttributeResponseFinishReasons = "gen_ai.response.finish_reasons"
+	AttributeUsageInputTokens      = "gen_ai.usage.input_tokens"  // #nosec G101: Potential hardcoded credentials
+	AttributeUsageOutputTokens     = "gen_ai.usage.output_tokens" // #nosec G101: Potential hardcoded credentials
+	AttributeErrorType             = "error.type"
+	AttributeHTTPStatusCode        = "http.response.status_code"
+
+	// EventPrompt is the event with the messages of the request in the AttributePrompt as JSON, and EventCompletion
+	// is the event with the choices of the response in the AttributeCompletion as JSON.
+	EventPrompt         = "gen_ai.content.prompt"
+	AttributePrompt     = "gen_ai.prompt"
+	EventCompletion     = "gen_ai.content.completion"
+	AttributeCompletion = "gen_ai.completion"
+
+	OperationChat       = "chat"
+	OperationEmbeddings = "embeddings"
+)
+
+// System returns the gen_ai.system of the backend with the API schema.
+func System(schema filterapi.APISchemaName) string {
+	switch schema {
+	case filterapi.APISchemaOpenAI:
+		return "openai"
+	case filterapi.APISchemaAWSBedrock:
+		return "aws.bedrock"
+	case filterapi.APISchemaAzureOpenAI:
+		return "az.ai.openai"
+	case filterapi.APISchemaGCPVertexAI:
+		return "gcp.vertex_ai"
+	case filterapi.APISchemaGCPAnthropic:
+		return "anthropic"
+	default:
+		return "_OTHER"
+	}
+}
+
+// Propagator is the propagator of the trace context and the baggage in the W3C format, which joins the trace of the
+// incoming request and propagates it to the upstream request.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// NewTracerProvider creates a new TracerProvider exporting the spans to the OTLP/HTTP endpoint, e.g.
+// "http://otel-collector:4318". The "/v1/traces" path is appended unless the endpoint already has it.
+//
+// The traces are sampled with the ratio from 0 to 1 unless the parent span of the incoming request is sampled or
+// not, in which case the decision of the parent is followed.
+func NewTracerProvider(ctx context.Context, endpoint string, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid tracing endpoint %q", endpoint)
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(path, "/v1/traces") {
+		path += "/v1/traces"
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithURLPath(path)}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	), nil
+}
@@ -0,0 +1,69 @@
+// Copyright Envoy AI Gateway Authors
+// SPDX-License-Identifier: Apache-2.0
+// The full text of the Apache license is available in the LICENSE file at
+// the root of the repo.
+
+package tracing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/envoyproxy/ai-gateway/filterapi"
+)
+
+func TestSystem(t *testing.T) {
+	for schema, want := range map[filterapi.APISchemaName]string{
+		filterapi.APISchemaOpenAI:       "openai",
+		filterapi.APISchemaAWSBedrock:   "aws.bedrock",
+		filterapi.APISchemaAzureOpenAI:  "az.ai.openai",
+		filterapi.APISchemaGCPVertexAI:  "gcp.vertex_ai",
+		filterapi.APISchemaGCPAnthropic: "anthropic",
+		"Unknown":                       "_OTHER",
+	} {
+		require.Equal(t, want, System(schema), schema)
+	}
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	t.Run("export", func(t *testing.T) {
+		received := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/otlp/v1/traces" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			var req coltracepb.ExportTraceServiceRequest
+			require.NoError(t, proto.Unmarshal(body, &req))
+			received <- &req
+		}))
+		defer srv.Close()
+
+		tp, err := NewTracerProvider(t.Context(), srv.URL+"/otlp/", 1)
+		require.NoError(t, err)
+		_, span := tp.Tracer(ScopeName).Start(t.Context(), "chat gpt")
+		span.End()
+		require.NoError(t, tp.Shutdown(t.Context()))
+
+		req := <-received
+		require.Len(t, req.ResourceSpans, 1)
+		rs := req.ResourceSpans[0]
+		require.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+		require.Equal(t, "ai-gateway-extproc", rs.Resource.Attributes[0].Value.GetStringValue())
+		require.Equal(t, ScopeName, rs.ScopeSpans[0].Scope.Name)
+		require.Equal(t, "chat gpt", rs.ScopeSpans[0].Spans[0].Name)
+	})
+
+	t.Run("invalid endpoint", func(t *testing.T) {
+		_, err := NewTracerProvider(t.Context(), "otel-collector", 1)
+		require.EqualError(t, err, `invalid tracing endpoint "otel-collector"`)
+	})
+}
@@ -709,7 +709,8 @@ func TestSecretController(t *testing.T) {
 	require.NoError(t, err)
 
 	eventCh := internaltesting.NewControllerEventChan[*aigv1a1.BackendSecurityPolicy]()
-	sc := controller.NewSecretController(mgr.GetClient(), k, defaultLogger(), eventCh.Ch)
+	consumerKeyEventCh := internaltesting.NewControllerEventChan[*aigv1a1.ConsumerKey]()
+	sc := controller.NewSecretController(mgr.GetClient(), k, defaultLogger(), eventCh.Ch, consumerKeyEventCh.Ch)
 	const secretName, secretNamespace = "mysecret", "default"
 
 	err = ctrl.NewControllerManagedBy(mgr).For(&corev1.Secret{}).Complete(sc)